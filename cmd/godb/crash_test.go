@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
+)
+
+// クラッシュテストの子プロセスに作業ディレクトリを渡す環境変数
+const crashWorkloadEnv = "GODB_CRASH_WORKLOAD"
+
+const (
+	crashAccounts       = 10
+	crashInitialBalance = 100
+)
+
+// TestCrashRecovery は送金を続けるプロセスを任意の時点で SIGKILL し、
+// 再起動後のリカバリでデータが一貫していることを確かめる
+//   - 口座の残高の合計が変わらない（途中のトランザクションが取り消される）
+//   - 完了を報告した送金はすべて残っている（コミットが失われない）
+func TestCrashRecovery(t *testing.T) {
+	if testing.Short() {
+		t.Skip("crash test is skipped in short mode")
+	}
+	dir := t.TempDir()
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	lastCommitted := 0
+	for round := 0; round < 6; round++ {
+		committed := runCrashWorkload(t, dir, time.Duration(20+rng.Intn(200))*time.Millisecond)
+		lastCommitted = max(lastCommitted, committed)
+		verifyAfterCrash(t, dir, lastCommitted)
+	}
+	if lastCommitted == 0 {
+		t.Error("the workload never committed a transfer")
+	}
+}
+
+// runCrashWorkload は子プロセスで送金を実行し、delay 後に強制終了する
+// 戻り値は子プロセスが完了を報告した最後の送金番号
+func runCrashWorkload(t *testing.T, dir string, delay time.Duration) int {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestCrashWorkload$")
+	cmd.Env = append(os.Environ(), crashWorkloadEnv+"="+dir)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	reported := make(chan int, 1)
+	go func() {
+		last := 0
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			if id, ok := strings.CutPrefix(scanner.Text(), "committed "); ok {
+				last, _ = strconv.Atoi(id)
+			}
+		}
+		reported <- last
+	}()
+	time.Sleep(delay)
+	cmd.Process.Kill()
+	cmd.Wait()
+	return <-reported
+}
+
+// verifyAfterCrash はリカバリ後のデータを検査する
+func verifyAfterCrash(t *testing.T, dir string, lastCommitted int) {
+	t.Helper()
+	db, err := openDatabase(dir)
+	if err != nil {
+		t.Fatalf("openDatabase after crash failed: %v", err)
+	}
+	defer db.Close()
+	t.Logf("recovery: %s", db.report)
+
+	if !db.catalog.TableExists("accounts") || !db.catalog.TableExists("transfers") {
+		return // テーブルを作る前に終了した
+	}
+	result, err := db.session.Execute("SELECT * FROM accounts")
+	if err != nil {
+		t.Fatalf("SELECT accounts failed: %v", err)
+	}
+	rows := result.GetRows()
+	if len(rows) != 0 && len(rows) != crashAccounts {
+		t.Fatalf("expected 0 or %d accounts, got %d", crashAccounts, len(rows))
+	}
+	total := 0
+	for _, row := range rows {
+		total += int(row.GetValues()[1].(storage.Int32Value))
+		// 主キーのインデックスもテーブルと一致している
+		id := row.GetValues()[0].(storage.Int32Value)
+		byID, err := db.session.Execute(fmt.Sprintf("SELECT * FROM accounts WHERE id = %d", id))
+		if err != nil || byID.GetRowCount() != 1 {
+			t.Fatalf("index lookup for account %d returned %v (err=%v)", id, byID, err)
+		}
+	}
+	if len(rows) == crashAccounts && total != crashAccounts*crashInitialBalance {
+		t.Errorf("total balance changed: got %d, want %d", total, crashAccounts*crashInitialBalance)
+	}
+
+	result, err = db.session.Execute("SELECT * FROM transfers")
+	if err != nil {
+		t.Fatalf("SELECT transfers failed: %v", err)
+	}
+	seen := make(map[int]bool)
+	maxID := 0
+	for _, row := range result.GetRows() {
+		id := int(row.GetValues()[0].(storage.Int32Value))
+		seen[id] = true
+		maxID = max(maxID, id)
+	}
+	// 報告済みの送金は残り、番号は欠けずに続いている（コミット直後に終了した1件は残っていてもよい）
+	if maxID < lastCommitted {
+		t.Errorf("committed transfer %d was lost (max transfer is %d)", lastCommitted, maxID)
+	}
+	if len(seen) != maxID {
+		t.Errorf("transfers are not contiguous: %d rows, max id %d", len(seen), maxID)
+	}
+}
+
+// TestCrashWorkload は TestCrashRecovery から子プロセスとして起動され、終了させられるまで送金を続ける
+func TestCrashWorkload(t *testing.T) {
+	dir := os.Getenv(crashWorkloadEnv)
+	if dir == "" {
+		t.Skip("run by TestCrashRecovery")
+	}
+	db, err := openDatabase(dir)
+	if err != nil {
+		t.Fatalf("openDatabase failed: %v", err)
+	}
+	sess := db.session
+	exec := func(sql string) {
+		if _, err := sess.Execute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+	if !db.catalog.TableExists("accounts") {
+		exec("CREATE TABLE accounts (id INT PRIMARY KEY, balance INT)")
+	}
+	if !db.catalog.TableExists("transfers") {
+		exec("CREATE TABLE transfers (id INT PRIMARY KEY, amount INT)")
+	}
+	result, _ := sess.Execute("SELECT * FROM accounts")
+	if result.GetRowCount() == 0 {
+		exec("BEGIN")
+		for i := 1; i <= crashAccounts; i++ {
+			exec(fmt.Sprintf("INSERT INTO accounts (id, balance) VALUES (%d, %d)", i, crashInitialBalance))
+		}
+		exec("COMMIT")
+	}
+	result, _ = sess.Execute("SELECT * FROM transfers")
+	next := result.GetRowCount() + 1
+
+	balance := func(id int) int {
+		result, err := sess.Execute(fmt.Sprintf("SELECT * FROM accounts WHERE id = %d", id))
+		if err != nil || result.GetRowCount() != 1 {
+			t.Fatalf("balance of %d: %v", id, err)
+		}
+		return int(result.GetRows()[0].GetValues()[1].(storage.Int32Value))
+	}
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for {
+		from, to := 1+rng.Intn(crashAccounts), 1+rng.Intn(crashAccounts)
+		amount := rng.Intn(10)
+		exec("BEGIN")
+		exec(fmt.Sprintf("UPDATE accounts SET balance = %d WHERE id = %d", balance(from)-amount, from))
+		exec(fmt.Sprintf("UPDATE accounts SET balance = %d WHERE id = %d", balance(to)+amount, to))
+		if rng.Intn(5) == 0 {
+			// 取り消す送金も混ぜる
+			exec("ROLLBACK")
+			continue
+		}
+		exec(fmt.Sprintf("INSERT INTO transfers (id, amount) VALUES (%d, %d)", next, amount))
+		exec("COMMIT")
+		fmt.Printf("committed %d\n", next)
+		next++
+	}
+}
@@ -9,32 +9,85 @@ import (
 	"github.com/takeuchi-shogo/go-example-database/internal/dbtxn"
 	"github.com/takeuchi-shogo/go-example-database/internal/executor"
 	"github.com/takeuchi-shogo/go-example-database/internal/session"
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
 	"github.com/takeuchi-shogo/go-example-database/pkg/repl"
 )
 
 func main() {
 	dataDir := "data"
 
-	// カタログを作成
-	catalog, err := catalog.NewCatalog(dataDir)
+	db, err := openDatabase(dataDir)
 	if err != nil {
-		log.Fatalf("Failed to create catalog: %v", err)
+		log.Fatalf("Failed to open database: %v", err)
 	}
+	defer db.Close()
+	log.Printf("recovery: %s", db.report)
 
+	// REPL を起動
+	repl := repl.NewRepl(os.Stdin, os.Stdout, db.session)
+	repl.Run()
+}
+
+// database は起動したデータベースの構成要素
+type database struct {
+	catalog catalog.Catalog
+	wal     *dbtxn.WAL
+	session session.Session
+	report  *dbtxn.RecoveryReport
+}
+
+// openDatabase はカタログと WAL を開き、クラッシュリカバリを済ませてからセッションを作成する
+func openDatabase(dataDir string) (*database, error) {
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return nil, err
+	}
 	// WAL を作成
 	walPath := filepath.Join(dataDir, "wal.log")
 	wal, err := dbtxn.NewWAL(walPath)
 	if err != nil {
-		log.Fatalf("Failed to create WAL: %v", err)
+		return nil, err
+	}
+	// 同時にコミットするセッションの fsync をまとめる
+	wal.StartGroupCommit(dbtxn.DefaultGroupCommitConfig)
+
+	// カタログを作成（テーブルのページは WAL を書き出してからディスクに書く）
+	pool := storage.NewBufferPool(storage.DefaultBufferPoolFrames, storage.EvictionPolicyLRU)
+	wal.SetBufferPool(pool)
+	catalog, err := catalog.NewCatalogWithBufferPool(dataDir, pool)
+	if err != nil {
+		wal.Close()
+		return nil, err
+	}
+
+	// コミット済みの変更を再現し、終わっていないトランザクションを取り消す
+	report, err := dbtxn.NewRecoveryManager(wal, catalog).RecoverWithReport()
+	if err != nil {
+		catalog.Close()
+		wal.Close()
+		return nil, err
+	}
+	// リカバリの結果をページに書き出し、次の起動で読むログを減らす
+	if err := wal.Checkpoint(); err != nil {
+		catalog.Close()
+		wal.Close()
+		return nil, err
 	}
-	defer wal.Close()
 
 	// Executor と Session を作成
 	executor := executor.NewExecutor(catalog, wal)
 	session := session.NewSession(catalog, executor, wal)
-	defer session.Close()
+	return &database{catalog: catalog, wal: wal, session: session, report: report}, nil
+}
 
-	// REPL を起動
-	repl := repl.NewRepl(os.Stdin, os.Stdout, session)
-	repl.Run()
+// Close はテーブルを書き出し、チェックポイントを取ってから WAL を閉じる
+func (db *database) Close() error {
+	if err := db.session.Close(); err != nil {
+		db.wal.Close()
+		return err
+	}
+	if err := db.wal.Checkpoint(); err != nil {
+		db.wal.Close()
+		return err
+	}
+	return db.wal.Close()
 }
@@ -2,18 +2,24 @@
 catalog.go はデータベースのカタログを管理する
 スキーマの管理
 既存の internal/storage パッケージとの橋渡し
+テーブル定義は system_catalog.go でデータディレクトリに永続化する
 */
 package catalog
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sync"
 
+	"github.com/takeuchi-shogo/go-example-database/internal/index"
 	"github.com/takeuchi-shogo/go-example-database/internal/storage"
 )
 
+// ErrUncataloguedTableFile はカタログに載っていないテーブルのデータファイルが残っていることを表す
+var ErrUncataloguedTableFile = errors.New("table data file exists but is not in the catalog")
+
 type Catalog interface {
 	// CreateTable はテーブルを作成する
 	CreateTable(name string, schema *storage.Schema) error
@@ -27,27 +33,224 @@ type Catalog interface {
 	ListTables() []*storage.Table
 	// GetSchema はスキーマを取得する
 	GetSchema(name string) (*storage.Schema, error)
+	// GetBufferPool はテーブルが共有するバッファプールを取得する
+	GetBufferPool() *storage.BufferPool
+	// CreateIndex はテーブルのカラム（複合キーなら複数）にインデックスを作成する
+	CreateIndex(name, tableName string, columns []string, unique bool) error
+	// DropIndex はインデックスを削除する
+	DropIndex(name string) error
+	// GetIndexes はテーブルのインデックス定義の一覧を返す
+	GetIndexes(tableName string) []IndexInfo
+	// SetStatistics はテーブルの統計情報を保存する
+	SetStatistics(tableName string, stats *storage.TableStatistics) error
+	// GetStatistics はテーブルの統計情報を返す（ANALYZE していなければ nil）
+	GetStatistics(tableName string) *storage.TableStatistics
 	// Close はカタログを閉じる
 	Close() error
 }
 
+// IndexInfo はインデックスの定義
+type IndexInfo struct {
+	Name      string   // インデックス名
+	TableName string   // テーブル名
+	Columns   []string // カラム名（複合キーならキーの順）
+	Unique    bool     // ユニークインデックスかどうか
+	Primary   bool     // PRIMARY KEY から自動で作られたかどうか
+}
+
 // catalog はデータベースのカタログを管理する
 type catalog struct {
 	dataDir string
 	tables  map[string]*storage.Table
 	schemas map[string]*storage.Schema
+	indexes map[string][]IndexInfo              // テーブル名ごとのインデックス定義
+	stats   map[string]*storage.TableStatistics // テーブル名ごとの統計情報
+	pool    *storage.BufferPool
 	lock    sync.RWMutex
 }
 
+// NewCatalog はカタログを作成する
+// データディレクトリにシステムカタログがあれば読み込み、各テーブルの Pager を開き直す
 func NewCatalog(dataDir string) (Catalog, error) {
+	return NewCatalogWithBufferPool(dataDir, storage.NewBufferPool(storage.DefaultBufferPoolFrames, storage.EvictionPolicyLRU))
+}
+
+// NewCatalogWithBufferPool は指定したバッファプールを全テーブルで共有するカタログを作成する
+func NewCatalogWithBufferPool(dataDir string, pool *storage.BufferPool) (Catalog, error) {
 	if err := os.MkdirAll(dataDir, 0755); err != nil {
 		return nil, err
 	}
-	return &catalog{
+	c := &catalog{
 		dataDir: dataDir,
 		tables:  make(map[string]*storage.Table),
 		schemas: make(map[string]*storage.Schema),
-	}, nil
+		indexes: make(map[string][]IndexInfo),
+		stats:   make(map[string]*storage.TableStatistics),
+		pool:    pool,
+	}
+	if err := c.load(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// load はシステムカタログからテーブルを復元する
+func (c *catalog) load() error {
+	sc, err := loadSystemCatalog(c.dataDir)
+	if err != nil {
+		return err
+	}
+	for _, meta := range sc.Tables {
+		filePath := c.tableFilePath(meta.Name)
+		if _, err := os.Stat(filePath); err != nil {
+			return fmt.Errorf("table %s: data file is missing: %w", meta.Name, err)
+		}
+		pager, err := storage.NewPager(filePath)
+		if err != nil {
+			return err
+		}
+		schema := meta.toSchema()
+		table, err := storage.NewTableWithBufferPool(storage.TableName(meta.Name), schema, pager, c.pool)
+		if err != nil {
+			pager.Close()
+			return fmt.Errorf("table %s: %w", meta.Name, err)
+		}
+		c.tables[meta.Name] = table
+		c.schemas[meta.Name] = schema
+		if stats := meta.Statistics.toStatistics(schema); stats != nil {
+			c.stats[meta.Name] = stats
+		}
+		for _, im := range meta.Indexes {
+			info := IndexInfo{Name: im.Name, TableName: meta.Name, Columns: im.getColumns(), Unique: im.Unique, Primary: im.Primary}
+			if err := c.openIndex(table, schema, info); err != nil {
+				return fmt.Errorf("table %s: %w", meta.Name, err)
+			}
+			c.indexes[meta.Name] = append(c.indexes[meta.Name], info)
+		}
+	}
+	return nil
+}
+
+// indexFilePath はインデックス用のファイルパスを返す
+func (c *catalog) indexFilePath(name string) string {
+	return filepath.Join(c.dataDir, name+".idx")
+}
+
+// openIndex はインデックスファイルを開いてテーブルに登録する
+// 前回正常に閉じられていればそのまま使い、そうでなければテーブルのデータから作り直す
+func (c *catalog) openIndex(table *storage.Table, schema *storage.Schema, info IndexInfo) error {
+	idx, err := c.newDiskIndex(schema, info)
+	switch {
+	case errors.Is(err, index.ErrCorruptedBTree):
+		// 壊れたファイルは作り直す
+	case err != nil:
+		return err
+	case idx.IsClean():
+		return table.AttachIndex(idx)
+	default:
+		if err := idx.Drop(); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(c.indexFilePath(info.Name)); err != nil {
+		return err
+	}
+	return c.buildIndex(table, schema, info)
+}
+
+// buildIndex は空のインデックスファイルを作成し、既存の行で構築してテーブルに登録する
+func (c *catalog) buildIndex(table *storage.Table, schema *storage.Schema, info IndexInfo) error {
+	idx, err := c.newDiskIndex(schema, info)
+	if err != nil {
+		return err
+	}
+	if err := table.AddIndex(idx); err != nil {
+		idx.Drop()
+		os.Remove(c.indexFilePath(info.Name))
+		return err
+	}
+	return nil
+}
+
+// newDiskIndex はインデックスファイルを開く
+func (c *catalog) newDiskIndex(schema *storage.Schema, info IndexInfo) (*index.DiskIndex, error) {
+	columns := make([]int, 0, len(info.Columns))
+	for _, name := range info.Columns {
+		colIdx := schema.GetColumnIndex(name)
+		if colIdx < 0 {
+			return nil, fmt.Errorf("column %s not found", name)
+		}
+		columns = append(columns, colIdx)
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("index %s has no columns", info.Name)
+	}
+	indexType := index.IndexTypeSecondary
+	switch {
+	case info.Primary:
+		indexType = index.IndexTypePrimary
+	case info.Unique:
+		indexType = index.IndexTypeUnique
+	}
+	return index.OpenDiskIndex(c.indexFilePath(info.Name), info.Name, indexType, columns, c.pool)
+}
+
+// primaryKeyIndex は PRIMARY KEY カラムに自動で作るユニークインデックスの定義を返す
+func primaryKeyIndex(name string, schema *storage.Schema) (IndexInfo, bool) {
+	pk := schema.GetPrimaryKeyIndex()
+	if pk < 0 {
+		return IndexInfo{}, false
+	}
+	column := schema.GetColumns()[pk]
+	return IndexInfo{Name: name + "_pkey", TableName: name, Columns: []string{column.GetName()}, Unique: true, Primary: true}, true
+}
+
+// findIndex は名前からインデックス定義を探す
+// 呼び出し側でロックを取得していること
+func (c *catalog) findIndex(name string) (IndexInfo, bool) {
+	for _, infos := range c.indexes {
+		for _, info := range infos {
+			if info.Name == name {
+				return info, true
+			}
+		}
+	}
+	return IndexInfo{}, false
+}
+
+// newIndexMetas はインデックス定義を保存用の形式に変換する
+func newIndexMetas(infos []IndexInfo) []indexMeta {
+	metas := make([]indexMeta, 0, len(infos))
+	for _, info := range infos {
+		metas = append(metas, indexMeta{Name: info.Name, Columns: info.Columns, Unique: info.Unique, Primary: info.Primary})
+	}
+	return metas
+}
+
+// persist は現在のスキーマ一覧をシステムカタログに書き込む
+// except に指定したテーブルは除外し、extra に指定したテーブルは追加する
+// 呼び出し側でロックを取得していること
+func (c *catalog) persist(except string, extra *tableMeta) error {
+	sc := &systemCatalog{}
+	for name, schema := range c.schemas {
+		if name == except {
+			continue
+		}
+		meta := newTableMeta(name, schema)
+		meta.Indexes = newIndexMetas(c.indexes[name])
+		meta.Statistics = newStatisticsMeta(c.stats[name])
+		sc.Tables = append(sc.Tables, meta)
+	}
+	if extra != nil {
+		sc.Tables = append(sc.Tables, *extra)
+	}
+	return saveSystemCatalog(c.dataDir, sc)
+}
+
+// tableFilePath はテーブル用のファイルパスを返す
+func (c *catalog) tableFilePath(name string) string {
+	return filepath.Join(c.dataDir, name+".db")
 }
 
 // CreateTable はテーブルを作成する
@@ -60,20 +263,84 @@ func (c *catalog) CreateTable(name string, schema *storage.Schema) error {
 		return fmt.Errorf("table %s already exists", name)
 	}
 	// テーブル用のファイルパスを作成
-	filePath := filepath.Join(c.dataDir, name+".db")
+	filePath := c.tableFilePath(name)
+	if err := checkUncataloguedTableFile(filePath); err != nil {
+		return err
+	}
 	// pager を作成
 	pager, err := storage.NewPager(filePath)
 	if err != nil {
 		return err
 	}
+	// PRIMARY KEY には一意性を保証するインデックスを自動で作る
+	var indexes []IndexInfo
+	if info, ok := primaryKeyIndex(name, schema); ok {
+		if _, exists := c.findIndex(info.Name); exists {
+			pager.Close()
+			return fmt.Errorf("index %s already exists", info.Name)
+		}
+		// カタログに載っていないインデックスファイルは残骸なので削除する（テーブルから作り直せる）
+		if err := os.Remove(c.indexFilePath(info.Name)); err != nil && !os.IsNotExist(err) {
+			pager.Close()
+			return err
+		}
+		indexes = append(indexes, info)
+	}
 	// テーブルを作成
-	table := storage.NewTable(storage.TableName(name), schema, pager)
+	table, err := storage.NewTableWithBufferPool(storage.TableName(name), schema, pager, c.pool)
+	if err != nil {
+		pager.Close()
+		os.Remove(filePath)
+		return err
+	}
+	for _, info := range indexes {
+		if err := c.buildIndex(table, schema, info); err != nil {
+			c.discardTable(table, name, indexes)
+			return err
+		}
+	}
+	// テーブルとインデックスを作れてからカタログを永続化する
+	meta := newTableMeta(name, schema)
+	meta.Indexes = newIndexMetas(indexes)
+	if err := c.persist("", &meta); err != nil {
+		c.discardTable(table, name, indexes)
+		return err
+	}
 	c.tables[name] = table
 	// スキーマの追加
 	c.schemas[name] = schema
+	if len(indexes) > 0 {
+		c.indexes[name] = indexes
+	}
 	return nil
 }
 
+// checkUncataloguedTableFile はカタログに載っていないテーブルのデータファイルがあればエラーを返す
+// カタログより前に作られたデータや DROP 途中の残骸かもしれないので消さない
+// 空のファイルは CREATE TABLE 途中の残骸で行を持たないので削除する
+func checkUncataloguedTableFile(filePath string) error {
+	info, err := os.Stat(filePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Size() > 0 {
+		return fmt.Errorf("%w: %s (move or remove it to create the table)", ErrUncataloguedTableFile, filePath)
+	}
+	return os.Remove(filePath)
+}
+
+// discardTable は作成途中のテーブルを閉じ、テーブルとインデックスのファイルを削除する
+func (c *catalog) discardTable(table *storage.Table, name string, indexes []IndexInfo) {
+	table.Drop()
+	os.Remove(c.tableFilePath(name))
+	for _, info := range indexes {
+		os.Remove(c.indexFilePath(info.Name))
+	}
+}
+
 // GetTable はテーブルを取得する
 func (c *catalog) GetTable(name string) (*storage.Table, error) {
 	c.lock.RLock()
@@ -93,17 +360,29 @@ func (c *catalog) DropTable(name string) error {
 	if !ok {
 		return fmt.Errorf("table %s not found", name)
 	}
-	if err := table.Close(); err != nil {
+	// 先にカタログから外す（クラッシュしても .idx ファイルが残るだけで済む）
+	// インデックスはテーブルから作り直せるので、残ったファイルは同じ名前の CREATE INDEX や CREATE TABLE が削除する
+	if err := c.persist(name, nil); err != nil {
+		return err
+	}
+	// 削除するファイルなのでダーティページは書き出さない
+	if err := table.Drop(); err != nil {
 		return err
 	}
 
 	// テーブル用のファイルを削除
-	filePath := filepath.Join(c.dataDir, name+".db")
-	if err := os.Remove(filePath); err != nil {
+	if err := os.Remove(c.tableFilePath(name)); err != nil {
 		return err
 	}
+	for _, info := range c.indexes[name] {
+		if err := os.Remove(c.indexFilePath(info.Name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
 	delete(c.tables, name)
 	delete(c.schemas, name)
+	delete(c.indexes, name)
+	delete(c.stats, name)
 	return nil
 }
 
@@ -136,6 +415,122 @@ func (c *catalog) GetSchema(name string) (*storage.Schema, error) {
 	return schema, nil
 }
 
+// GetBufferPool はテーブルが共有するバッファプールを取得する
+func (c *catalog) GetBufferPool() *storage.BufferPool {
+	return c.pool
+}
+
+// CreateIndex はテーブルのカラム（複合キーなら複数）にインデックスを作成する
+// 既存の行でインデックスを構築し、ユニークインデックスで重複があればエラーにする
+func (c *catalog) CreateIndex(name, tableName string, columns []string, unique bool) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	table, ok := c.tables[tableName]
+	if !ok {
+		return fmt.Errorf("table %s not found", tableName)
+	}
+	if _, exists := c.findIndex(name); exists {
+		return fmt.Errorf("index %s already exists", name)
+	}
+	// カタログに載っていないファイルは過去の DROP 途中でクラッシュした残骸なので削除する
+	if err := os.Remove(c.indexFilePath(name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	info := IndexInfo{Name: name, TableName: tableName, Columns: columns, Unique: unique}
+	if err := c.buildIndex(table, c.schemas[tableName], info); err != nil {
+		return err
+	}
+	c.indexes[tableName] = append(c.indexes[tableName], info)
+	if err := c.persist("", nil); err != nil {
+		c.indexes[tableName] = c.indexes[tableName][:len(c.indexes[tableName])-1]
+		c.removeIndexFile(table, name)
+		return err
+	}
+	return nil
+}
+
+// removeIndexFile はインデックスをテーブルから外し、ファイルを削除する
+func (c *catalog) removeIndexFile(table *storage.Table, name string) error {
+	idx := table.GetIndex(name)
+	if idx == nil {
+		return fmt.Errorf("index %s not found", name)
+	}
+	if err := table.RemoveIndex(name); err != nil {
+		return err
+	}
+	if err := idx.Drop(); err != nil {
+		return err
+	}
+	return os.Remove(c.indexFilePath(name))
+}
+
+// DropIndex はインデックスを削除する
+// PRIMARY KEY のインデックスは削除できない
+func (c *catalog) DropIndex(name string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	info, ok := c.findIndex(name)
+	if !ok {
+		return fmt.Errorf("index %s not found", name)
+	}
+	if info.Primary {
+		return fmt.Errorf("cannot drop primary key index %s", name)
+	}
+	old := c.indexes[info.TableName]
+	remaining := make([]IndexInfo, 0, len(old))
+	for _, i := range old {
+		if i.Name != name {
+			remaining = append(remaining, i)
+		}
+	}
+	c.indexes[info.TableName] = remaining
+	// 先にカタログから外す（クラッシュしても .idx ファイルが残るだけで済む）
+	// インデックスはテーブルから作り直せるので、残ったファイルは同じ名前の CREATE INDEX や CREATE TABLE が削除する
+	if err := c.persist("", nil); err != nil {
+		c.indexes[info.TableName] = old
+		return err
+	}
+	return c.removeIndexFile(c.tables[info.TableName], name)
+}
+
+// GetIndexes はテーブルのインデックス定義の一覧を返す
+func (c *catalog) GetIndexes(tableName string) []IndexInfo {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	infos := make([]IndexInfo, len(c.indexes[tableName]))
+	copy(infos, c.indexes[tableName])
+	return infos
+}
+
+// SetStatistics はテーブルの統計情報を保存する
+func (c *catalog) SetStatistics(tableName string, stats *storage.TableStatistics) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.tables[tableName]; !ok {
+		return fmt.Errorf("table %s not found", tableName)
+	}
+	old, existed := c.stats[tableName]
+	c.stats[tableName] = stats
+	if err := c.persist("", nil); err != nil {
+		if existed {
+			c.stats[tableName] = old
+		} else {
+			delete(c.stats, tableName)
+		}
+		return err
+	}
+	return nil
+}
+
+// GetStatistics はテーブルの統計情報を返す（ANALYZE していなければ nil）
+func (c *catalog) GetStatistics(tableName string) *storage.TableStatistics {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.stats[tableName]
+}
+
 // Close はカタログを閉じる
 func (c *catalog) Close() error {
 	c.lock.Lock()
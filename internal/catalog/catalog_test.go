@@ -1,8 +1,11 @@
 package catalog
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 
 	"github.com/takeuchi-shogo/go-example-database/internal/storage"
@@ -253,3 +256,456 @@ func TestListTables(t *testing.T) {
 		t.Errorf("Expected 2 tables, got %d", len(tables))
 	}
 }
+
+func TestCatalogReopen(t *testing.T) {
+	tempDir := t.TempDir()
+	cat, err := NewCatalog(tempDir)
+	if err != nil {
+		t.Fatalf("NewCatalog failed: %v", err)
+	}
+
+	id := storage.NewColumn("id", storage.ColumnTypeInt32, 0, false)
+	id.SetPrimaryKey(true)
+	columns := []storage.Column{
+		*id,
+		*storage.NewColumn("name", storage.ColumnTypeString, 255, true),
+	}
+	if err := cat.CreateTable("users", storage.NewSchema("users", columns)); err != nil {
+		t.Fatalf("CreateTable failed: %v", err)
+	}
+	table, _ := cat.GetTable("users")
+	row := storage.NewRow([]storage.Value{storage.Int32Value(1), storage.StringValue("alice")})
+	if err := table.Insert(row); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if err := cat.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// 再起動後もテーブルとスキーマが復元されるか
+	reopened, err := NewCatalog(tempDir)
+	if err != nil {
+		t.Fatalf("NewCatalog (reopen) failed: %v", err)
+	}
+	defer reopened.Close()
+
+	if !reopened.TableExists("users") {
+		t.Fatal("table users should exist after reopen")
+	}
+	schema, err := reopened.GetSchema("users")
+	if err != nil {
+		t.Fatalf("GetSchema failed: %v", err)
+	}
+	if schema.GetColumnCount() != 2 {
+		t.Fatalf("Expected 2 columns, got %d", schema.GetColumnCount())
+	}
+	cols := schema.GetColumns()
+	if cols[0].GetName() != "id" || cols[0].GetColumnType() != storage.ColumnTypeInt32 || !cols[0].GetPrimaryKey() {
+		t.Errorf("unexpected id column: %+v", cols[0])
+	}
+	if cols[1].GetName() != "name" || cols[1].GetSize() != 255 || !cols[1].GetNullable() {
+		t.Errorf("unexpected name column: %+v", cols[1])
+	}
+
+	reopenedTable, _ := reopened.GetTable("users")
+	rows, err := reopenedTable.Scan()
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if len(rows) != 1 {
+		t.Errorf("Expected 1 row after reopen, got %d", len(rows))
+	}
+}
+
+func TestCatalogReopenAfterDrop(t *testing.T) {
+	tempDir := t.TempDir()
+	cat, err := NewCatalog(tempDir)
+	if err != nil {
+		t.Fatalf("NewCatalog failed: %v", err)
+	}
+	columns := []storage.Column{
+		*storage.NewColumn("id", storage.ColumnTypeInt32, 0, false),
+	}
+	cat.CreateTable("users", storage.NewSchema("users", columns))
+	cat.CreateTable("orders", storage.NewSchema("orders", columns))
+	if err := cat.DropTable("users"); err != nil {
+		t.Fatalf("DropTable failed: %v", err)
+	}
+	cat.Close()
+
+	reopened, err := NewCatalog(tempDir)
+	if err != nil {
+		t.Fatalf("NewCatalog (reopen) failed: %v", err)
+	}
+	defer reopened.Close()
+
+	if reopened.TableExists("users") {
+		t.Error("dropped table should not exist after reopen")
+	}
+	if !reopened.TableExists("orders") {
+		t.Error("table orders should exist after reopen")
+	}
+}
+
+func TestCreateTableRefusesUncataloguedFile(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// カタログより前に作られたデータや DROP 途中の残骸を再現
+	orphan := filepath.Join(tempDir, "users.db")
+	data := make([]byte, 4096)
+	data[0] = 1
+	if err := os.WriteFile(orphan, data, 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	// 空のファイルは CREATE TABLE 途中の残骸なので作り直せる
+	if err := os.WriteFile(filepath.Join(tempDir, "orders.db"), nil, 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	cat, err := NewCatalog(tempDir)
+	if err != nil {
+		t.Fatalf("NewCatalog failed: %v", err)
+	}
+	defer cat.Close()
+
+	columns := []storage.Column{
+		*storage.NewColumn("id", storage.ColumnTypeInt32, 0, false),
+	}
+	if err := cat.CreateTable("users", storage.NewSchema("users", columns)); !errors.Is(err, ErrUncataloguedTableFile) {
+		t.Fatalf("expected ErrUncataloguedTableFile, got %v", err)
+	}
+	if cat.TableExists("users") {
+		t.Error("table users should not be created")
+	}
+	if got, err := os.ReadFile(orphan); err != nil || !reflect.DeepEqual(got, data) {
+		t.Errorf("uncatalogued file should be kept as is (err=%v)", err)
+	}
+
+	if err := cat.CreateTable("orders", storage.NewSchema("orders", columns)); err != nil {
+		t.Fatalf("CreateTable over an empty file failed: %v", err)
+	}
+}
+
+func TestCreateTablePersistFailure(t *testing.T) {
+	tempDir := t.TempDir()
+	cat, err := NewCatalog(tempDir)
+	if err != nil {
+		t.Fatalf("NewCatalog failed: %v", err)
+	}
+	defer cat.Close()
+
+	// 一時ファイルの位置にディレクトリを置いてカタログの書き込みを失敗させる
+	tmpPath := systemCatalogPath(tempDir) + ".tmp"
+	if err := os.Mkdir(tmpPath, 0755); err != nil {
+		t.Fatalf("Mkdir failed: %v", err)
+	}
+	id := storage.NewColumn("id", storage.ColumnTypeInt32, 0, false)
+	id.SetPrimaryKey(true)
+	if err := cat.CreateTable("users", storage.NewSchema("users", []storage.Column{*id})); err == nil {
+		t.Fatal("expected error when the catalog cannot be written")
+	}
+	if cat.TableExists("users") {
+		t.Error("table users should not be created")
+	}
+	for _, name := range []string{"users.db", "users_pkey.idx"} {
+		if _, err := os.Stat(filepath.Join(tempDir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s should be removed, got %v", name, err)
+		}
+	}
+
+	// 書き込めるようになれば同じ名前で作り直せる
+	os.Remove(tmpPath)
+	if err := cat.CreateTable("users", storage.NewSchema("users", []storage.Column{*id})); err != nil {
+		t.Fatalf("CreateTable after failure failed: %v", err)
+	}
+}
+
+func TestNewCatalogMissingTableFile(t *testing.T) {
+	tempDir := t.TempDir()
+	cat, err := NewCatalog(tempDir)
+	if err != nil {
+		t.Fatalf("NewCatalog failed: %v", err)
+	}
+	columns := []storage.Column{
+		*storage.NewColumn("id", storage.ColumnTypeInt32, 0, false),
+	}
+	cat.CreateTable("users", storage.NewSchema("users", columns))
+	cat.Close()
+
+	os.Remove(filepath.Join(tempDir, "users.db"))
+
+	if _, err := NewCatalog(tempDir); err == nil {
+		t.Error("Expected error when a table file is missing")
+	}
+}
+
+func TestCatalogSharedBufferPool(t *testing.T) {
+	tempDir := t.TempDir()
+	pool := storage.NewBufferPool(8, storage.EvictionPolicyClock)
+	cat, err := NewCatalogWithBufferPool(tempDir, pool)
+	if err != nil {
+		t.Fatalf("NewCatalogWithBufferPool failed: %v", err)
+	}
+	defer cat.Close()
+
+	if cat.GetBufferPool() != pool {
+		t.Fatal("GetBufferPool should return the given pool")
+	}
+
+	columns := []storage.Column{
+		*storage.NewColumn("id", storage.ColumnTypeInt32, 0, false),
+	}
+	cat.CreateTable("users", storage.NewSchema("users", columns))
+	cat.CreateTable("orders", storage.NewSchema("orders", columns))
+	for _, name := range []string{"users", "orders"} {
+		table, _ := cat.GetTable(name)
+		if err := table.Insert(storage.NewRow([]storage.Value{storage.Int32Value(1)})); err != nil {
+			t.Fatalf("Insert into %s failed: %v", name, err)
+		}
+		if _, err := table.Scan(); err != nil {
+			t.Fatalf("Scan %s failed: %v", name, err)
+		}
+	}
+
+	// 両テーブルのアクセスが同じプールの統計に現れる
+	if stats := pool.Stats(); stats.Hits < 2 {
+		t.Errorf("expected hits from both tables, got %+v", stats)
+	}
+}
+
+// newIndexTestCatalog は主キー id と age カラムを持つ users テーブルを作成する
+func newIndexTestCatalog(t *testing.T, dir string) Catalog {
+	t.Helper()
+	cat, err := NewCatalog(dir)
+	if err != nil {
+		t.Fatalf("NewCatalog failed: %v", err)
+	}
+	id := storage.NewColumn("id", storage.ColumnTypeInt32, 0, false)
+	id.SetPrimaryKey(true)
+	columns := []storage.Column{
+		*id,
+		*storage.NewColumn("age", storage.ColumnTypeInt32, 0, false),
+	}
+	if err := cat.CreateTable("users", storage.NewSchema("users", columns)); err != nil {
+		t.Fatalf("CreateTable failed: %v", err)
+	}
+	return cat
+}
+
+func TestCreateTablePrimaryKeyIndex(t *testing.T) {
+	cat := newIndexTestCatalog(t, t.TempDir())
+	defer cat.Close()
+
+	indexes := cat.GetIndexes("users")
+	if len(indexes) != 1 || indexes[0].Name != "users_pkey" || !indexes[0].Unique || !indexes[0].Primary {
+		t.Fatalf("unexpected indexes: %+v", indexes)
+	}
+	table, _ := cat.GetTable("users")
+	if err := table.Insert(storage.NewRow([]storage.Value{storage.Int32Value(1), storage.Int32Value(20)})); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if err := table.Insert(storage.NewRow([]storage.Value{storage.Int32Value(1), storage.Int32Value(30)})); err == nil {
+		t.Error("expected duplicate primary key error")
+	}
+	if err := cat.DropIndex("users_pkey"); err == nil {
+		t.Error("expected error when dropping primary key index")
+	}
+}
+
+func TestCreateAndDropIndex(t *testing.T) {
+	dir := t.TempDir()
+	cat := newIndexTestCatalog(t, dir)
+	table, _ := cat.GetTable("users")
+	for i, age := range []int32{20, 30, 20} {
+		table.Insert(storage.NewRow([]storage.Value{storage.Int32Value(int32(i + 1)), storage.Int32Value(age)}))
+	}
+
+	if err := cat.CreateIndex("age_uniq", "users", []string{"age"}, true); err == nil {
+		t.Error("expected error for unique index on duplicated values")
+	}
+	if err := cat.CreateIndex("age_idx", "users", []string{"age"}, false); err != nil {
+		t.Fatalf("CreateIndex failed: %v", err)
+	}
+	if err := cat.CreateIndex("age_idx", "users", []string{"age"}, false); err == nil {
+		t.Error("expected error for duplicate index name")
+	}
+	if err := cat.CreateIndex("no_table_idx", "missing", []string{"age"}, false); err == nil {
+		t.Error("expected error for missing table")
+	}
+	if err := cat.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// 再起動後もインデックスが復元される
+	reopened, err := NewCatalog(dir)
+	if err != nil {
+		t.Fatalf("NewCatalog (reopen) failed: %v", err)
+	}
+	defer reopened.Close()
+	if got := len(reopened.GetIndexes("users")); got != 2 {
+		t.Fatalf("expected 2 indexes after reopen, got %d", got)
+	}
+	reopenedTable, _ := reopened.GetTable("users")
+	idx := reopenedTable.GetIndex("age_idx")
+	if idx == nil {
+		t.Fatal("age_idx should be attached to the table")
+	}
+	rowIDs, err := idx.Lookup(storage.NewKeyRangeEqual(storage.Int32Value(20)))
+	if err != nil || len(rowIDs) != 2 {
+		t.Errorf("expected 2 rows for age=20, got %v (err=%v)", rowIDs, err)
+	}
+
+	if err := reopened.DropIndex("age_idx"); err != nil {
+		t.Fatalf("DropIndex failed: %v", err)
+	}
+	if reopenedTable.GetIndex("age_idx") != nil || len(reopened.GetIndexes("users")) != 1 {
+		t.Error("age_idx should be removed")
+	}
+	if err := reopened.DropIndex("age_idx"); err == nil {
+		t.Error("expected error when dropping missing index")
+	}
+}
+
+func TestStringAndCompositeIndexes(t *testing.T) {
+	cat, err := NewCatalog(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewCatalog failed: %v", err)
+	}
+	defer cat.Close()
+	name := storage.NewColumn("name", storage.ColumnTypeString, 255, false)
+	name.SetPrimaryKey(true)
+	columns := []storage.Column{
+		*name,
+		*storage.NewColumn("category", storage.ColumnTypeString, 255, false),
+		*storage.NewColumn("rank", storage.ColumnTypeInt32, 0, false),
+	}
+	if err := cat.CreateTable("tags", storage.NewSchema("tags", columns)); err != nil {
+		t.Fatalf("CreateTable failed: %v", err)
+	}
+	// 文字列の主キーにも自動でインデックスを作る
+	if indexes := cat.GetIndexes("tags"); len(indexes) != 1 || indexes[0].Name != "tags_pkey" {
+		t.Fatalf("unexpected indexes: %+v", indexes)
+	}
+	table, _ := cat.GetTable("tags")
+	for _, tag := range []struct {
+		name, category string
+		rank           int32
+	}{{"go", "lang", 2}, {"rust", "lang", 1}, {"sql", "query", 1}} {
+		row := storage.NewRow([]storage.Value{storage.StringValue(tag.name), storage.StringValue(tag.category), storage.Int32Value(tag.rank)})
+		if err := table.Insert(row); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+	if err := table.Insert(storage.NewRow([]storage.Value{storage.StringValue("go"), storage.StringValue("x"), storage.Int32Value(0)})); err == nil {
+		t.Error("expected duplicate primary key error")
+	}
+
+	if err := cat.CreateIndex("category_rank_idx", "tags", []string{"category", "rank"}, false); err != nil {
+		t.Fatalf("CreateIndex failed: %v", err)
+	}
+	idx := table.GetIndex("category_rank_idx")
+	// 先頭カラムだけの検索は rank の昇順で返る
+	rowIDs, err := idx.Lookup(storage.NewKeyRangeEqual(storage.StringValue("lang")))
+	if err != nil || len(rowIDs) != 2 || rowIDs[0] != 2 || rowIDs[1] != 1 {
+		t.Errorf("expected rowIDs [2 1] for category=lang, got %v (err=%v)", rowIDs, err)
+	}
+	rowIDs, _ = idx.Lookup(storage.NewKeyRangeEqual(storage.StringValue("lang"), storage.Int32Value(2)))
+	if len(rowIDs) != 1 || rowIDs[0] != 1 {
+		t.Errorf("expected rowIDs [1] for (lang, 2), got %v", rowIDs)
+	}
+}
+
+func TestIndexRebuiltWhenFileIsMissing(t *testing.T) {
+	dir := t.TempDir()
+	cat := newIndexTestCatalog(t, dir)
+	table, _ := cat.GetTable("users")
+	for i, age := range []int32{20, 30, 20} {
+		table.Insert(storage.NewRow([]storage.Value{storage.Int32Value(int32(i + 1)), storage.Int32Value(age)}))
+	}
+	if err := cat.CreateIndex("age_idx", "users", []string{"age"}, false); err != nil {
+		t.Fatalf("CreateIndex failed: %v", err)
+	}
+	if err := cat.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "age_idx.idx")); err != nil {
+		t.Fatalf("index file should exist: %v", err)
+	}
+	if err := os.Remove(filepath.Join(dir, "age_idx.idx")); err != nil {
+		t.Fatal(err)
+	}
+
+	// ファイルがなければテーブルのデータから作り直す
+	reopened, err := NewCatalog(dir)
+	if err != nil {
+		t.Fatalf("NewCatalog (reopen) failed: %v", err)
+	}
+	defer reopened.Close()
+	reopenedTable, _ := reopened.GetTable("users")
+	rowIDs, err := reopenedTable.GetIndex("age_idx").Lookup(storage.NewKeyRangeEqual(storage.Int32Value(20)))
+	if err != nil || len(rowIDs) != 2 {
+		t.Errorf("expected 2 rows for age=20, got %v (err=%v)", rowIDs, err)
+	}
+}
+
+func TestStatisticsPersisted(t *testing.T) {
+	tempDir := t.TempDir()
+	cat, err := NewCatalog(tempDir)
+	if err != nil {
+		t.Fatalf("NewCatalog failed: %v", err)
+	}
+	price := storage.NewColumn("price", storage.ColumnTypeDecimal, 8, true)
+	price.SetScale(2)
+	schema := storage.NewSchema("items", []storage.Column{
+		*storage.NewColumn("id", storage.ColumnTypeInt64, 0, false),
+		*storage.NewColumn("name", storage.ColumnTypeString, 255, false),
+		*price,
+		*storage.NewColumn("active", storage.ColumnTypeBool, 0, false),
+	})
+	if err := cat.CreateTable("items", schema); err != nil {
+		t.Fatalf("CreateTable failed: %v", err)
+	}
+	if cat.GetStatistics("items") != nil {
+		t.Fatal("expected no statistics before ANALYZE")
+	}
+	var rows []*storage.Row
+	for i := 0; i < 30; i++ {
+		var p storage.Value = storage.NewDecimal(int64(i*150), 2)
+		if i%3 == 0 {
+			p = nil
+		}
+		rows = append(rows, storage.NewRow([]storage.Value{
+			storage.Int64Value(int64(i)), storage.StringValue(fmt.Sprintf("item%02d", i)), p, storage.BoolValue(i%2 == 0),
+		}))
+	}
+	stats := storage.CollectStatistics(schema, rows)
+	if err := cat.SetStatistics("items", stats); err != nil {
+		t.Fatalf("SetStatistics failed: %v", err)
+	}
+	if err := cat.SetStatistics("missing", stats); err == nil {
+		t.Error("expected error for unknown table")
+	}
+	cat.Close()
+
+	// 再起動後も統計情報が復元されるか
+	reopened, err := NewCatalog(tempDir)
+	if err != nil {
+		t.Fatalf("NewCatalog (reopen) failed: %v", err)
+	}
+	defer reopened.Close()
+	loaded := reopened.GetStatistics("items")
+	if loaded == nil {
+		t.Fatal("expected statistics after reopen")
+	}
+	if !reflect.DeepEqual(loaded, stats) {
+		t.Errorf("statistics changed after reopen:\nexpected %+v\ngot      %+v", stats, loaded)
+	}
+
+	// テーブルを削除すると統計情報も消える
+	if err := reopened.DropTable("items"); err != nil {
+		t.Fatalf("DropTable failed: %v", err)
+	}
+	if reopened.GetStatistics("items") != nil {
+		t.Error("expected statistics to be removed with the table")
+	}
+}
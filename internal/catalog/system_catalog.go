@@ -0,0 +1,244 @@
+/*
+system_catalog.go はカタログ（テーブル定義）をデータディレクトリに永続化する
+再起動後も <name>.db ファイルとスキーマを対応付けられるようにする
+*/
+package catalog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
+)
+
+const (
+	// システムカタログのファイル名
+	systemCatalogFileName = "catalog.json"
+	// システムカタログのフォーマットバージョン
+	systemCatalogVersion = 1
+)
+
+// systemCatalog はディスクに保存するカタログの内容
+type systemCatalog struct {
+	Version int         `json:"version"`
+	Tables  []tableMeta `json:"tables"`
+}
+
+// tableMeta はテーブル1つ分の定義
+type tableMeta struct {
+	Name    string       `json:"name"`
+	Columns []columnMeta `json:"columns"`
+	Indexes []indexMeta  `json:"indexes,omitempty"`
+	// Statistics は ANALYZE で集めた統計情報（まだ集めていなければ nil）
+	Statistics *statisticsMeta `json:"statistics,omitempty"`
+}
+
+// columnMeta はカラム1つ分の定義
+type columnMeta struct {
+	Name       string             `json:"name"`
+	Type       storage.ColumnType `json:"type"`
+	Size       uint16             `json:"size"`
+	Scale      uint8              `json:"scale,omitempty"`
+	Nullable   bool               `json:"nullable"`
+	PrimaryKey bool               `json:"primary_key"`
+}
+
+// indexMeta はインデックス1つ分の定義
+// インデックスの中身は <インデックス名>.idx に保存する
+type indexMeta struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns,omitempty"`
+	Column  string   `json:"column,omitempty"` // 単一カラムだった頃の形式（読み込み専用）
+	Unique  bool     `json:"unique"`
+	Primary bool     `json:"primary,omitempty"`
+}
+
+// statisticsMeta はテーブルの統計情報
+type statisticsMeta struct {
+	RowCount int64                  `json:"row_count"`
+	Columns  []columnStatisticsMeta `json:"columns"`
+}
+
+// columnStatisticsMeta はカラム1つ分の統計情報
+// 値は表示用の文字列で保存し、読み込むときにカラムの型に戻す
+type columnStatisticsMeta struct {
+	Name          string   `json:"name"`
+	DistinctCount int64    `json:"distinct_count"`
+	NullFraction  float64  `json:"null_fraction"`
+	Min           *string  `json:"min,omitempty"`
+	Max           *string  `json:"max,omitempty"`
+	Histogram     []string `json:"histogram,omitempty"`
+}
+
+// newStatisticsMeta は統計情報を保存用の形式に変換する
+func newStatisticsMeta(stats *storage.TableStatistics) *statisticsMeta {
+	if stats == nil {
+		return nil
+	}
+	meta := &statisticsMeta{RowCount: stats.RowCount}
+	for _, col := range stats.Columns {
+		cm := columnStatisticsMeta{Name: col.Name, DistinctCount: col.DistinctCount, NullFraction: col.NullFraction}
+		if col.Min != nil {
+			lo, hi := storage.FormatValue(col.Min), storage.FormatValue(col.Max)
+			cm.Min, cm.Max = &lo, &hi
+		}
+		for _, v := range col.Histogram {
+			cm.Histogram = append(cm.Histogram, storage.FormatValue(v))
+		}
+		meta.Columns = append(meta.Columns, cm)
+	}
+	return meta
+}
+
+// toStatistics は保存した統計情報を復元する
+// カラムの型に戻せない値があるカラム（スキーマに無いカラムを含む）は値の情報を捨てる
+func (m *statisticsMeta) toStatistics(schema *storage.Schema) *storage.TableStatistics {
+	if m == nil {
+		return nil
+	}
+	stats := &storage.TableStatistics{RowCount: m.RowCount}
+	for _, cm := range m.Columns {
+		col := storage.ColumnStatistics{Name: cm.Name, DistinctCount: cm.DistinctCount, NullFraction: cm.NullFraction}
+		if idx := schema.GetColumnIndex(cm.Name); idx >= 0 && cm.Min != nil && cm.Max != nil {
+			column := &schema.GetColumns()[idx]
+			lo, err1 := parseStatisticsValue(*cm.Min, column)
+			hi, err2 := parseStatisticsValue(*cm.Max, column)
+			histogram := make([]storage.Value, 0, len(cm.Histogram))
+			ok := err1 == nil && err2 == nil
+			for _, s := range cm.Histogram {
+				v, err := parseStatisticsValue(s, column)
+				if err != nil {
+					ok = false
+					break
+				}
+				histogram = append(histogram, v)
+			}
+			if ok {
+				col.Min, col.Max, col.Histogram = lo, hi, histogram
+			}
+		}
+		stats.Columns = append(stats.Columns, col)
+	}
+	return stats
+}
+
+// parseStatisticsValue は保存した文字列をカラムの型の値に戻す
+func parseStatisticsValue(s string, column *storage.Column) (storage.Value, error) {
+	if column.GetColumnType() == storage.ColumnTypeBool {
+		b, err := strconv.ParseBool(s)
+		return storage.BoolValue(b), err
+	}
+	return storage.CastValue(storage.StringValue(s), column)
+}
+
+// getColumns はインデックス対象のカラム名を返す
+func (m indexMeta) getColumns() []string {
+	if len(m.Columns) == 0 && m.Column != "" {
+		return []string{m.Column}
+	}
+	return m.Columns
+}
+
+// newTableMeta はスキーマからテーブル定義を作成する
+func newTableMeta(name string, schema *storage.Schema) tableMeta {
+	columns := make([]columnMeta, 0, schema.GetColumnCount())
+	for _, col := range schema.GetColumns() {
+		columns = append(columns, columnMeta{
+			Name:       col.GetName(),
+			Type:       col.GetColumnType(),
+			Size:       col.GetSize(),
+			Scale:      col.GetScale(),
+			Nullable:   col.GetNullable(),
+			PrimaryKey: col.GetPrimaryKey(),
+		})
+	}
+	return tableMeta{Name: name, Columns: columns}
+}
+
+// toSchema はテーブル定義からスキーマを復元する
+func (m tableMeta) toSchema() *storage.Schema {
+	columns := make([]storage.Column, len(m.Columns))
+	for i, col := range m.Columns {
+		columns[i] = *storage.NewColumn(col.Name, col.Type, col.Size, col.Nullable)
+		columns[i].SetScale(col.Scale)
+		columns[i].SetPrimaryKey(col.PrimaryKey)
+	}
+	return storage.NewSchema(m.Name, columns)
+}
+
+// systemCatalogPath はシステムカタログのファイルパスを返す
+func systemCatalogPath(dataDir string) string {
+	return filepath.Join(dataDir, systemCatalogFileName)
+}
+
+// loadSystemCatalog はシステムカタログを読み込む
+// ファイルが存在しない場合は空のカタログを返す
+func loadSystemCatalog(dataDir string) (*systemCatalog, error) {
+	data, err := os.ReadFile(systemCatalogPath(dataDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return &systemCatalog{Version: systemCatalogVersion}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var sc systemCatalog
+	if err := json.Unmarshal(data, &sc); err != nil {
+		return nil, fmt.Errorf("failed to decode system catalog: %w", err)
+	}
+	if sc.Version > systemCatalogVersion {
+		return nil, fmt.Errorf("unsupported system catalog version: %d", sc.Version)
+	}
+	return &sc, nil
+}
+
+// saveSystemCatalog はシステムカタログをクラッシュセーフに書き込む
+// 一時ファイルに書いて fsync した後 rename で置き換えるため、
+// 途中でクラッシュしても古いカタログか新しいカタログのどちらかが残る
+func saveSystemCatalog(dataDir string, sc *systemCatalog) error {
+	sc.Version = systemCatalogVersion
+	// テーブル名順に並べて出力を安定させる
+	sort.Slice(sc.Tables, func(i, j int) bool { return sc.Tables[i].Name < sc.Tables[j].Name })
+
+	data, err := json.MarshalIndent(sc, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := systemCatalogPath(dataDir)
+	tmpPath := path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	// rename 自体を永続化するためにディレクトリも fsync する
+	return syncDir(dataDir)
+}
+
+// syncDir はディレクトリエントリの変更をディスクに反映する
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,74 @@
+package catalog
+
+import (
+	"os"
+	"testing"
+
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
+)
+
+func TestLoadSystemCatalogEmpty(t *testing.T) {
+	sc, err := loadSystemCatalog(t.TempDir())
+	if err != nil {
+		t.Fatalf("loadSystemCatalog failed: %v", err)
+	}
+	if len(sc.Tables) != 0 {
+		t.Errorf("Expected 0 tables, got %d", len(sc.Tables))
+	}
+}
+
+func TestSaveAndLoadSystemCatalog(t *testing.T) {
+	tempDir := t.TempDir()
+	id := storage.NewColumn("id", storage.ColumnTypeInt64, 8, false)
+	id.SetPrimaryKey(true)
+	balance := storage.NewColumn("balance", storage.ColumnTypeDecimal, 12, false)
+	balance.SetScale(2)
+	schema := storage.NewSchema("users", []storage.Column{
+		*id,
+		*storage.NewColumn("active", storage.ColumnTypeBool, 1, true),
+		*balance,
+	})
+
+	sc := &systemCatalog{Tables: []tableMeta{newTableMeta("users", schema)}}
+	if err := saveSystemCatalog(tempDir, sc); err != nil {
+		t.Fatalf("saveSystemCatalog failed: %v", err)
+	}
+	// 一時ファイルが残っていないか
+	if _, err := os.Stat(systemCatalogPath(tempDir) + ".tmp"); !os.IsNotExist(err) {
+		t.Error("temporary catalog file should be renamed")
+	}
+
+	loaded, err := loadSystemCatalog(tempDir)
+	if err != nil {
+		t.Fatalf("loadSystemCatalog failed: %v", err)
+	}
+	if loaded.Version != systemCatalogVersion {
+		t.Errorf("Expected version %d, got %d", systemCatalogVersion, loaded.Version)
+	}
+	if len(loaded.Tables) != 1 {
+		t.Fatalf("Expected 1 table, got %d", len(loaded.Tables))
+	}
+	restored := loaded.Tables[0].toSchema()
+	if restored.GetTableName() != "users" {
+		t.Errorf("Expected table name users, got %s", restored.GetTableName())
+	}
+	if restored.GetPrimaryKeyIndex() != 0 {
+		t.Errorf("Expected primary key index 0, got %d", restored.GetPrimaryKeyIndex())
+	}
+	if !restored.GetColumns()[1].GetNullable() {
+		t.Error("Expected active column to be nullable")
+	}
+	if col := restored.GetColumns()[2]; col.GetColumnType() != storage.ColumnTypeDecimal || col.GetSize() != 12 || col.GetScale() != 2 {
+		t.Errorf("Expected DECIMAL(12,2), got %s(%d,%d)", col.GetColumnType(), col.GetSize(), col.GetScale())
+	}
+}
+
+func TestLoadSystemCatalogCorrupted(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.WriteFile(systemCatalogPath(tempDir), []byte("{broken"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if _, err := loadSystemCatalog(tempDir); err == nil {
+		t.Error("Expected error for corrupted catalog")
+	}
+}
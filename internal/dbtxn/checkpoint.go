@@ -0,0 +1,172 @@
+package dbtxn
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
+)
+
+var (
+	ErrCorruptedCheckpoint = errors.New("corrupted checkpoint record")
+	ErrCheckpointNotFound  = errors.New("checkpoint record not found in WAL")
+)
+
+// CheckpointData はファジーチェックポイントのレコードに記録する内容
+// チェックポイント中もトランザクションは止めないので、ページにどこまで反映されたかは
+// アクティブトランザクション表とダーティページ表から求める
+type CheckpointData struct {
+	RedoLSN    uint64              // リカバリでログを読み始める LSN（これより前のログは不要）
+	MaxTxnID   uint64              // これまでに使った最大のトランザクションID
+	ActiveTxns map[uint64]uint64   // アクティブトランザクション表: トランザクションID -> 最初のログの LSN
+	DirtyPages []storage.DirtyPage // ダーティページ表
+}
+
+// encode はチェックポイントの内容をバイト列にする
+func (c *CheckpointData) encode() []byte {
+	buf := make([]byte, 0, 24+len(c.ActiveTxns)*16+len(c.DirtyPages)*32)
+	buf = binary.LittleEndian.AppendUint64(buf, c.RedoLSN)
+	buf = binary.LittleEndian.AppendUint64(buf, c.MaxTxnID)
+	// 同じ内容なら同じバイト列になるようにトランザクションIDの順に並べる
+	ids := make([]uint64, 0, len(c.ActiveTxns))
+	for id := range c.ActiveTxns {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(ids)))
+	for _, id := range ids {
+		buf = binary.LittleEndian.AppendUint64(buf, id)
+		buf = binary.LittleEndian.AppendUint64(buf, c.ActiveTxns[id])
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(c.DirtyPages)))
+	for _, page := range c.DirtyPages {
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(len(page.File)))
+		buf = append(buf, page.File...)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(page.PageID))
+		buf = binary.LittleEndian.AppendUint64(buf, page.RecLSN)
+	}
+	return buf
+}
+
+// decodeCheckpointData は encode したバイト列からチェックポイントの内容を復元する
+func decodeCheckpointData(data []byte) (*CheckpointData, error) {
+	r := &byteReader{data: data}
+	c := &CheckpointData{
+		RedoLSN:    r.uint64(),
+		MaxTxnID:   r.uint64(),
+		ActiveTxns: make(map[uint64]uint64),
+	}
+	for n := r.uint32(); n > 0 && !r.short; n-- {
+		id := r.uint64()
+		c.ActiveTxns[id] = r.uint64()
+	}
+	for n := r.uint32(); n > 0 && !r.short; n-- {
+		file := string(r.bytes(int(r.uint16())))
+		pageID := storage.PageID(r.uint32())
+		c.DirtyPages = append(c.DirtyPages, storage.DirtyPage{File: file, PageID: pageID, RecLSN: r.uint64()})
+	}
+	if r.short || len(r.data) != 0 {
+		return nil, ErrCorruptedCheckpoint
+	}
+	return c, nil
+}
+
+// byteReader は先頭から順に固定長の値を読む
+// 足りなければ short を設定し、以降はゼロ値を返す
+type byteReader struct {
+	data  []byte
+	short bool
+}
+
+func (r *byteReader) bytes(n int) []byte {
+	if r.short || len(r.data) < n {
+		r.short = true
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *byteReader) uint16() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *byteReader) uint32() uint32 {
+	if b := r.bytes(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *byteReader) uint64() uint64 {
+	if b := r.bytes(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+// マスターレコードは最後に完了したチェックポイントの LSN を持つ小さなファイル
+// WAL のパスに ".master" を付けた名前で置き、書き換えは一時ファイルからの rename で行う
+
+func masterPath(walPath string) string {
+	return walPath + ".master"
+}
+
+// readMaster はマスターレコードからチェックポイントの LSN を読む（なければ 0）
+func readMaster(walPath string) (uint64, error) {
+	data, err := os.ReadFile(masterPath(walPath))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(data) != 12 || crc32.ChecksumIEEE(data[:8]) != binary.LittleEndian.Uint32(data[8:]) {
+		return 0, ErrCorruptedCheckpoint
+	}
+	return binary.LittleEndian.Uint64(data[:8]), nil
+}
+
+// writeMaster はマスターレコードをチェックポイントの LSN に書き換える
+func writeMaster(walPath string, lsn uint64) error {
+	data := binary.LittleEndian.AppendUint64(nil, lsn)
+	data = binary.LittleEndian.AppendUint32(data, crc32.ChecksumIEEE(data))
+	tmp := masterPath(walPath) + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, masterPath(walPath)); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(walPath))
+}
+
+// syncDir はディレクトリを fsync し、ファイルの作成・削除・rename を確実にディスクに書き込む
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
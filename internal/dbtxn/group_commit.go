@@ -0,0 +1,172 @@
+package dbtxn
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"time"
+)
+
+var ErrWALClosed = errors.New("WAL is closed")
+
+// GroupCommitConfig はグループコミットの設定
+type GroupCommitConfig struct {
+	MaxDelay time.Duration // 最初のコミットが待ち始めてから書き出すまでの最大の待ち時間（0 なら待たない）
+	MaxBatch int           // これだけのコミットが集まったら待ち時間を待たずに書き出す
+}
+
+// DefaultGroupCommitConfig はグループコミットの既定の設定
+var DefaultGroupCommitConfig = GroupCommitConfig{
+	MaxDelay: 200 * time.Microsecond,
+	MaxBatch: 64,
+}
+
+// commitRequest は LSN が書き込まれるのを待つコミット
+type commitRequest struct {
+	lsn  uint64
+	done chan error
+}
+
+// groupCommitter はコミットを集めて1回の fsync で書き出す
+// コミットするトランザクションは要求を送って待ち、書き出し役の goroutine が1つだけ fsync する
+// fsync の間に届いた要求は次の書き出しにまとめられる
+type groupCommitter struct {
+	wal      *WAL
+	config   GroupCommitConfig
+	requests chan *commitRequest
+	closed   chan struct{}
+	wg       sync.WaitGroup
+	// mu は停止後に要求が送られないようにする（送る側は読み取りロックを持つ）
+	mu      sync.RWMutex
+	stopped bool
+}
+
+// StartGroupCommit はグループコミットを開始する
+// 以降の FlushTo は書き出し役にまとめて書き出してもらう
+func (w *WAL) StartGroupCommit(config GroupCommitConfig) {
+	if config.MaxBatch <= 0 {
+		config.MaxBatch = DefaultGroupCommitConfig.MaxBatch
+	}
+	gc := &groupCommitter{
+		wal:      w,
+		config:   config,
+		requests: make(chan *commitRequest, config.MaxBatch),
+		closed:   make(chan struct{}),
+	}
+	gc.wg.Add(1)
+	go gc.run()
+
+	w.mu.Lock()
+	old := w.groupCommit
+	w.groupCommit = gc
+	w.mu.Unlock()
+	if old != nil {
+		old.stop()
+	}
+}
+
+// wait は lsn までのレコードが書き込まれるまで待つ
+func (gc *groupCommitter) wait(lsn uint64) error {
+	req := &commitRequest{lsn: lsn, done: make(chan error, 1)}
+	gc.mu.RLock()
+	if gc.stopped {
+		gc.mu.RUnlock()
+		return ErrWALClosed
+	}
+	gc.requests <- req
+	gc.mu.RUnlock()
+	return <-req.done
+}
+
+// run は要求を集めて書き出し、待っているコミットに結果を返す
+func (gc *groupCommitter) run() {
+	defer gc.wg.Done()
+	for {
+		var batch []*commitRequest
+		select {
+		case req := <-gc.requests:
+			batch = append(batch, req)
+		case <-gc.closed:
+			gc.drain()
+			return
+		}
+		batch = gc.collect(batch)
+		gc.flush(batch)
+	}
+}
+
+// collect は最大 MaxDelay 待って、MaxBatch までの要求を集める
+// 実行中のトランザクションがなければ後から来るコミットはないので待たない
+// その判断の前に一度だけほかの goroutine に実行を譲り、コミットしかけのトランザクションに要求を送らせる
+func (gc *groupCommitter) collect(batch []*commitRequest) []*commitRequest {
+	var timeout <-chan time.Time
+	if gc.config.MaxDelay > 0 {
+		timer := time.NewTimer(gc.config.MaxDelay)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	yielded := false
+	for len(batch) < gc.config.MaxBatch {
+		// すでに届いている要求をまとめる
+		select {
+		case req := <-gc.requests:
+			batch = append(batch, req)
+			continue
+		default:
+		}
+		if timeout == nil {
+			return batch
+		}
+		if !yielded {
+			runtime.Gosched()
+			yielded = true
+			continue
+		}
+		if !gc.wal.hasActiveTxns() {
+			return batch
+		}
+		select {
+		case req := <-gc.requests:
+			batch = append(batch, req)
+		case <-timeout:
+			return batch
+		case <-gc.closed:
+			return batch
+		}
+	}
+	return batch
+}
+
+// flush は1回書き出して、まとめた要求すべてに結果を返す
+// 要求を送る前にコミットのレコードはバッファに追加されているので、1回の書き出しですべて書き込まれる
+func (gc *groupCommitter) flush(batch []*commitRequest) {
+	err := gc.wal.Flush()
+	for _, req := range batch {
+		if err == nil && gc.wal.GetFlushedLSN() < req.lsn {
+			err = gc.wal.Flush()
+		}
+		req.done <- err
+	}
+}
+
+// drain は停止するときに残っている要求を書き出す
+func (gc *groupCommitter) drain() {
+	for {
+		select {
+		case req := <-gc.requests:
+			gc.flush([]*commitRequest{req})
+		default:
+			return
+		}
+	}
+}
+
+// stop は書き出し役を止める
+// すでに送られた要求は書き出してから止まる
+func (gc *groupCommitter) stop() {
+	gc.mu.Lock()
+	gc.stopped = true
+	gc.mu.Unlock()
+	close(gc.closed)
+	gc.wg.Wait()
+}
@@ -0,0 +1,145 @@
+package dbtxn
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// commitConcurrently は committers 個の goroutine から n 件ずつコミットする
+func commitConcurrently(t testing.TB, tm *TxnManager, committers, n int) {
+	var wg sync.WaitGroup
+	errs := make(chan error, committers)
+	for i := 0; i < committers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < n; j++ {
+				txn, err := tm.Begin()
+				if err == nil {
+					tm.wal.LogInsert(txn.ID, "users", uint64(j), nil, []byte("alice"))
+					err = tm.Commit(txn)
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+				// コミットが返った時点で COMMIT ログは書き込まれている
+				if flushed := tm.wal.GetFlushedLSN(); txn.CommitLSN == 0 || flushed < txn.CommitLSN {
+					errs <- fmt.Errorf("txn %d acknowledged before its commit record %d was durable (flushed LSN %d)", txn.ID, txn.CommitLSN, flushed)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+}
+
+func TestGroupCommitBatchesConcurrentCommits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.wal")
+	wal, _ := NewWAL(path)
+	wal.StartGroupCommit(GroupCommitConfig{MaxDelay: 2 * time.Millisecond, MaxBatch: 16})
+	tm := NewTxnManager(wal)
+
+	commitConcurrently(t, tm, 16, 10)
+	if syncs := wal.syncs.Load(); syncs >= 160 {
+		t.Errorf("expected fewer fsyncs than commits, got %d for 160 commits", syncs)
+	}
+	wal.Close()
+
+	// すべてのコミットがディスクに残っている
+	wal2, _ := NewWAL(path)
+	defer wal2.Close()
+	records, _ := wal2.Read()
+	commits := 0
+	for _, r := range records {
+		if r.LogType == LogCommit {
+			commits++
+		}
+	}
+	if commits != 160 {
+		t.Errorf("expected 160 commit records, got %d", commits)
+	}
+}
+
+func TestGroupCommitStopsOnClose(t *testing.T) {
+	wal, _ := NewWAL(filepath.Join(t.TempDir(), "test.wal"))
+	tm := NewTxnManager(wal)
+	txn, _ := tm.Begin()
+	// 実行中のトランザクションが残っているので、書き出し役は MaxDelay まで次のコミットを待ち続ける
+	tm.Begin()
+
+	// 書き出し役を動かす前にコミットの要求が届くように、要求を受け取るチャネルだけ先に用意する
+	gc := &groupCommitter{
+		wal:      wal,
+		config:   GroupCommitConfig{MaxDelay: time.Hour, MaxBatch: 1000},
+		requests: make(chan *commitRequest, 1000),
+		closed:   make(chan struct{}),
+	}
+	wal.groupCommit = gc
+	done := make(chan error, 1)
+	go func() { done <- tm.Commit(txn) }()
+	deadline := time.Now().Add(time.Second)
+	for len(gc.requests) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the commit to wait for the group committer")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	gc.wg.Add(1)
+	go gc.run()
+
+	// 待ち時間が長くても、閉じるときに待っているコミットは書き出される
+	wal.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if flushed := wal.GetFlushedLSN(); txn.CommitLSN == 0 || flushed < txn.CommitLSN {
+		t.Errorf("expected commit record %d to be durable, flushed LSN %d", txn.CommitLSN, flushed)
+	}
+	if records, _ := wal.ReadFrom(txn.CommitLSN); len(records) == 0 || records[0].LogType != LogCommit || records[0].TxnID != txn.ID {
+		t.Errorf("expected the commit record on disk, got %+v", records)
+	}
+}
+
+// BenchmarkCommit は多数のトランザクションが同時にコミットするときのスループットを比べる
+// commits/fsync は1回の fsync でまとめて書き込めたコミットの数
+func BenchmarkCommit(b *testing.B) {
+	configs := []struct {
+		name   string
+		config *GroupCommitConfig
+	}{
+		{"fsync-per-commit", nil},
+		{"group-nodelay", &GroupCommitConfig{MaxDelay: 0, MaxBatch: 128}},
+		{"group-200us", &GroupCommitConfig{MaxDelay: 200 * time.Microsecond, MaxBatch: 128}},
+	}
+	for _, committers := range []int{1, 16, 64} {
+		for _, c := range configs {
+			b.Run(fmt.Sprintf("%s/committers=%d", c.name, committers), func(b *testing.B) {
+				wal, err := NewWAL(filepath.Join(b.TempDir(), "bench.wal"))
+				if err != nil {
+					b.Fatal(err)
+				}
+				defer wal.Close()
+				if c.config != nil {
+					wal.StartGroupCommit(*c.config)
+				}
+				tm := NewTxnManager(wal)
+				perCommitter := (b.N + committers - 1) / committers
+				start := wal.syncs.Load()
+				b.ResetTimer()
+				commitConcurrently(b, tm, committers, perCommitter)
+				b.StopTimer()
+				if syncs := wal.syncs.Load() - start; syncs > 0 {
+					b.ReportMetric(float64(perCommitter*committers)/float64(syncs), "commits/fsync")
+				}
+			})
+		}
+	}
+}
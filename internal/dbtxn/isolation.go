@@ -0,0 +1,57 @@
+package dbtxn
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrUnsupportedIsolationLevel = errors.New("unsupported isolation level")
+
+// IsolationLevel はトランザクションの分離レベル
+// どのレベルでもコミットされていない変更は読まない（ダーティリードは起きない）
+type IsolationLevel uint8
+
+const (
+	// IsolationReadCommitted は文ごとに新しいスナップショットを読む
+	// 同じ行を読み直すと値が変わることがあり（ノンリピータブルリード）、ファントムも起きる
+	IsolationReadCommitted IsolationLevel = iota
+	// IsolationRepeatableRead は BEGIN の時点のスナップショットを読み続ける（スナップショット分離）
+	// 同じ行を先に変更したトランザクションがコミットしていれば、コミットで ErrWriteConflict になる
+	// 別々の行を読んで書くトランザクションの組み合わせ（write skew）は防げない
+	IsolationRepeatableRead
+	// IsolationSerializable は読んだテーブルに S ロックを取り、最新のコミット済みの行を読む（strict 2PL）
+	// 読んだテーブルへのほかのトランザクションの書き込みはコミットまで待たされ、
+	// write skew になる組み合わせはデッドロックとして片方がロールバックされる
+	IsolationSerializable
+)
+
+// DefaultIsolationLevel はセッションが最初に使う分離レベル
+const DefaultIsolationLevel = IsolationRepeatableRead
+
+func (l IsolationLevel) String() string {
+	switch l {
+	case IsolationReadCommitted:
+		return "READ COMMITTED"
+	case IsolationRepeatableRead:
+		return "REPEATABLE READ"
+	case IsolationSerializable:
+		return "SERIALIZABLE"
+	default:
+		return fmt.Sprintf("IsolationLevel(%d)", l)
+	}
+}
+
+// ParseIsolationLevel は "READ COMMITTED" のような SQL の分離レベル名を IsolationLevel にする
+func ParseIsolationLevel(name string) (IsolationLevel, error) {
+	switch strings.ToUpper(strings.Join(strings.Fields(name), " ")) {
+	case "READ COMMITTED":
+		return IsolationReadCommitted, nil
+	case "REPEATABLE READ":
+		return IsolationRepeatableRead, nil
+	case "SERIALIZABLE":
+		return IsolationSerializable, nil
+	default:
+		return 0, fmt.Errorf("%w: %s", ErrUnsupportedIsolationLevel, name)
+	}
+}
@@ -0,0 +1,364 @@
+package dbtxn
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultLockTimeout はロックを待つ最大の時間
+const DefaultLockTimeout = 5 * time.Second
+
+var (
+	// ErrDeadlock はデッドロックの犠牲に選ばれたトランザクションのロック要求が返す
+	// 呼び出し側はトランザクションをロールバックしてロックを解放すること
+	ErrDeadlock = errors.New("deadlock detected: transaction chosen as victim")
+	// ErrLockTimeout はロックを待つ時間が上限を超えたときに返す
+	ErrLockTimeout = errors.New("lock wait timeout exceeded")
+)
+
+// LockMode はロックの種類
+// 行に S / X を取る前に、テーブルには意図ロック（IS / IX）を取る
+type LockMode uint8
+
+const (
+	LockIntentionShared    LockMode = iota // IS: テーブルの行を読む
+	LockIntentionExclusive                 // IX: テーブルの行を変更する
+	LockShared                             // S: 読み取り
+	LockExclusive                          // X: 書き込み
+)
+
+func (m LockMode) String() string {
+	switch m {
+	case LockIntentionShared:
+		return "IS"
+	case LockIntentionExclusive:
+		return "IX"
+	case LockShared:
+		return "S"
+	case LockExclusive:
+		return "X"
+	default:
+		return fmt.Sprintf("LockMode(%d)", m)
+	}
+}
+
+// lockCompatible[a][b] は a と b を別々のトランザクションが同時に持てるかどうか
+var lockCompatible = [4][4]bool{
+	//                        IS     IX     S      X
+	LockIntentionShared:    {true, true, true, false},
+	LockIntentionExclusive: {true, true, false, false},
+	LockShared:             {true, false, true, false},
+	LockExclusive:          {false, false, false, false},
+}
+
+// covers は m を持っていれば requested のロックも持っているとみなせるかどうかを返す
+func (m LockMode) covers(requested LockMode) bool {
+	switch m {
+	case LockExclusive:
+		return true
+	case LockShared, LockIntentionExclusive:
+		return requested == m || requested == LockIntentionShared
+	default:
+		return requested == LockIntentionShared
+	}
+}
+
+// upgradeMode は held と requested の両方を満たす最も弱いモードを返す
+// S と IX の組み合わせ（SIX）は持たないので X にする
+func upgradeMode(held, requested LockMode) LockMode {
+	if held.covers(requested) {
+		return held
+	}
+	if requested.covers(held) {
+		return requested
+	}
+	return LockExclusive
+}
+
+// LockKey はロックの対象
+// RowID が 0 ならテーブル全体を表す（行IDは 1 から振られる）
+type LockKey struct {
+	Table string
+	RowID int64
+}
+
+// TableLockKey はテーブル全体のロックのキーを返す
+func TableLockKey(table string) LockKey {
+	return LockKey{Table: table}
+}
+
+// RowLockKey はテーブルの1行のロックのキーを返す
+func RowLockKey(table string, rowID int64) LockKey {
+	return LockKey{Table: table, RowID: rowID}
+}
+
+func (k LockKey) String() string {
+	if k.RowID == 0 {
+		return k.Table
+	}
+	return fmt.Sprintf("%s#%d", k.Table, k.RowID)
+}
+
+// lockRequest は待っているロック要求
+type lockRequest struct {
+	txnID uint64
+	mode  LockMode
+	done  chan error // 許可されたら nil、デッドロックの犠牲になったら ErrDeadlock を受け取る
+}
+
+// lockQueue は1つのキーに対するロックの状態
+// 待っている要求は到着順に許可する（格上げの要求だけは先頭に入れる）
+type lockQueue struct {
+	granted map[uint64]LockMode
+	waiting []*lockRequest
+}
+
+// compatible は txnID 以外のトランザクションが持つロックと mode が両立するかどうかを返す
+func (q *lockQueue) compatible(txnID uint64, mode LockMode) bool {
+	for id, held := range q.granted {
+		if id != txnID && !lockCompatible[held][mode] {
+			return false
+		}
+	}
+	return true
+}
+
+// lockWait はトランザクションが待っているロック
+type lockWait struct {
+	key     LockKey
+	request *lockRequest
+}
+
+// LockManager は行とテーブルのロックを管理する
+// ロックはトランザクションが終わるまで持ち続け、ReleaseAll でまとめて解放する（strict 2PL）
+// 待ち始めるたびに待ちグラフを調べ、閉路ができたら最も新しいトランザクションを犠牲にする
+type LockManager struct {
+	mu      sync.Mutex
+	queues  map[LockKey]*lockQueue
+	held    map[uint64]map[LockKey]struct{} // トランザクションが持つロック
+	waits   map[uint64]lockWait             // トランザクションが待っているロック（待つのは同時に1つだけ）
+	timeout time.Duration
+}
+
+func NewLockManager() *LockManager {
+	return NewLockManagerWithTimeout(DefaultLockTimeout)
+}
+
+// NewLockManagerWithTimeout はロックを待つ時間の上限を指定してロックマネージャーを作成する
+func NewLockManagerWithTimeout(timeout time.Duration) *LockManager {
+	return &LockManager{
+		queues:  make(map[LockKey]*lockQueue),
+		held:    make(map[uint64]map[LockKey]struct{}),
+		waits:   make(map[uint64]lockWait),
+		timeout: timeout,
+	}
+}
+
+// Lock は txnID のトランザクションに key のロックを取る
+// 両立しないロックをほかのトランザクションが持っていれば、解放されるまで待つ
+// すでに持っているロックより強いモードを要求した場合は格上げする
+func (lm *LockManager) Lock(txnID uint64, key LockKey, mode LockMode) error {
+	lm.mu.Lock()
+	q, ok := lm.queues[key]
+	if !ok {
+		q = &lockQueue{granted: make(map[uint64]LockMode)}
+		lm.queues[key] = q
+	}
+	held, holding := q.granted[txnID]
+	if holding {
+		if held.covers(mode) {
+			lm.mu.Unlock()
+			return nil
+		}
+		mode = upgradeMode(held, mode)
+	}
+	// 格上げは待っている要求を追い越す（後ろに並ぶと、自分の持つロックを待つ要求を待つことになる）
+	if (holding || len(q.waiting) == 0) && q.compatible(txnID, mode) {
+		lm.grant(q, key, txnID, mode)
+		lm.mu.Unlock()
+		return nil
+	}
+
+	request := &lockRequest{txnID: txnID, mode: mode, done: make(chan error, 1)}
+	if holding {
+		q.waiting = append([]*lockRequest{request}, q.waiting...)
+	} else {
+		q.waiting = append(q.waiting, request)
+	}
+	lm.waits[txnID] = lockWait{key: key, request: request}
+	if cycle := lm.findCycle(txnID); cycle != nil {
+		lm.abort(victimOf(cycle))
+	}
+	lm.mu.Unlock()
+
+	timer := time.NewTimer(lm.timeout)
+	defer timer.Stop()
+	select {
+	case err := <-request.done:
+		return err
+	case <-timer.C:
+	}
+
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	// タイムアウトと同時に許可されていればそちらを優先する
+	select {
+	case err := <-request.done:
+		return err
+	default:
+	}
+	lm.cancel(key, request)
+	return ErrLockTimeout
+}
+
+// ReleaseAll はトランザクションが持つロックをすべて解放し、待っている要求を許可する
+func (lm *LockManager) ReleaseAll(txnID uint64) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	if wait, ok := lm.waits[txnID]; ok {
+		lm.cancel(wait.key, wait.request)
+	}
+	for key := range lm.held[txnID] {
+		if q, ok := lm.queues[key]; ok {
+			delete(q.granted, txnID)
+			lm.wake(key, q)
+		}
+	}
+	delete(lm.held, txnID)
+}
+
+// GetHeldMode はトランザクションが key に持つロックのモードを返す
+func (lm *LockManager) GetHeldMode(txnID uint64, key LockKey) (LockMode, bool) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	q, ok := lm.queues[key]
+	if !ok {
+		return 0, false
+	}
+	mode, ok := q.granted[txnID]
+	return mode, ok
+}
+
+// GetWaitCount はロックを待っているトランザクションの数を返す
+func (lm *LockManager) GetWaitCount() int {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	return len(lm.waits)
+}
+
+// grant はロックを許可する
+func (lm *LockManager) grant(q *lockQueue, key LockKey, txnID uint64, mode LockMode) {
+	q.granted[txnID] = mode
+	keys, ok := lm.held[txnID]
+	if !ok {
+		keys = make(map[LockKey]struct{})
+		lm.held[txnID] = keys
+	}
+	keys[key] = struct{}{}
+}
+
+// wake は待っている要求を先頭から順に、両立する限り許可する
+func (lm *LockManager) wake(key LockKey, q *lockQueue) {
+	for len(q.waiting) > 0 {
+		request := q.waiting[0]
+		if !q.compatible(request.txnID, request.mode) {
+			break
+		}
+		q.waiting = q.waiting[1:]
+		delete(lm.waits, request.txnID)
+		lm.grant(q, key, request.txnID, request.mode)
+		request.done <- nil
+	}
+	if len(q.granted) == 0 && len(q.waiting) == 0 {
+		delete(lm.queues, key)
+	}
+}
+
+// cancel は待っている要求を取り下げる
+// 先頭の要求がなくなると後ろの要求を許可できることがあるので wake も呼ぶ
+func (lm *LockManager) cancel(key LockKey, request *lockRequest) {
+	delete(lm.waits, request.txnID)
+	q, ok := lm.queues[key]
+	if !ok {
+		return
+	}
+	for i, r := range q.waiting {
+		if r == request {
+			q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+			break
+		}
+	}
+	lm.wake(key, q)
+}
+
+// abort はデッドロックの犠牲になったトランザクションの待ちを取り下げ、ErrDeadlock を通知する
+// 持っているロックはトランザクションのロールバックで解放される
+func (lm *LockManager) abort(txnID uint64) {
+	wait, ok := lm.waits[txnID]
+	if !ok {
+		return
+	}
+	lm.cancel(wait.key, wait.request)
+	wait.request.done <- ErrDeadlock
+}
+
+// waitsFor は待ちグラフで txnID から出る辺（txnID が終わるのを待っているトランザクション）を返す
+// 両立しないロックを持つトランザクションと、同じキーで先に並んでいる両立しない要求が対象
+func (lm *LockManager) waitsFor(txnID uint64) []uint64 {
+	wait, ok := lm.waits[txnID]
+	if !ok {
+		return nil
+	}
+	q := lm.queues[wait.key]
+	blockers := make([]uint64, 0)
+	for id, held := range q.granted {
+		if id != txnID && !lockCompatible[held][wait.request.mode] {
+			blockers = append(blockers, id)
+		}
+	}
+	for _, r := range q.waiting {
+		if r == wait.request {
+			break
+		}
+		if r.txnID != txnID && !lockCompatible[r.mode][wait.request.mode] {
+			blockers = append(blockers, r.txnID)
+		}
+	}
+	return blockers
+}
+
+// findCycle は start を含む待ちグラフの閉路を探し、見つかればその上のトランザクションを返す
+// 閉路ができるのは待ち始めたときだけなので、待ち始めたトランザクションから探せば十分
+func (lm *LockManager) findCycle(start uint64) []uint64 {
+	path := make([]uint64, 0)
+	visited := make(map[uint64]bool)
+	var visit func(txnID uint64) bool
+	visit = func(txnID uint64) bool {
+		path = append(path, txnID)
+		visited[txnID] = true
+		for _, next := range lm.waitsFor(txnID) {
+			if next == start || (!visited[next] && visit(next)) {
+				return true
+			}
+		}
+		path = path[:len(path)-1]
+		return false
+	}
+	if visit(start) {
+		return path
+	}
+	return nil
+}
+
+// victimOf は閉路の中で最も新しい（IDが大きい）トランザクションを犠牲に選ぶ
+// 新しいトランザクションほど取り消す変更が少ないとみなす
+func victimOf(cycle []uint64) uint64 {
+	victim := cycle[0]
+	for _, txnID := range cycle[1:] {
+		victim = max(victim, txnID)
+	}
+	return victim
+}
@@ -0,0 +1,226 @@
+package dbtxn
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// lockAsync は別の goroutine でロックを取り、結果を返すチャネルを返す
+func lockAsync(lm *LockManager, txnID uint64, key LockKey, mode LockMode) <-chan error {
+	result := make(chan error, 1)
+	go func() { result <- lm.Lock(txnID, key, mode) }()
+	return result
+}
+
+// expectBlocked はロック要求がまだ許可されていないことを確かめる
+func expectBlocked(t *testing.T, result <-chan error) {
+	t.Helper()
+	select {
+	case err := <-result:
+		t.Fatalf("expected the lock request to wait, got %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+// awaitWaitCount は n 個のトランザクションがロックを待ち始めるまで待つ
+func awaitWaitCount(t *testing.T, lm *LockManager, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for lm.GetWaitCount() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d lock waiters, got %d", n, lm.GetWaitCount())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func expectGranted(t *testing.T, result <-chan error) {
+	t.Helper()
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatalf("expected the lock to be granted, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("lock request was not granted")
+	}
+}
+
+func TestLockCompatibility(t *testing.T) {
+	tests := []struct {
+		held, requested LockMode
+		compatible      bool
+	}{
+		{LockShared, LockShared, true},
+		{LockShared, LockExclusive, false},
+		{LockExclusive, LockShared, false},
+		{LockIntentionShared, LockIntentionExclusive, true},
+		{LockIntentionExclusive, LockIntentionExclusive, true},
+		{LockIntentionExclusive, LockShared, false},
+		{LockIntentionShared, LockShared, true},
+		{LockIntentionShared, LockExclusive, false},
+	}
+	for _, tt := range tests {
+		lm := NewLockManagerWithTimeout(time.Second)
+		key := TableLockKey("users")
+		if err := lm.Lock(1, key, tt.held); err != nil {
+			t.Fatalf("Lock(%s) failed: %v", tt.held, err)
+		}
+		result := lockAsync(lm, 2, key, tt.requested)
+		if tt.compatible {
+			expectGranted(t, result)
+			continue
+		}
+		expectBlocked(t, result)
+		lm.ReleaseAll(1)
+		expectGranted(t, result)
+	}
+}
+
+func TestLockUpgrade(t *testing.T) {
+	lm := NewLockManagerWithTimeout(time.Second)
+	key := RowLockKey("users", 1)
+	lm.Lock(1, key, LockShared)
+	lm.Lock(2, key, LockShared)
+
+	// ほかのトランザクションが S を持っている間は X に格上げできない
+	result := lockAsync(lm, 1, key, LockExclusive)
+	expectBlocked(t, result)
+	lm.ReleaseAll(2)
+	expectGranted(t, result)
+	if mode, ok := lm.GetHeldMode(1, key); !ok || mode != LockExclusive {
+		t.Errorf("expected X after upgrade, got %s (held=%v)", mode, ok)
+	}
+	// 弱いモードを要求しても X のまま
+	lm.Lock(1, key, LockShared)
+	if mode, _ := lm.GetHeldMode(1, key); mode != LockExclusive {
+		t.Errorf("expected X to be kept, got %s", mode)
+	}
+	// S と IX を両方持つなら X にする
+	table := TableLockKey("users")
+	lm.Lock(3, table, LockShared)
+	lm.Lock(3, table, LockIntentionExclusive)
+	if mode, _ := lm.GetHeldMode(3, table); mode != LockExclusive {
+		t.Errorf("expected S+IX to become X, got %s", mode)
+	}
+}
+
+func TestLockWaitersAreGrantedInOrder(t *testing.T) {
+	lm := NewLockManagerWithTimeout(time.Second)
+	key := RowLockKey("users", 1)
+	lm.Lock(1, key, LockExclusive)
+	writer := lockAsync(lm, 2, key, LockExclusive)
+	expectBlocked(t, writer)
+	// 先に X を待つ要求があるので、S は両立しても追い越さない
+	reader := lockAsync(lm, 3, key, LockShared)
+	expectBlocked(t, reader)
+
+	lm.ReleaseAll(1)
+	expectGranted(t, writer)
+	expectBlocked(t, reader)
+	lm.ReleaseAll(2)
+	expectGranted(t, reader)
+}
+
+func TestGetWaitCount(t *testing.T) {
+	lm := NewLockManagerWithTimeout(time.Second)
+	key := RowLockKey("users", 1)
+	lm.Lock(1, key, LockExclusive)
+	if n := lm.GetWaitCount(); n != 0 {
+		t.Fatalf("expected no waiters, got %d", n)
+	}
+
+	writer := lockAsync(lm, 2, key, LockExclusive)
+	awaitWaitCount(t, lm, 1)
+	lm.ReleaseAll(1)
+	expectGranted(t, writer)
+	if n := lm.GetWaitCount(); n != 0 {
+		t.Errorf("expected no waiters after the lock was granted, got %d", n)
+	}
+}
+
+func TestLockTimeout(t *testing.T) {
+	lm := NewLockManagerWithTimeout(30 * time.Millisecond)
+	key := RowLockKey("users", 1)
+	lm.Lock(1, key, LockExclusive)
+
+	if err := lm.Lock(2, key, LockShared); !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("expected ErrLockTimeout, got %v", err)
+	}
+	// タイムアウトした要求は取り下げられている
+	if _, ok := lm.GetHeldMode(2, key); ok {
+		t.Error("timed out request should not hold the lock")
+	}
+	lm.ReleaseAll(1)
+	if err := lm.Lock(2, key, LockExclusive); err != nil {
+		t.Fatalf("Lock after release failed: %v", err)
+	}
+}
+
+func TestDeadlockAbortsYoungestTransaction(t *testing.T) {
+	lm := NewLockManagerWithTimeout(5 * time.Second)
+	row1, row2 := RowLockKey("users", 1), RowLockKey("users", 2)
+	lm.Lock(1, row1, LockExclusive)
+	lm.Lock(2, row2, LockExclusive)
+
+	older := lockAsync(lm, 1, row2, LockExclusive)
+	expectBlocked(t, older)
+	// 2 が 1 を待つと閉路ができ、新しい 2 が犠牲になる（タイムアウトを待たない）
+	start := time.Now()
+	if err := lm.Lock(2, row1, LockExclusive); !errors.Is(err, ErrDeadlock) {
+		t.Fatalf("expected ErrDeadlock, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("deadlock was detected only after %v", elapsed)
+	}
+	// 犠牲になったトランザクションがロールバックしてロックを解放すると、古いほうが進む
+	expectBlocked(t, older)
+	lm.ReleaseAll(2)
+	expectGranted(t, older)
+}
+
+func TestDeadlockOnUpgrade(t *testing.T) {
+	lm := NewLockManagerWithTimeout(5 * time.Second)
+	key := RowLockKey("users", 1)
+	lm.Lock(1, key, LockShared)
+	lm.Lock(2, key, LockShared)
+
+	// 両方が S から X に格上げしようとするとデッドロックになる
+	older := lockAsync(lm, 1, key, LockExclusive)
+	expectBlocked(t, older)
+	if err := lm.Lock(2, key, LockExclusive); !errors.Is(err, ErrDeadlock) {
+		t.Fatalf("expected ErrDeadlock, got %v", err)
+	}
+	lm.ReleaseAll(2)
+	expectGranted(t, older)
+}
+
+func TestTxnManagerReleasesLocksAtCommit(t *testing.T) {
+	wal, _ := NewWAL(filepath.Join(t.TempDir(), "test.wal"))
+	defer wal.Close()
+	tm := NewTxnManagerWithLockManager(wal, nil, NewLockManagerWithTimeout(time.Second))
+
+	txn1, _ := tm.Begin()
+	txn2, _ := tm.Begin()
+	key := RowLockKey("users", 1)
+	if err := txn1.Lock(key, LockExclusive); err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+	result := make(chan error, 1)
+	go func() { result <- txn2.Lock(key, LockExclusive) }()
+	expectBlocked(t, result)
+
+	// ロックはコミットするまで解放されない
+	if err := tm.Commit(txn1); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	expectGranted(t, result)
+	if err := tm.Rollback(txn2); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	if _, ok := tm.GetLockManager().GetHeldMode(txn2.ID, key); ok {
+		t.Error("locks should be released at rollback")
+	}
+}
@@ -1,8 +1,10 @@
 package dbtxn
 
 import (
+	"fmt"
+	"slices"
+
 	"github.com/takeuchi-shogo/go-example-database/internal/catalog"
-	"github.com/takeuchi-shogo/go-example-database/internal/storage"
 )
 
 type RecoveryManager struct {
@@ -10,6 +12,21 @@ type RecoveryManager struct {
 	catalog catalog.Catalog
 }
 
+// RecoveryReport はリカバリで行った処理の概要
+type RecoveryReport struct {
+	StartLSN   uint64   // ログを読み始めた LSN（チェックポイントの REDO 開始位置）
+	Records    int      // 読み込んだログの数
+	Redone     int      // 再現した変更の数
+	Committed  int      // コミット済みのトランザクション数
+	UndoneTxns []uint64 // 取り消したトランザクション
+	Undone     int      // 取り消した変更の数
+}
+
+func (r *RecoveryReport) String() string {
+	return fmt.Sprintf("%d log records from LSN %d, redo %d changes (%d committed txns), undo %d changes in %d txns",
+		r.Records, r.StartLSN, r.Redone, r.Committed, r.Undone, len(r.UndoneTxns))
+}
+
 type TxnStatus struct {
 	ID      uint64
 	State   TxnState
@@ -24,29 +41,47 @@ func NewRecoveryManager(wal *WAL, catalog catalog.Catalog) *RecoveryManager {
 }
 
 func (rm *RecoveryManager) Recover() error {
+	_, err := rm.RecoverWithReport()
+	return err
+}
+
+// RecoverWithReport は分析・REDO・UNDO を行い、処理の概要を返す
+// 最後のチェックポイントがあれば、その REDO 開始位置からログを読む
+// それより前の変更はページに反映済みで、終わっていないトランザクションのログもそれ以降にある
+func (rm *RecoveryManager) RecoverWithReport() (*RecoveryReport, error) {
+	report := &RecoveryReport{StartLSN: 1}
+	if _, checkpoint := rm.wal.GetCheckpoint(); checkpoint != nil {
+		report.StartLSN = checkpoint.RedoLSN
+	}
 	// WAL を読み込む
-	records, err := rm.wal.Read()
+	records, err := rm.wal.ReadFrom(report.StartLSN)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	report.Records = len(records)
 
 	if len(records) == 0 {
-		return nil // リカバリー必要なし
+		return report, nil // リカバリー必要なし
 	}
 	// トランザクションごとに分類
 	txnMap := rm.analyzeTransactions(records)
+	for id, status := range txnMap {
+		if id != 0 && status.State == TxnStateCommitted {
+			report.Committed++
+		}
+	}
 
 	// REDO 処理
-	if err := rm.redo(txnMap); err != nil {
-		return err
+	if report.Redone, err = rm.redo(records); err != nil {
+		return nil, err
 	}
 
 	// UNDO 処理
-	if err := rm.undo(txnMap); err != nil {
-		return err
+	if err := rm.undo(txnMap, report); err != nil {
+		return nil, err
 	}
 
-	return nil
+	return report, nil
 }
 
 func (rm *RecoveryManager) analyzeTransactions(records []LogRecord) map[uint64]*TxnStatus {
@@ -75,138 +110,65 @@ func (rm *RecoveryManager) analyzeTransactions(records []LogRecord) map[uint64]*
 }
 
 // redo は REDO 処理を行う
-func (rm *RecoveryManager) redo(txnMap map[uint64]*TxnStatus) error {
+// コミットされたかどうかによらず、ログの順に変更（CLR を含む）をすべて再現する
+// 行を変更後の状態にするだけなので、すでに反映済みの変更を繰り返しても結果は変わらない
+func (rm *RecoveryManager) redo(records []LogRecord) (int, error) {
 	// catalog が nil の場合は REDO をスキップ
 	if rm.catalog == nil {
-		return nil
+		return 0, nil
 	}
-	for _, status := range txnMap {
-		if status.State != TxnStateCommitted {
+	redone := 0
+	for _, record := range records {
+		var image []byte
+		switch record.LogType {
+		case LogInsert, LogUpdate, LogCompensate:
+			image = record.After
+		case LogDelete:
+			image = nil
+		default:
 			continue
 		}
-		for _, record := range status.Records {
-			switch record.LogType {
-			case LogInsert:
-				// After を Before に、Before を After に変換
-				// データベースに対して INSERT 操作を行う
-				table, err := rm.catalog.GetTable(record.TableName)
-				if err != nil {
-					return err
-				}
-				schema, err := rm.catalog.GetSchema(record.TableName)
-				if err != nil {
-					return err
-				}
-				row, err := storage.DecodeRow(record.After, schema)
-				if err != nil {
-					return err
-				}
-				err = table.Insert(row)
-				if err != nil {
-					return err
-				}
-			case LogUpdate:
-				// After データで行を更新
-				table, err := rm.catalog.GetTable(record.TableName)
-				if err != nil {
-					return err
-				}
-				schema, err := rm.catalog.GetSchema(record.TableName)
-				if err != nil {
-					return err
-				}
-				row, err := storage.DecodeRow(record.After, schema)
-				if err != nil {
-					return err
-				}
-				_, err = table.Update(row.GetRowID(), row)
-				if err != nil {
-					return err
-				}
-			case LogDelete:
-				// After データで行を削除
-				table, err := rm.catalog.GetTable(record.TableName)
-				if err != nil {
-					return err
-				}
-				if _, err = table.Delete(int64(record.RowID)); err != nil {
-					return err
-				}
-			}
+		table, err := rm.catalog.GetTable(record.TableName)
+		if err != nil {
+			// 後で削除されたテーブルへの変更は再現しない
+			continue
+		}
+		if err := applyImage(table, int64(record.RowID), image); err != nil {
+			return redone, err
 		}
+		redone++
 	}
-	return nil
+	return redone, nil
 }
 
 // undo は UNDO 処理を行う
-func (rm *RecoveryManager) undo(txnMap map[uint64]*TxnStatus) error {
-	for _, status := range txnMap {
-		if status.State != TxnStateActive {
+// 終わっていないトランザクションの変更を取り消し、ROLLBACK ログを書く
+func (rm *RecoveryManager) undo(txnMap map[uint64]*TxnStatus, report *RecoveryReport) error {
+	// 新しいトランザクションから順に取り消す
+	ids := make([]uint64, 0, len(txnMap))
+	for id := range txnMap {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	slices.Reverse(ids)
+	for _, id := range ids {
+		status := txnMap[id]
+		// TxnID 0 はトランザクション外で自動的に確定した変更とシステムレコード
+		if status.State != TxnStateActive || status.ID == 0 {
 			continue
 		}
 		if rm.catalog != nil {
-			// 逆順に処理
-			for i := len(status.Records) - 1; i >= 0; i-- {
-				record := status.Records[i]
-				switch record.LogType {
-				case LogInsert:
-					// INSERT の取り消し → DELETE
-					table, err := rm.catalog.GetTable(record.TableName)
-					if err != nil {
-						return err
-					}
-					schema, err := rm.catalog.GetSchema(record.TableName)
-					if err != nil {
-						return err
-					}
-					row, err := storage.DecodeRow(record.After, schema)
-					if err != nil {
-						return err
-					}
-					_, err = table.Delete(row.GetRowID())
-					if err != nil {
-						return err
-					}
-				case LogUpdate:
-					// UPDATE の取り消し → Before データで行を更新
-					table, err := rm.catalog.GetTable(record.TableName)
-					if err != nil {
-						return err
-					}
-					schema, err := rm.catalog.GetSchema(record.TableName)
-					if err != nil {
-						return err
-					}
-					row, err := storage.DecodeRow(record.Before, schema)
-					if err != nil {
-						return err
-					}
-					_, err = table.Update(row.GetRowID(), row)
-					if err != nil {
-						return err
-					}
-				case LogDelete:
-					// DELETE の取り消し → Before データで行を挿入
-					table, err := rm.catalog.GetTable(record.TableName)
-					if err != nil {
-						return err
-					}
-					schema, err := rm.catalog.GetSchema(record.TableName)
-					if err != nil {
-						return err
-					}
-					row, err := storage.DecodeRow(record.Before, schema)
-					if err != nil {
-						return err
-					}
-					if err = table.Insert(row); err != nil {
-						return err
-					}
-				}
+			undone, err := undoTransaction(rm.wal, rm.catalog, status.ID, status.Records, nil)
+			report.Undone += undone
+			if err != nil {
+				return err
 			}
 		}
+		report.UndoneTxns = append(report.UndoneTxns, status.ID)
 		// Rollback したログを追記
-		rm.wal.LogRollback(status.ID)
+		if err := rm.wal.LogRollback(status.ID); err != nil {
+			return err
+		}
 	}
 	// UNDO ログをディスクに書き込む
 	return rm.wal.Flush()
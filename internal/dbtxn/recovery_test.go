@@ -175,3 +175,26 @@ func TestMultipleTransactions(t *testing.T) {
 		t.Errorf("expected 0 active txns, got %d", len(tm.activeTxns))
 	}
 }
+
+func TestTxnIDsContinueAfterReopen(t *testing.T) {
+	// 再起動後も以前のトランザクションIDを使い回さない
+	path := filepath.Join(t.TempDir(), "test.wal")
+
+	wal, _ := NewWAL(path)
+	tm := NewTxnManager(wal)
+	for i := 0; i < 3; i++ {
+		txn, _ := tm.Begin()
+		tm.Commit(txn)
+	}
+	wal.Close()
+
+	wal2, _ := NewWAL(path)
+	defer wal2.Close()
+	txn, err := NewTxnManager(wal2).Begin()
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	if txn.ID != 4 {
+		t.Errorf("expected txn ID 4 after reopen, got %d", txn.ID)
+	}
+}
@@ -0,0 +1,92 @@
+package dbtxn
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrSavepointNotFound = errors.New("savepoint not found")
+
+// savepoint はトランザクションの中で名前を付けた位置
+type savepoint struct {
+	name string
+	lsn  uint64 // SAVEPOINT ログの LSN（これより後のログが ROLLBACK TO で取り消される）
+}
+
+// findSavepoint は名前が一致する最も新しいセーブポイントの位置を返す
+// 同じ名前で作り直したセーブポイントは、古いほうを隠す
+func (txn *Transaction) findSavepoint(name string) (int, error) {
+	for i := len(txn.savepoints) - 1; i >= 0; i-- {
+		if txn.savepoints[i].name == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %s", ErrSavepointNotFound, name)
+}
+
+// Savepoint はトランザクションの現在の位置にセーブポイントを作成する
+func (tm *TxnManager) Savepoint(txn *Transaction, name string) error {
+	txn.mu.Lock()
+	defer txn.mu.Unlock()
+
+	if txn.State != TxnStateActive {
+		return fmt.Errorf("transaction is not active")
+	}
+	lsn, err := tm.wal.LogSavepoint(txn.ID, name)
+	if err != nil {
+		return err
+	}
+	txn.savepoints = append(txn.savepoints, savepoint{name: name, lsn: lsn})
+	return nil
+}
+
+// RollbackToSavepoint はセーブポイントより後の変更だけを取り消す
+// トランザクションは続き、セーブポイントも残る（その後に作ったセーブポイントは消える）
+// 取り消した変更のロックは解放しない（strict 2PL）
+func (tm *TxnManager) RollbackToSavepoint(txn *Transaction, name string) error {
+	txn.mu.Lock()
+	defer txn.mu.Unlock()
+
+	if txn.State != TxnStateActive {
+		return fmt.Errorf("transaction is not active")
+	}
+	i, err := txn.findSavepoint(name)
+	if err != nil {
+		return err
+	}
+	if tm.catalog != nil {
+		if err := tm.wal.Flush(); err != nil {
+			return err
+		}
+		records, err := tm.readTxnRecords(txn, txn.savepoints[i].lsn+1)
+		if err != nil {
+			return err
+		}
+		// 取り消した行はセーブポイントの時点の状態を自分の版として記録し直す
+		restored := func(record LogRecord, image []byte) {
+			txn.RecordVersion(record.TableName, int64(record.RowID), record.After, image)
+		}
+		if _, err := undoTransaction(tm.wal, tm.catalog, txn.ID, records, restored); err != nil {
+			return err
+		}
+	}
+	txn.savepoints = txn.savepoints[:i+1]
+	return nil
+}
+
+// ReleaseSavepoint はセーブポイントとその後に作ったセーブポイントを削除する
+// 変更は取り消さない
+func (tm *TxnManager) ReleaseSavepoint(txn *Transaction, name string) error {
+	txn.mu.Lock()
+	defer txn.mu.Unlock()
+
+	if txn.State != TxnStateActive {
+		return fmt.Errorf("transaction is not active")
+	}
+	i, err := txn.findSavepoint(name)
+	if err != nil {
+		return err
+	}
+	txn.savepoints = txn.savepoints[:i]
+	return nil
+}
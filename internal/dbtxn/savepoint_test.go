@@ -0,0 +1,94 @@
+package dbtxn
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRollbackToSavepoint(t *testing.T) {
+	cat, wal, table := setupUndoTest(t)
+	tm := NewTxnManagerWithCatalog(wal, cat)
+
+	txn, _ := tm.Begin()
+	loggedInsert(t, wal, table, txn.ID, newUser(1, 1, "alice"))
+	tm.Savepoint(txn, "a")
+	loggedInsert(t, wal, table, txn.ID, newUser(2, 2, "bob"))
+	tm.Savepoint(txn, "b")
+	loggedUpdate(t, wal, table, txn.ID, newUser(1, 1, "alice2"))
+	loggedDelete(t, wal, table, txn.ID, 2)
+
+	// 内側のセーブポイントまで戻す
+	if err := tm.RollbackToSavepoint(txn, "b"); err != nil {
+		t.Fatalf("RollbackToSavepoint(b) failed: %v", err)
+	}
+	if names := userNames(t, table); len(names) != 2 || names[1] != "alice" || names[2] != "bob" {
+		t.Fatalf("expected the state at savepoint b, got %v", names)
+	}
+	// セーブポイントは残るので、同じ位置に何度でも戻せる
+	loggedInsert(t, wal, table, txn.ID, newUser(3, 3, "carol"))
+	if err := tm.RollbackToSavepoint(txn, "b"); err != nil {
+		t.Fatalf("second RollbackToSavepoint(b) failed: %v", err)
+	}
+	if names := userNames(t, table); len(names) != 2 {
+		t.Fatalf("expected the state at savepoint b again, got %v", names)
+	}
+
+	// 外側まで戻すと、その後に作ったセーブポイントは消える
+	if err := tm.RollbackToSavepoint(txn, "a"); err != nil {
+		t.Fatalf("RollbackToSavepoint(a) failed: %v", err)
+	}
+	if names := userNames(t, table); len(names) != 1 || names[1] != "alice" {
+		t.Fatalf("expected the state at savepoint a, got %v", names)
+	}
+	if err := tm.RollbackToSavepoint(txn, "b"); !errors.Is(err, ErrSavepointNotFound) {
+		t.Errorf("expected ErrSavepointNotFound for b, got %v", err)
+	}
+	if err := tm.ReleaseSavepoint(txn, "a"); err != nil {
+		t.Fatalf("ReleaseSavepoint failed: %v", err)
+	}
+	if err := tm.RollbackToSavepoint(txn, "a"); !errors.Is(err, ErrSavepointNotFound) {
+		t.Errorf("expected ErrSavepointNotFound after release, got %v", err)
+	}
+
+	// トランザクション全体のロールバックは、部分的に取り消した変更を二重に取り消さない
+	if err := tm.Rollback(txn); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	if names := userNames(t, table); len(names) != 0 {
+		t.Errorf("expected no rows, got %v", names)
+	}
+}
+
+func TestRecoveryAfterRollbackToSavepoint(t *testing.T) {
+	cat, wal, table := setupUndoTest(t)
+	tm := NewTxnManagerWithCatalog(wal, cat)
+
+	// コミットしたトランザクションは、セーブポイントまで戻した変更を除いて再現される
+	committed, _ := tm.Begin()
+	loggedInsert(t, wal, table, committed.ID, newUser(1, 1, "alice"))
+	tm.Savepoint(committed, "sp")
+	loggedInsert(t, wal, table, committed.ID, newUser(2, 2, "bob"))
+	tm.RollbackToSavepoint(committed, "sp")
+	loggedUpdate(t, wal, table, committed.ID, newUser(1, 1, "alice2"))
+	if err := tm.Commit(committed); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	// 終わっていないトランザクションは、部分的に取り消した後の変更もすべて取り消される
+	active, _ := tm.Begin()
+	tm.Savepoint(active, "sp")
+	loggedInsert(t, wal, table, active.ID, newUser(3, 3, "carol"))
+	tm.RollbackToSavepoint(active, "sp")
+	loggedUpdate(t, wal, table, active.ID, newUser(1, 1, "uncommitted"))
+	wal.Flush()
+
+	report, err := NewRecoveryManager(wal, cat).RecoverWithReport()
+	if err != nil {
+		t.Fatalf("Recover failed: %v", err)
+	}
+	if report.Undone != 1 || len(report.UndoneTxns) != 1 || report.UndoneTxns[0] != active.ID {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if names := userNames(t, table); len(names) != 1 || names[1] != "alice2" {
+		t.Errorf("expected only alice2, got %v", names)
+	}
+}
@@ -1,11 +1,18 @@
 package dbtxn
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"sync"
 	"sync/atomic"
+
+	"github.com/takeuchi-shogo/go-example-database/internal/catalog"
 )
 
+// ErrCommitFailed は COMMIT ログを書けず、トランザクションをコミットせずに終了したことを表す
+var ErrCommitFailed = errors.New("commit failed")
+
 // TxnState はトランザクションの状態を表す
 type TxnState uint8
 
@@ -13,53 +20,136 @@ const (
 	TxnStateActive TxnState = iota
 	TxnStateCommitted
 	TxnStateRolledBack
+	TxnStateFailed // ロールバックを最後まで記録できずに終了した（再起動時のリカバリで取り消す）
 )
 
 // Transaction はトランザクションを管理する
 type Transaction struct {
-	ID       uint64
-	State    TxnState
-	StartLSN uint64
-	wal      *WAL
-	mu       sync.Mutex
+	ID         uint64
+	State      TxnState
+	StartLSN   uint64
+	CommitLSN  uint64 // COMMIT ログの LSN（コミットしていなければ 0）
+	wal        *WAL
+	locks      *LockManager
+	snapshot   *Snapshot // 読むスナップショット（READ COMMITTED では文ごとに取り直す）
+	versions   *VersionStore
+	isolation  IsolationLevel
+	savepoints []savepoint // 作成した順のセーブポイント
+	mu         sync.Mutex
+}
+
+// Lock はトランザクションが終わるまで持ち続けるロックを取る（strict 2PL）
+// ErrDeadlock や ErrLockTimeout が返ったらトランザクションをロールバックすること
+func (txn *Transaction) Lock(key LockKey, mode LockMode) error {
+	if txn.locks == nil {
+		return nil
+	}
+	return txn.locks.Lock(txn.ID, key, mode)
+}
+
+// GetSnapshot はトランザクションが読むスナップショットを返す
+func (txn *Transaction) GetSnapshot() *Snapshot {
+	return txn.snapshot
+}
+
+// GetIsolationLevel はトランザクションの分離レベルを返す
+func (txn *Transaction) GetIsolationLevel() IsolationLevel {
+	return txn.isolation
+}
+
+// RecordVersion はテーブルの行を変更する前に、変更前の版を残す
+func (txn *Transaction) RecordVersion(table string, rowID int64, before, after []byte) {
+	txn.versions.Record(txn.ID, table, rowID, before, after)
 }
 
 type TxnManager struct {
 	wal        *WAL
+	catalog    catalog.Catalog         // ROLLBACK で変更を取り消すテーブル（nil なら取り消さない）
 	nextTxnID  uint64                  // 次のトランザクションID
 	activeTxns map[uint64]*Transaction // アクティブなトランザクション
+	locks      *LockManager            // 行とテーブルのロック（トランザクションの終了時に解放する）
+	versions   *VersionStore           // スナップショットから読む行の古い版
 	mu         sync.Mutex
 }
 
 func NewTxnManager(wal *WAL) *TxnManager {
+	return NewTxnManagerWithCatalog(wal, nil)
+}
+
+// NewTxnManagerWithCatalog は ROLLBACK でカタログのテーブルに変更を取り消すトランザクションマネージャーを作成する
+func NewTxnManagerWithCatalog(wal *WAL, catalog catalog.Catalog) *TxnManager {
+	return NewTxnManagerWithLockManager(wal, catalog, NewLockManager())
+}
+
+// NewTxnManagerWithLockManager はロックを取るロックマネージャーを指定してトランザクションマネージャーを作成する
+func NewTxnManagerWithLockManager(wal *WAL, catalog catalog.Catalog, locks *LockManager) *TxnManager {
 	return &TxnManager{
 		wal:        wal,
-		nextTxnID:  1,
+		catalog:    catalog,
+		nextTxnID:  wal.GetMaxTxnID() + 1,
 		activeTxns: make(map[uint64]*Transaction),
+		locks:      locks,
+		versions:   NewVersionStore(),
 	}
 }
 
-// Begin は新しいトランザクションを開始する
+// GetVersionStore は行の古い版を保持するストアを返す
+func (tm *TxnManager) GetVersionStore() *VersionStore {
+	return tm.versions
+}
+
+// GetWAL はトランザクションのログを書く WAL を返す
+func (tm *TxnManager) GetWAL() *WAL {
+	return tm.wal
+}
+
+// GetLockManager はトランザクションがロックを取るロックマネージャーを返す
+func (tm *TxnManager) GetLockManager() *LockManager {
+	return tm.locks
+}
+
+// Begin は新しいトランザクションを既定の分離レベルで開始する
 func (tm *TxnManager) Begin() (*Transaction, error) {
+	return tm.BeginWithIsolationLevel(DefaultIsolationLevel)
+}
+
+// BeginWithIsolationLevel は分離レベルを指定して新しいトランザクションを開始する
+func (tm *TxnManager) BeginWithIsolationLevel(level IsolationLevel) (*Transaction, error) {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
 	txnID := atomic.AddUint64(&tm.nextTxnID, 1) - 1
 	// WAL に BEGIN ログを追加
-	if err := tm.wal.LogBegin(txnID); err != nil {
+	begin := &LogRecord{LogType: LogBegin, TxnID: txnID}
+	if err := tm.wal.Append(begin); err != nil {
 		return nil, err
 	}
 
 	txn := &Transaction{
-		ID:       txnID,
-		State:    TxnStateActive,
-		StartLSN: tm.wal.nextLSN,
+		ID:        txnID,
+		State:     TxnStateActive,
+		StartLSN:  begin.LSN,
+		locks:     tm.locks,
+		snapshot:  tm.versions.Snapshot(txnID),
+		versions:  tm.versions,
+		isolation: level,
 	}
 
 	tm.activeTxns[txnID] = txn
 	return txn, nil
 }
 
+// BeginStatement はトランザクションの中で文を実行する前に呼ぶ
+// READ COMMITTED なら、文の開始時点までにコミットされた変更が見えるようにスナップショットを取り直す
+func (tm *TxnManager) BeginStatement(txn *Transaction) {
+	if txn.isolation != IsolationReadCommitted {
+		return
+	}
+	old := txn.snapshot
+	txn.snapshot = tm.versions.Snapshot(txn.ID)
+	tm.versions.ReleaseSnapshot(old)
+}
+
 // Commit はトランザクションをコミットする
 func (tm *TxnManager) Commit(txn *Transaction) error {
 	txn.mu.Lock()
@@ -68,21 +158,40 @@ func (tm *TxnManager) Commit(txn *Transaction) error {
 	if txn.State != TxnStateActive {
 		return fmt.Errorf("transaction is not active")
 	}
+	// REPEATABLE READ では、スナップショットの後にほかのトランザクションがコミットした行を変更していたらロールバックする
+	// （READ COMMITTED は最新の行を変更してよく、SERIALIZABLE は読んだテーブルのロックで書き込みを順序付ける）
+	if txn.isolation == IsolationRepeatableRead {
+		if err := tm.versions.Validate(txn.snapshot); err != nil {
+			if rerr := tm.rollback(txn); rerr != nil {
+				return fmt.Errorf("%w (rollback failed: %v)", err, rerr)
+			}
+			return fmt.Errorf("%w: transaction rolled back", err)
+		}
+	}
 
-	txn.State = TxnStateCommitted
-	// WAL に COMMIT ログを追加
-	if err := tm.wal.LogCommit(txn.ID); err != nil {
-		return err
+	// WAL に COMMIT ログを追加し、ディスクに書き込まれるまで待つ（グループコミットならほかのコミットとまとめて書く）
+	commit := &LogRecord{LogType: LogCommit, TxnID: txn.ID}
+	err := tm.wal.Append(commit)
+	if err == nil {
+		err = tm.wal.FlushTo(commit.LSN)
 	}
-	// バッファをフラッシュ
-	if err := tm.wal.Flush(); err != nil {
-		return err
+	if err != nil {
+		return tm.abortCommit(txn, err)
 	}
+	txn.State = TxnStateCommitted
+	txn.CommitLSN = commit.LSN
 
-	tm.mu.Lock()
-	delete(tm.activeTxns, txn.ID)
-	tm.mu.Unlock()
+	// コミットが永続化されてから新しいスナップショットに版を見せ、ロックを解放する
+	tm.versions.Commit(txn.ID)
+	tm.finish(txn)
 
+	// ログが増えてセグメントを切り替えていたらチェックポイントを取り、古いセグメントを削除する
+	// コミットはすでに永続化しているので、失敗してもコミットの結果にはせずログに残す（次のコミットで取り直す）
+	if tm.wal.CheckpointDue() {
+		if err := tm.wal.Checkpoint(); err != nil {
+			log.Printf("checkpoint failed: %v", err)
+		}
+	}
 	return nil
 }
 
@@ -94,22 +203,77 @@ func (tm *TxnManager) Rollback(txn *Transaction) error {
 	if txn.State != TxnStateActive {
 		return fmt.Errorf("transaction is not active")
 	}
+	return tm.rollback(txn)
+}
 
-	txn.State = TxnStateRolledBack
-	// WAL に ROLLBACK ログを追加
-	if err := tm.wal.LogRollback(txn.ID); err != nil {
-		return err
+// rollback はトランザクションの変更を取り消す（呼び出し側が txn.mu を持つ）
+// 失敗してもトランザクションは終了させ、ROLLBACK ログを書けなかった分は再起動時のリカバリで取り消す
+func (tm *TxnManager) rollback(txn *Transaction) error {
+	// StartLSN 以降のログを逆順にたどって変更を取り消す
+	var err error
+	if tm.catalog != nil {
+		err = tm.undo(txn)
 	}
-	// バッファをフラッシュ
-	if err := tm.wal.Flush(); err != nil {
-		return err
+	// すべて取り消してから ROLLBACK ログを追加し、ディスクに書き込む
+	if err == nil {
+		err = tm.wal.LogRollback(txn.ID)
 	}
+	if err == nil {
+		err = tm.wal.Flush()
+	}
+	if err == nil {
+		txn.State = TxnStateRolledBack
+	} else {
+		txn.State = TxnStateFailed
+	}
+
+	// 版を取り除き、ロックを解放する
+	tm.versions.Abort(txn.ID)
+	tm.finish(txn)
+	return err
+}
 
-	// TODO: UNDO 操作
+// abortCommit は COMMIT ログを書けなかったトランザクションをロールバックする
+func (tm *TxnManager) abortCommit(txn *Transaction, cause error) error {
+	if rerr := tm.rollback(txn); rerr != nil {
+		return fmt.Errorf("%w: %v (rollback failed: %v)", ErrCommitFailed, cause, rerr)
+	}
+	return fmt.Errorf("%w: %v: transaction rolled back", ErrCommitFailed, cause)
+}
 
+// finish は終了したトランザクションをアクティブなトランザクションから外し、スナップショットとロックを解放する
+func (tm *TxnManager) finish(txn *Transaction) {
 	tm.mu.Lock()
 	delete(tm.activeTxns, txn.ID)
 	tm.mu.Unlock()
+	tm.versions.ReleaseSnapshot(txn.snapshot)
+	tm.locks.ReleaseAll(txn.ID)
+}
 
-	return nil
+// undo はトランザクションのログを読み、before-image をテーブルに書き戻す
+func (tm *TxnManager) undo(txn *Transaction) error {
+	if err := tm.wal.Flush(); err != nil {
+		return err
+	}
+	txnRecords, err := tm.readTxnRecords(txn, txn.StartLSN)
+	if err != nil {
+		return err
+	}
+	_, err = undoTransaction(tm.wal, tm.catalog, txn.ID, txnRecords, nil)
+	return err
+}
+
+// readTxnRecords は lsn 以降のトランザクションのログを LSN の昇順に返す
+func (tm *TxnManager) readTxnRecords(txn *Transaction, lsn uint64) ([]LogRecord, error) {
+	records, err := tm.wal.ReadFrom(lsn)
+	if err != nil {
+		return nil, err
+	}
+	txnRecords := make([]LogRecord, 0)
+	for _, record := range records {
+		if record.TxnID == txn.ID {
+			txnRecords = append(txnRecords, record)
+		}
+	}
+	return txnRecords, nil
 }
@@ -1,6 +1,8 @@
 package dbtxn
 
 import (
+	"errors"
+	"os"
 	"path/filepath"
 	"testing"
 )
@@ -127,3 +129,124 @@ func TestAnalyzeTransactions(t *testing.T) {
 		t.Errorf("TxnID=3 should be RolledBack, got %d", txnMap[3].State)
 	}
 }
+
+func TestCommitFailureReleasesTransaction(t *testing.T) {
+	// COMMIT ログを書けなければコミット済みにせず、ロックとスナップショットを解放する
+	dir := t.TempDir()
+	wal, err := NewWAL(filepath.Join(dir, "test.wal"))
+	if err != nil {
+		t.Fatalf("NewWAL failed: %v", err)
+	}
+	tm := NewTxnManager(wal)
+
+	txn, err := tm.Begin()
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	key := RowLockKey("users", 1)
+	if err := txn.Lock(key, LockExclusive); err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+	// セグメントを閉じて書き込みを失敗させる
+	wal.file.Close()
+
+	if err := tm.Commit(txn); !errors.Is(err, ErrCommitFailed) {
+		t.Fatalf("expected ErrCommitFailed, got %v", err)
+	}
+	// ROLLBACK ログも書けないので、ロールバック済みにはしない
+	if txn.State != TxnStateFailed {
+		t.Errorf("expected Failed state, got %d", txn.State)
+	}
+	if _, ok := tm.activeTxns[txn.ID]; ok {
+		t.Error("failed transaction should not stay active")
+	}
+	if _, held := tm.locks.GetHeldMode(txn.ID, key); held {
+		t.Error("failed transaction should release its locks")
+	}
+	if err := tm.Rollback(txn); err == nil {
+		t.Error("expected error when rolling back a finished transaction")
+	}
+}
+
+func TestRollbackFailureReleasesTransaction(t *testing.T) {
+	// ROLLBACK ログを書けなくても、版を取り除いてロックとスナップショットを解放する
+	wal, err := NewWAL(filepath.Join(t.TempDir(), "test.wal"))
+	if err != nil {
+		t.Fatalf("NewWAL failed: %v", err)
+	}
+	tm := NewTxnManager(wal)
+
+	txn, err := tm.Begin()
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	key := RowLockKey("users", 1)
+	if err := txn.Lock(key, LockExclusive); err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+	tm.versions.Record(txn.ID, "users", 1, nil, []byte("row"))
+	wal.file.Close()
+
+	if err := tm.Rollback(txn); err == nil {
+		t.Fatal("expected rollback to fail when the WAL cannot be written")
+	}
+	if txn.State != TxnStateFailed {
+		t.Errorf("expected Failed state, got %d", txn.State)
+	}
+	if _, ok := tm.activeTxns[txn.ID]; ok {
+		t.Error("failed transaction should not stay active")
+	}
+	if _, held := tm.locks.GetHeldMode(txn.ID, key); held {
+		t.Error("failed transaction should release its locks")
+	}
+	if _, ok := tm.versions.writes[txn.ID]; ok || tm.versions.GetVersionCount() != 0 {
+		t.Error("failed transaction should drop its uncommitted versions")
+	}
+}
+
+func TestCommitSucceedsWhenCheckpointFails(t *testing.T) {
+	// コミットが永続化されていれば、チェックポイントが失敗してもコミットは成功する
+	path := filepath.Join(t.TempDir(), "test.wal")
+	wal, err := NewWALWithSegmentSize(path, 256)
+	if err != nil {
+		t.Fatalf("NewWAL failed: %v", err)
+	}
+	tm := NewTxnManager(wal)
+	// マスターレコードを書けないようにする
+	if err := os.Mkdir(masterPath(path)+".tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for !wal.CheckpointDue() {
+		txn, err := tm.Begin()
+		if err != nil {
+			t.Fatalf("Begin failed: %v", err)
+		}
+		if err := tm.wal.LogInsert(txn.ID, "users", 1, nil, []byte("0123456789")); err != nil {
+			t.Fatalf("LogInsert failed: %v", err)
+		}
+		if err := tm.Commit(txn); err != nil {
+			t.Fatalf("Commit failed: %v", err)
+		}
+		if txn.State != TxnStateCommitted {
+			t.Fatalf("expected Committed state, got %d", txn.State)
+		}
+	}
+	txn, err := tm.Begin()
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	if err := tm.Commit(txn); err != nil {
+		t.Fatalf("expected commit to succeed when the checkpoint fails, got %v", err)
+	}
+	if txn.State != TxnStateCommitted {
+		t.Errorf("expected Committed state, got %d", txn.State)
+	}
+	if _, ok := tm.activeTxns[txn.ID]; ok {
+		t.Error("committed transaction should not stay active")
+	}
+	// 失敗したチェックポイントは次のコミットで取り直す
+	if !wal.CheckpointDue() {
+		t.Error("expected the checkpoint to stay due after it failed")
+	}
+}
@@ -0,0 +1,90 @@
+package dbtxn
+
+import (
+	"errors"
+	"math"
+
+	"github.com/takeuchi-shogo/go-example-database/internal/catalog"
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
+)
+
+// undoTransaction はトランザクションの変更を新しいものから順に取り消す
+// records はそのトランザクションのログを LSN の昇順に並べたもの
+// 取り消すたびに補償ログ（CLR）を書き、UndoNext に取り消したログの LSN を記録する
+// 途中で中断しても、次は CLR の UndoNext より前のログから再開するので同じ変更を二重に取り消さない
+// restored が nil でなければ、行を元に戻すたびに戻した後の行（nil なら行がない）を渡す
+// 戻り値は取り消した変更の数
+func undoTransaction(wal *WAL, cat catalog.Catalog, txnID uint64, records []LogRecord, restored func(record LogRecord, image []byte)) (int, error) {
+	undone := 0
+	undoNext := uint64(math.MaxUint64)
+	for i := len(records) - 1; i >= 0; i-- {
+		record := records[i]
+		if record.LSN >= undoNext {
+			continue
+		}
+		switch record.LogType {
+		case LogCompensate:
+			// この CLR より前に取り消し済みのログがある
+			undoNext = min(undoNext, record.UndoNext)
+			continue
+		case LogInsert, LogUpdate, LogDelete:
+		default:
+			continue
+		}
+		table, err := cat.GetTable(record.TableName)
+		if err != nil {
+			// トランザクション中に削除されたテーブルは取り消せないので飛ばす
+			undoNext = record.LSN
+			continue
+		}
+		// INSERT の取り消しは行の削除、UPDATE / DELETE の取り消しは変更前の行に戻す
+		var image []byte
+		if record.LogType != LogInsert {
+			image = record.Before
+		}
+		// 先に CLR を書いてからテーブルに反映する
+		if err := wal.Append(&LogRecord{
+			LogType:   LogCompensate,
+			TxnID:     txnID,
+			TableName: record.TableName,
+			RowID:     record.RowID,
+			Before:    record.After,
+			After:     image,
+			UndoNext:  record.LSN,
+		}); err != nil {
+			return undone, err
+		}
+		if restored != nil {
+			restored(record, image)
+		}
+		if err := applyImage(table, int64(record.RowID), image); err != nil {
+			return undone, err
+		}
+		undoNext = record.LSN
+		undone++
+	}
+	return undone, nil
+}
+
+// applyImage は行を image の状態にする（image が nil なら行がない状態にする）
+// 現在の状態によらず同じ結果になるので、REDO や UNDO を何度繰り返してもよい
+func applyImage(table *storage.Table, rowID int64, image []byte) error {
+	if image == nil {
+		if _, err := table.Delete(rowID); err != nil && !errors.Is(err, storage.ErrRowNotFound) {
+			return err
+		}
+		return nil
+	}
+	row, err := storage.DecodeRow(image, table.GetSchema())
+	if err != nil {
+		return err
+	}
+	row.SetRowID(rowID)
+	if _, err := table.FindByRowID(rowID); err == nil {
+		_, err = table.Update(rowID, row)
+		return err
+	} else if !errors.Is(err, storage.ErrRowNotFound) {
+		return err
+	}
+	return table.Insert(row)
+}
@@ -0,0 +1,255 @@
+package dbtxn
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/takeuchi-shogo/go-example-database/internal/catalog"
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
+)
+
+// setupUndoTest は users(id, name) テーブルを持つカタログと WAL を作成する
+func setupUndoTest(t *testing.T) (catalog.Catalog, *WAL, *storage.Table) {
+	t.Helper()
+	dir := t.TempDir()
+	cat, err := catalog.NewCatalog(dir)
+	if err != nil {
+		t.Fatalf("NewCatalog failed: %v", err)
+	}
+	t.Cleanup(func() { cat.Close() })
+	schema := storage.NewSchema("users", []storage.Column{
+		*storage.NewColumn("id", storage.ColumnTypeInt32, 0, false),
+		*storage.NewColumn("name", storage.ColumnTypeString, 255, true),
+	})
+	if err := cat.CreateTable("users", schema); err != nil {
+		t.Fatalf("CreateTable failed: %v", err)
+	}
+	wal, err := NewWAL(filepath.Join(dir, "test.wal"))
+	if err != nil {
+		t.Fatalf("NewWAL failed: %v", err)
+	}
+	t.Cleanup(func() { wal.Close() })
+	table, _ := cat.GetTable("users")
+	return cat, wal, table
+}
+
+func newUser(rowID int64, id int32, name string) *storage.Row {
+	return storage.NewRowWithID(rowID, []storage.Value{storage.Int32Value(id), storage.StringValue(name)})
+}
+
+// userNames は行IDごとの name を返す
+func userNames(t *testing.T, table *storage.Table) map[int64]string {
+	t.Helper()
+	rows, err := table.Scan()
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	names := make(map[int64]string)
+	for _, row := range rows {
+		names[row.GetRowID()] = string(row.GetValues()[1].(storage.StringValue))
+	}
+	return names
+}
+
+// 実行器と同じように WAL に記録してからテーブルを変更する
+func loggedInsert(t *testing.T, wal *WAL, table *storage.Table, txnID uint64, row *storage.Row) {
+	t.Helper()
+	wal.LogInsert(txnID, "users", uint64(row.GetRowID()), nil, row.Encode())
+	if err := table.Insert(row); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+}
+
+func loggedUpdate(t *testing.T, wal *WAL, table *storage.Table, txnID uint64, row *storage.Row) {
+	t.Helper()
+	before, _ := table.FindByRowID(row.GetRowID())
+	wal.LogUpdate(txnID, "users", uint64(row.GetRowID()), before.Encode(), row.Encode())
+	if _, err := table.Update(row.GetRowID(), row); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+}
+
+func loggedDelete(t *testing.T, wal *WAL, table *storage.Table, txnID uint64, rowID int64) {
+	t.Helper()
+	before, _ := table.FindByRowID(rowID)
+	wal.LogDelete(txnID, "users", uint64(rowID), before.Encode())
+	if _, err := table.Delete(rowID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+}
+
+func TestRollbackUndoesChanges(t *testing.T) {
+	cat, wal, table := setupUndoTest(t)
+	tm := NewTxnManagerWithCatalog(wal, cat)
+
+	// コミット済みの行
+	committed, _ := tm.Begin()
+	loggedInsert(t, wal, table, committed.ID, newUser(1, 1, "alice"))
+	loggedInsert(t, wal, table, committed.ID, newUser(2, 2, "bob"))
+	if err := tm.Commit(committed); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	txn, _ := tm.Begin()
+	loggedInsert(t, wal, table, txn.ID, newUser(3, 3, "carol"))
+	loggedUpdate(t, wal, table, txn.ID, newUser(1, 1, "alice2"))
+	loggedUpdate(t, wal, table, txn.ID, newUser(1, 1, "alice3"))
+	loggedDelete(t, wal, table, txn.ID, 2)
+	if err := tm.Rollback(txn); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+
+	names := userNames(t, table)
+	if len(names) != 2 || names[1] != "alice" || names[2] != "bob" {
+		t.Errorf("expected committed rows only, got %v", names)
+	}
+
+	// 取り消した変更ごとに CLR があり、最後に ROLLBACK がある
+	records, _ := wal.Read()
+	clrs := 0
+	for _, r := range records {
+		if r.TxnID == txn.ID && r.LogType == LogCompensate {
+			clrs++
+		}
+	}
+	if clrs != 4 {
+		t.Errorf("expected 4 CLRs, got %d", clrs)
+	}
+	if last := records[len(records)-1]; last.LogType != LogRollback || last.TxnID != txn.ID {
+		t.Errorf("expected ROLLBACK as the last record, got %+v", last)
+	}
+}
+
+func TestUndoSkipsCompensatedRecords(t *testing.T) {
+	cat, wal, table := setupUndoTest(t)
+
+	// INSERT 2件のうち、後の1件だけ取り消したところで中断した状態を作る
+	wal.LogBegin(1)
+	loggedInsert(t, wal, table, 1, newUser(1, 1, "alice"))
+	loggedInsert(t, wal, table, 1, newUser(2, 2, "bob"))
+	wal.Flush()
+	records, _ := wal.Read()
+	if _, err := undoTransaction(wal, cat, 1, records[2:], nil); err != nil {
+		t.Fatalf("undoTransaction failed: %v", err)
+	}
+	wal.Flush()
+	records, _ = wal.Read()
+	if records[len(records)-1].LogType != LogCompensate {
+		t.Fatalf("expected a CLR, got %+v", records[len(records)-1])
+	}
+	if names := userNames(t, table); len(names) != 1 || names[1] != "alice" {
+		t.Fatalf("expected only alice, got %v", names)
+	}
+
+	// 別のトランザクションが同じ行IDを再利用していても、取り消し済みの INSERT は再度取り消さない
+	table.Insert(newUser(2, 2, "bob-again"))
+	if undone, err := undoTransaction(wal, cat, 1, records[1:], nil); err != nil || undone != 1 {
+		t.Fatalf("undoTransaction = %d, %v", undone, err)
+	}
+	names := userNames(t, table)
+	if len(names) != 1 || names[2] != "bob-again" {
+		t.Errorf("expected only bob-again, got %v", names)
+	}
+}
+
+func TestRecoveryUndoesActiveTxn(t *testing.T) {
+	cat, wal, table := setupUndoTest(t)
+
+	wal.LogBegin(1)
+	loggedInsert(t, wal, table, 1, newUser(1, 1, "alice"))
+	wal.LogCommit(1)
+	wal.LogBegin(2)
+	loggedUpdate(t, wal, table, 2, newUser(1, 1, "changed"))
+	loggedInsert(t, wal, table, 2, newUser(2, 2, "bob"))
+	wal.Flush()
+
+	rm := NewRecoveryManager(wal, cat)
+	report, err := rm.RecoverWithReport()
+	if err != nil {
+		t.Fatalf("Recover failed: %v", err)
+	}
+	if report.Redone != 3 || report.Committed != 1 || report.Undone != 2 || len(report.UndoneTxns) != 1 || report.UndoneTxns[0] != 2 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	names := userNames(t, table)
+	if len(names) != 1 || names[1] != "alice" {
+		t.Errorf("expected only alice, got %v", names)
+	}
+
+	// 2回目のリカバリでも同じ状態になる
+	if err := rm.Recover(); err != nil {
+		t.Fatalf("second Recover failed: %v", err)
+	}
+	if names := userNames(t, table); len(names) != 1 || names[1] != "alice" {
+		t.Errorf("expected only alice after second recovery, got %v", names)
+	}
+}
+
+func TestRecoveryStartsFromCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	walPath := filepath.Join(dir, "test.wal")
+	schema := storage.NewSchema("users", []storage.Column{
+		*storage.NewColumn("id", storage.ColumnTypeInt32, 0, false),
+		*storage.NewColumn("name", storage.ColumnTypeString, 255, true),
+	})
+	wal, _ := NewWAL(walPath)
+	pool := storage.NewBufferPool(16, storage.EvictionPolicyLRU)
+	wal.SetBufferPool(pool)
+	cat, err := catalog.NewCatalogWithBufferPool(dir, pool)
+	if err != nil {
+		t.Fatalf("NewCatalog failed: %v", err)
+	}
+	t.Cleanup(func() { cat.Close() })
+	cat.CreateTable("users", schema)
+	table, _ := cat.GetTable("users")
+	tm := NewTxnManagerWithCatalog(wal, cat)
+
+	for i := int64(1); i <= 3; i++ {
+		txn, _ := tm.Begin()
+		loggedInsert(t, wal, table, txn.ID, newUser(i, int32(i), "before"))
+		tm.Commit(txn)
+	}
+	// チェックポイントの時点で終わっていないトランザクション
+	active, _ := tm.Begin()
+	loggedUpdate(t, wal, table, active.ID, newUser(1, 1, "uncommitted"))
+	if err := wal.Checkpoint(); err != nil {
+		t.Fatalf("Checkpoint failed: %v", err)
+	}
+	checkpointLSN, data := wal.GetCheckpoint()
+	if data.ActiveTxns[active.ID] != active.StartLSN || data.RedoLSN != active.StartLSN {
+		t.Errorf("unexpected checkpoint: %+v", data)
+	}
+	// チェックポイント後の変更はページに書き出さないまま終了する
+	txn, _ := tm.Begin()
+	loggedInsert(t, wal, table, txn.ID, newUser(4, 4, "after"))
+	tm.Commit(txn)
+	loggedUpdate(t, wal, table, active.ID, newUser(2, 2, "uncommitted"))
+	wal.Close()
+
+	// ディスク上のファイルだけから開き直してリカバリする
+	wal2, err := NewWAL(walPath)
+	if err != nil {
+		t.Fatalf("reopen WAL failed: %v", err)
+	}
+	t.Cleanup(func() { wal2.Close() })
+	cat2, err := catalog.NewCatalog(dir)
+	if err != nil {
+		t.Fatalf("reopen catalog failed: %v", err)
+	}
+	t.Cleanup(func() { cat2.Close() })
+	report, err := NewRecoveryManager(wal2, cat2).RecoverWithReport()
+	if err != nil {
+		t.Fatalf("Recover failed: %v", err)
+	}
+	if report.StartLSN != active.StartLSN || report.StartLSN >= checkpointLSN {
+		t.Errorf("expected recovery to start at LSN %d, got %+v", active.StartLSN, report)
+	}
+	if len(report.UndoneTxns) != 1 || report.UndoneTxns[0] != active.ID || report.Undone != 2 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	table2, _ := cat2.GetTable("users")
+	names := userNames(t, table2)
+	if len(names) != 4 || names[1] != "before" || names[2] != "before" || names[4] != "after" {
+		t.Errorf("unexpected rows after recovery: %v", names)
+	}
+}
@@ -0,0 +1,261 @@
+package dbtxn
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// ErrWriteConflict は、スナップショットを取った後にほかのトランザクションがコミットした行を
+// 変更したトランザクションのコミットが返す（先にコミットしたほうが勝つ）
+var ErrWriteConflict = errors.New("write conflict: row was modified by a concurrent transaction")
+
+// rowVersion は行の1つの版
+// テーブルには常に最新の版（未コミットかもしれない）が書かれていて、
+// 古い版はここに新しい順の連鎖として残す
+type rowVersion struct {
+	data     []byte // 行をエンコードしたもの（nil なら行が存在しない）
+	txnID    uint64 // 版を作ったトランザクション（0 なら版を記録し始める前からある行）
+	commitTS uint64 // 作ったトランザクションのコミット時刻（未コミットなら 0）
+	prev     *rowVersion
+}
+
+func (v *rowVersion) committed() bool {
+	return v.txnID == 0 || v.commitTS != 0
+}
+
+// Visibility はスナップショットから行がどう見えるかを表す
+type Visibility uint8
+
+const (
+	VisibleCurrent Visibility = iota // テーブルにある最新の行が見える
+	VisibleVersion                   // 古い版が見える
+	Invisible                        // 行は見えない（コミットされていない挿入や、スナップショットより前の削除）
+)
+
+// VersionStore はテーブルの行の古い版を保持し、スナップショットごとに見える版を返す
+// 版を持つのは変更されてからまだ全員に見えるようになっていない行だけで、ほかの行はテーブルの行がそのまま見える
+// コミットするたびに時刻を1つ進め、スナップショットはその時刻までにコミットした版を見る
+type VersionStore struct {
+	mu        sync.Mutex
+	clock     uint64                           // 最後にコミットしたトランザクションのコミット時刻
+	chains    map[string]map[int64]*rowVersion // テーブル名 -> 行ID -> 最新の版
+	writes    map[uint64]map[LockKey]struct{}  // トランザクションが変更した行
+	snapshots map[*Snapshot]struct{}           // 使われているスナップショット（GC で残す版を決める）
+}
+
+func NewVersionStore() *VersionStore {
+	return &VersionStore{
+		chains:    make(map[string]map[int64]*rowVersion),
+		writes:    make(map[uint64]map[LockKey]struct{}),
+		snapshots: make(map[*Snapshot]struct{}),
+	}
+}
+
+// Snapshot はある時点までにコミットされたデータの見え方
+type Snapshot struct {
+	store  *VersionStore
+	txnID  uint64 // 自分の変更は常に見える（トランザクションの外なら 0）
+	readTS uint64 // この時刻までにコミットした版が見える
+}
+
+// Snapshot は現在の時刻のスナップショットを作成する
+// 使い終わったら ReleaseSnapshot を呼ぶこと（それまで必要な古い版は GC されない）
+func (vs *VersionStore) Snapshot(txnID uint64) *Snapshot {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	s := &Snapshot{store: vs, txnID: txnID, readTS: vs.clock}
+	vs.snapshots[s] = struct{}{}
+	return s
+}
+
+// ReleaseSnapshot はスナップショットを使い終え、不要になった古い版を捨てる
+func (vs *VersionStore) ReleaseSnapshot(s *Snapshot) {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	delete(vs.snapshots, s)
+	vs.collectGarbage()
+}
+
+// GetReadTS はスナップショットの時刻を返す
+func (s *Snapshot) GetReadTS() uint64 {
+	return s.readTS
+}
+
+// visible はスナップショットから版が見えるかどうかを返す
+func (s *Snapshot) visible(v *rowVersion) bool {
+	if v.txnID != 0 && v.txnID == s.txnID {
+		return true
+	}
+	return v.committed() && v.commitTS <= s.readTS
+}
+
+// Read は行のどの版が見えるかを返す
+// VisibleVersion のときは見える版のエンコードした行も返す
+func (s *Snapshot) Read(table string, rowID int64) (Visibility, []byte) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+	head, ok := s.store.chains[table][rowID]
+	if !ok {
+		return VisibleCurrent, nil
+	}
+	for v := head; v != nil; v = v.prev {
+		if !s.visible(v) {
+			continue
+		}
+		switch {
+		case v.data == nil:
+			return Invisible, nil
+		case v == head:
+			return VisibleCurrent, nil
+		default:
+			return VisibleVersion, v.data
+		}
+	}
+	return Invisible, nil
+}
+
+// VersionedRows はテーブルで版を持つ行のうち、スナップショットから見える行を行IDの順に返す
+// テーブルから削除された行や、走査中に別のページへ移動した行を補うために使う
+func (s *Snapshot) VersionedRows(table string) (rowIDs []int64, rows [][]byte) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+	chains := s.store.chains[table]
+	for _, rowID := range slices.Sorted(maps.Keys(chains)) {
+		for v := chains[rowID]; v != nil; v = v.prev {
+			if s.visible(v) {
+				if v.data != nil {
+					rowIDs = append(rowIDs, rowID)
+					rows = append(rows, v.data)
+				}
+				break
+			}
+		}
+	}
+	return rowIDs, rows
+}
+
+// Record はトランザクションによる行の変更を記録する
+// テーブルを変更する前に呼ぶこと（変更中の行をほかのスナップショットが読んでも古い版が見つかるように）
+// before は変更前の行（挿入なら nil）、after は変更後の行（削除なら nil）
+// 呼び出し側は行に X ロックを持っていること
+func (vs *VersionStore) Record(txnID uint64, table string, rowID int64, before, after []byte) {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	chains, ok := vs.chains[table]
+	if !ok {
+		chains = make(map[int64]*rowVersion)
+		vs.chains[table] = chains
+	}
+	head, ok := chains[rowID]
+	switch {
+	case ok && head.txnID == txnID && !head.committed():
+		// 同じトランザクションが続けて変更した
+		head.data = after
+	case ok:
+		// テーブルにあった行が最新の版の内容
+		head.data = before
+		chains[rowID] = &rowVersion{data: after, txnID: txnID, prev: head}
+	default:
+		base := &rowVersion{data: before}
+		chains[rowID] = &rowVersion{data: after, txnID: txnID, prev: base}
+	}
+	keys, ok := vs.writes[txnID]
+	if !ok {
+		keys = make(map[LockKey]struct{})
+		vs.writes[txnID] = keys
+	}
+	keys[RowLockKey(table, rowID)] = struct{}{}
+}
+
+// Validate はトランザクションが変更した行を、スナップショットより後にほかのトランザクションが
+// コミットしていないかを確かめる
+func (vs *VersionStore) Validate(s *Snapshot) error {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	for key := range vs.writes[s.txnID] {
+		head, ok := vs.chains[key.Table][key.RowID]
+		if !ok || head.txnID != s.txnID {
+			continue
+		}
+		// 自分が上書きした版
+		if overwritten := head.prev; overwritten != nil && overwritten.commitTS > s.readTS {
+			return ErrWriteConflict
+		}
+	}
+	return nil
+}
+
+// Commit はトランザクションの版をコミット済みにする
+// COMMIT ログが書き込まれてから呼ぶ
+func (vs *VersionStore) Commit(txnID uint64) {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	vs.clock++
+	for key := range vs.writes[txnID] {
+		if head, ok := vs.chains[key.Table][key.RowID]; ok && head.txnID == txnID {
+			head.commitTS = vs.clock
+		}
+	}
+	delete(vs.writes, txnID)
+	vs.collectGarbage()
+}
+
+// Abort はロールバックしたトランザクションの版を取り除く
+// テーブルの行を元に戻してから呼ぶ
+func (vs *VersionStore) Abort(txnID uint64) {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	for key := range vs.writes[txnID] {
+		chains := vs.chains[key.Table]
+		if head, ok := chains[key.RowID]; ok && head.txnID == txnID && !head.committed() {
+			chains[key.RowID] = head.prev
+		}
+	}
+	delete(vs.writes, txnID)
+	vs.collectGarbage()
+}
+
+// GetVersionCount は保持している版の数を返す（版の記録を始める前からある行の版も含む）
+func (vs *VersionStore) GetVersionCount() int {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	count := 0
+	for _, chains := range vs.chains {
+		for _, head := range chains {
+			for v := head; v != nil; v = v.prev {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// collectGarbage は使われているどのスナップショットにも必要ない古い版を捨てる
+// 最も古いスナップショットから見える版より古い版は誰も読まない
+// 最新の版が全員に見えるなら、テーブルの行を読めばよいので連鎖ごと捨てる
+func (vs *VersionStore) collectGarbage() {
+	oldest := vs.clock
+	for s := range vs.snapshots {
+		oldest = min(oldest, s.readTS)
+	}
+	for table, chains := range vs.chains {
+		for rowID, head := range chains {
+			for v := head; v != nil; v = v.prev {
+				if !v.committed() || v.commitTS > oldest {
+					continue
+				}
+				if v == head {
+					delete(chains, rowID)
+				} else {
+					v.prev = nil
+				}
+				break
+			}
+		}
+		if len(chains) == 0 {
+			delete(vs.chains, table)
+		}
+	}
+}
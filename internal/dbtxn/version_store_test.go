@@ -0,0 +1,109 @@
+package dbtxn
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestVersionStoreVisibility(t *testing.T) {
+	vs := NewVersionStore()
+	before := vs.Snapshot(0)
+
+	// txn 1 が行を更新した（まだコミットしていない）
+	writer := vs.Snapshot(1)
+	vs.Record(1, "users", 1, []byte("alice"), []byte("bob"))
+	if v, _ := writer.Read("users", 1); v != VisibleCurrent {
+		t.Errorf("writer should see its own change, got %v", v)
+	}
+	if v, data := before.Read("users", 1); v != VisibleVersion || !bytes.Equal(data, []byte("alice")) {
+		t.Errorf("uncommitted change should be hidden, got %v %q", v, data)
+	}
+	// ほかのテーブルや変更されていない行はテーブルの行がそのまま見える
+	if v, _ := before.Read("users", 2); v != VisibleCurrent {
+		t.Errorf("unversioned row should be read from the table, got %v", v)
+	}
+
+	vs.Commit(1)
+	vs.ReleaseSnapshot(writer)
+	after := vs.Snapshot(0)
+	if v, _ := after.Read("users", 1); v != VisibleCurrent {
+		t.Errorf("snapshot taken after commit should see the new row, got %v", v)
+	}
+	// コミットより前のスナップショットには古い版が見え続ける
+	if v, data := before.Read("users", 1); v != VisibleVersion || !bytes.Equal(data, []byte("alice")) {
+		t.Errorf("old snapshot should keep seeing the old row, got %v %q", v, data)
+	}
+}
+
+func TestVersionStoreInsertAndDelete(t *testing.T) {
+	vs := NewVersionStore()
+	reader := vs.Snapshot(0)
+
+	vs.Record(1, "users", 1, nil, []byte("alice"))
+	vs.Record(2, "users", 2, []byte("bob"), nil)
+	if v, _ := reader.Read("users", 1); v != Invisible {
+		t.Errorf("uncommitted insert should be invisible, got %v", v)
+	}
+	vs.Commit(1)
+	vs.Commit(2)
+	if v, _ := reader.Read("users", 1); v != Invisible {
+		t.Errorf("insert committed after the snapshot should be invisible, got %v", v)
+	}
+	// テーブルから削除された行は版から補う
+	rowIDs, rows := reader.VersionedRows("users")
+	if len(rowIDs) != 1 || rowIDs[0] != 2 || !bytes.Equal(rows[0], []byte("bob")) {
+		t.Errorf("expected the deleted row to stay visible, got %v %q", rowIDs, rows)
+	}
+}
+
+func TestVersionStoreWriteConflict(t *testing.T) {
+	vs := NewVersionStore()
+	first, second := vs.Snapshot(1), vs.Snapshot(2)
+
+	vs.Record(1, "users", 1, []byte("alice"), []byte("bob"))
+	if err := vs.Validate(first); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	vs.Commit(1)
+	// 2 のスナップショットより後に 1 がコミットした行を上書きした
+	vs.Record(2, "users", 1, []byte("bob"), []byte("carol"))
+	if err := vs.Validate(second); !errors.Is(err, ErrWriteConflict) {
+		t.Fatalf("expected ErrWriteConflict, got %v", err)
+	}
+	vs.Abort(2)
+
+	// コミットの後に始めたトランザクションは競合しない
+	third := vs.Snapshot(3)
+	vs.Record(3, "users", 1, []byte("bob"), []byte("dave"))
+	if err := vs.Validate(third); err != nil {
+		t.Errorf("unexpected conflict: %v", err)
+	}
+}
+
+func TestVersionStoreGarbageCollection(t *testing.T) {
+	vs := NewVersionStore()
+	reader := vs.Snapshot(0)
+	for i := uint64(1); i <= 3; i++ {
+		vs.Record(i, "users", 1, []byte{byte(i)}, []byte{byte(i + 1)})
+		vs.Commit(i)
+	}
+	// 古いスナップショットが使われている間は、そのスナップショットから見える版を残す
+	if v, data := reader.Read("users", 1); v != VisibleVersion || !bytes.Equal(data, []byte{1}) {
+		t.Fatalf("expected the oldest version, got %v %v", v, data)
+	}
+	latest := vs.Snapshot(0)
+	vs.ReleaseSnapshot(reader)
+	if count := vs.GetVersionCount(); count != 0 {
+		t.Errorf("expected all versions to be collected, got %d", count)
+	}
+	if v, _ := latest.Read("users", 1); v != VisibleCurrent {
+		t.Errorf("expected the table row after GC, got %v", v)
+	}
+	// ロールバックした変更の版も残らない
+	vs.Record(4, "users", 1, []byte{4}, []byte{5})
+	vs.Abort(4)
+	if count := vs.GetVersionCount(); count != 0 {
+		t.Errorf("expected aborted versions to be removed, got %d", count)
+	}
+}
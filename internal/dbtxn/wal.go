@@ -1,14 +1,20 @@
 package dbtxn
 
 import (
-	"bytes"
-	"encoding/binary"
-	"encoding/gob"
-	"io"
+	"errors"
+	"fmt"
+	"maps"
 	"os"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
+
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
 )
 
+// ErrWALFailed は書き込みに失敗したログを取り消せず、WAL に書き込めなくなったことを表す
+var ErrWALFailed = errors.New("WAL failed")
+
 type LogType uint8
 
 const (
@@ -23,6 +29,7 @@ const (
 	// チェックポイント
 	LogCheckpoint
 	LogCompensate // UNDO 時の補償ログ
+	LogSavepoint  // セーブポイント（TableName にセーブポイント名を入れる）
 )
 
 type LogRecord struct {
@@ -33,48 +40,230 @@ type LogRecord struct {
 	RowID     uint64  // 行ID
 	Before    []byte  // 変更前のデータ
 	After     []byte  // 変更後のデータ
+	UndoNext  uint64  // CLR のみ: 取り消したログの LSN（これより前のログが次の取り消し対象）
 }
 
 // WALはWrite-Ahead Logを管理する
+// ログはセグメントに分けて書き、チェックポイントで不要になった古いセグメントは削除する
+//
+// ロックは2つあり、flushMu を先に取る
+//   - flushMu: ファイルへの書き込みとセグメント（file, fileSize, segments, failed）を守る
+//   - mu: バッファと LSN などのメモリ上の状態を守る。fsync の間は持たないので、その間も Append できる
 type WAL struct {
-	filePath string
-	file     *os.File
-	mu       sync.Mutex
-	nextLSN  uint64
-	buffer   []LogRecord
+	filePath    string
+	flushMu     sync.Mutex
+	file        *os.File     // 書き込み中のセグメント
+	fileSize    int64        // 書き込み中のセグメントのサイズ
+	segments    []walSegment // 残っているセグメント（最後が書き込み中）
+	segmentSize int64        // このサイズを超えたら次のセグメントに切り替える
+	failed      error        // nil でなければ書き込めなくなった理由（以降の書き込みはすべて失敗する）
+	mu          sync.Mutex
+	nextLSN     uint64
+	flushedLSN  uint64 // ディスクに書き込み済みの最後の LSN
+	maxTxnID    uint64 // これまでにログに現れた最大のトランザクションID
+	buffer      []LogRecord
+	syncs       atomic.Uint64   // fsync の回数
+	groupCommit *groupCommitter // グループコミット（nil なら FlushTo はすぐに書き出す）
+	// activeTxns はアクティブトランザクション表（トランザクションID -> 最初のログの LSN）
+	activeTxns    map[uint64]uint64
+	checkpointLSN uint64          // 最後のチェックポイントの LSN（なければ 0）
+	checkpoint    *CheckpointData // 最後のチェックポイントの内容
+	checkpointDue bool            // 前回のチェックポイントからセグメントを切り替えた
+	pool          *storage.BufferPool
 }
 
 // NewWAL はWALを初期化する
 func NewWAL(path string) (*WAL, error) {
-	// ファイルを開く
-	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
-	if err != nil {
+	return NewWALWithSegmentSize(path, DefaultWALSegmentSize)
+}
+
+// NewWALWithSegmentSize は segmentSize バイトごとにセグメントを切り替える WAL を初期化する
+func NewWALWithSegmentSize(path string, segmentSize int64) (*WAL, error) {
+	if segmentSize <= 0 {
+		segmentSize = DefaultWALSegmentSize
+	}
+	wal := &WAL{
+		filePath:    path,
+		segmentSize: segmentSize,
+		mu:          sync.Mutex{},
+		nextLSN:     1,
+		buffer:      make([]LogRecord, 0),
+		activeTxns:  make(map[uint64]uint64),
+	}
+	if err := wal.open(); err != nil {
 		return nil, err
 	}
+	return wal, nil
+}
 
-	wal := &WAL{
-		filePath: path,
-		file:     file,
-		mu:       sync.Mutex{},
-		nextLSN:  1,
-		buffer:   make([]LogRecord, 0),
+// open は既存のログから次の LSN・最大のトランザクションID・アクティブトランザクション表を復元し、
+// 最後のセグメントを追記用に開く
+// マスターレコードにチェックポイントがあれば、それより前のログは読まない
+func (w *WAL) open() error {
+	segments, err := listSegments(w.filePath)
+	if err != nil {
+		return err
+	}
+	if len(segments) == 0 {
+		segments = []walSegment{{index: 0, path: segmentPath(w.filePath, 0)}}
+	}
+	for i := range segments {
+		segments[i].firstLSN, err = readFirstLSN(segments[i].path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	w.segments = segments
+
+	checkpointLSN, err := readMaster(w.filePath)
+	if err != nil {
+		return err
 	}
+	for i := w.segmentFor(checkpointLSN); i < len(segments); i++ {
+		end, err := readSegment(segments[i].path, func(record *LogRecord) error {
+			if record.LSN < checkpointLSN {
+				return nil
+			}
+			w.nextLSN = record.LSN + 1
+			if record.LSN == checkpointLSN && record.LogType == LogCheckpoint {
+				data, err := decodeCheckpointData(record.After)
+				if err != nil {
+					return err
+				}
+				w.checkpointLSN, w.checkpoint = record.LSN, data
+				w.activeTxns = maps.Clone(data.ActiveTxns)
+				w.maxTxnID = max(w.maxTxnID, data.MaxTxnID)
+				return nil
+			}
+			w.track(record)
+			return nil
+		})
+		switch {
+		case err == ErrCorruptedWAL && i == len(segments)-1:
+			// 書き込み中にクラッシュした末尾のレコードは捨てる
+			if err := os.Truncate(segments[i].path, end); err != nil {
+				return err
+			}
+		case os.IsNotExist(err):
+		case err != nil:
+			return err
+		}
+	}
+	if checkpointLSN > 0 && w.checkpoint == nil {
+		return ErrCheckpointNotFound
+	}
+	w.flushedLSN = w.nextLSN - 1
 
-	// 既存ログがあれば最後のLSNを取得
-	lastLSN, err := wal.getLastLSN()
-	if err == nil && lastLSN > 0 {
-		wal.nextLSN = lastLSN + 1
+	// 最後のセグメントに追記する
+	last := w.segments[len(w.segments)-1]
+	file, err := os.OpenFile(last.path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return err
 	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	w.file, w.fileSize = file, info.Size()
+	if w.fileSize == 0 {
+		return w.writeSegmentHeader()
+	}
+	// 以前の形式のセグメントには追記せず、新しい形式のセグメントに切り替える
+	// 古いセグメントは読めるまま残し、チェックポイントで不要になったら削除する
+	legacy, err := isLegacySegment(last.path)
+	if err != nil {
+		return err
+	}
+	if legacy {
+		return w.rotate()
+	}
+	return nil
+}
 
-	return wal, nil
+// writeSegmentHeader は空のセグメントの先頭に形式を表すヘッダーを書く
+func (w *WAL) writeSegmentHeader() error {
+	return w.write(segmentMagic)
 }
 
-func (w *WAL) getLastLSN() (uint64, error) {
-	records, err := w.Read()
-	if err != nil || len(records) == 0 {
-		return 0, err
+// segmentFor は lsn のレコードを含むセグメントの位置を返す
+func (w *WAL) segmentFor(lsn uint64) int {
+	for i := len(w.segments) - 1; i > 0; i-- {
+		if first := w.segments[i].firstLSN; first != 0 && first <= lsn {
+			return i
+		}
+	}
+	return 0
+}
+
+// GetMaxTxnID はこれまでにログに現れた最大のトランザクションIDを返す
+// 再起動後に同じトランザクションIDを使い回さないために使う
+func (w *WAL) GetMaxTxnID() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.maxTxnID
+}
+
+// GetCheckpoint は最後のチェックポイントの LSN と内容を返す（なければ 0 と nil）
+func (w *WAL) GetCheckpoint() (uint64, *CheckpointData) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.checkpointLSN, w.checkpoint
+}
+
+// SetBufferPool はテーブルのページを持つバッファプールを WAL に結び付ける
+//   - ページを書き出す前に WAL を書き出す（ログより先にページがディスクに載らないようにする）
+//   - ページがダーティになったときの recLSN を記録し、チェックポイントでダーティページ表を取る
+func (w *WAL) SetBufferPool(pool *storage.BufferPool) {
+	w.mu.Lock()
+	w.pool = pool
+	w.mu.Unlock()
+	pool.SetBeforeFlush(w.Flush)
+	pool.SetRecLSN(w.recLSN)
+}
+
+// recLSN はページがダーティになったときの recLSN を返す
+// 変更のログはページより先に書かれているので、アクティブなトランザクションの最初のログから REDO すれば足りる
+func (w *WAL) recLSN() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.oldestActiveLSN()
+}
+
+// oldestActiveLSN はアクティブなトランザクションの最初のログのうち最も古い LSN を返す
+// アクティブなトランザクションがなければ最後に追加したログの LSN を返す
+// 呼び出し側でロックを取得していること
+func (w *WAL) oldestActiveLSN() uint64 {
+	lsn := max(w.nextLSN-1, 1)
+	for _, first := range w.activeTxns {
+		lsn = min(lsn, first)
+	}
+	return lsn
+}
+
+// hasActiveTxns は終わっていないトランザクションがあれば true を返す
+func (w *WAL) hasActiveTxns() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.activeTxns) > 0
+}
+
+// track はアクティブトランザクション表と最大のトランザクションIDを更新する
+// 呼び出し側でロックを取得していること
+func (w *WAL) track(record *LogRecord) {
+	w.maxTxnID = max(w.maxTxnID, record.TxnID)
+	if record.TxnID == 0 {
+		return
+	}
+	switch record.LogType {
+	case LogCommit, LogRollback:
+		delete(w.activeTxns, record.TxnID)
+	case LogCheckpoint:
+	default:
+		if _, ok := w.activeTxns[record.TxnID]; !ok {
+			w.activeTxns[record.TxnID] = record.LSN
+		}
 	}
-	return records[len(records)-1].LSN, nil
 }
 
 // Append はLogRecordをバッファに追加する
@@ -84,6 +273,7 @@ func (w *WAL) Append(record *LogRecord) error {
 
 	record.LSN = w.nextLSN
 	w.nextLSN++
+	w.track(record)
 
 	w.buffer = append(w.buffer, *record)
 	return nil
@@ -91,115 +281,259 @@ func (w *WAL) Append(record *LogRecord) error {
 
 // Flush はバッファ内のレコードをディスクに書き込む
 func (w *WAL) Flush() error {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+	return w.flush()
+}
+
+// FlushTo は lsn までのレコードがディスクに書き込まれるまで待つ
+// グループコミットが有効なら、同じ時期に待っているほかのトランザクションとまとめて1回の fsync で書き込む
+func (w *WAL) FlushTo(lsn uint64) error {
+	if w.GetFlushedLSN() >= lsn {
+		return nil
+	}
+	w.mu.Lock()
+	gc := w.groupCommit
+	w.mu.Unlock()
+	if gc != nil {
+		return gc.wait(lsn)
+	}
+	return w.Flush()
+}
+
+// GetFlushedLSN はディスクに書き込み済みの最後の LSN を返す
+func (w *WAL) GetFlushedLSN() uint64 {
 	w.mu.Lock()
 	defer w.mu.Unlock()
+	return w.flushedLSN
+}
 
-	if len(w.buffer) == 0 {
+// flush はバッファ内のレコードを書き込み、セグメントが大きくなったら次に切り替える
+// 書き込みと fsync の間は mu を持たないので、ほかのトランザクションはその間もログを追加できる
+// 呼び出し側で flushMu を取得していること
+func (w *WAL) flush() error {
+	if w.failed != nil {
+		return w.failed
+	}
+	w.mu.Lock()
+	records := w.buffer
+	w.buffer = make([]LogRecord, 0)
+	w.mu.Unlock()
+	if len(records) == 0 {
 		return nil
 	}
-	// バッファ内の全てのレコードをシリアライズ
-	for _, record := range w.buffer {
-		data, err := w.serialize(&record)
-		if err != nil {
-			return err
-		}
-		// レコード長 + データを書き込む
-		length := uint32(len(data))
-		if err := binary.Write(w.file, binary.LittleEndian, length); err != nil {
-			return err
-		}
-		if _, err := w.file.Write(data); err != nil {
-			return err
-		}
+
+	// バッファ内の全てのレコードをエンコードし、まとめて書き込む
+	// 切り替えたセグメントのヘッダーを書けていなければ、レコードの前に書く
+	var data []byte
+	if w.fileSize == 0 {
+		data = append(data, segmentMagic...)
+	}
+	for _, record := range records {
+		data = appendRecord(data, &record)
 	}
-	// fsync でディスクに確実に書き込む
-	if err := w.file.Sync(); err != nil {
+	if err := w.write(data); err != nil {
+		// 書き込めなかったレコードはバッファに戻す（ファイルからは取り除いてあるので、次の書き出しで重複しない）
+		w.mu.Lock()
+		w.buffer = append(records, w.buffer...)
+		w.mu.Unlock()
 		return err
 	}
-	// バッファをクリア
-	w.buffer = make([]LogRecord, 0)
+	current := &w.segments[len(w.segments)-1]
+	if current.firstLSN == 0 {
+		current.firstLSN = records[0].LSN
+	}
+	w.mu.Lock()
+	w.flushedLSN = records[len(records)-1].LSN
+	w.mu.Unlock()
+
+	if w.fileSize >= w.segmentSize {
+		return w.rotate()
+	}
 	return nil
 }
 
-// serialize はLogRecordをシリアライズする
-func (w *WAL) serialize(record *LogRecord) ([]byte, error) {
-	var buf bytes.Buffer
-	enc := gob.NewEncoder(&buf)
-	if err := enc.Encode(record); err != nil {
-		return nil, err
+// write はデータをセグメントに追記し、fsync でディスクに確実に書き込む
+// 失敗したら追記した分を切り詰めてセグメントを元のサイズに戻す
+// 戻せなければ途中まで書いたレコードが残るので、以降は書き込まずに ErrWALFailed を返す
+func (w *WAL) write(data []byte) error {
+	_, err := w.file.Write(data)
+	if err == nil {
+		w.syncs.Add(1)
+		err = w.file.Sync()
+	}
+	if err != nil {
+		if terr := w.file.Truncate(w.fileSize); terr != nil {
+			w.failed = fmt.Errorf("%w: %v (truncate failed: %v)", ErrWALFailed, err, terr)
+			return w.failed
+		}
+		return err
 	}
-	return buf.Bytes(), nil
+	w.fileSize += int64(len(data))
+	return nil
 }
 
-// Read はディスクからLogRecordを読み込む
-func (w *WAL) Read() ([]LogRecord, error) {
-	// ファイルの先頭に移動
-	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
-		return nil, err
+// rotate は新しいセグメントを作成して書き込み先を切り替える
+// 呼び出し側で flushMu を取得していること
+func (w *WAL) rotate() error {
+	next := walSegment{index: w.segments[len(w.segments)-1].index + 1}
+	next.path = segmentPath(w.filePath, next.index)
+	file, err := os.OpenFile(next.path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if err := syncDir(filepath.Dir(w.filePath)); err != nil {
+		file.Close()
+		return err
+	}
+	if err := w.file.Close(); err != nil {
+		file.Close()
+		return err
 	}
+	w.file, w.fileSize = file, 0
+	w.segments = append(w.segments, next)
+	w.mu.Lock()
+	w.checkpointDue = true
+	w.mu.Unlock()
+	return w.writeSegmentHeader()
+}
 
-	var records []LogRecord
+// Read はディスクに残っているすべての LogRecord を読み込む
+func (w *WAL) Read() ([]LogRecord, error) {
+	return w.ReadFrom(0)
+}
+
+// ReadFrom は LSN が lsn 以上の LogRecord を読み込む
+// lsn より前のレコードしかないセグメントは読まない
+func (w *WAL) ReadFrom(lsn uint64) ([]LogRecord, error) {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
 
-	for {
-		// レコード長を読む
-		var length uint32
-		if err := binary.Read(w.file, binary.LittleEndian, &length); err != nil {
-			if err == io.EOF {
-				break
+	var records []LogRecord
+	for i := w.segmentFor(lsn); i < len(w.segments); i++ {
+		_, err := readSegment(w.segments[i].path, func(record *LogRecord) error {
+			if record.LSN >= lsn {
+				records = append(records, *record)
 			}
-			return nil, err
-		}
-		// read record data
-		data := make([]byte, length)
-		if _, err := io.ReadFull(w.file, data); err != nil {
-			return nil, err
-		}
-		// deserialize
-		record, err := w.deserialize(data)
+			return nil
+		})
 		if err != nil {
 			return nil, err
 		}
-		records = append(records, *record)
 	}
-
 	return records, nil
 }
 
-// deserialize はシリアライズされたデータをLogRecordにデシリアライズする
-func (w *WAL) deserialize(data []byte) (*LogRecord, error) {
-	var record LogRecord
-	buf := bytes.NewBuffer(data)
-	dec := gob.NewDecoder(buf)
-	if err := dec.Decode(&record); err != nil {
-		return nil, err
-	}
-	return &record, nil
+// CheckpointDue は前回のチェックポイントからセグメントを切り替えていれば true を返す
+func (w *WAL) CheckpointDue() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.checkpointDue
 }
 
-// Checkpoint はバッファ内のレコードをディスクに書き込み、チェックポイントレコードを追加する
+// Checkpoint はファジーチェックポイントを取る
+// トランザクションを止めずにダーティページを書き出し、アクティブトランザクション表とダーティページ表を
+// チェックポイントレコードに記録してからマスターレコードを更新する
+// REDO の開始位置より前のログしかないセグメントは削除する
 func (w *WAL) Checkpoint() error {
-	// バッファをフラッシュ
-	if err := w.Flush(); err != nil {
-		return err
+	w.mu.Lock()
+	// 書き出しを始める前の時点で終わっていないトランザクションのログは残す
+	redoLSN := w.oldestActiveLSN()
+	pool := w.pool
+	if pool == nil {
+		// ページの反映状況がわからないので、前回のチェックポイントより先には進めない
+		redoLSN = 1
+		if w.checkpoint != nil {
+			redoLSN = w.checkpoint.RedoLSN
+		}
 	}
-	// チェックポイントレコードを追加
-	record := &LogRecord{
+	w.mu.Unlock()
+
+	var dirtyPages []storage.DirtyPage
+	if pool != nil {
+		if err := pool.FlushAll(); err != nil {
+			return err
+		}
+		if err := pool.Sync(); err != nil {
+			return err
+		}
+		// 書き出している間にダーティになったページ
+		dirtyPages = pool.DirtyPages()
+		for _, page := range dirtyPages {
+			redoLSN = min(redoLSN, page.RecLSN)
+		}
+	}
+
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+	w.mu.Lock()
+	data := &CheckpointData{
+		RedoLSN:    redoLSN,
+		MaxTxnID:   w.maxTxnID,
+		ActiveTxns: maps.Clone(w.activeTxns),
+		DirtyPages: dirtyPages,
+	}
+	// UNDO のために終わっていないトランザクションのログもすべて残す
+	for _, first := range data.ActiveTxns {
+		data.RedoLSN = min(data.RedoLSN, first)
+	}
+	record := LogRecord{
+		LSN:     w.nextLSN,
 		LogType: LogCheckpoint,
 		TxnID:   0, // システムレコード
+		After:   data.encode(),
 	}
-
-	if err := w.Append(record); err != nil {
+	w.nextLSN++
+	w.buffer = append(w.buffer, record)
+	w.mu.Unlock()
+	if err := w.flush(); err != nil {
 		return err
 	}
-	if err := w.Flush(); err != nil {
+	if err := writeMaster(w.filePath, record.LSN); err != nil {
 		return err
 	}
-	return nil
+	w.mu.Lock()
+	w.checkpointLSN, w.checkpoint, w.checkpointDue = record.LSN, data, false
+	w.mu.Unlock()
+	return w.removeSegmentsBefore(data.RedoLSN)
+}
+
+// removeSegmentsBefore は lsn より前のレコードしかないセグメントを削除する
+// 書き込み中のセグメントは削除しない
+// 呼び出し側で flushMu を取得していること
+func (w *WAL) removeSegmentsBefore(lsn uint64) error {
+	n := 0
+	for n+1 < len(w.segments) {
+		next := w.segments[n+1].firstLSN
+		if next == 0 || next > lsn {
+			break
+		}
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+	for _, segment := range w.segments[:n] {
+		if err := os.Remove(segment.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	w.segments = w.segments[n:]
+	return syncDir(filepath.Dir(w.filePath))
 }
 
 // Close はWALを閉じる
 func (w *WAL) Close() error {
-	if err := w.Flush(); err != nil {
+	w.mu.Lock()
+	gc := w.groupCommit
+	w.groupCommit = nil
+	w.mu.Unlock()
+	if gc != nil {
+		gc.stop()
+	}
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+	if err := w.flush(); err != nil {
 		return err
 	}
 	return w.file.Close()
@@ -256,6 +590,20 @@ func (w *WAL) LogCommit(txnID uint64) error {
 	})
 }
 
+// LogSavepoint はセーブポイントをログに記録し、その LSN を返す
+// ROLLBACK TO SAVEPOINT はこの LSN より後のログを取り消す
+func (w *WAL) LogSavepoint(txnID uint64, name string) (uint64, error) {
+	record := &LogRecord{
+		LogType:   LogSavepoint,
+		TxnID:     txnID,
+		TableName: name,
+	}
+	if err := w.Append(record); err != nil {
+		return 0, err
+	}
+	return record.LSN, nil
+}
+
 // LogAbort はトランザクション中断をログに記録する
 func (w *WAL) LogRollback(txnID uint64) error {
 	return w.Append(&LogRecord{
@@ -0,0 +1,81 @@
+package dbtxn
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"math"
+)
+
+// レコードの本体は次の順に固定のバイト順（リトルエンディアン）で並べる
+//
+//	version u8 | type u8 | lsn u64 | txnID u64 | undoNext u64 | rowID u64
+//	| tableName (u16 長さ + バイト列) | before (u32 長さ + バイト列) | after (u32 長さ + バイト列)
+//
+// before / after の長さが nilImage なら nil（空のバイト列とは区別する）
+const (
+	recordVersion   = 1
+	recordFixedSize = 1 + 1 + 8*4 + 2 + 4 + 4
+	maxRecordSize   = 64 << 20
+	nilImage        = math.MaxUint32
+)
+
+// crcTable はレコード本体のチェックサム（CRC32C）に使う
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// appendRecord はレコードを [本体の長さ][本体の CRC32C][本体] の形で buf に追加する
+func appendRecord(buf []byte, record *LogRecord) []byte {
+	start := len(buf)
+	buf = append(buf, make([]byte, 8)...)
+	buf = append(buf, recordVersion, byte(record.LogType))
+	buf = binary.LittleEndian.AppendUint64(buf, record.LSN)
+	buf = binary.LittleEndian.AppendUint64(buf, record.TxnID)
+	buf = binary.LittleEndian.AppendUint64(buf, record.UndoNext)
+	buf = binary.LittleEndian.AppendUint64(buf, record.RowID)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(record.TableName)))
+	buf = append(buf, record.TableName...)
+	buf = appendImage(buf, record.Before)
+	buf = appendImage(buf, record.After)
+
+	body := buf[start+8:]
+	binary.LittleEndian.PutUint32(buf[start:], uint32(len(body)))
+	binary.LittleEndian.PutUint32(buf[start+4:], crc32.Checksum(body, crcTable))
+	return buf
+}
+
+func appendImage(buf []byte, image []byte) []byte {
+	if image == nil {
+		return binary.LittleEndian.AppendUint32(buf, nilImage)
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(image)))
+	return append(buf, image...)
+}
+
+// decodeRecord はチェックサムを確かめたレコード本体を LogRecord に戻す
+func decodeRecord(body []byte) (*LogRecord, error) {
+	r := &byteReader{data: body}
+	head := r.bytes(2)
+	if head == nil || head[0] != recordVersion {
+		return nil, ErrCorruptedWAL
+	}
+	record := &LogRecord{LogType: LogType(head[1])}
+	record.LSN = r.uint64()
+	record.TxnID = r.uint64()
+	record.UndoNext = r.uint64()
+	record.RowID = r.uint64()
+	record.TableName = string(r.bytes(int(r.uint16())))
+	record.Before = r.image()
+	record.After = r.image()
+	if r.short || len(r.data) != 0 {
+		return nil, ErrCorruptedWAL
+	}
+	return record, nil
+}
+
+// image は appendImage で書いたバイト列を読む
+func (r *byteReader) image() []byte {
+	n := r.uint32()
+	if n == nilImage || r.short {
+		return nil
+	}
+	return append([]byte{}, r.bytes(int(n))...)
+}
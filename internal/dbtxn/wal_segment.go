@@ -0,0 +1,206 @@
+package dbtxn
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DefaultWALSegmentSize はセグメントを切り替えるサイズ
+const DefaultWALSegmentSize = 16 << 20
+
+var (
+	// ErrCorruptedWAL は途中で切れたレコードやチェックサムが合わないレコード
+	// 最後のセグメントの末尾なら書き込み中のクラッシュとみなして切り詰め、それ以外はエラーにする
+	ErrCorruptedWAL = errors.New("corrupted WAL record")
+	// errStopReading は readSegment を途中で終えるために fn が返す
+	errStopReading = errors.New("stop reading")
+)
+
+// セグメントは先頭のヘッダーで形式を区別する
+// ヘッダーがなければ gob でエンコードした以前の形式として読む（書き込みは常に新しい形式）
+var segmentMagic = []byte("GODBWAL\x01")
+
+const segmentHeaderSize = 8
+
+// walSegment は WAL を分割したファイルの1つ
+// 最初のセグメントは WAL のパスそのもの、以降は "<パス>.000001" のように番号を付ける
+type walSegment struct {
+	index    int
+	path     string
+	firstLSN uint64 // 最初のレコードの LSN（空のセグメントは 0）
+}
+
+func segmentPath(walPath string, index int) string {
+	if index == 0 {
+		return walPath
+	}
+	return fmt.Sprintf("%s.%06d", walPath, index)
+}
+
+// listSegments は既存のセグメントを番号順に返す
+func listSegments(walPath string) ([]walSegment, error) {
+	entries, err := os.ReadDir(filepath.Dir(walPath))
+	if err != nil {
+		return nil, err
+	}
+	base := filepath.Base(walPath)
+	segments := make([]walSegment, 0)
+	for _, entry := range entries {
+		name := entry.Name()
+		index := 0
+		if name != base {
+			suffix, ok := strings.CutPrefix(name, base+".")
+			if !ok || len(suffix) != 6 {
+				continue
+			}
+			if index, err = strconv.Atoi(suffix); err != nil || index <= 0 {
+				continue
+			}
+		}
+		segments = append(segments, walSegment{index: index, path: segmentPath(walPath, index)})
+	}
+	slices.SortFunc(segments, func(a, b walSegment) int { return a.index - b.index })
+	return segments, nil
+}
+
+// readSegment はセグメントのレコードを先頭から順に読み、fn を呼ぶ
+// 戻り値は正しく読めた最後のレコードの終端オフセット
+// 末尾のレコードが途中で切れているか壊れていれば ErrCorruptedWAL を返す
+func readSegment(path string, fn func(record *LogRecord) error) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	header := make([]byte, segmentHeaderSize)
+	n, err := io.ReadFull(reader, header)
+	switch {
+	case err == io.EOF:
+		return 0, nil // 空のセグメント
+	case n < segmentHeaderSize && bytes.HasPrefix(segmentMagic, header[:n]):
+		return 0, ErrCorruptedWAL // ヘッダーを書いている途中
+	case n == segmentHeaderSize && bytes.Equal(header, segmentMagic):
+		return readRecords(reader, segmentHeaderSize, fn)
+	default:
+		return readLegacyRecords(io.MultiReader(bytes.NewReader(header[:n]), reader), fn)
+	}
+}
+
+// readRecords はヘッダーの後ろのレコードを読む
+// レコードは [本体の長さ u32][本体の CRC32C u32][本体] の形で並んでいる
+func readRecords(r io.Reader, offset int64, fn func(record *LogRecord) error) (int64, error) {
+	head := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, head); err != nil {
+			if err == io.EOF {
+				return offset, nil
+			}
+			if err == io.ErrUnexpectedEOF {
+				return offset, ErrCorruptedWAL
+			}
+			return offset, err
+		}
+		length := binary.LittleEndian.Uint32(head[0:4])
+		if length < recordFixedSize || length > maxRecordSize {
+			return offset, ErrCorruptedWAL
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(r, body); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return offset, ErrCorruptedWAL
+			}
+			return offset, err
+		}
+		if crc32.Checksum(body, crcTable) != binary.LittleEndian.Uint32(head[4:8]) {
+			return offset, ErrCorruptedWAL
+		}
+		record, err := decodeRecord(body)
+		if err != nil {
+			return offset, err
+		}
+		if err := fn(record); err != nil {
+			if err == errStopReading {
+				return offset, nil
+			}
+			return offset, err
+		}
+		offset += 8 + int64(length)
+	}
+}
+
+// readLegacyRecords は gob でエンコードした以前の形式のレコードを読む
+// レコードは [長さ u32][gob] の形で並んでいる
+func readLegacyRecords(r io.Reader, fn func(record *LogRecord) error) (int64, error) {
+	var offset int64
+	for {
+		var length uint32
+		if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+			if err == io.EOF {
+				return offset, nil
+			}
+			if err == io.ErrUnexpectedEOF {
+				return offset, ErrCorruptedWAL
+			}
+			return offset, err
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(r, data); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return offset, ErrCorruptedWAL
+			}
+			return offset, err
+		}
+		var record LogRecord
+		if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&record); err != nil {
+			return offset, ErrCorruptedWAL
+		}
+		if err := fn(&record); err != nil {
+			if err == errStopReading {
+				return offset, nil
+			}
+			return offset, err
+		}
+		offset += 4 + int64(length)
+	}
+}
+
+// isLegacySegment は以前の形式のレコードを持つセグメントかどうかを返す
+func isLegacySegment(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	header := make([]byte, segmentHeaderSize)
+	n, err := io.ReadFull(file, header)
+	if err == io.EOF {
+		return false, nil
+	}
+	return !bytes.HasPrefix(segmentMagic, header[:n]), nil
+}
+
+// readFirstLSN はセグメントの最初のレコードの LSN を返す（空なら 0）
+func readFirstLSN(path string) (uint64, error) {
+	var lsn uint64
+	_, err := readSegment(path, func(record *LogRecord) error {
+		lsn = record.LSN
+		return errStopReading
+	})
+	if err == ErrCorruptedWAL {
+		return 0, nil
+	}
+	return lsn, err
+}
@@ -1,9 +1,16 @@
 package dbtxn
 
 import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"io"
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
 )
 
 func TestNewWAL(t *testing.T) {
@@ -293,3 +300,326 @@ func TestLogAbort(t *testing.T) {
 		t.Errorf("expected LogAbort, got %d", records[2].LogType)
 	}
 }
+
+func TestSegmentRotationAndReadFrom(t *testing.T) {
+	// 小さいセグメントで書き、複数のファイルに分かれても LSN 順に読めることを確認
+	path := filepath.Join(t.TempDir(), "test.wal")
+	wal, err := NewWALWithSegmentSize(path, 256)
+	if err != nil {
+		t.Fatalf("NewWAL failed: %v", err)
+	}
+	for i := 0; i < 40; i++ {
+		wal.LogInsert(1, "users", uint64(i), nil, []byte("0123456789"))
+		wal.Flush()
+	}
+	wal.Close()
+
+	segments, _ := listSegments(path)
+	if len(segments) < 3 {
+		t.Fatalf("expected several segments, got %d", len(segments))
+	}
+
+	wal2, err := NewWALWithSegmentSize(path, 256)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer wal2.Close()
+	if wal2.nextLSN != 41 {
+		t.Errorf("expected nextLSN=41, got %d", wal2.nextLSN)
+	}
+	records, err := wal2.ReadFrom(25)
+	if err != nil {
+		t.Fatalf("ReadFrom failed: %v", err)
+	}
+	if len(records) != 16 || records[0].LSN != 25 || records[15].LSN != 40 {
+		t.Errorf("expected LSN 25..40, got %d records", len(records))
+	}
+	if all, _ := wal2.Read(); len(all) != 40 {
+		t.Errorf("expected 40 records, got %d", len(all))
+	}
+}
+
+func TestReopenTruncatesTornRecord(t *testing.T) {
+	// 書き込み中のクラッシュで末尾が切れていても、それより前のログから続けられる
+	path := filepath.Join(t.TempDir(), "test.wal")
+	wal, _ := NewWAL(path)
+	wal.LogBegin(1)
+	wal.LogCommit(1)
+	wal.Close()
+
+	file, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	file.Write([]byte{200, 0, 0, 0, 1, 2, 3})
+	file.Close()
+
+	wal2, err := NewWAL(path)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	wal2.LogBegin(2)
+	wal2.Close()
+
+	wal3, _ := NewWAL(path)
+	defer wal3.Close()
+	records, err := wal3.Read()
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if len(records) != 3 || records[2].LSN != 3 || records[2].TxnID != 2 {
+		t.Errorf("unexpected records after torn tail: %+v", records)
+	}
+}
+
+func TestCheckpointRemovesOldSegments(t *testing.T) {
+	// 終わっていないトランザクションのログは残し、終わったら古いセグメントを削除する
+	path := filepath.Join(t.TempDir(), "test.wal")
+	wal, _ := NewWALWithSegmentSize(path, 256)
+	wal.SetBufferPool(storage.NewBufferPool(4, storage.EvictionPolicyLRU))
+	for txnID := uint64(1); txnID <= 10; txnID++ {
+		wal.LogBegin(txnID)
+		wal.LogInsert(txnID, "users", txnID, nil, []byte("0123456789"))
+		wal.LogCommit(txnID)
+		wal.Flush()
+	}
+	wal.LogBegin(11)
+	wal.LogInsert(11, "users", 11, nil, []byte("0123456789"))
+	active := wal.nextLSN - 2
+	for txnID := uint64(12); txnID <= 20; txnID++ {
+		wal.LogBegin(txnID)
+		wal.LogCommit(txnID)
+		wal.Flush()
+	}
+
+	if !wal.CheckpointDue() {
+		t.Error("expected a checkpoint to be due after rotation")
+	}
+	if err := wal.Checkpoint(); err != nil {
+		t.Fatalf("Checkpoint failed: %v", err)
+	}
+	lsn, data := wal.GetCheckpoint()
+	if data.RedoLSN != active || data.ActiveTxns[11] != active || len(data.ActiveTxns) != 1 {
+		t.Errorf("unexpected checkpoint at %d: %+v", lsn, data)
+	}
+	records, _ := wal.Read()
+	if records[0].LSN > active {
+		t.Errorf("log of the active txn was removed: first LSN %d", records[0].LSN)
+	}
+	if records[0].LSN == 1 {
+		t.Error("expected old segments to be removed")
+	}
+
+	wal.LogCommit(11)
+	if err := wal.Checkpoint(); err != nil {
+		t.Fatalf("Checkpoint failed: %v", err)
+	}
+	wal.Close()
+
+	// 再オープンではチェックポイントから読み、削除したログのトランザクションIDも引き継ぐ
+	wal2, err := NewWALWithSegmentSize(path, 256)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer wal2.Close()
+	if wal2.GetMaxTxnID() != 20 {
+		t.Errorf("expected max txn ID 20, got %d", wal2.GetMaxTxnID())
+	}
+	lsn2, data2 := wal2.GetCheckpoint()
+	if lsn2 <= lsn || len(data2.ActiveTxns) != 0 {
+		t.Errorf("unexpected checkpoint after reopen at %d: %+v", lsn2, data2)
+	}
+	if records, _ := wal2.Read(); records[0].LSN <= active {
+		t.Errorf("expected segments before LSN %d to be removed, first LSN is %d", active, records[0].LSN)
+	}
+	if wal2.nextLSN != lsn2+1 {
+		t.Errorf("expected nextLSN=%d, got %d", lsn2+1, wal2.nextLSN)
+	}
+}
+
+func TestCheckpointDataEncoding(t *testing.T) {
+	data := &CheckpointData{
+		RedoLSN:    7,
+		MaxTxnID:   42,
+		ActiveTxns: map[uint64]uint64{3: 7, 5: 12},
+		DirtyPages: []storage.DirtyPage{{File: "users.db", PageID: 2, RecLSN: 9}},
+	}
+	decoded, err := decodeCheckpointData(data.encode())
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if decoded.RedoLSN != 7 || decoded.MaxTxnID != 42 || len(decoded.ActiveTxns) != 2 || decoded.ActiveTxns[5] != 12 ||
+		len(decoded.DirtyPages) != 1 || decoded.DirtyPages[0] != data.DirtyPages[0] {
+		t.Errorf("unexpected decoded checkpoint: %+v", decoded)
+	}
+	if _, err := decodeCheckpointData(data.encode()[:20]); err != ErrCorruptedCheckpoint {
+		t.Errorf("expected ErrCorruptedCheckpoint, got %v", err)
+	}
+}
+
+func TestRecordEncoding(t *testing.T) {
+	record := &LogRecord{
+		LSN:       7,
+		TxnID:     3,
+		LogType:   LogCompensate,
+		TableName: "users",
+		RowID:     42,
+		Before:    []byte{},
+		After:     nil,
+		UndoNext:  5,
+	}
+	frame := appendRecord(nil, record)
+	decoded, err := decodeRecord(frame[8:])
+	if err != nil {
+		t.Fatalf("decodeRecord failed: %v", err)
+	}
+	// 空のイメージと nil（行がない）は区別する
+	if decoded.Before == nil || len(decoded.Before) != 0 || decoded.After != nil {
+		t.Errorf("nil and empty images must be kept apart: before=%v after=%v", decoded.Before, decoded.After)
+	}
+	if decoded.LSN != 7 || decoded.TxnID != 3 || decoded.LogType != LogCompensate ||
+		decoded.TableName != "users" || decoded.RowID != 42 || decoded.UndoNext != 5 {
+		t.Errorf("unexpected decoded record: %+v", decoded)
+	}
+	if _, err := decodeRecord(frame[8 : len(frame)-1]); err != ErrCorruptedWAL {
+		t.Errorf("expected ErrCorruptedWAL for a short record, got %v", err)
+	}
+}
+
+func TestReopenTruncatesCorruptRecord(t *testing.T) {
+	// チェックサムが合わない末尾のレコードは捨て、その LSN から書き直す
+	path := filepath.Join(t.TempDir(), "test.wal")
+	wal, _ := NewWAL(path)
+	wal.LogBegin(1)
+	wal.LogInsert(1, "users", 1, nil, []byte("alice"))
+	wal.LogCommit(1)
+	wal.Close()
+
+	data, _ := os.ReadFile(path)
+	data[len(data)-3] ^= 0xff
+	os.WriteFile(path, data, 0644)
+
+	wal2, err := NewWAL(path)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer wal2.Close()
+	if wal2.nextLSN != 3 {
+		t.Errorf("expected nextLSN=3 after dropping the corrupt record, got %d", wal2.nextLSN)
+	}
+	records, err := wal2.Read()
+	if err != nil || len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d (err=%v)", len(records), err)
+	}
+	if info, _ := os.Stat(path); info.Size() >= int64(len(data)) {
+		t.Errorf("expected the corrupt tail to be truncated, size %d", info.Size())
+	}
+}
+
+// writeLegacyLog は gob でエンコードした以前の形式の WAL を書く
+func writeLegacyLog(t *testing.T, path string, records []LogRecord) {
+	t.Helper()
+	var data []byte
+	for _, record := range records {
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(&record); err != nil {
+			t.Fatalf("gob encode failed: %v", err)
+		}
+		data = binary.LittleEndian.AppendUint32(data, uint32(buf.Len()))
+		data = append(data, buf.Bytes()...)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateLegacyLog(t *testing.T) {
+	// 以前の形式のログはそのまま読め、新しいレコードは新しい形式のセグメントに書く
+	path := filepath.Join(t.TempDir(), "test.wal")
+	writeLegacyLog(t, path, []LogRecord{
+		{LSN: 1, TxnID: 1, LogType: LogBegin},
+		{LSN: 2, TxnID: 1, LogType: LogInsert, TableName: "users", RowID: 1, After: []byte("alice")},
+		{LSN: 3, TxnID: 1, LogType: LogCommit},
+	})
+
+	wal, err := NewWAL(path)
+	if err != nil {
+		t.Fatalf("NewWAL failed: %v", err)
+	}
+	if wal.nextLSN != 4 || wal.GetMaxTxnID() != 1 {
+		t.Errorf("expected nextLSN=4 and max txn 1, got %d and %d", wal.nextLSN, wal.GetMaxTxnID())
+	}
+	wal.LogBegin(2)
+	wal.LogCommit(2)
+	wal.Flush()
+
+	records, err := wal.Read()
+	if err != nil || len(records) != 5 || string(records[1].After) != "alice" || records[4].LSN != 5 {
+		t.Fatalf("unexpected records: %+v (err=%v)", records, err)
+	}
+	header := make([]byte, segmentHeaderSize)
+	file, _ := os.Open(segmentPath(path, 1))
+	file.Read(header)
+	file.Close()
+	if !bytes.Equal(header, segmentMagic) {
+		t.Errorf("expected new records in a new-format segment, header %q", header)
+	}
+
+	// チェックポイントで以前の形式のセグメントは不要になり削除される
+	wal.SetBufferPool(storage.NewBufferPool(4, storage.EvictionPolicyLRU))
+	if err := wal.Checkpoint(); err != nil {
+		t.Fatalf("Checkpoint failed: %v", err)
+	}
+	wal.Close()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected the legacy segment to be removed, stat err=%v", err)
+	}
+	wal2, err := NewWAL(path)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer wal2.Close()
+	if wal2.nextLSN != 7 || wal2.GetMaxTxnID() != 2 {
+		t.Errorf("expected nextLSN=7 and max txn 2, got %d and %d", wal2.nextLSN, wal2.GetMaxTxnID())
+	}
+}
+
+func TestFlushSyncFailureDoesNotRewriteRecords(t *testing.T) {
+	// fsync に失敗したら書いた分を取り消し、取り消せなければ以降は書き込まない
+	wal, err := NewWAL(filepath.Join(t.TempDir(), "test.wal"))
+	if err != nil {
+		t.Fatalf("NewWAL failed: %v", err)
+	}
+	segment := wal.file
+	defer segment.Close()
+	// パイプへの書き込みは成功するが、fsync と切り詰めは失敗する
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	wal.file = w
+	size := wal.fileSize
+
+	wal.LogBegin(1)
+	if err := wal.Flush(); !errors.Is(err, ErrWALFailed) {
+		t.Fatalf("expected ErrWALFailed, got %v", err)
+	}
+	if wal.fileSize != size {
+		t.Errorf("expected segment size to stay %d, got %d", size, wal.fileSize)
+	}
+	if flushed := wal.GetFlushedLSN(); flushed != 0 {
+		t.Errorf("expected nothing to be flushed, got LSN %d", flushed)
+	}
+	written := make([]byte, 4096)
+	n, _ := r.Read(written)
+
+	// 同じレコードをもう一度書かない
+	wal.LogCommit(1)
+	if err := wal.Flush(); !errors.Is(err, ErrWALFailed) {
+		t.Fatalf("expected ErrWALFailed after the WAL failed, got %v", err)
+	}
+	w.Close()
+	rest, _ := io.ReadAll(r)
+	if len(rest) != 0 {
+		t.Errorf("expected no more writes after the failure, got %d bytes after the first %d", len(rest), n)
+	}
+}
@@ -1,6 +1,7 @@
 package executor
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
@@ -8,110 +9,198 @@ import (
 	"github.com/takeuchi-shogo/go-example-database/internal/storage"
 )
 
-func (e *executor) executeAggregate(node *planner.AggregateNode) (ResultSet, error) {
-	// NOTE:
-	// 集約（GROUP BY / COUNT / SUM ...）はまだ実装途中。
-	// ここで未定義変数を返してコンパイルを壊さないよう、明示的に未実装として扱う。
-	childResult, err := e.Execute(node.Child)
+// errGroupByNotImplemented は GROUP BY 付きの集約がまだ実装されていないことを表す
+var errGroupByNotImplemented = errors.New("group by not implemented")
+
+func (e *executor) openAggregate(node *planner.AggregateNode) (Iterator, error) {
+	// TODO: GROUP BY 句を評価
+	if len(node.GroupBy) > 0 {
+		return nil, errGroupByNotImplemented
+	}
+	child, err := e.Open(node.Child)
 	if err != nil {
 		return nil, err
 	}
-	rows := childResult.GetRows()
-
 	// GROUP BY がない場合、全行を1グループとして集約
-	if len(node.GroupBy) == 0 {
-		values := make([]storage.Value, len(node.Aggregates))
-		for i, agg := range node.Aggregates {
-			result, err := e.calculateAggregate(agg, rows, childResult.GetSchema())
-			if err != nil {
-				return nil, err
-			}
-			values[i] = result
-		}
-		resultRow := storage.NewRow(values)
-		return NewResultSetWithRowsAndSchema(node.Schema(), []*storage.Row{resultRow}), nil
-	}
-	// TODO: GROUP BY 句を評価
-	return NewResultSetWithMessage("group by not implemented"), nil
+	return NewAggregateIterator(child, node.Aggregates, node.Child.Schema()), nil
 }
 
-func (e *executor) aggreateAll(rows []*storage.Row, node *planner.AggregateNode) (ResultSet, error) {
-	values := make([]storage.Value, len(node.Aggregates))
-
-	for i, agg := range node.Aggregates {
-		result, err := e.calculateAggregate(agg, rows, node.Child.Schema())
-		if err != nil {
-			return nil, err
-		}
-		values[i] = result
-	}
-
-	resultRow := storage.NewRow(values)
-	return NewResultSetWithRowsAndSchema(node.Schema(), []*storage.Row{resultRow}), nil
+// aggregateAccumulator は1つの集約関数の途中結果を保持する
+// 行を1つずつ add するので、入力全体をメモリに載せる必要がない
+type aggregateAccumulator interface {
+	add(row *storage.Row) error
+	result() (storage.Value, error)
 }
 
-func (e *executor) calculateAggregate(agg planner.AggregateExpression, rows []*storage.Row, schema *storage.Schema) (storage.Value, error) {
+func newAggregateAccumulator(agg planner.AggregateExpression, schema *storage.Schema) (aggregateAccumulator, error) {
 	funcName := strings.ToUpper(agg.Function)
+	if funcName == "COUNT" && (agg.Column == "" || agg.Column == "*") {
+		return &countAccumulator{colIdx: -1}, nil
+	}
+	switch funcName {
+	case "COUNT", "SUM", "AVG", "MAX", "MIN":
+	default:
+		return nil, fmt.Errorf("unsupported aggregate function: %s", agg.Function)
+	}
+	colIdx, err := schema.FindColumn("", agg.Column)
+	if err != nil {
+		return nil, err
+	}
 	switch funcName {
 	case "COUNT":
-		return storage.Int64Value(int64(len(rows))), nil
+		return &countAccumulator{colIdx: colIdx}, nil
 	case "SUM":
-		var sum int64
-		colIdx := schema.GetColumnIndex(agg.Column)
-		if colIdx < 0 {
-			return nil, fmt.Errorf("column not found: %s", agg.Column)
-		}
-		for _, row := range rows {
-			val := row.GetValues()[colIdx]
-			sum += int64(val.(storage.Int32Value))
-		}
-		return storage.Int64Value(sum), nil
+		return &sumAccumulator{colIdx: colIdx}, nil
 	case "AVG":
-		if len(rows) == 0 {
-			return nil, fmt.Errorf("no rows to calculate average")
-		}
-		var sum int64
-		colIdx := schema.GetColumnIndex(agg.Column)
-		if colIdx < 0 {
-			return nil, fmt.Errorf("column not found: %s", agg.Column)
-		}
-		for _, row := range rows {
-			val := row.GetValues()[colIdx]
-			sum += int64(val.(storage.Int32Value))
-		}
-		return storage.Int64Value(sum / int64(len(rows))), nil
+		return &avgAccumulator{sumAccumulator: sumAccumulator{colIdx: colIdx}}, nil
 	case "MAX":
-		if len(rows) == 0 {
-			return nil, fmt.Errorf("no rows to calculate max")
-		}
-		colIdx := schema.GetColumnIndex(agg.Column)
-		if colIdx < 0 {
-			return nil, fmt.Errorf("column not found: %s", agg.Column)
-		}
-		max := int64(rows[0].GetValues()[colIdx].(storage.Int32Value))
-		for _, row := range rows[1:] {
-			val := int64(row.GetValues()[colIdx].(storage.Int32Value))
-			if val > max {
-				max = val
-			}
-		}
-		return storage.Int64Value(max), nil
-	case "MIN":
-		if len(rows) == 0 {
-			return nil, fmt.Errorf("no rows to calculate min")
+		return &extremeAccumulator{colIdx: colIdx, better: func(c int) bool { return c > 0 }}, nil
+	default:
+		return &extremeAccumulator{colIdx: colIdx, better: func(c int) bool { return c < 0 }}, nil
+	}
+}
+
+// countAccumulator は COUNT を計算する
+// COUNT(*) は全行、COUNT(カラム) は NULL でない行を数える
+type countAccumulator struct {
+	colIdx int // COUNT(*) なら -1
+	count  int64
+}
+
+func (a *countAccumulator) add(row *storage.Row) error {
+	if a.colIdx >= 0 && row.GetValues()[a.colIdx] == nil {
+		return nil
+	}
+	a.count++
+	return nil
+}
+
+func (a *countAccumulator) result() (storage.Value, error) {
+	return storage.Int64Value(a.count), nil
+}
+
+// sumAccumulator は SUM を計算する
+// 整数は BIGINT、浮動小数点数は DOUBLE、DECIMAL は DECIMAL で合計する
+// NULL は飛ばし、NULL でない値が1つもなければ NULL になる
+type sumAccumulator struct {
+	colIdx int
+	sum    storage.Value // まだ値がなければ nil
+}
+
+func (a *sumAccumulator) add(row *storage.Row) error {
+	val := row.GetValues()[a.colIdx]
+	if val == nil {
+		return nil
+	}
+	sum, err := addNumbers(a.sum, val)
+	if err != nil {
+		return err
+	}
+	a.sum = sum
+	return nil
+}
+
+func (a *sumAccumulator) result() (storage.Value, error) {
+	return a.sum, nil
+}
+
+// addNumbers は合計 sum に val を足す（sum が nil なら val が最初の値）
+func addNumbers(sum, val storage.Value) (storage.Value, error) {
+	switch v := val.(type) {
+	case storage.Int32Value:
+		val = storage.Int64Value(v)
+	case storage.Float32Value:
+		val = storage.Float64Value(v)
+	case storage.Int64Value, storage.Float64Value, storage.DecimalValue:
+	default:
+		return nil, fmt.Errorf("cannot sum %T", val)
+	}
+	switch s := sum.(type) {
+	case nil:
+		return val, nil
+	case storage.Int64Value:
+		if v, ok := val.(storage.Int64Value); ok {
+			return s + v, nil
 		}
-		colIdx := schema.GetColumnIndex(agg.Column)
-		if colIdx < 0 {
-			return nil, fmt.Errorf("column not found: %s", agg.Column)
+	case storage.Float64Value:
+		if v, ok := val.(storage.Float64Value); ok {
+			return s + v, nil
 		}
-		min := int64(rows[0].GetValues()[colIdx].(storage.Int32Value))
-		for _, row := range rows[1:] {
-			val := int64(row.GetValues()[colIdx].(storage.Int32Value))
-			if val < min {
-				min = val
-			}
+	case storage.DecimalValue:
+		if v, ok := val.(storage.DecimalValue); ok {
+			return s.Add(v)
 		}
-		return storage.Int64Value(min), nil
 	}
-	return nil, fmt.Errorf("unsupported aggregate function: %s", agg.Function)
+	return nil, fmt.Errorf("cannot add %T to %T", val, sum)
+}
+
+// avgAccumulator は AVG を計算する
+// 整数の平均は BIGINT（切り捨て）、浮動小数点数は DOUBLE、DECIMAL は DECIMAL になる
+type avgAccumulator struct {
+	sumAccumulator
+	count int64
+}
+
+func (a *avgAccumulator) add(row *storage.Row) error {
+	if row.GetValues()[a.colIdx] == nil {
+		return nil
+	}
+	if err := a.sumAccumulator.add(row); err != nil {
+		return err
+	}
+	a.count++
+	return nil
+}
+
+func (a *avgAccumulator) result() (storage.Value, error) {
+	if a.count == 0 {
+		return nil, nil
+	}
+	switch sum := a.sum.(type) {
+	case storage.Int64Value:
+		return sum / storage.Int64Value(a.count), nil
+	case storage.Float64Value:
+		return sum / storage.Float64Value(a.count), nil
+	case storage.DecimalValue:
+		return sum.Div(storage.NewDecimal(a.count, 0))
+	default:
+		return nil, fmt.Errorf("cannot average %T", a.sum)
+	}
+}
+
+// extremeAccumulator は MAX / MIN を計算する（NULL は飛ばす）
+type extremeAccumulator struct {
+	colIdx int
+	better func(c int) bool // 値と今の値の比較結果から、値を選ぶかどうかを返す
+	value  storage.Value
+}
+
+func (a *extremeAccumulator) add(row *storage.Row) error {
+	val := row.GetValues()[a.colIdx]
+	if val == nil {
+		return nil
+	}
+	if a.value == nil {
+		a.value = val
+		return nil
+	}
+	c, err := storage.CompareValues(val, a.value)
+	if err != nil {
+		return err
+	}
+	if a.better(c) {
+		a.value = val
+	}
+	return nil
+}
+
+func (a *extremeAccumulator) result() (storage.Value, error) {
+	if a.value == nil {
+		return nil, nil
+	}
+	// 整数は BIGINT で返す
+	if v, ok := a.value.(storage.Int32Value); ok {
+		return storage.Int64Value(v), nil
+	}
+	return a.value, nil
 }
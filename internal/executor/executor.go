@@ -1,7 +1,10 @@
 package executor
 
 import (
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
 
 	internalcatalog "github.com/takeuchi-shogo/go-example-database/internal/catalog"
 	"github.com/takeuchi-shogo/go-example-database/internal/dbtxn"
@@ -9,34 +12,71 @@ import (
 	"github.com/takeuchi-shogo/go-example-database/internal/storage"
 )
 
+// ErrNotNullViolation は NOT NULL のカラムに NULL を入れようとしたときに返す
+var ErrNotNullViolation = errors.New("null value violates not-null constraint")
+
 type Executor interface {
 	Execute(plan planner.PlanNode) (ResultSet, error)
+	// Open は SELECT 系のプランをプル型のイテレータとして開く
+	Open(plan planner.PlanNode) (Iterator, error)
 	SetTxnID(txnID uint64) // トランザクション ID 設定
+	// SetTransaction は文を実行するトランザクションを設定する（nil ならトランザクション外）
+	// トランザクションの中では読み書きする行とテーブルにロックを取る
+	SetTransaction(txn *dbtxn.Transaction)
+	// SetSnapshot はトランザクションの外で SELECT が読むスナップショットを設定する
+	SetSnapshot(snapshot *dbtxn.Snapshot)
+	// SetJoinMemoryLimit は結合がメモリに載せる行の上限（バイト）を設定する
+	// ハッシュ結合のハッシュ表とマージ結合の並べ替えで、上限を超えた行は一時ファイルに書き出す
+	SetJoinMemoryLimit(limit int)
+	// SetSortMemoryLimit は ORDER BY の並べ替えがメモリに載せる行の上限（バイト）を設定する
+	// 上限を超えたら並べた行を一時ファイルに書き出し、最後にマージする
+	SetSortMemoryLimit(limit int)
 }
 
 type executor struct {
-	catalog internalcatalog.Catalog
-	wal     *dbtxn.WAL
-	txnID   uint64
+	catalog  internalcatalog.Catalog
+	wal      *dbtxn.WAL
+	txnID    uint64
+	txn      *dbtxn.Transaction
+	snapshot *dbtxn.Snapshot // トランザクションの外で SELECT が読む版（nil ならテーブルの行をそのまま読む）
+	writing  bool            // UPDATE / DELETE の対象行を走査している
+
+	joinMemoryLimit int // 結合がメモリに載せる行の上限（バイト）
+	sortMemoryLimit int // 並べ替えがメモリに載せる行の上限（バイト）
 }
 
 func NewExecutor(c internalcatalog.Catalog, wal *dbtxn.WAL) Executor {
-	return &executor{catalog: c, wal: wal, txnID: 0}
+	return &executor{catalog: c, wal: wal, txnID: 0, joinMemoryLimit: defaultJoinMemoryLimit, sortMemoryLimit: defaultSortMemoryLimit}
+}
+
+func (e *executor) SetJoinMemoryLimit(limit int) {
+	e.joinMemoryLimit = limit
+}
+
+func (e *executor) SetSortMemoryLimit(limit int) {
+	e.sortMemoryLimit = limit
 }
 
 func (e *executor) SetTxnID(txnID uint64) {
 	e.txnID = txnID
 }
 
+func (e *executor) SetTransaction(txn *dbtxn.Transaction) {
+	e.txn = txn
+	e.txnID = 0
+	if txn != nil {
+		e.txnID = txn.ID
+	}
+}
+
+func (e *executor) SetSnapshot(snapshot *dbtxn.Snapshot) {
+	e.snapshot = snapshot
+}
+
 // Execute は PlanNode を実行して結果を返す
+// 検索系のノードはイテレータを最後まで読んで結果セットにまとめる
 func (e *executor) Execute(plan planner.PlanNode) (ResultSet, error) {
 	switch node := plan.(type) {
-	case *planner.ScanNode:
-		return e.executeScan(node)
-	case *planner.FilterNode:
-		return e.executeFilter(node)
-	case *planner.ProjectNode:
-		return e.executeProject(node)
 	case *planner.InsertNode:
 		return e.executeInsert(node)
 	case *planner.UpdateNode:
@@ -45,74 +85,220 @@ func (e *executor) Execute(plan planner.PlanNode) (ResultSet, error) {
 		return e.executeDelete(node)
 	case *planner.CreateTableNode:
 		return e.executeCreateTable(node)
+	case *planner.CreateIndexNode:
+		return e.executeCreateIndex(node)
+	case *planner.DropIndexNode:
+		return e.executeDropIndex(node)
+	case *planner.AnalyzeNode:
+		return e.executeAnalyze(node)
+	case *planner.ScanNode, *planner.IndexScanNode, *planner.FilterNode, *planner.ProjectNode,
+		*planner.JoinNode, *planner.AggregateNode, *planner.EmptyNode, *planner.SubqueryScanNode,
+		*planner.SortNode, *planner.LimitNode, *planner.DistinctNode, *planner.ExplainNode:
+		return e.executeQuery(node)
+	default:
+		return NewResultSetWithMessage(fmt.Sprintf("unsupported plan node type: %T", node)), nil
+	}
+}
+
+// executeQuery は検索系のプランを実行して結果セットを返す
+func (e *executor) executeQuery(plan planner.PlanNode) (ResultSet, error) {
+	it, err := e.Open(plan)
+	if errors.Is(err, errGroupByNotImplemented) {
+		return NewResultSetWithMessage(err.Error()), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	rows, err := drain(it)
+	if err != nil {
+		return nil, err
+	}
+	return NewResultSetWithRowsAndSchema(plan.Schema(), rows), nil
+}
+
+// Open は PlanNode からイテレータの木を組み立てる
+// 行は親が Next を呼んだときに初めて読み込まれる
+func (e *executor) Open(plan planner.PlanNode) (Iterator, error) {
+	switch node := plan.(type) {
+	case *planner.ScanNode:
+		return e.openScan(node)
+	case *planner.IndexScanNode:
+		return e.openIndexScan(node)
+	case *planner.FilterNode:
+		return e.openFilter(node)
+	case *planner.ProjectNode:
+		return e.openProject(node)
 	case *planner.JoinNode:
-		return e.executeJoin(node)
+		return e.openJoin(node)
 	case *planner.AggregateNode:
-		return e.executeAggregate(node)
+		return e.openAggregate(node)
+	case *planner.EmptyNode:
+		return NewEmptyIterator(), nil
+	case *planner.SubqueryScanNode:
+		// 派生テーブルはカラムのテーブル名が変わるだけなので、サブクエリの行をそのまま返す
+		return e.Open(node.Child)
+	case *planner.SortNode:
+		return e.openSort(node)
+	case *planner.LimitNode:
+		child, err := e.Open(node.Child)
+		if err != nil {
+			return nil, err
+		}
+		return NewLimitIterator(child, node.Count, node.Offset), nil
+	case *planner.DistinctNode:
+		child, err := e.Open(node.Child)
+		if err != nil {
+			return nil, err
+		}
+		return NewDistinctIterator(child), nil
+	case *planner.ExplainNode:
+		// 文は実行せず、実行計画を1ノード1行で返す
+		lines := planner.ExplainPlan(node.Child)
+		rows := make([]*storage.Row, len(lines))
+		for i, line := range lines {
+			rows[i] = storage.NewRow([]storage.Value{storage.TextValue(line)})
+		}
+		return NewRowsIterator(rows), nil
 	default:
-		return NewResultSetWithMessage(fmt.Sprintf("unsupported plan node type: %T", node)), nil
+		return nil, errUnsupportedIterator(plan)
 	}
 }
 
-func (e *executor) executeScan(node *planner.ScanNode) (ResultSet, error) {
+func (e *executor) openScan(node *planner.ScanNode) (Iterator, error) {
 	table, err := e.catalog.GetTable(node.TableName)
 	if err != nil {
-		return NewResultSetWithMessage(fmt.Sprintf("table not found: %s", node.TableName)), err
+		return nil, fmt.Errorf("table not found: %s", node.TableName)
 	}
-	rows, err := table.Scan()
+	return e.wrapScan(NewTableIterator(table), table, nil, storage.KeyRange{})
+}
+
+func (e *executor) openIndexScan(node *planner.IndexScanNode) (Iterator, error) {
+	table, err := e.catalog.GetTable(node.TableName)
 	if err != nil {
-		return NewResultSetWithMessage(fmt.Sprintf("error scanning table: %s", err.Error())), err
+		return nil, fmt.Errorf("table not found: %s", node.TableName)
 	}
-	return NewResultSetWithRowsAndSchema(node.TableSchema, rows), nil
+	idx := table.GetIndex(node.IndexName)
+	if idx == nil {
+		return nil, fmt.Errorf("index not found: %s", node.IndexName)
+	}
+	return e.wrapScan(NewIndexScanIterator(table, idx, node.Range), table, idx, node.Range)
 }
 
-func (e *executor) executeFilter(node *planner.FilterNode) (ResultSet, error) {
-	// 子ノードを先に実行
-	childResult, err := e.Execute(node.Child)
+func (e *executor) openFilter(node *planner.FilterNode) (Iterator, error) {
+	child, err := e.Open(node.Child)
 	if err != nil {
 		return nil, err
 	}
-	// 子ノードの結果をフィルタリング
-	filteredRows := make([]*storage.Row, 0)
-	for _, row := range childResult.GetRows() {
-		result, err := node.Condition.Evaluate(row, childResult.GetSchema())
+	schema := node.Child.Schema()
+	e.bindSubqueries(node.Condition)
+	return NewFilterIterator(child, func(row *storage.Row) (bool, error) {
+		result, err := node.Condition.Evaluate(row, schema)
 		if err != nil {
-			return nil, err
+			return false, err
+		}
+		match, ok := result.(bool)
+		return ok && match, nil
+	}), nil
+}
+
+func (e *executor) openProject(node *planner.ProjectNode) (Iterator, error) {
+	child, err := e.Open(node.Child)
+	if err != nil {
+		return nil, err
+	}
+	// カラム参照はそのまま値を取り出し、それ以外の式は行ごとに評価する
+	schema := node.Child.Schema()
+	indexes := make([]int, len(node.Columns))
+	expressions := make([]planner.Expression, len(node.Columns))
+	for i := range node.Columns {
+		expr := node.GetExpression(i)
+		indexes[i] = -1
+		if ref, ok := expr.(*planner.ColumnRef); ok {
+			if indexes[i], err = schema.FindColumn(ref.TableName, ref.Name); err != nil {
+				child.Close()
+				return nil, err
+			}
 		}
-		if match, ok := result.(bool); ok && match {
-			filteredRows = append(filteredRows, row)
+		if indexes[i] < 0 {
+			expressions[i] = expr
 		}
 	}
-	return NewResultSetWithRowsAndSchema(childResult.GetSchema(), filteredRows), nil
+	e.bindSubqueries(expressions...)
+	return NewExpressionProjectIterator(child, indexes, expressions, schema), nil
 }
 
-func (e *executor) executeProject(node *planner.ProjectNode) (ResultSet, error) {
-	// 子ノードを先に実行
-	childResult, err := e.Execute(node.Child)
+func (e *executor) openSort(node *planner.SortNode) (Iterator, error) {
+	child, err := e.Open(node.Child)
 	if err != nil {
 		return nil, err
 	}
-	// 指定されたカラムのインデックスを取得
-	schema := childResult.GetSchema()
-	columns := schema.GetColumns()
-	// カラム名 -> インデックスのマップを作成
-	columnIndexMap := make(map[string]int)
-	for i, col := range columns {
-		columnIndexMap[col.GetName()] = i
+	for _, key := range node.Keys {
+		e.bindSubqueries(key.Expression)
 	}
-	// 指定されたカラムのインデックスを取得
-	projectedRows := make([]*storage.Row, 0)
-	for _, row := range childResult.GetRows() {
-		values := row.GetValues()
-		projectedValues := make([]storage.Value, len(node.Columns))
-		for i, col := range node.Columns {
-			if index, ok := columnIndexMap[col]; ok {
-				projectedValues[i] = values[index]
-			}
-		}
-		projectedRows = append(projectedRows, storage.NewRow(projectedValues))
+	return NewSortIterator(child, node, e.sortMemoryLimit), nil
+}
+
+func (e *executor) openJoin(node *planner.JoinNode) (Iterator, error) {
+	left, err := e.Open(node.Left)
+	if err != nil {
+		return nil, err
+	}
+	right, err := e.Open(node.Right)
+	if err != nil {
+		left.Close()
+		return nil, err
+	}
+	e.bindSubqueries(node.Condition)
+	switch node.Algorithm {
+	case planner.JoinAlgorithmHash:
+		return NewHashJoinIterator(left, right, node, e.joinMemoryLimit), nil
+	case planner.JoinAlgorithmMerge:
+		return NewMergeJoinIterator(left, right, node, e.joinMemoryLimit), nil
+	}
+	switch node.JoinType {
+	case planner.JoinTypeSemi, planner.JoinTypeAnti:
+		return NewSemiJoinIterator(left, right, node.Condition, node.ConditionSchema(), node.JoinType == planner.JoinTypeAnti), nil
+	case planner.JoinTypeLeft, planner.JoinTypeRight, planner.JoinTypeFull:
+		leftWidth := len(node.Left.Schema().GetColumns())
+		return NewOuterJoinIterator(left, right, node.Condition, node.Schema(), leftWidth, node.JoinType), nil
+	}
+	return NewNestedLoopJoinIterator(left, right, node.Condition, node.Schema()), nil
+}
+
+// bindSubqueries は式の中のサブクエリをこの executor で実行できるようにする
+func (e *executor) bindSubqueries(exprs ...planner.Expression) {
+	for _, subquery := range planner.CollectSubqueries(exprs...) {
+		subquery.SetRunner(e.runSubquery)
+	}
+}
+
+// runSubquery はサブクエリのプランを実行して全行を返す
+// UPDATE / DELETE の対象行を走査している途中でも、サブクエリが読む行には X ロックを取らない
+func (e *executor) runSubquery(plan planner.PlanNode) ([]*storage.Row, error) {
+	writing := e.writing
+	e.writing = false
+	defer func() { e.writing = writing }()
+	it, err := e.Open(plan)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	return drain(it)
+}
+
+// collectRows は子ノードの行をすべて読み込む
+// UPDATE / DELETE は対象行を確定させてから変更する（走査中に移動した行を二重に処理しないため）
+// トランザクションの中では最新の対象行に X ロックを取りながら読む
+func (e *executor) collectRows(plan planner.PlanNode) ([]*storage.Row, error) {
+	e.writing = true
+	defer func() { e.writing = false }()
+	it, err := e.Open(plan)
+	if err != nil {
+		return nil, err
 	}
-	return NewResultSetWithRowsAndSchema(schema, projectedRows), nil
+	defer it.Close()
+	return drain(it)
 }
 
 func (e *executor) executeInsert(node *planner.InsertNode) (ResultSet, error) {
@@ -120,31 +306,44 @@ func (e *executor) executeInsert(node *planner.InsertNode) (ResultSet, error) {
 	if err != nil {
 		return nil, err
 	}
-	// 値を評価して storage.Value に変換
+	schema, err := e.catalog.GetSchema(node.TableName)
+	if err != nil {
+		return nil, err
+	}
+	columns := schema.GetColumns()
+	if len(node.Values) != len(columns) {
+		return nil, fmt.Errorf("%w: table %s has %d columns but %d values were supplied", storage.ErrColumnCountMismatch, node.TableName, len(columns), len(node.Values))
+	}
+	// 値を評価してカラムの型の storage.Value に変換
+	e.bindSubqueries(node.Values...)
 	values := make([]storage.Value, len(node.Values))
 	for i, value := range node.Values {
 		evaluated, err := value.Evaluate(nil, nil)
 		if err != nil {
 			return nil, err
 		}
-		values[i], err = toStorageValue(evaluated)
-		if err != nil {
+		if values[i], err = toColumnValue(evaluated, &columns[i]); err != nil {
 			return nil, err
 		}
 	}
-	row := storage.NewRow(values)
+	if err := e.lockTable(node.TableName, dbtxn.LockExclusive); err != nil {
+		return nil, err
+	}
+	// ROLLBACK で取り消せるように、行IDを決めてから WAL に記録する
+	row := storage.NewRowWithID(table.ReserveRowID(), values)
+	if err := e.lockRow(node.TableName, row.GetRowID()); err != nil {
+		return nil, err
+	}
 	// wal に先行書き込み（write-ahead log）
-	if e.wal != nil {
-		rowBytes, err := row.Serialize()
-		if err != nil {
-			return nil, err
-		}
-		if err := e.wal.LogInsert(e.txnID, node.TableName, 0, nil, rowBytes); err != nil {
-			return nil, err
-		}
+	record := &dbtxn.LogRecord{LogType: dbtxn.LogInsert, TableName: node.TableName, RowID: uint64(row.GetRowID()), After: row.Encode()}
+	if err := e.logChange(record); err != nil {
+		return nil, err
 	}
 	err = table.Insert(row)
 	if err != nil {
+		if cerr := e.compensate(record); cerr != nil {
+			return nil, cerr
+		}
 		return NewResultSetWithMessage(fmt.Sprintf("error inserting into table: %s", err.Error())), err
 	}
 	return NewResultSetWithMessage(fmt.Sprintf("row inserted: %s", node.TableName)), nil
@@ -162,10 +361,13 @@ func (e *executor) executeUpdate(node *planner.UpdateNode) (ResultSet, error) {
 		return nil, err
 	}
 	// 2. 子ノードを実行して対象行を取得
-	childResult, err := e.Execute(node.Child)
+	targetRows, err := e.collectRows(node.Child)
 	if err != nil {
 		return nil, err
 	}
+	for _, expr := range node.Sets {
+		e.bindSubqueries(expr)
+	}
 	// 3. カラム名 ⇨ インデックスのマップを作成
 	columnIndexMap := make(map[string]int)
 	for i, col := range schema.GetColumns() {
@@ -173,13 +375,10 @@ func (e *executor) executeUpdate(node *planner.UpdateNode) (ResultSet, error) {
 	}
 	// 4. 更新する行を取得
 	var updateCount int
-	for _, row := range childResult.GetRows() {
+	for _, row := range targetRows {
 		rowID := row.GetRowID()
-		// before deserialize data
-		beforeBytes, err := row.Serialize()
-		if err != nil {
-			return nil, err
-		}
+		// 変更前の行（ROLLBACK で書き戻す）
+		beforeBytes := row.Encode()
 		// SET 式を評価して新しい値を作成
 		newValues := make([]storage.Value, len(schema.GetColumns()))
 		// 既存の値をコピー
@@ -193,27 +392,25 @@ func (e *executor) executeUpdate(node *planner.UpdateNode) (ResultSet, error) {
 			if err != nil {
 				return nil, err
 			}
-			storageValue, err := toStorageValue(value)
+			storageValue, err := toColumnValue(value, &schema.GetColumns()[idx])
 			if err != nil {
 				return nil, err
 			}
 			newValues[idx] = storageValue
 		}
 		newRow := storage.NewRowWithID(rowID, newValues)
-		// After deserialize data
-		afterBytes, err := newRow.Serialize()
-		if err != nil {
-			return nil, err
-		}
+		afterBytes := newRow.Encode()
 		// WAL に先行書き込み
-		if e.wal != nil {
-			if err := e.wal.LogUpdate(e.txnID, node.TableName, uint64(rowID), beforeBytes, afterBytes); err != nil {
-				return nil, err
-			}
+		record := &dbtxn.LogRecord{LogType: dbtxn.LogUpdate, TableName: node.TableName, RowID: uint64(rowID), Before: beforeBytes, After: afterBytes}
+		if err := e.logChange(record); err != nil {
+			return nil, err
 		}
 		// 行を更新
 		_, err = table.Update(rowID, newRow)
 		if err != nil {
+			if cerr := e.compensate(record); cerr != nil {
+				return nil, cerr
+			}
 			return nil, err
 		}
 		updateCount++
@@ -229,27 +426,26 @@ func (e *executor) executeDelete(node *planner.DeleteNode) (ResultSet, error) {
 		return nil, err
 	}
 	// 2. 子ノードを実行して対象行を取得
-	childResult, err := e.Execute(node.Child)
+	targetRows, err := e.collectRows(node.Child)
 	if err != nil {
 		return nil, err
 	}
 	// 3. 各行を削除
 	var deleteCount int
-	for _, row := range childResult.GetRows() {
+	for _, row := range targetRows {
 		rowID := row.GetRowID()
-		// before deserialize data
-		beforeBytes, err := row.Serialize()
-		if err != nil {
-			return nil, err
-		}
+		// 変更前の行（ROLLBACK で書き戻す）
+		beforeBytes := row.Encode()
 		// WAL に先行書き込み
-		if e.wal != nil {
-			if err := e.wal.LogDelete(e.txnID, node.TableName, uint64(rowID), beforeBytes); err != nil {
-				return nil, err
-			}
+		record := &dbtxn.LogRecord{LogType: dbtxn.LogDelete, TableName: node.TableName, RowID: uint64(rowID), Before: beforeBytes}
+		if err := e.logChange(record); err != nil {
+			return nil, err
 		}
 		// 行を削除
 		if _, err = table.Delete(rowID); err != nil {
+			if cerr := e.compensate(record); cerr != nil {
+				return nil, cerr
+			}
 			return nil, err
 		}
 		deleteCount++
@@ -257,6 +453,42 @@ func (e *executor) executeDelete(node *planner.DeleteNode) (ResultSet, error) {
 	return NewResultSetWithMessage(fmt.Sprintf("deleted %d rows in %s", deleteCount, node.TableName)), nil
 }
 
+// logChange は行の変更を現在のトランザクションのログとして WAL に追加する
+// テーブルを変更する前に呼び、変更前の行をほかのトランザクションのスナップショットに残す
+func (e *executor) logChange(record *dbtxn.LogRecord) error {
+	record.TxnID = e.txnID
+	if e.wal != nil {
+		if err := e.wal.Append(record); err != nil {
+			return err
+		}
+	}
+	if e.txn != nil {
+		e.txn.RecordVersion(record.TableName, int64(record.RowID), record.Before, record.After)
+	}
+	return nil
+}
+
+// compensate はテーブルに反映できなかった変更を取り消し済みとして記録する
+// REDO で適用されず、UNDO でも取り消し対象にならないように CLR を書く
+// 記録した版もテーブルの行に合わせて元に戻す
+func (e *executor) compensate(record *dbtxn.LogRecord) error {
+	if e.txn != nil {
+		e.txn.RecordVersion(record.TableName, int64(record.RowID), record.After, record.Before)
+	}
+	if e.wal == nil {
+		return nil
+	}
+	return e.wal.Append(&dbtxn.LogRecord{
+		LogType:   dbtxn.LogCompensate,
+		TxnID:     record.TxnID,
+		TableName: record.TableName,
+		RowID:     record.RowID,
+		Before:    record.After,
+		After:     record.Before,
+		UndoNext:  record.LSN,
+	})
+}
+
 // executeCreateTable は CREATE TABLE 文を実行して結果を返す
 func (e *executor) executeCreateTable(node *planner.CreateTableNode) (ResultSet, error) {
 	if err := e.catalog.CreateTable(node.TableName, node.TableSchema); err != nil {
@@ -265,6 +497,67 @@ func (e *executor) executeCreateTable(node *planner.CreateTableNode) (ResultSet,
 	return NewResultSetWithMessage(fmt.Sprintf("table created: %s", node.TableName)), nil
 }
 
+// executeCreateIndex は CREATE INDEX 文を実行して結果を返す
+func (e *executor) executeCreateIndex(node *planner.CreateIndexNode) (ResultSet, error) {
+	if err := e.catalog.CreateIndex(node.IndexName, node.TableName, node.Columns, node.Unique); err != nil {
+		return NewResultSetWithMessage(fmt.Sprintf("error creating index: %s", err.Error())), err
+	}
+	return NewResultSetWithMessage(fmt.Sprintf("index created: %s", node.IndexName)), nil
+}
+
+// executeDropIndex は DROP INDEX 文を実行して結果を返す
+func (e *executor) executeDropIndex(node *planner.DropIndexNode) (ResultSet, error) {
+	if err := e.catalog.DropIndex(node.IndexName); err != nil {
+		return NewResultSetWithMessage(fmt.Sprintf("error dropping index: %s", err.Error())), err
+	}
+	return NewResultSetWithMessage(fmt.Sprintf("index dropped: %s", node.IndexName)), nil
+}
+
+// executeAnalyze は ANALYZE 文を実行して結果を返す
+// テーブルを読んで集めた統計情報をカタログに保存する（テーブル名がなければ全テーブル）
+func (e *executor) executeAnalyze(node *planner.AnalyzeNode) (ResultSet, error) {
+	names := []string{node.TableName}
+	if node.TableName == "" {
+		names = names[:0]
+		for _, table := range e.catalog.ListTables() {
+			names = append(names, string(table.GetName()))
+		}
+		slices.Sort(names)
+	}
+	for _, name := range names {
+		if err := e.analyzeTable(name); err != nil {
+			return NewResultSetWithMessage(fmt.Sprintf("error analyzing table: %s", err.Error())), err
+		}
+	}
+	return NewResultSetWithMessage(fmt.Sprintf("analyzed: %s", strings.Join(names, ", "))), nil
+}
+
+// analyzeTable はテーブルの見えている行から統計情報を集めてカタログに保存する
+// 行は読みながら集計し、テーブル全体をメモリに読み込まない
+func (e *executor) analyzeTable(name string) error {
+	schema, err := e.catalog.GetSchema(name)
+	if err != nil {
+		return err
+	}
+	it, err := e.Open(&planner.ScanNode{TableName: name, TableSchema: schema})
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	collector := storage.NewStatisticsCollector(schema)
+	for {
+		hasNext, err := it.Next()
+		if err != nil {
+			return err
+		}
+		if !hasNext {
+			break
+		}
+		collector.Add(it.GetRow())
+	}
+	return e.catalog.SetStatistics(name, collector.Statistics())
+}
+
 func toStorageValue(value any) (storage.Value, error) {
 	switch v := value.(type) {
 	case string:
@@ -277,40 +570,31 @@ func toStorageValue(value any) (storage.Value, error) {
 		return storage.Int32Value(v), nil
 	case int64:
 		return storage.Int64Value(v), nil
+	case float32:
+		return storage.Float32Value(v), nil
+	case float64:
+		return storage.Float64Value(v), nil
+	case storage.Value:
+		return v, nil
 	default:
 		return nil, fmt.Errorf("unsupported value type: %T", v)
 	}
 }
 
-func (e *executor) executeJoin(node *planner.JoinNode) (ResultSet, error) {
-	// 左テーブルを実行
-	leftResult, err := e.Execute(node.Left)
-	if err != nil {
-		return nil, err
+// toColumnValue は式の値をカラムの型の storage.Value に変換する
+// NOT NULL のカラムに NULL は入れられない
+func toColumnValue(value any, col *storage.Column) (storage.Value, error) {
+	if value == nil {
+		if !col.GetNullable() {
+			return nil, fmt.Errorf("%w: column %s", ErrNotNullViolation, col.GetName())
+		}
+		return nil, nil
 	}
-	// 右テーブルを実行
-	rightResult, err := e.Execute(node.Right)
+	storageValue, err := toStorageValue(value)
 	if err != nil {
 		return nil, err
 	}
-	// 結合スキーマを作成
-	joinSchema := node.Schema()
-	// 結合条件を評価
-	var joinedRows []*storage.Row
-	for _, leftRow := range leftResult.GetRows() {
-		for _, rightRow := range rightResult.GetRows() {
-			// 左右の行を結合して結合条件を評価
-			mergedRow := mergeRows(leftRow, rightRow)
-			result, err := node.Condition.Evaluate(mergedRow, joinSchema)
-			if err != nil {
-				return nil, err
-			}
-			if match, ok := result.(bool); ok && match {
-				joinedRows = append(joinedRows, mergedRow)
-			}
-		}
-	}
-	return NewResultSetWithRowsAndSchema(joinSchema, joinedRows), nil
+	return storage.CastValue(storageValue, col)
 }
 
 // mergeRows は左右の行を結合して新しい行を作成する
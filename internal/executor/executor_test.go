@@ -393,8 +393,8 @@ func TestToStorageValue(t *testing.T) {
 		{"int", 42, false},
 		{"int32", int32(42), false},
 		{"int64", int64(42), false},
-		{"float", 3.14, true}, // 未実装
-		{"nil", nil, true},    // 未対応
+		{"float", 3.14, false},
+		{"nil", nil, true}, // 未対応
 	}
 
 	for _, tt := range tests {
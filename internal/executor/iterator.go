@@ -1,7 +1,15 @@
 package executor
 
-import "github.com/takeuchi-shogo/go-example-database/internal/storage"
+import (
+	"fmt"
+	"slices"
 
+	"github.com/takeuchi-shogo/go-example-database/internal/planner"
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
+)
+
+// Iterator は Volcano モデルのプル型イテレータ
+// 親ノードが Next を呼ぶたびに子ノードから1行ずつ取り出す
 type Iterator interface {
 	Next() (bool, error)
 	GetRow() *storage.Row
@@ -9,55 +17,92 @@ type Iterator interface {
 	Close() error
 }
 
+// tableIterator はテーブルをページ単位で遅延読み込みする
 type tableIterator struct {
-	table *storage.Table
-	rows  []*storage.Row
-	index int
+	table  *storage.Table
+	cursor *storage.TableIterator
 }
 
 func NewTableIterator(table *storage.Table) Iterator {
-	return &tableIterator{table: table, rows: make([]*storage.Row, 0)}
+	return &tableIterator{table: table, cursor: table.Iterator()}
 }
 
 func (i *tableIterator) Next() (bool, error) {
-	// すべての行を取得
-	if len(i.rows) == 0 {
-		rows, err := i.table.Scan()
-		if err != nil {
-			return false, err
-		}
-		i.rows = rows
-		i.index = -1 // Next() で 0 になるように
-	}
-	i.index++
-	return i.index < len(i.rows), nil
+	return i.cursor.Next()
 }
 
 func (i *tableIterator) GetRow() *storage.Row {
-	if i.index < 0 || i.index >= len(i.rows) {
-		return nil
-	}
-	return i.rows[i.index]
+	return i.cursor.Row()
 }
 
 func (i *tableIterator) Reset() {
-	i.index = 0
+	i.cursor.Reset()
 }
 
+// Close はテーブル自体は閉じない（テーブルはカタログが管理する）
 func (i *tableIterator) Close() error {
-	if err := i.table.Close(); err != nil {
-		return err
+	return nil
+}
+
+// indexScanIterator はインデックスで絞り込んだ行IDの行だけを読む
+type indexScanIterator struct {
+	table   *storage.Table
+	index   storage.TableIndex
+	keys    storage.KeyRange
+	rowIDs  []int64 // 最初の Next でインデックスから取得する
+	pos     int
+	loaded  bool
+	current *storage.Row
+}
+
+func NewIndexScanIterator(table *storage.Table, index storage.TableIndex, keys storage.KeyRange) Iterator {
+	return &indexScanIterator{table: table, index: index, keys: keys}
+}
+
+func (i *indexScanIterator) Next() (bool, error) {
+	if !i.loaded {
+		rowIDs, err := i.table.LookupIndex(i.index, i.keys)
+		if err != nil {
+			return false, err
+		}
+		i.rowIDs = rowIDs
+		i.pos = 0
+		i.loaded = true
+	}
+	if i.pos >= len(i.rowIDs) {
+		i.current = nil
+		return false, nil
 	}
+	row, err := i.table.FindByRowID(i.rowIDs[i.pos])
+	if err != nil {
+		return false, err
+	}
+	i.pos++
+	i.current = row
+	return true, nil
+}
+
+func (i *indexScanIterator) GetRow() *storage.Row {
+	return i.current
+}
+
+func (i *indexScanIterator) Reset() {
+	i.loaded = false
+	i.rowIDs = nil
+	i.current = nil
+}
+
+func (i *indexScanIterator) Close() error {
 	return nil
 }
 
 type filterIterator struct {
 	source    Iterator
-	predicate func(row *storage.Row) bool
+	predicate func(row *storage.Row) (bool, error)
 	current   *storage.Row
 }
 
-func NewFilterIterator(source Iterator, predicate func(row *storage.Row) bool) Iterator {
+func NewFilterIterator(source Iterator, predicate func(row *storage.Row) (bool, error)) Iterator {
 	return &filterIterator{source: source, predicate: predicate, current: nil}
 }
 
@@ -68,10 +113,15 @@ func (i *filterIterator) Next() (bool, error) {
 			return false, err
 		}
 		if !hasNext {
+			i.current = nil
 			return false, nil
 		}
 		row := i.source.GetRow()
-		if i.predicate(row) {
+		match, err := i.predicate(row)
+		if err != nil {
+			return false, err
+		}
+		if match {
 			i.current = row
 			return true, nil
 		}
@@ -90,3 +140,596 @@ func (i *filterIterator) Reset() {
 func (i *filterIterator) Close() error {
 	return i.source.Close()
 }
+
+// projectIterator は指定したカラムだけを取り出す
+// 式が指定された出力カラムは行ごとに式を評価して値を作る
+type projectIterator struct {
+	source      Iterator
+	indexes     []int                // 出力カラムごとの入力カラム位置（見つからなければ -1）
+	expressions []planner.Expression // 出力カラムごとの式（nil ならカラム位置の値を使う）
+	schema      *storage.Schema      // 式を評価する入力スキーマ
+	current     *storage.Row
+}
+
+func NewProjectIterator(source Iterator, indexes []int) Iterator {
+	return &projectIterator{source: source, indexes: indexes}
+}
+
+func NewExpressionProjectIterator(source Iterator, indexes []int, expressions []planner.Expression, schema *storage.Schema) Iterator {
+	return &projectIterator{source: source, indexes: indexes, expressions: expressions, schema: schema}
+}
+
+func (i *projectIterator) Next() (bool, error) {
+	hasNext, err := i.source.Next()
+	if err != nil || !hasNext {
+		i.current = nil
+		return false, err
+	}
+	row := i.source.GetRow()
+	values := row.GetValues()
+	projectedValues := make([]storage.Value, len(i.indexes))
+	for j, index := range i.indexes {
+		if j < len(i.expressions) && i.expressions[j] != nil {
+			value, err := i.expressions[j].Evaluate(row, i.schema)
+			if err != nil {
+				return false, err
+			}
+			if value != nil {
+				if projectedValues[j], err = toStorageValue(value); err != nil {
+					return false, err
+				}
+			}
+			continue
+		}
+		if index >= 0 {
+			projectedValues[j] = values[index]
+		}
+	}
+	i.current = storage.NewRowWithID(row.GetRowID(), projectedValues)
+	return true, nil
+}
+
+func (i *projectIterator) GetRow() *storage.Row {
+	return i.current
+}
+
+func (i *projectIterator) Reset() {
+	i.source.Reset()
+	i.current = nil
+}
+
+func (i *projectIterator) Close() error {
+	return i.source.Close()
+}
+
+// nestedLoopJoinIterator は左の1行ごとに右を先頭から読み直して結合する
+type nestedLoopJoinIterator struct {
+	left      Iterator
+	right     Iterator
+	condition planner.Expression
+	schema    *storage.Schema
+	leftRow   *storage.Row
+	current   *storage.Row
+}
+
+func NewNestedLoopJoinIterator(left, right Iterator, condition planner.Expression, schema *storage.Schema) Iterator {
+	return &nestedLoopJoinIterator{left: left, right: right, condition: condition, schema: schema}
+}
+
+func (i *nestedLoopJoinIterator) Next() (bool, error) {
+	for {
+		if i.leftRow == nil {
+			hasNext, err := i.left.Next()
+			if err != nil || !hasNext {
+				i.current = nil
+				return false, err
+			}
+			i.leftRow = i.left.GetRow()
+			i.right.Reset()
+		}
+		hasNext, err := i.right.Next()
+		if err != nil {
+			return false, err
+		}
+		if !hasNext {
+			// 右を読み切ったので左を進める
+			i.leftRow = nil
+			continue
+		}
+		// 左右の行を結合して結合条件を評価
+		mergedRow := mergeRows(i.leftRow, i.right.GetRow())
+		if i.condition != nil {
+			result, err := i.condition.Evaluate(mergedRow, i.schema)
+			if err != nil {
+				return false, err
+			}
+			if match, ok := result.(bool); !ok || !match {
+				continue
+			}
+		}
+		i.current = mergedRow
+		return true, nil
+	}
+}
+
+func (i *nestedLoopJoinIterator) GetRow() *storage.Row {
+	return i.current
+}
+
+func (i *nestedLoopJoinIterator) Reset() {
+	i.left.Reset()
+	i.right.Reset()
+	i.leftRow = nil
+	i.current = nil
+}
+
+func (i *nestedLoopJoinIterator) Close() error {
+	if err := i.left.Close(); err != nil {
+		return err
+	}
+	return i.right.Close()
+}
+
+// outerJoinIterator は LEFT / RIGHT / FULL OUTER JOIN を入れ子ループで行う
+// 相手のない行は相手側のカラムを NULL にして返す
+// RIGHT / FULL は一致した右の行の位置を覚えておき、左を読み切った後に右を読み直して残りの行を返す
+type outerJoinIterator struct {
+	left       Iterator
+	right      Iterator
+	condition  planner.Expression
+	schema     *storage.Schema
+	leftWidth  int
+	rightWidth int
+	keepLeft   bool // 相手のない左の行を返す（LEFT / FULL）
+	keepRight  bool // 相手のない右の行を返す（RIGHT / FULL）
+
+	leftRow      *storage.Row
+	leftMatched  bool
+	rightPos     int          // 右の何行目を読んでいるか
+	rightMatched map[int]bool // 一度でも一致した右の行の位置
+	tail         bool         // 左を読み切り、相手のない右の行を返している
+	current      *storage.Row
+}
+
+func NewOuterJoinIterator(left, right Iterator, condition planner.Expression, schema *storage.Schema, leftWidth int, joinType planner.JoinType) Iterator {
+	return &outerJoinIterator{
+		left:         left,
+		right:        right,
+		condition:    condition,
+		schema:       schema,
+		leftWidth:    leftWidth,
+		rightWidth:   len(schema.GetColumns()) - leftWidth,
+		keepLeft:     joinType == planner.JoinTypeLeft || joinType == planner.JoinTypeFull,
+		keepRight:    joinType == planner.JoinTypeRight || joinType == planner.JoinTypeFull,
+		rightMatched: make(map[int]bool),
+	}
+}
+
+func (i *outerJoinIterator) Next() (bool, error) {
+	if i.tail {
+		return i.nextUnmatchedRight()
+	}
+	for {
+		if i.leftRow == nil {
+			hasNext, err := i.left.Next()
+			if err != nil {
+				return false, err
+			}
+			if !hasNext {
+				if !i.keepRight {
+					i.current = nil
+					return false, nil
+				}
+				i.tail = true
+				i.rightPos = 0
+				i.right.Reset()
+				return i.nextUnmatchedRight()
+			}
+			i.leftRow = i.left.GetRow()
+			i.leftMatched = false
+			i.rightPos = 0
+			i.right.Reset()
+		}
+		hasNext, err := i.right.Next()
+		if err != nil {
+			return false, err
+		}
+		if !hasNext {
+			// 右を読み切ったので左を進める（一致しなかった左の行は右を NULL にして返す）
+			leftRow, matched := i.leftRow, i.leftMatched
+			i.leftRow = nil
+			if i.keepLeft && !matched {
+				i.current = mergeRows(leftRow, nullRow(i.rightWidth))
+				return true, nil
+			}
+			continue
+		}
+		pos := i.rightPos
+		i.rightPos++
+		mergedRow := mergeRows(i.leftRow, i.right.GetRow())
+		if i.condition != nil {
+			result, err := i.condition.Evaluate(mergedRow, i.schema)
+			if err != nil {
+				return false, err
+			}
+			if match, ok := result.(bool); !ok || !match {
+				continue
+			}
+		}
+		i.leftMatched = true
+		if i.keepRight {
+			i.rightMatched[pos] = true
+		}
+		i.current = mergedRow
+		return true, nil
+	}
+}
+
+// nextUnmatchedRight は一度も一致しなかった右の行を、左を NULL にして返す
+func (i *outerJoinIterator) nextUnmatchedRight() (bool, error) {
+	for {
+		hasNext, err := i.right.Next()
+		if err != nil || !hasNext {
+			i.current = nil
+			return false, err
+		}
+		pos := i.rightPos
+		i.rightPos++
+		if !i.rightMatched[pos] {
+			i.current = mergeRows(nullRow(i.leftWidth), i.right.GetRow())
+			return true, nil
+		}
+	}
+}
+
+func (i *outerJoinIterator) GetRow() *storage.Row {
+	return i.current
+}
+
+func (i *outerJoinIterator) Reset() {
+	i.left.Reset()
+	i.right.Reset()
+	i.leftRow = nil
+	i.leftMatched = false
+	i.rightPos = 0
+	i.rightMatched = make(map[int]bool)
+	i.tail = false
+	i.current = nil
+}
+
+func (i *outerJoinIterator) Close() error {
+	if err := i.left.Close(); err != nil {
+		return err
+	}
+	return i.right.Close()
+}
+
+// nullRow はすべてのカラムが NULL の行を作る
+func nullRow(width int) *storage.Row {
+	return storage.NewRow(make([]storage.Value, width))
+}
+
+// semiJoinIterator は右に結合条件を満たす行がある左の行だけを返す（anti なら行がない左の行だけ）
+// 左の行は結合せずにそのまま返す
+type semiJoinIterator struct {
+	left      Iterator
+	right     Iterator
+	condition planner.Expression
+	schema    *storage.Schema // 左右を結合したスキーマ（結合条件の評価に使う）
+	anti      bool
+	current   *storage.Row
+}
+
+func NewSemiJoinIterator(left, right Iterator, condition planner.Expression, schema *storage.Schema, anti bool) Iterator {
+	return &semiJoinIterator{left: left, right: right, condition: condition, schema: schema, anti: anti}
+}
+
+func (i *semiJoinIterator) Next() (bool, error) {
+	for {
+		hasNext, err := i.left.Next()
+		if err != nil || !hasNext {
+			i.current = nil
+			return false, err
+		}
+		leftRow := i.left.GetRow()
+		matched, err := i.hasMatch(leftRow)
+		if err != nil {
+			return false, err
+		}
+		if matched != i.anti {
+			i.current = leftRow
+			return true, nil
+		}
+	}
+}
+
+// hasMatch は右に左の行との結合条件を満たす行があるかどうかを返す（見つかった時点で読むのをやめる）
+func (i *semiJoinIterator) hasMatch(leftRow *storage.Row) (bool, error) {
+	i.right.Reset()
+	for {
+		hasNext, err := i.right.Next()
+		if err != nil || !hasNext {
+			return false, err
+		}
+		if i.condition == nil {
+			return true, nil
+		}
+		result, err := i.condition.Evaluate(mergeRows(leftRow, i.right.GetRow()), i.schema)
+		if err != nil {
+			return false, err
+		}
+		if match, ok := result.(bool); ok && match {
+			return true, nil
+		}
+	}
+}
+
+func (i *semiJoinIterator) GetRow() *storage.Row {
+	return i.current
+}
+
+func (i *semiJoinIterator) Reset() {
+	i.left.Reset()
+	i.right.Reset()
+	i.current = nil
+}
+
+func (i *semiJoinIterator) Close() error {
+	if err := i.left.Close(); err != nil {
+		return err
+	}
+	return i.right.Close()
+}
+
+// aggregateIterator は子ノードを読み切ってから集約結果の1行を返す
+type aggregateIterator struct {
+	source     Iterator
+	aggregates []planner.AggregateExpression
+	schema     *storage.Schema // 子ノードのスキーマ
+	done       bool
+	current    *storage.Row
+}
+
+func NewAggregateIterator(source Iterator, aggregates []planner.AggregateExpression, schema *storage.Schema) Iterator {
+	return &aggregateIterator{source: source, aggregates: aggregates, schema: schema}
+}
+
+func (i *aggregateIterator) Next() (bool, error) {
+	if i.done {
+		i.current = nil
+		return false, nil
+	}
+	i.done = true
+	accumulators := make([]aggregateAccumulator, len(i.aggregates))
+	for j, agg := range i.aggregates {
+		acc, err := newAggregateAccumulator(agg, i.schema)
+		if err != nil {
+			return false, err
+		}
+		accumulators[j] = acc
+	}
+	for {
+		hasNext, err := i.source.Next()
+		if err != nil {
+			return false, err
+		}
+		if !hasNext {
+			break
+		}
+		row := i.source.GetRow()
+		for _, acc := range accumulators {
+			if err := acc.add(row); err != nil {
+				return false, err
+			}
+		}
+	}
+	values := make([]storage.Value, len(accumulators))
+	for j, acc := range accumulators {
+		value, err := acc.result()
+		if err != nil {
+			return false, err
+		}
+		values[j] = value
+	}
+	i.current = storage.NewRow(values)
+	return true, nil
+}
+
+func (i *aggregateIterator) GetRow() *storage.Row {
+	return i.current
+}
+
+func (i *aggregateIterator) Reset() {
+	i.source.Reset()
+	i.done = false
+	i.current = nil
+}
+
+func (i *aggregateIterator) Close() error {
+	return i.source.Close()
+}
+
+// limitIterator は先頭の offset 行を読み飛ばし、その後の count 行だけを返す
+// count 行を返したら子から読むのをやめる
+type limitIterator struct {
+	source   Iterator
+	count    int // 負なら制限なし
+	offset   int
+	returned int
+	skipped  bool
+	current  *storage.Row
+}
+
+func NewLimitIterator(source Iterator, count, offset int) Iterator {
+	return &limitIterator{source: source, count: count, offset: offset}
+}
+
+func (i *limitIterator) Next() (bool, error) {
+	if i.count >= 0 && i.returned >= i.count {
+		i.current = nil
+		return false, nil
+	}
+	if !i.skipped {
+		i.skipped = true
+		for n := 0; n < i.offset; n++ {
+			hasNext, err := i.source.Next()
+			if err != nil || !hasNext {
+				i.current = nil
+				return false, err
+			}
+		}
+	}
+	hasNext, err := i.source.Next()
+	if err != nil || !hasNext {
+		i.current = nil
+		return false, err
+	}
+	i.returned++
+	i.current = i.source.GetRow()
+	return true, nil
+}
+
+func (i *limitIterator) GetRow() *storage.Row {
+	return i.current
+}
+
+func (i *limitIterator) Reset() {
+	i.source.Reset()
+	i.returned = 0
+	i.skipped = false
+	i.current = nil
+}
+
+func (i *limitIterator) Close() error {
+	return i.source.Close()
+}
+
+// distinctIterator は同じ値の行を一度だけ返す（NULL どうしは同じ値とみなす）
+// 返した行を値のハッシュ表に覚えておき、同じキーの行と値を比べ直して重複を見分ける
+type distinctIterator struct {
+	source  Iterator
+	seen    map[string][]*storage.Row
+	current *storage.Row
+}
+
+func NewDistinctIterator(source Iterator) Iterator {
+	return &distinctIterator{source: source, seen: make(map[string][]*storage.Row)}
+}
+
+func (i *distinctIterator) Next() (bool, error) {
+	for {
+		hasNext, err := i.source.Next()
+		if err != nil {
+			return false, err
+		}
+		if !hasNext {
+			i.current = nil
+			return false, nil
+		}
+		row := i.source.GetRow()
+		key := hashKey(row.GetValues())
+		if slices.ContainsFunc(i.seen[key], func(seen *storage.Row) bool { return sameValues(seen, row) }) {
+			continue
+		}
+		i.seen[key] = append(i.seen[key], row)
+		i.current = row
+		return true, nil
+	}
+}
+
+// sameValues は2つの行の値がすべて等しいかどうかを返す（NULL どうしは等しい）
+func sameValues(a, b *storage.Row) bool {
+	for n, av := range a.GetValues() {
+		bv := b.GetValues()[n]
+		if av == nil || bv == nil {
+			if av != bv {
+				return false
+			}
+			continue
+		}
+		if c, err := storage.CompareValues(av, bv); err != nil || c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (i *distinctIterator) GetRow() *storage.Row {
+	return i.current
+}
+
+func (i *distinctIterator) Reset() {
+	i.source.Reset()
+	i.seen = make(map[string][]*storage.Row)
+	i.current = nil
+}
+
+func (i *distinctIterator) Close() error {
+	return i.source.Close()
+}
+
+// rowsIterator はあらかじめ用意した行を順に返す
+type rowsIterator struct {
+	rows    []*storage.Row
+	pos     int
+	current *storage.Row
+}
+
+func NewRowsIterator(rows []*storage.Row) Iterator {
+	return &rowsIterator{rows: rows}
+}
+
+func (i *rowsIterator) Next() (bool, error) {
+	if i.pos >= len(i.rows) {
+		i.current = nil
+		return false, nil
+	}
+	i.current = i.rows[i.pos]
+	i.pos++
+	return true, nil
+}
+
+func (i *rowsIterator) GetRow() *storage.Row {
+	return i.current
+}
+
+func (i *rowsIterator) Reset() {
+	i.pos = 0
+	i.current = nil
+}
+
+func (i *rowsIterator) Close() error {
+	return nil
+}
+
+// emptyIterator は常に空の結果を返す
+type emptyIterator struct{}
+
+func NewEmptyIterator() Iterator {
+	return &emptyIterator{}
+}
+
+func (i *emptyIterator) Next() (bool, error)  { return false, nil }
+func (i *emptyIterator) GetRow() *storage.Row { return nil }
+func (i *emptyIterator) Reset()               {}
+func (i *emptyIterator) Close() error         { return nil }
+
+// drain はイテレータを最後まで読み、行を集める
+func drain(it Iterator) ([]*storage.Row, error) {
+	rows := make([]*storage.Row, 0)
+	for {
+		hasNext, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
+		if !hasNext {
+			return rows, nil
+		}
+		rows = append(rows, it.GetRow())
+	}
+}
+
+// errUnsupportedIterator はイテレータを作れないプランノード
+func errUnsupportedIterator(node planner.PlanNode) error {
+	return fmt.Errorf("plan node cannot be iterated: %T", node)
+}
@@ -0,0 +1,286 @@
+package executor
+
+import (
+	"testing"
+
+	"github.com/takeuchi-shogo/go-example-database/internal/planner"
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
+)
+
+func createNumbersTable(t *testing.T, exec Executor, rowCount int) *storage.Schema {
+	t.Helper()
+	e := exec.(*executor)
+	columns := []storage.Column{
+		*storage.NewColumn("id", storage.ColumnTypeInt32, 0, false),
+		*storage.NewColumn("label", storage.ColumnTypeString, 255, false),
+	}
+	schema := storage.NewSchema("numbers", columns)
+	if err := e.catalog.CreateTable("numbers", schema); err != nil {
+		t.Fatalf("CreateTable failed: %v", err)
+	}
+	table, _ := e.catalog.GetTable("numbers")
+	for i := 0; i < rowCount; i++ {
+		row := storage.NewRow([]storage.Value{storage.Int32Value(i), storage.StringValue("a-reasonably-long-label-value")})
+		if err := table.Insert(row); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+	return schema
+}
+
+func TestOpenScanReadsPagesLazily(t *testing.T) {
+	cat, exec, wal := setupTestEnvironment(t)
+	defer wal.Close()
+	defer cat.Close()
+	schema := createNumbersTable(t, exec, 1000)
+
+	it, err := exec.Open(&planner.ScanNode{TableName: "numbers", TableSchema: schema})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer it.Close()
+
+	// 最初の行を取り出すまでページを読まない
+	before := cat.GetBufferPool().Stats()
+	hasNext, err := it.Next()
+	if err != nil || !hasNext {
+		t.Fatalf("Next() = (%v, %v), want (true, nil)", hasNext, err)
+	}
+	after := cat.GetBufferPool().Stats()
+	accesses := (after.Hits + after.Misses) - (before.Hits + before.Misses)
+	if accesses != 1 {
+		t.Errorf("first row touched %d pages, want 1", accesses)
+	}
+	if got := it.GetRow().GetValues()[0]; got != storage.Int32Value(0) {
+		t.Errorf("first row id = %v, want 0", got)
+	}
+}
+
+func TestOpenFilterStreamsMatchingRows(t *testing.T) {
+	cat, exec, wal := setupTestEnvironment(t)
+	defer wal.Close()
+	defer cat.Close()
+	schema := createNumbersTable(t, exec, 50)
+
+	plan := &planner.FilterNode{
+		Condition: &planner.BinaryExpr{
+			Left:     &planner.ColumnRef{Name: "id"},
+			Operator: ">=",
+			Right:    &planner.Literal{Value: 45},
+		},
+		Child: &planner.ScanNode{TableName: "numbers", TableSchema: schema},
+	}
+	it, err := exec.Open(plan)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer it.Close()
+	rows, err := drain(it)
+	if err != nil {
+		t.Fatalf("drain failed: %v", err)
+	}
+	if len(rows) != 5 {
+		t.Errorf("Expected 5 rows, got %d", len(rows))
+	}
+
+	// Reset すると先頭から読み直せる
+	it.Reset()
+	rows, _ = drain(it)
+	if len(rows) != 5 {
+		t.Errorf("Expected 5 rows after Reset, got %d", len(rows))
+	}
+}
+
+func TestOpenFilterPropagatesError(t *testing.T) {
+	cat, exec, wal := setupTestEnvironment(t)
+	defer wal.Close()
+	defer cat.Close()
+	schema := createNumbersTable(t, exec, 3)
+
+	plan := &planner.FilterNode{
+		Condition: &planner.ColumnRef{Name: "missing"},
+		Child:     &planner.ScanNode{TableName: "numbers", TableSchema: schema},
+	}
+	if _, err := exec.Execute(plan); err == nil {
+		t.Error("Expected error for unknown column in filter")
+	}
+}
+
+func TestOpenJoinRescansInnerSide(t *testing.T) {
+	cat, exec, wal := setupTestEnvironment(t)
+	defer wal.Close()
+	defer cat.Close()
+	schema := createNumbersTable(t, exec, 4)
+
+	otherSchema := storage.NewSchema("others", []storage.Column{
+		*storage.NewColumn("other_id", storage.ColumnTypeInt32, 0, false),
+	})
+	cat.CreateTable("others", otherSchema)
+	others, _ := cat.GetTable("others")
+	for _, id := range []int32{1, 3, 3} {
+		others.Insert(storage.NewRow([]storage.Value{storage.Int32Value(id)}))
+	}
+
+	plan := &planner.JoinNode{
+		Left:     &planner.ScanNode{TableName: "numbers", TableSchema: schema},
+		Right:    &planner.ScanNode{TableName: "others", TableSchema: otherSchema},
+		JoinType: planner.JoinTypeInner,
+		Condition: &planner.BinaryExpr{
+			Left:     &planner.ColumnRef{Name: "id"},
+			Operator: "=",
+			Right:    &planner.ColumnRef{Name: "other_id"},
+		},
+	}
+	result, err := exec.Execute(plan)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if result.GetRowCount() != 3 {
+		t.Errorf("Expected 3 joined rows, got %d", result.GetRowCount())
+	}
+}
+
+func TestOpenSemiJoinKeepsLeftRows(t *testing.T) {
+	cat, exec, wal := setupTestEnvironment(t)
+	defer wal.Close()
+	defer cat.Close()
+	schema := createNumbersTable(t, exec, 4)
+
+	otherSchema := storage.NewSchema("others", []storage.Column{
+		*storage.NewColumn("other_id", storage.ColumnTypeInt32, 0, false),
+	})
+	cat.CreateTable("others", otherSchema)
+	others, _ := cat.GetTable("others")
+	for _, id := range []int32{1, 3, 3} {
+		others.Insert(storage.NewRow([]storage.Value{storage.Int32Value(id)}))
+	}
+
+	// 右に一致する行が複数あっても左の行は1回だけ返し、右のカラムは付けない
+	for joinType, want := range map[planner.JoinType][]storage.Value{
+		planner.JoinTypeSemi: {storage.Int32Value(1), storage.Int32Value(3)},
+		planner.JoinTypeAnti: {storage.Int32Value(0), storage.Int32Value(2)},
+	} {
+		plan := &planner.JoinNode{
+			Left:     &planner.ScanNode{TableName: "numbers", TableSchema: schema},
+			Right:    &planner.ScanNode{TableName: "others", TableSchema: otherSchema},
+			JoinType: joinType,
+			Condition: &planner.BinaryExpr{
+				Left:     &planner.ColumnRef{Name: "id"},
+				Operator: "=",
+				Right:    &planner.ColumnRef{Name: "other_id"},
+			},
+		}
+		result, err := exec.Execute(plan)
+		if err != nil {
+			t.Fatalf("%s: Execute failed: %v", joinType, err)
+		}
+		rows := result.GetRows()
+		if len(rows) != len(want) {
+			t.Fatalf("%s: expected %d rows, got %d", joinType, len(want), len(rows))
+		}
+		for i, row := range rows {
+			if len(row.GetValues()) != 2 || row.GetValues()[0] != want[i] {
+				t.Errorf("%s: row %d = %v, want id %v", joinType, i, row.GetValues(), want[i])
+			}
+		}
+	}
+}
+
+func TestOpenOuterJoinExtendsWithNulls(t *testing.T) {
+	cat, exec, wal := setupTestEnvironment(t)
+	defer wal.Close()
+	defer cat.Close()
+	schema := createNumbersTable(t, exec, 4)
+
+	otherSchema := storage.NewSchema("others", []storage.Column{
+		*storage.NewColumn("other_id", storage.ColumnTypeInt32, 0, false),
+	})
+	cat.CreateTable("others", otherSchema)
+	others, _ := cat.GetTable("others")
+	for _, id := range []int32{1, 3, 3, 7} {
+		others.Insert(storage.NewRow([]storage.Value{storage.Int32Value(id)}))
+	}
+
+	// 相手のない行の数（左の id 0, 2 と右の other_id 7）
+	tests := []struct {
+		joinType       planner.JoinType
+		rows           int
+		leftUnmatched  int
+		rightUnmatched int
+	}{
+		{planner.JoinTypeLeft, 5, 2, 0},
+		{planner.JoinTypeRight, 4, 0, 1},
+		{planner.JoinTypeFull, 6, 2, 1},
+	}
+	for _, tt := range tests {
+		plan := &planner.JoinNode{
+			Left:     &planner.ScanNode{TableName: "numbers", TableSchema: schema},
+			Right:    &planner.ScanNode{TableName: "others", TableSchema: otherSchema},
+			JoinType: tt.joinType,
+			Condition: &planner.BinaryExpr{
+				Left:     &planner.ColumnRef{Name: "id"},
+				Operator: "=",
+				Right:    &planner.ColumnRef{Name: "other_id"},
+			},
+		}
+		it, err := exec.Open(plan)
+		if err != nil {
+			t.Fatalf("%s: Open failed: %v", tt.joinType, err)
+		}
+		// Reset の後も同じ結果になる
+		for pass := 0; pass < 2; pass++ {
+			rows, err := drain(it)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.joinType, err)
+			}
+			if len(rows) != tt.rows {
+				t.Fatalf("%s: expected %d rows, got %d", tt.joinType, tt.rows, len(rows))
+			}
+			leftUnmatched, rightUnmatched := 0, 0
+			for _, row := range rows {
+				values := row.GetValues()
+				if len(values) != 3 {
+					t.Fatalf("%s: expected 3 columns, got %v", tt.joinType, values)
+				}
+				if values[2] == nil {
+					leftUnmatched++
+				}
+				if values[0] == nil && values[1] == nil {
+					rightUnmatched++
+				}
+			}
+			if leftUnmatched != tt.leftUnmatched || rightUnmatched != tt.rightUnmatched {
+				t.Errorf("%s: unmatched left %d right %d, want %d %d", tt.joinType, leftUnmatched, rightUnmatched, tt.leftUnmatched, tt.rightUnmatched)
+			}
+			it.Reset()
+		}
+		it.Close()
+	}
+}
+
+func TestOpenAggregateStreamsInput(t *testing.T) {
+	cat, exec, wal := setupTestEnvironment(t)
+	defer wal.Close()
+	defer cat.Close()
+	schema := createNumbersTable(t, exec, 10)
+
+	plan := &planner.AggregateNode{
+		Child: &planner.ScanNode{TableName: "numbers", TableSchema: schema},
+		Aggregates: []planner.AggregateExpression{
+			{Function: "COUNT", Column: ""},
+			{Function: "SUM", Column: "id"},
+			{Function: "MAX", Column: "id"},
+		},
+	}
+	result, err := exec.Execute(plan)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if result.GetRowCount() != 1 {
+		t.Fatalf("Expected 1 row, got %d", result.GetRowCount())
+	}
+	values := result.GetRows()[0].GetValues()
+	if values[0] != storage.Int64Value(10) || values[1] != storage.Int64Value(45) || values[2] != storage.Int64Value(9) {
+		t.Errorf("unexpected aggregate values: %v", values)
+	}
+}
@@ -0,0 +1,765 @@
+package executor
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"hash/fnv"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/takeuchi-shogo/go-example-database/internal/planner"
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
+)
+
+const (
+	// defaultJoinMemoryLimit は結合がメモリに載せる行の合計サイズの上限（バイト）
+	// ハッシュ結合ではハッシュ表に載せる右の行、マージ結合では左右それぞれの並べ替えに使う
+	defaultJoinMemoryLimit = 16 << 20
+	// hashJoinPartitions は上限を超えたときに左右の行を書き出すパーティションの数
+	hashJoinPartitions = 16
+	// maxPartitionDepth はハッシュ表に載せきれないパーティションを分け直す回数の上限
+	// 同じ結合キーの行が多いと分けても小さくならないので、上限に達したらそのままメモリに載せる
+	maxPartitionDepth = 3
+)
+
+// joinEntry は結合の候補になる右の行
+type joinEntry struct {
+	row     *storage.Row
+	matched bool // 一度でも結合条件を満たした（RIGHT / FULL で相手のない行を返すため）
+}
+
+// joinMatcher は結合の種類に応じて、左の1行と候補の右の行から出力する行を作る
+// 候補は結合キーが一致した行で、さらに結合条件全体を評価して絞り込む
+type joinMatcher struct {
+	condition  planner.Expression
+	schema     *storage.Schema // 左右を結合したスキーマ（結合条件の評価に使う）
+	joinType   planner.JoinType
+	leftWidth  int
+	rightWidth int
+}
+
+func newJoinMatcher(node *planner.JoinNode) joinMatcher {
+	return joinMatcher{
+		condition:  node.Condition,
+		schema:     node.ConditionSchema(),
+		joinType:   node.JoinType,
+		leftWidth:  len(node.Left.Schema().GetColumns()),
+		rightWidth: len(node.Right.Schema().GetColumns()),
+	}
+}
+
+// match は左の行と結合条件を満たす候補を結合した行を返す（満たした候補には印を付ける）
+// セミ結合・反結合は左の行だけを返し、LEFT / FULL は相手がなければ右を NULL にして返す
+func (m joinMatcher) match(leftRow *storage.Row, candidates []*joinEntry) ([]*storage.Row, error) {
+	var rows []*storage.Row
+	matched := false
+	for _, candidate := range candidates {
+		mergedRow := mergeRows(leftRow, candidate.row)
+		if m.condition != nil {
+			result, err := m.condition.Evaluate(mergedRow, m.schema)
+			if err != nil {
+				return nil, err
+			}
+			if ok, _ := result.(bool); !ok {
+				continue
+			}
+		}
+		matched = true
+		candidate.matched = true
+		if m.joinType == planner.JoinTypeSemi || m.joinType == planner.JoinTypeAnti {
+			break
+		}
+		rows = append(rows, mergedRow)
+	}
+	switch {
+	case m.joinType == planner.JoinTypeSemi && matched, m.joinType == planner.JoinTypeAnti && !matched:
+		rows = append(rows, leftRow)
+	case (m.joinType == planner.JoinTypeLeft || m.joinType == planner.JoinTypeFull) && !matched:
+		rows = append(rows, mergeRows(leftRow, nullRow(m.rightWidth)))
+	}
+	return rows, nil
+}
+
+// unmatched は RIGHT / FULL で一度も結合条件を満たさなかった右の行を、左を NULL にして返す
+func (m joinMatcher) unmatched(entries []*joinEntry) []*storage.Row {
+	if m.joinType != planner.JoinTypeRight && m.joinType != planner.JoinTypeFull {
+		return nil
+	}
+	var rows []*storage.Row
+	for _, entry := range entries {
+		if !entry.matched {
+			rows = append(rows, mergeRows(nullRow(m.leftWidth), entry.row))
+		}
+	}
+	return rows
+}
+
+// evaluateKeys は行の結合キーを求める（どれかが NULL なら ok は false で、その行はどの行とも一致しない）
+func evaluateKeys(keys []planner.Expression, row *storage.Row, schema *storage.Schema) ([]storage.Value, bool, error) {
+	values := make([]storage.Value, len(keys))
+	for i, key := range keys {
+		value, err := key.Evaluate(row, schema)
+		if err != nil {
+			return nil, false, err
+		}
+		if value == nil {
+			return nil, false, nil
+		}
+		if values[i], err = toStorageValue(value); err != nil {
+			return nil, false, err
+		}
+	}
+	return values, true, nil
+}
+
+// hashKey は結合キーや DISTINCT の行の値をハッシュ表のキーにする（NULL も1つの値として表す）
+// 比べて等しい値は同じキーになるように、数値は型によらず float64 の値で表す
+// （違う値が同じキーになっても、結合条件や値を比べ直すので結果は変わらない）
+func hashKey(values []storage.Value) string {
+	var b strings.Builder
+	for _, value := range values {
+		switch v := value.(type) {
+		case nil:
+			b.WriteString("null")
+		case storage.Int32Value:
+			writeNumber(&b, float64(v))
+		case storage.Int64Value:
+			writeNumber(&b, float64(v))
+		case storage.Float32Value:
+			writeNumber(&b, float64(v))
+		case storage.Float64Value:
+			writeNumber(&b, float64(v))
+		case storage.DecimalValue:
+			writeNumber(&b, v.Float64())
+		case storage.StringValue:
+			b.WriteString("s" + string(v))
+		case storage.TextValue:
+			b.WriteString("s" + string(v))
+		default:
+			b.WriteString(value.Type().String() + storage.FormatValue(value))
+		}
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+func writeNumber(b *strings.Builder, f float64) {
+	if f == 0 {
+		f = 0 // -0 と 0 をそろえる
+	}
+	b.WriteString("n" + strconv.FormatFloat(f, 'g', -1, 64))
+}
+
+// hashJoinIterator は右の行で結合キーのハッシュ表を作り、左の行で引いて結合する
+// 右の行の合計サイズがメモリの上限を超えたら、左右の行を結合キーのハッシュでパーティションに分けて
+// 一時ファイルに書き出し、パーティションごとにハッシュ表を作り直して結合する（同じキーの行は同じパーティションに入る）
+// パーティションの右の行もメモリに載せきれなければ、ハッシュの種を変えてさらに分ける
+type hashJoinIterator struct {
+	left        Iterator
+	right       Iterator
+	leftKeys    []planner.Expression
+	rightKeys   []planner.Expression
+	leftSchema  *storage.Schema
+	rightSchema *storage.Schema
+	matcher     joinMatcher
+	memoryLimit int
+
+	built      bool
+	table      map[string][]*joinEntry // 結合キーごとの右の行
+	entries    []*joinEntry            // ハッシュ表にある右の行（NULL キーの行も含む）
+	partitions []*hashPartition        // 書き出したパーティション（メモリに収まれば nil）
+	next       int                     // 次に結合するパーティション（分け直したパーティションはその位置に入れ替わる）
+	probe      func() (*storage.Row, error)
+	pending    []*storage.Row
+	done       bool
+	current    *storage.Row
+}
+
+// hashPartition はディスクに書き出した左右の行
+type hashPartition struct {
+	build *spillFile // 右の行
+	probe *spillFile // 左の行
+	level int        // 分けた回数（ハッシュの種にする）
+}
+
+func NewHashJoinIterator(left, right Iterator, node *planner.JoinNode, memoryLimit int) Iterator {
+	return &hashJoinIterator{
+		left:        left,
+		right:       right,
+		leftKeys:    node.LeftKeys,
+		rightKeys:   node.RightKeys,
+		leftSchema:  node.Left.Schema(),
+		rightSchema: node.Right.Schema(),
+		matcher:     newJoinMatcher(node),
+		memoryLimit: memoryLimit,
+	}
+}
+
+func (i *hashJoinIterator) Next() (bool, error) {
+	if !i.built {
+		if err := i.build(); err != nil {
+			return false, err
+		}
+		i.built = true
+	}
+	for len(i.pending) == 0 {
+		if i.done {
+			i.current = nil
+			return false, nil
+		}
+		if err := i.step(); err != nil {
+			return false, err
+		}
+	}
+	i.current = i.pending[0]
+	i.pending = i.pending[1:]
+	return true, nil
+}
+
+// build は右の行を読んでハッシュ表を作る（上限を超えたら左右をパーティションに書き出す）
+func (i *hashJoinIterator) build() error {
+	i.table = make(map[string][]*joinEntry)
+	size := 0
+	for {
+		hasNext, err := i.right.Next()
+		if err != nil {
+			return err
+		}
+		if !hasNext {
+			break
+		}
+		row := i.right.GetRow()
+		if i.partitions != nil {
+			if err := i.spill(i.partitions, row, i.rightKeys, i.rightSchema, (*hashPartition).buildFile); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := i.add(row); err != nil {
+			return err
+		}
+		if size += row.Size(); size > i.memoryLimit {
+			if err := i.partition(); err != nil {
+				return err
+			}
+		}
+	}
+	if i.partitions == nil {
+		return nil
+	}
+	// 左の行も同じようにパーティションに分ける
+	for {
+		hasNext, err := i.left.Next()
+		if err != nil {
+			return err
+		}
+		if !hasNext {
+			break
+		}
+		if err := i.spill(i.partitions, i.left.GetRow(), i.leftKeys, i.leftSchema, (*hashPartition).probeFile); err != nil {
+			return err
+		}
+	}
+	return rewindPartitions(i.partitions)
+}
+
+// add は右の行をハッシュ表に加える
+func (i *hashJoinIterator) add(row *storage.Row) error {
+	key, ok, err := evaluateKeys(i.rightKeys, row, i.rightSchema)
+	if err != nil {
+		return err
+	}
+	entry := &joinEntry{row: row}
+	i.entries = append(i.entries, entry)
+	if ok {
+		k := hashKey(key)
+		i.table[k] = append(i.table[k], entry)
+	}
+	return nil
+}
+
+// partition はパーティションのファイルを作り、ハッシュ表の行を書き出す
+func (i *hashJoinIterator) partition() error {
+	partitions, err := newPartitions(0)
+	if err != nil {
+		return err
+	}
+	i.partitions = partitions
+	for _, entry := range i.entries {
+		if err := i.spill(i.partitions, entry.row, i.rightKeys, i.rightSchema, (*hashPartition).buildFile); err != nil {
+			return err
+		}
+	}
+	i.table, i.entries = nil, nil
+	return nil
+}
+
+// newPartitions は level 回目に分けるパーティションのファイルを作る（途中で失敗したら作ったファイルを消す）
+func newPartitions(level int) ([]*hashPartition, error) {
+	partitions := make([]*hashPartition, 0, hashJoinPartitions)
+	for range hashJoinPartitions {
+		build, err := newSpillFile("godb-join-*.spill")
+		if err != nil {
+			removePartitions(partitions)
+			return nil, err
+		}
+		probe, err := newSpillFile("godb-join-*.spill")
+		if err != nil {
+			build.remove()
+			removePartitions(partitions)
+			return nil, err
+		}
+		partitions = append(partitions, &hashPartition{build: build, probe: probe, level: level})
+	}
+	return partitions, nil
+}
+
+// rewindPartitions は書き出したパーティションを先頭から読めるようにする
+func rewindPartitions(partitions []*hashPartition) error {
+	for _, p := range partitions {
+		if err := p.build.rewind(); err != nil {
+			return err
+		}
+		if err := p.probe.rewind(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// spill は行を結合キーのハッシュで決まるパーティションに書き出す（NULL キーの行は先頭のパーティションに入れる）
+func (i *hashJoinIterator) spill(partitions []*hashPartition, row *storage.Row, keys []planner.Expression, schema *storage.Schema, file func(*hashPartition) *spillFile) error {
+	key, ok, err := evaluateKeys(keys, row, schema)
+	if err != nil {
+		return err
+	}
+	n := 0
+	if ok {
+		h := fnv.New32a()
+		h.Write([]byte{byte(partitions[0].level)})
+		h.Write([]byte(hashKey(key)))
+		n = int(h.Sum32() % uint32(len(partitions)))
+	}
+	return file(partitions[n]).write(row)
+}
+
+func (p *hashPartition) buildFile() *spillFile { return p.build }
+func (p *hashPartition) probeFile() *spillFile { return p.probe }
+
+// step は左の行を1行引いて結合する（パーティションの左を読み切ったら次のパーティションに進む）
+func (i *hashJoinIterator) step() error {
+	if i.probe == nil {
+		if err := i.nextPartition(); err != nil || i.done {
+			return err
+		}
+	}
+	row, err := i.probe()
+	if err != nil {
+		return err
+	}
+	if row == nil {
+		// パーティションの左を読み切ったので、相手のない右の行を返す
+		i.pending = append(i.pending, i.matcher.unmatched(i.entries)...)
+		i.probe = nil
+		return nil
+	}
+	var candidates []*joinEntry
+	key, ok, err := evaluateKeys(i.leftKeys, row, i.leftSchema)
+	if err != nil {
+		return err
+	}
+	if ok {
+		candidates = i.table[hashKey(key)]
+	}
+	rows, err := i.matcher.match(row, candidates)
+	if err != nil {
+		return err
+	}
+	i.pending = append(i.pending, rows...)
+	return nil
+}
+
+// nextPartition は次に結合するパーティションのハッシュ表を作る（メモリに収まった場合は左をそのまま読む）
+func (i *hashJoinIterator) nextPartition() error {
+	if i.partitions == nil {
+		if i.next > 0 {
+			i.done = true
+			return nil
+		}
+		i.next++
+		i.probe = func() (*storage.Row, error) {
+			hasNext, err := i.left.Next()
+			if err != nil || !hasNext {
+				return nil, err
+			}
+			return i.left.GetRow(), nil
+		}
+		return nil
+	}
+	for {
+		if i.next >= len(i.partitions) {
+			i.done = true
+			return nil
+		}
+		p := i.partitions[i.next]
+		loaded, err := i.load(p)
+		if err != nil {
+			return err
+		}
+		if loaded {
+			i.next++
+			i.probe = p.probe.read
+			return nil
+		}
+		// 載せきれないので分け直し、分けたパーティションから順に結合する
+		partitions, err := i.repartition(p)
+		if err != nil {
+			return err
+		}
+		p.build.remove()
+		p.probe.remove()
+		i.partitions = slices.Replace(i.partitions, i.next, i.next+1, partitions...)
+	}
+}
+
+// load はパーティションの右の行でハッシュ表を作る
+// メモリの上限を超えたら false を返す（分け直せる回数を使い切っていれば、上限を超えてもすべて載せる）
+func (i *hashJoinIterator) load(p *hashPartition) (bool, error) {
+	i.table, i.entries = make(map[string][]*joinEntry), nil
+	size := 0
+	for {
+		row, err := p.build.read()
+		if err != nil {
+			return false, err
+		}
+		if row == nil {
+			return true, nil
+		}
+		if err := i.add(row); err != nil {
+			return false, err
+		}
+		if size += row.Size(); size > i.memoryLimit && p.level < maxPartitionDepth {
+			return false, nil
+		}
+	}
+}
+
+// repartition はハッシュ表に読んだ行とパーティションの残りの行を、次の段のパーティションに分けて書き出す
+func (i *hashJoinIterator) repartition(p *hashPartition) ([]*hashPartition, error) {
+	partitions, err := newPartitions(p.level + 1)
+	if err != nil {
+		return nil, err
+	}
+	if err := i.spillPartition(partitions, p); err != nil {
+		removePartitions(partitions)
+		return nil, err
+	}
+	return partitions, nil
+}
+
+// spillPartition はハッシュ表の行とパーティションの残りの左右の行を partitions に書き出す
+func (i *hashJoinIterator) spillPartition(partitions []*hashPartition, p *hashPartition) error {
+	for _, entry := range i.entries {
+		if err := i.spill(partitions, entry.row, i.rightKeys, i.rightSchema, (*hashPartition).buildFile); err != nil {
+			return err
+		}
+	}
+	i.table, i.entries = nil, nil
+	sources := []struct {
+		read   func() (*storage.Row, error)
+		keys   []planner.Expression
+		schema *storage.Schema
+		file   func(*hashPartition) *spillFile
+	}{
+		{p.build.read, i.rightKeys, i.rightSchema, (*hashPartition).buildFile},
+		{p.probe.read, i.leftKeys, i.leftSchema, (*hashPartition).probeFile},
+	}
+	for _, source := range sources {
+		for {
+			row, err := source.read()
+			if err != nil {
+				return err
+			}
+			if row == nil {
+				break
+			}
+			if err := i.spill(partitions, row, source.keys, source.schema, source.file); err != nil {
+				return err
+			}
+		}
+	}
+	return rewindPartitions(partitions)
+}
+
+func (i *hashJoinIterator) GetRow() *storage.Row {
+	return i.current
+}
+
+func (i *hashJoinIterator) Reset() {
+	i.left.Reset()
+	i.right.Reset()
+	i.removePartitions()
+	i.built = false
+	i.table, i.entries = nil, nil
+	i.next = 0
+	i.probe = nil
+	i.pending = nil
+	i.done = false
+	i.current = nil
+}
+
+func (i *hashJoinIterator) Close() error {
+	i.removePartitions()
+	if err := i.left.Close(); err != nil {
+		return err
+	}
+	return i.right.Close()
+}
+
+// removePartitions はパーティションの一時ファイルを消す
+func (i *hashJoinIterator) removePartitions() {
+	removePartitions(i.partitions)
+	i.partitions = nil
+}
+
+func removePartitions(partitions []*hashPartition) {
+	for _, p := range partitions {
+		p.build.remove()
+		p.probe.remove()
+	}
+}
+
+// spillFile は結合や並べ替えがメモリに載せきれない行を書き出す一時ファイル
+// 書き終えたら rewind してから先頭から読む
+type spillFile struct {
+	file    *os.File
+	writer  *bufio.Writer
+	encoder *gob.Encoder
+	decoder *gob.Decoder
+}
+
+// spilledRow は一時ファイルに書き出す行
+type spilledRow struct {
+	RowID  int64
+	Values []storage.Value
+}
+
+// newSpillFile は pattern（os.CreateTemp の形式）の名前で一時ファイルを作る
+func newSpillFile(pattern string) (*spillFile, error) {
+	file, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return nil, err
+	}
+	writer := bufio.NewWriter(file)
+	return &spillFile{file: file, writer: writer, encoder: gob.NewEncoder(writer)}, nil
+}
+
+func (f *spillFile) write(row *storage.Row) error {
+	return f.encoder.Encode(spilledRow{RowID: row.GetRowID(), Values: row.GetValues()})
+}
+
+// rewind は書き出した行を先頭から読めるようにする
+func (f *spillFile) rewind() error {
+	if err := f.writer.Flush(); err != nil {
+		return err
+	}
+	if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	f.decoder = gob.NewDecoder(bufio.NewReader(f.file))
+	return nil
+}
+
+// read は次の行を返す（読み切ったら nil）
+func (f *spillFile) read() (*storage.Row, error) {
+	var row spilledRow
+	if err := f.decoder.Decode(&row); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return storage.NewRowWithID(row.RowID, row.Values), nil
+}
+
+// remove はファイルを閉じて消す
+func (f *spillFile) remove() {
+	f.file.Close()
+	os.Remove(f.file.Name())
+}
+
+// mergeJoinIterator は左右を結合キーの昇順に並べ、先頭から1行ずつ突き合わせて結合する
+// 並べ替えは外部ソートの sortIterator で行い、メモリの上限を超えた行は一時ファイルに書き出す
+// （入力が結合キーの順に並んでいても、スナップショットの古い版が混ざると並びが崩れるので並べ替えを通す）
+// メモリに載せるのは、右の同じ結合キーの行だけ
+type mergeJoinIterator struct {
+	left    mergeInput
+	right   mergeInput
+	matcher joinMatcher
+
+	started bool
+	pending []*storage.Row
+	done    bool
+	current *storage.Row
+}
+
+// mergeInput は結合キーの昇順に並んだ入力を1行ずつ読む
+type mergeInput struct {
+	it     Iterator
+	keys   []planner.Expression
+	schema *storage.Schema
+	row    *storage.Row    // 現在の行（読み切ったら nil）
+	key    []storage.Value // 現在の行の結合キー（NULL を含めば nil で、どの行とも一致しない）
+}
+
+// NewMergeJoinIterator はマージ結合のイテレータを作る
+// 左右の並べ替えはそれぞれ memoryLimit までメモリに載せる
+func NewMergeJoinIterator(left, right Iterator, node *planner.JoinNode, memoryLimit int) Iterator {
+	return &mergeJoinIterator{
+		left:    newMergeInput(left, node.LeftKeys, node.Left, memoryLimit),
+		right:   newMergeInput(right, node.RightKeys, node.Right, memoryLimit),
+		matcher: newJoinMatcher(node),
+	}
+}
+
+// newMergeInput は入力を結合キーの昇順に並べ替えて読む
+func newMergeInput(it Iterator, keys []planner.Expression, child planner.PlanNode, memoryLimit int) mergeInput {
+	sortKeys := make([]planner.SortKey, len(keys))
+	for n, key := range keys {
+		sortKeys[n] = planner.SortKey{Expression: key}
+	}
+	sorted := NewSortIterator(it, &planner.SortNode{Keys: sortKeys, Child: child}, memoryLimit)
+	return mergeInput{it: sorted, keys: keys, schema: child.Schema()}
+}
+
+// advance は次の行と結合キーを読む
+func (in *mergeInput) advance() error {
+	hasNext, err := in.it.Next()
+	if err != nil {
+		return err
+	}
+	in.row, in.key = nil, nil
+	if !hasNext {
+		return nil
+	}
+	in.row = in.it.GetRow()
+	key, ok, err := evaluateKeys(in.keys, in.row, in.schema)
+	if err != nil {
+		return err
+	}
+	if ok {
+		in.key = key
+	}
+	return nil
+}
+
+func (i *mergeJoinIterator) Next() (bool, error) {
+	if !i.started {
+		if err := i.left.advance(); err != nil {
+			return false, err
+		}
+		if err := i.right.advance(); err != nil {
+			return false, err
+		}
+		i.started = true
+	}
+	for len(i.pending) == 0 {
+		if i.done {
+			i.current = nil
+			return false, nil
+		}
+		if err := i.step(); err != nil {
+			return false, err
+		}
+	}
+	i.current = i.pending[0]
+	i.pending = i.pending[1:]
+	return true, nil
+}
+
+// step は左右の先頭の行を比べ、一致する相手のない行を返すか、同じ結合キーの行どうしを結合する
+func (i *mergeJoinIterator) step() error {
+	left, right := &i.left, &i.right
+	switch {
+	case left.row == nil && right.row == nil:
+		i.done = true
+		return nil
+	case left.row != nil && (left.key == nil || right.row == nil || (right.key != nil && compareKeys(left.key, right.key) < 0)):
+		// 右のキーより小さい左の行（NULL キーの行も）は一致する行がない
+		return i.matchLeft(nil)
+	case right.key == nil || left.row == nil || compareKeys(right.key, left.key) < 0:
+		i.pending = append(i.pending, i.matcher.unmatched([]*joinEntry{{row: right.row}})...)
+		return right.advance()
+	}
+	// 右の同じ結合キーの行をまとめ、左の同じ結合キーの行と結合する
+	key := left.key
+	var group []*joinEntry
+	for right.row != nil && (right.key == nil || compareKeys(right.key, key) == 0) {
+		if right.key == nil {
+			i.pending = append(i.pending, i.matcher.unmatched([]*joinEntry{{row: right.row}})...)
+		} else {
+			group = append(group, &joinEntry{row: right.row})
+		}
+		if err := right.advance(); err != nil {
+			return err
+		}
+	}
+	for left.row != nil && (left.key == nil || compareKeys(left.key, key) == 0) {
+		candidates := group
+		if left.key == nil {
+			candidates = nil
+		}
+		if err := i.matchLeft(candidates); err != nil {
+			return err
+		}
+	}
+	i.pending = append(i.pending, i.matcher.unmatched(group)...)
+	return nil
+}
+
+// matchLeft は左の現在の行を候補と結合し、左を次の行に進める
+func (i *mergeJoinIterator) matchLeft(candidates []*joinEntry) error {
+	rows, err := i.matcher.match(i.left.row, candidates)
+	if err != nil {
+		return err
+	}
+	i.pending = append(i.pending, rows...)
+	return i.left.advance()
+}
+
+// compareKeys は結合キーを先頭の値から順に比べる
+// 結合キーは比べられる型の組み合わせだけなので、比べられない値は等しいとみなす
+func compareKeys(a, b []storage.Value) int {
+	for n := range a {
+		if c, err := storage.CompareValues(a[n], b[n]); err == nil && c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func (i *mergeJoinIterator) GetRow() *storage.Row {
+	return i.current
+}
+
+func (i *mergeJoinIterator) Reset() {
+	i.left.it.Reset()
+	i.right.it.Reset()
+	i.left.row, i.left.key = nil, nil
+	i.right.row, i.right.key = nil, nil
+	i.started = false
+	i.pending = nil
+	i.done = false
+	i.current = nil
+}
+
+func (i *mergeJoinIterator) Close() error {
+	if err := i.left.it.Close(); err != nil {
+		return err
+	}
+	return i.right.it.Close()
+}
@@ -0,0 +1,235 @@
+package executor
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/takeuchi-shogo/go-example-database/internal/planner"
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
+)
+
+// createJoinTables は結合キーに重複と NULL がある2つのテーブルを作る
+func createJoinTables(t *testing.T, exec Executor) (*storage.Schema, *storage.Schema) {
+	t.Helper()
+	e := exec.(*executor)
+	lefts := storage.NewSchema("lefts", []storage.Column{
+		*storage.NewColumn("k", storage.ColumnTypeInt32, 0, true),
+		*storage.NewColumn("tag", storage.ColumnTypeString, 255, false),
+	})
+	rights := storage.NewSchema("rights", []storage.Column{
+		*storage.NewColumn("rk", storage.ColumnTypeInt64, 0, true),
+		*storage.NewColumn("v", storage.ColumnTypeString, 255, false),
+	})
+	rows := map[*storage.Schema][][]storage.Value{
+		lefts: {
+			{storage.Int32Value(5), storage.StringValue("e")},
+			{storage.Int32Value(2), storage.StringValue("b")},
+			{nil, storage.StringValue("d")},
+			{storage.Int32Value(1), storage.StringValue("a")},
+			{storage.Int32Value(2), storage.StringValue("c")},
+		},
+		rights: {
+			{storage.Int64Value(3), storage.StringValue("z")},
+			{storage.Int64Value(2), storage.StringValue("x")},
+			{nil, storage.StringValue("w")},
+			{storage.Int64Value(2), storage.StringValue("y")},
+			{storage.Int64Value(1), storage.StringValue("u")},
+		},
+	}
+	for schema, values := range rows {
+		name := schema.GetTableName()
+		if err := e.catalog.CreateTable(name, schema); err != nil {
+			t.Fatalf("CreateTable failed: %v", err)
+		}
+		table, _ := e.catalog.GetTable(name)
+		for _, v := range values {
+			if err := table.Insert(storage.NewRow(v)); err != nil {
+				t.Fatalf("Insert failed: %v", err)
+			}
+		}
+	}
+	return lefts, rights
+}
+
+// joinResult は結合結果の行を並べ替えて文字列にする
+func joinResult(t *testing.T, exec Executor, plan planner.PlanNode) []string {
+	t.Helper()
+	it, err := exec.Open(plan)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer it.Close()
+	rows, err := drain(it)
+	if err != nil {
+		t.Fatalf("%s: %v", plan.String(), err)
+	}
+	result := make([]string, len(rows))
+	for i, row := range rows {
+		values := make([]string, len(row.GetValues()))
+		for j, value := range row.GetValues() {
+			values[j] = storage.FormatValue(value)
+		}
+		result[i] = strings.Join(values, ",")
+	}
+	slices.Sort(result)
+	return result
+}
+
+func TestHashAndMergeJoinsMatchNestedLoop(t *testing.T) {
+	cat, exec, wal := setupTestEnvironment(t)
+	defer wal.Close()
+	defer cat.Close()
+	lefts, rights := createJoinTables(t, exec)
+
+	// 結合キー以外の条件も結合条件として評価する
+	condition := &planner.BinaryExpr{
+		Left: &planner.BinaryExpr{
+			Left:     &planner.ColumnRef{TableName: "lefts", Name: "k"},
+			Operator: "=",
+			Right:    &planner.ColumnRef{TableName: "rights", Name: "rk"},
+		},
+		Operator: "AND",
+		Right: &planner.BinaryExpr{
+			Left:     &planner.ColumnRef{Name: "v"},
+			Operator: "<>",
+			Right:    &planner.Literal{Value: "y"},
+		},
+	}
+	joinTypes := []planner.JoinType{
+		planner.JoinTypeInner, planner.JoinTypeLeft, planner.JoinTypeRight,
+		planner.JoinTypeFull, planner.JoinTypeSemi, planner.JoinTypeAnti,
+	}
+	for _, joinType := range joinTypes {
+		newJoin := func(algorithm planner.JoinAlgorithm) *planner.JoinNode {
+			return &planner.JoinNode{
+				Left:      &planner.ScanNode{TableName: "lefts", TableSchema: lefts},
+				Right:     &planner.ScanNode{TableName: "rights", TableSchema: rights},
+				JoinType:  joinType,
+				Condition: condition,
+				Algorithm: algorithm,
+				LeftKeys:  []planner.Expression{&planner.ColumnRef{TableName: "lefts", Name: "k"}},
+				RightKeys: []planner.Expression{&planner.ColumnRef{TableName: "rights", Name: "rk"}},
+			}
+		}
+		want := joinResult(t, exec, newJoin(planner.JoinAlgorithmNestedLoop))
+		if len(want) == 0 {
+			t.Fatalf("%s: nested loop returned no rows", joinType)
+		}
+		if got := joinResult(t, exec, newJoin(planner.JoinAlgorithmHash)); !slices.Equal(got, want) {
+			t.Errorf("%s hash join: expected %v, got %v", joinType, want, got)
+		}
+		if got := joinResult(t, exec, newJoin(planner.JoinAlgorithmMerge)); !slices.Equal(got, want) {
+			t.Errorf("%s merge join: expected %v, got %v", joinType, want, got)
+		}
+		// 上限を超えるとパーティションや並べ替えのランに書き出してから結合する
+		exec.SetJoinMemoryLimit(1)
+		if got := joinResult(t, exec, newJoin(planner.JoinAlgorithmHash)); !slices.Equal(got, want) {
+			t.Errorf("%s spilled hash join: expected %v, got %v", joinType, want, got)
+		}
+		if got := joinResult(t, exec, newJoin(planner.JoinAlgorithmMerge)); !slices.Equal(got, want) {
+			t.Errorf("%s spilled merge join: expected %v, got %v", joinType, want, got)
+		}
+		exec.SetJoinMemoryLimit(defaultJoinMemoryLimit)
+	}
+
+	// 外部結合は NULL キーの行も相手のない行として返す
+	want := []string{"1,a,1,u", "2,b,2,x", "2,c,2,x", "5,e,NULL,NULL", "NULL,NULL,2,y", "NULL,NULL,3,z", "NULL,NULL,NULL,w", "NULL,d,NULL,NULL"}
+	full := &planner.JoinNode{
+		Left:      &planner.ScanNode{TableName: "lefts", TableSchema: lefts},
+		Right:     &planner.ScanNode{TableName: "rights", TableSchema: rights},
+		JoinType:  planner.JoinTypeFull,
+		Condition: condition,
+		Algorithm: planner.JoinAlgorithmHash,
+		LeftKeys:  []planner.Expression{&planner.ColumnRef{TableName: "lefts", Name: "k"}},
+		RightKeys: []planner.Expression{&planner.ColumnRef{TableName: "rights", Name: "rk"}},
+	}
+	if got := joinResult(t, exec, full); !slices.Equal(got, want) {
+		t.Errorf("full hash join: expected %v, got %v", want, got)
+	}
+}
+
+func TestHashJoinSpillRemovesFiles(t *testing.T) {
+	cat, exec, wal := setupTestEnvironment(t)
+	defer wal.Close()
+	defer cat.Close()
+	lefts, rights := createJoinTables(t, exec)
+	tempDir := t.TempDir()
+	t.Setenv("TMPDIR", tempDir)
+	exec.SetJoinMemoryLimit(1)
+
+	plan := &planner.JoinNode{
+		Left:      &planner.ScanNode{TableName: "lefts", TableSchema: lefts},
+		Right:     &planner.ScanNode{TableName: "rights", TableSchema: rights},
+		JoinType:  planner.JoinTypeInner,
+		Condition: &planner.BinaryExpr{Left: &planner.ColumnRef{Name: "k"}, Operator: "=", Right: &planner.ColumnRef{Name: "rk"}},
+		Algorithm: planner.JoinAlgorithmHash,
+		LeftKeys:  []planner.Expression{&planner.ColumnRef{Name: "k"}},
+		RightKeys: []planner.Expression{&planner.ColumnRef{Name: "rk"}},
+	}
+	it, err := exec.Open(plan)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	// Reset の後も同じ行を返す
+	for pass := 0; pass < 2; pass++ {
+		rows, err := drain(it)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 5 {
+			t.Fatalf("expected 5 rows, got %d", len(rows))
+		}
+		// 上限が1バイトなので、行のあるパーティションはさらに分け直している
+		files, _ := filepath.Glob(filepath.Join(tempDir, "godb-join-*"))
+		if len(files) <= 2*hashJoinPartitions {
+			t.Fatalf("expected more than %d spill files after repartitioning, got %d", 2*hashJoinPartitions, len(files))
+		}
+		it.Reset()
+	}
+	it.Close()
+	if entries, _ := os.ReadDir(tempDir); len(entries) != 0 {
+		t.Errorf("expected spill files to be removed, got %d files", len(entries))
+	}
+}
+
+func TestMergeJoinSpillRemovesFiles(t *testing.T) {
+	cat, exec, wal := setupTestEnvironment(t)
+	defer wal.Close()
+	defer cat.Close()
+	lefts, rights := createJoinTables(t, exec)
+	tempDir := t.TempDir()
+	t.Setenv("TMPDIR", tempDir)
+	exec.SetJoinMemoryLimit(1)
+
+	plan := &planner.JoinNode{
+		Left:      &planner.ScanNode{TableName: "lefts", TableSchema: lefts},
+		Right:     &planner.ScanNode{TableName: "rights", TableSchema: rights},
+		JoinType:  planner.JoinTypeInner,
+		Condition: &planner.BinaryExpr{Left: &planner.ColumnRef{Name: "k"}, Operator: "=", Right: &planner.ColumnRef{Name: "rk"}},
+		Algorithm: planner.JoinAlgorithmMerge,
+		LeftKeys:  []planner.Expression{&planner.ColumnRef{Name: "k"}},
+		RightKeys: []planner.Expression{&planner.ColumnRef{Name: "rk"}},
+	}
+	it, err := exec.Open(plan)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	// 左右を外部ソートで並べてから、1行ずつ突き合わせる
+	rows, err := drain(it)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 5 {
+		t.Fatalf("expected 5 rows, got %d", len(rows))
+	}
+	if files, _ := filepath.Glob(filepath.Join(tempDir, "godb-sort-*")); len(files) == 0 {
+		t.Error("expected sort runs for the merge join inputs")
+	}
+	it.Close()
+	if entries, _ := os.ReadDir(tempDir); len(entries) != 0 {
+		t.Errorf("expected spill files to be removed, got %d files", len(entries))
+	}
+}
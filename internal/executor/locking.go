@@ -0,0 +1,154 @@
+package executor
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/takeuchi-shogo/go-example-database/internal/dbtxn"
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
+)
+
+// lockingIterator は走査で読んだ行にトランザクションのロックを取ってから返す
+// 読んだ時点の行はほかのトランザクションが変更中かもしれないので、ロックを取ってから読み直す
+type lockingIterator struct {
+	source  Iterator
+	table   *storage.Table
+	txn     *dbtxn.Transaction
+	mode    dbtxn.LockMode
+	index   storage.TableIndex // インデックススキャンならキーが変わった行を範囲と照合し直す
+	keys    storage.KeyRange
+	seen    map[int64]struct{} // 走査中に別のページへ移動した行を二度返さない
+	current *storage.Row
+}
+
+func newLockingIterator(source Iterator, table *storage.Table, txn *dbtxn.Transaction, mode dbtxn.LockMode) *lockingIterator {
+	return &lockingIterator{source: source, table: table, txn: txn, mode: mode, seen: make(map[int64]struct{})}
+}
+
+func (i *lockingIterator) Next() (bool, error) {
+	for {
+		hasNext, err := i.source.Next()
+		if err != nil || !hasNext {
+			i.current = nil
+			return false, err
+		}
+		row := i.source.GetRow()
+		rowID := row.GetRowID()
+		if _, ok := i.seen[rowID]; ok {
+			continue
+		}
+		key := dbtxn.RowLockKey(string(i.table.GetName()), rowID)
+		if err := i.txn.Lock(key, i.mode); err != nil {
+			return false, err
+		}
+		latest, err := i.table.FindByRowID(rowID)
+		if errors.Is(err, storage.ErrRowNotFound) {
+			continue // ロックを待つ間に削除された
+		}
+		if err != nil {
+			return false, err
+		}
+		if i.index != nil && indexKeyChanged(i.index, row, latest) {
+			inRange, err := i.stillInRange(rowID)
+			if err != nil {
+				return false, err
+			}
+			if !inRange {
+				continue
+			}
+		}
+		i.seen[rowID] = struct{}{}
+		i.current = latest
+		return true, nil
+	}
+}
+
+// stillInRange はキーが変わった行がまだ検索範囲に含まれるかをインデックスで確かめる
+func (i *lockingIterator) stillInRange(rowID int64) (bool, error) {
+	rowIDs, err := i.table.LookupIndex(i.index, i.keys)
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(rowIDs, rowID), nil
+}
+
+func (i *lockingIterator) GetRow() *storage.Row {
+	return i.current
+}
+
+func (i *lockingIterator) Reset() {
+	i.source.Reset()
+	i.seen = make(map[int64]struct{})
+	i.current = nil
+}
+
+func (i *lockingIterator) Close() error {
+	return i.source.Close()
+}
+
+// indexKeyChanged はインデックスのキーになるカラムの値が変わったかどうかを返す
+func indexKeyChanged(idx storage.TableIndex, before, after *storage.Row) bool {
+	for _, col := range idx.GetColumnIndexes() {
+		if before.GetValues()[col] != after.GetValues()[col] {
+			return true
+		}
+	}
+	return false
+}
+
+// lockTable はテーブルに意図ロックを取る
+func (e *executor) lockTable(name string, rowMode dbtxn.LockMode) error {
+	if e.txn == nil {
+		return nil
+	}
+	mode := dbtxn.LockIntentionShared
+	if rowMode == dbtxn.LockExclusive {
+		mode = dbtxn.LockIntentionExclusive
+	}
+	return e.txn.Lock(dbtxn.TableLockKey(name), mode)
+}
+
+// lockRow は行に X ロックを取る（挿入した行など、走査を経ない行に使う）
+func (e *executor) lockRow(name string, rowID int64) error {
+	if e.txn == nil {
+		return nil
+	}
+	return e.txn.Lock(dbtxn.RowLockKey(name, rowID), dbtxn.LockExclusive)
+}
+
+// wrapScan は走査のイテレータを、トランザクションの読み方に合わせたイテレータで包む
+// UPDATE / DELETE の対象行は最新の行を読み、読んだ時点で X ロックを取る（S から格上げするとデッドロックしやすいため）
+// WHERE に合わない行もロックするので、インデックスで絞り込めない条件ではテーブル全体を押さえることになる
+// SERIALIZABLE の SELECT はテーブルに S ロックを取って最新の行を読む（範囲を問わずテーブル単位なので、ファントムも防ぐ）
+// それ以外の SELECT はロックを取らずにスナップショットから見える版を読む（スナップショットがなければテーブルの行をそのまま読む）
+func (e *executor) wrapScan(source Iterator, table *storage.Table, idx storage.TableIndex, keys storage.KeyRange) (Iterator, error) {
+	switch {
+	case e.txn != nil && e.writing:
+		if err := e.lockTable(string(table.GetName()), dbtxn.LockExclusive); err != nil {
+			return nil, err
+		}
+		it := newLockingIterator(source, table, e.txn, dbtxn.LockExclusive)
+		it.index, it.keys = idx, keys
+		return it, nil
+	case e.txn != nil && e.txn.GetIsolationLevel() == dbtxn.IsolationSerializable:
+		if err := e.txn.Lock(dbtxn.TableLockKey(string(table.GetName())), dbtxn.LockShared); err != nil {
+			return nil, err
+		}
+		return source, nil
+	case e.readSnapshot() != nil:
+		it := newSnapshotIterator(source, table, e.readSnapshot())
+		it.index, it.keys = idx, keys
+		return it, nil
+	default:
+		return source, nil
+	}
+}
+
+// readSnapshot は SELECT が読むスナップショットを返す
+// トランザクションの中ではトランザクションのスナップショット（READ COMMITTED なら文ごとに取り直したもの）を使う
+func (e *executor) readSnapshot() *dbtxn.Snapshot {
+	if e.txn != nil {
+		return e.txn.GetSnapshot()
+	}
+	return e.snapshot
+}
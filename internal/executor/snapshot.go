@@ -0,0 +1,136 @@
+package executor
+
+import (
+	"github.com/takeuchi-shogo/go-example-database/internal/dbtxn"
+	"github.com/takeuchi-shogo/go-example-database/internal/index"
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
+)
+
+// snapshotIterator はスナップショットから見える版の行だけを返す
+// テーブルにある最新の行が見えなければ古い版に置き換え、テーブルにない行（削除された行や
+// 走査中に別のページへ移動した行）は走査の後で版から補う
+// 行にロックを取らないので、ほかのトランザクションの書き込みを待たない
+type snapshotIterator struct {
+	source   Iterator
+	table    *storage.Table
+	snapshot *dbtxn.Snapshot
+	index    storage.TableIndex // インデックススキャンなら古い版のキーを範囲と照合する
+	keys     storage.KeyRange
+	seen     map[int64]struct{}
+	pending  []*storage.Row // 走査の後で返す版の行（nil なら未取得）
+	current  *storage.Row
+}
+
+func newSnapshotIterator(source Iterator, table *storage.Table, snapshot *dbtxn.Snapshot) *snapshotIterator {
+	return &snapshotIterator{source: source, table: table, snapshot: snapshot, seen: make(map[int64]struct{})}
+}
+
+func (i *snapshotIterator) Next() (bool, error) {
+	if i.pending == nil {
+		for {
+			hasNext, err := i.source.Next()
+			if err != nil {
+				return false, err
+			}
+			if !hasNext {
+				break
+			}
+			row, err := i.visibleRow(i.source.GetRow())
+			if err != nil {
+				return false, err
+			}
+			if row != nil {
+				i.current = row
+				return true, nil
+			}
+		}
+		if err := i.loadVersions(); err != nil {
+			return false, err
+		}
+	}
+	if len(i.pending) == 0 {
+		i.current = nil
+		return false, nil
+	}
+	i.current = i.pending[0]
+	i.pending = i.pending[1:]
+	return true, nil
+}
+
+// visibleRow はテーブルから読んだ行をスナップショットから見える版にする（見えなければ nil）
+func (i *snapshotIterator) visibleRow(row *storage.Row) (*storage.Row, error) {
+	rowID := row.GetRowID()
+	if _, ok := i.seen[rowID]; ok {
+		return nil, nil
+	}
+	i.seen[rowID] = struct{}{}
+	visibility, data := i.snapshot.Read(string(i.table.GetName()), rowID)
+	switch visibility {
+	case dbtxn.VisibleCurrent:
+		return row, nil
+	case dbtxn.VisibleVersion:
+		return i.decode(data)
+	default:
+		return nil, nil
+	}
+}
+
+// loadVersions はテーブルの走査で見つからなかった、スナップショットから見える版を集める
+func (i *snapshotIterator) loadVersions() error {
+	i.pending = make([]*storage.Row, 0)
+	rowIDs, versions := i.snapshot.VersionedRows(string(i.table.GetName()))
+	for n, rowID := range rowIDs {
+		if _, ok := i.seen[rowID]; ok {
+			continue
+		}
+		row, err := i.decode(versions[n])
+		if err != nil {
+			return err
+		}
+		if row != nil {
+			i.pending = append(i.pending, row)
+		}
+	}
+	return nil
+}
+
+// decode は版の行を復元する
+// インデックススキャンでは、版のキーが検索範囲に含まれなければ nil を返す
+func (i *snapshotIterator) decode(data []byte) (*storage.Row, error) {
+	row, err := storage.DecodeRow(data, i.table.GetSchema())
+	if err != nil {
+		return nil, err
+	}
+	if i.index == nil {
+		return row, nil
+	}
+	// NULL を含むキーの扱いはテーブルがインデックスに載せるときと同じ
+	key := make([]storage.Value, 0, len(i.index.GetColumnIndexes()))
+	for n, col := range i.index.GetColumnIndexes() {
+		value := row.GetValues()[col]
+		if value == nil && (n == 0 || i.index.IsUnique()) {
+			return nil, nil
+		}
+		key = append(key, value)
+	}
+	ok, err := index.KeyRangeContains(i.keys, key)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return row, nil
+}
+
+func (i *snapshotIterator) GetRow() *storage.Row {
+	return i.current
+}
+
+func (i *snapshotIterator) Reset() {
+	i.source.Reset()
+	i.seen = make(map[int64]struct{})
+	i.pending = nil
+	i.current = nil
+}
+
+func (i *snapshotIterator) Close() error {
+	return i.source.Close()
+}
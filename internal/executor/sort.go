@@ -0,0 +1,288 @@
+package executor
+
+import (
+	"cmp"
+	"container/heap"
+	"slices"
+
+	"github.com/takeuchi-shogo/go-example-database/internal/planner"
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
+)
+
+// defaultSortMemoryLimit は並べ替えがメモリに載せる行の合計サイズの上限（バイト）
+const defaultSortMemoryLimit = 16 << 20
+
+// sortEntry は並べ替える行とソートキーの値
+type sortEntry struct {
+	row *storage.Row
+	key []storage.Value // NULL は nil
+	seq int             // キーが等しい行の順（メモリ上では読んだ順、マージではランの番号）
+}
+
+// sortIterator は子の行をすべて読み、ソートキーの順に並べて返す
+// 行の合計サイズがメモリの上限を超えたら、それまでの行を並べて一時ファイルに書き出し（ラン）、
+// 最後にすべてのランを先頭から少しずつ読みながらマージする（外部マージソート）
+// top-N（limit が正）では、先頭の limit 行だけをヒープに残しながら読む
+type sortIterator struct {
+	source      Iterator
+	keys        []planner.SortKey
+	schema      *storage.Schema
+	limit       int
+	memoryLimit int
+
+	sorted  bool
+	entries []*sortEntry // メモリ上で並べた行
+	pos     int          // 次に返す entries の位置
+	runs    []*spillFile // 書き出したラン（メモリに収まれば nil）
+	merge   *entryHeap   // 各ランの先頭の行
+	current *storage.Row
+}
+
+func NewSortIterator(source Iterator, node *planner.SortNode, memoryLimit int) Iterator {
+	return &sortIterator{
+		source:      source,
+		keys:        node.Keys,
+		schema:      node.Child.Schema(),
+		limit:       node.Limit,
+		memoryLimit: memoryLimit,
+	}
+}
+
+func (i *sortIterator) Next() (bool, error) {
+	if !i.sorted {
+		var err error
+		if i.limit > 0 {
+			err = i.sortTopN()
+		} else {
+			err = i.sort()
+		}
+		if err != nil {
+			return false, err
+		}
+		i.sorted = true
+	}
+	if i.runs != nil {
+		return i.nextMerged()
+	}
+	if i.pos >= len(i.entries) {
+		i.current = nil
+		return false, nil
+	}
+	i.current = i.entries[i.pos].row
+	i.pos++
+	return true, nil
+}
+
+// sort は子の行を読んで並べる（上限を超えたらランに書き出し、マージの準備をする）
+func (i *sortIterator) sort() error {
+	size := 0
+	for {
+		hasNext, err := i.source.Next()
+		if err != nil {
+			return err
+		}
+		if !hasNext {
+			break
+		}
+		row := i.source.GetRow()
+		entry, err := i.newEntry(row, len(i.entries))
+		if err != nil {
+			return err
+		}
+		i.entries = append(i.entries, entry)
+		if size += row.Size(); size > i.memoryLimit {
+			if err := i.spill(); err != nil {
+				return err
+			}
+			size = 0
+		}
+	}
+	if i.runs == nil {
+		slices.SortFunc(i.entries, i.compare)
+		return nil
+	}
+	if len(i.entries) > 0 {
+		if err := i.spill(); err != nil {
+			return err
+		}
+	}
+	i.merge = &entryHeap{less: func(a, b *sortEntry) bool { return i.compare(a, b) < 0 }}
+	for n := range i.runs {
+		entry, err := i.readRun(n)
+		if err != nil {
+			return err
+		}
+		if entry != nil {
+			heap.Push(i.merge, entry)
+		}
+	}
+	return nil
+}
+
+// spill はメモリ上の行を並べてランとして一時ファイルに書き出す
+func (i *sortIterator) spill() error {
+	slices.SortFunc(i.entries, i.compare)
+	run, err := newSpillFile("godb-sort-*.spill")
+	if err != nil {
+		return err
+	}
+	i.runs = append(i.runs, run)
+	for _, entry := range i.entries {
+		if err := run.write(entry.row); err != nil {
+			return err
+		}
+	}
+	if err := run.rewind(); err != nil {
+		return err
+	}
+	i.entries = nil
+	return nil
+}
+
+// readRun は n 番目のランの次の行を読む（読み切ったら nil）
+func (i *sortIterator) readRun(n int) (*sortEntry, error) {
+	row, err := i.runs[n].read()
+	if err != nil || row == nil {
+		return nil, err
+	}
+	return i.newEntry(row, n)
+}
+
+// nextMerged はランの先頭の行のうち最も小さい行を返し、そのランの次の行をヒープに入れる
+func (i *sortIterator) nextMerged() (bool, error) {
+	if i.merge.Len() == 0 {
+		i.current = nil
+		return false, nil
+	}
+	entry := heap.Pop(i.merge).(*sortEntry)
+	next, err := i.readRun(entry.seq)
+	if err != nil {
+		return false, err
+	}
+	if next != nil {
+		heap.Push(i.merge, next)
+	}
+	i.current = entry.row
+	return true, nil
+}
+
+// sortTopN は並べたときに先頭の limit 行に入る行だけを残しながら子の行を読む
+// 残した行は最も後ろに並ぶ行が根に来るヒープに入れ、それより前に並ぶ行が来たら入れ替える
+func (i *sortIterator) sortTopN() error {
+	top := &entryHeap{less: func(a, b *sortEntry) bool { return i.compare(a, b) > 0 }}
+	for seq := 0; ; seq++ {
+		hasNext, err := i.source.Next()
+		if err != nil {
+			return err
+		}
+		if !hasNext {
+			break
+		}
+		entry, err := i.newEntry(i.source.GetRow(), seq)
+		if err != nil {
+			return err
+		}
+		if top.Len() < i.limit {
+			heap.Push(top, entry)
+		} else if i.compare(entry, top.items[0]) < 0 {
+			top.items[0] = entry
+			heap.Fix(top, 0)
+		}
+	}
+	i.entries = top.items
+	slices.SortFunc(i.entries, i.compare)
+	return nil
+}
+
+// newEntry は行のソートキーを求める
+func (i *sortIterator) newEntry(row *storage.Row, seq int) (*sortEntry, error) {
+	key := make([]storage.Value, len(i.keys))
+	for n, k := range i.keys {
+		value, err := k.Expression.Evaluate(row, i.schema)
+		if err != nil {
+			return nil, err
+		}
+		if value == nil {
+			continue
+		}
+		if key[n], err = toStorageValue(value); err != nil {
+			return nil, err
+		}
+	}
+	return &sortEntry{row: row, key: key, seq: seq}, nil
+}
+
+// compare はソートキーを先頭から順に比べ、等しければ seq で比べる
+func (i *sortIterator) compare(a, b *sortEntry) int {
+	if c := compareSortKeys(a.key, b.key, i.keys); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.seq, b.seq)
+}
+
+// compareSortKeys はソートキーの値を先頭から順に比べる
+// NULL は最も小さい値とし、比べられない値は等しいとみなす
+func compareSortKeys(a, b []storage.Value, keys []planner.SortKey) int {
+	for n, key := range keys {
+		var c int
+		switch {
+		case a[n] == nil && b[n] == nil:
+		case a[n] == nil:
+			c = -1
+		case b[n] == nil:
+			c = 1
+		default:
+			c, _ = storage.CompareValues(a[n], b[n])
+		}
+		if key.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func (i *sortIterator) GetRow() *storage.Row {
+	return i.current
+}
+
+func (i *sortIterator) Reset() {
+	i.source.Reset()
+	i.removeRuns()
+	i.sorted = false
+	i.entries = nil
+	i.pos = 0
+	i.merge = nil
+	i.current = nil
+}
+
+func (i *sortIterator) Close() error {
+	i.removeRuns()
+	return i.source.Close()
+}
+
+// removeRuns はランの一時ファイルを消す
+func (i *sortIterator) removeRuns() {
+	for _, run := range i.runs {
+		run.remove()
+	}
+	i.runs = nil
+}
+
+// entryHeap は less の順に並べる sortEntry のヒープ（container/heap で使う）
+type entryHeap struct {
+	items []*sortEntry
+	less  func(a, b *sortEntry) bool
+}
+
+func (h *entryHeap) Len() int           { return len(h.items) }
+func (h *entryHeap) Less(a, b int) bool { return h.less(h.items[a], h.items[b]) }
+func (h *entryHeap) Swap(a, b int)      { h.items[a], h.items[b] = h.items[b], h.items[a] }
+func (h *entryHeap) Push(x any)         { h.items = append(h.items, x.(*sortEntry)) }
+func (h *entryHeap) Pop() any {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
@@ -0,0 +1,176 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/takeuchi-shogo/go-example-database/internal/planner"
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
+)
+
+// createSortTable は grp に重複と NULL がある 200 行のテーブルを作る
+func createSortTable(t *testing.T, exec Executor) *storage.Schema {
+	t.Helper()
+	e := exec.(*executor)
+	schema := storage.NewSchema("items", []storage.Column{
+		*storage.NewColumn("id", storage.ColumnTypeInt64, 0, false),
+		*storage.NewColumn("grp", storage.ColumnTypeInt32, 0, true),
+		*storage.NewColumn("name", storage.ColumnTypeString, 255, false),
+	})
+	if err := e.catalog.CreateTable("items", schema); err != nil {
+		t.Fatalf("CreateTable failed: %v", err)
+	}
+	table, _ := e.catalog.GetTable("items")
+	for i := 0; i < 200; i++ {
+		var grp storage.Value = storage.Int32Value(i * 7 % 10)
+		if i%13 == 0 {
+			grp = nil
+		}
+		row := storage.NewRow([]storage.Value{storage.Int64Value(i), grp, storage.StringValue(fmt.Sprintf("item%d", i))})
+		if err := table.Insert(row); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+	return schema
+}
+
+// resultValues は結果の行の先頭カラムを返された順に文字列にする
+func resultValues(t *testing.T, exec Executor, plan planner.PlanNode) []string {
+	t.Helper()
+	it, err := exec.Open(plan)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer it.Close()
+	rows, err := drain(it)
+	if err != nil {
+		t.Fatalf("%s: %v", plan.String(), err)
+	}
+	values := make([]string, len(rows))
+	for i, row := range rows {
+		values[i] = storage.FormatValue(row.GetValues()[0])
+	}
+	return values
+}
+
+func TestSortSpillsAndMergesInOrder(t *testing.T) {
+	cat, exec, wal := setupTestEnvironment(t)
+	defer wal.Close()
+	defer cat.Close()
+	schema := createSortTable(t, exec)
+	tempDir := t.TempDir()
+	t.Setenv("TMPDIR", tempDir)
+
+	// grp の昇順（NULL が先頭）、grp が等しければ id の降順
+	var want []string
+	for grp := -1; grp < 10; grp++ {
+		for id := 199; id >= 0; id-- {
+			if (id%13 == 0 && grp == -1) || (id%13 != 0 && id*7%10 == grp) {
+				want = append(want, fmt.Sprint(id))
+			}
+		}
+	}
+	newSort := func(limit int) *planner.SortNode {
+		return &planner.SortNode{
+			Keys: []planner.SortKey{
+				{Expression: &planner.ColumnRef{Name: "grp"}},
+				{Expression: &planner.ColumnRef{Name: "id"}, Desc: true},
+			},
+			Limit: limit,
+			Child: &planner.ScanNode{TableName: "items", TableSchema: schema},
+		}
+	}
+
+	if got := resultValues(t, exec, newSort(0)); !slices.Equal(got, want) {
+		t.Errorf("in-memory sort: expected %v, got %v", want, got)
+	}
+	if got := resultValues(t, exec, newSort(15)); !slices.Equal(got, want[:15]) {
+		t.Errorf("top-n sort: expected %v, got %v", want[:15], got)
+	}
+	// 上限を超えると並べた行を一時ファイルに書き出してからマージする
+	for _, limit := range []int{1, 500} {
+		exec.SetSortMemoryLimit(limit)
+		it, err := exec.Open(newSort(0))
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		for pass := 0; pass < 2; pass++ {
+			rows, err := drain(it)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, len(rows))
+			for i, row := range rows {
+				got[i] = storage.FormatValue(row.GetValues()[0])
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("spilled sort (limit %d): expected %v, got %v", limit, want, got)
+			}
+			if files, _ := filepath.Glob(filepath.Join(tempDir, "godb-sort-*")); len(files) == 0 {
+				t.Errorf("expected spill files with limit %d", limit)
+			}
+			it.Reset()
+		}
+		it.Close()
+		if entries, _ := os.ReadDir(tempDir); len(entries) != 0 {
+			t.Errorf("expected spill files to be removed, got %d files", len(entries))
+		}
+	}
+}
+
+func TestLimitAndDistinct(t *testing.T) {
+	cat, exec, wal := setupTestEnvironment(t)
+	defer wal.Close()
+	defer cat.Close()
+	schema := createSortTable(t, exec)
+	scan := &planner.ScanNode{TableName: "items", TableSchema: schema}
+
+	limits := []struct {
+		count, offset int
+		want          []string
+	}{
+		{5, 190, []string{"190", "191", "192", "193", "194"}},
+		{3, 0, []string{"0", "1", "2"}},
+		{-1, 197, []string{"197", "198", "199"}},
+		{0, 0, []string{}},
+		{5, 300, []string{}},
+	}
+	for _, tt := range limits {
+		plan := &planner.LimitNode{Count: tt.count, Offset: tt.offset, Child: scan}
+		if got := resultValues(t, exec, plan); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: expected %v, got %v", plan.String(), tt.want, got)
+		}
+	}
+
+	// NULL も1つの値として重複を取り除く
+	distinct := &planner.DistinctNode{Child: &planner.ProjectNode{Columns: []string{"grp"}, Child: scan}}
+	got := resultValues(t, exec, distinct)
+	slices.Sort(got)
+	want := []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9", "NULL"}
+	if !slices.Equal(got, want) {
+		t.Errorf("distinct: expected %v, got %v", want, got)
+	}
+}
+
+func TestExecuteExplain(t *testing.T) {
+	cat, exec, wal := setupTestEnvironment(t)
+	defer wal.Close()
+	defer cat.Close()
+	schema := createSortTable(t, exec)
+
+	plan := &planner.ExplainNode{Child: &planner.LimitNode{Count: 1, Child: &planner.ScanNode{TableName: "items", TableSchema: schema}}}
+	result, err := exec.Execute(plan)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	var got []string
+	for _, row := range result.GetRows() {
+		got = append(got, storage.FormatValue(row.GetValues()[0]))
+	}
+	if want := []string{"Limit(1)", "  Scan(items)"}; !slices.Equal(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
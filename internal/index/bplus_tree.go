@@ -0,0 +1,667 @@
+/*
+bplus_tree.go はページ単位でディスクに置く B+Tree
+ページ0はメタページ、それ以外の各ページがノード（リーフ / 内部）1つに対応する
+キーは可変長のバイト列で bytes.Compare の順に並ぶ（key_codec.go で型の順序を保つように符号化する）
+ページの読み書きはすべてバッファプールを経由する
+*/
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sort"
+
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
+)
+
+var (
+	ErrKeyTooLarge     = errors.New("index key too large")
+	ErrCorruptedBTree  = errors.New("corrupted b+tree file")
+	errNodeTypeUnknown = errors.New("unknown b+tree node type")
+)
+
+const (
+	// MaxKeySize は1つのキーの最大バイト数（1ページに最低3エントリ入るようにする）
+	MaxKeySize = 1024
+
+	bptreeMagic   = "GBPT"
+	bptreeVersion = 1
+	metaPageID    = storage.PageID(0)
+	// nilPageID はリンクがないことを表す（ページ0はメタページなのでノードには使われない）
+	nilPageID = storage.PageID(0)
+
+	// ノードの種類
+	pageTypeLeaf     byte = 1
+	pageTypeInternal byte = 2
+	pageTypeFree     byte = 3
+
+	// ノードヘッダ: 種類(1) + エントリ数(2) + 次のリーフ(8) + 前のリーフ(8)
+	nodeHeaderSize = 1 + 2 + 8 + 8
+	// minNodeSize を下回ったノードは兄弟と併合または再分配する
+	minNodeSize = storage.PageSize / 4
+)
+
+// bptNode はデコードしたノード
+// 変更はデコードした状態で行い、ページに書き戻すときにサイズを確認する
+type bptNode struct {
+	id       storage.PageID
+	leaf     bool
+	keys     [][]byte
+	values   []int64          // リーフ: 行ID
+	children []storage.PageID // 内部ノード: len(keys)+1 個の子
+	next     storage.PageID   // リーフ間のリンク（範囲検索用）
+	prev     storage.PageID
+}
+
+// size はノードをページに書いたときのバイト数
+func (n *bptNode) size() int {
+	size := nodeHeaderSize
+	if !n.leaf {
+		size += 8 // 先頭の子
+	}
+	for _, key := range n.keys {
+		size += 2 + len(key) + 8
+	}
+	return size
+}
+
+// lowerBound は key 以上の最初のキーの位置を返す
+func (n *bptNode) lowerBound(key []byte) int {
+	return sort.Search(len(n.keys), func(i int) bool { return bytes.Compare(n.keys[i], key) >= 0 })
+}
+
+// childIndex は key を含む子の位置を返す
+// 区切りキー K について 左の子 < K <= 右の子 なので、key 以下のキーの数が子の位置になる
+func (n *bptNode) childIndex(key []byte) int {
+	return sort.Search(len(n.keys), func(i int) bool { return bytes.Compare(n.keys[i], key) > 0 })
+}
+
+func (n *bptNode) encode(buf []byte) {
+	clear(buf)
+	if n.leaf {
+		buf[0] = pageTypeLeaf
+	} else {
+		buf[0] = pageTypeInternal
+	}
+	binary.LittleEndian.PutUint16(buf[1:3], uint16(len(n.keys)))
+	binary.LittleEndian.PutUint64(buf[3:11], uint64(n.next))
+	binary.LittleEndian.PutUint64(buf[11:19], uint64(n.prev))
+	off := nodeHeaderSize
+	if !n.leaf {
+		// 割り当て直後の内部ノードはまだ子を持たない
+		if len(n.children) > 0 {
+			binary.LittleEndian.PutUint64(buf[off:], uint64(n.children[0]))
+		}
+		off += 8
+	}
+	for i, key := range n.keys {
+		binary.LittleEndian.PutUint16(buf[off:], uint16(len(key)))
+		off += 2
+		off += copy(buf[off:], key)
+		if n.leaf {
+			binary.LittleEndian.PutUint64(buf[off:], uint64(n.values[i]))
+		} else {
+			binary.LittleEndian.PutUint64(buf[off:], uint64(n.children[i+1]))
+		}
+		off += 8
+	}
+}
+
+func decodeNode(id storage.PageID, buf []byte) (*bptNode, error) {
+	n := &bptNode{id: id}
+	switch buf[0] {
+	case pageTypeLeaf:
+		n.leaf = true
+	case pageTypeInternal:
+	default:
+		return nil, errNodeTypeUnknown
+	}
+	count := int(binary.LittleEndian.Uint16(buf[1:3]))
+	n.next = storage.PageID(binary.LittleEndian.Uint64(buf[3:11]))
+	n.prev = storage.PageID(binary.LittleEndian.Uint64(buf[11:19]))
+	off := nodeHeaderSize
+	if !n.leaf {
+		n.children = append(n.children, storage.PageID(binary.LittleEndian.Uint64(buf[off:])))
+		off += 8
+	}
+	n.keys = make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		if off+2 > len(buf) {
+			return nil, ErrCorruptedBTree
+		}
+		keyLen := int(binary.LittleEndian.Uint16(buf[off:]))
+		off += 2
+		if off+keyLen+8 > len(buf) {
+			return nil, ErrCorruptedBTree
+		}
+		key := make([]byte, keyLen)
+		copy(key, buf[off:off+keyLen])
+		off += keyLen
+		n.keys = append(n.keys, key)
+		v := binary.LittleEndian.Uint64(buf[off:])
+		off += 8
+		if n.leaf {
+			n.values = append(n.values, int64(v))
+		} else {
+			n.children = append(n.children, storage.PageID(v))
+		}
+	}
+	return n, nil
+}
+
+// BPlusTree はディスク上の B+Tree
+// キーは木の中で一意（重複を許すインデックスは呼び出し側で行IDを付ける）
+type BPlusTree struct {
+	pager     *storage.Pager
+	pool      *storage.BufferPool
+	root      storage.PageID
+	pageCount int64          // 割り当て済みのページ数（メタページを含む）
+	freeHead  storage.PageID // 空きページリストの先頭
+	// clean はメタページに正常終了が記録されているかどうか
+	// 変更を始める前に false を書き込んでおき、Flush で true に戻す
+	clean bool
+}
+
+// OpenBPlusTree は Pager 上の B+Tree を開く。空のファイルなら初期化する
+func OpenBPlusTree(pager *storage.Pager, pool *storage.BufferPool) (*BPlusTree, error) {
+	t := &BPlusTree{pager: pager, pool: pool}
+	if pager.GetNumPages() == 0 {
+		// メタページと空のルート（リーフ）を作成
+		t.pageCount = 2
+		t.root = 1
+		if err := t.writeNode(&bptNode{id: t.root, leaf: true}, true); err != nil {
+			return nil, err
+		}
+		if err := t.writeMeta(true); err != nil {
+			return nil, err
+		}
+		return t, nil
+	}
+	if err := t.readMeta(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// IsClean は前回正常に閉じられたファイルかどうかを返す
+// false の場合はクラッシュで中身がテーブルとずれている可能性がある
+func (t *BPlusTree) IsClean() bool {
+	return t.clean
+}
+
+// メタページ: マジック(4) + バージョン(2) + 正常終了フラグ(1) + ルート(8) + ページ数(8) + 空きリスト(8)
+func (t *BPlusTree) readMeta() error {
+	page, err := t.pool.FetchPage(t.pager, metaPageID)
+	if err != nil {
+		return err
+	}
+	defer t.pool.UnpinPage(t.pager, metaPageID, false)
+	buf := page.Data()
+	if string(buf[0:4]) != bptreeMagic || binary.LittleEndian.Uint16(buf[4:6]) != bptreeVersion {
+		return ErrCorruptedBTree
+	}
+	t.clean = buf[6] == 1
+	t.root = storage.PageID(binary.LittleEndian.Uint64(buf[7:15]))
+	t.pageCount = int64(binary.LittleEndian.Uint64(buf[15:23]))
+	t.freeHead = storage.PageID(binary.LittleEndian.Uint64(buf[23:31]))
+	return nil
+}
+
+func (t *BPlusTree) writeMeta(isNew bool) error {
+	var page *storage.Page
+	var err error
+	if isNew {
+		page, err = t.pool.NewPage(t.pager, metaPageID)
+	} else {
+		page, err = t.pool.FetchPage(t.pager, metaPageID)
+	}
+	if err != nil {
+		return err
+	}
+	buf := page.Data()
+	clear(buf)
+	copy(buf[0:4], bptreeMagic)
+	binary.LittleEndian.PutUint16(buf[4:6], bptreeVersion)
+	if t.clean {
+		buf[6] = 1
+	}
+	binary.LittleEndian.PutUint64(buf[7:15], uint64(t.root))
+	binary.LittleEndian.PutUint64(buf[15:23], uint64(t.pageCount))
+	binary.LittleEndian.PutUint64(buf[23:31], uint64(t.freeHead))
+	return t.pool.UnpinPage(t.pager, metaPageID, true)
+}
+
+// beginWrite は最初の変更の前に「正常終了していない」ことをディスクに記録する
+func (t *BPlusTree) beginWrite() error {
+	if !t.clean {
+		return nil
+	}
+	t.clean = false
+	if err := t.writeMeta(false); err != nil {
+		return err
+	}
+	return t.pool.FlushPage(t.pager, metaPageID)
+}
+
+func (t *BPlusTree) readNode(id storage.PageID) (*bptNode, error) {
+	page, err := t.pool.FetchPage(t.pager, id)
+	if err != nil {
+		return nil, err
+	}
+	defer t.pool.UnpinPage(t.pager, id, false)
+	return decodeNode(id, page.Data())
+}
+
+func (t *BPlusTree) writeNode(n *bptNode, isNew bool) error {
+	var page *storage.Page
+	var err error
+	if isNew {
+		page, err = t.pool.NewPage(t.pager, n.id)
+	} else {
+		page, err = t.pool.FetchPage(t.pager, n.id)
+	}
+	if err != nil {
+		return err
+	}
+	n.encode(page.Data())
+	return t.pool.UnpinPage(t.pager, n.id, true)
+}
+
+// allocateNode は空きページを再利用するか、ファイル末尾に新しいページを割り当てる
+func (t *BPlusTree) allocateNode(leaf bool) (*bptNode, error) {
+	n := &bptNode{leaf: leaf}
+	if t.freeHead != nilPageID {
+		page, err := t.pool.FetchPage(t.pager, t.freeHead)
+		if err != nil {
+			return nil, err
+		}
+		n.id = t.freeHead
+		t.freeHead = storage.PageID(binary.LittleEndian.Uint64(page.Data()[1:9]))
+		if err := t.pool.UnpinPage(t.pager, n.id, false); err != nil {
+			return nil, err
+		}
+		return n, t.writeNode(n, false)
+	}
+	n.id = storage.PageID(t.pageCount)
+	t.pageCount++
+	return n, t.writeNode(n, true)
+}
+
+// freeNode はページを空きリストに戻す
+func (t *BPlusTree) freeNode(id storage.PageID) error {
+	page, err := t.pool.FetchPage(t.pager, id)
+	if err != nil {
+		return err
+	}
+	buf := page.Data()
+	clear(buf)
+	buf[0] = pageTypeFree
+	binary.LittleEndian.PutUint64(buf[1:9], uint64(t.freeHead))
+	t.freeHead = id
+	return t.pool.UnpinPage(t.pager, id, true)
+}
+
+// Get は key に対応する値を返す
+func (t *BPlusTree) Get(key []byte) (int64, bool, error) {
+	it, err := t.Seek(key)
+	if err != nil {
+		return 0, false, err
+	}
+	ok, err := it.Next()
+	if err != nil || !ok || !bytes.Equal(it.Key(), key) {
+		return 0, false, err
+	}
+	return it.Value(), true, nil
+}
+
+// splitResult は子ノードが分割されたときに親へ伝える区切りキーと右のノード
+type splitResult struct {
+	key   []byte
+	right storage.PageID
+}
+
+// Insert はキーと値を追加する。同じキーがあれば ErrDuplicateKey を返す
+func (t *BPlusTree) Insert(key []byte, value int64) error {
+	if len(key) > MaxKeySize {
+		return ErrKeyTooLarge
+	}
+	if err := t.beginWrite(); err != nil {
+		return err
+	}
+	split, err := t.insert(t.root, key, value)
+	if err != nil {
+		return err
+	}
+	if split != nil {
+		if err := t.growRoot(split); err != nil {
+			return err
+		}
+	}
+	return t.writeMeta(false)
+}
+
+// growRoot はルートが分割されたときに新しいルートを作る
+func (t *BPlusTree) growRoot(split *splitResult) error {
+	root, err := t.allocateNode(false)
+	if err != nil {
+		return err
+	}
+	root.keys = [][]byte{split.key}
+	root.children = []storage.PageID{t.root, split.right}
+	if err := t.writeNode(root, false); err != nil {
+		return err
+	}
+	t.root = root.id
+	return nil
+}
+
+func (t *BPlusTree) insert(id storage.PageID, key []byte, value int64) (*splitResult, error) {
+	n, err := t.readNode(id)
+	if err != nil {
+		return nil, err
+	}
+	if n.leaf {
+		i := n.lowerBound(key)
+		if i < len(n.keys) && bytes.Equal(n.keys[i], key) {
+			return nil, ErrDuplicateKey
+		}
+		n.keys = insertAt(n.keys, i, key)
+		n.values = insertAt(n.values, i, value)
+	} else {
+		i := n.childIndex(key)
+		split, err := t.insert(n.children[i], key, value)
+		if err != nil || split == nil {
+			return nil, err
+		}
+		n.keys = insertAt(n.keys, i, split.key)
+		n.children = insertAt(n.children, i+1, split.right)
+	}
+	return t.storeNode(n)
+}
+
+// storeNode はノードを書き戻す。1ページに収まらなければ分割して親に伝える
+func (t *BPlusTree) storeNode(n *bptNode) (*splitResult, error) {
+	if n.size() <= storage.PageSize {
+		return nil, t.writeNode(n, false)
+	}
+	right, err := t.allocateNode(n.leaf)
+	if err != nil {
+		return nil, err
+	}
+	sepKey := t.splitInto(n, right)
+	if n.leaf {
+		// リーフのリンクをつなぎ直す
+		right.next = n.next
+		right.prev = n.id
+		if n.next != nilPageID {
+			next, err := t.readNode(n.next)
+			if err != nil {
+				return nil, err
+			}
+			next.prev = right.id
+			if err := t.writeNode(next, false); err != nil {
+				return nil, err
+			}
+		}
+		n.next = right.id
+	}
+	if err := t.writeNode(n, false); err != nil {
+		return nil, err
+	}
+	if err := t.writeNode(right, false); err != nil {
+		return nil, err
+	}
+	return &splitResult{key: sepKey, right: right.id}, nil
+}
+
+// splitInto は left の内容をバイト数がほぼ半分になる位置で left と right に分け、区切りキーを返す
+// リーフは右の先頭キーを複製して親に上げ、内部ノードは中央のキーを親に移す
+func (t *BPlusTree) splitInto(left, right *bptNode) []byte {
+	total := left.size()
+	acc := nodeHeaderSize
+	mid := 1
+	for i, key := range left.keys {
+		acc += 2 + len(key) + 8
+		if acc >= total/2 {
+			mid = i + 1
+			break
+		}
+	}
+	if mid >= len(left.keys) {
+		mid = len(left.keys) - 1
+	}
+	if left.leaf {
+		right.keys = append([][]byte{}, left.keys[mid:]...)
+		right.values = append([]int64{}, left.values[mid:]...)
+		left.keys = left.keys[:mid]
+		left.values = left.values[:mid]
+		return right.keys[0]
+	}
+	sepKey := left.keys[mid]
+	right.keys = append([][]byte{}, left.keys[mid+1:]...)
+	right.children = append([]storage.PageID{}, left.children[mid+1:]...)
+	left.keys = left.keys[:mid]
+	left.children = left.children[:mid+1]
+	return sepKey
+}
+
+// Delete は key を削除する。見つからなければ false を返す
+func (t *BPlusTree) Delete(key []byte) (bool, error) {
+	if err := t.beginWrite(); err != nil {
+		return false, err
+	}
+	found, split, err := t.delete(t.root, key)
+	if err != nil || !found {
+		return found, err
+	}
+	if split != nil {
+		if err := t.growRoot(split); err != nil {
+			return false, err
+		}
+	}
+	// キーのなくなった内部ノードのルートは唯一の子と入れ替える
+	for {
+		root, err := t.readNode(t.root)
+		if err != nil {
+			return false, err
+		}
+		if root.leaf || len(root.keys) > 0 {
+			break
+		}
+		if err := t.freeNode(root.id); err != nil {
+			return false, err
+		}
+		t.root = root.children[0]
+	}
+	return true, t.writeMeta(false)
+}
+
+func (t *BPlusTree) delete(id storage.PageID, key []byte) (bool, *splitResult, error) {
+	n, err := t.readNode(id)
+	if err != nil {
+		return false, nil, err
+	}
+	if n.leaf {
+		i := n.lowerBound(key)
+		if i >= len(n.keys) || !bytes.Equal(n.keys[i], key) {
+			return false, nil, nil
+		}
+		n.keys = append(n.keys[:i], n.keys[i+1:]...)
+		n.values = append(n.values[:i], n.values[i+1:]...)
+		return true, nil, t.writeNode(n, false)
+	}
+	i := n.childIndex(key)
+	found, split, err := t.delete(n.children[i], key)
+	if err != nil || !found {
+		return found, nil, err
+	}
+	if split != nil {
+		n.keys = insertAt(n.keys, i, split.key)
+		n.children = insertAt(n.children, i+1, split.right)
+	} else {
+		child, err := t.readNode(n.children[i])
+		if err != nil {
+			return false, nil, err
+		}
+		if child.size() < minNodeSize {
+			if err := t.rebalance(n, i); err != nil {
+				return false, nil, err
+			}
+		}
+	}
+	// 区切りキーが長くなって親があふれた場合は分割する
+	split, err = t.storeNode(n)
+	return true, split, err
+}
+
+// rebalance は parent の i 番目の子が小さくなりすぎたときに、隣の兄弟と併合または再分配する
+func (t *BPlusTree) rebalance(parent *bptNode, i int) error {
+	if len(parent.children) < 2 {
+		return nil
+	}
+	sep := i - 1
+	if i == 0 {
+		sep = 0
+	}
+	left, err := t.readNode(parent.children[sep])
+	if err != nil {
+		return err
+	}
+	right, err := t.readNode(parent.children[sep+1])
+	if err != nil {
+		return err
+	}
+
+	// 併合した場合のノード
+	merged := &bptNode{id: left.id, leaf: left.leaf, prev: left.prev, next: right.next}
+	if left.leaf {
+		merged.keys = append(append([][]byte{}, left.keys...), right.keys...)
+		merged.values = append(append([]int64{}, left.values...), right.values...)
+	} else {
+		// 内部ノードは親の区切りキーを降ろしてつなぐ
+		merged.keys = append(append(append([][]byte{}, left.keys...), parent.keys[sep]), right.keys...)
+		merged.children = append(append([]storage.PageID{}, left.children...), right.children...)
+	}
+
+	if merged.size() <= storage.PageSize {
+		// 併合: 右のノードを解放し、親から区切りキーと右の子を外す
+		if merged.leaf && right.next != nilPageID {
+			next, err := t.readNode(right.next)
+			if err != nil {
+				return err
+			}
+			next.prev = merged.id
+			if err := t.writeNode(next, false); err != nil {
+				return err
+			}
+		}
+		if err := t.writeNode(merged, false); err != nil {
+			return err
+		}
+		if err := t.freeNode(right.id); err != nil {
+			return err
+		}
+		parent.keys = append(parent.keys[:sep], parent.keys[sep+1:]...)
+		parent.children = append(parent.children[:sep+1], parent.children[sep+2:]...)
+		return nil
+	}
+
+	// 再分配: 併合した内容をバイト数で半分に分け直す
+	newRight := &bptNode{id: right.id, leaf: right.leaf, prev: left.id, next: right.next}
+	merged.next = right.id
+	parent.keys[sep] = t.splitInto(merged, newRight)
+	if err := t.writeNode(merged, false); err != nil {
+		return err
+	}
+	return t.writeNode(newRight, false)
+}
+
+// Seek は key 以上の最初のキーの直前に位置するイテレータを返す（key が nil なら先頭から）
+func (t *BPlusTree) Seek(key []byte) (*TreeIterator, error) {
+	n, err := t.readNode(t.root)
+	if err != nil {
+		return nil, err
+	}
+	for !n.leaf {
+		if n, err = t.readNode(n.children[n.childIndex(key)]); err != nil {
+			return nil, err
+		}
+	}
+	return &TreeIterator{tree: t, leaf: n, pos: n.lowerBound(key)}, nil
+}
+
+// Flush は正常終了を記録してすべてのページを書き出す
+func (t *BPlusTree) Flush() error {
+	// 先にすべてのページを書き出してから、最後にメタページに正常終了の印を付ける
+	if err := t.writeMeta(false); err != nil {
+		return err
+	}
+	if err := t.pool.FlushPager(t.pager); err != nil {
+		return err
+	}
+	t.clean = true
+	if err := t.writeMeta(false); err != nil {
+		return err
+	}
+	return t.pool.FlushPage(t.pager, metaPageID)
+}
+
+// Close はページを書き出して B+Tree を閉じる
+func (t *BPlusTree) Close() error {
+	if err := t.Flush(); err != nil {
+		return err
+	}
+	t.pool.DiscardPager(t.pager)
+	return t.pager.Close()
+}
+
+// Drop はページを書き出さずに閉じる（ファイルを削除する前に使う）
+func (t *BPlusTree) Drop() error {
+	t.pool.DiscardPager(t.pager)
+	return t.pager.Close()
+}
+
+// TreeIterator はリーフのリンクをたどってキーを昇順に返す
+// 一度に保持するのは現在のリーフだけ
+type TreeIterator struct {
+	tree  *BPlusTree
+	leaf  *bptNode
+	pos   int
+	key   []byte
+	value int64
+}
+
+// Next は次のキーに進む。キーがなければ false を返す
+func (it *TreeIterator) Next() (bool, error) {
+	for it.leaf != nil {
+		if it.pos < len(it.leaf.keys) {
+			it.key = it.leaf.keys[it.pos]
+			it.value = it.leaf.values[it.pos]
+			it.pos++
+			return true, nil
+		}
+		if it.leaf.next == nilPageID {
+			it.leaf = nil
+			break
+		}
+		next, err := it.tree.readNode(it.leaf.next)
+		if err != nil {
+			return false, err
+		}
+		it.leaf = next
+		it.pos = 0
+	}
+	it.key = nil
+	return false, nil
+}
+
+// Key は現在のキーを返す
+func (it *TreeIterator) Key() []byte {
+	return it.key
+}
+
+// Value は現在の値を返す
+func (it *TreeIterator) Value() int64 {
+	return it.value
+}
@@ -0,0 +1,276 @@
+package index
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
+)
+
+// openTestTree は一時ファイル上に B+Tree を開く
+func openTestTree(t *testing.T, path string, pool *storage.BufferPool) *BPlusTree {
+	t.Helper()
+	pager, err := storage.NewPager(path)
+	if err != nil {
+		t.Fatalf("NewPager failed: %v", err)
+	}
+	tree, err := OpenBPlusTree(pager, pool)
+	if err != nil {
+		t.Fatalf("OpenBPlusTree failed: %v", err)
+	}
+	return tree
+}
+
+func newTestBufferPool() *storage.BufferPool {
+	return storage.NewBufferPool(16, storage.EvictionPolicyLRU)
+}
+
+// testKey は長さの異なる可変長キーを作る
+func testKey(i int) []byte {
+	return []byte(fmt.Sprintf("key-%06d-%s", i, bytes.Repeat([]byte("x"), i%50)))
+}
+
+// checkTree は木の構造を検査し、キーの数を返す
+// キーが昇順であること、区切りキーの範囲に収まること、すべてのリーフが同じ深さにあることを確かめる
+func checkTree(t *testing.T, tree *BPlusTree) int {
+	t.Helper()
+	leafDepth := -1
+	var walk func(id storage.PageID, low, high []byte, depth int) int
+	walk = func(id storage.PageID, low, high []byte, depth int) int {
+		n, err := tree.readNode(id)
+		if err != nil {
+			t.Fatalf("readNode(%d) failed: %v", id, err)
+		}
+		for i, key := range n.keys {
+			if i > 0 && bytes.Compare(n.keys[i-1], key) >= 0 {
+				t.Fatalf("page %d: keys are not sorted", id)
+			}
+			if (low != nil && bytes.Compare(key, low) < 0) || (high != nil && bytes.Compare(key, high) >= 0) {
+				t.Fatalf("page %d: key %q out of range", id, key)
+			}
+		}
+		if n.leaf {
+			if leafDepth < 0 {
+				leafDepth = depth
+			} else if leafDepth != depth {
+				t.Fatalf("leaves at different depths: %d and %d", leafDepth, depth)
+			}
+			return len(n.keys)
+		}
+		count := 0
+		for i, child := range n.children {
+			childLow, childHigh := low, high
+			if i > 0 {
+				childLow = n.keys[i-1]
+			}
+			if i < len(n.keys) {
+				childHigh = n.keys[i]
+			}
+			count += walk(child, childLow, childHigh, depth+1)
+		}
+		return count
+	}
+	return walk(tree.root, nil, nil, 0)
+}
+
+// collectKeys はイテレータで全キーを読む
+func collectKeys(t *testing.T, tree *BPlusTree, from []byte) [][]byte {
+	t.Helper()
+	it, err := tree.Seek(from)
+	if err != nil {
+		t.Fatalf("Seek failed: %v", err)
+	}
+	var keys [][]byte
+	for {
+		ok, err := it.Next()
+		if err != nil {
+			t.Fatalf("Next failed: %v", err)
+		}
+		if !ok {
+			return keys
+		}
+		keys = append(keys, it.Key())
+	}
+}
+
+func TestBPlusTree_InsertSplitsAndSeek(t *testing.T) {
+	tree := openTestTree(t, filepath.Join(t.TempDir(), "t.idx"), newTestBufferPool())
+	defer tree.Close()
+
+	const n = 3000
+	for _, i := range rand.New(rand.NewSource(1)).Perm(n) {
+		if err := tree.Insert(testKey(i), int64(i)); err != nil {
+			t.Fatalf("Insert(%d) failed: %v", i, err)
+		}
+	}
+	if got := checkTree(t, tree); got != n {
+		t.Fatalf("expected %d keys, got %d", n, got)
+	}
+	if root, _ := tree.readNode(tree.root); root.leaf {
+		t.Fatal("root should have split into an internal node")
+	}
+
+	for _, i := range []int{0, 1, 1500, n - 1} {
+		value, found, err := tree.Get(testKey(i))
+		if err != nil || !found || value != int64(i) {
+			t.Errorf("Get(%d) = %d, %v, %v", i, value, found, err)
+		}
+	}
+	if _, found, _ := tree.Get([]byte("missing")); found {
+		t.Error("expected missing key not to be found")
+	}
+	if err := tree.Insert(testKey(10), 99); !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("expected ErrDuplicateKey, got %v", err)
+	}
+
+	// 途中から昇順に読める（リーフのリンクをたどる）
+	keys := collectKeys(t, tree, testKey(2990))
+	if len(keys) != 10 || !bytes.Equal(keys[0], testKey(2990)) || !bytes.Equal(keys[9], testKey(2999)) {
+		t.Errorf("unexpected keys from Seek: %d keys", len(keys))
+	}
+	if keys := collectKeys(t, tree, nil); len(keys) != n {
+		t.Errorf("expected %d keys from the start, got %d", n, len(keys))
+	}
+}
+
+func TestBPlusTree_DeleteMergesAndReusesPages(t *testing.T) {
+	tree := openTestTree(t, filepath.Join(t.TempDir(), "t.idx"), newTestBufferPool())
+	defer tree.Close()
+
+	const n = 2000
+	for i := 0; i < n; i++ {
+		if err := tree.Insert(testKey(i), int64(i)); err != nil {
+			t.Fatalf("Insert(%d) failed: %v", i, err)
+		}
+	}
+	pagesAfterInsert := tree.pageCount
+
+	// 偶数を消すと半分になったノードが兄弟と再配分される
+	for i := 0; i < n; i += 2 {
+		found, err := tree.Delete(testKey(i))
+		if err != nil || !found {
+			t.Fatalf("Delete(%d) = %v, %v", i, found, err)
+		}
+	}
+	if got := checkTree(t, tree); got != n/2 {
+		t.Fatalf("expected %d keys, got %d", n/2, got)
+	}
+	if found, _ := tree.Delete(testKey(0)); found {
+		t.Error("expected second delete to report not found")
+	}
+
+	// 残りを消すとノードがマージされ、ルートはリーフに戻る
+	for i := 1; i < n; i += 2 {
+		if found, err := tree.Delete(testKey(i)); err != nil || !found {
+			t.Fatalf("Delete(%d) = %v, %v", i, found, err)
+		}
+	}
+	if got := checkTree(t, tree); got != 0 {
+		t.Fatalf("expected empty tree, got %d keys", got)
+	}
+	if root, _ := tree.readNode(tree.root); !root.leaf {
+		t.Error("root should collapse into a leaf")
+	}
+	if tree.freeHead == nilPageID {
+		t.Fatal("freed pages should be on the free list")
+	}
+
+	// 解放したページを再利用するのでファイルは大きくならない
+	for i := 0; i < n; i++ {
+		if err := tree.Insert(testKey(i), int64(i)); err != nil {
+			t.Fatalf("Insert(%d) failed: %v", i, err)
+		}
+	}
+	if tree.pageCount != pagesAfterInsert {
+		t.Errorf("expected page count %d after reinsert, got %d", pagesAfterInsert, tree.pageCount)
+	}
+	if got := checkTree(t, tree); got != n {
+		t.Fatalf("expected %d keys, got %d", n, got)
+	}
+}
+
+func TestBPlusTree_RandomOperations(t *testing.T) {
+	tree := openTestTree(t, filepath.Join(t.TempDir(), "t.idx"), newTestBufferPool())
+	defer tree.Close()
+
+	rng := rand.New(rand.NewSource(7))
+	expected := make(map[int]bool)
+	for step := 0; step < 8000; step++ {
+		i := rng.Intn(1500)
+		if rng.Intn(3) == 0 {
+			found, err := tree.Delete(testKey(i))
+			if err != nil || found != expected[i] {
+				t.Fatalf("step %d: Delete(%d) = %v, %v", step, i, found, err)
+			}
+			delete(expected, i)
+			continue
+		}
+		err := tree.Insert(testKey(i), int64(i))
+		if expected[i] != errors.Is(err, ErrDuplicateKey) {
+			t.Fatalf("step %d: Insert(%d) returned %v", step, i, err)
+		}
+		expected[i] = true
+	}
+	if got := checkTree(t, tree); got != len(expected) {
+		t.Fatalf("expected %d keys, got %d", len(expected), got)
+	}
+}
+
+func TestBPlusTree_ReopenAndCleanFlag(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "t.idx")
+	pool := newTestBufferPool()
+	tree := openTestTree(t, path, pool)
+	if tree.IsClean() {
+		t.Error("a new tree should not be clean until it is flushed")
+	}
+	for i := 0; i < 500; i++ {
+		tree.Insert(testKey(i), int64(i))
+	}
+	if err := tree.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	tree = openTestTree(t, path, pool)
+	if !tree.IsClean() {
+		t.Error("tree should be clean after Close")
+	}
+	if got := checkTree(t, tree); got != 500 {
+		t.Fatalf("expected 500 keys after reopen, got %d", got)
+	}
+	// 変更を始めるとディスク上は正常終了していない状態になる
+	if _, err := tree.Delete(testKey(0)); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := tree.Drop(); err != nil {
+		t.Fatalf("Drop failed: %v", err)
+	}
+
+	tree = openTestTree(t, path, pool)
+	defer tree.Close()
+	if tree.IsClean() {
+		t.Error("tree should not be clean after closing without flush")
+	}
+}
+
+func TestBPlusTree_KeyTooLarge(t *testing.T) {
+	tree := openTestTree(t, filepath.Join(t.TempDir(), "t.idx"), newTestBufferPool())
+	defer tree.Close()
+
+	if err := tree.Insert(make([]byte, MaxKeySize+1), 1); !errors.Is(err, ErrKeyTooLarge) {
+		t.Errorf("expected ErrKeyTooLarge, got %v", err)
+	}
+	// 上限ぎりぎりのキーでも分割できる
+	for i := 0; i < 50; i++ {
+		key := append(testKey(i), bytes.Repeat([]byte("y"), MaxKeySize-len(testKey(i)))...)
+		if err := tree.Insert(key, int64(i)); err != nil {
+			t.Fatalf("Insert(%d) failed: %v", i, err)
+		}
+	}
+	if got := checkTree(t, tree); got != 50 {
+		t.Fatalf("expected 50 keys, got %d", got)
+	}
+}
@@ -68,29 +68,54 @@ func (n *bTreeNode) findKeyIndex(key int64) int {
 }
 
 func (t *bTree) Search(key int64) (int64, bool) {
-	return t.root.search(key)
+	var value int64 = -1
+	found := false
+	t.Ascend(key, func(k, v int64) bool {
+		if k == key {
+			value, found = v, true
+		}
+		return false
+	})
+	return value, found
 }
 
-func (n *bTreeNode) search(key int64) (int64, bool) {
-	// キーの位置を二分探索で特定
-	i := n.findKeyIndex(key)
+// seekLeaf は key を含みうる最も左のリーフを返す
+// 重複キーは分割で左右のリーフにまたがることがあるため、区切りキーと等しい場合は左の子へ降りる
+func (t *bTree) seekLeaf(key int64) *bTreeNode {
+	n := t.root
+	for !n.isLeaf() {
+		n = n.children[n.findKeyIndex(key)]
+	}
+	return n
+}
 
-	if n.isLeaf() {
-		// キーが一致すれば値を返す
-		if i < n.keyCount() && n.keys[i] == key {
-			return n.values[i], true
+// Ascend は low 以上のキーを昇順に fn へ渡す。fn が false を返すと打ち切る
+func (t *bTree) Ascend(low int64, fn func(key, value int64) bool) {
+	for leaf := t.seekLeaf(low); leaf != nil; leaf = leaf.next {
+		for i := leaf.findKeyIndex(low); i < leaf.keyCount(); i++ {
+			if !fn(leaf.keys[i], leaf.values[i]) {
+				return
+			}
 		}
-		return -1, false
 	}
+}
 
-	// 内部ノードの場合
-	// B+Tree では内部ノードのキーは「右の子ツリーの最小値」を表す
-	// key < keys[i] なら children[i] へ
-	// key >= keys[i] なら children[i+1] へ
-	if i < n.keyCount() && key >= n.keys[i] {
-		return n.children[i+1].search(key)
+// Delete はキーと値の組を1つ削除する
+// 簡易実装: リーフから取り除くだけで、ノードの併合は行わない
+func (t *bTree) Delete(key int64, value int64) bool {
+	for leaf := t.seekLeaf(key); leaf != nil; leaf = leaf.next {
+		for i := leaf.findKeyIndex(key); i < leaf.keyCount(); i++ {
+			if leaf.keys[i] != key {
+				return false
+			}
+			if leaf.values[i] == value {
+				leaf.keys = append(leaf.keys[:i], leaf.keys[i+1:]...)
+				leaf.values = append(leaf.values[:i], leaf.values[i+1:]...)
+				return true
+			}
+		}
 	}
-	return n.children[i].search(key)
+	return false
 }
 
 func (t *bTree) Insert(key int64, value int64) {
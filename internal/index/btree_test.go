@@ -283,3 +283,74 @@ func TestBTree_LargeDataset(t *testing.T) {
 		t.Errorf("expected not to find key %d", n+1)
 	}
 }
+
+func TestBTree_DuplicateKeysAndDelete(t *testing.T) {
+	tree := NewBTree()
+
+	// 重複キーを分割が起きるだけ挿入
+	for i := int64(1); i <= 20; i++ {
+		tree.Insert(7, i)
+	}
+	tree.Insert(3, 100)
+	tree.Insert(9, 200)
+
+	count := 0
+	tree.Ascend(7, func(key, value int64) bool {
+		if key != 7 {
+			return false
+		}
+		count++
+		return true
+	})
+	if count != 20 {
+		t.Errorf("expected 20 entries for key 7, got %d", count)
+	}
+
+	// キーと値の組で削除する
+	if !tree.Delete(7, 15) {
+		t.Error("expected to delete (7, 15)")
+	}
+	if tree.Delete(7, 15) {
+		t.Error("expected (7, 15) to be already deleted")
+	}
+	if tree.Delete(8, 1) {
+		t.Error("expected not to delete missing key 8")
+	}
+	for i := int64(1); i <= 20; i++ {
+		if i != 15 {
+			tree.Delete(7, i)
+		}
+	}
+	if _, found := tree.Search(7); found {
+		t.Error("expected key 7 to be gone")
+	}
+	if value, found := tree.Search(9); !found || value != 200 {
+		t.Errorf("expected key 9 -> 200, got %d (found=%v)", value, found)
+	}
+}
+
+func TestBTree_Ascend(t *testing.T) {
+	tree := NewBTree()
+	for _, k := range []int64{50, 10, 40, 20, 30, 60, 5} {
+		tree.Insert(k, k*10)
+	}
+
+	var keys []int64
+	tree.Ascend(15, func(key, value int64) bool {
+		if key > 50 {
+			return false
+		}
+		keys = append(keys, key)
+		return true
+	})
+	expected := []int64{20, 30, 40, 50}
+	if len(keys) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, keys)
+	}
+	for i := range expected {
+		if keys[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected, keys)
+			break
+		}
+	}
+}
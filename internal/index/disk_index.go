@@ -0,0 +1,161 @@
+package index
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
+)
+
+var _ Index = (*DiskIndex)(nil)
+
+// DiskIndex はディスク上の B+Tree を使うインデックス
+// 非ユニークインデックスはキーの後ろに行IDを付けて、木の中でエントリを一意にする
+type DiskIndex struct {
+	name      string
+	indexType IndexType
+	columns   []int // キーにするカラムの位置（複合キーなら複数）
+	tree      *BPlusTree
+}
+
+// OpenDiskIndex は path のインデックスファイルを開く（なければ作成する）
+func OpenDiskIndex(path, name string, indexType IndexType, columns []int, pool *storage.BufferPool) (*DiskIndex, error) {
+	pager, err := storage.NewPager(path)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := OpenBPlusTree(pager, pool)
+	if err != nil {
+		pool.DiscardPager(pager)
+		pager.Close()
+		return nil, err
+	}
+	return &DiskIndex{name: name, indexType: indexType, columns: columns, tree: tree}, nil
+}
+
+func (i *DiskIndex) GetName() string {
+	return i.name
+}
+
+func (i *DiskIndex) GetIndexType() IndexType {
+	return i.indexType
+}
+
+func (i *DiskIndex) GetColumnIndexes() []int {
+	return i.columns
+}
+
+func (i *DiskIndex) IsUnique() bool {
+	return i.indexType == IndexTypePrimary || i.indexType == IndexTypeUnique
+}
+
+// IsClean は前回正常に閉じられたかどうかを返す
+// false の場合はテーブルとずれている可能性があるので作り直すこと
+func (i *DiskIndex) IsClean() bool {
+	return i.tree.IsClean()
+}
+
+// treeKey は木に格納するキーを作る
+func (i *DiskIndex) treeKey(key []storage.Value, rowID int64) ([]byte, error) {
+	encoded, err := EncodeKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if i.IsUnique() {
+		return encoded, nil
+	}
+	return appendRowID(encoded, rowID), nil
+}
+
+// Add はキーと行IDを追加する
+func (i *DiskIndex) Add(key []storage.Value, rowID int64) error {
+	k, err := i.treeKey(key, rowID)
+	if err != nil {
+		return err
+	}
+	if err := i.tree.Insert(k, rowID); err != nil {
+		if err == ErrDuplicateKey {
+			return fmt.Errorf("%w: %s %v", err, i.name, key)
+		}
+		return err
+	}
+	return nil
+}
+
+// Remove はキーと行IDの組を削除する
+func (i *DiskIndex) Remove(key []storage.Value, rowID int64) error {
+	k, err := i.treeKey(key, rowID)
+	if err != nil {
+		return err
+	}
+	if i.IsUnique() {
+		// ユニークインデックスは別の行が同じキーを持っていないか確認してから消す
+		value, found, err := i.tree.Get(k)
+		if err != nil {
+			return err
+		}
+		if !found || value != rowID {
+			return ErrKeyNotFound
+		}
+	}
+	found, err := i.tree.Delete(k)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrKeyNotFound
+	}
+	return nil
+}
+
+// Lookup は範囲に含まれるキーを持つ行IDをキーの昇順で返す
+// 範囲の値が複合キーの先頭カラムだけの場合は、その接頭辞で比較する
+func (i *DiskIndex) Lookup(r storage.KeyRange) ([]int64, error) {
+	var low, high []byte
+	var err error
+	if r.Low != nil {
+		if low, err = EncodeKey(r.Low); err != nil {
+			return nil, err
+		}
+	}
+	if r.High != nil {
+		if high, err = EncodeKey(r.High); err != nil {
+			return nil, err
+		}
+	}
+	it, err := i.tree.Seek(low)
+	if err != nil {
+		return nil, err
+	}
+	rowIDs := make([]int64, 0)
+	for {
+		ok, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return rowIDs, nil
+		}
+		key := it.Key()
+		if low != nil && !r.LowInclusive && bytes.HasPrefix(key, low) {
+			continue
+		}
+		if high != nil {
+			c := comparePrefix(key, high)
+			if c > 0 || (c == 0 && !r.HighInclusive) {
+				return rowIDs, nil
+			}
+		}
+		rowIDs = append(rowIDs, it.Value())
+	}
+}
+
+// Close はインデックスを書き出して閉じる
+func (i *DiskIndex) Close() error {
+	return i.tree.Close()
+}
+
+// Drop は書き出さずに閉じる（ファイルを削除する前に使う）
+func (i *DiskIndex) Drop() error {
+	return i.tree.Drop()
+}
@@ -0,0 +1,115 @@
+package index
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
+)
+
+func openTestDiskIndex(t *testing.T, indexType IndexType, columns ...int) *DiskIndex {
+	t.Helper()
+	idx, err := OpenDiskIndex(filepath.Join(t.TempDir(), "test.idx"), "test_idx", indexType, columns, newTestBufferPool())
+	if err != nil {
+		t.Fatalf("OpenDiskIndex failed: %v", err)
+	}
+	t.Cleanup(func() { idx.Close() })
+	return idx
+}
+
+func TestDiskIndex_UniqueKeys(t *testing.T) {
+	idx := openTestDiskIndex(t, IndexTypePrimary, 0)
+	for i, name := range []string{"carol", "alice", "bob"} {
+		if err := idx.Add([]storage.Value{storage.StringValue(name)}, int64(i+1)); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+	if err := idx.Add([]storage.Value{storage.StringValue("bob")}, 9); !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("expected ErrDuplicateKey, got %v", err)
+	}
+
+	rowIDs, err := idx.Lookup(storage.NewKeyRangeEqual(storage.StringValue("bob")))
+	if err != nil || len(rowIDs) != 1 || rowIDs[0] != 3 {
+		t.Errorf("expected [3], got %v (err=%v)", rowIDs, err)
+	}
+	// 別の行IDでは消せない
+	if err := idx.Remove([]storage.Value{storage.StringValue("bob")}, 9); err != ErrKeyNotFound {
+		t.Errorf("expected ErrKeyNotFound, got %v", err)
+	}
+	if err := idx.Remove([]storage.Value{storage.StringValue("bob")}, 3); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	rowIDs, _ = idx.Lookup(storage.KeyRange{})
+	if len(rowIDs) != 2 || rowIDs[0] != 2 || rowIDs[1] != 1 {
+		t.Errorf("expected [2 1] in key order, got %v", rowIDs)
+	}
+}
+
+func TestDiskIndex_RangeLookup(t *testing.T) {
+	idx := openTestDiskIndex(t, IndexTypeSecondary, 1)
+	for rowID, age := range []int32{30, 20, 30, 40, 10, -5} {
+		if err := idx.Add([]storage.Value{storage.Int32Value(age)}, int64(rowID+1)); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+	key := func(v int32) []storage.Value { return []storage.Value{storage.Int32Value(v)} }
+	tests := []struct {
+		name string
+		r    storage.KeyRange
+		want []int64
+	}{
+		{"equal", storage.NewKeyRangeEqual(storage.Int32Value(30)), []int64{1, 3}},
+		{"20 < age <= 40", storage.KeyRange{Low: key(20), High: key(40), HighInclusive: true}, []int64{1, 3, 4}},
+		{"age < 20", storage.KeyRange{High: key(20)}, []int64{6, 5}},
+		{"age >= 30", storage.KeyRange{Low: key(30), LowInclusive: true}, []int64{1, 3, 4}},
+		{"empty", storage.KeyRange{Low: key(41), LowInclusive: true}, []int64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rowIDs, err := idx.Lookup(tt.r)
+			if err != nil {
+				t.Fatalf("Lookup failed: %v", err)
+			}
+			if len(rowIDs) != len(tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, rowIDs)
+			}
+			for i := range rowIDs {
+				if rowIDs[i] != tt.want[i] {
+					t.Fatalf("expected %v, got %v", tt.want, rowIDs)
+				}
+			}
+		})
+	}
+}
+
+func TestDiskIndex_CompositePrefixLookup(t *testing.T) {
+	idx := openTestDiskIndex(t, IndexTypeUnique, 0, 1)
+	rows := []struct {
+		city string
+		age  int32
+	}{{"osaka", 30}, {"tokyo", 25}, {"tokyo", 40}, {"tokyo", 31}, {"tokyoto", 20}}
+	for i, r := range rows {
+		if err := idx.Add([]storage.Value{storage.StringValue(r.city), storage.Int32Value(r.age)}, int64(i+1)); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+	if got := idx.GetColumnIndexes(); len(got) != 2 || got[1] != 1 {
+		t.Errorf("unexpected column indexes: %v", got)
+	}
+
+	// 先頭カラムだけの等価検索は "tokyoto" を含まない
+	rowIDs, _ := idx.Lookup(storage.NewKeyRangeEqual(storage.StringValue("tokyo")))
+	if len(rowIDs) != 3 || rowIDs[0] != 2 || rowIDs[1] != 4 || rowIDs[2] != 3 {
+		t.Errorf("expected [2 4 3], got %v", rowIDs)
+	}
+	// city = 'tokyo' AND age > 30
+	rowIDs, _ = idx.Lookup(storage.KeyRange{
+		Low:           []storage.Value{storage.StringValue("tokyo"), storage.Int32Value(30)},
+		High:          []storage.Value{storage.StringValue("tokyo")},
+		HighInclusive: true,
+	})
+	if len(rowIDs) != 2 || rowIDs[0] != 4 || rowIDs[1] != 3 {
+		t.Errorf("expected [4 3], got %v", rowIDs)
+	}
+}
@@ -1,10 +1,17 @@
 package index
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
+)
 
 var (
-	ErrKeyNotFound  = errors.New("key not found")
-	ErrDuplicateKey = errors.New("duplicate key")
+	ErrKeyNotFound        = errors.New("key not found")
+	ErrDuplicateKey       = errors.New("duplicate key")
+	ErrUnsupportedKeyType = errors.New("unsupported index key type")
 )
 
 type IndexType uint8
@@ -17,7 +24,12 @@ const (
 
 var _ Index = (*index)(nil)
 
-type Index interface{}
+// Index はテーブルのインデックス
+// storage.TableIndex を満たすので storage.Table に登録して行の変更と同期させる
+type Index interface {
+	storage.TableIndex
+	GetIndexType() IndexType
+}
 
 type index struct {
 	name        string
@@ -64,3 +76,99 @@ func (i *index) GetIndexType() IndexType {
 func (i *index) GetColumnIndex() int {
 	return i.columnIndex
 }
+
+func (i *index) GetColumnIndexes() []int {
+	return []int{i.columnIndex}
+}
+
+func (i *index) IsUnique() bool {
+	return i.indexType == IndexTypePrimary || i.indexType == IndexTypeUnique
+}
+
+// Add はカラムの値をキーとして行IDを追加する
+func (i *index) Add(key []storage.Value, rowID int64) error {
+	k, err := toSingleKey(key)
+	if err != nil {
+		return err
+	}
+	if err := i.Insert(k, rowID); err != nil {
+		return fmt.Errorf("%w: %s (%v)", err, i.name, key)
+	}
+	return nil
+}
+
+// Remove はキーと行IDの組を削除する
+func (i *index) Remove(key []storage.Value, rowID int64) error {
+	k, err := toSingleKey(key)
+	if err != nil {
+		return err
+	}
+	if !i.tree.Delete(k, rowID) {
+		return ErrKeyNotFound
+	}
+	return nil
+}
+
+// Lookup は範囲に含まれるキーを持つ行IDをキーの昇順で返す
+func (i *index) Lookup(r storage.KeyRange) ([]int64, error) {
+	low, high := int64(math.MinInt64), int64(math.MaxInt64)
+	var err error
+	if r.Low != nil {
+		if low, err = toSingleKey(r.Low); err != nil {
+			return nil, err
+		}
+	}
+	if r.High != nil {
+		if high, err = toSingleKey(r.High); err != nil {
+			return nil, err
+		}
+	}
+	rowIDs := make([]int64, 0)
+	i.tree.Ascend(low, func(key, rowID int64) bool {
+		if r.Low != nil && !r.LowInclusive && key == low {
+			return true
+		}
+		if key > high || (r.High != nil && !r.HighInclusive && key == high) {
+			return false
+		}
+		rowIDs = append(rowIDs, rowID)
+		return true
+	})
+	return rowIDs, nil
+}
+
+// Close はメモリ上のインデックスなので何もしない
+func (i *index) Close() error {
+	return nil
+}
+
+// Drop はメモリ上のインデックスなので何もしない
+func (i *index) Drop() error {
+	return nil
+}
+
+// toSingleKey は単一カラムのキーを B+Tree のキーに変換する
+// メモリ上のインデックスは int64 のキーしか扱えないため、整数と真偽値の単一カラムに限られる
+func toSingleKey(key []storage.Value) (int64, error) {
+	if len(key) != 1 {
+		return 0, fmt.Errorf("%w: %d columns", ErrUnsupportedKeyType, len(key))
+	}
+	return toKey(key[0])
+}
+
+// toKey はカラムの値を B+Tree のキーに変換する
+func toKey(value storage.Value) (int64, error) {
+	switch v := value.(type) {
+	case storage.Int32Value:
+		return int64(v), nil
+	case storage.Int64Value:
+		return int64(v), nil
+	case storage.BoolValue:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("%w: %T", ErrUnsupportedKeyType, value)
+	}
+}
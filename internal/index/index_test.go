@@ -1,7 +1,10 @@
 package index
 
 import (
+	"errors"
 	"testing"
+
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
 )
 
 func TestNewIndex(t *testing.T) {
@@ -227,3 +230,64 @@ func TestIndex_LargeDataset(t *testing.T) {
 		t.Errorf("expected ErrKeyNotFound, got %v", err)
 	}
 }
+
+func TestIndex_AddRemoveLookup(t *testing.T) {
+	idx := NewIndex("age_idx", IndexTypeSecondary, 1)
+
+	for rowID, age := range []int32{30, 20, 30, 40, 10} {
+		if err := idx.Add([]storage.Value{storage.Int32Value(age)}, int64(rowID+1)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	rowIDs, err := idx.Lookup(storage.NewKeyRangeEqual(storage.Int32Value(30)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rowIDs) != 2 {
+		t.Errorf("expected 2 rows for age=30, got %v", rowIDs)
+	}
+
+	// 20 < age <= 40
+	rowIDs, _ = idx.Lookup(storage.KeyRange{
+		Low:           []storage.Value{storage.Int32Value(20)},
+		High:          []storage.Value{storage.Int32Value(40)},
+		HighInclusive: true,
+	})
+	if len(rowIDs) != 3 || rowIDs[2] != 4 {
+		t.Errorf("expected 3 rows ending with rowID 4, got %v", rowIDs)
+	}
+
+	// age < 30（下限なし）
+	rowIDs, _ = idx.Lookup(storage.KeyRange{High: []storage.Value{storage.Int32Value(30)}})
+	if len(rowIDs) != 2 || rowIDs[0] != 5 {
+		t.Errorf("expected rowIDs [5 2], got %v", rowIDs)
+	}
+
+	if err := idx.Remove([]storage.Value{storage.Int32Value(30)}, 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := idx.Remove([]storage.Value{storage.Int32Value(30)}, 1); err != ErrKeyNotFound {
+		t.Errorf("expected ErrKeyNotFound, got %v", err)
+	}
+	rowIDs, _ = idx.Lookup(storage.NewKeyRangeEqual(storage.Int32Value(30)))
+	if len(rowIDs) != 1 || rowIDs[0] != 3 {
+		t.Errorf("expected [3], got %v", rowIDs)
+	}
+}
+
+func TestIndex_AddUniqueAndUnsupportedKey(t *testing.T) {
+	idx := NewIndex("users_pkey", IndexTypePrimary, 0)
+	if !idx.IsUnique() {
+		t.Error("primary index should be unique")
+	}
+	if err := idx.Add([]storage.Value{storage.Int64Value(1)}, 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := idx.Add([]storage.Value{storage.Int64Value(1)}, 2); !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("expected ErrDuplicateKey, got %v", err)
+	}
+	if err := idx.Add([]storage.Value{storage.StringValue("a")}, 3); !errors.Is(err, ErrUnsupportedKeyType) {
+		t.Errorf("expected ErrUnsupportedKeyType, got %v", err)
+	}
+}
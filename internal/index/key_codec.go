@@ -0,0 +1,141 @@
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
+)
+
+// キーの各値の先頭に付けるタグ（NULL は値より前に並ぶ）
+const (
+	keyTagNull  byte = 0x00
+	keyTagValue byte = 0x01
+)
+
+// EncodeKey はカラムの値（複合キーなら複数）をバイト列に符号化する
+// 符号化したキー同士を bytes.Compare で比べると、カラム型に従って値を比べた順序と一致する
+// 各値の符号は自己終端するので、先頭のカラムだけを符号化したものは複合キーの接頭辞になる
+func EncodeKey(values []storage.Value) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, value := range values {
+		if value == nil {
+			buf.WriteByte(keyTagNull)
+			continue
+		}
+		buf.WriteByte(keyTagValue)
+		switch v := value.(type) {
+		case storage.Int32Value:
+			// 符号ビットを反転すると負数が正数より前に並ぶ
+			var b [4]byte
+			binary.BigEndian.PutUint32(b[:], uint32(v)^(1<<31))
+			buf.Write(b[:])
+		case storage.Int64Value:
+			writeInt64Key(&buf, int64(v))
+		case storage.Float32Value:
+			writeFloatKey(&buf, float64(v))
+		case storage.Float64Value:
+			writeFloatKey(&buf, float64(v))
+		case storage.DecimalValue:
+			// 同じカラムの値はスケールがそろっているので、スケールを除いた値を比べればよい
+			writeInt64Key(&buf, v.Unscaled)
+		case storage.DateValue:
+			var b [4]byte
+			binary.BigEndian.PutUint32(b[:], uint32(v)^(1<<31))
+			buf.Write(b[:])
+		case storage.TimeValue:
+			writeInt64Key(&buf, int64(v))
+		case storage.TimestampValue:
+			writeInt64Key(&buf, int64(v))
+		case storage.BoolValue:
+			if v {
+				buf.WriteByte(1)
+			} else {
+				buf.WriteByte(0)
+			}
+		case storage.StringValue:
+			// 0x00 を 0x00 0xFF にエスケープし、0x00 0x01 で終端する
+			// 終端が値のどのバイトよりも小さいので、短い文字列が前に並ぶ
+			for i := 0; i < len(v); i++ {
+				buf.WriteByte(v[i])
+				if v[i] == 0x00 {
+					buf.WriteByte(0xFF)
+				}
+			}
+			buf.Write([]byte{0x00, 0x01})
+		default:
+			return nil, fmt.Errorf("%w: %T", ErrUnsupportedKeyType, value)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func writeInt64Key(buf *bytes.Buffer, v int64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(v)^(1<<63))
+	buf.Write(b[:])
+}
+
+// writeFloatKey は浮動小数点数を大小の順に並ぶバイト列にする
+// 正の数は符号ビットを立て、負の数は全ビットを反転する（-0 は 0 にそろえる）
+func writeFloatKey(buf *bytes.Buffer, f float64) {
+	if f == 0 {
+		f = 0
+	}
+	bits := math.Float64bits(f)
+	if bits&(1<<63) != 0 {
+		bits = ^bits
+	} else {
+		bits |= 1 << 63
+	}
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], bits)
+	buf.Write(b[:])
+}
+
+// appendRowID は非ユニークインデックスのキーに行IDを付けて、木の中でキーを一意にする
+func appendRowID(key []byte, rowID int64) []byte {
+	out := make([]byte, len(key)+8)
+	copy(out, key)
+	binary.BigEndian.PutUint64(out[len(key):], uint64(rowID)^(1<<63))
+	return out
+}
+
+// comparePrefix は key の先頭 len(prefix) バイトと prefix を比較する
+// 複合キーの先頭カラムだけを指定した範囲検索で使う
+func comparePrefix(key, prefix []byte) int {
+	if len(key) > len(prefix) {
+		key = key[:len(prefix)]
+	}
+	return bytes.Compare(key, prefix)
+}
+
+// KeyRangeContains はキーが範囲に含まれるかどうかを返す
+// Lookup と同じく、範囲の値が複合キーの先頭カラムだけの場合はその接頭辞で比較する
+func KeyRangeContains(r storage.KeyRange, key []storage.Value) (bool, error) {
+	encoded, err := EncodeKey(key)
+	if err != nil {
+		return false, err
+	}
+	if r.Low != nil {
+		low, err := EncodeKey(r.Low)
+		if err != nil {
+			return false, err
+		}
+		if c := comparePrefix(encoded, low); c < 0 || (c == 0 && !r.LowInclusive) {
+			return false, nil
+		}
+	}
+	if r.High != nil {
+		high, err := EncodeKey(r.High)
+		if err != nil {
+			return false, err
+		}
+		if c := comparePrefix(encoded, high); c > 0 || (c == 0 && !r.HighInclusive) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,114 @@
+package index
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
+)
+
+func mustEncodeKey(t *testing.T, values ...storage.Value) []byte {
+	t.Helper()
+	key, err := EncodeKey(values)
+	if err != nil {
+		t.Fatalf("EncodeKey failed: %v", err)
+	}
+	return key
+}
+
+func TestEncodeKey_Ordering(t *testing.T) {
+	// 各グループは昇順に並んでいる
+	groups := [][][]storage.Value{
+		{{nil}, {storage.Int32Value(-100)}, {storage.Int32Value(-1)}, {storage.Int32Value(0)}, {storage.Int32Value(7)}, {storage.Int32Value(1 << 30)}},
+		{{storage.Int64Value(-1 << 40)}, {storage.Int64Value(-1)}, {storage.Int64Value(1)}, {storage.Int64Value(1 << 40)}},
+		{{storage.BoolValue(false)}, {storage.BoolValue(true)}},
+		{{storage.Float64Value(-1e300)}, {storage.Float64Value(-0.5)}, {storage.Float64Value(0)}, {storage.Float64Value(1e-300)}, {storage.Float64Value(2.5)}},
+		{{storage.Float32Value(-3)}, {storage.Float32Value(-0.25)}, {storage.Float32Value(0.25)}},
+		{{storage.NewDecimal(-1050, 2)}, {storage.NewDecimal(-1, 2)}, {storage.NewDecimal(0, 2)}, {storage.NewDecimal(199, 2)}},
+		{{storage.DateValue(-1)}, {storage.DateValue(0)}, {storage.DateValue(19782)}},
+		{{storage.TimestampValue(-1)}, {storage.TimestampValue(0)}, {storage.TimestampValue(1 << 50)}},
+		{{nil}, {storage.StringValue("")}, {storage.StringValue("a")}, {storage.StringValue("a\x00")}, {storage.StringValue("a\x00b")}, {storage.StringValue("ab")}, {storage.StringValue("b")}},
+		{
+			{storage.StringValue("a"), storage.Int32Value(5)},
+			{storage.StringValue("a"), storage.Int32Value(10)},
+			{storage.StringValue("ab"), nil},
+			{storage.StringValue("ab"), storage.Int32Value(-1)},
+			{storage.StringValue("b"), storage.Int32Value(0)},
+		},
+	}
+	for g, group := range groups {
+		for i := 1; i < len(group); i++ {
+			prev, cur := mustEncodeKey(t, group[i-1]...), mustEncodeKey(t, group[i]...)
+			if bytes.Compare(prev, cur) >= 0 {
+				t.Errorf("group %d: %v should sort before %v", g, group[i-1], group[i])
+			}
+		}
+	}
+}
+
+func TestEncodeKey_NegativeZero(t *testing.T) {
+	// -0 と 0 は同じキーになる
+	if !bytes.Equal(mustEncodeKey(t, storage.Float64Value(math.Copysign(0, -1))), mustEncodeKey(t, storage.Float64Value(0))) {
+		t.Error("-0 and 0 should encode to the same key")
+	}
+}
+
+func TestEncodeKey_Prefix(t *testing.T) {
+	prefix := mustEncodeKey(t, storage.StringValue("a"))
+	if comparePrefix(mustEncodeKey(t, storage.StringValue("a"), storage.Int32Value(1)), prefix) != 0 {
+		t.Error("composite key should match its first column")
+	}
+	// "ab" は "a" で始まるが、終端があるので接頭辞にはならない
+	if comparePrefix(mustEncodeKey(t, storage.StringValue("ab"), storage.Int32Value(1)), prefix) <= 0 {
+		t.Error(`"ab" should sort after the "a" prefix`)
+	}
+	if _, err := EncodeKey([]storage.Value{storage.Int32Value(1), nil}); err != nil {
+		t.Errorf("unexpected error for NULL column: %v", err)
+	}
+}
+
+func TestEncodeKey_RowIDSuffix(t *testing.T) {
+	base := mustEncodeKey(t, storage.Int32Value(3))
+	a, b := appendRowID(base, -1), appendRowID(base, 2)
+	if bytes.Compare(a, b) >= 0 || !bytes.HasPrefix(a, base) {
+		t.Error("row IDs should keep duplicate keys in row ID order")
+	}
+	if _, err := EncodeKey([]storage.Value{unsupportedValue{}}); !errors.Is(err, ErrUnsupportedKeyType) {
+		t.Errorf("expected ErrUnsupportedKeyType, got %v", err)
+	}
+}
+
+// unsupportedValue はキーにできない値
+type unsupportedValue struct{}
+
+func (unsupportedValue) Type() storage.ColumnType { return storage.ColumnTypeFloat64 }
+func (unsupportedValue) Size() int                { return 0 }
+func (unsupportedValue) Encode() []byte           { return nil }
+
+func TestKeyRangeContains(t *testing.T) {
+	key := []storage.Value{storage.Int32Value(5), storage.StringValue("x")}
+	tests := []struct {
+		name string
+		r    storage.KeyRange
+		want bool
+	}{
+		{"equal prefix", storage.NewKeyRangeEqual(storage.Int32Value(5)), true},
+		{"other value", storage.NewKeyRangeEqual(storage.Int32Value(4)), false},
+		{"exclusive low", storage.KeyRange{Low: []storage.Value{storage.Int32Value(5)}}, false},
+		{"inclusive low", storage.KeyRange{Low: []storage.Value{storage.Int32Value(5)}, LowInclusive: true}, true},
+		{"exclusive high", storage.KeyRange{High: []storage.Value{storage.Int32Value(5)}}, false},
+		{"open high", storage.KeyRange{High: []storage.Value{storage.Int32Value(6)}}, true},
+		{"unbounded", storage.KeyRange{}, true},
+	}
+	for _, tt := range tests {
+		got, err := KeyRangeContains(tt.r, key)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
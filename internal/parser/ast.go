@@ -15,26 +15,34 @@ type Expression interface {
 
 // SelectStatement はSELECT文を表す
 type SelectStatement struct {
-	Columns []Expression    // 選択するカラム
-	From    string          // テーブル名
-	Join    *Join           // 結合条件
-	Where   Expression      // 条件
-	GroupBy []string        // GROUP BY 句
-	OrderBy []OrderByClause // ソート条件
-	Limit   *int            // 最大行数
-	Offset  *int            // オフセット
-}
-
-// Join は結合条件を表す
+	Distinct bool             // SELECT DISTINCT かどうか
+	Columns  []Expression     // 選択するカラム
+	From     string           // テーブル名（派生テーブルの場合はその別名）
+	Alias    string           // FROM のテーブルの別名（なければ空）
+	Subquery *SelectStatement // FROM 句のサブクエリ（派生テーブル、テーブルなら nil）
+	Joins    []*Join          // 結合するテーブル（書いた順に結合する）
+	Where    Expression       // 条件
+	GroupBy  []string         // GROUP BY 句
+	OrderBy  []OrderByClause  // ソート条件
+	Limit    *int             // 最大行数
+	Offset   *int             // オフセット
+}
+
+// Join は結合するテーブルと結合条件を表す
 type Join struct {
-	Table string     // 結合するテーブル名
-	On    Expression // 結合条件
+	Type     string           // INNER, LEFT, RIGHT, FULL, CROSS
+	Table    string           // 結合するテーブル名（派生テーブルの場合はその別名）
+	Alias    string           // テーブルの別名（なければ空）
+	Subquery *SelectStatement // 派生テーブル（テーブルなら nil）
+	On       Expression       // ON の結合条件（USING と CROSS JOIN では nil）
+	Using    []string         // USING (カラム, ...) のカラム
 }
 
 // OrderByClause はソート条件を表す
 type OrderByClause struct {
-	Column string // ソートするカラム
-	Asc    bool   // 昇順か降順か
+	Column     string     // ソートするカラム（カラム名でなければ空）
+	Expression Expression // ソートする式（カラム、式、SELECT 列の番号）
+	Asc        bool       // 昇順か降順か
 }
 
 // InsertStatement はINSERT文を表す
@@ -71,11 +79,29 @@ type ColumnDefinition struct {
 	Nullable   bool   // NULLかどうか
 }
 
+// CreateIndexStatement はCREATE INDEX文を表す
+type CreateIndexStatement struct {
+	IndexName string   // インデックス名
+	TableName string   // テーブル名
+	Columns   []string // カラム名（複合インデックスなら複数）
+	Unique    bool     // UNIQUE かどうか
+}
+
+// DropIndexStatement はDROP INDEX文を表す
+type DropIndexStatement struct {
+	IndexName string // インデックス名
+}
+
 // ExplainStatement はEXPLAIN文を表す
 type ExplainStatement struct {
 	Statement Statement // 説明する文
 }
 
+// AnalyzeStatement はANALYZE文を表す
+type AnalyzeStatement struct {
+	TableName string // 統計情報を集めるテーブル名（全テーブルなら空）
+}
+
 // Identifier はカラム名やテーブル名
 type Identifier struct {
 	Value string // 値
@@ -97,6 +123,22 @@ type IntegerLiteral struct {
 	Value int // 値
 }
 
+// FloatLiteral は小数点や指数を含む数値リテラルを表す
+// 精度を落とさないように、字句のまま保持する
+type FloatLiteral struct {
+	Value string // 値（"1.50" や "2e10"）
+}
+
+// TypedLiteral は型名を前に付けた文字列リテラルを表す（DATE '2024-01-31' など）
+type TypedLiteral struct {
+	Type  string // 型名（DATE, TIME, TIMESTAMP）
+	Value string // 値
+}
+
+// NullLiteral は NULL を表す
+type NullLiteral struct {
+}
+
 // BooleanLiteral は真偽リテラルを表す
 type BooleanLiteral struct {
 	Value bool // 値
@@ -109,6 +151,70 @@ type BinaryExpression struct {
 	Right    Expression // 右辺
 }
 
+// UnaryExpression は単項演算子を表す（-price や NOT active など）
+type UnaryExpression struct {
+	Operator string     // 演算子
+	Operand  Expression // 被演算子
+}
+
+// FunctionCall はスカラー関数の呼び出しを表す（UPPER(name) など）
+type FunctionCall struct {
+	Name      string       // 関数名（大文字）
+	Arguments []Expression // 引数
+}
+
+// CastExpression は CAST(x AS type) を表す
+type CastExpression struct {
+	Expression Expression // 変換する式
+	Type       string     // 変換先の型（CREATE TABLE のカラム型と同じ表記）
+}
+
+// AliasedExpression は SELECT 列の AS エイリアスを表す
+type AliasedExpression struct {
+	Expression Expression // 式
+	Alias      string     // エイリアス
+}
+
+// LikeExpression は [NOT] LIKE を表す
+type LikeExpression struct {
+	Expression Expression // 調べる式
+	Pattern    Expression // パターン（% は任意の文字列、_ は任意の1文字）
+	Escape     Expression // ESCAPE の文字（省略時は nil）
+	Not        bool       // NOT LIKE かどうか
+}
+
+// InExpression は [NOT] IN (値のリスト) または [NOT] IN (SELECT ...) を表す
+type InExpression struct {
+	Expression Expression       // 調べる式
+	List       []Expression     // 値のリスト
+	Subquery   *SelectStatement // IN (SELECT ...) のサブクエリ（値のリストなら nil）
+	Not        bool             // NOT IN かどうか
+}
+
+// SubqueryExpression は式の中の (SELECT ...) を表す（1行1列の値になる）
+type SubqueryExpression struct {
+	Select *SelectStatement
+}
+
+// ExistsExpression は EXISTS (SELECT ...) を表す（NOT EXISTS は NOT の UnaryExpression で包む）
+type ExistsExpression struct {
+	Subquery *SelectStatement
+}
+
+// BetweenExpression は [NOT] BETWEEN low AND high を表す
+type BetweenExpression struct {
+	Expression Expression // 調べる式
+	Low        Expression // 下限（含む）
+	High       Expression // 上限（含む）
+	Not        bool       // NOT BETWEEN かどうか
+}
+
+// IsNullExpression は IS NULL / IS NOT NULL を表す
+type IsNullExpression struct {
+	Expression Expression // 調べる式
+	Not        bool       // IS NOT NULL かどうか
+}
+
 // Asterisk は*を表す
 type Asterisk struct {
 }
@@ -121,6 +227,12 @@ type AggregateFunction struct {
 
 // BeginStatement はBEGIN文を表す
 type BeginStatement struct {
+	IsolationLevel string // ISOLATION LEVEL の指定（"READ COMMITTED" など。省略時は空）
+}
+
+// SetTransactionStatement はSET TRANSACTION ISOLATION LEVEL文を表す
+type SetTransactionStatement struct {
+	IsolationLevel string // "READ COMMITTED", "REPEATABLE READ", "SERIALIZABLE" など
 }
 
 // CommitStatement はCOMMIT文を表す
@@ -129,4 +241,15 @@ type CommitStatement struct {
 
 // RollbackStatement はROLLBACK文を表す
 type RollbackStatement struct {
+	Savepoint string // ROLLBACK TO SAVEPOINT の戻り先（トランザクション全体を取り消すなら空）
+}
+
+// SavepointStatement はSAVEPOINT文を表す
+type SavepointStatement struct {
+	Name string
+}
+
+// ReleaseSavepointStatement はRELEASE SAVEPOINT文を表す
+type ReleaseSavepointStatement struct {
+	Name string
 }
@@ -55,11 +55,23 @@ func (l *lexer) nextToken() *token {
 		tok = newToken(TOKEN_ASTERISK, string(l.ch))
 	case '.':
 		tok = newToken(TOKEN_DOT, string(l.ch))
+	case '+':
+		tok = newToken(TOKEN_PLUS, string(l.ch))
+	case '-':
+		tok = newToken(TOKEN_MINUS, string(l.ch))
+	case '/':
+		tok = newToken(TOKEN_SLASH, string(l.ch))
+	case '%':
+		tok = newToken(TOKEN_PERCENT, string(l.ch))
 	case '<':
 		if l.peekChar() == '=' {
 			ch := l.ch
 			l.readChar()
 			tok = newToken(TOKEN_LTE, string(ch)+string(l.ch))
+		} else if l.peekChar() == '>' {
+			ch := l.ch
+			l.readChar()
+			tok = newToken(TOKEN_NEQ, string(ch)+string(l.ch))
 		} else {
 			tok = newToken(TOKEN_LT, string(l.ch))
 		}
@@ -90,8 +102,7 @@ func (l *lexer) nextToken() *token {
 			tok.tokenType = LookupIdent(tok.literal)
 			return &tok
 		} else if isDigit(l.ch) {
-			tok.tokenType = TOKEN_INT
-			tok.literal = l.readNumber()
+			tok.literal, tok.tokenType = l.readNumber()
 			return &tok
 		} else {
 			tok = newToken(TOKEN_ILLEGAL, string(l.ch))
@@ -119,12 +130,38 @@ func (l *lexer) readIdentifier() string {
 }
 
 // readNumber は数字を読み込む
-func (l *lexer) readNumber() string {
+// 小数点か指数（1.5, 2e10, 3.0E-4）があれば TOKEN_FLOAT、なければ TOKEN_INT を返す
+func (l *lexer) readNumber() (string, TokenType) {
 	position := l.position
+	tokenType := TOKEN_INT
+	l.readDigits()
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tokenType = TOKEN_FLOAT
+		l.readChar() // . をスキップ
+		l.readDigits()
+	}
+	if l.ch == 'e' || l.ch == 'E' {
+		exponent := l.readPosition
+		if exponent < len(l.input) && (l.input[exponent] == '+' || l.input[exponent] == '-') {
+			exponent++
+		}
+		if exponent < len(l.input) && isDigit(l.input[exponent]) {
+			tokenType = TOKEN_FLOAT
+			for l.readPosition < exponent {
+				l.readChar() // e と符号をスキップ
+			}
+			l.readChar()
+			l.readDigits()
+		}
+	}
+	return l.input[position:l.position], tokenType
+}
+
+// readDigits は数字が続く間読み進める
+func (l *lexer) readDigits() {
 	for isDigit(l.ch) {
 		l.readChar()
 	}
-	return l.input[position:l.position]
 }
 
 // readString は文字列を読み込む
@@ -218,7 +218,7 @@ func TestLexer_CreateTable(t *testing.T) {
 }
 
 func TestLexer_Operators(t *testing.T) {
-	input := "= != < > <= >="
+	input := "= != < > <= >= <>"
 
 	tests := []struct {
 		expectedType    TokenType
@@ -230,6 +230,7 @@ func TestLexer_Operators(t *testing.T) {
 		{TOKEN_GT, ">"},
 		{TOKEN_LTE, "<="},
 		{TOKEN_GTE, ">="},
+		{TOKEN_NEQ, "<>"},
 		{TOKEN_EOF, ""},
 	}
 
@@ -305,6 +306,38 @@ func TestLexer_Numbers(t *testing.T) {
 	}
 }
 
+func TestLexer_FloatNumbers(t *testing.T) {
+	input := "1.5 2e10 3.0E-4 7. t.id 4e"
+
+	tests := []struct {
+		expectedType    TokenType
+		expectedLiteral string
+	}{
+		{TOKEN_FLOAT, "1.5"},
+		{TOKEN_FLOAT, "2e10"},
+		{TOKEN_FLOAT, "3.0E-4"},
+		{TOKEN_INT, "7"},
+		{TOKEN_DOT, "."},
+		{TOKEN_IDENT, "t"},
+		{TOKEN_DOT, "."},
+		{TOKEN_IDENT, "id"},
+		{TOKEN_INT, "4"},
+		{TOKEN_IDENT, "e"},
+		{TOKEN_EOF, ""},
+	}
+
+	lexer := NewLexer(input)
+
+	for i, tt := range tests {
+		tok := lexer.nextToken()
+
+		if tok.tokenType != tt.expectedType || tok.literal != tt.expectedLiteral {
+			t.Errorf("tests[%d] - expected=%v %q, got=%v %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.tokenType, tok.literal)
+		}
+	}
+}
+
 func TestLexer_OrderByLimit(t *testing.T) {
 	input := "SELECT * FROM users ORDER BY name DESC LIMIT 10"
 
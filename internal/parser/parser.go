@@ -74,15 +74,28 @@ func (p *parser) Parse() (Statement, error) {
 	case TOKEN_DELETE:
 		return p.parseDeleteStatement()
 	case TOKEN_CREATE:
+		if p.peekTokenIs(TOKEN_INDEX) || p.peekTokenIs(TOKEN_UNIQUE) {
+			return p.parseCreateIndexStatement()
+		}
 		return p.parseCreateTableStatement()
+	case TOKEN_DROP:
+		return p.parseDropStatement()
 	case TOKEN_EXPLAIN:
 		return p.parseExplainStatement()
+	case TOKEN_ANALYZE:
+		return p.parseAnalyzeStatement()
 	case TOKEN_BEGIN:
 		return p.parseBeginStatement()
 	case TOKEN_COMMIT:
 		return p.parseCommitStatement()
 	case TOKEN_ROLLBACK:
 		return p.parseRollbackStatement()
+	case TOKEN_SET:
+		return p.parseSetTransactionStatement()
+	case TOKEN_SAVEPOINT:
+		return p.parseSavepointStatement()
+	case TOKEN_RELEASE:
+		return p.parseReleaseSavepointStatement()
 	default:
 		return nil, fmt.Errorf("unexpected token: %d", p.currentToken.tokenType)
 	}
@@ -92,6 +105,11 @@ func (p *parser) parseSelectStatement() (*SelectStatement, error) {
 	stmt := &SelectStatement{}
 	// SELECT の次へ進む
 	p.nextToken()
+	// DISTINCT（オプション）
+	if p.currentTokenIs(TOKEN_DISTINCT) {
+		stmt.Distinct = true
+		p.nextToken()
+	}
 	// カラムリストをパース
 	columns, err := p.parseSelectColumns()
 	if err != nil {
@@ -102,27 +120,21 @@ func (p *parser) parseSelectStatement() (*SelectStatement, error) {
 	if !p.expectPeek(TOKEN_FROM) {
 		return nil, fmt.Errorf("expected FROM token")
 	}
-	// テーブル名をパース
-	if !p.expectPeek(TOKEN_IDENT) {
-		return nil, fmt.Errorf("expected table name")
+	// テーブル名 [AS 別名] か (SELECT ...) AS 別名 をパース
+	stmt.From, stmt.Alias, stmt.Subquery, err = p.parseTableReference()
+	if err != nil {
+		return nil, err
 	}
-	stmt.From = p.currentToken.literal
-	// JOIN を期待
-	if p.peekTokenIs(TOKEN_JOIN) {
-		p.nextToken() // JOIN へ
-		p.nextToken() // テーブル名へ
-		joinTable := p.currentToken.literal
-		// ON を期待
-		if !p.expectPeek(TOKEN_ON) {
-			return nil, fmt.Errorf("expected ON token")
-		}
-		p.nextToken() // ON へ
-		// 条件式をパース
-		joinOn, err := p.parseExpression()
+	// JOIN（いくつでも続けられる）
+	for {
+		join, err := p.parseJoin()
 		if err != nil {
 			return nil, err
 		}
-		stmt.Join = &Join{Table: joinTable, On: joinOn}
+		if join == nil {
+			break
+		}
+		stmt.Joins = append(stmt.Joins, join)
 	}
 	// Where句をパース
 	if p.peekTokenIs(TOKEN_WHERE) {
@@ -156,16 +168,34 @@ func (p *parser) parseSelectStatement() (*SelectStatement, error) {
 		}
 	}
 
-	// LIMIT（オプション）
+	// LIMIT と OFFSET（オプション）
 	if p.peekTokenIs(TOKEN_LIMIT) {
-		p.nextToken()
-		p.nextToken()
-		limit, _ := strconv.Atoi(p.currentToken.literal)
-		stmt.Limit = &limit
+		p.nextToken() // LIMIT へ
+		if stmt.Limit, err = p.parseRowCount("LIMIT"); err != nil {
+			return nil, err
+		}
+	}
+	if p.peekTokenIs(TOKEN_OFFSET) {
+		p.nextToken() // OFFSET へ
+		if stmt.Offset, err = p.parseRowCount("OFFSET"); err != nil {
+			return nil, err
+		}
 	}
 	return stmt, nil
 }
 
+// parseRowCount は LIMIT や OFFSET の後の行数をパースする
+func (p *parser) parseRowCount(clause string) (*int, error) {
+	if !p.expectPeek(TOKEN_INT) {
+		return nil, fmt.Errorf("expected row count after %s", clause)
+	}
+	n, err := strconv.Atoi(p.currentToken.literal)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", clause, p.currentToken.literal)
+	}
+	return &n, nil
+}
+
 func (p *parser) parseSelectColumns() ([]Expression, error) {
 	columns := []Expression{}
 	// カラムリストをパース
@@ -173,41 +203,67 @@ func (p *parser) parseSelectColumns() ([]Expression, error) {
 	if p.currentTokenIs(TOKEN_ASTERISK) {
 		return []Expression{&Asterisk{}}, nil
 	}
-	// カラム名のリスト
+	// 式のリスト（カラム名、集約関数、price * qty AS total など）
 	for {
-		// 集約関数の場合
-		if p.isAggregateFunctionToken() {
-			aggFunc, err := p.parseAggregateFunction()
-			if err != nil {
-				return nil, err
+		expr, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		// AS エイリアス（AS は省略できる）
+		if p.peekTokenIs(TOKEN_AS) {
+			p.nextToken() // AS へ
+			if !p.expectPeek(TOKEN_IDENT) {
+				return nil, fmt.Errorf("expected alias after AS")
 			}
-			columns = append(columns, aggFunc)
-		} else if p.currentTokenIs(TOKEN_IDENT) {
-			columns = append(columns, &Identifier{Value: p.currentToken.literal})
-		} else {
-			return nil, fmt.Errorf("expected column name or aggregate function")
+			expr = &AliasedExpression{Expression: expr, Alias: p.currentToken.literal}
+		} else if p.peekTokenIs(TOKEN_IDENT) {
+			p.nextToken() // エイリアスへ
+			expr = &AliasedExpression{Expression: expr, Alias: p.currentToken.literal}
 		}
+		columns = append(columns, expr)
 		if !p.peekTokenIs(TOKEN_COMMA) {
 			break
 		}
 		p.nextToken() // COMMA へ
-		p.nextToken() // 次のカラム名へ
+		p.nextToken() // 次の式へ
 	}
 	return columns, nil
 }
 
+// parseExpression は式をパースする
+// 優先順位は低い順に OR, AND, NOT, 比較（IS NULL, LIKE, IN, BETWEEN を含む）, + -, * /, 単項マイナス
 func (p *parser) parseExpression() (Expression, error) {
-	// まず比較式を解析
-	left, err := p.parseComparisonExpression()
+	return p.parseOrExpression()
+}
+
+func (p *parser) parseOrExpression() (Expression, error) {
+	left, err := p.parseAndExpression()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekTokenIs(TOKEN_OR) {
+		p.nextToken() // 演算子へ
+		operator := p.currentToken.literal
+		p.nextToken() // 右辺へ
+		right, err := p.parseAndExpression()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpression{Left: left, Operator: operator, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAndExpression() (Expression, error) {
+	left, err := p.parseNotExpression()
 	if err != nil {
 		return nil, err
 	}
-	// AND/OR があれば論理式を作成
-	for p.peekTokenIs(TOKEN_AND) || p.peekTokenIs(TOKEN_OR) {
+	for p.peekTokenIs(TOKEN_AND) {
 		p.nextToken() // 演算子へ
 		operator := p.currentToken.literal
 		p.nextToken() // 右辺へ
-		right, err := p.parseComparisonExpression()
+		right, err := p.parseNotExpression()
 		if err != nil {
 			return nil, err
 		}
@@ -216,11 +272,44 @@ func (p *parser) parseExpression() (Expression, error) {
 	return left, nil
 }
 
+// parseNotExpression は論理否定の NOT をパースする
+func (p *parser) parseNotExpression() (Expression, error) {
+	if !p.currentTokenIs(TOKEN_NOT) {
+		return p.parseComparisonExpression()
+	}
+	p.nextToken() // 被演算子へ
+	operand, err := p.parseNotExpression()
+	if err != nil {
+		return nil, err
+	}
+	return &UnaryExpression{Operator: "NOT", Operand: operand}, nil
+}
+
 func (p *parser) parseComparisonExpression() (Expression, error) {
-	left, err := p.parsePrimaryExpression()
+	left, err := p.parseAdditiveExpression()
 	if err != nil {
 		return nil, err
 	}
+	// [NOT] LIKE / IN / BETWEEN
+	not := false
+	if p.peekTokenIs(TOKEN_NOT) {
+		p.nextToken() // NOT へ
+		if !p.peekTokenIs(TOKEN_LIKE) && !p.peekTokenIs(TOKEN_IN) && !p.peekTokenIs(TOKEN_BETWEEN) {
+			return nil, fmt.Errorf("expected LIKE, IN or BETWEEN after NOT")
+		}
+		not = true
+	}
+	switch {
+	case p.peekTokenIs(TOKEN_LIKE):
+		p.nextToken() // LIKE へ
+		return p.parseLikeExpression(left, not)
+	case p.peekTokenIs(TOKEN_IN):
+		p.nextToken() // IN へ
+		return p.parseInExpression(left, not)
+	case p.peekTokenIs(TOKEN_BETWEEN):
+		p.nextToken() // BETWEEN へ
+		return p.parseBetweenExpression(left, not)
+	}
 	// 比較演算子があれば BinaryExpression を作成
 	if p.peekTokenIs(TOKEN_EQ) || p.peekTokenIs(TOKEN_NEQ) ||
 		p.peekTokenIs(TOKEN_LT) || p.peekTokenIs(TOKEN_GT) ||
@@ -229,7 +318,128 @@ func (p *parser) parseComparisonExpression() (Expression, error) {
 		p.nextToken() // 演算子へ
 		operator := p.currentToken.literal
 		p.nextToken() // 右辺へ
-		right, err := p.parsePrimaryExpression()
+		right, err := p.parseAdditiveExpression()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpression{Left: left, Operator: operator, Right: right}
+	}
+	// IS [NOT] NULL
+	if p.peekTokenIs(TOKEN_IS) {
+		p.nextToken() // IS へ
+		expr := &IsNullExpression{Expression: left}
+		if p.peekTokenIs(TOKEN_NOT) {
+			p.nextToken() // NOT へ
+			expr.Not = true
+		}
+		if !p.expectPeek(TOKEN_NULL) {
+			return nil, fmt.Errorf("expected NULL after IS")
+		}
+		left = expr
+	}
+	return left, nil
+}
+
+// parseLikeExpression は LIKE の後ろ（パターンと ESCAPE）をパースする
+func (p *parser) parseLikeExpression(left Expression, not bool) (Expression, error) {
+	p.nextToken() // パターンへ
+	pattern, err := p.parseAdditiveExpression()
+	if err != nil {
+		return nil, err
+	}
+	expr := &LikeExpression{Expression: left, Pattern: pattern, Not: not}
+	if p.peekTokenIs(TOKEN_ESCAPE) {
+		p.nextToken() // ESCAPE へ
+		p.nextToken() // エスケープ文字へ
+		if expr.Escape, err = p.parseAdditiveExpression(); err != nil {
+			return nil, err
+		}
+	}
+	return expr, nil
+}
+
+// parseInExpression は IN の後ろの値のリストをパースする
+func (p *parser) parseInExpression(left Expression, not bool) (Expression, error) {
+	if !p.expectPeek(TOKEN_LPAREN) {
+		return nil, fmt.Errorf("expected ( after IN")
+	}
+	expr := &InExpression{Expression: left, Not: not}
+	// IN (SELECT ...)
+	if p.peekTokenIs(TOKEN_SELECT) {
+		subquery, err := p.parseSubquery()
+		if err != nil {
+			return nil, err
+		}
+		expr.Subquery = subquery
+		return expr, nil
+	}
+	for {
+		p.nextToken() // 値へ
+		value, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		expr.List = append(expr.List, value)
+		if !p.peekTokenIs(TOKEN_COMMA) {
+			break
+		}
+		p.nextToken() // COMMA へ
+	}
+	if !p.expectPeek(TOKEN_RPAREN) {
+		return nil, fmt.Errorf("expected ) after IN list")
+	}
+	return expr, nil
+}
+
+// parseBetweenExpression は BETWEEN low AND high をパースする
+// low と high は算術式までにして、間の AND を論理演算子として読まないようにする
+func (p *parser) parseBetweenExpression(left Expression, not bool) (Expression, error) {
+	p.nextToken() // 下限へ
+	low, err := p.parseAdditiveExpression()
+	if err != nil {
+		return nil, err
+	}
+	if !p.expectPeek(TOKEN_AND) {
+		return nil, fmt.Errorf("expected AND in BETWEEN")
+	}
+	p.nextToken() // 上限へ
+	high, err := p.parseAdditiveExpression()
+	if err != nil {
+		return nil, err
+	}
+	return &BetweenExpression{Expression: left, Low: low, High: high, Not: not}, nil
+}
+
+// parseAdditiveExpression は + と - をパースする（左結合）
+func (p *parser) parseAdditiveExpression() (Expression, error) {
+	left, err := p.parseMultiplicativeExpression()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekTokenIs(TOKEN_PLUS) || p.peekTokenIs(TOKEN_MINUS) {
+		p.nextToken() // 演算子へ
+		operator := p.currentToken.literal
+		p.nextToken() // 右辺へ
+		right, err := p.parseMultiplicativeExpression()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpression{Left: left, Operator: operator, Right: right}
+	}
+	return left, nil
+}
+
+// parseMultiplicativeExpression は *、/、% をパースする（左結合）
+func (p *parser) parseMultiplicativeExpression() (Expression, error) {
+	left, err := p.parseUnaryExpression()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekTokenIs(TOKEN_ASTERISK) || p.peekTokenIs(TOKEN_SLASH) || p.peekTokenIs(TOKEN_PERCENT) {
+		p.nextToken() // 演算子へ
+		operator := p.currentToken.literal
+		p.nextToken() // 右辺へ
+		right, err := p.parseUnaryExpression()
 		if err != nil {
 			return nil, err
 		}
@@ -238,10 +448,48 @@ func (p *parser) parseComparisonExpression() (Expression, error) {
 	return left, nil
 }
 
+// parseUnaryExpression は単項の + と - をパースする
+// 数値リテラルに付いた - はリテラルの符号として取り込む
+func (p *parser) parseUnaryExpression() (Expression, error) {
+	if !p.currentTokenIs(TOKEN_MINUS) && !p.currentTokenIs(TOKEN_PLUS) {
+		return p.parsePrimaryExpression()
+	}
+	operator := p.currentToken.literal
+	p.nextToken() // 被演算子へ
+	operand, err := p.parseUnaryExpression()
+	if err != nil {
+		return nil, err
+	}
+	if operator == "+" {
+		return operand, nil
+	}
+	switch o := operand.(type) {
+	case *IntegerLiteral:
+		return &IntegerLiteral{Value: -o.Value}, nil
+	case *FloatLiteral:
+		if !strings.HasPrefix(o.Value, "-") {
+			return &FloatLiteral{Value: "-" + o.Value}, nil
+		}
+	}
+	return &UnaryExpression{Operator: operator, Operand: operand}, nil
+}
+
 func (p *parser) parsePrimaryExpression() (Expression, error) {
+	if p.isAggregateFunctionToken() {
+		return p.parseAggregateFunction()
+	}
 	switch p.currentToken.tokenType {
 	case TOKEN_IDENT:
 		ident := p.currentToken.literal
+		// DATE '2024-01-31' のような型付きリテラルかチェック
+		if isTypedLiteralType(ident) && p.peekTokenIs(TOKEN_VARCHAR) {
+			p.nextToken() // 文字列へ
+			return &TypedLiteral{Type: strings.ToUpper(ident), Value: p.currentToken.literal}, nil
+		}
+		// UPPER(name) のような関数呼び出しかチェック
+		if p.peekTokenIs(TOKEN_LPAREN) {
+			return p.parseFunctionCall()
+		}
 		// table.column 形式かチェック
 		if p.peekTokenIs(TOKEN_DOT) {
 			p.nextToken() // . へ
@@ -255,17 +503,222 @@ func (p *parser) parsePrimaryExpression() (Expression, error) {
 	case TOKEN_INT:
 		val, _ := strconv.ParseInt(p.currentToken.literal, 10, 64)
 		return &IntegerLiteral{Value: int(val)}, nil
+	case TOKEN_FLOAT:
+		return &FloatLiteral{Value: p.currentToken.literal}, nil
 	case TOKEN_VARCHAR:
 		return &StringLiteral{Value: p.currentToken.literal}, nil
 	case TOKEN_TEXT:
 		return &StringLiteral{Value: p.currentToken.literal}, nil
 	case TOKEN_BOOL:
-		return &BooleanLiteral{Value: p.currentToken.literal == "true"}, nil
+		return &BooleanLiteral{Value: strings.EqualFold(p.currentToken.literal, "true")}, nil
+	case TOKEN_NULL:
+		return &NullLiteral{}, nil
+	case TOKEN_EXISTS:
+		if !p.expectPeek(TOKEN_LPAREN) {
+			return nil, fmt.Errorf("expected ( after EXISTS")
+		}
+		subquery, err := p.parseSubquery()
+		if err != nil {
+			return nil, err
+		}
+		return &ExistsExpression{Subquery: subquery}, nil
+	case TOKEN_LPAREN:
+		// (SELECT ...) はスカラーサブクエリ
+		if p.peekTokenIs(TOKEN_SELECT) {
+			subquery, err := p.parseSubquery()
+			if err != nil {
+				return nil, err
+			}
+			return &SubqueryExpression{Select: subquery}, nil
+		}
+		p.nextToken() // 括弧の中へ
+		expr, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		if !p.expectPeek(TOKEN_RPAREN) {
+			return nil, fmt.Errorf("expected ) after expression")
+		}
+		return expr, nil
 	default:
 		return nil, fmt.Errorf("unexpected token: %d", p.currentToken.tokenType)
 	}
 }
 
+// parseTableReference は FROM や JOIN の後ろのテーブルをパースする（現在のトークンはその前のトークン）
+// テーブル名 [[AS] 別名] か (SELECT ...) [AS] 別名 で、派生テーブルの名前は別名になる
+func (p *parser) parseTableReference() (string, string, *SelectStatement, error) {
+	if p.peekTokenIs(TOKEN_LPAREN) {
+		p.nextToken() // ( へ
+		subquery, err := p.parseSubquery()
+		if err != nil {
+			return "", "", nil, err
+		}
+		// 派生テーブルには別名が必要（AS は省略できる）
+		if p.peekTokenIs(TOKEN_AS) {
+			p.nextToken() // AS へ
+		}
+		if !p.expectPeek(TOKEN_IDENT) {
+			return "", "", nil, fmt.Errorf("expected alias for subquery in FROM")
+		}
+		return p.currentToken.literal, "", subquery, nil
+	}
+	if !p.expectPeek(TOKEN_IDENT) {
+		return "", "", nil, fmt.Errorf("expected table name")
+	}
+	table := p.currentToken.literal
+	alias := ""
+	if p.peekTokenIs(TOKEN_AS) {
+		p.nextToken() // AS へ
+		if !p.expectPeek(TOKEN_IDENT) {
+			return "", "", nil, fmt.Errorf("expected alias after AS")
+		}
+		alias = p.currentToken.literal
+	} else if p.peekTokenIs(TOKEN_IDENT) {
+		p.nextToken() // 別名へ
+		alias = p.currentToken.literal
+	}
+	return table, alias, nil, nil
+}
+
+// parseJoin は [INNER | LEFT [OUTER] | RIGHT [OUTER] | FULL [OUTER] | CROSS] JOIN をパースする
+// FROM a, b のカンマは CROSS JOIN とみなす
+// 次のトークンが JOIN 句でなければ nil を返す
+func (p *parser) parseJoin() (*Join, error) {
+	join := &Join{Type: "INNER"}
+	switch {
+	case p.peekTokenIs(TOKEN_COMMA):
+		p.nextToken() // COMMA へ
+		join.Type = "CROSS"
+		var err error
+		if join.Table, join.Alias, join.Subquery, err = p.parseTableReference(); err != nil {
+			return nil, err
+		}
+		return join, nil
+	case p.peekTokenIs(TOKEN_JOIN):
+	case p.peekTokenIs(TOKEN_INNER), p.peekTokenIs(TOKEN_CROSS):
+		p.nextToken() // INNER / CROSS へ
+		join.Type = strings.ToUpper(p.currentToken.literal)
+	case p.peekTokenIs(TOKEN_LEFT), p.peekTokenIs(TOKEN_RIGHT), p.peekTokenIs(TOKEN_FULL):
+		p.nextToken() // LEFT / RIGHT / FULL へ
+		join.Type = strings.ToUpper(p.currentToken.literal)
+		if p.peekTokenIs(TOKEN_OUTER) {
+			p.nextToken() // OUTER へ
+		}
+	default:
+		return nil, nil
+	}
+	if !p.expectPeek(TOKEN_JOIN) {
+		return nil, fmt.Errorf("expected JOIN after %s", join.Type)
+	}
+	var err error
+	join.Table, join.Alias, join.Subquery, err = p.parseTableReference()
+	if err != nil {
+		return nil, err
+	}
+	// CROSS JOIN には結合条件がない
+	if join.Type == "CROSS" {
+		if p.peekTokenIs(TOKEN_ON) || p.peekTokenIs(TOKEN_USING) {
+			return nil, fmt.Errorf("CROSS JOIN does not take a join condition")
+		}
+		return join, nil
+	}
+	switch {
+	case p.peekTokenIs(TOKEN_ON):
+		p.nextToken() // ON へ
+		p.nextToken() // 条件式へ
+		if join.On, err = p.parseExpression(); err != nil {
+			return nil, err
+		}
+	case p.peekTokenIs(TOKEN_USING):
+		p.nextToken() // USING へ
+		if !p.expectPeek(TOKEN_LPAREN) {
+			return nil, fmt.Errorf("expected ( after USING")
+		}
+		join.Using = p.parseIdentifierList()
+		if len(join.Using) == 0 {
+			return nil, fmt.Errorf("expected column names in USING")
+		}
+		if !p.expectPeek(TOKEN_RPAREN) {
+			return nil, fmt.Errorf("expected ) after USING columns")
+		}
+	default:
+		return nil, fmt.Errorf("expected ON or USING after JOIN %s", join.Table)
+	}
+	return join, nil
+}
+
+// parseSubquery は (SELECT ...) をパースする（現在のトークンは開き括弧）
+func (p *parser) parseSubquery() (*SelectStatement, error) {
+	if !p.expectPeek(TOKEN_SELECT) {
+		return nil, fmt.Errorf("expected SELECT in subquery")
+	}
+	stmt, err := p.parseSelectStatement()
+	if err != nil {
+		return nil, err
+	}
+	if !p.expectPeek(TOKEN_RPAREN) {
+		return nil, fmt.Errorf("expected ) after subquery")
+	}
+	return stmt, nil
+}
+
+// parseFunctionCall は関数呼び出しをパースする（現在のトークンは関数名）
+// CAST(x AS type) は型名を引数に取るので CastExpression にする
+func (p *parser) parseFunctionCall() (Expression, error) {
+	name := strings.ToUpper(p.currentToken.literal)
+	p.nextToken() // ( へ
+	if name == "CAST" {
+		p.nextToken() // 式へ
+		expr, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		if !p.expectPeek(TOKEN_AS) {
+			return nil, fmt.Errorf("expected AS in CAST")
+		}
+		p.nextToken() // 型名へ
+		columnType, err := p.parseDataType()
+		if err != nil {
+			return nil, err
+		}
+		if !p.expectPeek(TOKEN_RPAREN) {
+			return nil, fmt.Errorf("expected ) after CAST")
+		}
+		return &CastExpression{Expression: expr, Type: columnType}, nil
+	}
+	call := &FunctionCall{Name: name, Arguments: []Expression{}}
+	if p.peekTokenIs(TOKEN_RPAREN) {
+		p.nextToken() // ) へ
+		return call, nil
+	}
+	for {
+		p.nextToken() // 引数へ
+		arg, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		call.Arguments = append(call.Arguments, arg)
+		if !p.peekTokenIs(TOKEN_COMMA) {
+			break
+		}
+		p.nextToken() // COMMA へ
+	}
+	if !p.expectPeek(TOKEN_RPAREN) {
+		return nil, fmt.Errorf("expected ) after arguments of %s", name)
+	}
+	return call, nil
+}
+
+// isTypedLiteralType は型付きリテラルに使える型名かどうかを返す
+func isTypedLiteralType(name string) bool {
+	switch strings.ToUpper(name) {
+	case "DATE", "TIME", "TIMESTAMP":
+		return true
+	}
+	return false
+}
+
 func (p *parser) parseInsertStatement() (*InsertStatement, error) {
 	stmt := &InsertStatement{}
 	// INTO を期待
@@ -325,7 +778,7 @@ func (p *parser) parseExpressionList() []Expression {
 	list := []Expression{}
 	for {
 		p.nextToken() // 値へ
-		expr, err := p.parsePrimaryExpression()
+		expr, err := p.parseExpression()
 		if err != nil {
 			break
 		}
@@ -341,11 +794,15 @@ func (p *parser) parseExpressionList() []Expression {
 func (p *parser) parseOrderBy() ([]OrderByClause, error) {
 	clauses := []OrderByClause{}
 	for {
-		p.nextToken() // カラム名へ
-		if !p.currentTokenIs(TOKEN_IDENT) {
-			return nil, fmt.Errorf("expected column name")
+		p.nextToken() // ソートする式へ
+		expr, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		clause := OrderByClause{Expression: expr, Asc: true}
+		if ident, ok := expr.(*Identifier); ok {
+			clause.Column = ident.Value
 		}
-		clause := OrderByClause{Column: p.currentToken.literal, Asc: true}
 		if p.peekTokenIs(TOKEN_DESC) {
 			p.nextToken() // DESC へ
 			clause.Asc = false
@@ -389,8 +846,8 @@ func (p *parser) parseUpdateStatement() (*UpdateStatement, error) {
 			return nil, fmt.Errorf("expected = after column name")
 		}
 		p.nextToken() // 値へ
-		// 値をパース
-		value, err := p.parsePrimaryExpression()
+		// 値の式をパース（SET x = x + 1 など）
+		value, err := p.parseExpression()
 		if err != nil {
 			return nil, err
 		}
@@ -476,6 +933,76 @@ func (p *parser) parseCreateTableStatement() (*CreateTableStatement, error) {
 	return stmt, nil
 }
 
+// CREATE [UNIQUE] INDEX 文をパース
+func (p *parser) parseCreateIndexStatement() (*CreateIndexStatement, error) {
+	stmt := &CreateIndexStatement{}
+	// UNIQUE（オプション）
+	if p.peekTokenIs(TOKEN_UNIQUE) {
+		p.nextToken() // UNIQUE へ
+		stmt.Unique = true
+	}
+	// INDEX を期待
+	if !p.expectPeek(TOKEN_INDEX) {
+		return nil, fmt.Errorf("expected INDEX token")
+	}
+	// インデックス名をパース
+	if !p.expectPeek(TOKEN_IDENT) {
+		return nil, fmt.Errorf("expected index name")
+	}
+	stmt.IndexName = p.currentToken.literal
+	// ON を期待
+	if !p.expectPeek(TOKEN_ON) {
+		return nil, fmt.Errorf("expected ON after index name")
+	}
+	// テーブル名をパース
+	if !p.expectPeek(TOKEN_IDENT) {
+		return nil, fmt.Errorf("expected table name")
+	}
+	stmt.TableName = p.currentToken.literal
+	// (カラム名, ...) を期待
+	if !p.expectPeek(TOKEN_LPAREN) {
+		return nil, fmt.Errorf("expected ( after table name")
+	}
+	for {
+		if !p.expectPeek(TOKEN_IDENT) {
+			return nil, fmt.Errorf("expected column name")
+		}
+		stmt.Columns = append(stmt.Columns, p.currentToken.literal)
+		if !p.peekTokenIs(TOKEN_COMMA) {
+			break
+		}
+		p.nextToken() // , へ
+	}
+	if !p.expectPeek(TOKEN_RPAREN) {
+		return nil, fmt.Errorf("expected ) after column name")
+	}
+	return stmt, nil
+}
+
+// DROP 文をパース（現在は DROP INDEX のみ）
+func (p *parser) parseDropStatement() (Statement, error) {
+	if !p.expectPeek(TOKEN_INDEX) {
+		return nil, fmt.Errorf("expected INDEX after DROP")
+	}
+	stmt := &DropIndexStatement{}
+	// インデックス名をパース
+	if !p.expectPeek(TOKEN_IDENT) {
+		return nil, fmt.Errorf("expected index name")
+	}
+	stmt.IndexName = p.currentToken.literal
+	return stmt, nil
+}
+
+// ANALYZE [table] をパース
+func (p *parser) parseAnalyzeStatement() (*AnalyzeStatement, error) {
+	stmt := &AnalyzeStatement{}
+	if p.peekTokenIs(TOKEN_IDENT) {
+		p.nextToken()
+		stmt.TableName = p.currentToken.literal
+	}
+	return stmt, nil
+}
+
 // カラム定義をパース
 func (p *parser) parseColumnDefinition() (*ColumnDefinition, error) {
 	colDef := &ColumnDefinition{}
@@ -486,46 +1013,106 @@ func (p *parser) parseColumnDefinition() (*ColumnDefinition, error) {
 	colDef.Name = p.currentToken.literal
 	p.nextToken() // データ型へ
 
+	columnType, err := p.parseDataType()
+	if err != nil {
+		return nil, err
+	}
+	colDef.ColumnType = columnType
+	// 制約（PRIMARY KEY, NOT NULL, NULL）を順不同で読む
+	// 何も指定しなければ NULL を入れられる。PRIMARY KEY のカラムには入れられない
+	colDef.Nullable = true
+	for {
+		switch {
+		case p.peekTokenIs(TOKEN_PRIMARY):
+			p.nextToken() // PRIMARY へ
+			if !p.expectPeek(TOKEN_KEY) {
+				return nil, fmt.Errorf("expected KEY after PRIMARY")
+			}
+			colDef.PrimaryKey = true
+			colDef.Nullable = false
+		case p.peekTokenIs(TOKEN_NOT):
+			p.nextToken() // NOT へ
+			if !p.expectPeek(TOKEN_NULL) {
+				return nil, fmt.Errorf("expected NULL after NOT")
+			}
+			colDef.Nullable = false
+		case p.peekTokenIs(TOKEN_NULL):
+			p.nextToken() // NULL へ
+			if colDef.PrimaryKey {
+				return nil, fmt.Errorf("primary key column %s cannot be NULL", colDef.Name)
+			}
+			colDef.Nullable = true
+		default:
+			return colDef, nil
+		}
+	}
+}
+
+// parseDataType はデータ型（VARCHAR(255) や DECIMAL(10,2) など）をパースして正規化した型名を返す
+// CREATE TABLE のカラム定義と CAST で使う
+func (p *parser) parseDataType() (string, error) {
+	var columnType string
 	// データ型（INT, VARCHAR等は識別子として認識される）
 	if !p.currentTokenIs(TOKEN_IDENT) {
-		return nil, fmt.Errorf("expected data type, got token: %d", p.currentToken.tokenType)
+		return "", fmt.Errorf("expected data type, got token: %d", p.currentToken.tokenType)
 	}
 
 	switch strings.ToUpper(p.currentToken.literal) {
 	case "INT", "INTEGER":
-		colDef.ColumnType = "INT"
-	case "FLOAT", "DOUBLE":
-		colDef.ColumnType = "FLOAT"
+		columnType = "INT"
+	case "BIGINT":
+		columnType = "BIGINT"
+	case "FLOAT", "REAL":
+		columnType = "FLOAT"
+	case "DOUBLE":
+		columnType = "DOUBLE"
+		// DOUBLE PRECISION も受け付ける
+		if p.peekTokenIs(TOKEN_IDENT) && strings.EqualFold(p.peekToken.literal, "PRECISION") {
+			p.nextToken()
+		}
+	case "DECIMAL", "NUMERIC":
+		columnType = "DECIMAL"
+		// DECIMAL(10,2) や DECIMAL(10) のような形式をパース
+		if p.peekTokenIs(TOKEN_LPAREN) {
+			p.nextToken() // ( へ
+			if !p.expectPeek(TOKEN_INT) {
+				return "", fmt.Errorf("expected precision in DECIMAL")
+			}
+			precision := p.currentToken.literal
+			scale := "0"
+			if p.peekTokenIs(TOKEN_COMMA) {
+				p.nextToken() // , へ
+				if !p.expectPeek(TOKEN_INT) {
+					return "", fmt.Errorf("expected scale in DECIMAL")
+				}
+				scale = p.currentToken.literal
+			}
+			if !p.expectPeek(TOKEN_RPAREN) {
+				return "", fmt.Errorf("expected ) after DECIMAL precision")
+			}
+			columnType = fmt.Sprintf("DECIMAL(%s,%s)", precision, scale)
+		}
+	case "DATE", "TIME", "TIMESTAMP":
+		columnType = strings.ToUpper(p.currentToken.literal)
 	case "VARCHAR":
-		colDef.ColumnType = "VARCHAR"
+		columnType = "VARCHAR"
 		// VARCHAR(255) のような形式をパース
 		if p.peekTokenIs(TOKEN_LPAREN) {
 			p.nextToken() // ( へ
 			p.nextToken() // サイズへ
-			colDef.ColumnType = fmt.Sprintf("VARCHAR(%s)", p.currentToken.literal)
+			columnType = fmt.Sprintf("VARCHAR(%s)", p.currentToken.literal)
 			p.nextToken() // ) へ
 		}
 	case "BOOL", "BOOLEAN":
-		colDef.ColumnType = "BOOL"
+		columnType = "BOOL"
 	case "TEXT":
-		colDef.ColumnType = "TEXT"
+		columnType = "TEXT"
+	case "BLOB", "BYTEA":
+		columnType = "BLOB"
 	default:
-		return nil, fmt.Errorf("unknown data type: %s", p.currentToken.literal)
-	}
-	// PRIMARY KEY かどうか
-	if p.peekTokenIs(TOKEN_PRIMARY) {
-		p.nextToken() // PRIMARY へ
-		if !p.expectPeek(TOKEN_KEY) {
-			return nil, fmt.Errorf("expected KEY after PRIMARY")
-		}
-		colDef.PrimaryKey = true
-	}
-	// NULL かどうか
-	if p.peekTokenIs(TOKEN_NULL) {
-		p.nextToken() // NULL へ
-		colDef.Nullable = true
+		return "", fmt.Errorf("unknown data type: %s", p.currentToken.literal)
 	}
-	return colDef, nil
+	return columnType, nil
 }
 
 // EXPLAIN文をパース
@@ -594,17 +1181,106 @@ func (p *parser) parseGroupBy() ([]string, error) {
 	return columns, nil
 }
 
+// BEGIN [TRANSACTION] [ISOLATION LEVEL ...] をパース
 func (p *parser) parseBeginStatement() (*BeginStatement, error) {
 	stmt := &BeginStatement{}
+	if p.peekTokenIs(TOKEN_TRANSACTION) {
+		p.nextToken() // TRANSACTION へ
+	}
+	if p.peekTokenIs(TOKEN_ISOLATION) {
+		p.nextToken() // ISOLATION へ
+		level, err := p.parseIsolationLevel()
+		if err != nil {
+			return nil, err
+		}
+		stmt.IsolationLevel = level
+	}
 	return stmt, nil
 }
 
+// SET TRANSACTION ISOLATION LEVEL ... をパース
+func (p *parser) parseSetTransactionStatement() (*SetTransactionStatement, error) {
+	if !p.expectPeek(TOKEN_TRANSACTION) {
+		return nil, fmt.Errorf("expected TRANSACTION after SET")
+	}
+	if !p.expectPeek(TOKEN_ISOLATION) {
+		return nil, fmt.Errorf("expected ISOLATION after SET TRANSACTION")
+	}
+	level, err := p.parseIsolationLevel()
+	if err != nil {
+		return nil, err
+	}
+	return &SetTransactionStatement{IsolationLevel: level}, nil
+}
+
+// ISOLATION の後の LEVEL と分離レベル名をパースする（呼び出し元で ISOLATION まで進めておく）
+// LEVEL や分離レベル名はカラム名にも使えるように識別子として読む
+func (p *parser) parseIsolationLevel() (string, error) {
+	if !p.expectPeek(TOKEN_IDENT) || !strings.EqualFold(p.currentToken.literal, "LEVEL") {
+		return "", fmt.Errorf("expected LEVEL after ISOLATION")
+	}
+	if !p.expectPeek(TOKEN_IDENT) {
+		return "", fmt.Errorf("expected isolation level")
+	}
+	first := strings.ToUpper(p.currentToken.literal)
+	switch first {
+	case "SERIALIZABLE":
+		return first, nil
+	case "READ", "REPEATABLE":
+		if !p.expectPeek(TOKEN_IDENT) {
+			return "", fmt.Errorf("expected isolation level after %s", first)
+		}
+		return first + " " + strings.ToUpper(p.currentToken.literal), nil
+	default:
+		return "", fmt.Errorf("unknown isolation level: %s", p.currentToken.literal)
+	}
+}
+
 func (p *parser) parseCommitStatement() (*CommitStatement, error) {
 	stmt := &CommitStatement{}
 	return stmt, nil
 }
 
+// ROLLBACK [TO [SAVEPOINT] name] をパース
+// TO はカラム名にも使えるように識別子として読む
 func (p *parser) parseRollbackStatement() (*RollbackStatement, error) {
 	stmt := &RollbackStatement{}
+	if !p.peekTokenIs(TOKEN_IDENT) || !strings.EqualFold(p.peekToken.literal, "TO") {
+		return stmt, nil
+	}
+	p.nextToken() // TO へ
+	name, err := p.parseSavepointName()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Savepoint = name
 	return stmt, nil
 }
+
+// SAVEPOINT name をパース
+func (p *parser) parseSavepointStatement() (*SavepointStatement, error) {
+	if !p.expectPeek(TOKEN_IDENT) {
+		return nil, fmt.Errorf("expected savepoint name")
+	}
+	return &SavepointStatement{Name: p.currentToken.literal}, nil
+}
+
+// RELEASE [SAVEPOINT] name をパース
+func (p *parser) parseReleaseSavepointStatement() (*ReleaseSavepointStatement, error) {
+	name, err := p.parseSavepointName()
+	if err != nil {
+		return nil, err
+	}
+	return &ReleaseSavepointStatement{Name: name}, nil
+}
+
+// 省略できる SAVEPOINT の後のセーブポイント名をパース
+func (p *parser) parseSavepointName() (string, error) {
+	if p.peekTokenIs(TOKEN_SAVEPOINT) {
+		p.nextToken() // SAVEPOINT へ
+	}
+	if !p.expectPeek(TOKEN_IDENT) {
+		return "", fmt.Errorf("expected savepoint name")
+	}
+	return p.currentToken.literal, nil
+}
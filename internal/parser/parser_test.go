@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -399,3 +400,577 @@ func TestParser_Errors(t *testing.T) {
 		t.Errorf("expected 2 errors, got %d", len(errors))
 	}
 }
+
+func TestParser_CreateIndex(t *testing.T) {
+	tests := []struct {
+		input  string
+		unique bool
+	}{
+		{"CREATE INDEX idx_age ON users (age)", false},
+		{"CREATE UNIQUE INDEX idx_age ON users (age)", true},
+	}
+	for _, tt := range tests {
+		stmt, err := NewParser(NewLexer(tt.input)).Parse()
+		if err != nil {
+			t.Fatalf("parse error: %v", err)
+		}
+		createStmt, ok := stmt.(*CreateIndexStatement)
+		if !ok {
+			t.Fatalf("expected *CreateIndexStatement, got %T", stmt)
+		}
+		if createStmt.IndexName != "idx_age" || createStmt.TableName != "users" || len(createStmt.Columns) != 1 || createStmt.Columns[0] != "age" {
+			t.Errorf("unexpected statement: %+v", createStmt)
+		}
+		if createStmt.Unique != tt.unique {
+			t.Errorf("expected unique=%v, got %v", tt.unique, createStmt.Unique)
+		}
+	}
+
+	if _, err := NewParser(NewLexer("CREATE INDEX idx_age users (age)")).Parse(); err == nil {
+		t.Error("expected error when ON is missing")
+	}
+
+	stmt, err := NewParser(NewLexer("CREATE INDEX idx_name_age ON users (name, age)")).Parse()
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	createStmt := stmt.(*CreateIndexStatement)
+	if len(createStmt.Columns) != 2 || createStmt.Columns[0] != "name" || createStmt.Columns[1] != "age" {
+		t.Errorf("expected columns [name age], got %v", createStmt.Columns)
+	}
+}
+
+func TestParser_DropIndex(t *testing.T) {
+	stmt, err := NewParser(NewLexer("DROP INDEX idx_age")).Parse()
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	dropStmt, ok := stmt.(*DropIndexStatement)
+	if !ok {
+		t.Fatalf("expected *DropIndexStatement, got %T", stmt)
+	}
+	if dropStmt.IndexName != "idx_age" {
+		t.Errorf("expected indexName='idx_age', got %q", dropStmt.IndexName)
+	}
+}
+
+func TestParser_Analyze(t *testing.T) {
+	tests := []struct {
+		input     string
+		tableName string
+	}{
+		{"ANALYZE users", "users"},
+		{"ANALYZE", ""},
+		{"ANALYZE;", ""},
+	}
+	for _, tt := range tests {
+		stmt, err := NewParser(NewLexer(tt.input)).Parse()
+		if err != nil {
+			t.Fatalf("%s: parse error: %v", tt.input, err)
+		}
+		analyzeStmt, ok := stmt.(*AnalyzeStatement)
+		if !ok {
+			t.Fatalf("%s: expected *AnalyzeStatement, got %T", tt.input, stmt)
+		}
+		if analyzeStmt.TableName != tt.tableName {
+			t.Errorf("%s: expected tableName=%q, got %q", tt.input, tt.tableName, analyzeStmt.TableName)
+		}
+	}
+}
+
+func TestParser_IsolationLevel(t *testing.T) {
+	tests := []struct {
+		input string
+		level string
+	}{
+		{"BEGIN", ""},
+		{"BEGIN TRANSACTION", ""},
+		{"BEGIN ISOLATION LEVEL SERIALIZABLE", "SERIALIZABLE"},
+		{"BEGIN TRANSACTION ISOLATION LEVEL READ COMMITTED", "READ COMMITTED"},
+		{"SET TRANSACTION ISOLATION LEVEL REPEATABLE READ", "REPEATABLE READ"},
+	}
+	for _, tt := range tests {
+		stmt, err := NewParser(NewLexer(tt.input)).Parse()
+		if err != nil {
+			t.Fatalf("%s: parse error: %v", tt.input, err)
+		}
+		var level string
+		switch stmt := stmt.(type) {
+		case *BeginStatement:
+			level = stmt.IsolationLevel
+		case *SetTransactionStatement:
+			level = stmt.IsolationLevel
+		default:
+			t.Fatalf("%s: unexpected statement %T", tt.input, stmt)
+		}
+		if level != tt.level {
+			t.Errorf("%s: expected level %q, got %q", tt.input, tt.level, level)
+		}
+	}
+
+	for _, input := range []string{"BEGIN ISOLATION SERIALIZABLE", "SET TRANSACTION ISOLATION LEVEL READ", "SET TRANSACTION"} {
+		if _, err := NewParser(NewLexer(input)).Parse(); err == nil {
+			t.Errorf("%s: expected parse error", input)
+		}
+	}
+}
+
+func TestParser_Savepoint(t *testing.T) {
+	stmt, err := NewParser(NewLexer("SAVEPOINT first")).Parse()
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	if sp, ok := stmt.(*SavepointStatement); !ok || sp.Name != "first" {
+		t.Errorf("expected SAVEPOINT first, got %#v", stmt)
+	}
+
+	for _, input := range []string{"ROLLBACK TO first", "ROLLBACK TO SAVEPOINT first"} {
+		stmt, err := NewParser(NewLexer(input)).Parse()
+		if err != nil {
+			t.Fatalf("%s: parse error: %v", input, err)
+		}
+		if rb, ok := stmt.(*RollbackStatement); !ok || rb.Savepoint != "first" {
+			t.Errorf("%s: expected rollback to first, got %#v", input, stmt)
+		}
+	}
+	stmt, _ = NewParser(NewLexer("ROLLBACK")).Parse()
+	if rb := stmt.(*RollbackStatement); rb.Savepoint != "" {
+		t.Errorf("expected a full rollback, got savepoint %q", rb.Savepoint)
+	}
+
+	for _, input := range []string{"RELEASE first", "RELEASE SAVEPOINT first"} {
+		stmt, err := NewParser(NewLexer(input)).Parse()
+		if err != nil {
+			t.Fatalf("%s: parse error: %v", input, err)
+		}
+		if rel, ok := stmt.(*ReleaseSavepointStatement); !ok || rel.Name != "first" {
+			t.Errorf("%s: expected RELEASE first, got %#v", input, stmt)
+		}
+	}
+
+	for _, input := range []string{"SAVEPOINT", "ROLLBACK TO", "RELEASE SAVEPOINT"} {
+		if _, err := NewParser(NewLexer(input)).Parse(); err == nil {
+			t.Errorf("%s: expected parse error", input)
+		}
+	}
+}
+
+func TestParser_NumericAndTemporalTypes(t *testing.T) {
+	input := "CREATE TABLE events (a BIGINT, b FLOAT, c REAL, d DOUBLE, e DOUBLE PRECISION, f DECIMAL(10,2), g NUMERIC(5), h DECIMAL, i DATE, j TIME, k TIMESTAMP, l TEXT, m BLOB, n BYTEA)"
+	stmt, err := NewParser(NewLexer(input)).Parse()
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	createStmt := stmt.(*CreateTableStatement)
+	expected := []string{"BIGINT", "FLOAT", "FLOAT", "DOUBLE", "DOUBLE", "DECIMAL(10,2)", "DECIMAL(5,0)", "DECIMAL", "DATE", "TIME", "TIMESTAMP", "TEXT", "BLOB", "BLOB"}
+	if len(createStmt.Columns) != len(expected) {
+		t.Fatalf("expected %d columns, got %d", len(expected), len(createStmt.Columns))
+	}
+	for i, want := range expected {
+		if createStmt.Columns[i].ColumnType != want {
+			t.Errorf("column %s: expected type %s, got %s", createStmt.Columns[i].Name, want, createStmt.Columns[i].ColumnType)
+		}
+	}
+
+	if _, err := NewParser(NewLexer("CREATE TABLE t (a DECIMAL(10,))")).Parse(); err == nil {
+		t.Error("expected parse error for a missing DECIMAL scale")
+	}
+}
+
+func TestParser_FloatAndTypedLiterals(t *testing.T) {
+	input := "SELECT * FROM events WHERE price >= 12.50 AND day = DATE '2024-01-31' AND at < TIMESTAMP '2024-01-31 10:00:00' AND score > 1e3"
+	stmt, err := NewParser(NewLexer(input)).Parse()
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	var literals []Expression
+	var collect func(expr Expression)
+	collect = func(expr Expression) {
+		if bin, ok := expr.(*BinaryExpression); ok {
+			if bin.Operator == "AND" {
+				collect(bin.Left)
+				collect(bin.Right)
+				return
+			}
+			literals = append(literals, bin.Right)
+		}
+	}
+	collect(stmt.(*SelectStatement).Where)
+	expected := []Expression{
+		&FloatLiteral{Value: "12.50"},
+		&TypedLiteral{Type: "DATE", Value: "2024-01-31"},
+		&TypedLiteral{Type: "TIMESTAMP", Value: "2024-01-31 10:00:00"},
+		&FloatLiteral{Value: "1e3"},
+	}
+	if len(literals) != len(expected) {
+		t.Fatalf("expected %d comparisons, got %d", len(expected), len(literals))
+	}
+	for i, want := range expected {
+		if !reflect.DeepEqual(literals[i], want) {
+			t.Errorf("literal %d: expected %#v, got %#v", i, want, literals[i])
+		}
+	}
+}
+
+func TestParser_NullConstraintsAndLiterals(t *testing.T) {
+	stmt, err := NewParser(NewLexer("CREATE TABLE users (id INT PRIMARY KEY, name VARCHAR(255) NOT NULL, email TEXT, note TEXT NULL)")).Parse()
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	expected := []bool{false, false, true, true}
+	for i, col := range stmt.(*CreateTableStatement).Columns {
+		if col.Nullable != expected[i] {
+			t.Errorf("column %s: expected nullable=%v, got %v", col.Name, expected[i], col.Nullable)
+		}
+	}
+	if _, err := NewParser(NewLexer("CREATE TABLE t (id INT PRIMARY KEY NULL)")).Parse(); err == nil {
+		t.Error("expected an error for a nullable primary key")
+	}
+
+	stmt, err = NewParser(NewLexer("INSERT INTO users (id, name, email, note) VALUES (1, 'alice', NULL, NULL)")).Parse()
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	values := stmt.(*InsertStatement).Values
+	if len(values) != 4 {
+		t.Fatalf("expected 4 values, got %d", len(values))
+	}
+	if _, ok := values[2].(*NullLiteral); !ok {
+		t.Errorf("expected NullLiteral, got %T", values[2])
+	}
+
+	stmt, err = NewParser(NewLexer("SELECT * FROM users WHERE email IS NULL AND note IS NOT NULL")).Parse()
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	where := stmt.(*SelectStatement).Where.(*BinaryExpression)
+	left, ok := where.Left.(*IsNullExpression)
+	if !ok || left.Not || !reflect.DeepEqual(left.Expression, &Identifier{Value: "email"}) {
+		t.Errorf("unexpected left operand: %#v", where.Left)
+	}
+	right, ok := where.Right.(*IsNullExpression)
+	if !ok || !right.Not {
+		t.Errorf("unexpected right operand: %#v", where.Right)
+	}
+	if _, err := NewParser(NewLexer("SELECT * FROM users WHERE email IS 1")).Parse(); err == nil {
+		t.Error("expected an error for IS without NULL")
+	}
+}
+
+func TestParser_ArithmeticExpressions(t *testing.T) {
+	stmt, err := NewParser(NewLexer("SELECT id, price * qty AS total, -(price - 1) / 2 FROM orders WHERE qty + 1 > 2 * -3 OR id = 1 AND qty = 2")).Parse()
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	selectStmt := stmt.(*SelectStatement)
+	if len(selectStmt.Columns) != 3 {
+		t.Fatalf("expected 3 columns, got %d", len(selectStmt.Columns))
+	}
+	aliased, ok := selectStmt.Columns[1].(*AliasedExpression)
+	if !ok || aliased.Alias != "total" {
+		t.Fatalf("expected AliasedExpression total, got %#v", selectStmt.Columns[1])
+	}
+	expectedTotal := &BinaryExpression{Left: &Identifier{Value: "price"}, Operator: "*", Right: &Identifier{Value: "qty"}}
+	if !reflect.DeepEqual(aliased.Expression, expectedTotal) {
+		t.Errorf("unexpected total expression: %#v", aliased.Expression)
+	}
+	// 単項マイナスは / より強く結び付く
+	expectedNegated := &BinaryExpression{
+		Left: &UnaryExpression{Operator: "-", Operand: &BinaryExpression{
+			Left: &Identifier{Value: "price"}, Operator: "-", Right: &IntegerLiteral{Value: 1},
+		}},
+		Operator: "/",
+		Right:    &IntegerLiteral{Value: 2},
+	}
+	if !reflect.DeepEqual(selectStmt.Columns[2], expectedNegated) {
+		t.Errorf("unexpected negated expression: %#v", selectStmt.Columns[2])
+	}
+
+	// OR は AND より弱く、算術は比較より強い
+	where, ok := selectStmt.Where.(*BinaryExpression)
+	if !ok || where.Operator != "OR" {
+		t.Fatalf("expected OR at the top, got %#v", selectStmt.Where)
+	}
+	expectedComparison := &BinaryExpression{
+		Left:     &BinaryExpression{Left: &Identifier{Value: "qty"}, Operator: "+", Right: &IntegerLiteral{Value: 1}},
+		Operator: ">",
+		Right:    &BinaryExpression{Left: &IntegerLiteral{Value: 2}, Operator: "*", Right: &IntegerLiteral{Value: -3}},
+	}
+	if !reflect.DeepEqual(where.Left, expectedComparison) {
+		t.Errorf("unexpected comparison: %#v", where.Left)
+	}
+	if right, ok := where.Right.(*BinaryExpression); !ok || right.Operator != "AND" {
+		t.Errorf("expected AND on the right, got %#v", where.Right)
+	}
+
+	stmt, err = NewParser(NewLexer("UPDATE orders SET qty = qty + 1, price = price * 1.10 WHERE id = 1")).Parse()
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	sets := stmt.(*UpdateStatement).SetExpressions
+	expectedQty := &BinaryExpression{Left: &Identifier{Value: "qty"}, Operator: "+", Right: &IntegerLiteral{Value: 1}}
+	if !reflect.DeepEqual(sets["qty"], expectedQty) {
+		t.Errorf("unexpected SET qty: %#v", sets["qty"])
+	}
+	expectedPrice := &BinaryExpression{Left: &Identifier{Value: "price"}, Operator: "*", Right: &FloatLiteral{Value: "1.10"}}
+	if !reflect.DeepEqual(sets["price"], expectedPrice) {
+		t.Errorf("unexpected SET price: %#v", sets["price"])
+	}
+
+	stmt, err = NewParser(NewLexer("INSERT INTO orders (id, price) VALUES (-1, -2.5)")).Parse()
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	values := stmt.(*InsertStatement).Values
+	if !reflect.DeepEqual(values, []Expression{&IntegerLiteral{Value: -1}, &FloatLiteral{Value: "-2.5"}}) {
+		t.Errorf("unexpected negative literals: %#v", values)
+	}
+}
+
+func TestParser_ModuloExpression(t *testing.T) {
+	stmt, err := NewParser(NewLexer("SELECT qty % 3 * 2 + 1 FROM orders")).Parse()
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	// % は * と同じ強さで左から結び付き、+ より強い
+	expected := &BinaryExpression{
+		Left: &BinaryExpression{
+			Left:     &BinaryExpression{Left: &Identifier{Value: "qty"}, Operator: "%", Right: &IntegerLiteral{Value: 3}},
+			Operator: "*",
+			Right:    &IntegerLiteral{Value: 2},
+		},
+		Operator: "+",
+		Right:    &IntegerLiteral{Value: 1},
+	}
+	if got := stmt.(*SelectStatement).Columns[0]; !reflect.DeepEqual(got, expected) {
+		t.Errorf("unexpected expression: %#v", got)
+	}
+}
+
+func TestParser_FunctionCallsAndCast(t *testing.T) {
+	stmt, err := NewParser(NewLexer("SELECT upper(name), SUBSTR(name, 1, 3) AS prefix, CAST(price AS DECIMAL(10,2)) FROM users WHERE LENGTH(TRIM(name)) > 3")).Parse()
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	selectStmt := stmt.(*SelectStatement)
+	expected := []Expression{
+		&FunctionCall{Name: "UPPER", Arguments: []Expression{&Identifier{Value: "name"}}},
+		&AliasedExpression{
+			Expression: &FunctionCall{Name: "SUBSTR", Arguments: []Expression{&Identifier{Value: "name"}, &IntegerLiteral{Value: 1}, &IntegerLiteral{Value: 3}}},
+			Alias:      "prefix",
+		},
+		&CastExpression{Expression: &Identifier{Value: "price"}, Type: "DECIMAL(10,2)"},
+	}
+	if !reflect.DeepEqual(selectStmt.Columns, expected) {
+		t.Errorf("unexpected columns: %#v", selectStmt.Columns)
+	}
+	expectedWhere := &BinaryExpression{
+		Left: &FunctionCall{Name: "LENGTH", Arguments: []Expression{
+			&FunctionCall{Name: "TRIM", Arguments: []Expression{&Identifier{Value: "name"}}},
+		}},
+		Operator: ">",
+		Right:    &IntegerLiteral{Value: 3},
+	}
+	if !reflect.DeepEqual(selectStmt.Where, expectedWhere) {
+		t.Errorf("unexpected WHERE: %#v", selectStmt.Where)
+	}
+
+	for _, sql := range []string{
+		"SELECT CAST(price DECIMAL) FROM users",
+		"SELECT CAST(price AS NOPE) FROM users",
+		"SELECT UPPER(name FROM users",
+	} {
+		if _, err := NewParser(NewLexer(sql)).Parse(); err == nil {
+			t.Errorf("expected a parse error for %q", sql)
+		}
+	}
+}
+
+func TestParser_Predicates(t *testing.T) {
+	stmt, err := NewParser(NewLexer("SELECT * FROM users WHERE NOT name LIKE 'a!%%' ESCAPE '!' AND age NOT BETWEEN 1 + 1 AND 10 AND id NOT IN (1, 2, 3) OR name IN ('x')")).Parse()
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	expected := &BinaryExpression{
+		Left: &BinaryExpression{
+			Left: &BinaryExpression{
+				Left: &UnaryExpression{Operator: "NOT", Operand: &LikeExpression{
+					Expression: &Identifier{Value: "name"},
+					Pattern:    &StringLiteral{Value: "a!%%"},
+					Escape:     &StringLiteral{Value: "!"},
+				}},
+				Operator: "AND",
+				Right: &BetweenExpression{
+					Expression: &Identifier{Value: "age"},
+					Low:        &BinaryExpression{Left: &IntegerLiteral{Value: 1}, Operator: "+", Right: &IntegerLiteral{Value: 1}},
+					High:       &IntegerLiteral{Value: 10},
+					Not:        true,
+				},
+			},
+			Operator: "AND",
+			Right: &InExpression{
+				Expression: &Identifier{Value: "id"},
+				List:       []Expression{&IntegerLiteral{Value: 1}, &IntegerLiteral{Value: 2}, &IntegerLiteral{Value: 3}},
+				Not:        true,
+			},
+		},
+		Operator: "OR",
+		Right:    &InExpression{Expression: &Identifier{Value: "name"}, List: []Expression{&StringLiteral{Value: "x"}}},
+	}
+	if where := stmt.(*SelectStatement).Where; !reflect.DeepEqual(where, expected) {
+		t.Errorf("unexpected WHERE: %#v", where)
+	}
+
+	for _, sql := range []string{
+		"SELECT * FROM users WHERE id NOT 1",
+		"SELECT * FROM users WHERE id IN 1, 2",
+		"SELECT * FROM users WHERE id BETWEEN 1 OR 2",
+		"SELECT * FROM users WHERE id IN ()",
+	} {
+		if _, err := NewParser(NewLexer(sql)).Parse(); err == nil {
+			t.Errorf("expected a parse error for %q", sql)
+		}
+	}
+}
+
+func TestParser_Subqueries(t *testing.T) {
+	stmt, err := NewParser(NewLexer("SELECT name, (SELECT COUNT(*) FROM orders) AS n FROM (SELECT * FROM users) AS u WHERE NOT EXISTS (SELECT * FROM bans WHERE bans.user_id = u.id) AND id NOT IN (SELECT user_id FROM orders)")).Parse()
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	selectStmt := stmt.(*SelectStatement)
+	if selectStmt.From != "u" || !reflect.DeepEqual(selectStmt.Subquery, &SelectStatement{Columns: []Expression{&Asterisk{}}, From: "users"}) {
+		t.Errorf("unexpected FROM: %s %#v", selectStmt.From, selectStmt.Subquery)
+	}
+	expectedColumn := &AliasedExpression{
+		Expression: &SubqueryExpression{Select: &SelectStatement{
+			Columns: []Expression{&AggregateFunction{Function: "COUNT", Argument: &Asterisk{}}},
+			From:    "orders",
+		}},
+		Alias: "n",
+	}
+	if !reflect.DeepEqual(selectStmt.Columns[1], expectedColumn) {
+		t.Errorf("unexpected scalar subquery: %#v", selectStmt.Columns[1])
+	}
+	expectedWhere := &BinaryExpression{
+		Left: &UnaryExpression{Operator: "NOT", Operand: &ExistsExpression{Subquery: &SelectStatement{
+			Columns: []Expression{&Asterisk{}},
+			From:    "bans",
+			Where: &BinaryExpression{
+				Left:     &QualifiedIdentifier{TableName: "bans", ColumnName: "user_id"},
+				Operator: "=",
+				Right:    &QualifiedIdentifier{TableName: "u", ColumnName: "id"},
+			},
+		}}},
+		Operator: "AND",
+		Right: &InExpression{
+			Expression: &Identifier{Value: "id"},
+			Subquery:   &SelectStatement{Columns: []Expression{&Identifier{Value: "user_id"}}, From: "orders"},
+			Not:        true,
+		},
+	}
+	if !reflect.DeepEqual(selectStmt.Where, expectedWhere) {
+		t.Errorf("unexpected WHERE: %#v", selectStmt.Where)
+	}
+
+	for _, sql := range []string{
+		"SELECT * FROM (SELECT * FROM users)",
+		"SELECT * FROM users WHERE EXISTS SELECT * FROM orders",
+		"SELECT * FROM users WHERE id IN (SELECT id FROM orders",
+	} {
+		if _, err := NewParser(NewLexer(sql)).Parse(); err == nil {
+			t.Errorf("%s: expected parse error", sql)
+		}
+	}
+}
+
+func TestParser_Joins(t *testing.T) {
+	stmt, err := NewParser(NewLexer("SELECT u.name, o.amount FROM users AS u JOIN orders o ON o.user_id = u.id LEFT OUTER JOIN items i USING (order_id, sku) CROSS JOIN colors")).Parse()
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	selectStmt := stmt.(*SelectStatement)
+	if selectStmt.From != "users" || selectStmt.Alias != "u" {
+		t.Errorf("unexpected FROM: %s AS %s", selectStmt.From, selectStmt.Alias)
+	}
+	expected := []*Join{
+		{
+			Type:  "INNER",
+			Table: "orders",
+			Alias: "o",
+			On: &BinaryExpression{
+				Left:     &QualifiedIdentifier{TableName: "o", ColumnName: "user_id"},
+				Operator: "=",
+				Right:    &QualifiedIdentifier{TableName: "u", ColumnName: "id"},
+			},
+		},
+		{Type: "LEFT", Table: "items", Alias: "i", Using: []string{"order_id", "sku"}},
+		{Type: "CROSS", Table: "colors"},
+	}
+	if !reflect.DeepEqual(selectStmt.Joins, expected) {
+		t.Errorf("unexpected joins: %#v", selectStmt.Joins)
+	}
+
+	stmt, err = NewParser(NewLexer("SELECT * FROM a RIGHT JOIN b ON a.id = b.id FULL OUTER JOIN (SELECT * FROM c) AS x ON x.id = b.id")).Parse()
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	joins := stmt.(*SelectStatement).Joins
+	if len(joins) != 2 || joins[0].Type != "RIGHT" || joins[1].Type != "FULL" || joins[1].Table != "x" || joins[1].Subquery == nil {
+		t.Errorf("unexpected joins: %#v", joins)
+	}
+
+	for _, sql := range []string{
+		"SELECT * FROM a JOIN b",
+		"SELECT * FROM a LEFT b ON a.id = b.id",
+		"SELECT * FROM a CROSS JOIN b ON a.id = b.id",
+		"SELECT * FROM a JOIN b USING ()",
+		"SELECT * FROM a AS",
+	} {
+		if _, err := NewParser(NewLexer(sql)).Parse(); err == nil {
+			t.Errorf("%s: expected parse error", sql)
+		}
+	}
+}
+
+func TestParser_DistinctOrderByLimitOffset(t *testing.T) {
+	stmt, err := NewParser(NewLexer("SELECT DISTINCT u.name, price * qty AS total FROM users u ORDER BY u.name, total DESC, 2 ASC LIMIT 10 OFFSET 20")).Parse()
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	selectStmt := stmt.(*SelectStatement)
+	if !selectStmt.Distinct || len(selectStmt.Columns) != 2 {
+		t.Errorf("expected DISTINCT with 2 columns, got %v %d", selectStmt.Distinct, len(selectStmt.Columns))
+	}
+	expected := []OrderByClause{
+		{Expression: &QualifiedIdentifier{TableName: "u", ColumnName: "name"}, Asc: true},
+		{Column: "total", Expression: &Identifier{Value: "total"}, Asc: false},
+		{Expression: &IntegerLiteral{Value: 2}, Asc: true},
+	}
+	if !reflect.DeepEqual(selectStmt.OrderBy, expected) {
+		t.Errorf("unexpected ORDER BY: %#v", selectStmt.OrderBy)
+	}
+	if selectStmt.Limit == nil || *selectStmt.Limit != 10 || selectStmt.Offset == nil || *selectStmt.Offset != 20 {
+		t.Errorf("expected LIMIT 10 OFFSET 20, got %v %v", selectStmt.Limit, selectStmt.Offset)
+	}
+
+	// OFFSET だけでも書ける
+	stmt, err = NewParser(NewLexer("SELECT * FROM users OFFSET 5")).Parse()
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	if s := stmt.(*SelectStatement); s.Limit != nil || s.Offset == nil || *s.Offset != 5 {
+		t.Errorf("expected only OFFSET 5, got %v %v", s.Limit, s.Offset)
+	}
+
+	for _, sql := range []string{
+		"SELECT * FROM users LIMIT",
+		"SELECT * FROM users LIMIT name",
+		"SELECT * FROM users LIMIT 1 OFFSET",
+		"SELECT * FROM users ORDER BY",
+	} {
+		if _, err := NewParser(NewLexer(sql)).Parse(); err == nil {
+			t.Errorf("%s: expected parse error", sql)
+		}
+	}
+}
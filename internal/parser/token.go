@@ -18,27 +18,35 @@ const (
 	TOKEN_BOOL    // true, false, etc.
 
 	// キーワード(DML)
-	TOKEN_SELECT // SELECT
-	TOKEN_INSERT // INSERT
-	TOKEN_UPDATE // UPDATE
-	TOKEN_DELETE // DELETE
-	TOKEN_FROM   // FROM
-	TOKEN_WHERE  // WHERE
-	TOKEN_GROUP  // GROUP
-	TOKEN_HAVING // HAVING
-	TOKEN_SET    // SET
-	TOKEN_VALUES // VALUES
-	TOKEN_INTO   // INTO
+	TOKEN_SELECT   // SELECT
+	TOKEN_INSERT   // INSERT
+	TOKEN_UPDATE   // UPDATE
+	TOKEN_DELETE   // DELETE
+	TOKEN_FROM     // FROM
+	TOKEN_WHERE    // WHERE
+	TOKEN_GROUP    // GROUP
+	TOKEN_HAVING   // HAVING
+	TOKEN_SET      // SET
+	TOKEN_VALUES   // VALUES
+	TOKEN_INTO     // INTO
+	TOKEN_DISTINCT // DISTINCT
 	// キーワード(トランザクション)
-	TOKEN_BEGIN    // BEGIN
-	TOKEN_COMMIT   // COMMIT
-	TOKEN_ROLLBACK // ROLLBACK
+	TOKEN_BEGIN       // BEGIN
+	TOKEN_COMMIT      // COMMIT
+	TOKEN_ROLLBACK    // ROLLBACK
+	TOKEN_TRANSACTION // TRANSACTION
+	TOKEN_ISOLATION   // ISOLATION
+	TOKEN_SAVEPOINT   // SAVEPOINT
+	TOKEN_RELEASE     // RELEASE
 	// キーワード(DDL)
 	TOKEN_CREATE  // CREATE
 	TOKEN_DROP    // DROP
 	TOKEN_ALTER   // ALTER
 	TOKEN_TABLE   // TABLE
 	TOKEN_EXPLAIN // EXPLAIN
+	TOKEN_INDEX   // INDEX
+	TOKEN_UNIQUE  // UNIQUE
+	TOKEN_ANALYZE // ANALYZE
 	// 集約関数
 	TOKEN_COUNT // COUNT
 	TOKEN_SUM   // SUM
@@ -50,6 +58,13 @@ const (
 	TOKEN_OR      //OR
 	TOKEN_NOT     // NOT
 	TOKEN_NULL    // NULL
+	TOKEN_IS      // IS
+	TOKEN_AS      // AS
+	TOKEN_LIKE    // LIKE
+	TOKEN_ESCAPE  // ESCAPE
+	TOKEN_IN      // IN
+	TOKEN_BETWEEN // BETWEEN
+	TOKEN_EXISTS  // EXISTS
 	TOKEN_PRIMARY // PRIMARY KEY
 	TOKEN_KEY     // KEY
 	TOKEN_ORDER   // ORDER
@@ -60,6 +75,13 @@ const (
 	TOKEN_OFFSET  // OFFSET
 	TOKEN_JOIN    // JOIN
 	TOKEN_ON      // ON
+	TOKEN_INNER   // INNER
+	TOKEN_LEFT    // LEFT
+	TOKEN_RIGHT   // RIGHT
+	TOKEN_FULL    // FULL
+	TOKEN_OUTER   // OUTER
+	TOKEN_CROSS   // CROSS
+	TOKEN_USING   // USING
 	// 演算子
 	TOKEN_EQ  // =
 	TOKEN_NEQ // != or <>
@@ -67,6 +89,11 @@ const (
 	TOKEN_GT  // >
 	TOKEN_LTE // <=
 	TOKEN_GTE // >=
+	// 算術演算子（* は TOKEN_ASTERISK を使う）
+	TOKEN_PLUS    // +
+	TOKEN_MINUS   // -
+	TOKEN_SLASH   // /
+	TOKEN_PERCENT // %
 
 	// セパレータ
 	TOKEN_COMMA     // ,
@@ -88,27 +115,35 @@ func newToken(tokenType TokenType, literal string) token {
 
 var keywords = map[string]TokenType{
 	// DML
-	"SELECT": TOKEN_SELECT,
-	"INSERT": TOKEN_INSERT,
-	"UPDATE": TOKEN_UPDATE,
-	"DELETE": TOKEN_DELETE,
-	"FROM":   TOKEN_FROM,
-	"WHERE":  TOKEN_WHERE,
-	"GROUP":  TOKEN_GROUP,
-	"HAVING": TOKEN_HAVING,
-	"SET":    TOKEN_SET,
-	"VALUES": TOKEN_VALUES,
-	"INTO":   TOKEN_INTO,
+	"SELECT":   TOKEN_SELECT,
+	"INSERT":   TOKEN_INSERT,
+	"UPDATE":   TOKEN_UPDATE,
+	"DELETE":   TOKEN_DELETE,
+	"FROM":     TOKEN_FROM,
+	"WHERE":    TOKEN_WHERE,
+	"GROUP":    TOKEN_GROUP,
+	"HAVING":   TOKEN_HAVING,
+	"SET":      TOKEN_SET,
+	"VALUES":   TOKEN_VALUES,
+	"INTO":     TOKEN_INTO,
+	"DISTINCT": TOKEN_DISTINCT,
 	// transaction
-	"BEGIN":    TOKEN_BEGIN,
-	"COMMIT":   TOKEN_COMMIT,
-	"ROLLBACK": TOKEN_ROLLBACK,
+	"BEGIN":       TOKEN_BEGIN,
+	"COMMIT":      TOKEN_COMMIT,
+	"ROLLBACK":    TOKEN_ROLLBACK,
+	"TRANSACTION": TOKEN_TRANSACTION,
+	"ISOLATION":   TOKEN_ISOLATION,
+	"SAVEPOINT":   TOKEN_SAVEPOINT,
+	"RELEASE":     TOKEN_RELEASE,
 	// DDL
 	"CREATE":  TOKEN_CREATE,
 	"DROP":    TOKEN_DROP,
 	"ALTER":   TOKEN_ALTER,
 	"TABLE":   TOKEN_TABLE,
 	"EXPLAIN": TOKEN_EXPLAIN,
+	"INDEX":   TOKEN_INDEX,
+	"UNIQUE":  TOKEN_UNIQUE,
+	"ANALYZE": TOKEN_ANALYZE,
 	// 集約関数
 	"COUNT": TOKEN_COUNT,
 	"SUM":   TOKEN_SUM,
@@ -121,6 +156,15 @@ var keywords = map[string]TokenType{
 	"OR":      TOKEN_OR,
 	"NOT":     TOKEN_NOT,
 	"NULL":    TOKEN_NULL,
+	"TRUE":    TOKEN_BOOL,
+	"FALSE":   TOKEN_BOOL,
+	"IS":      TOKEN_IS,
+	"AS":      TOKEN_AS,
+	"LIKE":    TOKEN_LIKE,
+	"ESCAPE":  TOKEN_ESCAPE,
+	"IN":      TOKEN_IN,
+	"BETWEEN": TOKEN_BETWEEN,
+	"EXISTS":  TOKEN_EXISTS,
 	"PRIMARY": TOKEN_PRIMARY,
 	"KEY":     TOKEN_KEY,
 	"ORDER":   TOKEN_ORDER,
@@ -131,6 +175,13 @@ var keywords = map[string]TokenType{
 	"OFFSET":  TOKEN_OFFSET,
 	"JOIN":    TOKEN_JOIN,
 	"ON":      TOKEN_ON,
+	"INNER":   TOKEN_INNER,
+	"LEFT":    TOKEN_LEFT,
+	"RIGHT":   TOKEN_RIGHT,
+	"FULL":    TOKEN_FULL,
+	"OUTER":   TOKEN_OUTER,
+	"CROSS":   TOKEN_CROSS,
+	"USING":   TOKEN_USING,
 	// 演算子
 	"EQ":  TOKEN_EQ,
 	"NEQ": TOKEN_NEQ,
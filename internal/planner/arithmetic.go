@@ -0,0 +1,207 @@
+package planner
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
+)
+
+// evaluateArithmetic は四則演算と剰余（+, -, *, /, %）を評価する
+// どちらかが NULL なら NULL を返し、0 で割ると storage.ErrDivisionByZero を返す
+// 整数同士は整数（int 同士なら int）、浮動小数点数を含めば float64、整数と DECIMAL なら DECIMAL で計算する
+// DATE に整数を足し引きすると日数だけずらした DATE、DATE 同士の差は日数になる
+func evaluateArithmetic(operator string, left, right any) (any, error) {
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	return arithmetic(operator, left, right)
+}
+
+func arithmetic(operator string, left, right any) (any, error) {
+	if l, ok := left.(string); ok && operator == "+" {
+		if r, ok := right.(string); ok {
+			return l + r, nil
+		}
+	}
+	if d, ok := left.(storage.DateValue); ok {
+		return dateArithmetic(operator, d, right)
+	}
+	if d, ok := right.(storage.DateValue); ok && operator == "+" {
+		return dateArithmetic(operator, d, left)
+	}
+
+	switch {
+	case isIntegerValue(left) && isIntegerValue(right):
+		l, r := toInt64(left), toInt64(right)
+		result, err := integerArithmetic(operator, l, r)
+		if err != nil {
+			return nil, err
+		}
+		_, lInt := left.(int)
+		_, rInt := right.(int)
+		if lInt && rInt {
+			return int(result), nil
+		}
+		return result, nil
+	case isFloatValue(left) || isFloatValue(right):
+		l, lok := toFloat64(left)
+		r, rok := toFloat64(right)
+		if !lok || !rok {
+			break
+		}
+		return floatArithmetic(operator, l, r)
+	default:
+		l, lok := toDecimal(left)
+		r, rok := toDecimal(right)
+		if !lok || !rok {
+			break
+		}
+		return decimalArithmetic(operator, l, r)
+	}
+	return nil, fmt.Errorf("unsupported operand types for %s: %T and %T", operator, left, right)
+}
+
+func integerArithmetic(operator string, l, r int64) (int64, error) {
+	switch operator {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		if r == 0 {
+			return 0, storage.ErrDivisionByZero
+		}
+		return l / r, nil
+	case "%":
+		if r == 0 {
+			return 0, storage.ErrDivisionByZero
+		}
+		return l % r, nil
+	}
+	return 0, fmt.Errorf("unknown operator: %s", operator)
+}
+
+func floatArithmetic(operator string, l, r float64) (any, error) {
+	switch operator {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		if r == 0 {
+			return nil, storage.ErrDivisionByZero
+		}
+		return l / r, nil
+	case "%":
+		if r == 0 {
+			return nil, storage.ErrDivisionByZero
+		}
+		return math.Mod(l, r), nil
+	}
+	return nil, fmt.Errorf("unknown operator: %s", operator)
+}
+
+func decimalArithmetic(operator string, l, r storage.DecimalValue) (any, error) {
+	switch operator {
+	case "+":
+		return l.Add(r)
+	case "-":
+		return l.Sub(r)
+	case "*":
+		return l.Mul(r)
+	case "/":
+		return l.Div(r)
+	case "%":
+		return l.Mod(r)
+	}
+	return nil, fmt.Errorf("unknown operator: %s", operator)
+}
+
+func dateArithmetic(operator string, date storage.DateValue, other any) (any, error) {
+	switch {
+	case isIntegerValue(other) && (operator == "+" || operator == "-"):
+		days := toInt64(other)
+		if operator == "-" {
+			days = -days
+		}
+		return storage.DateValue(int64(date) + days), nil
+	case operator == "-":
+		if d, ok := other.(storage.DateValue); ok {
+			return int64(date) - int64(d), nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported operand types for %s: %T and %T", operator, date, other)
+}
+
+func isIntegerValue(v any) bool {
+	switch v.(type) {
+	case int, int64:
+		return true
+	}
+	return false
+}
+
+func isFloatValue(v any) bool {
+	_, ok := v.(float64)
+	return ok
+}
+
+func toInt64(v any) int64 {
+	switch n := v.(type) {
+	case int:
+		return int64(n)
+	case int64:
+		return n
+	}
+	return 0
+}
+
+func toFloat64(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case storage.DecimalValue:
+		return n.Float64(), true
+	}
+	return 0, false
+}
+
+func toDecimal(v any) (storage.DecimalValue, bool) {
+	switch n := v.(type) {
+	case int, int64:
+		return storage.NewDecimal(toInt64(n), 0), true
+	case storage.DecimalValue:
+		return n, true
+	}
+	return storage.DecimalValue{}, false
+}
+
+// toValue は式の評価結果を storage.Value にする（extractValue の逆）
+func toValue(v any) storage.Value {
+	switch val := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return storage.StringValue(val)
+	case bool:
+		return storage.BoolValue(val)
+	case int:
+		return storage.Int64Value(val)
+	case int64:
+		return storage.Int64Value(val)
+	case float64:
+		return storage.Float64Value(val)
+	case storage.Value:
+		return val
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package planner
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
+)
+
+func TestEvaluateArithmetic(t *testing.T) {
+	date, _ := storage.ParseDate("2024-02-28")
+	tests := []struct {
+		name     string
+		left     any
+		operator string
+		right    any
+		expected any
+	}{
+		{"int", 7, "/", 2, 3},
+		{"int and int64", 7, "+", int64(1), int64(8)},
+		{"int and float", 1, "+", 0.5, 1.5},
+		{"decimal and int", storage.NewDecimal(150, 2), "*", 2, storage.NewDecimal(300, 2)},
+		{"decimal and decimal", storage.NewDecimal(1, 1), "+", storage.NewDecimal(2, 1), storage.NewDecimal(3, 1)},
+		{"decimal and float", storage.NewDecimal(5, 1), "-", 0.25, 0.25},
+		{"date plus days", date, "+", 2, storage.DateValue(int32(date) + 2)},
+		{"days plus date", 1, "+", date, storage.DateValue(int32(date) + 1)},
+		{"date minus date", date, "-", storage.DateValue(int32(date) - 30), int64(30)},
+		{"null", nil, "+", 1, nil},
+		{"int modulo", -7, "%", 3, -1},
+		{"float modulo", 7.5, "%", 2, 1.5},
+		{"decimal modulo", storage.NewDecimal(1050, 2), "%", 4, storage.NewDecimal(250, 2)},
+		{"null divided by zero", nil, "/", 0, nil},
+		{"concat", "a", "+", "b", "ab"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := evaluateArithmetic(tt.operator, tt.left, tt.right)
+			if err != nil {
+				t.Fatalf("evaluateArithmetic failed: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("expected %#v, got %#v", tt.expected, got)
+			}
+		})
+	}
+
+	// 0 で割るとエラーになる
+	for _, left := range []any{7, int64(7), 7.5, storage.NewDecimal(7, 0)} {
+		for _, operator := range []string{"/", "%"} {
+			if _, err := evaluateArithmetic(operator, left, 0); !errors.Is(err, storage.ErrDivisionByZero) {
+				t.Errorf("%v %s 0: expected ErrDivisionByZero, got %v", left, operator, err)
+			}
+		}
+	}
+	if _, err := evaluateArithmetic("*", date, 2); err == nil {
+		t.Error("expected an error for DATE * INT")
+	}
+	if _, err := evaluateArithmetic("+", true, 1); err == nil {
+		t.Error("expected an error for BOOL + INT")
+	}
+}
+
+func TestCompareMixedValues(t *testing.T) {
+	if !valuesEqual(storage.NewDecimal(150, 2), storage.NewDecimal(15, 1)) {
+		t.Error("1.50 and 1.5 should be equal")
+	}
+	if !valuesEqual(3, int64(3)) {
+		t.Error("int and int64 should compare by value")
+	}
+	if valuesEqual(1, "1") {
+		t.Error("a number and a string should not be equal")
+	}
+	if compareValues(2.5, storage.NewDecimal(3, 0)) >= 0 {
+		t.Error("2.5 should be less than 3")
+	}
+	if compareValues(storage.DateValue(0), "1970-01-02") >= 0 {
+		t.Error("DATE should compare with a date string")
+	}
+}
+
+func TestLiteralToKey(t *testing.T) {
+	price := storage.NewColumn("price", storage.ColumnTypeDecimal, 10, false)
+	price.SetScale(2)
+	day := storage.NewColumn("day", storage.ColumnTypeDate, 0, false)
+	id := storage.NewColumn("id", storage.ColumnTypeInt32, 0, false)
+	tests := []struct {
+		name  string
+		value any
+		col   *storage.Column
+		want  storage.Value
+		ok    bool
+	}{
+		{"decimal", storage.NewDecimal(15, 1), price, storage.NewDecimal(150, 2), true},
+		{"int to decimal", 3, price, storage.NewDecimal(300, 2), true},
+		{"rounded decimal", storage.NewDecimal(1555, 3), price, nil, false},
+		{"date string", "2024-01-31", day, storage.DateValue(19753), true},
+		{"fraction for int", storage.NewDecimal(15, 1), id, nil, false},
+		{"out of range int", 1 << 40, id, nil, false},
+	}
+	for _, tt := range tests {
+		got, ok := literalToKey(tt.value, tt.col)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("%s: literalToKey = %#v, %v; want %#v, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
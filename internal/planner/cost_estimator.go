@@ -8,6 +8,10 @@ import (
 
 type CostEstimator interface {
 	EstimateCost(node PlanNode) (Cost, error)
+	// ChooseJoinAlgorithm は結合の方式ごとのコストを見積もり、最も安い方式を返す
+	ChooseJoinAlgorithm(node *JoinNode) (JoinAlgorithm, error)
+	// Selectivity は node の出力のうち条件を満たす行の割合を見積もる
+	Selectivity(condition Expression, node PlanNode) float64
 }
 
 type costEstimator struct {
@@ -22,6 +26,8 @@ func (e *costEstimator) EstimateCost(node PlanNode) (Cost, error) {
 	switch node := node.(type) {
 	case *ScanNode:
 		return e.estimateScanCost(node)
+	case *IndexScanNode:
+		return e.estimateIndexScanCost(node)
 	case *FilterNode:
 		return e.estimateFilterCost(node)
 	case *ProjectNode:
@@ -30,6 +36,16 @@ func (e *costEstimator) EstimateCost(node PlanNode) (Cost, error) {
 		return e.estimateJoinCost(node)
 	case *AggregateNode:
 		return e.estimateAggregateCost(node)
+	case *SubqueryScanNode:
+		return e.EstimateCost(node.Child)
+	case *SortNode:
+		return e.estimateSortCost(node)
+	case *DistinctNode:
+		return e.EstimateCost(node.Child)
+	case *LimitNode:
+		return e.estimateLimitCost(node)
+	case *EmptyNode:
+		return NewCost(0, 1, 1, 1), nil
 	default:
 		return nil, fmt.Errorf("unsupported plan node type: %T", node)
 	}
@@ -37,21 +53,57 @@ func (e *costEstimator) EstimateCost(node PlanNode) (Cost, error) {
 
 // estimateScanCost はテーブルスキャンのコストを推定する
 func (e *costEstimator) estimateScanCost(node *ScanNode) (Cost, error) {
-	table, err := e.catalog.GetTable(node.TableName)
+	rowCost, err := e.tableRowCount(node.TableName)
 	if err != nil {
 		return nil, err
 	}
-	rowCost := float64(table.GetRowCost())
+	return NewCost(rowCost, 1, 1, 1), nil
+}
+
+// tableRowCount はテーブルの行数を返す
+// ANALYZE で集めた行数があればそれを使い、なければテーブルが管理している行数を使う
+func (e *costEstimator) tableRowCount(tableName string) (float64, error) {
+	if stats := e.catalog.GetStatistics(tableName); stats != nil {
+		return float64(stats.RowCount), nil
+	}
+	table, err := e.catalog.GetTable(tableName)
+	if err != nil {
+		return 0, err
+	}
+	if table == nil {
+		return 0, fmt.Errorf("table not found: %s", tableName)
+	}
+	return float64(table.GetRowCost()), nil
+}
+
+// estimateIndexScanCost はインデックススキャンのコストを推定する
+// 統計情報があればキー範囲の選択率を見積もり、なければ等価条件は1%、範囲条件は30%の行に絞り込めると仮定する
+func (e *costEstimator) estimateIndexScanCost(node *IndexScanNode) (Cost, error) {
+	rowCost, err := e.tableRowCount(node.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if stats := e.catalog.GetStatistics(node.TableName); stats != nil {
+		if s, ok := indexScanSelectivity(stats, node); ok {
+			return NewCost(rowCost*s, 1, 1, 1), nil
+		}
+	}
+	if node.Range.IsPoint() {
+		rowCost *= 0.01
+	} else {
+		rowCost *= 0.3
+	}
 	return NewCost(rowCost, 1, 1, 1), nil
 }
 
 // estimateFilterCost はフィルタのコストを推定する
+// 条件の選択率を見積もれなければ子ノードの行数の10%とする
 func (e *costEstimator) estimateFilterCost(node *FilterNode) (Cost, error) {
 	childCost, err := e.EstimateCost(node.Child)
 	if err != nil {
 		return nil, err
 	}
-	childCost.MultiplyRowCount(0.1) // フィルタのコストは子ノードのコストの10%
+	childCost.MultiplyRowCount(e.Selectivity(node.Condition, node.Child))
 	return childCost, nil
 }
 
@@ -61,6 +113,8 @@ func (e *costEstimator) estimateProjectCost(node *ProjectNode) (Cost, error) {
 }
 
 // estimateJoinCost はJOINのコストを推定する
+// 結合結果の行数は左の行数×右の行数に結合条件の選択率を掛けて見積もる
+// 外部結合は相手のない行も返すので、残す側の行数を下回らない
 func (e *costEstimator) estimateJoinCost(node *JoinNode) (Cost, error) {
 	leftCost, err := e.EstimateCost(node.Left)
 	if err != nil {
@@ -70,7 +124,82 @@ func (e *costEstimator) estimateJoinCost(node *JoinNode) (Cost, error) {
 	if err != nil {
 		return nil, err
 	}
-	return NewCost(leftCost.GetRowCost()*rightCost.GetRowCost(), 1, 1, 1), nil
+	left, right := leftCost.GetRowCost(), rightCost.GetRowCost()
+	cpuCost := joinCPUCost(node.Algorithm, left, right)
+	// セミ結合・反結合は左の行を増やさない
+	if node.JoinType == JoinTypeSemi || node.JoinType == JoinTypeAnti {
+		return NewCost(left, cpuCost, 1, 1), nil
+	}
+	return NewCost(joinRowCount(node.JoinType, left, right, e.joinSelectivity(node)), cpuCost, 1, 1), nil
+}
+
+// joinSelectivity は結合条件を満たす左右の行の組の割合を見積もる（条件がなければ 1）
+func (e *costEstimator) joinSelectivity(node *JoinNode) float64 {
+	if node.Condition == nil {
+		return 1
+	}
+	// 結合条件は左右を結合した行で評価する
+	return e.Selectivity(node.Condition, &JoinNode{Left: node.Left, Right: node.Right, JoinType: JoinTypeInner})
+}
+
+// joinRowCount は結合の種類ごとに結合結果の行数を見積もる
+func joinRowCount(joinType JoinType, left, right, selectivity float64) float64 {
+	rows := left * right * selectivity
+	switch joinType {
+	case JoinTypeLeft:
+		return max(rows, left)
+	case JoinTypeRight:
+		return max(rows, right)
+	case JoinTypeFull:
+		return max(rows, left, right)
+	}
+	return rows
+}
+
+// ChooseJoinAlgorithm は結合の方式ごとのコストを見積もり、最も安い方式を返す
+func (e *costEstimator) ChooseJoinAlgorithm(node *JoinNode) (JoinAlgorithm, error) {
+	leftCost, err := e.EstimateCost(node.Left)
+	if err != nil {
+		return "", err
+	}
+	rightCost, err := e.EstimateCost(node.Right)
+	if err != nil {
+		return "", err
+	}
+	return chooseJoinAlgorithm(node, leftCost.GetRowCost(), rightCost.GetRowCost()), nil
+}
+
+// chooseJoinAlgorithm は左右の推定行数から最も安い結合の方式を返す
+// ハッシュ結合とマージ結合は等価条件がある結合だけ、マージ結合は左右が結合キーの順に並んでいるときだけ候補にする
+// コストが同じなら入れ子ループ、マージ結合、ハッシュ結合の順に選ぶ
+func chooseJoinAlgorithm(node *JoinNode, left, right float64) JoinAlgorithm {
+	candidates := []JoinAlgorithm{JoinAlgorithmNestedLoop}
+	if keys, _ := equiJoinKeys(node); len(keys) > 0 {
+		if keys, _ := mergeJoinKeys(node); len(keys) > 0 {
+			candidates = append(candidates, JoinAlgorithmMerge)
+		}
+		candidates = append(candidates, JoinAlgorithmHash)
+	}
+	best, bestCost := candidates[0], joinCPUCost(candidates[0], left, right)
+	for _, algorithm := range candidates[1:] {
+		if c := joinCPUCost(algorithm, left, right); c < bestCost {
+			best, bestCost = algorithm, c
+		}
+	}
+	return best
+}
+
+// joinCPUCost は結合の方式ごとに比べる行数を見積もる
+// 入れ子ループは左の行数×右の行数、ハッシュ結合はハッシュ表を作る右の行を2倍に数え、
+// マージ結合は整列済みの左右を1回ずつ読む
+func joinCPUCost(algorithm JoinAlgorithm, left, right float64) float64 {
+	switch algorithm {
+	case JoinAlgorithmHash:
+		return left + 2*right
+	case JoinAlgorithmMerge:
+		return left + right
+	}
+	return left * right
 }
 
 // estimateAggregateCost は集約のコストを推定する
@@ -86,3 +215,28 @@ func (e *costEstimator) estimateAggregateCost(node *AggregateNode) (Cost, error)
 	}
 	return NewCost(childCost.GetRowCost(), 1, 1, 1), nil
 }
+
+// estimateSortCost は並べ替えのコストを推定する（top-N なら先頭の行だけが残る）
+func (e *costEstimator) estimateSortCost(node *SortNode) (Cost, error) {
+	childCost, err := e.EstimateCost(node.Child)
+	if err != nil {
+		return nil, err
+	}
+	if node.Limit > 0 && float64(node.Limit) < childCost.GetRowCost() {
+		return NewCost(float64(node.Limit), 1, 1, 1), nil
+	}
+	return childCost, nil
+}
+
+// estimateLimitCost は LIMIT と OFFSET のコストを推定する
+func (e *costEstimator) estimateLimitCost(node *LimitNode) (Cost, error) {
+	childCost, err := e.EstimateCost(node.Child)
+	if err != nil {
+		return nil, err
+	}
+	rows := max(childCost.GetRowCost()-float64(node.Offset), 0)
+	if node.Count >= 0 {
+		rows = min(rows, float64(node.Count))
+	}
+	return NewCost(rows, 1, 1, 1), nil
+}
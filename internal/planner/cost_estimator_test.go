@@ -1,6 +1,7 @@
 package planner
 
 import (
+	"math"
 	"os"
 	"testing"
 
@@ -305,3 +306,145 @@ func TestCostEstimatorEmptyTable(t *testing.T) {
 		t.Errorf("Expected RowCost 0.0, got %f", cost.GetRowCost())
 	}
 }
+
+func TestCostEstimatorChooseJoinAlgorithm(t *testing.T) {
+	cat, cleanup := setupTestCatalogWithData(t)
+	defer cleanup()
+
+	ordersSchema := storage.NewSchema("orders", []storage.Column{
+		*storage.NewColumn("id", storage.ColumnTypeInt32, 0, false),
+		*storage.NewColumn("user_id", storage.ColumnTypeInt64, 0, false),
+	})
+	cat.CreateTable("orders", ordersSchema)
+	ordersTable, _ := cat.GetTable("orders")
+	for i := 0; i < 20; i++ {
+		ordersTable.Insert(storage.NewRow([]storage.Value{storage.Int32Value(int32(i)), storage.Int64Value(int64(i % 10))}))
+	}
+	usersSchema, _ := cat.GetSchema("users")
+	users := &ScanNode{TableName: "users", TableSchema: usersSchema}
+	orders := &ScanNode{TableName: "orders", TableSchema: ordersSchema}
+	// インデックススキャンはキーの順に行を返す
+	sortedUsers := &IndexScanNode{TableName: "users", TableSchema: usersSchema, IndexName: "users_id", Columns: []string{"id"},
+		Range: storage.KeyRange{Low: []storage.Value{storage.Int32Value(0)}, LowInclusive: true}}
+	sortedOrders := &IndexScanNode{TableName: "orders", TableSchema: ordersSchema, IndexName: "orders_user_id", Columns: []string{"user_id"},
+		Range: storage.KeyRange{Low: []storage.Value{storage.Int64Value(0)}, LowInclusive: true}}
+	equi := &BinaryExpr{
+		Left:     &ColumnRef{TableName: "users", Name: "id"},
+		Operator: "=",
+		Right:    &ColumnRef{TableName: "orders", Name: "user_id"},
+	}
+
+	tests := []struct {
+		name     string
+		join     *JoinNode
+		expected JoinAlgorithm
+	}{
+		// 10 * 20 = 200 より 10 + 2 * 20 = 50 のほうが安い
+		{"equi join", &JoinNode{Left: users, Right: orders, JoinType: JoinTypeInner, Condition: equi}, JoinAlgorithmHash},
+		{"left join", &JoinNode{Left: users, Right: orders, JoinType: JoinTypeLeft, Condition: equi}, JoinAlgorithmHash},
+		{"no condition", &JoinNode{Left: users, Right: orders, JoinType: JoinTypeCross}, JoinAlgorithmNestedLoop},
+		{"non-equi join", &JoinNode{Left: users, Right: orders, JoinType: JoinTypeInner,
+			Condition: &BinaryExpr{Left: &ColumnRef{Name: "id"}, Operator: "<", Right: &ColumnRef{Name: "user_id"}}}, JoinAlgorithmNestedLoop},
+		// 3 * 6 = 18 より整列済みの 3 + 6 = 9 のほうが安い
+		{"sorted inputs", &JoinNode{Left: sortedUsers, Right: sortedOrders, JoinType: JoinTypeInner, Condition: equi}, JoinAlgorithmMerge},
+		// 1行だけなら入れ子ループで十分
+		{"single row", &JoinNode{Left: &IndexScanNode{TableName: "users", TableSchema: usersSchema, Columns: []string{"id"},
+			Range: storage.KeyRange{Low: []storage.Value{storage.Int32Value(1)}, High: []storage.Value{storage.Int32Value(1)}, LowInclusive: true, HighInclusive: true}},
+			Right: orders, JoinType: JoinTypeInner, Condition: equi}, JoinAlgorithmNestedLoop},
+	}
+	estimator := NewCostEstimator(cat)
+	for _, tt := range tests {
+		algorithm, err := estimator.ChooseJoinAlgorithm(tt.join)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if algorithm != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.expected, algorithm)
+		}
+	}
+
+	// 結合キーは左右のカラムに分ける（右のカラムを先に書いても同じ）
+	join := &JoinNode{Left: users, Right: orders, JoinType: JoinTypeInner,
+		Condition: &BinaryExpr{Left: &ColumnRef{Name: "user_id"}, Operator: "=", Right: &ColumnRef{TableName: "users", Name: "id"}}}
+	leftKeys, rightKeys := equiJoinKeys(join)
+	if len(leftKeys) != 1 || leftKeys[0].String() != "users.id" || rightKeys[0].String() != "user_id" {
+		t.Errorf("unexpected join keys: %v %v", leftKeys, rightKeys)
+	}
+
+	// プランナーは選んだ方式と結合キーを JoinNode に設定する
+	plan, err := planSQL(t, NewPlanner(cat), "SELECT * FROM users JOIN orders ON orders.user_id = users.id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.String() != "HashJoin(Scan(users), Scan(orders))" || len(plan.(*JoinNode).LeftKeys) != 1 {
+		t.Errorf("unexpected plan: %s", plan.String())
+	}
+}
+
+func TestCostEstimatorWithStatistics(t *testing.T) {
+	cat, cleanup := setupTestCatalogWithData(t)
+	defer cleanup()
+	schema, _ := cat.GetSchema("users")
+	table, _ := cat.GetTable("users")
+	rows, _ := table.Scan()
+	if err := cat.SetStatistics("users", storage.CollectStatistics(schema, rows)); err != nil {
+		t.Fatal(err)
+	}
+	estimator := NewCostEstimator(cat)
+	scan := &ScanNode{TableName: "users", TableSchema: schema}
+	id := &ColumnRef{Name: "id"}
+
+	// id は 0〜9 の 10 行、name はすべて 'user'
+	tests := []struct {
+		name      string
+		condition Expression
+		expected  float64
+	}{
+		{"equal", &BinaryExpr{Left: id, Operator: "=", Right: &Literal{Value: 5}}, 1},
+		{"not equal", &BinaryExpr{Left: id, Operator: "<>", Right: &Literal{Value: 5}}, 9},
+		{"out of range", &BinaryExpr{Left: id, Operator: "=", Right: &Literal{Value: 50}}, 0},
+		{"less than", &BinaryExpr{Left: id, Operator: "<", Right: &Literal{Value: 3}}, 3},
+		{"literal on the left", &BinaryExpr{Left: &Literal{Value: 3}, Operator: ">", Right: id}, 3},
+		{"between", &BetweenExpr{Expr: id, Low: &Literal{Value: 2}, High: &Literal{Value: 5}}, 4},
+		{"in", &InExpr{Expr: id, List: []Expression{&Literal{Value: 1}, &Literal{Value: 2}}}, 2},
+		{"not", &UnaryExpr{Operator: "NOT", Expr: &BinaryExpr{Left: id, Operator: "<", Right: &Literal{Value: 3}}}, 7},
+		{"or", &BinaryExpr{
+			Left:     &BinaryExpr{Left: id, Operator: "=", Right: &Literal{Value: 1}},
+			Operator: "OR",
+			Right:    &BinaryExpr{Left: &ColumnRef{Name: "name"}, Operator: "=", Right: &Literal{Value: "user"}},
+		}, 10},
+		{"is null", &IsNullExpr{Expr: &ColumnRef{Name: "name"}}, 0},
+	}
+	for _, tt := range tests {
+		cost, err := estimator.EstimateCost(&FilterNode{Condition: tt.condition, Child: scan})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if math.Abs(cost.GetRowCost()-tt.expected) > 0.5 {
+			t.Errorf("%s: expected about %v rows, got %v", tt.name, tt.expected, cost.GetRowCost())
+		}
+	}
+
+	// インデックススキャンはキー範囲に入る行数を見積もる
+	indexScan := &IndexScanNode{TableName: "users", TableSchema: schema, IndexName: "users_id", Columns: []string{"id"},
+		Range: storage.KeyRange{Low: []storage.Value{storage.Int32Value(5)}, LowInclusive: true}}
+	if cost, _ := estimator.EstimateCost(indexScan); math.Abs(cost.GetRowCost()-5) > 0.5 {
+		t.Errorf("expected about 5 rows from index scan, got %v", cost.GetRowCost())
+	}
+
+	// 等価結合は値の種類の多いほうのカラムで割る
+	ordersSchema := storage.NewSchema("orders", []storage.Column{
+		*storage.NewColumn("user_id", storage.ColumnTypeInt32, 0, false),
+	})
+	cat.CreateTable("orders", ordersSchema)
+	cat.SetStatistics("orders", &storage.TableStatistics{RowCount: 40, Columns: []storage.ColumnStatistics{{Name: "user_id", DistinctCount: 5}}})
+	join := &JoinNode{
+		Left:      scan,
+		Right:     &ScanNode{TableName: "orders", TableSchema: ordersSchema},
+		JoinType:  JoinTypeInner,
+		Condition: &BinaryExpr{Left: &ColumnRef{TableName: "users", Name: "id"}, Operator: "=", Right: &ColumnRef{TableName: "orders", Name: "user_id"}},
+	}
+	if cost, _ := estimator.EstimateCost(join); cost.GetRowCost() != 40 {
+		t.Errorf("expected 40 joined rows, got %v", cost.GetRowCost())
+	}
+}
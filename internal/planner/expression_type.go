@@ -0,0 +1,147 @@
+package planner
+
+import (
+	"strings"
+
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
+)
+
+// expressionColumn は式の結果を出力するカラムを作る
+// カラム参照は元のカラムの型とテーブル名を引き継ぎ、それ以外は式から型を推測する（常に NULL を許す）
+func expressionColumn(expr Expression, name string, input *storage.Schema) storage.Column {
+	if ref, ok := expr.(*ColumnRef); ok && input != nil {
+		if idx, err := input.FindColumn(ref.TableName, ref.Name); err == nil {
+			src := input.GetColumns()[idx]
+			col := storage.NewColumn(name, src.GetColumnType(), src.GetSize(), src.GetNullable())
+			col.SetScale(src.GetScale())
+			col.SetTableName(src.GetTableName())
+			return *col
+		}
+	}
+	colType, scale := expressionType(expr, input)
+	var size uint16
+	if colType == storage.ColumnTypeDecimal {
+		size = storage.MaxDecimalPrecision
+	}
+	col := storage.NewColumn(name, colType, size, true)
+	col.SetScale(scale)
+	return *col
+}
+
+// expressionType は式の結果の型（DECIMAL の場合はスケールも）を推測する
+// 推測できない式は VARCHAR とみなす
+func expressionType(expr Expression, input *storage.Schema) (storage.ColumnType, uint8) {
+	switch e := expr.(type) {
+	case *ColumnRef:
+		if input != nil {
+			if idx, err := input.FindColumn(e.TableName, e.Name); err == nil {
+				col := input.GetColumns()[idx]
+				return col.GetColumnType(), col.GetScale()
+			}
+		}
+	case *Literal:
+		return literalType(e.Value)
+	case *IsNullExpr, *LikeExpr, *InExpr, *BetweenExpr, *InSubqueryExpr, *ExistsExpr:
+		return storage.ColumnTypeBool, 0
+	case *ScalarSubqueryExpr:
+		col := e.Subquery.Plan.Schema().GetColumns()[0]
+		return col.GetColumnType(), col.GetScale()
+	case *UnaryExpr:
+		if strings.EqualFold(e.Operator, "NOT") {
+			return storage.ColumnTypeBool, 0
+		}
+		return expressionType(e.Expr, input)
+	case *CastExpr:
+		return e.Target.GetColumnType(), e.Target.GetScale()
+	case *FunctionExpr:
+		// DECIMAL のスケールは最初の引数に合わせる
+		args := make([]storage.ColumnType, len(e.Args))
+		var scale uint8
+		for i, arg := range e.Args {
+			var argScale uint8
+			args[i], argScale = expressionType(arg, input)
+			if i == 0 {
+				scale = argScale
+			}
+		}
+		return e.fn.returnType(args), scale
+	case *BinaryExpr:
+		switch strings.ToUpper(e.Operator) {
+		case "+", "-", "*", "/", "%":
+			left, leftScale := expressionType(e.Left, input)
+			right, rightScale := expressionType(e.Right, input)
+			return arithmeticType(left, right), max(leftScale, rightScale)
+		}
+		return storage.ColumnTypeBool, 0
+	}
+	return storage.ColumnTypeString, 0
+}
+
+// aggregateColumn は集約関数の結果を出力するカラムを作る（aggregate.go の結果の型に合わせる）
+// COUNT は BIGINT、整数の SUM / AVG / MAX / MIN は BIGINT、それ以外は元のカラムの型になる
+func aggregateColumn(agg AggregateExpression, input *storage.Schema) storage.Column {
+	colType, scale := storage.ColumnTypeInt64, uint8(0)
+	if !strings.EqualFold(agg.Function, "COUNT") && input != nil {
+		if idx, err := input.FindColumn("", agg.Column); err == nil {
+			src := input.GetColumns()[idx]
+			colType, scale = src.GetColumnType(), src.GetScale()
+		}
+		switch colType {
+		case storage.ColumnTypeInt32:
+			colType = storage.ColumnTypeInt64
+		case storage.ColumnTypeFloat32:
+			if !strings.EqualFold(agg.Function, "MAX") && !strings.EqualFold(agg.Function, "MIN") {
+				colType = storage.ColumnTypeFloat64
+			}
+		}
+	}
+	var size uint16
+	if colType == storage.ColumnTypeDecimal {
+		size = storage.MaxDecimalPrecision
+	}
+	col := storage.NewColumn(agg.Name(), colType, size, true)
+	col.SetScale(scale)
+	return *col
+}
+
+// literalType はリテラル値の型を返す
+func literalType(value any) (storage.ColumnType, uint8) {
+	switch v := value.(type) {
+	case nil:
+		return storage.ColumnTypeString, 0
+	case int:
+		return storage.ColumnTypeInt32, 0
+	case storage.DecimalValue:
+		return storage.ColumnTypeDecimal, v.Scale
+	}
+	if v := toValue(value); v != nil {
+		return v.Type(), 0
+	}
+	return storage.ColumnTypeString, 0
+}
+
+// arithmeticType は算術演算の結果の型を返す（evaluateArithmetic の型の規則に合わせる）
+func arithmeticType(left, right storage.ColumnType) storage.ColumnType {
+	isText := func(t storage.ColumnType) bool {
+		return t == storage.ColumnTypeString || t == storage.ColumnTypeText
+	}
+	switch {
+	case isText(left) && isText(right):
+		if left == storage.ColumnTypeText || right == storage.ColumnTypeText {
+			return storage.ColumnTypeText
+		}
+		return storage.ColumnTypeString
+	case left == storage.ColumnTypeDate && right == storage.ColumnTypeDate:
+		return storage.ColumnTypeInt64
+	case left == storage.ColumnTypeDate || right == storage.ColumnTypeDate:
+		return storage.ColumnTypeDate
+	case left == storage.ColumnTypeFloat32 || left == storage.ColumnTypeFloat64 ||
+		right == storage.ColumnTypeFloat32 || right == storage.ColumnTypeFloat64:
+		return storage.ColumnTypeFloat64
+	case left == storage.ColumnTypeDecimal || right == storage.ColumnTypeDecimal:
+		return storage.ColumnTypeDecimal
+	case left == storage.ColumnTypeInt64 || right == storage.ColumnTypeInt64:
+		return storage.ColumnTypeInt64
+	}
+	return storage.ColumnTypeInt32
+}
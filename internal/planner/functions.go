@@ -0,0 +1,424 @@
+package planner
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
+)
+
+var (
+	ErrUnknownFunction = errors.New("unknown function")
+	ErrInvalidArgument = errors.New("invalid function argument")
+)
+
+// argKind は関数の引数に受け付ける値の種類
+type argKind int
+
+const (
+	argAny     argKind = iota // どの値でもよい
+	argString                 // 文字列（VARCHAR / TEXT）
+	argInteger                // 整数
+	argNumeric                // 数値（整数・浮動小数点数・DECIMAL）
+	argDate                   // 日付を持つ値（DATE / TIMESTAMP）
+	argTime                   // 時刻を持つ値（TIME / TIMESTAMP）
+)
+
+func (k argKind) String() string {
+	switch k {
+	case argString:
+		return "a string"
+	case argInteger:
+		return "an integer"
+	case argNumeric:
+		return "a number"
+	case argDate:
+		return "a DATE or TIMESTAMP"
+	case argTime:
+		return "a TIME or TIMESTAMP"
+	}
+	return "any value"
+}
+
+// accepts は値がこの種類として受け付けられるかどうかを返す
+func (k argKind) accepts(value any) bool {
+	switch value.(type) {
+	case string:
+		return k == argAny || k == argString
+	case int, int64:
+		return k == argAny || k == argInteger || k == argNumeric
+	case float64, storage.DecimalValue:
+		return k == argAny || k == argNumeric
+	case storage.DateValue:
+		return k == argAny || k == argDate
+	case storage.TimeValue:
+		return k == argAny || k == argTime
+	case storage.TimestampValue:
+		return k == argAny || k == argDate || k == argTime
+	}
+	return k == argAny
+}
+
+// scalarFunction は組み込みのスカラー関数の定義
+type scalarFunction struct {
+	name       string
+	args       []argKind // 引数ごとの種類（可変長の場合は最後の種類を繰り返す）
+	minArgs    int
+	variadic   bool                                               // 引数の数に上限がないかどうか
+	nullable   bool                                               // NULL の引数も関数に渡すかどうか（false なら結果は NULL）
+	returnType func(args []storage.ColumnType) storage.ColumnType // 結果の型
+	eval       func(args []any) (any, error)
+}
+
+// scalarFunctions は組み込みのスカラー関数（名前は大文字）
+var scalarFunctions = map[string]*scalarFunction{}
+
+func registerFunction(fn *scalarFunction) {
+	scalarFunctions[fn.name] = fn
+}
+
+// lookupFunction は関数名から関数を探す
+func lookupFunction(name string) (*scalarFunction, error) {
+	fn, ok := scalarFunctions[strings.ToUpper(name)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFunction, name)
+	}
+	return fn, nil
+}
+
+// argumentError は関数名と引数の位置（1始まり）を含むエラーを作る
+func argumentError(name string, position int, format string, args ...any) error {
+	return fmt.Errorf("%w: %s argument %d %s", ErrInvalidArgument, name, position, fmt.Sprintf(format, args...))
+}
+
+// checkArgCount は引数の数を確かめる
+func (f *scalarFunction) checkArgCount(n int) error {
+	maxArgs := len(f.args)
+	switch {
+	case f.variadic && n < f.minArgs:
+		return fmt.Errorf("%w: %s expects at least %d arguments, got %d", ErrInvalidArgument, f.name, f.minArgs, n)
+	case !f.variadic && (n < f.minArgs || n > maxArgs):
+		if f.minArgs == maxArgs {
+			return fmt.Errorf("%w: %s expects %d arguments, got %d", ErrInvalidArgument, f.name, maxArgs, n)
+		}
+		return fmt.Errorf("%w: %s expects %d to %d arguments, got %d", ErrInvalidArgument, f.name, f.minArgs, maxArgs, n)
+	}
+	return nil
+}
+
+// argKind は i 番目（0始まり）の引数の種類を返す
+func (f *scalarFunction) argKind(i int) argKind {
+	if i >= len(f.args) {
+		return f.args[len(f.args)-1]
+	}
+	return f.args[i]
+}
+
+// checkArg は i 番目（0始まり）の引数の値を確かめる（NULL はここでは確かめない）
+func (f *scalarFunction) checkArg(i int, value any) error {
+	if value == nil {
+		return nil
+	}
+	if kind := f.argKind(i); !kind.accepts(value) {
+		return argumentError(f.name, i+1, "must be %s, got %s", kind, valueTypeName(value))
+	}
+	return nil
+}
+
+// call は引数を確かめてから関数を呼ぶ
+func (f *scalarFunction) call(args []any) (any, error) {
+	if err := f.checkArgCount(len(args)); err != nil {
+		return nil, err
+	}
+	for i, arg := range args {
+		if err := f.checkArg(i, arg); err != nil {
+			return nil, err
+		}
+		if arg == nil && !f.nullable {
+			return nil, nil
+		}
+	}
+	return f.eval(args)
+}
+
+// valueTypeName はエラーメッセージ用に値の型名を返す
+func valueTypeName(value any) string {
+	if _, ok := value.(int); ok {
+		return storage.ColumnTypeInt32.String()
+	}
+	if v := toValue(value); v != nil {
+		return v.Type().String()
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// FunctionExpr はスカラー関数の呼び出しを表す
+type FunctionExpr struct {
+	Name string
+	Args []Expression
+	fn   *scalarFunction
+}
+
+// NewFunctionExpr は関数名から関数を探して FunctionExpr を作る
+// 引数の数と、リテラルの引数の型はここで確かめる
+func NewFunctionExpr(name string, args []Expression) (*FunctionExpr, error) {
+	fn, err := lookupFunction(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := fn.checkArgCount(len(args)); err != nil {
+		return nil, err
+	}
+	for i, arg := range args {
+		if literal, ok := arg.(*Literal); ok {
+			if err := fn.checkArg(i, literal.Value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &FunctionExpr{Name: fn.name, Args: args, fn: fn}, nil
+}
+
+func (e *FunctionExpr) Evaluate(row *storage.Row, schema *storage.Schema) (any, error) {
+	args := make([]any, len(e.Args))
+	for i, arg := range e.Args {
+		value, err := arg.Evaluate(row, schema)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+	return e.fn.call(args)
+}
+
+func (e *FunctionExpr) String() string {
+	args := make([]string, len(e.Args))
+	for i, arg := range e.Args {
+		args[i] = arg.String()
+	}
+	return fmt.Sprintf("%s(%s)", e.Name, strings.Join(args, ", "))
+}
+
+// CastExpr は CAST(x AS type) を表す
+type CastExpr struct {
+	Expr   Expression
+	Target storage.Column // 変換先の型（サイズとスケールを含む）
+	Type   string         // 変換先の型名（表示用）
+}
+
+func (e *CastExpr) Evaluate(row *storage.Row, schema *storage.Schema) (any, error) {
+	value, err := e.Expr.Evaluate(row, schema)
+	if err != nil || value == nil {
+		return nil, err
+	}
+	casted, err := storage.ConvertValue(toValue(value), &e.Target)
+	if err != nil {
+		return nil, argumentError("CAST", 1, "cannot be converted to %s: %v", e.Type, err)
+	}
+	return extractValue(casted), nil
+}
+
+func (e *CastExpr) String() string {
+	return fmt.Sprintf("CAST(%s AS %s)", e.Expr.String(), e.Type)
+}
+
+// 結果の型を決める関数
+func returns(t storage.ColumnType) func([]storage.ColumnType) storage.ColumnType {
+	return func([]storage.ColumnType) storage.ColumnType { return t }
+}
+
+func returnsFirstArg(args []storage.ColumnType) storage.ColumnType {
+	if len(args) == 0 {
+		return storage.ColumnTypeString
+	}
+	return args[0]
+}
+
+func init() {
+	// 文字列関数
+	registerFunction(&scalarFunction{name: "UPPER", args: []argKind{argString}, minArgs: 1, returnType: returnsFirstArg,
+		eval: func(args []any) (any, error) { return strings.ToUpper(args[0].(string)), nil }})
+	registerFunction(&scalarFunction{name: "LOWER", args: []argKind{argString}, minArgs: 1, returnType: returnsFirstArg,
+		eval: func(args []any) (any, error) { return strings.ToLower(args[0].(string)), nil }})
+	registerFunction(&scalarFunction{name: "LENGTH", args: []argKind{argString}, minArgs: 1, returnType: returns(storage.ColumnTypeInt32),
+		eval: func(args []any) (any, error) { return utf8.RuneCountInString(args[0].(string)), nil }})
+	registerFunction(&scalarFunction{name: "TRIM", args: []argKind{argString}, minArgs: 1, returnType: returnsFirstArg,
+		eval: func(args []any) (any, error) { return strings.Trim(args[0].(string), " "), nil }})
+	registerFunction(&scalarFunction{name: "SUBSTR", args: []argKind{argString, argInteger, argInteger}, minArgs: 2, returnType: returnsFirstArg,
+		eval: substr})
+	registerFunction(&scalarFunction{name: "CONCAT", args: []argKind{argAny}, minArgs: 1, variadic: true, nullable: true, returnType: returns(storage.ColumnTypeString),
+		eval: concat})
+	registerFunction(&scalarFunction{name: "REPLACE", args: []argKind{argString, argString, argString}, minArgs: 3, returnType: returnsFirstArg,
+		eval: func(args []any) (any, error) {
+			return strings.ReplaceAll(args[0].(string), args[1].(string), args[2].(string)), nil
+		}})
+
+	// 数学関数
+	registerFunction(&scalarFunction{name: "ABS", args: []argKind{argNumeric}, minArgs: 1, returnType: returnsFirstArg, eval: abs})
+	registerFunction(&scalarFunction{name: "ROUND", args: []argKind{argNumeric, argInteger}, minArgs: 1, returnType: returnsFirstArg, eval: round})
+	for _, name := range []string{"CEIL", "CEILING"} {
+		registerFunction(&scalarFunction{name: name, args: []argKind{argNumeric}, minArgs: 1, returnType: returnsFirstArg,
+			eval: func(args []any) (any, error) { return roundToInteger(args[0], true) }})
+	}
+	registerFunction(&scalarFunction{name: "FLOOR", args: []argKind{argNumeric}, minArgs: 1, returnType: returnsFirstArg,
+		eval: func(args []any) (any, error) { return roundToInteger(args[0], false) }})
+	registerFunction(&scalarFunction{name: "MOD", args: []argKind{argNumeric, argNumeric}, minArgs: 2, returnType: modType, eval: mod})
+
+	// NULL を扱う関数
+	registerFunction(&scalarFunction{name: "COALESCE", args: []argKind{argAny}, minArgs: 1, variadic: true, nullable: true, returnType: returnsFirstArg,
+		eval: func(args []any) (any, error) {
+			for _, arg := range args {
+				if arg != nil {
+					return arg, nil
+				}
+			}
+			return nil, nil
+		}})
+	registerFunction(&scalarFunction{name: "NULLIF", args: []argKind{argAny, argAny}, minArgs: 2, nullable: true, returnType: returnsFirstArg,
+		eval: func(args []any) (any, error) {
+			if args[0] != nil && args[1] != nil && valuesEqual(args[0], args[1]) {
+				return nil, nil
+			}
+			return args[0], nil
+		}})
+
+	// 日付関数
+	for _, part := range []struct {
+		name    string
+		kind    argKind
+		extract func(t time.Time) int
+	}{
+		{"YEAR", argDate, func(t time.Time) int { return t.Year() }},
+		{"MONTH", argDate, func(t time.Time) int { return int(t.Month()) }},
+		{"DAY", argDate, func(t time.Time) int { return t.Day() }},
+		{"HOUR", argTime, func(t time.Time) int { return t.Hour() }},
+		{"MINUTE", argTime, func(t time.Time) int { return t.Minute() }},
+		{"SECOND", argTime, func(t time.Time) int { return t.Second() }},
+	} {
+		registerFunction(&scalarFunction{name: part.name, args: []argKind{part.kind}, minArgs: 1, returnType: returns(storage.ColumnTypeInt32),
+			eval: func(args []any) (any, error) { return part.extract(temporalTime(args[0])), nil }})
+	}
+}
+
+// substr は SUBSTR(s, start[, length]) を計算する（start は1始まりの文字位置）
+func substr(args []any) (any, error) {
+	runes := []rune(args[0].(string))
+	begin := toInt64(args[1]) - 1
+	end := int64(len(runes))
+	if len(args) == 3 {
+		length := toInt64(args[2])
+		if length < 0 {
+			return nil, argumentError("SUBSTR", 3, "must not be negative, got %d", length)
+		}
+		end = min(end, begin+length)
+	}
+	begin = max(begin, 0)
+	if begin >= end {
+		return "", nil
+	}
+	return string(runes[begin:end]), nil
+}
+
+// concat は NULL を飛ばして値を文字列としてつなげる
+func concat(args []any) (any, error) {
+	var sb strings.Builder
+	for _, arg := range args {
+		if s, ok := arg.(string); ok {
+			sb.WriteString(s)
+		} else if arg != nil {
+			sb.WriteString(storage.FormatValue(toValue(arg)))
+		}
+	}
+	return sb.String(), nil
+}
+
+func abs(args []any) (any, error) {
+	switch v := args[0].(type) {
+	case int:
+		return max(v, -v), nil
+	case int64:
+		return max(v, -v), nil
+	case float64:
+		return math.Abs(v), nil
+	case storage.DecimalValue:
+		return storage.NewDecimal(max(v.Unscaled, -v.Unscaled), v.Scale), nil
+	}
+	return nil, argumentError("ABS", 1, "must be a number, got %s", valueTypeName(args[0]))
+}
+
+// round は ROUND(x[, digits]) を計算する（0.5 は 0 から遠い方に丸める）
+func round(args []any) (any, error) {
+	var digits int64
+	if len(args) == 2 {
+		digits = toInt64(args[1])
+		if digits < 0 || digits > storage.MaxDecimalPrecision {
+			return nil, argumentError("ROUND", 2, "must be between 0 and %d, got %d", storage.MaxDecimalPrecision, digits)
+		}
+	}
+	switch v := args[0].(type) {
+	case int, int64:
+		return v, nil
+	case float64:
+		scale := math.Pow10(int(digits))
+		return math.Round(v*scale) / scale, nil
+	case storage.DecimalValue:
+		if uint8(digits) >= v.Scale {
+			return v, nil
+		}
+		return v.Rescale(uint8(digits))
+	}
+	return nil, argumentError("ROUND", 1, "must be a number, got %s", valueTypeName(args[0]))
+}
+
+// roundToInteger は CEIL / FLOOR を計算する（DECIMAL はスケール 0 の DECIMAL になる）
+func roundToInteger(value any, ceil bool) (any, error) {
+	switch v := value.(type) {
+	case int, int64:
+		return v, nil
+	case float64:
+		if ceil {
+			return math.Ceil(v), nil
+		}
+		return math.Floor(v), nil
+	case storage.DecimalValue:
+		divisor := int64(math.Pow10(int(v.Scale)))
+		quotient, remainder := v.Unscaled/divisor, v.Unscaled%divisor
+		if ceil && remainder > 0 {
+			quotient++
+		} else if !ceil && remainder < 0 {
+			quotient--
+		}
+		return storage.NewDecimal(quotient, 0), nil
+	}
+	return nil, fmt.Errorf("%w: cannot round %s", ErrInvalidArgument, valueTypeName(value))
+}
+
+func modType(args []storage.ColumnType) storage.ColumnType {
+	if len(args) == 2 {
+		return arithmeticType(args[0], args[1])
+	}
+	return storage.ColumnTypeInt32
+}
+
+// mod は MOD(a, b) を計算する（結果の符号は a に合わせ、0 で割るとエラー）
+// DECIMAL は浮動小数点数にせず DECIMAL のまま計算する
+func mod(args []any) (any, error) {
+	return evaluateArithmetic("%", args[0], args[1])
+}
+
+// temporalTime は日付・時刻の値を time.Time（UTC）にする
+func temporalTime(value any) time.Time {
+	switch v := value.(type) {
+	case storage.DateValue:
+		return v.Time()
+	case storage.TimestampValue:
+		return v.Time()
+	case storage.TimeValue:
+		return time.UnixMicro(int64(v)).UTC()
+	}
+	return time.Time{}
+}
@@ -0,0 +1,164 @@
+package planner
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
+)
+
+func evaluateFunction(t *testing.T, name string, args ...any) (any, error) {
+	t.Helper()
+	exprs := make([]Expression, len(args))
+	for i, arg := range args {
+		exprs[i] = &Literal{Value: arg}
+	}
+	fn, err := NewFunctionExpr(name, exprs)
+	if err != nil {
+		return nil, err
+	}
+	return fn.Evaluate(nil, nil)
+}
+
+func TestScalarFunctions(t *testing.T) {
+	date, _ := storage.ParseDate("2024-02-29")
+	timestamp, _ := storage.ParseTimestamp("2024-01-31 13:45:06")
+	clock, _ := storage.ParseTime("07:08:09")
+	decimal, _ := storage.ParseDecimal("-2.345")
+
+	tests := []struct {
+		name string
+		args []any
+		want any
+	}{
+		{"UPPER", []any{"abc"}, "ABC"},
+		{"lower", []any{"ABC"}, "abc"},
+		{"LENGTH", []any{"あいう"}, 3},
+		{"TRIM", []any{"  a b  "}, "a b"},
+		{"SUBSTR", []any{"database", 5}, "base"},
+		{"SUBSTR", []any{"database", 1, 4}, "data"},
+		{"SUBSTR", []any{"database", 0, 3}, "da"},
+		{"SUBSTR", []any{"database", 20}, ""},
+		{"CONCAT", []any{"a", nil, 1, true}, "a1true"},
+		{"REPLACE", []any{"a-b-c", "-", "+"}, "a+b+c"},
+		{"ABS", []any{-3}, 3},
+		{"ABS", []any{-1.5}, 1.5},
+		{"ABS", []any{decimal}, storage.NewDecimal(2345, 3)},
+		{"ROUND", []any{2.567, 2}, 2.57},
+		{"ROUND", []any{2.5}, 3.0},
+		{"ROUND", []any{decimal, 2}, storage.NewDecimal(-235, 2)},
+		{"CEIL", []any{1.2}, 2.0},
+		{"CEILING", []any{decimal}, storage.NewDecimal(-2, 0)},
+		{"FLOOR", []any{decimal}, storage.NewDecimal(-3, 0)},
+		{"FLOOR", []any{7}, 7},
+		{"MOD", []any{7, 3}, 1},
+		{"MOD", []any{-7, 3}, -1},
+		{"MOD", []any{7.5, 2}, 1.5},
+		{"MOD", []any{storage.NewDecimal(1050, 2), 3}, storage.NewDecimal(150, 2)},
+		{"MOD", []any{storage.NewDecimal(-1, 1), storage.NewDecimal(3, 2)}, storage.NewDecimal(-1, 2)},
+		{"COALESCE", []any{nil, nil, "x", "y"}, "x"},
+		{"COALESCE", []any{nil}, nil},
+		{"NULLIF", []any{1, 1}, nil},
+		{"NULLIF", []any{1, 2}, 1},
+		{"NULLIF", []any{1, nil}, 1},
+		{"YEAR", []any{date}, 2024},
+		{"MONTH", []any{date}, 2},
+		{"DAY", []any{timestamp}, 31},
+		{"HOUR", []any{timestamp}, 13},
+		{"MINUTE", []any{clock}, 8},
+		{"SECOND", []any{clock}, 9},
+		// NULL の引数は NULL になる
+		{"UPPER", []any{nil}, nil},
+		{"SUBSTR", []any{"abc", nil}, nil},
+	}
+	for _, tt := range tests {
+		got, err := evaluateFunction(t, tt.name, tt.args...)
+		if err != nil {
+			t.Errorf("%s(%v) failed: %v", tt.name, tt.args, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s(%v) = %#v, want %#v", tt.name, tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestScalarFunctionErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []any
+		target  error
+		message string
+	}{
+		{"NOPE", []any{1}, ErrUnknownFunction, "NOPE"},
+		{"UPPER", []any{}, ErrInvalidArgument, "UPPER expects 1 arguments, got 0"},
+		{"SUBSTR", []any{"a"}, ErrInvalidArgument, "SUBSTR expects 2 to 3 arguments, got 1"},
+		{"COALESCE", []any{}, ErrInvalidArgument, "COALESCE expects at least 1 arguments, got 0"},
+		{"UPPER", []any{1}, ErrInvalidArgument, "UPPER argument 1 must be a string, got INT"},
+		{"SUBSTR", []any{"abc", "x"}, ErrInvalidArgument, "SUBSTR argument 2 must be an integer, got VARCHAR"},
+		{"SUBSTR", []any{"abc", 1, -1}, ErrInvalidArgument, "SUBSTR argument 3 must not be negative"},
+		{"ROUND", []any{1.5, 1.5}, ErrInvalidArgument, "ROUND argument 2 must be an integer, got DOUBLE"},
+		{"YEAR", []any{"2024-01-01"}, ErrInvalidArgument, "YEAR argument 1 must be a DATE or TIMESTAMP, got VARCHAR"},
+		{"MOD", []any{7, 0}, storage.ErrDivisionByZero, "division by zero"},
+	}
+	for _, tt := range tests {
+		_, err := evaluateFunction(t, tt.name, tt.args...)
+		if !errors.Is(err, tt.target) || !strings.Contains(err.Error(), tt.message) {
+			t.Errorf("%s(%v): expected %q, got %v", tt.name, tt.args, tt.message, err)
+		}
+	}
+
+	// カラムの値の型は評価するときに確かめる
+	schema := storage.NewSchema("users", []storage.Column{*storage.NewColumn("age", storage.ColumnTypeInt32, 4, true)})
+	fn, err := NewFunctionExpr("LOWER", []Expression{&ColumnRef{Name: "age"}})
+	if err != nil {
+		t.Fatalf("NewFunctionExpr failed: %v", err)
+	}
+	row := storage.NewRow([]storage.Value{storage.Int32Value(20)})
+	if _, err := fn.Evaluate(row, schema); !errors.Is(err, ErrInvalidArgument) || !strings.Contains(err.Error(), "LOWER argument 1") {
+		t.Errorf("expected an argument error, got %v", err)
+	}
+}
+
+func TestCastExpr(t *testing.T) {
+	cast := func(value any, typeName string) (any, error) {
+		target, err := planCastTarget(typeName)
+		if err != nil {
+			return nil, err
+		}
+		return (&CastExpr{Expr: &Literal{Value: value}, Target: target, Type: typeName}).Evaluate(nil, nil)
+	}
+	date, _ := storage.ParseDate("2024-01-31")
+	tests := []struct {
+		value    any
+		typeName string
+		want     any
+	}{
+		{"42", "INT", 42},
+		{3, "DOUBLE", 3.0},
+		{1.006, "DECIMAL(10,2)", storage.NewDecimal(101, 2)},
+		{12, "VARCHAR(10)", "12"},
+		{"2024-01-31", "DATE", date},
+		{nil, "INT", nil},
+		// 明示的な CAST は小数部を四捨五入して整数にする
+		{storage.NewDecimal(1050, 2), "INT", 11},
+		{1.5, "INT", 2},
+		{-1.5, "BIGINT", int64(-2)},
+		{"2.5", "INT", 3},
+		{storage.NewDecimal(1050, 2), "FLOAT", 10.5},
+		{storage.TextValue("0.125"), "DECIMAL(4,2)", storage.NewDecimal(13, 2)},
+	}
+	for _, tt := range tests {
+		got, err := cast(tt.value, tt.typeName)
+		if err != nil || got != tt.want {
+			t.Errorf("CAST(%v AS %s) = %#v, %v; want %#v", tt.value, tt.typeName, got, err, tt.want)
+		}
+	}
+	if _, err := cast("abc", "INT"); !errors.Is(err, ErrInvalidArgument) || !strings.Contains(err.Error(), "CAST argument 1") {
+		t.Errorf("expected a CAST argument error, got %v", err)
+	}
+	if s := (&CastExpr{Expr: &ColumnRef{Name: "price"}, Type: "INT"}).String(); s != "CAST(price AS INT)" {
+		t.Errorf("unexpected String(): %s", s)
+	}
+}
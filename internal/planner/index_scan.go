@@ -0,0 +1,250 @@
+package planner
+
+import (
+	"strings"
+
+	"github.com/takeuchi-shogo/go-example-database/internal/catalog"
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
+)
+
+// planTableAccess はテーブルの読み方を決める
+// WHERE 句にインデックスで絞り込める条件があれば IndexScanNode を使い、
+// 残りの条件は FilterNode で評価する
+func (p *planner) planTableAccess(tableName string, schema *storage.Schema, where Expression) PlanNode {
+	var plan PlanNode = &ScanNode{TableName: tableName, TableSchema: schema}
+	if where == nil {
+		return plan
+	}
+	conjuncts := splitConjunction(where)
+	scan, used := chooseIndexScan(tableName, schema, p.catalog.GetIndexes(tableName), conjuncts)
+	if scan == nil {
+		return &FilterNode{Condition: where, Child: plan}
+	}
+	if condition := joinConjunction(removeConjuncts(conjuncts, used)); condition != nil {
+		return &FilterNode{Condition: condition, Child: scan}
+	}
+	return scan
+}
+
+// indexCandidate はインデックスで評価できる条件（カラム 演算子 定数）
+type indexCandidate struct {
+	conjunct int // 元の条件の位置
+	operator string
+	value    storage.Value
+}
+
+// chooseIndexScan は条件に使えるインデックスを選ぶ
+// 一意なインデックスの等価条件、等価条件、範囲条件の順に優先し、
+// 同じ順位なら多くのカラムを絞り込めるものを選ぶ
+// 戻り値の used はインデックスで評価済みになった条件の位置
+func chooseIndexScan(tableName string, schema *storage.Schema, indexes []catalog.IndexInfo, conjuncts []Expression) (*IndexScanNode, []int) {
+	var best *IndexScanNode
+	var bestUsed []int
+	bestRank := 0
+	for _, info := range indexes {
+		r, used, rank := buildKeyRange(tableName, schema, info.Columns, conjuncts)
+		if rank == 0 {
+			continue
+		}
+		if info.Unique && rank == rankEqual && len(r.Low) == len(info.Columns) {
+			rank = rankUniqueEqual
+		}
+		if rank > bestRank || (rank == bestRank && len(used) > len(bestUsed)) {
+			best = &IndexScanNode{
+				TableName:   tableName,
+				TableSchema: schema,
+				IndexName:   info.Name,
+				Columns:     info.Columns,
+				Range:       r,
+			}
+			bestUsed = used
+			bestRank = rank
+		}
+	}
+	return best, bestUsed
+}
+
+const (
+	rankRange = iota + 1
+	rankEqual
+	rankUniqueEqual
+)
+
+// buildKeyRange はインデックスのカラムに対する条件からキー範囲を作る
+// 先頭のカラムから順に等価条件でキーの接頭辞を固定し、
+// 等価条件のない最初のカラムには下限と上限を1つずつ使う
+// 先頭のカラムに条件がなければ順位 0 を返す
+func buildKeyRange(tableName string, schema *storage.Schema, columns []string, conjuncts []Expression) (storage.KeyRange, []int, int) {
+	var prefix []storage.Value
+	var used []int
+	for _, column := range columns {
+		candidates := indexCandidates(tableName, schema, column, conjuncts)
+		equal := -1
+		for i, c := range candidates {
+			if c.operator == "=" {
+				equal = i
+				break
+			}
+		}
+		if equal < 0 {
+			r, rangeUsed := buildColumnRange(prefix, candidates)
+			if len(rangeUsed) > 0 {
+				return r, append(used, rangeUsed...), rankRange
+			}
+			break
+		}
+		prefix = append(prefix, candidates[equal].value)
+		used = append(used, candidates[equal].conjunct)
+	}
+	if len(prefix) == 0 {
+		return storage.KeyRange{}, nil, 0
+	}
+	return storage.NewKeyRangeEqual(prefix...), used, rankEqual
+}
+
+// buildColumnRange は接頭辞に続くカラムの範囲条件から下限と上限を作る
+// 片側の条件がなければ、その側は接頭辞だけで区切る
+func buildColumnRange(prefix []storage.Value, candidates []indexCandidate) (storage.KeyRange, []int) {
+	r := storage.KeyRange{LowInclusive: true, HighInclusive: true}
+	if len(prefix) > 0 {
+		r.Low, r.High = prefix, prefix
+	}
+	var used []int
+	var lowSet, highSet bool
+	for _, c := range candidates {
+		switch c.operator {
+		case ">", ">=":
+			if !lowSet {
+				r.Low, r.LowInclusive = appendKey(prefix, c.value), c.operator == ">="
+				lowSet = true
+				used = append(used, c.conjunct)
+			}
+		case "<", "<=":
+			if !highSet {
+				r.High, r.HighInclusive = appendKey(prefix, c.value), c.operator == "<="
+				highSet = true
+				used = append(used, c.conjunct)
+			}
+		}
+	}
+	if !lowSet && r.Low == nil {
+		r.LowInclusive = false
+	}
+	if !highSet && r.High == nil {
+		r.HighInclusive = false
+	}
+	return r, used
+}
+
+// appendKey は接頭辞の後ろに値を付けた新しいキーを作る
+func appendKey(prefix []storage.Value, value storage.Value) []storage.Value {
+	key := make([]storage.Value, len(prefix), len(prefix)+1)
+	copy(key, prefix)
+	return append(key, value)
+}
+
+// indexCandidates は column に対する「カラム 比較演算子 定数」の条件を集める
+func indexCandidates(tableName string, schema *storage.Schema, column string, conjuncts []Expression) []indexCandidate {
+	colIdx := schema.GetColumnIndex(column)
+	if colIdx < 0 {
+		return nil
+	}
+	col := schema.GetColumns()[colIdx]
+	var candidates []indexCandidate
+	for i, conjunct := range conjuncts {
+		bin, ok := conjunct.(*BinaryExpr)
+		if !ok {
+			continue
+		}
+		ref, lit, operator := columnComparison(bin)
+		if ref == nil || ref.Name != column || (ref.TableName != "" && ref.TableName != tableName) {
+			continue
+		}
+		value, ok := literalToKey(lit.Value, &col)
+		if !ok {
+			continue
+		}
+		candidates = append(candidates, indexCandidate{conjunct: i, operator: operator, value: value})
+	}
+	return candidates
+}
+
+// columnComparison は「カラム 演算子 定数」または「定数 演算子 カラム」を取り出す
+// 定数が左にある場合は演算子の向きを反転する
+func columnComparison(bin *BinaryExpr) (*ColumnRef, *Literal, string) {
+	flipped := map[string]string{"=": "=", "<": ">", ">": "<", "<=": ">=", ">=": "<="}
+	if _, ok := flipped[bin.Operator]; !ok {
+		return nil, nil, ""
+	}
+	if ref, ok := bin.Left.(*ColumnRef); ok {
+		if lit, ok := bin.Right.(*Literal); ok {
+			return ref, lit, bin.Operator
+		}
+	}
+	if ref, ok := bin.Right.(*ColumnRef); ok {
+		if lit, ok := bin.Left.(*Literal); ok {
+			return ref, lit, flipped[bin.Operator]
+		}
+	}
+	return nil, nil, ""
+}
+
+// literalToKey は定数をカラム型のインデックスキーに変換する
+// 型を変換すると値が変わる定数（INT のカラムと 1.5 など）はキーにできない
+func literalToKey(value any, col *storage.Column) (storage.Value, bool) {
+	literal := toValue(value)
+	if literal == nil {
+		return nil, false
+	}
+	key, err := storage.CastValue(literal, col)
+	if err != nil {
+		return nil, false
+	}
+	if c, err := storage.CompareValues(key, literal); err != nil || c != 0 {
+		return nil, false
+	}
+	return key, true
+}
+
+// splitConjunction は AND で結ばれた条件を分解する
+// BETWEEN は範囲条件として使えるように2つの比較に分ける
+func splitConjunction(expression Expression) []Expression {
+	if bin, ok := expression.(*BinaryExpr); ok && strings.EqualFold(bin.Operator, "AND") {
+		return append(splitConjunction(bin.Left), splitConjunction(bin.Right)...)
+	}
+	if between, ok := expression.(*BetweenExpr); ok && !between.Not {
+		return between.Conjuncts()
+	}
+	return []Expression{expression}
+}
+
+// joinConjunction は条件を AND で結び直す（条件がなければ nil）
+func joinConjunction(conjuncts []Expression) Expression {
+	var result Expression
+	for _, c := range conjuncts {
+		if result == nil {
+			result = c
+			continue
+		}
+		result = &BinaryExpr{Left: result, Operator: "AND", Right: c}
+	}
+	return result
+}
+
+// removeConjuncts は used に含まれる位置の条件を取り除く
+func removeConjuncts(conjuncts []Expression, used []int) []Expression {
+	remaining := make([]Expression, 0, len(conjuncts))
+	for i, c := range conjuncts {
+		skip := false
+		for _, u := range used {
+			if u == i {
+				skip = true
+				break
+			}
+		}
+		if !skip {
+			remaining = append(remaining, c)
+		}
+	}
+	return remaining
+}
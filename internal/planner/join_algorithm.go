@@ -0,0 +1,172 @@
+package planner
+
+import (
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
+)
+
+// JoinAlgorithm は結合の方式を表す
+type JoinAlgorithm string
+
+const (
+	// JoinAlgorithmNestedLoop は左の1行ごとに右を先頭から読み直す（どんな結合条件にも使える）
+	JoinAlgorithmNestedLoop JoinAlgorithm = "NESTED LOOP"
+	// JoinAlgorithmHash は右の行で結合キーのハッシュ表を作り、左の行で引く（等価結合だけ）
+	JoinAlgorithmHash JoinAlgorithm = "HASH"
+	// JoinAlgorithmMerge は結合キーの順に並んだ左右を先頭から突き合わせる（等価結合だけ）
+	JoinAlgorithmMerge JoinAlgorithm = "MERGE"
+)
+
+// planJoinAlgorithm はコストの見積もりで結合の方式を選び、結合キーを設定する
+// 見積もれない場合は入れ子ループのままにする
+func (p *planner) planJoinAlgorithm(join *JoinNode) {
+	algorithm, err := NewCostEstimator(p.catalog).ChooseJoinAlgorithm(join)
+	if err != nil {
+		return
+	}
+	setJoinAlgorithm(join, algorithm)
+}
+
+// setJoinAlgorithm は結合の方式と、その方式で使う結合キーを設定する
+func setJoinAlgorithm(join *JoinNode, algorithm JoinAlgorithm) {
+	join.Algorithm = algorithm
+	switch algorithm {
+	case JoinAlgorithmHash:
+		join.LeftKeys, join.RightKeys = equiJoinKeys(join)
+	case JoinAlgorithmMerge:
+		join.LeftKeys, join.RightKeys = mergeJoinKeys(join)
+	}
+}
+
+// equiJoinKeys は結合条件の「左の式 = 右の式」から左右の結合キーを取り出す
+// 結合キーが一致した行にも結合条件全体を評価するので、キーにならない条件は残ったままでよい
+func equiJoinKeys(join *JoinNode) (leftKeys, rightKeys []Expression) {
+	if join.Condition == nil {
+		return nil, nil
+	}
+	left, right := join.Left.Schema(), join.Right.Schema()
+	for _, conjunct := range splitConjunction(join.Condition) {
+		bin, ok := conjunct.(*BinaryExpr)
+		if !ok || bin.Operator != "=" {
+			continue
+		}
+		leftKey, rightKey := bin.Left, bin.Right
+		switch {
+		case joinSide(leftKey, left, right) == joinSideLeft && joinSide(rightKey, left, right) == joinSideRight:
+		case joinSide(leftKey, left, right) == joinSideRight && joinSide(rightKey, left, right) == joinSideLeft:
+			leftKey, rightKey = rightKey, leftKey
+		default:
+			continue
+		}
+		leftType, _ := expressionType(leftKey, left)
+		rightType, _ := expressionType(rightKey, right)
+		if !joinKeyCompatible(leftType, rightType) {
+			continue
+		}
+		leftKeys = append(leftKeys, leftKey)
+		rightKeys = append(rightKeys, rightKey)
+	}
+	return leftKeys, rightKeys
+}
+
+const (
+	joinSideNone = iota
+	joinSideLeft
+	joinSideRight
+)
+
+// joinSide は式が左右どちらのカラムだけを参照しているかを返す
+// 左右の両方にあるカラムは、結合条件を評価するときと同じように左のカラムとみなす
+// 曖昧なカラムを参照する式はどちらでもないとし、結合条件を評価するときにエラーにする
+func joinSide(expr Expression, left, right *storage.Schema) int {
+	refs := columnRefs(expr)
+	if len(refs) == 0 || len(CollectSubqueries(expr)) > 0 {
+		return joinSideNone
+	}
+	inLeft, inRight := true, true
+	for _, ref := range refs {
+		idx, err := resolveColumn(left, ref)
+		if err != nil {
+			return joinSideNone
+		}
+		if idx >= 0 {
+			inRight = false
+			continue
+		}
+		inLeft = false
+		if idx, err = resolveColumn(right, ref); err != nil {
+			return joinSideNone
+		}
+		if idx < 0 {
+			inRight = false
+		}
+	}
+	switch {
+	case inLeft:
+		return joinSideLeft
+	case inRight:
+		return joinSideRight
+	}
+	return joinSideNone
+}
+
+// joinKeyCompatible は2つの型の値を結合キーとして突き合わせられるかどうかを返す
+// 数値どうし、文字列どうし、同じ型どうしだけを許す（日付と文字列のような比較は入れ子ループで行う）
+func joinKeyCompatible(left, right storage.ColumnType) bool {
+	numeric := func(t storage.ColumnType) bool {
+		switch t {
+		case storage.ColumnTypeInt32, storage.ColumnTypeInt64, storage.ColumnTypeFloat32,
+			storage.ColumnTypeFloat64, storage.ColumnTypeDecimal:
+			return true
+		}
+		return false
+	}
+	text := func(t storage.ColumnType) bool {
+		return t == storage.ColumnTypeString || t == storage.ColumnTypeText
+	}
+	return left == right || (numeric(left) && numeric(right)) || (text(left) && text(right))
+}
+
+// mergeJoinKeys は左右がどちらもその順に並んでいる結合キーを1組返す（なければ nil）
+// 2つ目以降の結合キーは結合条件として評価する
+func mergeJoinKeys(join *JoinNode) (leftKeys, rightKeys []Expression) {
+	leftOrder, rightOrder := sortOrder(join.Left), sortOrder(join.Right)
+	if len(leftOrder) == 0 || len(rightOrder) == 0 {
+		return nil, nil
+	}
+	left, right := join.Left.Schema(), join.Right.Schema()
+	allLeft, allRight := equiJoinKeys(join)
+	for i := range allLeft {
+		l, ok1 := allLeft[i].(*ColumnRef)
+		r, ok2 := allRight[i].(*ColumnRef)
+		if ok1 && ok2 && sameColumn(left, l, leftOrder[0]) && sameColumn(right, r, rightOrder[0]) {
+			return []Expression{l}, []Expression{r}
+		}
+	}
+	return nil, nil
+}
+
+// sameColumn は2つのカラム参照がスキーマの同じカラムを指すかどうかを返す（どちらかが見つからないか曖昧なら false）
+func sameColumn(schema *storage.Schema, a, b *ColumnRef) bool {
+	i, err := resolveColumn(schema, a)
+	if err != nil || i < 0 {
+		return false
+	}
+	j, err := resolveColumn(schema, b)
+	return err == nil && i == j
+}
+
+// sortOrder はノードの出力が昇順に並んでいるカラムを返す（並び順が決まっていなければ nil）
+// インデックススキャンはインデックスのキーの順に行を返す
+func sortOrder(node PlanNode) []*ColumnRef {
+	switch n := node.(type) {
+	case *IndexScanNode:
+		order := make([]*ColumnRef, len(n.Columns))
+		for i, column := range n.Columns {
+			order[i] = &ColumnRef{TableName: n.TableSchema.GetTableName(), Name: column}
+		}
+		return order
+	case *FilterNode:
+		return sortOrder(n.Child)
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package planner
+
+import (
+	"math/bits"
+
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
+)
+
+// maxJoinReorderRelations は結合順を動的計画法で決めるテーブル数の上限
+// 調べる組み合わせはテーブル数の指数で増えるので、これより多ければ書いた順に結合する
+const maxJoinReorderRelations = 8
+
+// joinOrder は結合順を決めるときの、テーブルの組を結合するプランとその見積もり
+type joinOrder struct {
+	plan PlanNode
+	rows float64 // 推定行数
+	cost float64 // 結合で比べる行数の合計
+}
+
+// joinGraph は内部結合でつながったテーブルと、テーブルをまたぐ条件
+type joinGraph struct {
+	relations  []PlanNode
+	conditions []Expression // テーブル名で修飾した条件
+	masks      []uint       // 条件が参照するテーブルの集合（relations の位置のビット）
+}
+
+// reorderJoins は内部結合（CROSS JOIN を含む）でつないだテーブルの結合順を動的計画法で決める
+// plan が内部結合か、内部結合の上の Filter でなければ nil を返す
+// 条件は参照するテーブルがそろう最も下の結合（1つのテーブルだけならそのテーブルの Filter）に置く
+// 書いた順より安く結合できるときだけ、カラムを元の順に並べ直す Project を付けて返す（それ以外は nil）
+func (o *optimizer) reorderJoins(plan PlanNode) (PlanNode, error) {
+	if o.costEstimator == nil {
+		return nil, nil
+	}
+	var conditions []Expression
+	root := plan
+	if filter, ok := plan.(*FilterNode); ok {
+		conditions = splitConjunction(filter.Condition)
+		root = filter.Child
+	}
+	join, ok := root.(*JoinNode)
+	if !ok || !isInnerJoin(join) {
+		return nil, nil
+	}
+	var relations []PlanNode
+	collectJoinGraph(join, &relations, &conditions)
+	if len(relations) > maxJoinReorderRelations || !distinctTables(relations) {
+		return nil, nil
+	}
+	schema := join.Schema()
+	graph := &joinGraph{}
+	var residual []Expression // どのテーブルにも置けない条件（サブクエリや外側のカラムを参照する条件）
+	filters := make([][]Expression, len(relations))
+	for _, condition := range conditions {
+		qualified, mask, ok := qualifyJoinCondition(condition, schema, relations)
+		switch {
+		case !ok:
+			residual = append(residual, condition)
+		case bits.OnesCount(mask) == 1:
+			i := bits.TrailingZeros(mask)
+			filters[i] = append(filters[i], qualified)
+		default:
+			graph.conditions = append(graph.conditions, qualified)
+			graph.masks = append(graph.masks, mask)
+		}
+	}
+	// 1つのテーブルだけを参照する条件はテーブルの Filter にしてから最適化する
+	for i, relation := range relations {
+		if len(filters[i]) > 0 {
+			relation = &FilterNode{Condition: joinConjunction(filters[i]), Child: relation}
+		}
+		optimized, err := o.Optimize(relation)
+		if err != nil {
+			return nil, err
+		}
+		graph.relations = append(graph.relations, optimized)
+	}
+	best, written, ok := o.enumerateJoinOrders(graph)
+	if !ok || best.cost >= written.cost {
+		return nil, nil
+	}
+	result := restoreColumnOrder(best.plan, schema)
+	if len(residual) > 0 {
+		result = &FilterNode{Condition: joinConjunction(residual), Child: result}
+	}
+	return result, nil
+}
+
+// enumerateJoinOrders はテーブルの部分集合ごとに最も安い結合順を求め、全テーブルの結合と書いた順の結合を返す
+// 行数を見積もれないテーブルがあれば ok は false
+func (o *optimizer) enumerateJoinOrders(graph *joinGraph) (best, written *joinOrder, ok bool) {
+	n := len(graph.relations)
+	orders := make([]*joinOrder, 1<<n)
+	for i, relation := range graph.relations {
+		c, err := o.costEstimator.EstimateCost(relation)
+		if err != nil {
+			return nil, nil, false
+		}
+		orders[1<<i] = &joinOrder{plan: relation, rows: c.GetRowCost()}
+	}
+	for set := uint(1); set < 1<<n; set++ {
+		if bits.OnesCount(set) < 2 {
+			continue
+		}
+		// 集合を左右に分けるすべての分け方を比べる
+		for left := (set - 1) & set; left > 0; left = (left - 1) & set {
+			candidate := o.joinOrders(graph, orders[left], orders[set&^left], left, set&^left)
+			if orders[set] == nil || candidate.cost < orders[set].cost {
+				orders[set] = candidate
+			}
+		}
+	}
+	written = orders[1]
+	for i := 1; i < n; i++ {
+		done := uint(1)<<i - 1
+		written = o.joinOrders(graph, written, orders[1<<i], done, 1<<i)
+	}
+	return orders[1<<n-1], written, true
+}
+
+// joinOrders は2つのテーブルの組を結合し、結合の方式と行数・コストを見積もる
+// 左右を結合して初めて評価できる条件を結合条件にし、条件がなければ CROSS JOIN にする
+func (o *optimizer) joinOrders(graph *joinGraph, left, right *joinOrder, leftSet, rightSet uint) *joinOrder {
+	var conditions []Expression
+	for i, mask := range graph.masks {
+		if mask&^(leftSet|rightSet) == 0 && mask&^leftSet != 0 && mask&^rightSet != 0 {
+			conditions = append(conditions, graph.conditions[i])
+		}
+	}
+	join := &JoinNode{Left: left.plan, Right: right.plan, JoinType: JoinTypeInner, Condition: joinConjunction(conditions)}
+	selectivity := 1.0
+	if join.Condition == nil {
+		join.JoinType = JoinTypeCross
+	} else {
+		selectivity = o.costEstimator.Selectivity(join.Condition, join)
+	}
+	algorithm := chooseJoinAlgorithm(join, left.rows, right.rows)
+	setJoinAlgorithm(join, algorithm)
+	return &joinOrder{
+		plan: join,
+		rows: left.rows * right.rows * selectivity,
+		cost: left.cost + right.cost + joinCPUCost(algorithm, left.rows, right.rows),
+	}
+}
+
+// isInnerJoin は結合順を入れ替えられる結合（内部結合か CROSS JOIN）かどうかを返す
+func isInnerJoin(join *JoinNode) bool {
+	return join.JoinType == JoinTypeInner || join.JoinType == JoinTypeCross
+}
+
+// collectJoinGraph は内部結合でつながったテーブルを書いた順に集め、結合条件を条件に加える
+func collectJoinGraph(node PlanNode, relations *[]PlanNode, conditions *[]Expression) {
+	join, ok := node.(*JoinNode)
+	if !ok || !isInnerJoin(join) {
+		*relations = append(*relations, node)
+		return
+	}
+	collectJoinGraph(join.Left, relations, conditions)
+	collectJoinGraph(join.Right, relations, conditions)
+	if join.Condition != nil {
+		*conditions = append(*conditions, splitConjunction(join.Condition)...)
+	}
+}
+
+// distinctTables はどのテーブル名も1つのテーブルにしか現れないかどうかを返す
+// USING でまとめたカラムがあれば、カラムを修飾して並べ直せないので false を返す
+func distinctTables(relations []PlanNode) bool {
+	owner := make(map[string]int)
+	for i, relation := range relations {
+		for _, col := range relation.Schema().GetColumns() {
+			if col.GetTableName() == "" || col.GetHidden() {
+				return false
+			}
+			if j, ok := owner[col.GetTableName()]; ok && j != i {
+				return false
+			}
+			owner[col.GetTableName()] = i
+		}
+	}
+	return true
+}
+
+// qualifyJoinCondition は条件のカラム参照をテーブル名で修飾し、参照するテーブルの集合を返す
+// サブクエリを含む条件、結合したスキーマにないか曖昧なカラムを参照する条件、カラムを参照しない条件は ok が false
+func qualifyJoinCondition(condition Expression, schema *storage.Schema, relations []PlanNode) (Expression, uint, bool) {
+	refs := columnRefs(condition)
+	if len(refs) == 0 || len(CollectSubqueries(condition)) > 0 {
+		return nil, 0, false
+	}
+	for _, ref := range refs {
+		if idx, err := resolveColumn(schema, ref); err != nil || idx < 0 {
+			return nil, 0, false
+		}
+	}
+	qualified := replaceColumnRefs(condition, func(ref *ColumnRef) Expression { return qualifyColumn(ref, schema) })
+	var mask uint
+	for _, ref := range columnRefs(qualified) {
+		for i, relation := range relations {
+			if idx, _ := resolveColumn(relation.Schema(), ref); idx >= 0 {
+				mask |= 1 << i
+				break
+			}
+		}
+	}
+	return qualified, mask, true
+}
+
+// restoreColumnOrder は結合順を変えたプランのカラムを元の順に並べ直す（同じ順ならそのまま返す）
+func restoreColumnOrder(plan PlanNode, schema *storage.Schema) PlanNode {
+	columns := schema.GetColumns()
+	current := plan.Schema().GetColumns()
+	same := len(current) == len(columns)
+	for i := 0; same && i < len(columns); i++ {
+		same = current[i].GetTableName() == columns[i].GetTableName() && current[i].GetName() == columns[i].GetName()
+	}
+	if same {
+		return plan
+	}
+	project := &ProjectNode{Child: plan}
+	for _, col := range columns {
+		project.Columns = append(project.Columns, col.GetName())
+		project.Expressions = append(project.Expressions, &ColumnRef{TableName: col.GetTableName(), Name: col.GetName()})
+	}
+	return project
+}
@@ -0,0 +1,117 @@
+package planner
+
+import (
+	"testing"
+
+	"github.com/takeuchi-shogo/go-example-database/internal/catalog"
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
+)
+
+// setupJoinOrderCatalog は統計情報だけを設定した3つのテーブルのカタログを作る
+// orders は 100000 行、customers は 1000 行、items は 100 行とみなす
+func setupJoinOrderCatalog(t *testing.T) catalog.Catalog {
+	t.Helper()
+	cat, err := catalog.NewCatalog(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewCatalog failed: %v", err)
+	}
+	t.Cleanup(func() { cat.Close() })
+	tables := []struct {
+		name    string
+		columns []string
+		stats   *storage.TableStatistics
+	}{
+		{"orders", []string{"id", "customer_id", "item_id"}, &storage.TableStatistics{RowCount: 100000, Columns: []storage.ColumnStatistics{
+			{Name: "id", DistinctCount: 100000}, {Name: "customer_id", DistinctCount: 1000}, {Name: "item_id", DistinctCount: 100},
+		}}},
+		{"customers", []string{"id", "region"}, &storage.TableStatistics{RowCount: 1000, Columns: []storage.ColumnStatistics{
+			{Name: "id", DistinctCount: 1000}, {Name: "region", DistinctCount: 100},
+		}}},
+		{"items", []string{"id", "name"}, &storage.TableStatistics{RowCount: 100, Columns: []storage.ColumnStatistics{
+			{Name: "id", DistinctCount: 100}, {Name: "name", DistinctCount: 100},
+		}}},
+	}
+	for _, table := range tables {
+		columns := make([]storage.Column, len(table.columns))
+		for i, name := range table.columns {
+			columns[i] = *storage.NewColumn(name, storage.ColumnTypeInt64, 0, false)
+		}
+		if err := cat.CreateTable(table.name, storage.NewSchema(table.name, columns)); err != nil {
+			t.Fatalf("CreateTable failed: %v", err)
+		}
+		if err := cat.SetStatistics(table.name, table.stats); err != nil {
+			t.Fatalf("SetStatistics failed: %v", err)
+		}
+	}
+	return cat
+}
+
+func TestOptimizerReordersJoins(t *testing.T) {
+	cat := setupJoinOrderCatalog(t)
+	p := NewPlanner(cat)
+	optimizer := NewOptimizer(nil, NewCostEstimator(cat))
+	tests := []struct {
+		sql       string
+		expected  string
+		reordered bool
+	}{
+		// 絞り込んだ customers を先に結合して中間結果を小さくする
+		{"SELECT * FROM orders JOIN items ON orders.item_id = items.id JOIN customers ON orders.customer_id = customers.id WHERE customers.region = 3",
+			"HashJoin(HashJoin(Scan(orders), Filter((customers.region = 3))), Scan(items))", true},
+		// ハッシュ表は小さいほうのテーブルで作る
+		{"SELECT * FROM customers JOIN orders ON orders.customer_id = customers.id",
+			"HashJoin(Scan(orders), Scan(customers))", true},
+		// 書いた順が最も安ければそのまま
+		{"SELECT * FROM orders JOIN customers ON orders.customer_id = customers.id",
+			"HashJoin(Scan(orders), Scan(customers))", false},
+	}
+	for _, tt := range tests {
+		plan, err := planSQL(t, p, tt.sql)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.sql, err)
+		}
+		optimized, err := optimizer.Optimize(plan)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.sql, err)
+		}
+		// 結合順を変えたらカラムを書いた順に並べ直す
+		project, reordered := optimized.(*ProjectNode)
+		if reordered != tt.reordered {
+			t.Fatalf("%s: unexpected plan %s", tt.sql, optimized.String())
+		}
+		if reordered {
+			optimized = project.Child
+		}
+		if optimized.String() != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.sql, tt.expected, optimized.String())
+		}
+		if project != nil && !sameColumns(project.Schema(), plan.Schema()) {
+			t.Errorf("%s: columns changed: %v", tt.sql, project.Schema().GetColumns())
+		}
+	}
+
+	// 結合条件はそれぞれのテーブルがそろった結合に置く
+	plan, _ := planSQL(t, p, tests[0].sql)
+	optimized, _ := optimizer.Optimize(plan)
+	top := optimized.(*ProjectNode).Child.(*JoinNode)
+	if got := top.Condition.String(); got != "(orders.item_id = items.id)" {
+		t.Errorf("unexpected top condition: %s", got)
+	}
+	if got := top.Left.(*JoinNode).Condition.String(); got != "(orders.customer_id = customers.id)" {
+		t.Errorf("unexpected bottom condition: %s", got)
+	}
+}
+
+// sameColumns は2つのスキーマのカラムがテーブル名も含めて同じ順に並んでいるかどうかを返す
+func sameColumns(a, b *storage.Schema) bool {
+	if a.GetColumnCount() != b.GetColumnCount() {
+		return false
+	}
+	for i, col := range a.GetColumns() {
+		other := b.GetColumns()[i]
+		if col.GetTableName() != other.GetTableName() || col.GetName() != other.GetName() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,128 @@
+package planner
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
+)
+
+func TestPlanJoins(t *testing.T) {
+	p := NewPlanner(setupSubqueryCatalog())
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{"SELECT * FROM users AS u JOIN orders o ON o.user_id = u.id",
+			"Join(Scan(users AS u), Scan(orders AS o))"},
+		// JOIN は書いた順に左から結合する
+		{"SELECT * FROM users u LEFT JOIN orders o ON o.user_id = u.id RIGHT OUTER JOIN users v ON v.id = o.id",
+			"RightJoin(LeftJoin(Scan(users AS u), Scan(orders AS o), (o.user_id = u.id)), Scan(users AS v), (v.id = o.id))"},
+		{"SELECT * FROM users FULL JOIN orders ON users.id = orders.user_id",
+			"FullJoin(Scan(users), Scan(orders), (users.id = orders.user_id))"},
+		{"SELECT * FROM users CROSS JOIN orders",
+			"CrossJoin(Scan(users), Scan(orders))"},
+		{"SELECT * FROM users, orders o",
+			"CrossJoin(Scan(users), Scan(orders AS o))"},
+	}
+	for _, tt := range tests {
+		plan, err := planSQL(t, p, tt.sql)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.sql, err)
+		}
+		if plan.String() != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.sql, tt.expected, plan.String())
+		}
+	}
+
+	// USING は左右のカラムの等価条件になり、USING のカラムは1つにまとめて先頭に出力する
+	usingTests := []struct {
+		sql     string
+		want    []string
+		columns []string
+	}{
+		{"SELECT * FROM orders a JOIN orders b USING (id, user_id)",
+			[]string{"Project([id user_id amount amount])", "  Using(a.id AS id, a.user_id AS user_id)", "    Join(((a.id = b.id) AND (a.user_id = b.user_id)))", "      Scan(orders AS a)", "      Scan(orders AS b)"},
+			[]string{"id", "user_id", "amount", "amount"}},
+		{"SELECT * FROM users u RIGHT JOIN orders o USING (id)",
+			[]string{"Project([id name active user_id amount])", "  Using(o.id AS id)", "    RightJoin((u.id = o.id))", "      Scan(users AS u)", "      Scan(orders AS o)"},
+			[]string{"id", "name", "active", "user_id", "amount"}},
+		// 2つ目の USING は前にまとめたカラムの式と比べる
+		{"SELECT id, u.id, o.id, c.id FROM users u FULL JOIN orders o USING (id) LEFT JOIN orders c USING (id)",
+			[]string{"Project([id id id id])", "  Using(COALESCE(u.id, o.id) AS id)", "    LeftJoin((COALESCE(u.id, o.id) = c.id))", "      Using(COALESCE(u.id, o.id) AS id)", "        FullJoin((u.id = o.id))", "          Scan(users AS u)", "          Scan(orders AS o)", "      Scan(orders AS c)"},
+			[]string{"id", "id", "id", "id"}},
+	}
+	for _, tt := range usingTests {
+		plan, err := planSQL(t, p, tt.sql)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.sql, err)
+		}
+		if got := ExplainPlan(plan); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: expected %q, got %q", tt.sql, tt.want, got)
+		}
+		var columns []string
+		for _, col := range plan.Schema().GetColumns() {
+			columns = append(columns, col.GetName())
+		}
+		if !slices.Equal(columns, tt.columns) {
+			t.Errorf("%s: expected columns %v, got %v", tt.sql, tt.columns, columns)
+		}
+	}
+
+	// USING のカラムは左右の両方に必要
+	if _, err := planSQL(t, p, "SELECT * FROM users JOIN orders USING (amount)"); err == nil {
+		t.Error("expected error for USING column missing on the left")
+	}
+
+	// 修飾子のテーブルがないカラムや、複数のテーブルにある名前だけのカラムはエラーにする
+	errorTests := []struct {
+		sql string
+		err error
+	}{
+		{"SELECT zz.id FROM users", storage.ErrUnknownTable},
+		{"SELECT * FROM users WHERE zz.id = 1", storage.ErrUnknownTable},
+		{"SELECT users.amount FROM users", storage.ErrColumnNotFound},
+		{"SELECT id FROM users, orders", storage.ErrAmbiguousColumn},
+		{"SELECT * FROM users JOIN orders ON id = user_id", storage.ErrAmbiguousColumn},
+	}
+	for _, tt := range errorTests {
+		if _, err := planSQL(t, p, tt.sql); !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v, got %v", tt.sql, tt.err, err)
+		}
+	}
+}
+
+func TestFilterPushDownRespectsOuterJoins(t *testing.T) {
+	p := NewPlanner(setupSubqueryCatalog())
+	rule := NewFilterPushDownRule()
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		// LEFT JOIN は左の条件だけ押し下げる（右の IS NULL は NULL を補った行に対して評価する）
+		{"SELECT * FROM users u LEFT JOIN orders o ON o.user_id = u.id WHERE u.name = 'alice'", "LeftJoin"},
+		{"SELECT * FROM users u LEFT JOIN orders o ON o.user_id = u.id WHERE o.id IS NULL", "Filter"},
+		{"SELECT * FROM users u RIGHT JOIN orders o ON o.user_id = u.id WHERE o.amount > 10", "RightJoin"},
+		{"SELECT * FROM users u RIGHT JOIN orders o ON o.user_id = u.id WHERE u.name = 'alice'", "Filter"},
+		{"SELECT * FROM users u FULL JOIN orders o ON o.user_id = u.id WHERE u.name = 'alice'", "Filter"},
+		{"SELECT * FROM users u JOIN orders o ON o.user_id = u.id WHERE o.amount > 10", "Join"},
+	}
+	for _, tt := range tests {
+		plan, err := planSQL(t, p, tt.sql)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.sql, err)
+		}
+		result, err := rule.Apply(plan)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.sql, err)
+		}
+		got := "Filter"
+		if join, ok := result.(*JoinNode); ok {
+			got = join.String()[:len(tt.expected)]
+		}
+		if got != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.sql, tt.expected, result.String())
+		}
+	}
+}
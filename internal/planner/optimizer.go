@@ -14,17 +14,23 @@ func NewOptimizer(rules []Rule, costEstimator CostEstimator) Optimizer {
 		rules: []Rule{
 			NewFilterPushDownRule(),
 			NewConstantFoldingRule(),
+			NewTopNRule(),
 		},
 		costEstimator: costEstimator,
 	}
 }
 
 func (o *optimizer) Optimize(plan PlanNode) (PlanNode, error) {
-	// 1. 子ノードを再帰的に最適化
-	optimized, err := o.optimizeChildren(plan)
+	// 1. 内部結合の結合順を決める（決め直さなければ子ノードを再帰的に最適化）
+	optimized, err := o.reorderJoins(plan)
 	if err != nil {
 		return nil, err
 	}
+	if optimized == nil {
+		if optimized, err = o.optimizeChildren(plan); err != nil {
+			return nil, err
+		}
+	}
 	// 2. 各ルールを適用して最適化
 	for _, rule := range o.rules {
 		if rule.Match(optimized) {
@@ -38,6 +44,7 @@ func (o *optimizer) Optimize(plan PlanNode) (PlanNode, error) {
 	return optimized, nil
 }
 
+// optimizeChildren は子ノードを最適化したノードのコピーを返す（元のノードは変更しない）
 func (o *optimizer) optimizeChildren(plan PlanNode) (PlanNode, error) {
 	switch n := plan.(type) {
 	case *FilterNode:
@@ -45,13 +52,17 @@ func (o *optimizer) optimizeChildren(plan PlanNode) (PlanNode, error) {
 		if err != nil {
 			return nil, err
 		}
-		return &FilterNode{Condition: n.Condition, Child: child}, nil
+		c := *n
+		c.Child = child
+		return &c, nil
 	case *ProjectNode:
 		child, err := o.Optimize(n.Child)
 		if err != nil {
 			return nil, err
 		}
-		return &ProjectNode{Columns: n.Columns, Child: child}, nil
+		c := *n
+		c.Child = child
+		return &c, nil
 	case *JoinNode:
 		left, err := o.Optimize(n.Left)
 		if err != nil {
@@ -61,32 +72,75 @@ func (o *optimizer) optimizeChildren(plan PlanNode) (PlanNode, error) {
 		if err != nil {
 			return nil, err
 		}
-		return &JoinNode{Left: left, Right: right, JoinType: n.JoinType, Condition: n.Condition}, nil
+		c := *n
+		c.Left, c.Right = left, right
+		return &c, nil
 	case *AggregateNode:
 		child, err := o.Optimize(n.Child)
 		if err != nil {
 			return nil, err
 		}
-		return &AggregateNode{GroupBy: n.GroupBy, Aggregates: n.Aggregates, Child: child}, nil
-	case *InsertNode:
-		return &InsertNode{TableName: n.TableName, Columns: n.Columns, Values: n.Values}, nil
+		c := *n
+		c.Child = child
+		return &c, nil
+	case *SubqueryScanNode:
+		child, err := o.Optimize(n.Child)
+		if err != nil {
+			return nil, err
+		}
+		c := *n
+		c.Child = child
+		return &c, nil
+	case *SortNode:
+		child, err := o.Optimize(n.Child)
+		if err != nil {
+			return nil, err
+		}
+		c := *n
+		c.Child = child
+		return &c, nil
+	case *LimitNode:
+		child, err := o.Optimize(n.Child)
+		if err != nil {
+			return nil, err
+		}
+		c := *n
+		c.Child = child
+		return &c, nil
+	case *DistinctNode:
+		child, err := o.Optimize(n.Child)
+		if err != nil {
+			return nil, err
+		}
+		c := *n
+		c.Child = child
+		return &c, nil
+	case *ExplainNode:
+		child, err := o.Optimize(n.Child)
+		if err != nil {
+			return nil, err
+		}
+		c := *n
+		c.Child = child
+		return &c, nil
 	case *UpdateNode:
 		child, err := o.Optimize(n.Child)
 		if err != nil {
 			return nil, err
 		}
-		return &UpdateNode{TableName: n.TableName, Sets: n.Sets, Child: child}, nil
+		c := *n
+		c.Child = child
+		return &c, nil
 	case *DeleteNode:
 		child, err := o.Optimize(n.Child)
 		if err != nil {
 			return nil, err
 		}
-		return &DeleteNode{TableName: n.TableName, Child: child}, nil
-	case *CreateTableNode:
-		return &CreateTableNode{TableName: n.TableName, TableSchema: n.TableSchema}, nil
-	case *ScanNode:
-		return &ScanNode{TableName: n.TableName, TableSchema: n.TableSchema}, nil
+		c := *n
+		c.Child = child
+		return &c, nil
 	default:
+		// 子ノードのないノードはそのまま返す
 		return plan, nil
 	}
 }
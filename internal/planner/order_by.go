@@ -0,0 +1,141 @@
+package planner
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/takeuchi-shogo/go-example-database/internal/parser"
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
+)
+
+// ErrOrderByNotSelected は SELECT DISTINCT や集約の結果を、SELECT 列にない式で並べ替えようとしたときに返す
+var ErrOrderByNotSelected = errors.New("ORDER BY expression must appear in select list")
+
+// planOrderBy は DISTINCT の重複除去と ORDER BY の並べ替えを output（SELECT 列のノード）の上に追加する
+// ソートキーは SELECT 列の名前（エイリアス）や番号でも参照できる
+// SELECT 列にないカラムで並べ替えるときは、射影の前（input の上）で並べ替える
+func (p *planner) planOrderBy(stmt *parser.SelectStatement, input, output PlanNode) (PlanNode, error) {
+	plan := output
+	if stmt.Distinct {
+		plan = &DistinctNode{Child: output}
+	}
+	if len(stmt.OrderBy) == 0 {
+		return plan, nil
+	}
+	keys := make([]SortKey, len(stmt.OrderBy))
+	selected := true // すべてのキーを SELECT 列から求められるか
+	for i, clause := range stmt.OrderBy {
+		expr, err := p.planSortKey(clause.Expression, output)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = SortKey{Expression: expr, Desc: !clause.Asc}
+		ok, err := resolvable(expr, output.Schema())
+		if err != nil {
+			return nil, err
+		}
+		selected = selected && ok
+	}
+	if selected {
+		return &SortNode{Keys: keys, Child: plan}, nil
+	}
+	project, ok := output.(*ProjectNode)
+	if !ok || stmt.Distinct {
+		if output == input {
+			return nil, checkSortKeys(keys, output.Schema())
+		}
+		return nil, fmt.Errorf("%w: %s", ErrOrderByNotSelected, unresolvedColumn(keys, output.Schema()).String())
+	}
+	// SELECT 列の名前は射影する前の式に置き換えて、射影の前で並べ替える
+	outputSchema := output.Schema()
+	for i, key := range keys {
+		keys[i].Expression = replaceColumnRefs(key.Expression, func(ref *ColumnRef) Expression {
+			if idx, _ := resolveColumn(outputSchema, ref); idx >= 0 {
+				return project.GetExpression(idx)
+			}
+			return ref
+		})
+	}
+	if err := checkSortKeys(keys, input.Schema()); err != nil {
+		return nil, err
+	}
+	c := *project
+	c.Child = &SortNode{Keys: keys, Child: input}
+	return &c, nil
+}
+
+// planSortKey は ORDER BY の式を、SELECT 列（output のスキーマ）か射影の前のカラムを参照する式に変換する
+// 整数は SELECT 列の番号（1 始まり）、集約関数は同じ集約の結果のカラムを表す
+func (p *planner) planSortKey(expr parser.Expression, output PlanNode) (Expression, error) {
+	switch e := expr.(type) {
+	case *parser.IntegerLiteral:
+		columns := output.Schema().GetColumns()
+		if e.Value < 1 || e.Value > len(columns) {
+			return nil, fmt.Errorf("ORDER BY position %d is not in select list", e.Value)
+		}
+		col := columns[e.Value-1]
+		return &ColumnRef{TableName: col.GetTableName(), Name: col.GetName()}, nil
+	case *parser.AggregateFunction:
+		if aggregate, ok := output.(*AggregateNode); ok {
+			want := extractAggregateFunctions([]parser.Expression{e})[0]
+			for _, agg := range aggregate.Aggregates {
+				if strings.EqualFold(agg.Function, want.Function) && agg.Column == want.Column {
+					return &ColumnRef{Name: agg.Name()}, nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("%w: %s", ErrOrderByNotSelected, extractAggregateFunctions([]parser.Expression{e})[0].Name())
+	}
+	return p.planExpression(expr)
+}
+
+// resolvable は式が参照するカラムがすべてスキーマにあるかどうかを返す（曖昧なカラムがあればエラー）
+func resolvable(expr Expression, schema *storage.Schema) (bool, error) {
+	ok := true
+	for _, ref := range columnRefs(expr) {
+		idx, err := resolveColumn(schema, ref)
+		if err != nil {
+			return false, err
+		}
+		ok = ok && idx >= 0
+	}
+	return ok, nil
+}
+
+// unresolvedColumn はソートキーが参照するカラムのうち、スキーマにない最初のカラムを返す（すべてあれば nil）
+func unresolvedColumn(keys []SortKey, schema *storage.Schema) *ColumnRef {
+	for _, key := range keys {
+		for _, ref := range columnRefs(key.Expression) {
+			if idx, _ := resolveColumn(schema, ref); idx < 0 {
+				return ref
+			}
+		}
+	}
+	return nil
+}
+
+// checkSortKeys はソートキーが参照するカラムがすべてスキーマにあるかを確かめる
+func checkSortKeys(keys []SortKey, schema *storage.Schema) error {
+	for _, key := range keys {
+		if err := checkColumns(key.Expression, schema); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// planLimit は LIMIT か OFFSET があれば LimitNode を追加する
+func planLimit(stmt *parser.SelectStatement, plan PlanNode) PlanNode {
+	if stmt.Limit == nil && stmt.Offset == nil {
+		return plan
+	}
+	limit := &LimitNode{Count: -1, Child: plan}
+	if stmt.Limit != nil {
+		limit.Count = *stmt.Limit
+	}
+	if stmt.Offset != nil {
+		limit.Offset = *stmt.Offset
+	}
+	return limit
+}
@@ -0,0 +1,118 @@
+package planner
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/takeuchi-shogo/go-example-database/internal/parser"
+)
+
+func TestPlanOrderByLimitDistinct(t *testing.T) {
+	p := NewPlanner(setupTestCatalog())
+	o := NewOptimizer(nil, nil)
+
+	tests := []struct {
+		sql       string
+		want      []string // プランの各行
+		optimized []string // 最適化した後のプランの各行（nil なら want と同じ）
+	}{
+		{
+			sql:       "SELECT name FROM users ORDER BY name DESC LIMIT 5 OFFSET 2",
+			want:      []string{"Limit(5, offset 2)", "  Sort(name DESC)", "    Project([name])", "      Scan(users)"},
+			optimized: []string{"Limit(5, offset 2)", "  TopN(7, name DESC)", "    Project([name])", "      Scan(users)"},
+		},
+		{
+			// SELECT 列にないカラムで並べ替えるときは射影の前で並べ替える
+			sql:       "SELECT name FROM users ORDER BY id LIMIT 3",
+			want:      []string{"Limit(3)", "  Project([name])", "    Sort(id)", "      Scan(users)"},
+			optimized: []string{"Limit(3)", "  Project([name])", "    TopN(3, id)", "      Scan(users)"},
+		},
+		{
+			// エイリアスは射影の前の式に置き換える
+			sql:  "SELECT name AS n FROM users ORDER BY n, id DESC",
+			want: []string{"Project([name AS n])", "  Sort(name, id DESC)", "    Scan(users)"},
+		},
+		{
+			sql:  "SELECT DISTINCT name FROM users ORDER BY 1 OFFSET 1",
+			want: []string{"Offset(1)", "  Sort(users.name)", "    Distinct", "      Project([name])", "        Scan(users)"},
+		},
+		{
+			sql:  "SELECT COUNT(*) FROM users ORDER BY COUNT(*) DESC",
+			want: []string{"Sort(COUNT(*) DESC)", "  Aggregate([], [{COUNT  }])", "    Scan(users)"},
+		},
+	}
+	for _, tt := range tests {
+		stmt, err := parser.NewParser(parser.NewLexer(tt.sql)).Parse()
+		if err != nil {
+			t.Fatalf("%s: parse failed: %v", tt.sql, err)
+		}
+		plan, err := p.Plan(stmt)
+		if err != nil {
+			t.Fatalf("%s: plan failed: %v", tt.sql, err)
+		}
+		if got := ExplainPlan(plan); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: expected %q, got %q", tt.sql, tt.want, got)
+		}
+		optimized, err := o.Optimize(plan)
+		if err != nil {
+			t.Fatalf("%s: optimize failed: %v", tt.sql, err)
+		}
+		want := tt.optimized
+		if want == nil {
+			want = tt.want
+		}
+		if got := ExplainPlan(optimized); !slices.Equal(got, want) {
+			t.Errorf("%s: expected optimized %q, got %q", tt.sql, want, got)
+		}
+	}
+
+	errorTests := []struct {
+		sql         string
+		notSelected bool // ErrOrderByNotSelected になるか
+	}{
+		{"SELECT DISTINCT name FROM users ORDER BY id", true},
+		{"SELECT COUNT(*) FROM users ORDER BY id", true},
+		{"SELECT COUNT(*) FROM users ORDER BY SUM(id)", true},
+		{"SELECT * FROM users ORDER BY missing", false},
+		{"SELECT name FROM users ORDER BY missing", false},
+		{"SELECT name FROM users ORDER BY 2", false},
+	}
+	for _, tt := range errorTests {
+		stmt, err := parser.NewParser(parser.NewLexer(tt.sql)).Parse()
+		if err != nil {
+			t.Fatalf("%s: parse failed: %v", tt.sql, err)
+		}
+		_, err = p.Plan(stmt)
+		if err == nil {
+			t.Errorf("%s: expected error", tt.sql)
+			continue
+		}
+		if got := errors.Is(err, ErrOrderByNotSelected); got != tt.notSelected {
+			t.Errorf("%s: expected ErrOrderByNotSelected=%v, got %v", tt.sql, tt.notSelected, err)
+		}
+	}
+}
+
+func TestPlanExplain(t *testing.T) {
+	p := NewPlanner(setupTestCatalog())
+	stmt, err := parser.NewParser(parser.NewLexer("EXPLAIN SELECT name FROM users WHERE id > 1")).Parse()
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	plan, err := p.Plan(stmt)
+	if err != nil {
+		t.Fatalf("plan failed: %v", err)
+	}
+	explain, ok := plan.(*ExplainNode)
+	if !ok {
+		t.Fatalf("expected ExplainNode, got %T", plan)
+	}
+	want := []string{"Project([name])", "  Filter((id > 1))", "    Scan(users)"}
+	if got := ExplainPlan(explain.Child); !slices.Equal(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if explain.Schema().GetColumnCount() != 1 {
+		t.Errorf("expected 1 column, got %d", explain.Schema().GetColumnCount())
+	}
+}
@@ -2,6 +2,7 @@ package planner
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/takeuchi-shogo/go-example-database/internal/storage"
 )
@@ -17,6 +18,7 @@ type PlanNode interface {
 }
 
 // ScanNode はテーブルスキャンを表す
+// 別名を付けたテーブルは、別名のテーブル名を持つスキーマで表す
 type ScanNode struct {
 	TableName   string
 	TableSchema *storage.Schema
@@ -24,7 +26,84 @@ type ScanNode struct {
 
 func (n *ScanNode) Schema() *storage.Schema { return n.TableSchema }
 func (n *ScanNode) Children() []PlanNode    { return nil }
-func (n *ScanNode) String() string          { return fmt.Sprintf("Scan(%s)", n.TableName) }
+func (n *ScanNode) String() string {
+	return fmt.Sprintf("Scan(%s)", formatTable(n.TableName, n.TableSchema))
+}
+
+// formatTable はテーブル名を表す（別名があれば users AS u のように表す）
+func formatTable(tableName string, schema *storage.Schema) string {
+	if schema != nil && schema.GetTableName() != "" && schema.GetTableName() != tableName {
+		return tableName + " AS " + schema.GetTableName()
+	}
+	return tableName
+}
+
+// SubqueryScanNode は FROM 句のサブクエリ（派生テーブル）を表す
+// 子の行をそのまま返し、カラムは別名のテーブルに属する
+type SubqueryScanNode struct {
+	Alias string   // 派生テーブルの別名
+	Child PlanNode // サブクエリのプラン
+}
+
+func (n *SubqueryScanNode) Schema() *storage.Schema { return n.Child.Schema().WithTableName(n.Alias) }
+func (n *SubqueryScanNode) Children() []PlanNode    { return []PlanNode{n.Child} }
+func (n *SubqueryScanNode) String() string {
+	return fmt.Sprintf("Subquery(%s, %s)", n.Alias, n.Child.String())
+}
+
+// IndexScanNode はインデックスを使ったテーブルアクセスを表す
+// Range に含まれるキーを持つ行だけをキーの昇順で読む
+type IndexScanNode struct {
+	TableName   string
+	TableSchema *storage.Schema
+	IndexName   string
+	Columns     []string // インデックスのカラム（複合インデックスならキーの順）
+	Range       storage.KeyRange
+}
+
+func (n *IndexScanNode) Schema() *storage.Schema { return n.TableSchema }
+func (n *IndexScanNode) Children() []PlanNode    { return nil }
+func (n *IndexScanNode) String() string {
+	return fmt.Sprintf("IndexScan(%s, %s, %s)", formatTable(n.TableName, n.TableSchema), n.IndexName, formatKeyRange(n.Columns, n.Range))
+}
+
+// formatKeyRange はキー範囲を条件式の形で表す
+// 複合キーは (a, b) = (1, 2) のように組で表す
+func formatKeyRange(columns []string, r storage.KeyRange) string {
+	n := max(len(r.Low), len(r.High), 1)
+	column := formatTuple(columns[:min(n, len(columns))])
+	if r.IsPoint() {
+		return fmt.Sprintf("%s = %s", column, formatTuple(r.Low))
+	}
+	s := column
+	if r.Low != nil {
+		op := "<"
+		if r.LowInclusive {
+			op = "<="
+		}
+		s = fmt.Sprintf("%s %s %s", formatTuple(r.Low), op, s)
+	}
+	if r.High != nil {
+		op := "<"
+		if r.HighInclusive {
+			op = "<="
+		}
+		s = fmt.Sprintf("%s %s %s", s, op, formatTuple(r.High))
+	}
+	return s
+}
+
+// formatTuple は要素が1つならそのまま、複数なら (a, b) の形で表す
+func formatTuple[T any](items []T) string {
+	if len(items) == 1 {
+		return fmt.Sprint(items[0])
+	}
+	parts := make([]string, len(items))
+	for i, item := range items {
+		parts[i] = fmt.Sprint(item)
+	}
+	return "(" + strings.Join(parts, ", ") + ")"
+}
 
 // FilterNode は WHERE 句を表す
 type FilterNode struct {
@@ -38,13 +117,120 @@ func (n *FilterNode) String() string          { return fmt.Sprintf("Filter(%s)",
 
 // ProjectNode は SELECT 列を表す
 type ProjectNode struct {
-	Columns []string
-	Child   PlanNode
+	Columns     []string     // 出力カラム名
+	Expressions []Expression // 出力カラムごとの式（nil の場合は Columns のカラムをそのまま取り出す）
+	Using       int          // 先頭の Using 個のカラムは USING でまとめたカラム（using.go）
+	Child       PlanNode
+}
+
+func (n *ProjectNode) Children() []PlanNode { return []PlanNode{n.Child} }
+
+// Schema は出力カラムだけのスキーマを返す
+func (n *ProjectNode) Schema() *storage.Schema {
+	input := n.Child.Schema()
+	columns := make([]storage.Column, len(n.Columns))
+	for i, name := range n.Columns {
+		columns[i] = expressionColumn(n.GetExpression(i), name, input)
+	}
+	schema := storage.NewSchema(input.GetTableName(), columns)
+	if n.Using > 0 {
+		markUsingColumns(schema, n)
+	}
+	return schema
+}
+
+// GetExpression は i 番目の出力カラムの式を返す
+func (n *ProjectNode) GetExpression(i int) Expression {
+	if n.Expressions == nil {
+		return &ColumnRef{Name: n.Columns[i]}
+	}
+	return n.Expressions[i]
+}
+
+func (n *ProjectNode) String() string {
+	// USING の射影はまとめたカラムだけを表す（他のカラムはそのまま出力する）
+	if n.Using > 0 {
+		items := make([]string, n.Using)
+		for i := range items {
+			items[i] = n.GetExpression(i).String() + " AS " + n.Columns[i]
+		}
+		return fmt.Sprintf("Using(%s)", strings.Join(items, ", "))
+	}
+	items := make([]string, len(n.Columns))
+	for i, name := range n.Columns {
+		items[i] = name
+		expr := n.GetExpression(i)
+		if ref, ok := expr.(*ColumnRef); ok && ref.Name == name {
+			continue
+		}
+		if expr.String() != name {
+			items[i] = expr.String() + " AS " + name
+		}
+	}
+	return fmt.Sprintf("Project(%v)", items)
+}
+
+// SortKey は ORDER BY のソートキーを表す
+type SortKey struct {
+	Expression Expression
+	Desc       bool // 降順かどうか
 }
 
-func (n *ProjectNode) Schema() *storage.Schema { return n.Child.Schema() } // TODO: 選択した列だけのスキーマを返す
-func (n *ProjectNode) Children() []PlanNode    { return []PlanNode{n.Child} }
-func (n *ProjectNode) String() string          { return fmt.Sprintf("Project(%v)", n.Columns) }
+func (k SortKey) String() string {
+	if k.Desc {
+		return k.Expression.String() + " DESC"
+	}
+	return k.Expression.String()
+}
+
+// SortNode は ORDER BY を表す
+// NULL は最も小さい値として並べ、キーが等しい行は子の順のまま返す
+type SortNode struct {
+	Keys  []SortKey
+	Limit int // 0 より大きければ先頭の Limit 行だけを残す（ORDER BY と LIMIT の top-N）
+	Child PlanNode
+}
+
+func (n *SortNode) Schema() *storage.Schema { return n.Child.Schema() }
+func (n *SortNode) Children() []PlanNode    { return []PlanNode{n.Child} }
+func (n *SortNode) String() string {
+	keys := make([]string, len(n.Keys))
+	for i, key := range n.Keys {
+		keys[i] = key.String()
+	}
+	if n.Limit > 0 {
+		return fmt.Sprintf("TopN(%d, %s)", n.Limit, strings.Join(keys, ", "))
+	}
+	return fmt.Sprintf("Sort(%s)", strings.Join(keys, ", "))
+}
+
+// LimitNode は LIMIT と OFFSET を表す
+type LimitNode struct {
+	Count  int // 返す最大行数（負なら制限なし）
+	Offset int // 読み飛ばす行数
+	Child  PlanNode
+}
+
+func (n *LimitNode) Schema() *storage.Schema { return n.Child.Schema() }
+func (n *LimitNode) Children() []PlanNode    { return []PlanNode{n.Child} }
+func (n *LimitNode) String() string {
+	switch {
+	case n.Count < 0:
+		return fmt.Sprintf("Offset(%d)", n.Offset)
+	case n.Offset > 0:
+		return fmt.Sprintf("Limit(%d, offset %d)", n.Count, n.Offset)
+	}
+	return fmt.Sprintf("Limit(%d)", n.Count)
+}
+
+// DistinctNode は SELECT DISTINCT を表す（すべてのカラムが等しい行は最初の1行だけを返す）
+type DistinctNode struct {
+	Child PlanNode
+}
+
+func (n *DistinctNode) Schema() *storage.Schema { return n.Child.Schema() }
+func (n *DistinctNode) Children() []PlanNode    { return []PlanNode{n.Child} }
+func (n *DistinctNode) String() string          { return "Distinct" }
 
 // InsertNode は INSERT 文を表す
 type InsertNode struct {
@@ -100,6 +286,83 @@ func (n *CreateTableNode) Schema() *storage.Schema { return n.TableSchema }
 func (n *CreateTableNode) Children() []PlanNode    { return nil }
 func (n *CreateTableNode) String() string          { return fmt.Sprintf("CreateTable(%s)", n.TableName) }
 
+// CreateIndexNode は CREATE INDEX 文を表す
+type CreateIndexNode struct {
+	IndexName string
+	TableName string
+	Columns   []string
+	Unique    bool
+}
+
+func (n *CreateIndexNode) Schema() *storage.Schema { return nil }
+func (n *CreateIndexNode) Children() []PlanNode    { return nil }
+func (n *CreateIndexNode) String() string {
+	return fmt.Sprintf("CreateIndex(%s, %s(%s))", n.IndexName, n.TableName, strings.Join(n.Columns, ", "))
+}
+
+// DropIndexNode は DROP INDEX 文を表す
+type DropIndexNode struct {
+	IndexName string
+}
+
+func (n *DropIndexNode) Schema() *storage.Schema { return nil }
+func (n *DropIndexNode) Children() []PlanNode    { return nil }
+func (n *DropIndexNode) String() string          { return fmt.Sprintf("DropIndex(%s)", n.IndexName) }
+
+// AnalyzeNode は ANALYZE 文を表す
+type AnalyzeNode struct {
+	TableName string // 全テーブルなら空
+}
+
+func (n *AnalyzeNode) Schema() *storage.Schema { return nil }
+func (n *AnalyzeNode) Children() []PlanNode    { return nil }
+func (n *AnalyzeNode) String() string {
+	if n.TableName == "" {
+		return "Analyze"
+	}
+	return fmt.Sprintf("Analyze(%s)", n.TableName)
+}
+
+// ExplainNode は EXPLAIN 文を表す（文は実行せず、実行計画を1ノード1行で返す）
+type ExplainNode struct {
+	Child PlanNode
+}
+
+// Schema は実行計画の行を入れる1カラムのスキーマを返す
+func (n *ExplainNode) Schema() *storage.Schema {
+	return storage.NewSchema("", []storage.Column{*storage.NewColumn("plan", storage.ColumnTypeText, 0, false)})
+}
+func (n *ExplainNode) Children() []PlanNode { return []PlanNode{n.Child} }
+func (n *ExplainNode) String() string       { return "Explain" }
+
+// ExplainPlan は実行計画を、子ノードほど深く字下げした1ノード1行の文字列にする
+func ExplainPlan(plan PlanNode) []string {
+	var lines []string
+	var walk func(node PlanNode, depth int)
+	walk = func(node PlanNode, depth int) {
+		lines = append(lines, strings.Repeat("  ", depth)+explainLabel(node))
+		for _, child := range node.Children() {
+			walk(child, depth+1)
+		}
+	}
+	walk(plan, 0)
+	return lines
+}
+
+// explainLabel はノード自身の説明を返す（子ノードは含めない）
+func explainLabel(node PlanNode) string {
+	switch n := node.(type) {
+	case *JoinNode:
+		if n.Condition == nil {
+			return n.operatorName()
+		}
+		return fmt.Sprintf("%s(%s)", n.operatorName(), n.Condition.String())
+	case *SubqueryScanNode:
+		return fmt.Sprintf("Subquery(%s)", n.Alias)
+	}
+	return node.String()
+}
+
 // Expression は式を表す
 type Expression interface {
 	// Evaluate は式を評価する
@@ -110,10 +373,13 @@ type Expression interface {
 
 // JoinNode は JOIN を表す
 type JoinNode struct {
-	Left      PlanNode   // 左テーブル
-	Right     PlanNode   // 右テーブル
-	JoinType  JoinType   // INNER, LEFT, RIGHT, FULL OUTER
-	Condition Expression // 結合条件
+	Left      PlanNode      // 左テーブル
+	Right     PlanNode      // 右テーブル
+	JoinType  JoinType      // INNER, LEFT, RIGHT, FULL OUTER
+	Condition Expression    // 結合条件
+	Algorithm JoinAlgorithm // 結合の方式（空なら入れ子ループ）
+	LeftKeys  []Expression  // ハッシュ結合・マージ結合で左の行から作る結合キー
+	RightKeys []Expression  // ハッシュ結合・マージ結合で右の行から作る結合キー
 }
 
 type JoinType string
@@ -123,12 +389,60 @@ const (
 	JoinTypeLeft  JoinType = "LEFT"
 	JoinTypeRight JoinType = "RIGHT"
 	JoinTypeFull  JoinType = "FULL OUTER"
+	JoinTypeCross JoinType = "CROSS"
+	// JoinTypeSemi は右に条件を満たす行がある左の行だけを返す（EXISTS, IN (SELECT ...)）
+	JoinTypeSemi JoinType = "SEMI"
+	// JoinTypeAnti は右に条件を満たす行がない左の行だけを返す（NOT EXISTS, NOT IN (SELECT ...)）
+	JoinTypeAnti JoinType = "ANTI"
 )
 
-func (n *JoinNode) Schema() *storage.Schema { return n.Left.Schema().Merge(n.Right.Schema()) }
-func (n *JoinNode) Children() []PlanNode    { return []PlanNode{n.Left, n.Right} }
+// Schema は左右を結合したスキーマを返す（セミ結合と反結合は左のスキーマのまま）
+func (n *JoinNode) Schema() *storage.Schema {
+	if n.JoinType == JoinTypeSemi || n.JoinType == JoinTypeAnti {
+		return n.Left.Schema()
+	}
+	return n.Left.Schema().Merge(n.Right.Schema())
+}
+
+func (n *JoinNode) Children() []PlanNode { return []PlanNode{n.Left, n.Right} }
 func (n *JoinNode) String() string {
-	return fmt.Sprintf("Join(%s, %s)", n.Left.String(), n.Right.String())
+	name := n.operatorName()
+	// 内部結合は結合条件を省略する
+	if n.Condition == nil || n.JoinType == JoinTypeInner {
+		return fmt.Sprintf("%s(%s, %s)", name, n.Left.String(), n.Right.String())
+	}
+	return fmt.Sprintf("%s(%s, %s, %s)", name, n.Left.String(), n.Right.String(), n.Condition.String())
+}
+
+// operatorName は結合の方式と種類を表す名前（HashLeftJoin など）を返す
+func (n *JoinNode) operatorName() string {
+	name := "Join"
+	switch n.JoinType {
+	case JoinTypeLeft:
+		name = "LeftJoin"
+	case JoinTypeRight:
+		name = "RightJoin"
+	case JoinTypeFull:
+		name = "FullJoin"
+	case JoinTypeCross:
+		name = "CrossJoin"
+	case JoinTypeSemi:
+		name = "SemiJoin"
+	case JoinTypeAnti:
+		name = "AntiJoin"
+	}
+	switch n.Algorithm {
+	case JoinAlgorithmHash:
+		name = "Hash" + name
+	case JoinAlgorithmMerge:
+		name = "Merge" + name
+	}
+	return name
+}
+
+// ConditionSchema は結合条件を評価するスキーマ（左右を結合したもの）を返す
+func (n *JoinNode) ConditionSchema() *storage.Schema {
+	return n.Left.Schema().Merge(n.Right.Schema())
 }
 
 // ColumnRef はカラム参照を表す
@@ -138,18 +452,20 @@ type ColumnRef struct {
 }
 
 func (e *ColumnRef) Evaluate(row *storage.Row, schema *storage.Schema) (any, error) {
-	// カラム名からインデックスを取得
-	columns := schema.GetColumns()
-	for i, col := range columns {
-		if col.GetName() == e.Name {
-			values := row.GetValues()
-			if i < len(values) {
-				return extractValue(values[i]), nil
-			}
-			return nil, fmt.Errorf("column index out of range: %s", e.Name)
-		}
+	// INSERT の VALUES のように行がない場所ではカラムを参照できない
+	if schema == nil {
+		return nil, fmt.Errorf("column not found: %s", e.Name)
 	}
-	return nil, fmt.Errorf("column not found: %s", e.Name)
+	// カラム名（修飾子があればテーブル名も）からインデックスを取得
+	i, err := schema.FindColumn(e.TableName, e.Name)
+	if err != nil {
+		return nil, err
+	}
+	values := row.GetValues()
+	if i < len(values) {
+		return extractValue(values[i]), nil
+	}
+	return nil, fmt.Errorf("column index out of range: %s", e.Name)
 }
 
 func (e *ColumnRef) String() string {
@@ -167,12 +483,18 @@ func extractValue(v storage.Value) any {
 	switch val := v.(type) {
 	case storage.StringValue:
 		return string(val)
+	case storage.TextValue:
+		return string(val)
 	case storage.BoolValue:
 		return bool(val)
 	case storage.Int32Value:
 		return int(val)
 	case storage.Int64Value:
 		return int64(val)
+	case storage.Float32Value:
+		return float64(val)
+	case storage.Float64Value:
+		return float64(val)
 	default:
 		return v
 	}
@@ -188,13 +510,16 @@ func (e *Literal) Evaluate(row *storage.Row, schema *storage.Schema) (any, error
 }
 
 func (e *Literal) String() string {
+	if e.Value == nil {
+		return "NULL"
+	}
 	return fmt.Sprintf("%v", e.Value)
 }
 
 // BinaryExpr は二項演算を表す
 type BinaryExpr struct {
 	Left     Expression
-	Operator string // =, <, >, <=, >=, !=, AND, OR
+	Operator string // =, <, >, <=, >=, !=, AND, OR, +, -, *, /, %
 	Right    Expression
 }
 
@@ -207,86 +532,205 @@ func (e *BinaryExpr) Evaluate(row *storage.Row, schema *storage.Schema) (any, er
 	if err != nil {
 		return nil, err
 	}
+	return evaluateBinary(e.Operator, leftVal, rightVal)
+}
+
+func (e *BinaryExpr) String() string {
+	return fmt.Sprintf("(%s %s %s)", e.Left.String(), e.Operator, e.Right.String())
+}
 
-	switch e.Operator {
+// evaluateBinary は二項演算を SQL の3値論理で評価する
+// NULL（nil）を含む比較や算術は NULL（不明）になる
+// AND は片方が false なら false、OR は片方が true なら true になり、それ以外で NULL があれば NULL になる
+func evaluateBinary(operator string, left, right any) (any, error) {
+	switch strings.ToUpper(operator) {
+	case "AND":
+		l, r, err := toTruthValues(operator, left, right)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case l == truthFalse || r == truthFalse:
+			return false, nil
+		case l == truthUnknown || r == truthUnknown:
+			return nil, nil
+		}
+		return true, nil
+	case "OR":
+		l, r, err := toTruthValues(operator, left, right)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case l == truthTrue || r == truthTrue:
+			return true, nil
+		case l == truthUnknown || r == truthUnknown:
+			return nil, nil
+		}
+		return false, nil
+	case "+", "-", "*", "/", "%":
+		return evaluateArithmetic(operator, left, right)
+	}
+	if left == nil || right == nil {
+		switch operator {
+		case "=", "!=", "<>", "<", ">", "<=", ">=":
+			return nil, nil
+		}
+	}
+	switch operator {
 	case "=":
-		return leftVal == rightVal, nil
+		return valuesEqual(left, right), nil
 	case "!=", "<>":
-		return leftVal != rightVal, nil
+		return !valuesEqual(left, right), nil
 	case "<":
-		return compareValues(leftVal, rightVal) < 0, nil
+		return compareValues(left, right) < 0, nil
 	case ">":
-		return compareValues(leftVal, rightVal) > 0, nil
+		return compareValues(left, right) > 0, nil
 	case "<=":
-		return compareValues(leftVal, rightVal) <= 0, nil
+		return compareValues(left, right) <= 0, nil
 	case ">=":
-		return compareValues(leftVal, rightVal) >= 0, nil
-	case "AND":
-		leftBool, ok1 := leftVal.(bool)
-		rightBool, ok2 := rightVal.(bool)
-		if ok1 && ok2 {
-			return leftBool && rightBool, nil
-		}
-		return false, fmt.Errorf("AND requires boolean operands")
-	case "OR":
-		leftBool, ok1 := leftVal.(bool)
-		rightBool, ok2 := rightVal.(bool)
-		if ok1 && ok2 {
-			return leftBool || rightBool, nil
-		}
-		return false, fmt.Errorf("OR requires boolean operands")
+		return compareValues(left, right) >= 0, nil
 	default:
-		return nil, fmt.Errorf("unknown operator: %s", e.Operator)
+		return nil, fmt.Errorf("unknown operator: %s", operator)
 	}
 }
 
-func (e *BinaryExpr) String() string {
-	return fmt.Sprintf("(%s %s %s)", e.Left.String(), e.Operator, e.Right.String())
+// truthValue は3値論理の値
+type truthValue int
+
+const (
+	truthUnknown truthValue = iota
+	truthFalse
+	truthTrue
+)
+
+// toTruthValues は AND / OR の左右の値を3値論理の値にする（NULL は不明）
+func toTruthValues(operator string, left, right any) (truthValue, truthValue, error) {
+	l, ok1 := toTruthValue(left)
+	r, ok2 := toTruthValue(right)
+	if !ok1 || !ok2 {
+		return truthUnknown, truthUnknown, fmt.Errorf("%s requires boolean operands", strings.ToUpper(operator))
+	}
+	return l, r, nil
 }
 
-// compareValues は2つの値を比較する
-func compareValues(left, right any) int {
-	switch l := left.(type) {
-	case int:
-		if r, ok := right.(int); ok {
-			if l < r {
-				return -1
-			} else if l > r {
-				return 1
-			}
-			return 0
+func toTruthValue(value any) (truthValue, bool) {
+	switch v := value.(type) {
+	case nil:
+		return truthUnknown, true
+	case bool:
+		if v {
+			return truthTrue, true
 		}
-	case int64:
-		if r, ok := right.(int64); ok {
-			if l < r {
-				return -1
-			} else if l > r {
-				return 1
-			}
-			return 0
-		}
-	case string:
-		if r, ok := right.(string); ok {
-			if l < r {
-				return -1
-			} else if l > r {
-				return 1
-			}
-			return 0
+		return truthFalse, true
+	}
+	return truthUnknown, false
+}
+
+// UnaryExpr は単項演算（-x と NOT x）を表す
+type UnaryExpr struct {
+	Operator string // -, NOT
+	Expr     Expression
+}
+
+func (e *UnaryExpr) Evaluate(row *storage.Row, schema *storage.Schema) (any, error) {
+	value, err := e.Expr.Evaluate(row, schema)
+	if err != nil {
+		return nil, err
+	}
+	return evaluateUnary(e.Operator, value)
+}
+
+func (e *UnaryExpr) String() string {
+	if strings.EqualFold(e.Operator, "NOT") {
+		return fmt.Sprintf("(NOT %s)", e.Expr.String())
+	}
+	return fmt.Sprintf("(%s%s)", e.Operator, e.Expr.String())
+}
+
+// evaluateUnary は単項演算を評価する（-x は 0 - x として計算する）
+// NOT は3値論理で評価する（NOT NULL は NULL）
+func evaluateUnary(operator string, value any) (any, error) {
+	if strings.EqualFold(operator, "NOT") {
+		switch t, ok := toTruthValue(value); {
+		case !ok:
+			return nil, fmt.Errorf("NOT requires a boolean operand")
+		case t == truthUnknown:
+			return nil, nil
+		default:
+			return t == truthFalse, nil
 		}
 	}
-	return 0
+	if operator != "-" {
+		return nil, fmt.Errorf("unknown operator: %s", operator)
+	}
+	if value == nil {
+		return nil, nil
+	}
+	switch value.(type) {
+	case int, int64, float64, storage.DecimalValue:
+		return evaluateArithmetic("-", 0, value)
+	}
+	return nil, fmt.Errorf("unsupported operand type for unary -: %T", value)
+}
+
+// IsNullExpr は IS NULL / IS NOT NULL を表す（結果は NULL にならない）
+type IsNullExpr struct {
+	Expr Expression
+	Not  bool // IS NOT NULL かどうか
+}
+
+func (e *IsNullExpr) Evaluate(row *storage.Row, schema *storage.Schema) (any, error) {
+	value, err := e.Expr.Evaluate(row, schema)
+	if err != nil {
+		return nil, err
+	}
+	return (value == nil) != e.Not, nil
+}
+
+func (e *IsNullExpr) String() string {
+	if e.Not {
+		return fmt.Sprintf("(%s IS NOT NULL)", e.Expr.String())
+	}
+	return fmt.Sprintf("(%s IS NULL)", e.Expr.String())
+}
+
+// compareValues は2つの値を比較する（比較できない組み合わせは 0 を返す）
+// 数値は型が違っても値で比べ、日付や時刻は文字列と比べられる
+func compareValues(left, right any) int {
+	c, err := storage.CompareValues(toValue(left), toValue(right))
+	if err != nil {
+		return 0
+	}
+	return c
+}
+
+// valuesEqual は2つの値が等しいかどうかを返す
+// 比較できる値は compareValues で比べる（1.5 と 1.50 や、1 と 1.0 は等しい）
+func valuesEqual(left, right any) bool {
+	if c, err := storage.CompareValues(toValue(left), toValue(right)); err == nil {
+		return c == 0
+	}
+	return left == right
 }
 
 type AggregateNode struct {
 	Child      PlanNode              // 子ノード
 	GroupBy    []string              // GROUP BY 句
 	Aggregates []AggregateExpression // 集約関数
-	schema     *storage.Schema       // スキーマ
 }
 
-func (n *AggregateNode) Schema() *storage.Schema { return n.schema }
-func (n *AggregateNode) Children() []PlanNode    { return []PlanNode{n.Child} }
+// Schema は集約関数ごとに1カラムのスキーマを返す
+func (n *AggregateNode) Schema() *storage.Schema {
+	input := n.Child.Schema()
+	columns := make([]storage.Column, len(n.Aggregates))
+	for i, agg := range n.Aggregates {
+		columns[i] = aggregateColumn(agg, input)
+	}
+	return storage.NewSchema(input.GetTableName(), columns)
+}
+
+func (n *AggregateNode) Children() []PlanNode { return []PlanNode{n.Child} }
 func (n *AggregateNode) String() string {
 	return fmt.Sprintf("Aggregate(%v, %v)", n.GroupBy, n.Aggregates)
 }
@@ -297,6 +741,18 @@ type AggregateExpression struct {
 	Alias    string // AS のエイリアス
 }
 
+// Name は集約結果のカラム名を返す（エイリアスがなければ COUNT(*) のような式の文字列）
+func (a AggregateExpression) Name() string {
+	if a.Alias != "" {
+		return a.Alias
+	}
+	column := a.Column
+	if column == "" {
+		column = "*"
+	}
+	return fmt.Sprintf("%s(%s)", strings.ToUpper(a.Function), column)
+}
+
 type EmptyNode struct {
 	schema *storage.Schema
 }
@@ -249,3 +249,116 @@ func TestNodeChildren(t *testing.T) {
 		t.Error("ProjectNode should have one child")
 	}
 }
+
+func TestEvaluateBinaryThreeValuedLogic(t *testing.T) {
+	tests := []struct {
+		left     any
+		operator string
+		right    any
+		expected any
+	}{
+		{nil, "=", 1, nil},
+		{nil, "=", nil, nil},
+		{1, "<>", nil, nil},
+		{nil, "<", 1, nil},
+		{nil, "+", 1, nil},
+		{false, "AND", nil, false},
+		{true, "AND", nil, nil},
+		{nil, "AND", nil, nil},
+		{true, "OR", nil, true},
+		{false, "OR", nil, nil},
+		{true, "and", true, true},
+	}
+	for _, tt := range tests {
+		got, err := evaluateBinary(tt.operator, tt.left, tt.right)
+		if err != nil {
+			t.Fatalf("%v %s %v failed: %v", tt.left, tt.operator, tt.right, err)
+		}
+		if got != tt.expected {
+			t.Errorf("%v %s %v = %v, want %v", tt.left, tt.operator, tt.right, got, tt.expected)
+		}
+	}
+	if _, err := evaluateBinary("AND", true, 1); err == nil {
+		t.Error("expected an error for a non-boolean AND operand")
+	}
+}
+
+func TestIsNullExpr(t *testing.T) {
+	schema := storage.NewSchema("users", []storage.Column{
+		*storage.NewColumn("email", storage.ColumnTypeString, 255, true),
+	})
+	rows := []*storage.Row{
+		storage.NewRow([]storage.Value{nil}),
+		storage.NewRow([]storage.Value{storage.StringValue("a@example.com")}),
+	}
+	for _, not := range []bool{false, true} {
+		expr := &IsNullExpr{Expr: &ColumnRef{Name: "email"}, Not: not}
+		for i, row := range rows {
+			got, err := expr.Evaluate(row, schema)
+			if err != nil {
+				t.Fatalf("Evaluate failed: %v", err)
+			}
+			if want := (i == 0) != not; got != want {
+				t.Errorf("%s on row %d = %v, want %v", expr, i, got, want)
+			}
+		}
+	}
+	if s := (&IsNullExpr{Expr: &ColumnRef{Name: "email"}, Not: true}).String(); s != "(email IS NOT NULL)" {
+		t.Errorf("unexpected String(): %s", s)
+	}
+}
+
+func TestProjectNodeDerivedColumns(t *testing.T) {
+	schema := storage.NewSchema("orders", []storage.Column{
+		*storage.NewColumn("id", storage.ColumnTypeInt32, 4, false),
+		*storage.NewColumn("price", storage.ColumnTypeFloat64, 8, false),
+		*storage.NewColumn("qty", storage.ColumnTypeInt32, 4, false),
+	})
+	node := &ProjectNode{
+		Columns: []string{"id", "total", "(-qty)"},
+		Expressions: []Expression{
+			&ColumnRef{Name: "id"},
+			&BinaryExpr{Left: &ColumnRef{Name: "price"}, Operator: "*", Right: &ColumnRef{Name: "qty"}},
+			&UnaryExpr{Operator: "-", Expr: &ColumnRef{Name: "qty"}},
+		},
+		Child: &ScanNode{TableName: "orders", TableSchema: schema},
+	}
+	if expected := "Project([id (price * qty) AS total (-qty)])"; node.String() != expected {
+		t.Errorf("Expected '%s', got '%s'", expected, node.String())
+	}
+
+	// 出力スキーマは射影したカラムだけを持ち、式の型を推測する
+	columns := node.Schema().GetColumns()
+	expected := []struct {
+		name     string
+		colType  storage.ColumnType
+		nullable bool
+	}{
+		{"id", storage.ColumnTypeInt32, false},
+		{"total", storage.ColumnTypeFloat64, true},
+		{"(-qty)", storage.ColumnTypeInt32, true},
+	}
+	if len(columns) != len(expected) {
+		t.Fatalf("expected %d columns, got %d", len(expected), len(columns))
+	}
+	for i, want := range expected {
+		if columns[i].GetName() != want.name || columns[i].GetColumnType() != want.colType || columns[i].GetNullable() != want.nullable {
+			t.Errorf("column %d = %s %v nullable=%v, want %s %v nullable=%v", i,
+				columns[i].GetName(), columns[i].GetColumnType(), columns[i].GetNullable(), want.name, want.colType, want.nullable)
+		}
+	}
+
+	row := storage.NewRow([]storage.Value{storage.Int32Value(1), storage.Float64Value(2.5), storage.Int32Value(4)})
+	if got, err := node.Expressions[1].Evaluate(row, schema); err != nil || got != 10.0 {
+		t.Errorf("price * qty = %v, %v", got, err)
+	}
+	if got, err := node.Expressions[2].Evaluate(row, schema); err != nil || got != -4 {
+		t.Errorf("-qty = %v, %v", got, err)
+	}
+	if got, err := (&UnaryExpr{Operator: "-", Expr: &Literal{Value: nil}}).Evaluate(nil, nil); err != nil || got != nil {
+		t.Errorf("-NULL = %v, %v", got, err)
+	}
+	if _, err := (&UnaryExpr{Operator: "-", Expr: &Literal{Value: "a"}}).Evaluate(nil, nil); err == nil {
+		t.Error("expected an error for -'a'")
+	}
+}
@@ -2,6 +2,8 @@ package planner
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/takeuchi-shogo/go-example-database/internal/catalog"
 	"github.com/takeuchi-shogo/go-example-database/internal/parser"
@@ -35,6 +37,15 @@ func (p *planner) Plan(statement parser.Statement) (PlanNode, error) {
 		return p.planDelete(stmt)
 	case *parser.CreateTableStatement:
 		return p.planCreateTable(stmt)
+	case *parser.CreateIndexStatement:
+		return p.planCreateIndex(stmt)
+	case *parser.DropIndexStatement:
+		return &DropIndexNode{IndexName: stmt.IndexName}, nil
+	case *parser.AnalyzeStatement:
+		if stmt.TableName != "" && !p.catalog.TableExists(stmt.TableName) {
+			return nil, fmt.Errorf("table not found: %s", stmt.TableName)
+		}
+		return &AnalyzeNode{TableName: stmt.TableName}, nil
 	case *parser.ExplainStatement:
 		return p.planExplain(stmt)
 	default:
@@ -44,56 +55,199 @@ func (p *planner) Plan(statement parser.Statement) (PlanNode, error) {
 
 // planSelect は SELECT 文を PlanNode に変換する
 func (p *planner) planSelect(stmt *parser.SelectStatement) (PlanNode, error) {
-	// 1. テーブルスキャン
-	schema, err := p.catalog.GetSchema(stmt.From)
+	plan, outerRefs, err := p.planQuery(stmt)
 	if err != nil {
-		return nil, fmt.Errorf("table not found: %s", stmt.From)
+		return nil, err
+	}
+	// 外側のクエリがないので、FROM 句にないカラムは参照できない
+	if len(outerRefs) > 0 {
+		return nil, checkColumns(outerRefs[0], plan.Schema())
 	}
+	return plan, nil
+}
 
-	var plan PlanNode = &ScanNode{
-		TableName:   stmt.From,
-		TableSchema: schema,
+// planQuery は SELECT 文を PlanNode に変換する
+// WHERE 句が FROM 句にないカラム（相関サブクエリなら外側のカラム）を参照していれば、それも返す
+func (p *planner) planQuery(stmt *parser.SelectStatement) (PlanNode, []*ColumnRef, error) {
+	// 1. FROM 句（テーブル、派生テーブル、JOIN）
+	plan, err := p.planFrom(stmt)
+	if err != nil {
+		return nil, nil, err
 	}
+	// 2. WHERE 句
+	plan, outerRefs, err := p.planWhere(stmt.Where, plan)
+	if err != nil {
+		return nil, nil, err
+	}
+	// 3. 集約または射影
+	input := plan
+	plan, err = p.planSelectOutput(stmt, plan)
+	if err != nil {
+		return nil, nil, err
+	}
+	// 4. DISTINCT と ORDER BY
+	plan, err = p.planOrderBy(stmt, input, plan)
+	if err != nil {
+		return nil, nil, err
+	}
+	// 5. LIMIT と OFFSET
+	return planLimit(stmt, plan), outerRefs, nil
+}
 
-	// 2. JOIN 句があれば JOIN ノードを追加
-	if stmt.Join != nil {
-		// 右テーブルのスキーマを取得
-		rightSchema, err := p.catalog.GetSchema(stmt.Join.Table)
+// planFrom は FROM 句と JOIN を PlanNode に変換する
+// JOIN は書いた順に左から結合する
+func (p *planner) planFrom(stmt *parser.SelectStatement) (PlanNode, error) {
+	plan, err := p.planTableReference(stmt.From, stmt.Alias, stmt.Subquery)
+	if err != nil {
+		return nil, err
+	}
+	for _, join := range stmt.Joins {
+		right, err := p.planTableReference(join.Table, join.Alias, join.Subquery)
 		if err != nil {
-			return nil, fmt.Errorf("table not found: %s", stmt.Join.Table)
-		}
-		// 右テーブルのスキャンノードを作成
-		rightScan := &ScanNode{
-			TableName:   stmt.Join.Table,
-			TableSchema: rightSchema,
+			return nil, err
 		}
-		// 結合条件をパース
-		condition, err := p.planExpression(stmt.Join.On)
+		joinType, err := planJoinType(join.Type)
 		if err != nil {
 			return nil, err
 		}
-		// JOIN ノードを作成
-		plan = &JoinNode{
+		// 結合条件（USING は同じ名前のカラムの等価条件にする）
+		var condition Expression
+		var using []usingColumn
+		switch {
+		case join.On != nil:
+			if condition, err = p.planExpression(join.On); err != nil {
+				return nil, err
+			}
+		case len(join.Using) > 0:
+			if using, err = planUsing(join.Using, plan, right); err != nil {
+				return nil, err
+			}
+			condition = usingCondition(using)
+		}
+		join := &JoinNode{
 			Left:      plan,
-			Right:     rightScan,
-			JoinType:  JoinTypeInner,
+			Right:     right,
+			JoinType:  joinType,
 			Condition: condition,
 		}
+		// 別名を付けたテーブルは元のテーブル名では参照できない
+		if err := checkColumns(condition, join.ConditionSchema()); err != nil {
+			return nil, err
+		}
+		p.planJoinAlgorithm(join)
+		plan = join
+		if using != nil {
+			plan = planUsingColumns(join, using)
+		}
 	}
+	return plan, nil
+}
 
-	// 3. WHERE 句があればフィルタノードを追加
-	if stmt.Where != nil {
-		condition, err := p.planExpression(stmt.Where)
+// planTableReference は FROM や JOIN のテーブル（別名があれば別名のテーブル）か派生テーブルを PlanNode に変換する
+func (p *planner) planTableReference(name, alias string, subquery *parser.SelectStatement) (PlanNode, error) {
+	if subquery != nil {
+		// (SELECT ...) AS 別名
+		child, err := p.planSelect(subquery)
 		if err != nil {
 			return nil, err
 		}
-		plan = &FilterNode{
-			Condition: condition,
-			Child:     plan,
+		return &SubqueryScanNode{Alias: name, Child: child}, nil
+	}
+	schema, err := p.catalog.GetSchema(name)
+	if err != nil {
+		return nil, fmt.Errorf("table not found: %s", name)
+	}
+	if alias != "" {
+		schema = schema.WithTableName(alias)
+	}
+	return &ScanNode{TableName: name, TableSchema: schema}, nil
+}
+
+// planJoinType は JOIN の種類を JoinType に変換する
+func planJoinType(joinType string) (JoinType, error) {
+	switch strings.ToUpper(joinType) {
+	case "", "INNER":
+		return JoinTypeInner, nil
+	case "LEFT":
+		return JoinTypeLeft, nil
+	case "RIGHT":
+		return JoinTypeRight, nil
+	case "FULL":
+		return JoinTypeFull, nil
+	case "CROSS":
+		return JoinTypeCross, nil
+	}
+	return "", fmt.Errorf("unsupported join type: %s", joinType)
+}
+
+// planWhere は WHERE 句の条件を source の上に追加する
+// テーブルを直接読むならインデックスを使うか決め、それ以外は FilterNode で絞り込む
+// [NOT] EXISTS と [NOT] IN (SELECT ...) の条件はセミ結合・反結合にする
+// 戻り値は source のスキーマにないカラムの参照
+func (p *planner) planWhere(where parser.Expression, source PlanNode) (PlanNode, []*ColumnRef, error) {
+	if where == nil {
+		return source, nil, nil
+	}
+	schema := source.Schema()
+	var conditions []Expression
+	var joins []*JoinNode
+	conjuncts := splitWhere(where)
+	hasSubquery := false
+	for _, conjunct := range conjuncts {
+		if _, _, _, ok := subqueryPredicate(conjunct); ok {
+			hasSubquery = true
 		}
 	}
+	// サブクエリの条件がなければ WHERE 句をそのまま変換する
+	if !hasSubquery {
+		conjuncts = []parser.Expression{where}
+	}
+	for _, conjunct := range conjuncts {
+		if subquery, lhs, anti, ok := subqueryPredicate(conjunct); ok {
+			join, err := p.planSubqueryJoin(subquery, lhs, anti, schema)
+			if err != nil {
+				return nil, nil, err
+			}
+			joins = append(joins, join)
+			continue
+		}
+		condition, err := p.planExpression(conjunct)
+		if err != nil {
+			return nil, nil, err
+		}
+		conditions = append(conditions, condition)
+	}
 
-	// 4. 集約関数がある場合は AggregateNode を追加
+	var outerRefs []*ColumnRef
+	condition := joinConjunction(conditions)
+	for _, ref := range columnRefs(condition) {
+		idx, err := resolveColumn(schema, ref)
+		if err != nil {
+			return nil, nil, err
+		}
+		if idx < 0 {
+			outerRefs = append(outerRefs, ref)
+		}
+	}
+	plan := source
+	if condition != nil {
+		if scan, ok := source.(*ScanNode); ok {
+			plan = p.planTableAccess(scan.TableName, scan.TableSchema, condition)
+		} else {
+			plan = &FilterNode{Condition: condition, Child: source}
+		}
+	}
+	for _, join := range joins {
+		join.Left = plan
+		p.planJoinAlgorithm(join)
+		plan = join
+	}
+	return plan, outerRefs, nil
+}
+
+// planSelectOutput は SELECT 列に応じて集約または射影のノードを追加する
+func (p *planner) planSelectOutput(stmt *parser.SelectStatement, plan PlanNode) (PlanNode, error) {
+	// 集約関数がある場合は AggregateNode を追加
 	//    集約関数がない場合は SELECT 列が * でなければ ProjectNode を追加
 	if hasAggregateFunction(stmt.Columns) {
 		aggregates := extractAggregateFunctions(stmt.Columns)
@@ -101,22 +255,47 @@ func (p *planner) planSelect(stmt *parser.SelectStatement) (PlanNode, error) {
 			Child:      plan,
 			GroupBy:    stmt.GroupBy,
 			Aggregates: aggregates,
-			schema:     plan.Schema(),
 		}
 	} else if !isSelectAll(stmt.Columns) {
 		columns := extractColumnNames(stmt.Columns)
+		expressions := make([]Expression, len(stmt.Columns))
+		for i, col := range stmt.Columns {
+			if aliased, ok := col.(*parser.AliasedExpression); ok {
+				col = aliased.Expression
+			}
+			expr, err := p.planExpression(col)
+			if err != nil {
+				return nil, err
+			}
+			if err := checkColumns(expr, plan.Schema()); err != nil {
+				return nil, err
+			}
+			expressions[i] = expr
+		}
+		// 名前のない式は式の文字列をカラム名にする
+		for i, name := range columns {
+			if name == "" {
+				columns[i] = expressions[i].String()
+			}
+		}
 		plan = &ProjectNode{
-			Columns: columns,
-			Child:   plan,
+			Columns:     columns,
+			Expressions: expressions,
+			Child:       plan,
 		}
+	} else if hasHiddenColumns(plan.Schema()) {
+		// SELECT * は USING でまとめた元のカラムを出力しない
+		plan = planVisibleColumns(plan)
 	}
-
 	return plan, nil
 }
 
 // hasAggregateFunction は SELECT 列に集約関数が含まれているかどうかを判定する
 func hasAggregateFunction(columns []parser.Expression) bool {
 	for _, col := range columns {
+		if aliased, ok := col.(*parser.AliasedExpression); ok {
+			col = aliased.Expression
+		}
 		if _, ok := col.(*parser.AggregateFunction); ok {
 			return true
 		}
@@ -128,13 +307,17 @@ func hasAggregateFunction(columns []parser.Expression) bool {
 func extractAggregateFunctions(columns []parser.Expression) []AggregateExpression {
 	var aggregates []AggregateExpression
 	for _, col := range columns {
+		alias := ""
+		if aliased, ok := col.(*parser.AliasedExpression); ok {
+			col, alias = aliased.Expression, aliased.Alias
+		}
 		if agg, ok := col.(*parser.AggregateFunction); ok {
 			columnName := ""
 			if identity, ok := agg.Argument.(*parser.Identifier); ok {
 				columnName = identity.Value
 			}
 			// * の場合は全カラムを集約
-			aggregates = append(aggregates, AggregateExpression{Function: agg.Function, Column: columnName})
+			aggregates = append(aggregates, AggregateExpression{Function: agg.Function, Column: columnName, Alias: alias})
 		}
 	}
 	return aggregates
@@ -181,22 +364,15 @@ func (p *planner) planUpdate(stmt *parser.UpdateStatement) (PlanNode, error) {
 		sets[col] = planExpr
 	}
 
-	// 子ノード（WHERE 句があれば）
-	var child PlanNode = &ScanNode{
-		TableName:   stmt.TableName,
-		TableSchema: schema,
-	}
-
+	// 子ノード（WHERE 句があれば対象行を絞り込む）
+	var where Expression
 	if stmt.Where != nil {
-		condition, err := p.planExpression(stmt.Where)
+		where, err = p.planExpression(stmt.Where)
 		if err != nil {
 			return nil, err
 		}
-		child = &FilterNode{
-			Condition: condition,
-			Child:     child,
-		}
 	}
+	child := p.planTableAccess(stmt.TableName, schema, where)
 
 	return &UpdateNode{
 		TableName: stmt.TableName,
@@ -213,21 +389,14 @@ func (p *planner) planDelete(stmt *parser.DeleteStatement) (PlanNode, error) {
 	}
 
 	// 子ノード
-	var child PlanNode = &ScanNode{
-		TableName:   stmt.TableName,
-		TableSchema: schema,
-	}
-
+	var where Expression
 	if stmt.Where != nil {
-		condition, err := p.planExpression(stmt.Where)
+		where, err = p.planExpression(stmt.Where)
 		if err != nil {
 			return nil, err
 		}
-		child = &FilterNode{
-			Condition: condition,
-			Child:     child,
-		}
 	}
+	child := p.planTableAccess(stmt.TableName, schema, where)
 
 	return &DeleteNode{
 		TableName: stmt.TableName,
@@ -241,7 +410,17 @@ func (p *planner) planCreateTable(stmt *parser.CreateTableStatement) (PlanNode,
 	columns := make([]storage.Column, len(stmt.Columns))
 	for i, col := range stmt.Columns {
 		colType := parseColumnType(col.ColumnType)
-		columns[i] = *storage.NewColumn(col.Name, colType, 0, col.Nullable)
+		var size uint16
+		var scale uint8
+		if colType == storage.ColumnTypeDecimal {
+			var err error
+			if size, scale, err = parseDecimalType(col.ColumnType); err != nil {
+				return nil, err
+			}
+		}
+		columns[i] = *storage.NewColumn(col.Name, colType, size, col.Nullable)
+		columns[i].SetScale(scale)
+		columns[i].SetPrimaryKey(col.PrimaryKey)
 	}
 
 	schema := storage.NewSchema(stmt.TableName, columns)
@@ -252,10 +431,33 @@ func (p *planner) planCreateTable(stmt *parser.CreateTableStatement) (PlanNode,
 	}, nil
 }
 
+// planCreateIndex は CREATE INDEX 文を PlanNode に変換する
+func (p *planner) planCreateIndex(stmt *parser.CreateIndexStatement) (PlanNode, error) {
+	schema, err := p.catalog.GetSchema(stmt.TableName)
+	if err != nil {
+		return nil, fmt.Errorf("table not found: %s", stmt.TableName)
+	}
+	for _, column := range stmt.Columns {
+		if schema.GetColumnIndex(column) < 0 {
+			return nil, fmt.Errorf("column not found: %s", column)
+		}
+	}
+	return &CreateIndexNode{
+		IndexName: stmt.IndexName,
+		TableName: stmt.TableName,
+		Columns:   stmt.Columns,
+		Unique:    stmt.Unique,
+	}, nil
+}
+
 // planExplain は EXPLAIN 文を PlanNode に変換する
 func (p *planner) planExplain(stmt *parser.ExplainStatement) (PlanNode, error) {
-	// 内部の文をプランニングして返す（EXPLAIN 用の特別なノードは不要）
-	return p.Plan(stmt.Statement)
+	// 内部の文をプランニングし、実行せずに実行計画を返すノードで包む
+	plan, err := p.Plan(stmt.Statement)
+	if err != nil {
+		return nil, err
+	}
+	return &ExplainNode{Child: plan}, nil
 }
 
 // planExpression は parser.Expression を planner.Expression に変換する
@@ -270,12 +472,107 @@ func (p *planner) planExpression(expr parser.Expression) (Expression, error) {
 	case *parser.IntegerLiteral:
 		return &Literal{Value: e.Value}, nil
 
+	case *parser.FloatLiteral:
+		value, err := planFloatLiteral(e.Value)
+		if err != nil {
+			return nil, err
+		}
+		return &Literal{Value: value}, nil
+
+	case *parser.TypedLiteral:
+		value, err := planTypedLiteral(e.Type, e.Value)
+		if err != nil {
+			return nil, err
+		}
+		return &Literal{Value: value}, nil
+
 	case *parser.StringLiteral:
 		return &Literal{Value: e.Value}, nil
 
 	case *parser.BooleanLiteral:
 		return &Literal{Value: e.Value}, nil
 
+	case *parser.NullLiteral:
+		return &Literal{Value: nil}, nil
+
+	case *parser.IsNullExpression:
+		inner, err := p.planExpression(e.Expression)
+		if err != nil {
+			return nil, err
+		}
+		return &IsNullExpr{Expr: inner, Not: e.Not}, nil
+
+	case *parser.LikeExpression:
+		operands, err := p.planExpressions(e.Expression, e.Pattern, e.Escape)
+		if err != nil {
+			return nil, err
+		}
+		return &LikeExpr{Expr: operands[0], Pattern: operands[1], Escape: operands[2], Not: e.Not}, nil
+
+	case *parser.InExpression:
+		if e.Subquery != nil {
+			inner, err := p.planExpression(e.Expression)
+			if err != nil {
+				return nil, err
+			}
+			subquery, err := p.planSubquery(e.Subquery, 1)
+			if err != nil {
+				return nil, err
+			}
+			return &InSubqueryExpr{Expr: inner, Subquery: subquery, Not: e.Not}, nil
+		}
+		operands, err := p.planExpressions(append([]parser.Expression{e.Expression}, e.List...)...)
+		if err != nil {
+			return nil, err
+		}
+		return &InExpr{Expr: operands[0], List: operands[1:], Not: e.Not}, nil
+
+	case *parser.BetweenExpression:
+		operands, err := p.planExpressions(e.Expression, e.Low, e.High)
+		if err != nil {
+			return nil, err
+		}
+		return &BetweenExpr{Expr: operands[0], Low: operands[1], High: operands[2], Not: e.Not}, nil
+
+	case *parser.SubqueryExpression:
+		subquery, err := p.planSubquery(e.Select, 1)
+		if err != nil {
+			return nil, err
+		}
+		return &ScalarSubqueryExpr{Subquery: subquery}, nil
+
+	case *parser.ExistsExpression:
+		subquery, err := p.planSubquery(e.Subquery, 0)
+		if err != nil {
+			return nil, err
+		}
+		return &ExistsExpr{Subquery: subquery}, nil
+
+	case *parser.FunctionCall:
+		args, err := p.planExpressions(e.Arguments...)
+		if err != nil {
+			return nil, err
+		}
+		return NewFunctionExpr(e.Name, args)
+
+	case *parser.CastExpression:
+		inner, err := p.planExpression(e.Expression)
+		if err != nil {
+			return nil, err
+		}
+		target, err := planCastTarget(e.Type)
+		if err != nil {
+			return nil, err
+		}
+		return &CastExpr{Expr: inner, Target: target, Type: e.Type}, nil
+
+	case *parser.UnaryExpression:
+		inner, err := p.planExpression(e.Operand)
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryExpr{Operator: e.Operator, Expr: inner}, nil
+
 	case *parser.BinaryExpression:
 		left, err := p.planExpression(e.Left)
 		if err != nil {
@@ -296,6 +593,64 @@ func (p *planner) planExpression(expr parser.Expression) (Expression, error) {
 	}
 }
 
+// planExpressions は複数の式をまとめて変換する（nil の式は nil のまま）
+func (p *planner) planExpressions(exprs ...parser.Expression) ([]Expression, error) {
+	planned := make([]Expression, len(exprs))
+	for i, expr := range exprs {
+		if expr == nil {
+			continue
+		}
+		var err error
+		if planned[i], err = p.planExpression(expr); err != nil {
+			return nil, err
+		}
+	}
+	return planned, nil
+}
+
+// planFloatLiteral は小数のリテラルを値にする
+// 1.50 のような小数は DECIMAL、2e10 のような指数表記は浮動小数点数として扱う
+func planFloatLiteral(literal string) (any, error) {
+	if strings.ContainsAny(literal, "eE") {
+		f, err := strconv.ParseFloat(literal, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number: %s", literal)
+		}
+		return f, nil
+	}
+	return storage.ParseDecimal(literal)
+}
+
+// planCastTarget は CAST の変換先の型をカラムにする
+func planCastTarget(typeName string) (storage.Column, error) {
+	colType := parseColumnType(typeName)
+	var size uint16
+	var scale uint8
+	if colType == storage.ColumnTypeDecimal {
+		var err error
+		if size, scale, err = parseDecimalType(typeName); err != nil {
+			return storage.Column{}, err
+		}
+	}
+	col := storage.NewColumn("CAST", colType, size, true)
+	col.SetScale(scale)
+	return *col, nil
+}
+
+// planTypedLiteral は DATE '2024-01-31' のような型付きリテラルを値にする
+func planTypedLiteral(typeName, literal string) (any, error) {
+	switch typeName {
+	case "DATE":
+		return storage.ParseDate(literal)
+	case "TIME":
+		return storage.ParseTime(literal)
+	case "TIMESTAMP":
+		return storage.ParseTimestamp(literal)
+	default:
+		return nil, fmt.Errorf("unsupported literal type: %s", typeName)
+	}
+}
+
 // isSelectAll は SELECT * かどうかを判定する
 func isSelectAll(columns []parser.Expression) bool {
 	if len(columns) == 1 {
@@ -305,12 +660,20 @@ func isSelectAll(columns []parser.Expression) bool {
 	return false
 }
 
-// extractColumnNames は SELECT 列からカラム名を抽出する
+// extractColumnNames は SELECT 列から出力カラム名を抽出する
+// エイリアスがあればエイリアス、カラム参照ならカラム名、それ以外の式は空文字になる
 func extractColumnNames(columns []parser.Expression) []string {
 	names := make([]string, 0, len(columns))
 	for _, col := range columns {
-		if ident, ok := col.(*parser.Identifier); ok {
-			names = append(names, ident.Value)
+		switch c := col.(type) {
+		case *parser.AliasedExpression:
+			names = append(names, c.Alias)
+		case *parser.Identifier:
+			names = append(names, c.Value)
+		case *parser.QualifiedIdentifier:
+			names = append(names, c.ColumnName)
+		default:
+			names = append(names, "")
 		}
 	}
 	return names
@@ -323,11 +686,27 @@ func parseColumnType(typeStr string) storage.ColumnType {
 		return storage.ColumnTypeInt32
 	case "BIGINT":
 		return storage.ColumnTypeInt64
+	case "FLOAT":
+		return storage.ColumnTypeFloat32
+	case "DOUBLE":
+		return storage.ColumnTypeFloat64
 	case "BOOL":
 		return storage.ColumnTypeBool
 	case "TEXT":
-		return storage.ColumnTypeString
+		return storage.ColumnTypeText
+	case "BLOB":
+		return storage.ColumnTypeBlob
+	case "DATE":
+		return storage.ColumnTypeDate
+	case "TIME":
+		return storage.ColumnTypeTime
+	case "TIMESTAMP":
+		return storage.ColumnTypeTimestamp
 	default:
+		// DECIMAL(p,s)
+		if strings.HasPrefix(typeStr, "DECIMAL") {
+			return storage.ColumnTypeDecimal
+		}
 		// VARCHAR(n) など
 		if len(typeStr) >= 7 && typeStr[:7] == "VARCHAR" {
 			return storage.ColumnTypeString
@@ -335,3 +714,17 @@ func parseColumnType(typeStr string) storage.ColumnType {
 		return storage.ColumnTypeString
 	}
 }
+
+// parseDecimalType は DECIMAL(p,s) の精度とスケールを返す（省略時は精度 0、スケール 0）
+func parseDecimalType(typeStr string) (uint16, uint8, error) {
+	var precision, scale int
+	if typeStr != "DECIMAL" {
+		if _, err := fmt.Sscanf(typeStr, "DECIMAL(%d,%d)", &precision, &scale); err != nil {
+			return 0, 0, fmt.Errorf("invalid column type: %s", typeStr)
+		}
+	}
+	if precision > storage.MaxDecimalPrecision || scale > precision && precision != 0 || scale > storage.MaxDecimalPrecision {
+		return 0, 0, fmt.Errorf("invalid DECIMAL precision or scale: %s", typeStr)
+	}
+	return uint16(precision), uint8(scale), nil
+}
@@ -12,12 +12,14 @@ import (
 type mockCatalog struct {
 	schemas map[string]*storage.Schema
 	tables  map[string]bool
+	indexes map[string][]catalog.IndexInfo
 }
 
 func newMockCatalog() *mockCatalog {
 	return &mockCatalog{
 		schemas: make(map[string]*storage.Schema),
 		tables:  make(map[string]bool),
+		indexes: make(map[string][]catalog.IndexInfo),
 	}
 }
 
@@ -52,6 +54,31 @@ func (m *mockCatalog) GetSchema(name string) (*storage.Schema, error) {
 	return nil, nil
 }
 
+func (m *mockCatalog) GetBufferPool() *storage.BufferPool {
+	return nil
+}
+
+func (m *mockCatalog) CreateIndex(name, tableName string, columns []string, unique bool) error {
+	m.indexes[tableName] = append(m.indexes[tableName], catalog.IndexInfo{Name: name, TableName: tableName, Columns: columns, Unique: unique})
+	return nil
+}
+
+func (m *mockCatalog) DropIndex(name string) error {
+	return nil
+}
+
+func (m *mockCatalog) GetIndexes(tableName string) []catalog.IndexInfo {
+	return m.indexes[tableName]
+}
+
+func (m *mockCatalog) SetStatistics(tableName string, stats *storage.TableStatistics) error {
+	return nil
+}
+
+func (m *mockCatalog) GetStatistics(tableName string) *storage.TableStatistics {
+	return nil
+}
+
 func (m *mockCatalog) Close() error {
 	return nil
 }
@@ -294,3 +321,131 @@ func TestPlanDelete(t *testing.T) {
 		t.Fatalf("Expected FilterNode as child, got %T", deleteNode.Child)
 	}
 }
+
+func TestPlanSelectUsesIndex(t *testing.T) {
+	mock := setupTestCatalog()
+	mock.CreateIndex("users_pkey", "users", []string{"id"}, true)
+	planner := NewPlanner(mock)
+
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		// 等価条件はインデックススキャンだけで済む
+		{"SELECT * FROM users WHERE id = 1", "IndexScan(users, users_pkey, id = 1)"},
+		// 定数が左にある場合は演算子を反転する
+		{"SELECT * FROM users WHERE 10 < id", "IndexScan(users, users_pkey, 10 < id)"},
+		// 範囲条件以外は FilterNode に残る
+		{"SELECT * FROM users WHERE id >= 1 AND id < 5 AND active = true",
+			"Filter((active = true))"},
+		// インデックスのないカラムは全件スキャン
+		{"SELECT * FROM users WHERE name = 'alice'", "Filter((name = alice))"},
+		// BETWEEN は範囲条件になる（NOT BETWEEN はならない）
+		{"SELECT * FROM users WHERE id BETWEEN 1 AND 5", "IndexScan(users, users_pkey, 1 <= id <= 5)"},
+		{"SELECT * FROM users WHERE id NOT BETWEEN 1 AND 5", "Filter((id NOT BETWEEN 1 AND 5))"},
+	}
+	for _, tt := range tests {
+		stmt, err := parser.NewParser(parser.NewLexer(tt.sql)).Parse()
+		if err != nil {
+			t.Fatalf("%s: parse error: %v", tt.sql, err)
+		}
+		plan, err := planner.Plan(stmt)
+		if err != nil {
+			t.Fatalf("%s: plan error: %v", tt.sql, err)
+		}
+		if plan.String() != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.sql, tt.expected, plan.String())
+		}
+	}
+
+	stmt, _ := parser.NewParser(parser.NewLexer("SELECT * FROM users WHERE id >= 1 AND id < 5 AND active = true")).Parse()
+	plan, _ := planner.Plan(stmt)
+	filter, ok := plan.(*FilterNode)
+	if !ok {
+		t.Fatalf("expected *FilterNode, got %T", plan)
+	}
+	if filter.Child.String() != "IndexScan(users, users_pkey, 1 <= id < 5)" {
+		t.Errorf("unexpected child: %s", filter.Child.String())
+	}
+	if _, ok := filter.Child.(*ScanNode); ok {
+		t.Error("expected index scan, got full scan")
+	}
+}
+
+func TestPlanSelectUsesCompositeIndex(t *testing.T) {
+	mock := setupTestCatalog()
+	mock.CreateIndex("users_name_id", "users", []string{"name", "id"}, true)
+	planner := NewPlanner(mock)
+
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		// 全カラムの等価条件
+		{"SELECT * FROM users WHERE id = 1 AND name = 'bob'", "IndexScan(users, users_name_id, (name, id) = (bob, 1))"},
+		// 先頭カラムの等価条件と次のカラムの範囲条件
+		{"SELECT * FROM users WHERE name = 'bob' AND id > 3", "IndexScan(users, users_name_id, (bob, 3) < (name, id) <= bob)"},
+		// 先頭カラムだけ
+		{"SELECT * FROM users WHERE name = 'bob'", "IndexScan(users, users_name_id, name = bob)"},
+		// 先頭カラムに条件がなければ使えない
+		{"SELECT * FROM users WHERE id = 1", "Filter((id = 1))"},
+	}
+	for _, tt := range tests {
+		stmt, err := parser.NewParser(parser.NewLexer(tt.sql)).Parse()
+		if err != nil {
+			t.Fatalf("%s: parse error: %v", tt.sql, err)
+		}
+		plan, err := planner.Plan(stmt)
+		if err != nil {
+			t.Fatalf("%s: plan error: %v", tt.sql, err)
+		}
+		if plan.String() != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.sql, tt.expected, plan.String())
+		}
+	}
+}
+
+func TestPlanDeleteUsesIndex(t *testing.T) {
+	mock := setupTestCatalog()
+	mock.CreateIndex("users_pkey", "users", []string{"id"}, true)
+	planner := NewPlanner(mock)
+
+	stmt, _ := parser.NewParser(parser.NewLexer("DELETE FROM users WHERE id = 3")).Parse()
+	plan, err := planner.Plan(stmt)
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	deleteNode := plan.(*DeleteNode)
+	if _, ok := deleteNode.Child.(*IndexScanNode); !ok {
+		t.Errorf("expected *IndexScanNode child, got %T", deleteNode.Child)
+	}
+}
+
+func TestPlanCreateAndDropIndex(t *testing.T) {
+	mock := setupTestCatalog()
+	planner := NewPlanner(mock)
+
+	stmt, _ := parser.NewParser(parser.NewLexer("CREATE UNIQUE INDEX idx_name ON users (id)")).Parse()
+	plan, err := planner.Plan(stmt)
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	createNode, ok := plan.(*CreateIndexNode)
+	if !ok || createNode.IndexName != "idx_name" || len(createNode.Columns) != 1 || createNode.Columns[0] != "id" || !createNode.Unique {
+		t.Errorf("unexpected plan: %#v", plan)
+	}
+
+	stmt, _ = parser.NewParser(parser.NewLexer("CREATE INDEX idx_missing ON users (missing)")).Parse()
+	if _, err := planner.Plan(stmt); err == nil {
+		t.Error("expected error for missing column")
+	}
+
+	stmt, _ = parser.NewParser(parser.NewLexer("DROP INDEX idx_name")).Parse()
+	plan, err = planner.Plan(stmt)
+	if err != nil {
+		t.Fatalf("plan error: %v", err)
+	}
+	if dropNode, ok := plan.(*DropIndexNode); !ok || dropNode.IndexName != "idx_name" {
+		t.Errorf("unexpected plan: %#v", plan)
+	}
+}
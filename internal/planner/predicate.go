@@ -0,0 +1,230 @@
+package planner
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
+)
+
+// LikeExpr は [NOT] LIKE を表す
+type LikeExpr struct {
+	Expr    Expression
+	Pattern Expression
+	Escape  Expression // ESCAPE の文字（nil ならエスケープしない）
+	Not     bool
+}
+
+func (e *LikeExpr) Evaluate(row *storage.Row, schema *storage.Schema) (any, error) {
+	value, err := e.Expr.Evaluate(row, schema)
+	if err != nil {
+		return nil, err
+	}
+	pattern, err := e.Pattern.Evaluate(row, schema)
+	if err != nil {
+		return nil, err
+	}
+	var escape any
+	if e.Escape != nil {
+		if escape, err = e.Escape.Evaluate(row, schema); err != nil {
+			return nil, err
+		}
+	}
+	return evaluateLike(value, pattern, escape, e.Escape != nil, e.Not)
+}
+
+func (e *LikeExpr) String() string {
+	operator := "LIKE"
+	if e.Not {
+		operator = "NOT LIKE"
+	}
+	if e.Escape != nil {
+		return fmt.Sprintf("(%s %s %s ESCAPE %s)", e.Expr.String(), operator, e.Pattern.String(), e.Escape.String())
+	}
+	return fmt.Sprintf("(%s %s %s)", e.Expr.String(), operator, e.Pattern.String())
+}
+
+// evaluateLike は LIKE を3値論理で評価する（どれかが NULL なら NULL）
+func evaluateLike(value, pattern, escape any, hasEscape, not bool) (any, error) {
+	if value == nil || pattern == nil || (hasEscape && escape == nil) {
+		return nil, nil
+	}
+	s, ok1 := value.(string)
+	p, ok2 := pattern.(string)
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("LIKE requires string operands: %T and %T", value, pattern)
+	}
+	var escapeRune rune = -1
+	if hasEscape {
+		e, ok := escape.(string)
+		if !ok || utf8.RuneCountInString(e) != 1 {
+			return nil, fmt.Errorf("ESCAPE must be a single character: %v", escape)
+		}
+		escapeRune, _ = utf8.DecodeRuneInString(e)
+	}
+	matched, err := matchLike([]rune(s), []rune(p), escapeRune)
+	if err != nil {
+		return nil, err
+	}
+	return matched != not, nil
+}
+
+// matchLike は s がパターンに一致するかどうかを返す
+// % は0文字以上の任意の文字列、_ は任意の1文字に一致し、エスケープ文字の次の文字はそのまま比べる
+func matchLike(s, pattern []rune, escape rune) (bool, error) {
+	// % の直後から照合をやり直すための位置（バックトラック）
+	si, pi := 0, 0
+	starP, starS := -1, 0
+	for si < len(s) {
+		if pi < len(pattern) {
+			c := pattern[pi]
+			switch {
+			case c == escape:
+				if pi+1 >= len(pattern) {
+					return false, fmt.Errorf("LIKE pattern must not end with the escape character")
+				}
+				if pattern[pi+1] == s[si] {
+					si, pi = si+1, pi+2
+					continue
+				}
+			case c == '%':
+				starP, starS = pi, si
+				pi++
+				continue
+			case c == '_' || c == s[si]:
+				si, pi = si+1, pi+1
+				continue
+			}
+		}
+		if starP < 0 {
+			return false, nil
+		}
+		// 直前の % に1文字多く食べさせてやり直す
+		starS++
+		si, pi = starS, starP+1
+	}
+	for pi < len(pattern) && pattern[pi] == '%' {
+		pi++
+	}
+	if pi < len(pattern) && pattern[pi] == escape && pi+1 >= len(pattern) {
+		return false, fmt.Errorf("LIKE pattern must not end with the escape character")
+	}
+	return pi == len(pattern), nil
+}
+
+// InExpr は [NOT] IN (値のリスト) を表す
+type InExpr struct {
+	Expr Expression
+	List []Expression
+	Not  bool
+}
+
+func (e *InExpr) Evaluate(row *storage.Row, schema *storage.Schema) (any, error) {
+	value, err := e.Expr.Evaluate(row, schema)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]any, len(e.List))
+	for i, item := range e.List {
+		if list[i], err = item.Evaluate(row, schema); err != nil {
+			return nil, err
+		}
+	}
+	return evaluateIn(value, list, e.Not), nil
+}
+
+func (e *InExpr) String() string {
+	items := make([]string, len(e.List))
+	for i, item := range e.List {
+		items[i] = item.String()
+	}
+	operator := "IN"
+	if e.Not {
+		operator = "NOT IN"
+	}
+	return fmt.Sprintf("(%s %s (%s))", e.Expr.String(), operator, strings.Join(items, ", "))
+}
+
+// evaluateIn は IN を3値論理で評価する
+// 一致する値があれば true、なければリストに NULL があるときだけ NULL になる
+func evaluateIn(value any, list []any, not bool) any {
+	if value == nil {
+		return nil
+	}
+	hasNull := false
+	for _, item := range list {
+		if item == nil {
+			hasNull = true
+			continue
+		}
+		if valuesEqual(value, item) {
+			return !not
+		}
+	}
+	if hasNull {
+		return nil
+	}
+	return not
+}
+
+// BetweenExpr は [NOT] BETWEEN low AND high を表す（low と high を含む）
+type BetweenExpr struct {
+	Expr Expression
+	Low  Expression
+	High Expression
+	Not  bool
+}
+
+func (e *BetweenExpr) Evaluate(row *storage.Row, schema *storage.Schema) (any, error) {
+	value, err := e.Expr.Evaluate(row, schema)
+	if err != nil {
+		return nil, err
+	}
+	low, err := e.Low.Evaluate(row, schema)
+	if err != nil {
+		return nil, err
+	}
+	high, err := e.High.Evaluate(row, schema)
+	if err != nil {
+		return nil, err
+	}
+	return evaluateBetween(value, low, high, e.Not)
+}
+
+func (e *BetweenExpr) String() string {
+	operator := "BETWEEN"
+	if e.Not {
+		operator = "NOT BETWEEN"
+	}
+	return fmt.Sprintf("(%s %s %s AND %s)", e.Expr.String(), operator, e.Low.String(), e.High.String())
+}
+
+// evaluateBetween は value >= low AND value <= high を3値論理で評価する
+func evaluateBetween(value, low, high any, not bool) (any, error) {
+	lower, err := evaluateBinary(">=", value, low)
+	if err != nil {
+		return nil, err
+	}
+	upper, err := evaluateBinary("<=", value, high)
+	if err != nil {
+		return nil, err
+	}
+	result, err := evaluateBinary("AND", lower, upper)
+	if err != nil || !not {
+		return result, err
+	}
+	return evaluateUnary("NOT", result)
+}
+
+// Conjuncts は BETWEEN を2つの比較に分ける（NOT BETWEEN は分けられないので nil）
+// インデックスの範囲条件として使えるようにする
+func (e *BetweenExpr) Conjuncts() []Expression {
+	if e.Not {
+		return nil
+	}
+	return []Expression{
+		&BinaryExpr{Left: e.Expr, Operator: ">=", Right: e.Low},
+		&BinaryExpr{Left: e.Expr, Operator: "<=", Right: e.High},
+	}
+}
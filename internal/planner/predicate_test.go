@@ -0,0 +1,152 @@
+package planner
+
+import (
+	"testing"
+
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
+)
+
+func TestMatchLike(t *testing.T) {
+	tests := []struct {
+		value, pattern string
+		escape         rune
+		want           bool
+	}{
+		{"alice", "alice", -1, true},
+		{"alice", "a%", -1, true},
+		{"alice", "%ce", -1, true},
+		{"alice", "%li%", -1, true},
+		{"alice", "a_i_e", -1, true},
+		{"alice", "a_c%", -1, false},
+		{"alice", "%", -1, true},
+		{"", "%", -1, true},
+		{"", "_", -1, false},
+		{"abcabc", "%abc", -1, true},
+		{"aab", "%a_b", -1, true},
+		{"ab", "%a_b", -1, false},
+		{"Alice", "alice", -1, false},
+		{"あいう", "_い%", -1, true},
+		{"100%", "100!%", '!', true},
+		{"1000", "100!%", '!', false},
+		{"a_b", "a!_b", '!', true},
+		{"axb", "a!_b", '!', false},
+		{"a!b", "a!!b", '!', true},
+	}
+	for _, tt := range tests {
+		got, err := matchLike([]rune(tt.value), []rune(tt.pattern), tt.escape)
+		if err != nil {
+			t.Errorf("%q LIKE %q failed: %v", tt.value, tt.pattern, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q LIKE %q ESCAPE %q = %v, want %v", tt.value, tt.pattern, tt.escape, got, tt.want)
+		}
+	}
+	if _, err := matchLike([]rune("a"), []rune("a!"), '!'); err == nil {
+		t.Error("expected an error for a pattern ending with the escape character")
+	}
+}
+
+func TestPredicateThreeValuedLogic(t *testing.T) {
+	lit := func(v any) Expression { return &Literal{Value: v} }
+	tests := []struct {
+		expr Expression
+		want any
+	}{
+		{&UnaryExpr{Operator: "NOT", Expr: lit(true)}, false},
+		{&UnaryExpr{Operator: "NOT", Expr: lit(nil)}, nil},
+		{&LikeExpr{Expr: lit("abc"), Pattern: lit("a%")}, true},
+		{&LikeExpr{Expr: lit("abc"), Pattern: lit("a%"), Not: true}, false},
+		{&LikeExpr{Expr: lit(nil), Pattern: lit("a%")}, nil},
+		{&LikeExpr{Expr: lit("a%"), Pattern: lit("a#%"), Escape: lit("#")}, true},
+		{&InExpr{Expr: lit(2), List: []Expression{lit(1), lit(2)}}, true},
+		{&InExpr{Expr: lit(3), List: []Expression{lit(1), lit(2)}}, false},
+		{&InExpr{Expr: lit(3), List: []Expression{lit(1), lit(nil)}}, nil},
+		{&InExpr{Expr: lit(1), List: []Expression{lit(1), lit(nil)}, Not: true}, false},
+		{&InExpr{Expr: lit(3), List: []Expression{lit(1), lit(nil)}, Not: true}, nil},
+		{&InExpr{Expr: lit(nil), List: []Expression{lit(1)}}, nil},
+		{&InExpr{Expr: lit(1.0), List: []Expression{lit(1)}}, true},
+		{&BetweenExpr{Expr: lit(5), Low: lit(1), High: lit(5)}, true},
+		{&BetweenExpr{Expr: lit(6), Low: lit(1), High: lit(5)}, false},
+		{&BetweenExpr{Expr: lit(6), Low: lit(1), High: lit(5), Not: true}, true},
+		{&BetweenExpr{Expr: lit(6), Low: lit(nil), High: lit(5)}, false},
+		{&BetweenExpr{Expr: lit(3), Low: lit(nil), High: lit(5)}, nil},
+	}
+	for _, tt := range tests {
+		got, err := tt.expr.Evaluate(nil, nil)
+		if err != nil {
+			t.Errorf("%s failed: %v", tt.expr, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+
+	for _, expr := range []Expression{
+		&UnaryExpr{Operator: "NOT", Expr: lit(1)},
+		&LikeExpr{Expr: lit(1), Pattern: lit("1")},
+		&LikeExpr{Expr: lit("a"), Pattern: lit("a"), Escape: lit("ab")},
+	} {
+		if _, err := expr.Evaluate(nil, nil); err == nil {
+			t.Errorf("expected an error for %s", expr)
+		}
+	}
+}
+
+func TestPredicateRules(t *testing.T) {
+	usersSchema := storage.NewSchema("users", []storage.Column{
+		*storage.NewColumn("id", storage.ColumnTypeInt32, 0, false),
+		*storage.NewColumn("name", storage.ColumnTypeString, 255, false),
+	})
+	ordersSchema := storage.NewSchema("orders", []storage.Column{
+		*storage.NewColumn("order_id", storage.ColumnTypeInt32, 0, false),
+		*storage.NewColumn("user_id", storage.ColumnTypeInt32, 0, false),
+	})
+	users := &ScanNode{TableName: "users", TableSchema: usersSchema}
+	orders := &ScanNode{TableName: "orders", TableSchema: ordersSchema}
+
+	// 左テーブルだけを参照する LIKE は左に押し下げる
+	like := &LikeExpr{Expr: &ColumnRef{Name: "name"}, Pattern: &Literal{Value: "a%"}}
+	result, err := NewFilterPushDownRule().Apply(&FilterNode{
+		Condition: like,
+		Child:     &JoinNode{Left: users, Right: orders, JoinType: JoinTypeInner},
+	})
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if filter, ok := result.(*JoinNode).Left.(*FilterNode); !ok || filter.Condition != like {
+		t.Errorf("expected LIKE to be pushed to the left, got %s", result)
+	}
+	// 両方のテーブルを参照する IN は押し下げない
+	in := &InExpr{Expr: &ColumnRef{Name: "id"}, List: []Expression{&ColumnRef{Name: "user_id"}}}
+	filter := &FilterNode{Condition: in, Child: &JoinNode{Left: users, Right: orders, JoinType: JoinTypeInner}}
+	if result, _ := NewFilterPushDownRule().Apply(filter); result != filter {
+		t.Errorf("expected the filter to stay above the join, got %s", result)
+	}
+
+	// 定数だけの述語は畳み込む
+	fold := NewConstantFoldingRule()
+	tests := []struct {
+		condition Expression
+		want      string
+	}{
+		{&InExpr{Expr: &Literal{Value: 2}, List: []Expression{&Literal{Value: 1}, &Literal{Value: 2}}}, "Scan(users)"},
+		{&UnaryExpr{Operator: "NOT", Expr: &BetweenExpr{Expr: &Literal{Value: 2}, Low: &Literal{Value: 1}, High: &Literal{Value: 3}}}, "Empty"},
+		{&LikeExpr{Expr: &ColumnRef{Name: "name"}, Pattern: &FunctionExpr{Name: "LOWER", Args: []Expression{&Literal{Value: "A%"}}, fn: scalarFunctions["LOWER"]}}, "Filter((name LIKE a%))"},
+	}
+	for _, tt := range tests {
+		node := &FilterNode{Condition: tt.condition, Child: users}
+		if !fold.Match(node) {
+			t.Errorf("expected %s to match", tt.condition)
+			continue
+		}
+		result, err := fold.Apply(node)
+		if err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+		if got := result.String(); got != tt.want {
+			t.Errorf("folding %s = %s, want %s", tt.condition, got, tt.want)
+		}
+	}
+}
@@ -65,7 +65,8 @@ func (r *FilterPushDownRule) Apply(plan PlanNode) (PlanNode, error) {
 	referencedTables := r.getReferencedTables(filterNode.Condition)
 	leftSchema := join.Left.Schema()
 	// 左テーブルのカラムのみ参照している場合
-	if r.allColumnsInSchema(referencedTables, leftSchema) {
+	// 外部結合で NULL を補う側に条件を押し下げると、NULL を補った行が残ってしまうので押し下げない
+	if canPushLeft(join.JoinType) && r.allColumnsInSchema(referencedTables, leftSchema) {
 		return &JoinNode{
 			Left: &FilterNode{
 				Condition: filterNode.Condition,
@@ -74,11 +75,14 @@ func (r *FilterPushDownRule) Apply(plan PlanNode) (PlanNode, error) {
 			Right:     join.Right,
 			JoinType:  join.JoinType,
 			Condition: join.Condition,
+			Algorithm: join.Algorithm,
+			LeftKeys:  join.LeftKeys,
+			RightKeys: join.RightKeys,
 		}, nil
 	}
-	// 右テーブルのカラムのみ参照している場合
+	// 右テーブルのカラムのみ参照している場合（セミ結合・反結合の出力には右のカラムがない）
 	rightSchema := join.Right.Schema()
-	if r.allColumnsInSchema(referencedTables, rightSchema) {
+	if canPushRight(join.JoinType) && r.allColumnsInSchema(referencedTables, rightSchema) {
 		return &JoinNode{
 			Left: join.Left,
 			Right: &FilterNode{
@@ -87,31 +91,72 @@ func (r *FilterPushDownRule) Apply(plan PlanNode) (PlanNode, error) {
 			},
 			JoinType:  join.JoinType,
 			Condition: join.Condition,
+			Algorithm: join.Algorithm,
+			LeftKeys:  join.LeftKeys,
+			RightKeys: join.RightKeys,
 		}, nil
 	}
 	// 両方のテーブルを参照している場合
 	return plan, nil
 }
 
-func (r *FilterPushDownRule) getReferencedTables(expression Expression) []string {
-	var columns []string
+// canPushLeft は結合の上の条件を左の子へ押し下げられるかどうかを返す
+func canPushLeft(joinType JoinType) bool {
+	return joinType != JoinTypeRight && joinType != JoinTypeFull
+}
+
+// canPushRight は結合の上の条件を右の子へ押し下げられるかどうかを返す（セミ結合・反結合の出力には右のカラムがない）
+func canPushRight(joinType JoinType) bool {
+	return joinType == JoinTypeInner || joinType == JoinTypeCross || joinType == JoinTypeRight
+}
+
+func (r *FilterPushDownRule) getReferencedTables(expression Expression) []*ColumnRef {
+	var columns []*ColumnRef
 	r.collectColumnRefs(expression, &columns)
 	return columns
 }
 
-func (r *FilterPushDownRule) collectColumnRefs(expression Expression, columns *[]string) {
+func (r *FilterPushDownRule) collectColumnRefs(expression Expression, columns *[]*ColumnRef) {
 	switch e := expression.(type) {
 	case *BinaryExpr:
 		r.collectColumnRefs(e.Left, columns)
 		r.collectColumnRefs(e.Right, columns)
+	case *IsNullExpr:
+		r.collectColumnRefs(e.Expr, columns)
+	case *UnaryExpr:
+		r.collectColumnRefs(e.Expr, columns)
+	case *CastExpr:
+		r.collectColumnRefs(e.Expr, columns)
+	case *FunctionExpr:
+		for _, arg := range e.Args {
+			r.collectColumnRefs(arg, columns)
+		}
+	case *LikeExpr:
+		r.collectColumnRefs(e.Expr, columns)
+		r.collectColumnRefs(e.Pattern, columns)
+		if e.Escape != nil {
+			r.collectColumnRefs(e.Escape, columns)
+		}
+	case *InExpr:
+		r.collectColumnRefs(e.Expr, columns)
+		for _, item := range e.List {
+			r.collectColumnRefs(item, columns)
+		}
+	case *BetweenExpr:
+		r.collectColumnRefs(e.Expr, columns)
+		r.collectColumnRefs(e.Low, columns)
+		r.collectColumnRefs(e.High, columns)
+	case *InSubqueryExpr:
+		r.collectColumnRefs(e.Expr, columns)
 	case *ColumnRef:
-		*columns = append(*columns, e.Name)
+		*columns = append(*columns, e)
 	}
 }
 
-func (r *FilterPushDownRule) allColumnsInSchema(columns []string, schema *storage.Schema) bool {
+// allColumnsInSchema はすべてのカラム参照がスキーマのカラムかどうかを返す（テーブル名で修飾されていればテーブル名も比べる）
+func (r *FilterPushDownRule) allColumnsInSchema(columns []*ColumnRef, schema *storage.Schema) bool {
 	for _, column := range columns {
-		if schema.GetColumnIndex(column) < 0 {
+		if idx, err := resolveColumn(schema, column); err != nil || idx < 0 {
 			return false
 		}
 	}
@@ -164,11 +209,15 @@ func isAlwaysTrue(expression Expression) bool {
 	return ok && b
 }
 
+// isAlwaysFalse は条件が常に偽か NULL（どの行も残らない）かどうかを返す
 func isAlwaysFalse(expression Expression) bool {
 	literal, ok := expression.(*Literal)
 	if !ok {
 		return false
 	}
+	if literal.Value == nil {
+		return true
+	}
 	b, ok := literal.Value.(bool)
 	return ok && !b
 }
@@ -183,11 +232,42 @@ func (r *ConstantFoldingRule) foldConstants(expression Expression) Expression {
 		leftLiteral, leftOk := left.(*Literal)
 		rightLiteral, rightOk := right.(*Literal)
 		if leftOk && rightOk {
-			// 定数式を評価
-			result := r.evaluateConstantExpression(leftLiteral.Value, e.Operator, rightLiteral.Value)
-			return &Literal{Value: result}
+			// 定数式を評価（型が合わずエラーになる式は畳み込まない）
+			result, err := r.evaluateConstantExpression(leftLiteral.Value, e.Operator, rightLiteral.Value)
+			if err == nil {
+				return &Literal{Value: result}
+			}
 		}
 		return &BinaryExpr{Left: left, Operator: e.Operator, Right: right}
+	case *IsNullExpr:
+		inner := r.foldConstants(e.Expr)
+		if literal, ok := inner.(*Literal); ok {
+			return &Literal{Value: (literal.Value == nil) != e.Not}
+		}
+		return &IsNullExpr{Expr: inner, Not: e.Not}
+	case *UnaryExpr:
+		inner := r.foldConstants(e.Expr)
+		if literal, ok := inner.(*Literal); ok {
+			if result, err := evaluateUnary(e.Operator, literal.Value); err == nil {
+				return &Literal{Value: result}
+			}
+		}
+		return &UnaryExpr{Operator: e.Operator, Expr: inner}
+	case *CastExpr:
+		operands, constant := r.foldOperands(e.Expr)
+		return r.evaluateIfConstant(&CastExpr{Expr: operands[0], Target: e.Target, Type: e.Type}, constant)
+	case *FunctionExpr:
+		operands, constant := r.foldOperands(e.Args...)
+		return r.evaluateIfConstant(&FunctionExpr{Name: e.Name, Args: operands, fn: e.fn}, constant)
+	case *LikeExpr:
+		operands, constant := r.foldOperands(e.Expr, e.Pattern, e.Escape)
+		return r.evaluateIfConstant(&LikeExpr{Expr: operands[0], Pattern: operands[1], Escape: operands[2], Not: e.Not}, constant)
+	case *InExpr:
+		operands, constant := r.foldOperands(append([]Expression{e.Expr}, e.List...)...)
+		return r.evaluateIfConstant(&InExpr{Expr: operands[0], List: operands[1:], Not: e.Not}, constant)
+	case *BetweenExpr:
+		operands, constant := r.foldOperands(e.Expr, e.Low, e.High)
+		return r.evaluateIfConstant(&BetweenExpr{Expr: operands[0], Low: operands[1], High: operands[2], Not: e.Not}, constant)
 	case *Literal:
 		return expression
 	default:
@@ -195,161 +275,53 @@ func (r *ConstantFoldingRule) foldConstants(expression Expression) Expression {
 	}
 }
 
-func (r *ConstantFoldingRule) evaluateConstantExpression(left any, operator string, right any) any {
-	switch operator {
-	case "+":
-		return r.addValues(left, right)
-	case "-":
-		return r.subtractValues(left, right)
-	case "*":
-		return r.multiplyValues(left, right)
-	case "/":
-		return r.divideValues(left, right)
-	case "=":
-		return left == right
-	case "!=", "<>":
-		return left != right
-	case "<":
-		return compareValues(left, right) < 0
-	case ">":
-		return compareValues(left, right) > 0
-	case "<=":
-		return compareValues(left, right) <= 0
-	case ">=":
-		return compareValues(left, right) >= 0
-	case "AND":
-		leftBool, ok1 := left.(bool)
-		rightBool, ok2 := right.(bool)
-		if ok1 && ok2 {
-			return leftBool && rightBool
+// foldOperands は式の被演算子を畳み込み、すべて定数になったかどうかを返す（nil の被演算子は nil のまま）
+func (r *ConstantFoldingRule) foldOperands(operands ...Expression) ([]Expression, bool) {
+	folded := make([]Expression, len(operands))
+	constant := true
+	for i, operand := range operands {
+		if operand == nil {
+			continue
 		}
-		return false
-	case "OR":
-		leftBool, ok1 := left.(bool)
-		rightBool, ok2 := right.(bool)
-		if ok1 && ok2 {
-			return leftBool || rightBool
+		folded[i] = r.foldConstants(operand)
+		if _, ok := folded[i].(*Literal); !ok {
+			constant = false
 		}
-		return false
-	default:
-		return false
 	}
+	return folded, constant
 }
 
-func (r *ConstantFoldingRule) addValues(left any, right any) any {
-	switch left.(type) {
-	case int:
-		if r, ok := right.(int); ok {
-			return left.(int) + r
-		}
-	case int64:
-		if r, ok := right.(int64); ok {
-			return left.(int64) + r
-		}
-	case string:
-		if r, ok := right.(string); ok {
-			return left.(string) + r
-		}
-	case float32:
-		if r, ok := right.(float32); ok {
-			return left.(float32) + r
-		}
-	case float64:
-		if r, ok := right.(float64); ok {
-			return left.(float64) + r
-		}
-	case nil:
-		return right
-	default:
-		return fmt.Sprintf("%v + %v", left, right)
+// evaluateIfConstant は被演算子がすべて定数の式を評価して定数にする（エラーになる式はそのまま残す）
+func (r *ConstantFoldingRule) evaluateIfConstant(expression Expression, constant bool) Expression {
+	if !constant {
+		return expression
 	}
-	return nil
-}
-
-func (r *ConstantFoldingRule) subtractValues(left any, right any) any {
-	switch left.(type) {
-	case int:
-		if r, ok := right.(int); ok {
-			return left.(int) - r
-		}
-	case int64:
-		if r, ok := right.(int64); ok {
-			return left.(int64) - r
-		}
-	case float32:
-		if r, ok := right.(float32); ok {
-			return left.(float32) - r
-		}
-	case float64:
-		if r, ok := right.(float64); ok {
-			return left.(float64) - r
-		}
-	case nil:
-		return right
-	default:
-		return fmt.Sprintf("%v - %v", left, right)
+	result, err := expression.Evaluate(nil, nil)
+	if err != nil {
+		return expression
 	}
-	return nil
+	return &Literal{Value: result}
 }
 
-func (r *ConstantFoldingRule) multiplyValues(left any, right any) any {
-	switch left.(type) {
-	case int:
-		if r, ok := right.(int); ok {
-			return left.(int) * r
-		}
-	case int64:
-		if r, ok := right.(int64); ok {
-			return left.(int64) * r
+// hasConstantOperands は被演算子がすべて定数か、定数の部分式を含むかどうかを返す
+func (r *ConstantFoldingRule) hasConstantOperands(operands ...Expression) bool {
+	constant := true
+	for _, operand := range operands {
+		if operand == nil {
+			continue
 		}
-	case float32:
-		if r, ok := right.(float32); ok {
-			return left.(float32) * r
+		if r.hasConstantExpression(operand) {
+			return true
 		}
-	case float64:
-		if r, ok := right.(float64); ok {
-			return left.(float64) * r
+		if _, ok := operand.(*Literal); !ok {
+			constant = false
 		}
 	}
-	return nil
+	return constant
 }
 
-func (r *ConstantFoldingRule) divideValues(left any, right any) any {
-	switch left.(type) {
-	case int:
-		if r, ok := right.(int); ok {
-			if r == 0 {
-				return nil
-			}
-			return left.(int) / r
-		}
-	case int64:
-		if r, ok := right.(int64); ok {
-			if r == 0 {
-				return nil
-			}
-			return left.(int64) / r
-		}
-	case float32:
-		if r, ok := right.(float32); ok {
-			if r == 0 {
-				return nil
-			}
-			return left.(float32) / r
-		}
-	case float64:
-		if r, ok := right.(float64); ok {
-			if r == 0 {
-				return nil
-			}
-			return left.(float64) / r
-		}
-	case nil:
-		return right
-	default:
-		return fmt.Sprintf("%v / %v", left, right)
-	}
-	return nil
+func (r *ConstantFoldingRule) evaluateConstantExpression(left any, operator string, right any) (any, error) {
+	return evaluateBinary(operator, left, right)
 }
 
 func (r *ConstantFoldingRule) hasConstantExpression(expression Expression) bool {
@@ -363,6 +335,84 @@ func (r *ConstantFoldingRule) hasConstantExpression(expression Expression) bool
 		}
 		return r.hasConstantExpression(e.Left) ||
 			r.hasConstantExpression(e.Right)
+	case *IsNullExpr:
+		if _, ok := e.Expr.(*Literal); ok {
+			return true
+		}
+		return r.hasConstantExpression(e.Expr)
+	case *UnaryExpr:
+		if _, ok := e.Expr.(*Literal); ok {
+			return true
+		}
+		return r.hasConstantExpression(e.Expr)
+	case *CastExpr:
+		return r.hasConstantOperands(e.Expr)
+	case *FunctionExpr:
+		return r.hasConstantOperands(e.Args...)
+	case *LikeExpr:
+		return r.hasConstantOperands(e.Expr, e.Pattern, e.Escape)
+	case *InExpr:
+		return r.hasConstantOperands(append([]Expression{e.Expr}, e.List...)...)
+	case *BetweenExpr:
+		return r.hasConstantOperands(e.Expr, e.Low, e.High)
 	}
 	return false
 }
+
+// TopNRule は ORDER BY と LIMIT を、先頭の行だけを残しながら並べ替える top-N にする
+// 並べ替えと LIMIT の間に射影があってもよい（射影は行の数も順も変えない）
+type TopNRule struct{}
+
+func NewTopNRule() Rule {
+	return &TopNRule{}
+}
+
+func (r *TopNRule) Name() string {
+	return "top-n"
+}
+
+func (r *TopNRule) Match(plan PlanNode) bool {
+	limit, ok := plan.(*LimitNode)
+	if !ok || limit.Count <= 0 {
+		return false
+	}
+	_, ok = r.withTopN(limit.Child, limit.Count+limit.Offset)
+	return ok
+}
+
+func (r *TopNRule) Apply(plan PlanNode) (PlanNode, error) {
+	limit, ok := plan.(*LimitNode)
+	if !ok {
+		return nil, fmt.Errorf("plan is not a limit node: %T", plan)
+	}
+	// OFFSET で読み飛ばす行も残す
+	child, ok := r.withTopN(limit.Child, limit.Count+limit.Offset)
+	if !ok {
+		return plan, nil
+	}
+	c := *limit
+	c.Child = child
+	return &c, nil
+}
+
+// withTopN は plan の並べ替えを先頭 n 行だけ残す並べ替えにしたコピーを返す（並べ替えがなければ ok は false）
+func (r *TopNRule) withTopN(plan PlanNode, n int) (PlanNode, bool) {
+	switch node := plan.(type) {
+	case *SortNode:
+		if node.Limit > 0 && node.Limit <= n {
+			return nil, false
+		}
+		c := *node
+		c.Limit = n
+		return &c, true
+	case *ProjectNode:
+		child, ok := r.withTopN(node.Child, n)
+		if !ok {
+			return nil, false
+		}
+		c := *node
+		c.Child = child
+		return &c, true
+	}
+	return nil, false
+}
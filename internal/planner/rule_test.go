@@ -270,7 +270,7 @@ func TestConstantFoldingRuleApplyArithmetic(t *testing.T) {
 		{"multiply int", 4, "*", 3, 12},
 		{"divide int", 10, "/", 2, 5},
 		{"add int64", int64(100), "+", int64(200), int64(300)},
-		{"divide by zero", 10, "/", 0, nil},
+		{"modulo int", 10, "%", 4, 2},
 	}
 
 	for _, tt := range tests {
@@ -290,6 +290,12 @@ func TestConstantFoldingRuleApplyArithmetic(t *testing.T) {
 			}
 		})
 	}
+
+	// 0 で割る式は畳み込まず、実行時にエラーにする
+	divide := &BinaryExpr{Left: &Literal{Value: 10}, Operator: "/", Right: &Literal{Value: 0}}
+	if _, ok := rule.foldConstants(divide).(*BinaryExpr); !ok {
+		t.Error("division by zero should not be folded")
+	}
 }
 
 func TestConstantFoldingRuleApplyComparison(t *testing.T) {
@@ -457,6 +463,38 @@ func TestConstantFoldingRuleApplyAlwaysFalse(t *testing.T) {
 	}
 }
 
+func TestConstantFoldingRuleApplyNull(t *testing.T) {
+	rule := NewConstantFoldingRule()
+	schema := storage.NewSchema("users", []storage.Column{
+		*storage.NewColumn("id", storage.ColumnTypeInt32, 0, false),
+	})
+	scan := &ScanNode{TableName: "users", TableSchema: schema}
+
+	// WHERE NULL = NULL は NULL なので行は残らない
+	result, err := rule.Apply(&FilterNode{
+		Condition: &BinaryExpr{Left: &Literal{Value: nil}, Operator: "=", Right: &Literal{Value: nil}},
+		Child:     scan,
+	})
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if _, ok := result.(*EmptyNode); !ok {
+		t.Fatalf("expected EmptyNode, got %T", result)
+	}
+
+	// WHERE NULL IS NULL は常に真
+	result, err = rule.Apply(&FilterNode{
+		Condition: &IsNullExpr{Expr: &Literal{Value: nil}},
+		Child:     scan,
+	})
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if result != scan {
+		t.Fatalf("expected the filter to be removed, got %s", result)
+	}
+}
+
 func TestIsAlwaysTrue(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -0,0 +1,234 @@
+package planner
+
+import (
+	"strings"
+
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
+)
+
+// defaultSelectivity は統計情報がなく見積もれない条件の選択率
+const defaultSelectivity = 0.1
+
+// Selectivity は node の出力のうち条件を満たす行の割合を見積もる
+// ANALYZE で集めた統計情報があるカラムは、値の種類の数・NULL の割合・ヒストグラムから見積もる
+func (e *costEstimator) Selectivity(condition Expression, node PlanNode) float64 {
+	switch c := condition.(type) {
+	case *BinaryExpr:
+		switch strings.ToUpper(c.Operator) {
+		case "AND":
+			return e.Selectivity(c.Left, node) * e.Selectivity(c.Right, node)
+		case "OR":
+			left, right := e.Selectivity(c.Left, node), e.Selectivity(c.Right, node)
+			return left + right - left*right
+		}
+		return e.comparisonSelectivity(c, node)
+	case *UnaryExpr:
+		if strings.EqualFold(c.Operator, "NOT") {
+			return 1 - e.Selectivity(c.Expr, node)
+		}
+	case *IsNullExpr:
+		if stats, _ := e.columnStatistics(c.Expr, node); stats != nil {
+			if c.Not {
+				return 1 - stats.NullFraction
+			}
+			return stats.NullFraction
+		}
+	case *BetweenExpr:
+		stats, col := e.columnStatistics(c.Expr, node)
+		low, ok1 := statisticsLiteral(c.Low, col)
+		high, ok2 := statisticsLiteral(c.High, col)
+		if stats != nil && ok1 && ok2 {
+			s := rangeSelectivity(stats, low, true, high, true)
+			if c.Not {
+				return 1 - stats.NullFraction - s
+			}
+			return s
+		}
+	case *InExpr:
+		stats, col := e.columnStatistics(c.Expr, node)
+		if stats == nil {
+			break
+		}
+		s := 0.0
+		for _, item := range c.List {
+			value, ok := statisticsLiteral(item, col)
+			if !ok {
+				return defaultSelectivity
+			}
+			s += stats.EqualFraction(value)
+		}
+		s = min(s, 1-stats.NullFraction)
+		if c.Not {
+			return 1 - stats.NullFraction - s
+		}
+		return s
+	case *Literal:
+		if isAlwaysTrue(c) {
+			return 1
+		}
+		if isAlwaysFalse(c) {
+			return 0
+		}
+	}
+	return defaultSelectivity
+}
+
+// comparisonSelectivity は比較の選択率を見積もる
+// 「カラム 演算子 定数」はヒストグラムから、「カラム = カラム」は値の種類の多いほうから見積もる
+func (e *costEstimator) comparisonSelectivity(bin *BinaryExpr, node PlanNode) float64 {
+	if bin.Operator == "=" {
+		left, _ := e.columnStatistics(bin.Left, node)
+		right, _ := e.columnStatistics(bin.Right, node)
+		if left != nil && right != nil {
+			distinct := max(left.DistinctCount, right.DistinctCount, 1)
+			return (1 - left.NullFraction) * (1 - right.NullFraction) / float64(distinct)
+		}
+	}
+	operator := bin.Operator
+	if operator == "!=" || operator == "<>" {
+		operator = "="
+	}
+	ref, lit, operator := columnComparison(&BinaryExpr{Left: bin.Left, Operator: operator, Right: bin.Right})
+	if ref == nil {
+		return defaultSelectivity
+	}
+	stats, col := e.columnStatistics(ref, node)
+	value, ok := statisticsLiteral(lit, col)
+	if stats == nil || !ok {
+		return defaultSelectivity
+	}
+	nonNull := 1 - stats.NullFraction
+	switch operator {
+	case "=":
+		if bin.Operator == "=" {
+			return stats.EqualFraction(value)
+		}
+		return nonNull - stats.EqualFraction(value)
+	case "<":
+		return stats.LessFraction(value, false)
+	case "<=":
+		return stats.LessFraction(value, true)
+	case ">":
+		return nonNull - stats.LessFraction(value, true)
+	case ">=":
+		return nonNull - stats.LessFraction(value, false)
+	}
+	return defaultSelectivity
+}
+
+// rangeSelectivity は low から high までの値の行の割合を見積もる（nil の端は制限なし）
+func rangeSelectivity(stats *storage.ColumnStatistics, low storage.Value, lowInclusive bool, high storage.Value, highInclusive bool) float64 {
+	upper := 1 - stats.NullFraction
+	if high != nil {
+		upper = stats.LessFraction(high, highInclusive)
+	}
+	lower := 0.0
+	if low != nil {
+		lower = stats.LessFraction(low, !lowInclusive)
+	}
+	return max(upper-lower, 0)
+}
+
+// indexScanSelectivity はインデックススキャンのキー範囲に入る行の割合を見積もる
+// 等しい値で絞り込む先頭のカラムは値の種類の数から、範囲で絞り込むカラムはヒストグラムから見積もる
+func indexScanSelectivity(stats *storage.TableStatistics, node *IndexScanNode) (float64, bool) {
+	r := node.Range
+	s := 1.0
+	for i, column := range node.Columns {
+		if i >= len(r.Low) && i >= len(r.High) {
+			break
+		}
+		col := stats.GetColumn(column)
+		if col == nil {
+			return 0, false
+		}
+		last := i+1 >= max(len(r.Low), len(r.High))
+		if i < len(r.Low) && i < len(r.High) && (!last || r.IsPoint()) {
+			if c, err := storage.CompareValues(r.Low[i], r.High[i]); err == nil && c == 0 {
+				s *= col.EqualFraction(r.Low[i])
+				continue
+			}
+		}
+		// 範囲で絞り込むのは最後のカラムだけ
+		var low, high storage.Value
+		if i < len(r.Low) {
+			low = r.Low[i]
+		}
+		if i < len(r.High) {
+			high = r.High[i]
+		}
+		s *= rangeSelectivity(col, low, r.LowInclusive, high, r.HighInclusive)
+		break
+	}
+	return s, true
+}
+
+// columnStatistics は式がテーブルのカラムの参照なら、そのカラムの統計情報とカラム定義を返す
+// node の下のテーブルをたどり、別名や派生テーブルのカラムは元のテーブルのカラムに読み替える
+// 曖昧なカラムは統計情報がないものとして扱う（エラーはプランを作るときに返す）
+func (e *costEstimator) columnStatistics(expr Expression, node PlanNode) (*storage.ColumnStatistics, *storage.Column) {
+	ref, ok := expr.(*ColumnRef)
+	if !ok {
+		return nil, nil
+	}
+	switch n := node.(type) {
+	case *ScanNode:
+		return e.tableColumnStatistics(n.TableName, n.TableSchema, ref)
+	case *IndexScanNode:
+		return e.tableColumnStatistics(n.TableName, n.TableSchema, ref)
+	case *FilterNode:
+		return e.columnStatistics(ref, n.Child)
+	case *SortNode:
+		return e.columnStatistics(ref, n.Child)
+	case *LimitNode:
+		return e.columnStatistics(ref, n.Child)
+	case *DistinctNode:
+		return e.columnStatistics(ref, n.Child)
+	case *JoinNode:
+		if idx, _ := resolveColumn(n.Left.Schema(), ref); idx >= 0 {
+			return e.columnStatistics(ref, n.Left)
+		}
+		if n.JoinType != JoinTypeSemi && n.JoinType != JoinTypeAnti {
+			return e.columnStatistics(ref, n.Right)
+		}
+	case *ProjectNode:
+		if idx, _ := resolveColumn(n.Schema(), ref); idx >= 0 {
+			return e.columnStatistics(n.GetExpression(idx), n.Child)
+		}
+	case *SubqueryScanNode:
+		if idx, _ := resolveColumn(n.Schema(), ref); idx >= 0 {
+			col := n.Child.Schema().GetColumns()[idx]
+			return e.columnStatistics(&ColumnRef{TableName: col.GetTableName(), Name: col.GetName()}, n.Child)
+		}
+	}
+	return nil, nil
+}
+
+// tableColumnStatistics はテーブルのカラムの統計情報とカラム定義を返す（ANALYZE していなければ nil）
+func (e *costEstimator) tableColumnStatistics(tableName string, schema *storage.Schema, ref *ColumnRef) (*storage.ColumnStatistics, *storage.Column) {
+	idx, err := resolveColumn(schema, ref)
+	if err != nil || idx < 0 {
+		return nil, nil
+	}
+	stats := e.catalog.GetStatistics(tableName)
+	if stats == nil {
+		return nil, nil
+	}
+	col := &schema.GetColumns()[idx]
+	if colStats := stats.GetColumn(col.GetName()); colStats != nil {
+		return colStats, col
+	}
+	return nil, nil
+}
+
+// statisticsLiteral は定数の式をカラムの値と比べられる値にする
+func statisticsLiteral(expr Expression, col *storage.Column) (storage.Value, bool) {
+	lit, ok := expr.(*Literal)
+	if !ok || col == nil || lit.Value == nil {
+		return nil, false
+	}
+	if key, ok := literalToKey(lit.Value, col); ok {
+		return key, true
+	}
+	return toValue(lit.Value), true
+}
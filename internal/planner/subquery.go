@@ -0,0 +1,493 @@
+package planner
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/takeuchi-shogo/go-example-database/internal/parser"
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
+)
+
+var (
+	// ErrSubqueryColumns は1列を返すべきサブクエリ（スカラー、IN）が複数の列を返すときに返す
+	ErrSubqueryColumns = errors.New("subquery must return exactly one column")
+	// ErrSubqueryRows はスカラーサブクエリが複数の行を返したときに返す
+	ErrSubqueryRows = errors.New("scalar subquery returned more than one row")
+	// ErrCorrelatedSubquery はセミ結合・反結合に書き換えられない相関サブクエリに返す
+	ErrCorrelatedSubquery = errors.New("correlated subquery is only supported as EXISTS or IN in WHERE")
+)
+
+// SubqueryRunner はサブクエリのプランを実行して全行を返す（executor が設定する）
+type SubqueryRunner func(plan PlanNode) ([]*storage.Row, error)
+
+// Subquery は式の中で使う相関のないサブクエリ
+// 最初に評価したときに一度だけ実行し、結果を使い回す
+type Subquery struct {
+	Plan PlanNode
+	run  SubqueryRunner
+	rows []*storage.Row
+	done bool
+}
+
+// SetRunner はサブクエリを実行する関数を設定し、前回の結果を捨てる
+func (s *Subquery) SetRunner(run SubqueryRunner) {
+	s.run = run
+	s.rows = nil
+	s.done = false
+}
+
+// GetRows はサブクエリの結果の行を返す
+func (s *Subquery) GetRows() ([]*storage.Row, error) {
+	if s.done {
+		return s.rows, nil
+	}
+	if s.run == nil {
+		return nil, fmt.Errorf("subquery has no runner: %s", s.Plan.String())
+	}
+	rows, err := s.run(s.Plan)
+	if err != nil {
+		return nil, err
+	}
+	s.rows, s.done = rows, true
+	return rows, nil
+}
+
+// values は各行の先頭の列の値を返す
+func (s *Subquery) values() ([]any, error) {
+	rows, err := s.GetRows()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]any, len(rows))
+	for i, row := range rows {
+		values[i] = extractValue(row.GetValues()[0])
+	}
+	return values, nil
+}
+
+func (s *Subquery) String() string {
+	return "(" + s.Plan.String() + ")"
+}
+
+// ScalarSubqueryExpr は1行1列の値を返すサブクエリ（行がなければ NULL）
+type ScalarSubqueryExpr struct {
+	Subquery *Subquery
+}
+
+func (e *ScalarSubqueryExpr) Evaluate(row *storage.Row, schema *storage.Schema) (any, error) {
+	values, err := e.Subquery.values()
+	if err != nil {
+		return nil, err
+	}
+	switch len(values) {
+	case 0:
+		return nil, nil
+	case 1:
+		return values[0], nil
+	}
+	return nil, fmt.Errorf("%w: %d rows", ErrSubqueryRows, len(values))
+}
+
+func (e *ScalarSubqueryExpr) String() string {
+	return e.Subquery.String()
+}
+
+// InSubqueryExpr は [NOT] IN (SELECT ...) を表す（値のリストの IN と同じ3値論理）
+type InSubqueryExpr struct {
+	Expr     Expression
+	Subquery *Subquery
+	Not      bool
+}
+
+func (e *InSubqueryExpr) Evaluate(row *storage.Row, schema *storage.Schema) (any, error) {
+	value, err := e.Expr.Evaluate(row, schema)
+	if err != nil {
+		return nil, err
+	}
+	list, err := e.Subquery.values()
+	if err != nil {
+		return nil, err
+	}
+	return evaluateIn(value, list, e.Not), nil
+}
+
+func (e *InSubqueryExpr) String() string {
+	operator := "IN"
+	if e.Not {
+		operator = "NOT IN"
+	}
+	return fmt.Sprintf("(%s %s %s)", e.Expr.String(), operator, e.Subquery.String())
+}
+
+// ExistsExpr は EXISTS (SELECT ...) を表す（NULL にはならない）
+type ExistsExpr struct {
+	Subquery *Subquery
+}
+
+func (e *ExistsExpr) Evaluate(row *storage.Row, schema *storage.Schema) (any, error) {
+	rows, err := e.Subquery.GetRows()
+	if err != nil {
+		return nil, err
+	}
+	return len(rows) > 0, nil
+}
+
+func (e *ExistsExpr) String() string {
+	return "EXISTS" + e.Subquery.String()
+}
+
+// CollectSubqueries は式の中のサブクエリをすべて返す
+func CollectSubqueries(exprs ...Expression) []*Subquery {
+	var subqueries []*Subquery
+	for _, expr := range exprs {
+		walkExpression(expr, func(e Expression) {
+			switch s := e.(type) {
+			case *ScalarSubqueryExpr:
+				subqueries = append(subqueries, s.Subquery)
+			case *InSubqueryExpr:
+				subqueries = append(subqueries, s.Subquery)
+			case *ExistsExpr:
+				subqueries = append(subqueries, s.Subquery)
+			}
+		})
+	}
+	return subqueries
+}
+
+// walkExpression は式とその部分式を順にたどる（サブクエリのプランの中には入らない）
+func walkExpression(expr Expression, visit func(Expression)) {
+	if expr == nil {
+		return
+	}
+	visit(expr)
+	for _, operand := range operands(expr) {
+		walkExpression(operand, visit)
+	}
+}
+
+// operands は式の直接の部分式を返す（省略された部分式は nil）
+func operands(expr Expression) []Expression {
+	switch e := expr.(type) {
+	case *BinaryExpr:
+		return []Expression{e.Left, e.Right}
+	case *UnaryExpr:
+		return []Expression{e.Expr}
+	case *IsNullExpr:
+		return []Expression{e.Expr}
+	case *CastExpr:
+		return []Expression{e.Expr}
+	case *FunctionExpr:
+		return e.Args
+	case *LikeExpr:
+		return []Expression{e.Expr, e.Pattern, e.Escape}
+	case *InExpr:
+		return append([]Expression{e.Expr}, e.List...)
+	case *BetweenExpr:
+		return []Expression{e.Expr, e.Low, e.High}
+	case *InSubqueryExpr:
+		return []Expression{e.Expr}
+	}
+	return nil
+}
+
+// columnRefs は式が参照するカラムを返す
+func columnRefs(expr Expression) []*ColumnRef {
+	var refs []*ColumnRef
+	walkExpression(expr, func(e Expression) {
+		if ref, ok := e.(*ColumnRef); ok {
+			refs = append(refs, ref)
+		}
+	})
+	return refs
+}
+
+// replaceColumnRefs は式のカラム参照を replace の結果に置き換えた式を返す
+func replaceColumnRefs(expr Expression, replace func(*ColumnRef) Expression) Expression {
+	if expr == nil {
+		return nil
+	}
+	mapped := func(exprs ...Expression) []Expression {
+		result := make([]Expression, len(exprs))
+		for i, e := range exprs {
+			result[i] = replaceColumnRefs(e, replace)
+		}
+		return result
+	}
+	switch e := expr.(type) {
+	case *ColumnRef:
+		return replace(e)
+	case *BinaryExpr:
+		ops := mapped(e.Left, e.Right)
+		return &BinaryExpr{Left: ops[0], Operator: e.Operator, Right: ops[1]}
+	case *UnaryExpr:
+		return &UnaryExpr{Operator: e.Operator, Expr: replaceColumnRefs(e.Expr, replace)}
+	case *IsNullExpr:
+		return &IsNullExpr{Expr: replaceColumnRefs(e.Expr, replace), Not: e.Not}
+	case *CastExpr:
+		return &CastExpr{Expr: replaceColumnRefs(e.Expr, replace), Target: e.Target, Type: e.Type}
+	case *FunctionExpr:
+		return &FunctionExpr{Name: e.Name, Args: mapped(e.Args...), fn: e.fn}
+	case *LikeExpr:
+		ops := mapped(e.Expr, e.Pattern, e.Escape)
+		return &LikeExpr{Expr: ops[0], Pattern: ops[1], Escape: ops[2], Not: e.Not}
+	case *InExpr:
+		ops := mapped(append([]Expression{e.Expr}, e.List...)...)
+		return &InExpr{Expr: ops[0], List: ops[1:], Not: e.Not}
+	case *BetweenExpr:
+		ops := mapped(e.Expr, e.Low, e.High)
+		return &BetweenExpr{Expr: ops[0], Low: ops[1], High: ops[2], Not: e.Not}
+	case *InSubqueryExpr:
+		return &InSubqueryExpr{Expr: replaceColumnRefs(e.Expr, replace), Subquery: e.Subquery, Not: e.Not}
+	}
+	return expr
+}
+
+// planSubquery は式の中のサブクエリを変換する
+// 外側の行ごとに実行しないので、外側のカラムを参照する（相関する）サブクエリはエラーにする
+// columns が 0 より大きければ、サブクエリが返す列の数を確かめる
+func (p *planner) planSubquery(stmt *parser.SelectStatement, columns int) (*Subquery, error) {
+	plan, outerRefs, err := p.planQuery(stmt)
+	if err != nil {
+		return nil, err
+	}
+	if len(outerRefs) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrCorrelatedSubquery, outerRefs[0].String())
+	}
+	if columns > 0 && plan.Schema().GetColumnCount() != columns {
+		return nil, fmt.Errorf("%w: got %d", ErrSubqueryColumns, plan.Schema().GetColumnCount())
+	}
+	return &Subquery{Plan: plan}, nil
+}
+
+// subqueryPredicate は WHERE の条件が [NOT] EXISTS (SELECT ...) か x [NOT] IN (SELECT ...) なら、
+// サブクエリ、IN の左辺（EXISTS なら nil）、否定かどうかを返す
+func subqueryPredicate(expr parser.Expression) (*parser.SelectStatement, parser.Expression, bool, bool) {
+	not := false
+	if unary, ok := expr.(*parser.UnaryExpression); ok && strings.EqualFold(unary.Operator, "NOT") {
+		not, expr = true, unary.Operand
+	}
+	switch e := expr.(type) {
+	case *parser.ExistsExpression:
+		return e.Subquery, nil, not, true
+	case *parser.InExpression:
+		if e.Subquery != nil {
+			return e.Subquery, e.Expression, not != e.Not, true
+		}
+	}
+	return nil, nil, false, false
+}
+
+// splitWhere は AND で結ばれた WHERE 句を条件ごとに分ける
+func splitWhere(expr parser.Expression) []parser.Expression {
+	if bin, ok := expr.(*parser.BinaryExpression); ok && strings.EqualFold(bin.Operator, "AND") {
+		return append(splitWhere(bin.Left), splitWhere(bin.Right)...)
+	}
+	return []parser.Expression{expr}
+}
+
+// joinWhere は条件を AND で結び直す（条件がなければ nil）
+func joinWhere(conjuncts []parser.Expression) parser.Expression {
+	var result parser.Expression
+	for _, c := range conjuncts {
+		if result == nil {
+			result = c
+			continue
+		}
+		result = &parser.BinaryExpression{Left: result, Operator: "AND", Right: c}
+	}
+	return result
+}
+
+// planSubqueryJoin は WHERE の [NOT] EXISTS / [NOT] IN (SELECT ...) をセミ結合・反結合にする（Left は呼び出し側が設定する）
+// サブクエリの WHERE の外側のカラムを参照する条件（相関）は結合条件に移し、
+// 外側の行ごとにサブクエリを実行し直さないようにする
+//
+//	EXISTS (SELECT ... FROM t WHERE t.a = outer.b AND c) → SemiJoin(outer, Filter(c, t), t.a = outer.b)
+//	x NOT IN (SELECT y FROM t)                        → AntiJoin(outer, t, x = y OR (x = y) IS NULL)
+func (p *planner) planSubqueryJoin(stmt *parser.SelectStatement, lhs parser.Expression, anti bool, outer *storage.Schema) (*JoinNode, error) {
+	source, err := p.planFrom(stmt)
+	if err != nil {
+		return nil, err
+	}
+	inner := source.Schema()
+
+	// 1. サブクエリの WHERE を相関する条件とそれ以外に分ける
+	var local []parser.Expression
+	var correlated []Expression
+	for _, conjunct := range splitWhere(stmt.Where) {
+		if conjunct == nil {
+			continue
+		}
+		// 入れ子のサブクエリはサブクエリの中で変換する
+		if _, _, _, ok := subqueryPredicate(conjunct); ok {
+			local = append(local, conjunct)
+			continue
+		}
+		condition, err := p.planExpression(conjunct)
+		if err != nil {
+			return nil, err
+		}
+		isCorrelated, err := referencesOuter(condition, inner, outer)
+		if err != nil {
+			return nil, err
+		}
+		if isCorrelated {
+			correlated = append(correlated, condition)
+		} else {
+			local = append(local, conjunct)
+		}
+	}
+
+	// 2. 右側のプラン（相関がなければサブクエリそのまま、あれば相関する条件を除いた FROM と WHERE）
+	var right PlanNode
+	var value Expression // IN で比べるサブクエリの値
+	if len(correlated) == 0 {
+		if right, err = p.planSelect(stmt); err != nil {
+			return nil, err
+		}
+		if lhs != nil && right.Schema().GetColumnCount() != 1 {
+			return nil, fmt.Errorf("%w: got %d", ErrSubqueryColumns, right.Schema().GetColumnCount())
+		}
+	} else {
+		if hasAggregateFunction(stmt.Columns) || len(stmt.GroupBy) > 0 || stmt.Limit != nil || stmt.Offset != nil {
+			return nil, fmt.Errorf("%w: correlated subquery with aggregates, GROUP BY or LIMIT", ErrCorrelatedSubquery)
+		}
+		if right, _, err = p.planWhere(joinWhere(local), source); err != nil {
+			return nil, err
+		}
+		if lhs != nil {
+			if len(stmt.Columns) != 1 || isSelectAll(stmt.Columns) {
+				return nil, fmt.Errorf("%w: got %d", ErrSubqueryColumns, len(stmt.Columns))
+			}
+			column := stmt.Columns[0]
+			if aliased, ok := column.(*parser.AliasedExpression); ok {
+				column = aliased.Expression
+			}
+			if value, err = p.planExpression(column); err != nil {
+				return nil, err
+			}
+			if _, err := referencesOuter(value, inner, outer); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// 3. 外側と同じテーブル名のカラムがあれば、区別できるように右側に別名を付ける
+	if alias, ok := subqueryAlias(right.Schema(), outer); ok {
+		right = &SubqueryScanNode{Alias: alias, Child: right}
+	}
+	rightSchema := right.Schema()
+
+	// 4. 結合条件のカラム参照を左右どちらのカラムか分かるようにテーブル名で修飾する
+	// 相関する場合の右側は FROM 句と同じ並びのカラムを返す
+	// 曖昧なカラムは referencesOuter で確かめてあるので、ここでは起こらない
+	qualify := func(ref *ColumnRef) Expression {
+		if idx, _ := resolveColumn(inner, ref); idx >= 0 {
+			return &ColumnRef{TableName: rightSchema.GetColumns()[idx].GetTableName(), Name: ref.Name}
+		}
+		return qualifyColumn(ref, outer)
+	}
+	var conditions []Expression
+	for _, condition := range correlated {
+		conditions = append(conditions, replaceColumnRefs(condition, qualify))
+	}
+	if lhs != nil {
+		left, err := p.planExpression(lhs)
+		if err != nil {
+			return nil, err
+		}
+		left = replaceColumnRefs(left, func(ref *ColumnRef) Expression { return qualifyColumn(ref, outer) })
+		if value != nil {
+			value = replaceColumnRefs(value, qualify)
+		} else {
+			col := rightSchema.GetColumns()[0]
+			value = &ColumnRef{TableName: col.GetTableName(), Name: col.GetName()}
+		}
+		var match Expression = &BinaryExpr{Left: left, Operator: "=", Right: value}
+		// NOT IN は NULL と比べた行があると真にならないので、比較が NULL の行も一致とみなす
+		if anti {
+			match = &BinaryExpr{Left: match, Operator: "OR", Right: &IsNullExpr{Expr: match}}
+		}
+		conditions = append(conditions, match)
+	}
+	joinType := JoinTypeSemi
+	if anti {
+		joinType = JoinTypeAnti
+	}
+	return &JoinNode{Right: right, JoinType: joinType, Condition: joinConjunction(conditions)}, nil
+}
+
+// referencesOuter は条件がサブクエリの外側のカラムを参照するかどうかを返す
+// どちらにもないカラムを参照していればエラーにする
+func referencesOuter(condition Expression, inner, outer *storage.Schema) (bool, error) {
+	correlated := false
+	for _, ref := range columnRefs(condition) {
+		idx, err := resolveColumn(inner, ref)
+		if err != nil {
+			return false, err
+		}
+		if idx >= 0 {
+			continue
+		}
+		if _, err := outer.FindColumn(ref.TableName, ref.Name); err != nil {
+			return false, err
+		}
+		correlated = true
+	}
+	return correlated, nil
+}
+
+// resolveColumn はカラム参照のインデックスを返す
+// スキーマになければ -1 を返し、曖昧なら ErrAmbiguousColumn を返す
+func resolveColumn(schema *storage.Schema, ref *ColumnRef) (int, error) {
+	idx, err := schema.FindColumn(ref.TableName, ref.Name)
+	if errors.Is(err, storage.ErrColumnNotFound) || errors.Is(err, storage.ErrUnknownTable) {
+		return -1, nil
+	}
+	return idx, err
+}
+
+// checkColumns は式が参照するカラムがすべてスキーマにあるかを確かめ、
+// なければ FindColumn のエラー（存在しない、曖昧など）を返す
+func checkColumns(expr Expression, schema *storage.Schema) error {
+	for _, ref := range columnRefs(expr) {
+		if _, err := schema.FindColumn(ref.TableName, ref.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// qualifyColumn はスキーマにあるカラムの参照をそのカラムのテーブル名で修飾する
+// 曖昧なカラムはそのまま返し、評価するときにエラーにする
+func qualifyColumn(ref *ColumnRef, schema *storage.Schema) Expression {
+	if idx, err := resolveColumn(schema, ref); err == nil && idx >= 0 {
+		return &ColumnRef{TableName: schema.GetColumns()[idx].GetTableName(), Name: ref.Name}
+	}
+	return ref
+}
+
+// subqueryAlias は右側のカラムに外側と同じテーブル名のものがあれば、重ならない別名を返す
+func subqueryAlias(right, outer *storage.Schema) (string, bool) {
+	used := make(map[string]bool)
+	for _, col := range outer.GetColumns() {
+		used[col.GetTableName()] = true
+	}
+	clash := false
+	for _, col := range right.GetColumns() {
+		if used[col.GetTableName()] {
+			clash = true
+			break
+		}
+	}
+	if !clash {
+		return "", false
+	}
+	for i := 1; ; i++ {
+		alias := fmt.Sprintf("%s_%d", right.GetTableName(), i)
+		if !used[alias] {
+			return alias, true
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package planner
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/takeuchi-shogo/go-example-database/internal/parser"
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
+)
+
+func setupSubqueryCatalog() *mockCatalog {
+	mock := setupTestCatalog()
+	mock.CreateIndex("users_pkey", "users", []string{"id"}, true)
+	mock.CreateTable("orders", storage.NewSchema("orders", []storage.Column{
+		*storage.NewColumn("id", storage.ColumnTypeInt64, 0, false),
+		*storage.NewColumn("user_id", storage.ColumnTypeInt64, 0, true),
+		*storage.NewColumn("amount", storage.ColumnTypeInt64, 0, false),
+	}))
+	return mock
+}
+
+func planSQL(t *testing.T, p Planner, sql string) (PlanNode, error) {
+	t.Helper()
+	stmt, err := parser.NewParser(parser.NewLexer(sql)).Parse()
+	if err != nil {
+		t.Fatalf("%s: parse error: %v", sql, err)
+	}
+	return p.Plan(stmt)
+}
+
+func TestPlanSubqueryJoins(t *testing.T) {
+	p := NewPlanner(setupSubqueryCatalog())
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		// 相関する条件は結合条件に移り、残りの条件は右側で絞り込む
+		{"SELECT * FROM users WHERE EXISTS (SELECT * FROM orders WHERE orders.user_id = users.id AND amount > 10)",
+			"SemiJoin(Scan(users), Filter((amount > 10)), (orders.user_id = users.id))"},
+		{"SELECT * FROM users WHERE NOT EXISTS (SELECT * FROM orders WHERE user_id = users.id)",
+			"AntiJoin(Scan(users), Scan(orders), (orders.user_id = users.id))"},
+		{"SELECT * FROM users WHERE id IN (SELECT user_id FROM orders)",
+			"SemiJoin(Scan(users), Project([user_id]), (users.id = orders.user_id))"},
+		// NOT IN は比較が NULL になる行も一致とみなす
+		{"SELECT * FROM users WHERE id NOT IN (SELECT user_id FROM orders)",
+			"AntiJoin(Scan(users), Project([user_id]), ((users.id = orders.user_id) OR ((users.id = orders.user_id) IS NULL)))"},
+		// 外側と同じテーブルは別名を付けて区別し、残りの条件はインデックスに使える
+		{"SELECT * FROM users WHERE id IN (SELECT id FROM users WHERE name = 'alice') AND id < 5",
+			"SemiJoin(IndexScan(users, users_pkey, id < 5), Subquery(users_1, Project([id])), (users.id = users_1.id))"},
+		// OR の中のサブクエリは結合にせず値として評価する
+		{"SELECT * FROM users WHERE id IN (SELECT user_id FROM orders) OR name = 'bob'",
+			"Filter(((id IN (Project([user_id]))) OR (name = bob)))"},
+	}
+	for _, tt := range tests {
+		plan, err := planSQL(t, p, tt.sql)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.sql, err)
+		}
+		if plan.String() != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.sql, tt.expected, plan.String())
+		}
+	}
+
+	// セミ結合の出力は左のカラムだけ
+	plan, _ := planSQL(t, p, "SELECT * FROM users WHERE id IN (SELECT user_id FROM orders)")
+	if got := plan.Schema().GetColumnCount(); got != 3 {
+		t.Errorf("expected semi join to keep 3 columns, got %d", got)
+	}
+}
+
+func TestPlanScalarSubqueryAndDerivedTable(t *testing.T) {
+	p := NewPlanner(setupSubqueryCatalog())
+
+	plan, err := planSQL(t, p, "SELECT name FROM users WHERE id = (SELECT MAX(user_id) FROM orders)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter, ok := plan.(*ProjectNode).Child.(*FilterNode)
+	if !ok {
+		t.Fatalf("expected filter under project, got %s", plan.(*ProjectNode).Child.String())
+	}
+	scalar, ok := filter.Condition.(*BinaryExpr).Right.(*ScalarSubqueryExpr)
+	if !ok {
+		t.Fatalf("expected scalar subquery, got %s", filter.Condition.String())
+	}
+	if cols := scalar.Subquery.Plan.Schema().GetColumns(); len(cols) != 1 || cols[0].GetName() != "MAX(user_id)" {
+		t.Errorf("unexpected subquery schema: %v", cols)
+	}
+
+	plan, err = planSQL(t, p, "SELECT o.amount FROM (SELECT * FROM orders WHERE amount > 10) AS o WHERE o.user_id = 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter = plan.(*ProjectNode).Child.(*FilterNode)
+	derived, ok := filter.Child.(*SubqueryScanNode)
+	if !ok || derived.Alias != "o" {
+		t.Fatalf("expected derived table o, got %s", filter.Child.String())
+	}
+	for _, col := range derived.Schema().GetColumns() {
+		if col.GetTableName() != "o" {
+			t.Errorf("expected column %s to belong to o, got %s", col.GetName(), col.GetTableName())
+		}
+	}
+
+	errorCases := map[string]error{
+		"SELECT * FROM users WHERE id = (SELECT user_id FROM orders WHERE orders.user_id = users.id)":     ErrCorrelatedSubquery,
+		"SELECT * FROM users WHERE id IN (SELECT id, amount FROM orders)":                                 ErrSubqueryColumns,
+		"SELECT * FROM users WHERE id = (SELECT * FROM orders)":                                           ErrSubqueryColumns,
+		"SELECT * FROM users WHERE id IN (SELECT user_id FROM orders WHERE users.id = orders.id LIMIT 1)": ErrCorrelatedSubquery,
+		// サブクエリの中で曖昧なカラムを外側のカラムとみなさない
+		"SELECT * FROM orders WHERE EXISTS (SELECT u.name FROM users u JOIN orders o ON o.user_id = u.id WHERE id = 1)":        storage.ErrAmbiguousColumn,
+		"SELECT * FROM users WHERE id IN (SELECT id FROM orders o JOIN users u ON o.user_id = u.id WHERE o.amount = users.id)": storage.ErrAmbiguousColumn,
+		"SELECT * FROM orders WHERE amount = (SELECT o.amount FROM users u JOIN orders o ON o.user_id = u.id WHERE id = 1)":    storage.ErrAmbiguousColumn,
+	}
+	for sql, want := range errorCases {
+		if _, err := planSQL(t, p, sql); !errors.Is(err, want) {
+			t.Errorf("%s: expected %v, got %v", sql, want, err)
+		}
+	}
+}
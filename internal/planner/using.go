@@ -0,0 +1,123 @@
+package planner
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
+)
+
+// usingColumn は USING のカラムと、結合条件で比べる左右の式
+type usingColumn struct {
+	name        string
+	left, right Expression
+}
+
+// planUsing は USING (a, b) のカラムごとに、比べる左右のカラムをテーブル名で修飾した式にする
+func planUsing(columns []string, left, right PlanNode) ([]usingColumn, error) {
+	using := make([]usingColumn, len(columns))
+	for i, column := range columns {
+		l, err := usingOperand(left, column)
+		if err != nil {
+			return nil, err
+		}
+		r, err := usingOperand(right, column)
+		if err != nil {
+			return nil, err
+		}
+		using[i] = usingColumn{name: column, left: l, right: r}
+	}
+	return using, nil
+}
+
+// usingCondition は USING (a, b) を left.a = right.a AND left.b = right.b にする
+func usingCondition(using []usingColumn) Expression {
+	conditions := make([]Expression, len(using))
+	for i, column := range using {
+		conditions[i] = &BinaryExpr{Left: column.left, Operator: "=", Right: column.right}
+	}
+	return joinConjunction(conditions)
+}
+
+// usingOperand は USING のカラムを結合したスキーマでも区別できる式にする
+// 前の USING でまとめたカラムはテーブル名を持たないので、まとめた式（元のカラムの式）にする
+func usingOperand(plan PlanNode, column string) (Expression, error) {
+	schema := plan.Schema()
+	idx, err := schema.FindColumn("", column)
+	if err != nil {
+		return nil, fmt.Errorf("column not found in USING: %s: %w", column, err)
+	}
+	col := schema.GetColumns()[idx]
+	if project, ok := plan.(*ProjectNode); ok && idx < project.Using {
+		return project.GetExpression(idx), nil
+	}
+	return &ColumnRef{TableName: col.GetTableName(), Name: column}, nil
+}
+
+// planUsingColumns は USING の結合の上に、USING のカラムを1つにまとめる射影を追加する
+// まとめたカラムを先頭に出力し、名前だけで参照するとこのカラムになる
+// （内部結合と LEFT は左、RIGHT は右、FULL は COALESCE(左, 右) の値）
+// 左右の元のカラムはテーブル名で修飾したときだけ参照でき、* には含めない
+func planUsingColumns(join *JoinNode, using []usingColumn) PlanNode {
+	project := &ProjectNode{Using: len(using), Child: join}
+	names := make([]string, len(using))
+	for i, column := range using {
+		var merged Expression
+		switch join.JoinType {
+		case JoinTypeRight:
+			merged = column.right
+		case JoinTypeFull:
+			merged = &FunctionExpr{Name: "COALESCE", Args: []Expression{column.left, column.right}, fn: scalarFunctions["COALESCE"]}
+		default:
+			merged = column.left
+		}
+		names[i] = column.name
+		project.Columns = append(project.Columns, column.name)
+		project.Expressions = append(project.Expressions, merged)
+	}
+	for _, col := range join.Schema().GetColumns() {
+		// 前の USING でまとめた同じ名前のカラムは、新しくまとめたカラムに置き換わる
+		if col.GetTableName() == "" && slices.Contains(names, col.GetName()) {
+			continue
+		}
+		project.Columns = append(project.Columns, col.GetName())
+		project.Expressions = append(project.Expressions, &ColumnRef{TableName: col.GetTableName(), Name: col.GetName()})
+	}
+	return project
+}
+
+// markUsingColumns は USING の射影のスキーマで、まとめたカラムのテーブル名を外し、元のカラムを隠す
+func markUsingColumns(schema *storage.Schema, project *ProjectNode) {
+	input := project.Child.Schema()
+	columns := schema.GetColumns()
+	for i := range columns {
+		if i < project.Using {
+			columns[i].SetTableName("")
+			continue
+		}
+		hidden := slices.Contains(project.Columns[:project.Using], columns[i].GetName())
+		if ref, ok := project.GetExpression(i).(*ColumnRef); ok && !hidden {
+			idx, err := input.FindColumn(ref.TableName, ref.Name)
+			hidden = err == nil && input.GetColumns()[idx].GetHidden()
+		}
+		columns[i].SetHidden(hidden)
+	}
+}
+
+// hasHiddenColumns は USING でまとめた元のカラムがスキーマにあるかどうかを返す
+func hasHiddenColumns(schema *storage.Schema) bool {
+	return slices.ContainsFunc(schema.GetColumns(), func(col storage.Column) bool { return col.GetHidden() })
+}
+
+// planVisibleColumns は SELECT * で、USING でまとめた元のカラムを除いたカラムを射影する
+func planVisibleColumns(plan PlanNode) PlanNode {
+	project := &ProjectNode{Child: plan}
+	for _, col := range plan.Schema().GetColumns() {
+		if col.GetHidden() {
+			continue
+		}
+		project.Columns = append(project.Columns, col.GetName())
+		project.Expressions = append(project.Expressions, &ColumnRef{TableName: col.GetTableName(), Name: col.GetName()})
+	}
+	return project
+}
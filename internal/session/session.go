@@ -1,6 +1,7 @@
 package session
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/takeuchi-shogo/go-example-database/internal/catalog"
@@ -8,10 +9,14 @@ import (
 	"github.com/takeuchi-shogo/go-example-database/internal/executor"
 	"github.com/takeuchi-shogo/go-example-database/internal/parser"
 	"github.com/takeuchi-shogo/go-example-database/internal/planner"
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
 )
 
 type Session interface {
 	Execute(sqlQuery string) (executor.ResultSet, error)
+	// Stream は SELECT と EXPLAIN の結果を生成されたそばから1行ずつ emit に渡す
+	// それ以外の文は Execute と同じように実行する
+	Stream(sqlQuery string, emit func(row *storage.Row) error) (executor.ResultSet, error)
 	Close() error
 }
 
@@ -19,20 +24,30 @@ type session struct {
 	catalog    catalog.Catalog
 	executor   executor.Executor
 	planner    planner.Planner
+	optimizer  planner.Optimizer
 	wal        *dbtxn.WAL
 	txnManager *dbtxn.TxnManager
 	currentTxn *dbtxn.Transaction
+	isolation  dbtxn.IsolationLevel // このセッションで始めるトランザクションの分離レベル
 }
 
 func NewSession(catalog catalog.Catalog, executor executor.Executor, wal *dbtxn.WAL) Session {
-	txnManager := dbtxn.NewTxnManager(wal)
+	return NewSessionWithTxnManager(catalog, executor, dbtxn.NewTxnManagerWithCatalog(wal, catalog))
+}
+
+// NewSessionWithTxnManager はほかのセッションとトランザクションマネージャーを共有するセッションを作成する
+// 同じカタログを使うセッションは、ロックで互いの変更を待つために同じトランザクションマネージャーを使うこと
+// Executor はセッションごとに作成する
+func NewSessionWithTxnManager(catalog catalog.Catalog, executor executor.Executor, txnManager *dbtxn.TxnManager) Session {
 	return &session{
 		catalog:    catalog,
 		executor:   executor,
 		planner:    planner.NewPlanner(catalog),
-		wal:        wal,
+		optimizer:  planner.NewOptimizer(nil, planner.NewCostEstimator(catalog)),
+		wal:        txnManager.GetWAL(),
 		txnManager: txnManager,
 		currentTxn: nil,
+		isolation:  dbtxn.DefaultIsolationLevel,
 	}
 }
 
@@ -41,27 +56,166 @@ func (s *session) Execute(sqlQuery string) (executor.ResultSet, error) {
 	if err != nil {
 		return nil, err
 	}
-	switch stmt.(type) {
+	switch stmt := stmt.(type) {
 	case *parser.BeginStatement:
-		return s.Begin()
+		return s.begin(stmt)
+	case *parser.SetTransactionStatement:
+		return s.setTransaction(stmt)
 	case *parser.CommitStatement:
 		return s.Commit()
 	case *parser.RollbackStatement:
+		if stmt.Savepoint != "" {
+			return s.rollbackToSavepoint(stmt.Savepoint)
+		}
 		return s.Rollback()
+	case *parser.SavepointStatement:
+		return s.savepoint(stmt.Name)
+	case *parser.ReleaseSavepointStatement:
+		return s.releaseSavepoint(stmt.Name)
 	default:
 		return s.executeSQL(stmt)
 	}
 }
 
+func (s *session) Stream(sqlQuery string, emit func(row *storage.Row) error) (executor.ResultSet, error) {
+	stmt, err := parser.NewParser(parser.NewLexer(sqlQuery)).Parse()
+	if err != nil {
+		return nil, err
+	}
+	switch stmt.(type) {
+	case *parser.SelectStatement, *parser.ExplainStatement:
+	default:
+		return s.Execute(sqlQuery)
+	}
+	plan, err := s.plan(stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer s.beginStatement()()
+	it, err := s.executor.Open(plan)
+	if err != nil {
+		return nil, s.abortOnLockError(err)
+	}
+	defer it.Close()
+	count := 0
+	for {
+		hasNext, err := it.Next()
+		if err != nil {
+			return nil, s.abortOnLockError(err)
+		}
+		if !hasNext {
+			break
+		}
+		if err := emit(it.GetRow()); err != nil {
+			return nil, err
+		}
+		count++
+	}
+	return executor.NewResultSetWithMessage(fmt.Sprintf("%d rows", count)), nil
+}
+
 func (s *session) executeSQL(stmt parser.Statement) (executor.ResultSet, error) {
-	// 1. Statement を PlanNode に変換
+	// 1. Statement を PlanNode に変換して最適化
+	plan, err := s.plan(stmt)
+	if err != nil {
+		return nil, err
+	}
+	// 2. トランザクション外の変更は文ごとのトランザクションで実行する
+	if s.currentTxn == nil && isWritePlan(plan) {
+		return s.executeAutocommit(plan)
+	}
+	// 3. PlanNode を実行して結果を返す
+	defer s.beginStatement()()
+	result, err := s.executor.Execute(plan)
+	if err != nil {
+		return nil, s.abortOnLockError(err)
+	}
+	return result, nil
+}
+
+// plan は Statement を PlanNode に変換し、統計情報を使って結合順などを最適化する
+func (s *session) plan(stmt parser.Statement) (planner.PlanNode, error) {
 	plan, err := s.planner.Plan(stmt)
 	if err != nil {
 		return nil, err
 	}
-	// 2. PlanNode を実行して結果を返す
+	return s.optimizer.Optimize(plan)
+}
+
+// abortOnLockError はデッドロックの犠牲になったかロック待ちがタイムアウトしたトランザクションをロールバックする
+// ロックを持ったまま続けるとほかのトランザクションを待たせ続けるため、トランザクション全体を取り消す
+func (s *session) abortOnLockError(err error) error {
+	if s.currentTxn == nil || !(errors.Is(err, dbtxn.ErrDeadlock) || errors.Is(err, dbtxn.ErrLockTimeout)) {
+		return err
+	}
+	rerr := s.txnManager.Rollback(s.currentTxn)
+	s.currentTxn = nil
+	s.executor.SetTransaction(nil)
+	if rerr != nil {
+		return fmt.Errorf("%w (rollback failed: %v)", err, rerr)
+	}
+	return fmt.Errorf("%w: transaction rolled back", err)
+}
+
+// beginStatement は文を実行する前に、文が読むスナップショットを用意する
+// トランザクションの中ではトランザクションの分離レベルに従い、外では文の開始時点のスナップショットを設定する
+// 戻り値の関数で設定を外してスナップショットを解放する
+func (s *session) beginStatement() func() {
+	if s.currentTxn != nil {
+		s.txnManager.BeginStatement(s.currentTxn)
+		return func() {}
+	}
+	versions := s.txnManager.GetVersionStore()
+	snapshot := versions.Snapshot(0)
+	s.executor.SetSnapshot(snapshot)
+	return func() {
+		s.executor.SetSnapshot(nil)
+		versions.ReleaseSnapshot(snapshot)
+	}
+}
+
+// isWritePlan は行を変更する文かどうかを返す
+func isWritePlan(plan planner.PlanNode) bool {
+	switch plan.(type) {
+	case *planner.InsertNode, *planner.UpdateNode, *planner.DeleteNode:
+		return true
+	default:
+		return false
+	}
+}
+
+// maxAutocommitRetries は文ごとのトランザクションが書き込み競合でやり直す回数の上限
+const maxAutocommitRetries = 3
+
+// executeAutocommit は文を1つのトランザクションとして実行する
+// 失敗した場合は途中までの変更をロールバックする
+// 書き込み競合でロールバックされた場合は、利用者に結果を見せる前なので新しいスナップショットでやり直す
+func (s *session) executeAutocommit(plan planner.PlanNode) (executor.ResultSet, error) {
+	for attempt := 0; ; attempt++ {
+		result, err := s.executeOnce(plan)
+		if errors.Is(err, dbtxn.ErrWriteConflict) && attempt < maxAutocommitRetries {
+			continue
+		}
+		return result, err
+	}
+}
+
+// executeOnce は文を1つのトランザクションで1回実行する
+func (s *session) executeOnce(plan planner.PlanNode) (executor.ResultSet, error) {
+	txn, err := s.txnManager.BeginWithIsolationLevel(s.isolation)
+	if err != nil {
+		return nil, err
+	}
+	s.executor.SetTransaction(txn)
+	defer s.executor.SetTransaction(nil)
 	result, err := s.executor.Execute(plan)
 	if err != nil {
+		if rerr := s.txnManager.Rollback(txn); rerr != nil {
+			return nil, fmt.Errorf("%w (rollback failed: %v)", err, rerr)
+		}
+		return nil, err
+	}
+	if err := s.txnManager.Commit(txn); err != nil {
 		return nil, err
 	}
 	return result, nil
@@ -72,28 +226,60 @@ func (s *session) Close() error {
 }
 
 func (s *session) Begin() (executor.ResultSet, error) {
+	return s.begin(&parser.BeginStatement{})
+}
+
+// begin はトランザクションを開始する
+// ISOLATION LEVEL の指定がなければセッションの分離レベルを使う
+func (s *session) begin(stmt *parser.BeginStatement) (executor.ResultSet, error) {
 	if s.currentTxn != nil {
 		return nil, fmt.Errorf("transaction already started")
 	}
-	txn, err := s.txnManager.Begin()
+	level := s.isolation
+	if stmt.IsolationLevel != "" {
+		var err error
+		if level, err = dbtxn.ParseIsolationLevel(stmt.IsolationLevel); err != nil {
+			return nil, err
+		}
+	}
+	txn, err := s.txnManager.BeginWithIsolationLevel(level)
 	if err != nil {
 		return nil, err
 	}
 	s.currentTxn = txn
-	s.executor.SetTxnID(txn.ID)
+	s.executor.SetTransaction(txn)
 	return executor.NewResultSetWithMessage("BEGIN transaction successfully"), nil
 }
 
+// setTransaction はこのセッションで以降に始めるトランザクションの分離レベルを設定する
+// ほかのセッションの分離レベルは変わらない
+func (s *session) setTransaction(stmt *parser.SetTransactionStatement) (executor.ResultSet, error) {
+	if s.currentTxn != nil {
+		return nil, fmt.Errorf("cannot change isolation level inside a transaction")
+	}
+	level, err := dbtxn.ParseIsolationLevel(stmt.IsolationLevel)
+	if err != nil {
+		return nil, err
+	}
+	s.isolation = level
+	return executor.NewResultSetWithMessage(fmt.Sprintf("isolation level set to %s", level)), nil
+}
+
 func (s *session) Commit() (executor.ResultSet, error) {
 	if s.currentTxn == nil {
 		return nil, fmt.Errorf("no transaction to commit")
 	}
 	err := s.txnManager.Commit(s.currentTxn)
+	if errors.Is(err, dbtxn.ErrWriteConflict) || errors.Is(err, dbtxn.ErrCommitFailed) {
+		// 書き込み競合や COMMIT ログを書けなかったトランザクションは終了済み
+		s.currentTxn = nil
+		s.executor.SetTransaction(nil)
+	}
 	if err != nil {
 		return nil, err
 	}
 	s.currentTxn = nil
-	s.executor.SetTxnID(0)
+	s.executor.SetTransaction(nil)
 	return executor.NewResultSetWithMessage("COMMIT transaction successfully"), nil
 }
 
@@ -101,11 +287,45 @@ func (s *session) Rollback() (executor.ResultSet, error) {
 	if s.currentTxn == nil {
 		return nil, fmt.Errorf("no transaction to rollback")
 	}
+	// ロールバックに失敗してもトランザクションは終了しているので、セッションから外す
 	err := s.txnManager.Rollback(s.currentTxn)
+	s.currentTxn = nil
+	s.executor.SetTransaction(nil)
 	if err != nil {
 		return nil, err
 	}
-	s.currentTxn = nil
-	s.executor.SetTxnID(0)
 	return executor.NewResultSetWithMessage("ROLLBACK transaction successfully"), nil
 }
+
+// savepoint は現在のトランザクションにセーブポイントを作成する
+func (s *session) savepoint(name string) (executor.ResultSet, error) {
+	if s.currentTxn == nil {
+		return nil, fmt.Errorf("SAVEPOINT can only be used in a transaction")
+	}
+	if err := s.txnManager.Savepoint(s.currentTxn, name); err != nil {
+		return nil, err
+	}
+	return executor.NewResultSetWithMessage(fmt.Sprintf("savepoint %s created", name)), nil
+}
+
+// rollbackToSavepoint はセーブポイントより後の変更を取り消す（トランザクションは続く）
+func (s *session) rollbackToSavepoint(name string) (executor.ResultSet, error) {
+	if s.currentTxn == nil {
+		return nil, fmt.Errorf("ROLLBACK TO SAVEPOINT can only be used in a transaction")
+	}
+	if err := s.txnManager.RollbackToSavepoint(s.currentTxn, name); err != nil {
+		return nil, err
+	}
+	return executor.NewResultSetWithMessage(fmt.Sprintf("rolled back to savepoint %s", name)), nil
+}
+
+// releaseSavepoint はセーブポイントを削除する（変更はそのまま残る）
+func (s *session) releaseSavepoint(name string) (executor.ResultSet, error) {
+	if s.currentTxn == nil {
+		return nil, fmt.Errorf("RELEASE SAVEPOINT can only be used in a transaction")
+	}
+	if err := s.txnManager.ReleaseSavepoint(s.currentTxn, name); err != nil {
+		return nil, err
+	}
+	return executor.NewResultSetWithMessage(fmt.Sprintf("savepoint %s released", name)), nil
+}
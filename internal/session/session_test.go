@@ -1,13 +1,19 @@
 package session
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/takeuchi-shogo/go-example-database/internal/catalog"
 	"github.com/takeuchi-shogo/go-example-database/internal/dbtxn"
 	"github.com/takeuchi-shogo/go-example-database/internal/executor"
+	"github.com/takeuchi-shogo/go-example-database/internal/planner"
 	"github.com/takeuchi-shogo/go-example-database/internal/storage"
 )
 
@@ -269,7 +275,7 @@ func TestSessionJoin(t *testing.T) {
 	}
 
 	// JOIN 実行: users.id = orders.user_id
-	result, err := sess.Execute("SELECT * FROM users JOIN orders ON id = user_id")
+	result, err := sess.Execute("SELECT * FROM users JOIN orders ON users.id = user_id")
 	if err != nil {
 		t.Fatalf("SELECT JOIN failed: %v", err)
 	}
@@ -314,7 +320,7 @@ func TestSessionJoinNoMatch(t *testing.T) {
 	}
 
 	// JOIN 実行
-	result, err := sess.Execute("SELECT * FROM users JOIN orders ON id = user_id")
+	result, err := sess.Execute("SELECT * FROM users JOIN orders ON users.id = user_id")
 	if err != nil {
 		t.Fatalf("SELECT JOIN failed: %v", err)
 	}
@@ -699,6 +705,47 @@ func TestSessionBeginRollback(t *testing.T) {
 	if result.GetMessage() != "ROLLBACK transaction successfully" {
 		t.Errorf("Expected 'ROLLBACK transaction successfully', got '%s'", result.GetMessage())
 	}
+
+	// ROLLBACK した INSERT はテーブルに残らない
+	result, err = sess.Execute("SELECT * FROM users")
+	if err != nil {
+		t.Fatalf("SELECT failed: %v", err)
+	}
+	if result.GetRowCount() != 0 {
+		t.Errorf("Expected 0 rows after rollback, got %d", result.GetRowCount())
+	}
+}
+
+func TestSessionRollbackRestoresRows(t *testing.T) {
+	sess, cleanup := setupTestSession(t)
+	defer cleanup()
+
+	for _, sql := range []string{
+		"CREATE TABLE users (id INT PRIMARY KEY, name VARCHAR(255))",
+		"INSERT INTO users (id, name) VALUES (1, 'alice')",
+		"INSERT INTO users (id, name) VALUES (2, 'bob')",
+		"BEGIN",
+		"UPDATE users SET name = 'carol' WHERE id = 1",
+		"DELETE FROM users WHERE id = 2",
+		"INSERT INTO users (id, name) VALUES (2, 'dave')",
+		"ROLLBACK",
+	} {
+		if _, err := sess.Execute(sql); err != nil {
+			t.Fatalf("%s failed: %v", sql, err)
+		}
+	}
+
+	result, err := sess.Execute("SELECT * FROM users WHERE id = 1")
+	if err != nil {
+		t.Fatalf("SELECT failed: %v", err)
+	}
+	if result.GetRowCount() != 1 || result.GetRows()[0].GetValues()[1] != storage.StringValue("alice") {
+		t.Errorf("expected alice to be restored, got %v", result.GetRows())
+	}
+	result, _ = sess.Execute("SELECT * FROM users WHERE id = 2")
+	if result.GetRowCount() != 1 || result.GetRows()[0].GetValues()[1] != storage.StringValue("bob") {
+		t.Errorf("expected bob to be restored, got %v", result.GetRows())
+	}
 }
 
 func TestSessionDoubleBegin(t *testing.T) {
@@ -748,3 +795,1319 @@ func TestSessionRollbackWithoutBegin(t *testing.T) {
 		t.Errorf("Expected 'no transaction to rollback', got '%s'", err.Error())
 	}
 }
+
+func TestSessionStream(t *testing.T) {
+	sess, cleanup := setupTestSession(t)
+	defer cleanup()
+
+	if _, err := sess.Execute("CREATE TABLE users (id INT, name VARCHAR(255))"); err != nil {
+		t.Fatalf("CREATE TABLE failed: %v", err)
+	}
+	for _, sql := range []string{
+		"INSERT INTO users (id, name) VALUES (1, 'alice')",
+		"INSERT INTO users (id, name) VALUES (2, 'bob')",
+	} {
+		if _, err := sess.Execute(sql); err != nil {
+			t.Fatalf("INSERT failed: %v", err)
+		}
+	}
+
+	var streamed []*storage.Row
+	result, err := sess.Stream("SELECT * FROM users", func(row *storage.Row) error {
+		streamed = append(streamed, row)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if len(streamed) != 2 {
+		t.Errorf("Expected 2 streamed rows, got %d", len(streamed))
+	}
+	if result.GetMessage() != "2 rows" {
+		t.Errorf("Expected message '2 rows', got '%s'", result.GetMessage())
+	}
+
+	// SELECT 以外は通常どおり実行される
+	result, err = sess.Stream("INSERT INTO users (id, name) VALUES (3, 'carol')", func(row *storage.Row) error {
+		t.Error("emit should not be called for INSERT")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Stream (INSERT) failed: %v", err)
+	}
+	if result.GetMessage() != "row inserted: users" {
+		t.Errorf("Expected message 'row inserted: users', got '%s'", result.GetMessage())
+	}
+}
+
+func TestSessionIndexes(t *testing.T) {
+	sess, cleanup := setupTestSession(t)
+	defer cleanup()
+
+	mustExec := func(sql string) executor.ResultSet {
+		t.Helper()
+		result, err := sess.Execute(sql)
+		if err != nil {
+			t.Fatalf("%s failed: %v", sql, err)
+		}
+		return result
+	}
+
+	mustExec("CREATE TABLE users (id INT PRIMARY KEY, age INT)")
+	mustExec("INSERT INTO users (id, age) VALUES (1, 30)")
+	mustExec("INSERT INTO users (id, age) VALUES (2, 20)")
+	mustExec("INSERT INTO users (id, age) VALUES (3, 30)")
+
+	// PRIMARY KEY の重複は拒否される
+	if _, err := sess.Execute("INSERT INTO users (id, age) VALUES (1, 40)"); err == nil {
+		t.Error("expected duplicate primary key error")
+	}
+
+	mustExec("CREATE INDEX idx_age ON users (age)")
+	if result := mustExec("SELECT * FROM users WHERE age = 30"); result.GetRowCount() != 2 {
+		t.Errorf("expected 2 rows for age = 30, got %d", result.GetRowCount())
+	}
+	if result := mustExec("SELECT * FROM users WHERE id > 1"); result.GetRowCount() != 2 {
+		t.Errorf("expected 2 rows for id > 1, got %d", result.GetRowCount())
+	}
+
+	// UPDATE / DELETE 後もインデックスから正しい行が引ける
+	mustExec("UPDATE users SET age = 31 WHERE id = 1")
+	if result := mustExec("SELECT * FROM users WHERE age = 30"); result.GetRowCount() != 1 {
+		t.Errorf("expected 1 row for age = 30 after update, got %d", result.GetRowCount())
+	}
+	mustExec("DELETE FROM users WHERE age = 31")
+	if result := mustExec("SELECT * FROM users WHERE id = 1"); result.GetRowCount() != 0 {
+		t.Errorf("expected deleted row to be gone, got %d", result.GetRowCount())
+	}
+	mustExec("INSERT INTO users (id, age) VALUES (1, 50)")
+
+	mustExec("DROP INDEX idx_age")
+	if _, err := sess.Execute("DROP INDEX idx_age"); err == nil {
+		t.Error("expected error when dropping missing index")
+	}
+	if result := mustExec("SELECT * FROM users WHERE age = 50"); result.GetRowCount() != 1 {
+		t.Errorf("expected 1 row for age = 50, got %d", result.GetRowCount())
+	}
+}
+
+func TestSessionAutocommitRollsBackFailedStatement(t *testing.T) {
+	sess, cleanup := setupTestSession(t)
+	defer cleanup()
+
+	for _, sql := range []string{
+		"CREATE TABLE users (id INT PRIMARY KEY, name VARCHAR(255))",
+		"INSERT INTO users (id, name) VALUES (1, 'alice')",
+		"INSERT INTO users (id, name) VALUES (2, 'bob')",
+	} {
+		if _, err := sess.Execute(sql); err != nil {
+			t.Fatalf("%s failed: %v", sql, err)
+		}
+	}
+	// 2行目の更新で主キーが重複して失敗する
+	if _, err := sess.Execute("UPDATE users SET id = 5 WHERE id >= 1"); err == nil {
+		t.Fatal("expected duplicate key error")
+	}
+	// 1行目の更新も取り消されている
+	result, err := sess.Execute("SELECT * FROM users WHERE id = 5")
+	if err != nil {
+		t.Fatalf("SELECT failed: %v", err)
+	}
+	if result.GetRowCount() != 0 {
+		t.Errorf("expected the partial update to be rolled back, got %d rows", result.GetRowCount())
+	}
+	result, _ = sess.Execute("SELECT * FROM users")
+	if result.GetRowCount() != 2 {
+		t.Errorf("expected 2 rows, got %d", result.GetRowCount())
+	}
+}
+
+// setupSharedSessions は同じカタログとトランザクションマネージャーを使う n 個のセッションを作成する
+// セッションは同時に1つの goroutine からしか使えないので、並行に実行する文ごとにセッションを分ける
+func setupSharedSessions(t *testing.T, n int) []Session {
+	t.Helper()
+	tempDir := t.TempDir()
+	cat, err := catalog.NewCatalog(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create catalog: %v", err)
+	}
+	wal, err := dbtxn.NewWAL(filepath.Join(tempDir, "wal.log"))
+	if err != nil {
+		t.Fatalf("Failed to create WAL: %v", err)
+	}
+	tm := dbtxn.NewTxnManagerWithLockManager(wal, cat, dbtxn.NewLockManagerWithTimeout(2*time.Second))
+	sessions := make([]Session, n)
+	for i := range sessions {
+		sessions[i] = NewSessionWithTxnManager(cat, executor.NewExecutor(cat, wal), tm)
+	}
+	t.Cleanup(func() {
+		wal.Close()
+		cat.Close()
+	})
+	return sessions
+}
+
+// executeAsync は別の goroutine で SQL を実行し、結果のエラーを返すチャネルを返す
+func executeAsync(sess Session, sql string) <-chan error {
+	result := make(chan error, 1)
+	go func() {
+		_, err := sess.Execute(sql)
+		result <- err
+	}()
+	return result
+}
+
+// awaitLockWaiters は n 個のトランザクションがロックを待ち始めるまで待つ
+func awaitLockWaiters(t *testing.T, sess Session, n int) {
+	t.Helper()
+	locks := sess.(*session).txnManager.GetLockManager()
+	deadline := time.Now().Add(2 * time.Second)
+	for locks.GetWaitCount() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d transactions waiting for locks, got %d", n, locks.GetWaitCount())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func mustExecute(t *testing.T, sess Session, sqls ...string) {
+	t.Helper()
+	for _, sql := range sqls {
+		if _, err := sess.Execute(sql); err != nil {
+			t.Fatalf("%s failed: %v", sql, err)
+		}
+	}
+}
+
+func TestSessionWriterWaitsForRowLock(t *testing.T) {
+	sessions := setupSharedSessions(t, 3)
+	sess1, sess2, sess3 := sessions[0], sessions[1], sessions[2]
+	mustExecute(t, sess1,
+		"CREATE TABLE users (id INT PRIMARY KEY, name VARCHAR(255))",
+		"INSERT INTO users (id, name) VALUES (1, 'alice')",
+		"INSERT INTO users (id, name) VALUES (2, 'bob')",
+		"BEGIN",
+		"UPDATE users SET name = 'carol' WHERE id = 1",
+	)
+
+	// 同じ行の更新はコミットまで待たされる
+	blocked := executeAsync(sess2, "UPDATE users SET name = 'dave' WHERE id = 1")
+	awaitLockWaiters(t, sess2, 1)
+	select {
+	case err := <-blocked:
+		t.Fatalf("expected UPDATE to wait for the row lock, got %v", err)
+	default:
+	}
+	// 別の行は待たずに更新できる
+	mustExecute(t, sess3, "UPDATE users SET name = 'erin' WHERE id = 2")
+
+	mustExecute(t, sess1, "COMMIT")
+	if err := <-blocked; err != nil {
+		t.Fatalf("UPDATE failed after the lock was released: %v", err)
+	}
+	result, _ := sess1.Execute("SELECT name FROM users WHERE id = 1")
+	if rows := result.GetRows(); len(rows) != 1 || rows[0].GetValues()[0] != storage.StringValue("dave") {
+		t.Errorf("expected the waiting update to apply after commit, got %v", rows)
+	}
+}
+
+func TestSessionDeadlockRollsBackVictim(t *testing.T) {
+	sessions := setupSharedSessions(t, 2)
+	sess1, sess2 := sessions[0], sessions[1]
+	mustExecute(t, sess1,
+		"CREATE TABLE users (id INT PRIMARY KEY, name VARCHAR(255))",
+		"INSERT INTO users (id, name) VALUES (1, 'alice')",
+		"INSERT INTO users (id, name) VALUES (2, 'bob')",
+	)
+	mustExecute(t, sess1, "BEGIN", "UPDATE users SET name = 'carol' WHERE id = 1")
+	mustExecute(t, sess2, "BEGIN", "UPDATE users SET name = 'dave' WHERE id = 2")
+
+	older := executeAsync(sess1, "UPDATE users SET name = 'carol' WHERE id = 2")
+	awaitLockWaiters(t, sess1, 1)
+	// 後から始めたトランザクションが犠牲になり、ロールバックされる
+	_, err := sess2.Execute("UPDATE users SET name = 'dave' WHERE id = 1")
+	if !errors.Is(err, dbtxn.ErrDeadlock) {
+		t.Fatalf("expected ErrDeadlock, got %v", err)
+	}
+	if err := <-older; err != nil {
+		t.Fatalf("surviving transaction failed: %v", err)
+	}
+	if _, err := sess2.Execute("COMMIT"); err == nil {
+		t.Error("victim transaction should already be rolled back")
+	}
+	mustExecute(t, sess1, "COMMIT")
+
+	result, _ := sess2.Execute("SELECT name FROM users")
+	for _, row := range result.GetRows() {
+		if row.GetValues()[0] != storage.StringValue("carol") {
+			t.Errorf("expected only the surviving transaction's updates, got %v", row.GetValues())
+		}
+	}
+}
+
+// queryStrings は1列目が文字列の SELECT の結果を返す
+func queryStrings(t *testing.T, sess Session, sql string) []string {
+	t.Helper()
+	result, err := sess.Execute(sql)
+	if err != nil {
+		t.Fatalf("%s failed: %v", sql, err)
+	}
+	values := make([]string, 0)
+	for _, row := range result.GetRows() {
+		values = append(values, string(row.GetValues()[0].(storage.StringValue)))
+	}
+	return values
+}
+
+func TestSessionSnapshotReadDoesNotBlockWriter(t *testing.T) {
+	sessions := setupSharedSessions(t, 2)
+	reader, writer := sessions[0], sessions[1]
+	mustExecute(t, writer,
+		"CREATE TABLE users (id INT PRIMARY KEY, name VARCHAR(255))",
+		"INSERT INTO users (id, name) VALUES (1, 'alice')",
+		"INSERT INTO users (id, name) VALUES (2, 'bob')",
+	)
+	mustExecute(t, reader, "BEGIN")
+	if names := queryStrings(t, reader, "SELECT name FROM users"); len(names) != 2 {
+		t.Fatalf("expected 2 rows, got %v", names)
+	}
+
+	// 読み取り中のトランザクションがあっても書き込みは待たない
+	mustExecute(t, writer,
+		"BEGIN",
+		"UPDATE users SET name = 'carol' WHERE id = 1",
+		"DELETE FROM users WHERE id = 2",
+		"INSERT INTO users (id, name) VALUES (3, 'dave')",
+	)
+	// 書き込み中の行を読んでも待たず、コミット前の変更は見えない
+	if names := queryStrings(t, reader, "SELECT name FROM users"); len(names) != 2 || names[0] != "alice" || names[1] != "bob" {
+		t.Errorf("expected uncommitted changes to be invisible, got %v", names)
+	}
+	mustExecute(t, writer, "COMMIT")
+
+	// BEGIN の時点のスナップショットを読み続ける（インデックスを使う検索でも同じ）
+	if names := queryStrings(t, reader, "SELECT name FROM users"); len(names) != 2 || names[0] != "alice" || names[1] != "bob" {
+		t.Errorf("expected the snapshot taken at BEGIN, got %v", names)
+	}
+	if names := queryStrings(t, reader, "SELECT name FROM users WHERE id = 2"); len(names) != 1 || names[0] != "bob" {
+		t.Errorf("expected the deleted row through the index, got %v", names)
+	}
+	if names := queryStrings(t, reader, "SELECT name FROM users WHERE id = 3"); len(names) != 0 {
+		t.Errorf("expected the row inserted after BEGIN to be invisible, got %v", names)
+	}
+	mustExecute(t, reader, "COMMIT")
+
+	if names := queryStrings(t, reader, "SELECT name FROM users"); len(names) != 2 || names[0] != "carol" || names[1] != "dave" {
+		t.Errorf("expected committed changes after the transaction ended, got %v", names)
+	}
+}
+
+func TestSessionWriteConflictAbortsAtCommit(t *testing.T) {
+	sessions := setupSharedSessions(t, 2)
+	sess1, sess2 := sessions[0], sessions[1]
+	mustExecute(t, sess1,
+		"CREATE TABLE users (id INT PRIMARY KEY, name VARCHAR(255))",
+		"INSERT INTO users (id, name) VALUES (1, 'alice')",
+	)
+	mustExecute(t, sess1, "BEGIN")
+	mustExecute(t, sess2, "BEGIN", "UPDATE users SET name = 'bob' WHERE id = 1", "COMMIT")
+
+	// sess1 のスナップショットより後にコミットされた行を更新すると、コミットで競合になる
+	mustExecute(t, sess1, "UPDATE users SET name = 'carol' WHERE id = 1")
+	if _, err := sess1.Execute("COMMIT"); !errors.Is(err, dbtxn.ErrWriteConflict) {
+		t.Fatalf("expected ErrWriteConflict, got %v", err)
+	}
+	if names := queryStrings(t, sess1, "SELECT name FROM users"); len(names) != 1 || names[0] != "bob" {
+		t.Errorf("expected the first committer to win, got %v", names)
+	}
+}
+
+func TestSessionOldVersionsAreCollected(t *testing.T) {
+	tempDir := t.TempDir()
+	cat, _ := catalog.NewCatalog(tempDir)
+	wal, _ := dbtxn.NewWAL(filepath.Join(tempDir, "wal.log"))
+	defer wal.Close()
+	defer cat.Close()
+	tm := dbtxn.NewTxnManagerWithCatalog(wal, cat)
+	reader := NewSessionWithTxnManager(cat, executor.NewExecutor(cat, wal), tm)
+	writer := NewSessionWithTxnManager(cat, executor.NewExecutor(cat, wal), tm)
+
+	mustExecute(t, writer,
+		"CREATE TABLE users (id INT PRIMARY KEY, name VARCHAR(255))",
+		"INSERT INTO users (id, name) VALUES (1, 'alice')",
+	)
+	mustExecute(t, reader, "BEGIN")
+	mustExecute(t, writer,
+		"UPDATE users SET name = 'bob' WHERE id = 1",
+		"UPDATE users SET name = 'carol' WHERE id = 1",
+	)
+	// 読み取り中のスナップショットのために古い版が残っている
+	if count := tm.GetVersionStore().GetVersionCount(); count == 0 {
+		t.Fatal("expected old versions to be kept for the open snapshot")
+	}
+	if names := queryStrings(t, reader, "SELECT name FROM users"); len(names) != 1 || names[0] != "alice" {
+		t.Errorf("expected the snapshot to see alice, got %v", names)
+	}
+	mustExecute(t, reader, "COMMIT")
+	if count := tm.GetVersionStore().GetVersionCount(); count != 0 {
+		t.Errorf("expected versions to be collected once no snapshot needs them, got %d", count)
+	}
+}
+
+// isolationLevels は異常のテストで比べる分離レベル
+var isolationLevels = []string{"READ COMMITTED", "REPEATABLE READ", "SERIALIZABLE"}
+
+// setupIsolationSessions は reader の分離レベルを設定し、users に alice と bob を入れる
+func setupIsolationSessions(t *testing.T, level string) (reader, writer Session) {
+	t.Helper()
+	sessions := setupSharedSessions(t, 2)
+	reader, writer = sessions[0], sessions[1]
+	mustExecute(t, writer,
+		"CREATE TABLE users (id INT PRIMARY KEY, name VARCHAR(255))",
+		"INSERT INTO users (id, name) VALUES (1, 'alice')",
+		"INSERT INTO users (id, name) VALUES (2, 'bob')",
+	)
+	mustExecute(t, reader, "SET TRANSACTION ISOLATION LEVEL "+level)
+	return reader, writer
+}
+
+// awaitWriter は書き込みを待ってから読み取り側の続き（読み直してコミットする）を実行する
+// waits なら書き込みがロックを待ち始めたことを確かめ、続きを実行してから書き込みを待つ
+func awaitWriter(t *testing.T, writer Session, result <-chan error, waits bool, rest func()) {
+	t.Helper()
+	if waits {
+		awaitLockWaiters(t, writer, 1)
+		select {
+		case err := <-result:
+			t.Fatalf("expected the writer to wait for the reader, got %v", err)
+		default:
+		}
+		rest()
+	}
+	if err := <-result; err != nil {
+		t.Fatalf("writer failed: %v", err)
+	}
+	if !waits {
+		rest()
+	}
+}
+
+func TestSessionDirtyRead(t *testing.T) {
+	for _, level := range isolationLevels {
+		t.Run(level, func(t *testing.T) {
+			reader, writer := setupIsolationSessions(t, level)
+			mustExecute(t, writer, "BEGIN", "UPDATE users SET name = 'carol' WHERE id = 1")
+			mustExecute(t, reader, "BEGIN")
+
+			// SERIALIZABLE の読み取りは書き込み中のトランザクションが終わるまで待つ
+			// それ以外はスナップショットを読むので、書き込み中のトランザクションが終わる前に読み終える
+			waits := level == "SERIALIZABLE"
+			read := make(chan executor.ResultSet, 1)
+			go func() {
+				result, _ := reader.Execute("SELECT name FROM users WHERE id = 1")
+				read <- result
+			}()
+			var result executor.ResultSet
+			if waits {
+				awaitLockWaiters(t, reader, 1)
+			} else {
+				result = <-read
+			}
+			mustExecute(t, writer, "ROLLBACK")
+			if waits {
+				result = <-read
+			}
+
+			// どの分離レベルでもコミットされていない変更は見えない
+			if result == nil {
+				t.Fatal("SELECT failed")
+			}
+			if rows := result.GetRows(); len(rows) != 1 || rows[0].GetValues()[0] != storage.StringValue("alice") {
+				t.Errorf("expected no dirty read, got %v", rows)
+			}
+			mustExecute(t, reader, "COMMIT")
+		})
+	}
+}
+
+func TestSessionNonRepeatableRead(t *testing.T) {
+	tests := []struct {
+		level  string
+		reread string
+		waits  bool // 書き込みが読み取り側のコミットまで待たされる
+	}{
+		{"READ COMMITTED", "carol", false}, // 文ごとにスナップショットを取り直すので、コミットされた更新が見える
+		{"REPEATABLE READ", "alice", false},
+		{"SERIALIZABLE", "alice", true}, // 読んだテーブルに S ロックが残る
+	}
+	for _, tt := range tests {
+		t.Run(tt.level, func(t *testing.T) {
+			reader, writer := setupIsolationSessions(t, tt.level)
+			mustExecute(t, reader, "BEGIN")
+			if names := queryStrings(t, reader, "SELECT name FROM users WHERE id = 1"); len(names) != 1 || names[0] != "alice" {
+				t.Fatalf("expected alice, got %v", names)
+			}
+
+			updated := executeAsync(writer, "UPDATE users SET name = 'carol' WHERE id = 1")
+			awaitWriter(t, writer, updated, tt.waits, func() {
+				if names := queryStrings(t, reader, "SELECT name FROM users WHERE id = 1"); len(names) != 1 || names[0] != tt.reread {
+					t.Errorf("expected %s on re-read, got %v", tt.reread, names)
+				}
+				mustExecute(t, reader, "COMMIT")
+			})
+		})
+	}
+}
+
+func TestSessionPhantomRead(t *testing.T) {
+	tests := []struct {
+		level string
+		rows  int
+		waits bool
+	}{
+		{"READ COMMITTED", 3, false}, // 同じ条件で読み直すと、挿入された行が現れる
+		{"REPEATABLE READ", 2, false},
+		{"SERIALIZABLE", 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.level, func(t *testing.T) {
+			reader, writer := setupIsolationSessions(t, tt.level)
+			mustExecute(t, reader, "BEGIN")
+			if names := queryStrings(t, reader, "SELECT name FROM users WHERE id > 0"); len(names) != 2 {
+				t.Fatalf("expected 2 rows, got %v", names)
+			}
+
+			inserted := executeAsync(writer, "INSERT INTO users (id, name) VALUES (3, 'carol')")
+			awaitWriter(t, writer, inserted, tt.waits, func() {
+				if names := queryStrings(t, reader, "SELECT name FROM users WHERE id > 0"); len(names) != tt.rows {
+					t.Errorf("expected %d rows on re-read, got %v", tt.rows, names)
+				}
+				mustExecute(t, reader, "COMMIT")
+			})
+		})
+	}
+}
+
+func TestSessionWriteSkew(t *testing.T) {
+	tests := []struct {
+		level   string
+		onCall  int
+		victims int
+	}{
+		// スナップショットは別々の行の更新を競合にしないので、どちらもコミットできて当番がいなくなる
+		{"READ COMMITTED", 0, 0},
+		{"REPEATABLE READ", 0, 0},
+		// 両方が読んだテーブルに書こうとしてデッドロックになり、後から始めたほうがロールバックされる
+		{"SERIALIZABLE", 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.level, func(t *testing.T) {
+			sessions := setupSharedSessions(t, 2)
+			sess1, sess2 := sessions[0], sessions[1]
+			mustExecute(t, sess1,
+				"CREATE TABLE doctors (id INT PRIMARY KEY, name VARCHAR(255), on_call INT)",
+				"INSERT INTO doctors (id, name, on_call) VALUES (1, 'alice', 1)",
+				"INSERT INTO doctors (id, name, on_call) VALUES (2, 'bob', 1)",
+			)
+			// 当番が2人いることを確かめてから、自分を当番から外す
+			for _, sess := range sessions {
+				mustExecute(t, sess, "BEGIN ISOLATION LEVEL "+tt.level)
+				if names := queryStrings(t, sess, "SELECT name FROM doctors WHERE on_call = 1"); len(names) != 2 {
+					t.Fatalf("expected 2 doctors on call, got %v", names)
+				}
+			}
+			// SERIALIZABLE では sess2 が読んだテーブルの S ロックを待つので、待ち始めてから sess2 も更新する
+			// それ以外は待たずに更新を終える
+			waits := tt.victims > 0
+			first := executeAsync(sess1, "UPDATE doctors SET on_call = 0 WHERE id = 1")
+			if waits {
+				awaitLockWaiters(t, sess1, 1)
+			} else if err := <-first; err != nil {
+				t.Fatalf("UPDATE failed: %v", err)
+			}
+			victims := 0
+			if _, err := sess2.Execute("UPDATE doctors SET on_call = 0 WHERE id = 2"); errors.Is(err, dbtxn.ErrDeadlock) {
+				victims++
+			} else if err != nil {
+				t.Fatalf("UPDATE failed: %v", err)
+			} else {
+				mustExecute(t, sess2, "COMMIT")
+			}
+			if waits {
+				if err := <-first; err != nil {
+					t.Fatalf("UPDATE failed: %v", err)
+				}
+			}
+			mustExecute(t, sess1, "COMMIT")
+
+			if victims != tt.victims {
+				t.Errorf("expected %d deadlock victims, got %d", tt.victims, victims)
+			}
+			if names := queryStrings(t, sess1, "SELECT name FROM doctors WHERE on_call = 1"); len(names) != tt.onCall {
+				t.Errorf("expected %d doctors on call, got %v", tt.onCall, names)
+			}
+		})
+	}
+}
+
+func TestSessionSetTransactionInsideTransaction(t *testing.T) {
+	sess, cleanup := setupTestSession(t)
+	defer cleanup()
+	mustExecute(t, sess, "BEGIN")
+	if _, err := sess.Execute("SET TRANSACTION ISOLATION LEVEL SERIALIZABLE"); err == nil {
+		t.Error("expected error when changing the isolation level inside a transaction")
+	}
+	mustExecute(t, sess, "ROLLBACK")
+	if _, err := sess.Execute("SET TRANSACTION ISOLATION LEVEL READ UNCOMMITTED"); !errors.Is(err, dbtxn.ErrUnsupportedIsolationLevel) {
+		t.Errorf("expected ErrUnsupportedIsolationLevel, got %v", err)
+	}
+}
+
+func TestSessionSavepoints(t *testing.T) {
+	sessions := setupSharedSessions(t, 2)
+	sess, other := sessions[0], sessions[1]
+	sortedNames := func(sess Session) []string {
+		names := queryStrings(t, sess, "SELECT name FROM users")
+		slices.Sort(names)
+		return names
+	}
+	mustExecute(t, sess,
+		"CREATE TABLE users (id INT PRIMARY KEY, name VARCHAR(255))",
+		"BEGIN",
+		"INSERT INTO users (id, name) VALUES (1, 'alice')",
+		"SAVEPOINT outer_sp",
+		"INSERT INTO users (id, name) VALUES (2, 'bob')",
+		"SAVEPOINT inner_sp",
+		"UPDATE users SET name = 'carol' WHERE id = 1",
+		"DELETE FROM users WHERE id = 2",
+		"ROLLBACK TO SAVEPOINT inner_sp",
+	)
+	if names := sortedNames(sess); len(names) != 2 || names[0] != "alice" || names[1] != "bob" {
+		t.Fatalf("expected the state at inner_sp, got %v", names)
+	}
+
+	mustExecute(t, sess, "ROLLBACK TO outer_sp")
+	if names := sortedNames(sess); len(names) != 1 || names[0] != "alice" {
+		t.Fatalf("expected the state at outer_sp, got %v", names)
+	}
+	// inner_sp は outer_sp まで戻したときに消えている
+	if _, err := sess.Execute("ROLLBACK TO inner_sp"); !errors.Is(err, dbtxn.ErrSavepointNotFound) {
+		t.Errorf("expected ErrSavepointNotFound, got %v", err)
+	}
+	// トランザクションは続いていて、取り消した行の主キーを使い直せる
+	mustExecute(t, sess,
+		"INSERT INTO users (id, name) VALUES (2, 'dave')",
+		"RELEASE SAVEPOINT outer_sp",
+		"COMMIT",
+	)
+	if names := sortedNames(other); len(names) != 2 || names[0] != "alice" || names[1] != "dave" {
+		t.Errorf("expected alice and dave after commit, got %v", names)
+	}
+
+	if _, err := sess.Execute("SAVEPOINT sp"); err == nil {
+		t.Error("expected error for SAVEPOINT outside a transaction")
+	}
+}
+
+func TestSessionNumericAndTemporalTypes(t *testing.T) {
+	sess := setupSharedSessions(t, 1)[0]
+	mustExecute(t, sess,
+		"CREATE TABLE orders (id INT PRIMARY KEY, qty BIGINT, ratio FLOAT, score DOUBLE, price DECIMAL(8,2), day DATE, at TIME, created TIMESTAMP)",
+		"CREATE INDEX idx_price ON orders (price)",
+		"INSERT INTO orders (id, qty, ratio, score, price, day, at, created) VALUES (1, 10, 0.5, 1e3, 19.99, DATE '2024-01-31', TIME '09:30:00', TIMESTAMP '2024-01-31 09:30:00')",
+		"INSERT INTO orders (id, qty, ratio, score, price, day, at, created) VALUES (2, 20, 0.25, 2.5e2, 5, '2024-02-01', '18:00:00', '2024-02-01 18:00:00')",
+		"INSERT INTO orders (id, qty, ratio, score, price, day, at, created) VALUES (3, 30, 1.5, 2e0, 0.015, '2024-02-29', '00:00:01', '2024-02-29')",
+	)
+
+	result, err := sess.Execute("SELECT * FROM orders WHERE id = 3")
+	if err != nil {
+		t.Fatalf("SELECT failed: %v", err)
+	}
+	row := result.GetRows()[0].GetValues()
+	expected := []string{"3", "30", "1.5", "2", "0.02", "2024-02-29", "00:00:01", "2024-02-29 00:00:00"}
+	for i, want := range expected {
+		if got := storage.FormatValue(row[i]); got != want {
+			t.Errorf("column %d: expected %s, got %s", i, want, got)
+		}
+	}
+
+	// 型の違う値とも値で比べる
+	conditions := map[string]int{
+		"price = 5":                          1,
+		"price = 19.990":                     1,
+		"price > 4.99":                       2,
+		"score >= 250":                       2,
+		"ratio < 1":                          2,
+		"day = '2024-02-01'":                 1,
+		"day >= DATE '2024-02-01'":           2,
+		"at < TIME '12:00:00'":               2,
+		"created > TIMESTAMP '2024-02-01'":   2,
+		"created < DATE '2024-02-01'":        1,
+		"qty > 10 AND price < 10":            2,
+		"day > TIMESTAMP '2024-01-31 12:00'": 2,
+	}
+	for where, want := range conditions {
+		result, err := sess.Execute("SELECT * FROM orders WHERE " + where)
+		if err != nil {
+			t.Fatalf("WHERE %s failed: %v", where, err)
+		}
+		if got := len(result.GetRows()); got != want {
+			t.Errorf("WHERE %s: expected %d rows, got %d", where, want, got)
+		}
+	}
+
+	aggregates := map[string]string{
+		"SUM(qty)":     "60",
+		"AVG(qty)":     "20",
+		"SUM(price)":   "25.01",
+		"AVG(price)":   "8.336667",
+		"SUM(score)":   "1252",
+		"AVG(ratio)":   "0.75",
+		"MAX(price)":   "19.99",
+		"MIN(day)":     "2024-01-31",
+		"MAX(created)": "2024-02-29 00:00:00",
+	}
+	for agg, want := range aggregates {
+		result, err := sess.Execute("SELECT " + agg + " FROM orders")
+		if err != nil {
+			t.Fatalf("%s failed: %v", agg, err)
+		}
+		if got := storage.FormatValue(result.GetRows()[0].GetValues()[0]); got != want {
+			t.Errorf("%s: expected %s, got %s", agg, want, got)
+		}
+	}
+
+	mustExecute(t, sess, "UPDATE orders SET price = 7.125 WHERE id = 2")
+	result, err = sess.Execute("SELECT * FROM orders WHERE price = 7.13")
+	if err != nil || len(result.GetRows()) != 1 {
+		t.Errorf("expected the updated price to be rounded to the column scale, got %v (%v)", result, err)
+	}
+
+	for _, sql := range []string{
+		"INSERT INTO orders (id, qty, ratio, score, price, day, at, created) VALUES (4, 1, 1, 1, 1234567.1, '2024-01-01', '00:00', '2024-01-01')",
+		"INSERT INTO orders (id, qty, ratio, score, price, day, at, created) VALUES (4, 1, 1, 1, 1, '2024-02-30', '00:00', '2024-01-01')",
+		"INSERT INTO orders (id, qty, ratio, score, price, day, at, created) VALUES (4, 1, 1, 1, 1, '2024-01-01', '00:00')",
+	} {
+		if _, err := sess.Execute(sql); err == nil {
+			t.Errorf("%s: expected an error", sql)
+		}
+	}
+}
+
+func TestSessionTextAndBlobTypes(t *testing.T) {
+	sess := setupSharedSessions(t, 1)[0]
+	long := strings.Repeat("0123456789", 10000) // 1ページに収まらない長さ
+	mustExecute(t, sess,
+		"CREATE TABLE documents (id INT PRIMARY KEY, title VARCHAR(255), body TEXT, data BLOB NULL)",
+		"INSERT INTO documents (id, title, body, data) VALUES (1, 'long', '"+long+"', 'raw')",
+		"INSERT INTO documents (id, title, body, data) VALUES (2, 'short', 'hello', '')",
+	)
+
+	result, err := sess.Execute("SELECT * FROM documents WHERE id = 1")
+	if err != nil {
+		t.Fatalf("SELECT failed: %v", err)
+	}
+	row := result.GetRows()[0].GetValues()
+	if row[2] != storage.TextValue(long) || row[3] != storage.BlobValue("raw") {
+		t.Errorf("unexpected values: %d bytes, %v", len(storage.FormatValue(row[2])), row[3])
+	}
+	result, err = sess.Execute("SELECT * FROM documents WHERE body = 'hello'")
+	if err != nil || len(result.GetRows()) != 1 {
+		t.Errorf("expected TEXT to compare with a string literal, got %v (%v)", result, err)
+	}
+
+	mustExecute(t, sess,
+		"UPDATE documents SET body = 'replaced' WHERE id = 1",
+		"DELETE FROM documents WHERE id = 2",
+	)
+	result, err = sess.Execute("SELECT * FROM documents")
+	if err != nil || len(result.GetRows()) != 1 || result.GetRows()[0].GetValues()[2] != storage.TextValue("replaced") {
+		t.Errorf("unexpected rows after UPDATE and DELETE: %v (%v)", result, err)
+	}
+
+	if _, err := sess.Execute("INSERT INTO documents (id, title, body, data) VALUES (3, '" + strings.Repeat("a", storage.MaxVarcharLength+1) + "', '', '')"); !errors.Is(err, storage.ErrValueOutOfRange) {
+		t.Errorf("expected ErrValueOutOfRange for a long VARCHAR, got %v", err)
+	}
+}
+
+func TestSessionNullSemantics(t *testing.T) {
+	sess := setupSharedSessions(t, 1)[0]
+	mustExecute(t, sess,
+		"CREATE TABLE people (id INT PRIMARY KEY, name VARCHAR(255) NOT NULL, age INT, email VARCHAR(255))",
+		"INSERT INTO people (id, name, age, email) VALUES (1, 'alice', 30, 'alice@example.com')",
+		"INSERT INTO people (id, name, age, email) VALUES (2, 'bob', NULL, NULL)",
+		"INSERT INTO people (id, name, age, email) VALUES (3, 'carol', 20, NULL)",
+	)
+
+	// NULL との比較は不明なので、どちらの条件にも当てはまらない
+	conditions := map[string]int{
+		"age > 25":                       1,
+		"age <= 25":                      1,
+		"age = NULL":                     0,
+		"age <> NULL":                    0,
+		"age IS NULL":                    1,
+		"age IS NOT NULL":                2,
+		"email IS NULL":                  2,
+		"age > 25 OR email IS NULL":      3,
+		"age > 100 OR age < 100":         2,
+		"email IS NULL AND age IS NULL":  1,
+		"age IS NULL OR age IS NOT NULL": 3,
+	}
+	for where, want := range conditions {
+		result, err := sess.Execute("SELECT * FROM people WHERE " + where)
+		if err != nil {
+			t.Fatalf("WHERE %s failed: %v", where, err)
+		}
+		if got := len(result.GetRows()); got != want {
+			t.Errorf("WHERE %s: expected %d rows, got %d", where, want, got)
+		}
+	}
+
+	// 集約関数は NULL を飛ばす
+	aggregates := map[string]string{
+		"COUNT(*)":     "3",
+		"COUNT(age)":   "2",
+		"COUNT(email)": "1",
+		"SUM(age)":     "50",
+		"AVG(age)":     "25",
+		"MIN(age)":     "20",
+		"MAX(email)":   "alice@example.com",
+	}
+	for agg, want := range aggregates {
+		result, err := sess.Execute("SELECT " + agg + " FROM people")
+		if err != nil {
+			t.Fatalf("%s failed: %v", agg, err)
+		}
+		if got := storage.FormatValue(result.GetRows()[0].GetValues()[0]); got != want {
+			t.Errorf("%s: expected %s, got %s", agg, want, got)
+		}
+	}
+	result, err := sess.Execute("SELECT SUM(age) FROM people WHERE age IS NULL")
+	if err != nil || result.GetRows()[0].GetValues()[0] != nil {
+		t.Errorf("expected SUM of only NULLs to be NULL, got %v (%v)", result, err)
+	}
+
+	// NOT NULL 制約
+	if _, err := sess.Execute("INSERT INTO people (id, name, age, email) VALUES (4, NULL, 1, NULL)"); !errors.Is(err, executor.ErrNotNullViolation) {
+		t.Errorf("expected ErrNotNullViolation on INSERT, got %v", err)
+	}
+	if _, err := sess.Execute("UPDATE people SET name = NULL WHERE id = 1"); !errors.Is(err, executor.ErrNotNullViolation) {
+		t.Errorf("expected ErrNotNullViolation on UPDATE, got %v", err)
+	}
+	mustExecute(t, sess, "UPDATE people SET email = NULL WHERE id = 1")
+	result, err = sess.Execute("SELECT * FROM people WHERE email IS NOT NULL")
+	if err != nil || len(result.GetRows()) != 0 {
+		t.Errorf("expected no rows with an email after UPDATE, got %v (%v)", result, err)
+	}
+}
+
+func TestSessionArithmeticExpressions(t *testing.T) {
+	sess := setupSharedSessions(t, 1)[0]
+	mustExecute(t, sess,
+		"CREATE TABLE orders (id INT PRIMARY KEY, price DECIMAL(10,2), qty INT)",
+		"INSERT INTO orders (id, price, qty) VALUES (1, 10.50, 2)",
+		"INSERT INTO orders (id, price, qty) VALUES (2, 3.25, -1 + 5)",
+		"INSERT INTO orders (id, price, qty) VALUES (3, NULL, 1)",
+	)
+
+	result, err := sess.Execute("SELECT id, price * qty AS total, -qty, qty * 2 + 1 FROM orders WHERE qty * 2 > 1 + 2")
+	if err != nil {
+		t.Fatalf("SELECT failed: %v", err)
+	}
+	var names []string
+	for _, col := range result.GetSchema().GetColumns() {
+		names = append(names, col.GetName())
+	}
+	if want := []string{"id", "total", "(-qty)", "((qty * 2) + 1)"}; !slices.Equal(names, want) {
+		t.Errorf("expected columns %v, got %v", want, names)
+	}
+	if result.GetSchema().GetColumns()[1].GetColumnType() != storage.ColumnTypeDecimal {
+		t.Errorf("expected total to be DECIMAL, got %v", result.GetSchema().GetColumns()[1].GetColumnType())
+	}
+	expected := [][]string{
+		{"1", "21.00", "-2", "5"},
+		{"2", "13.00", "-4", "9"},
+	}
+	rows := result.GetRows()
+	if len(rows) != len(expected) {
+		t.Fatalf("expected %d rows, got %d", len(expected), len(rows))
+	}
+	for i, row := range rows {
+		for j, value := range row.GetValues() {
+			if got := storage.FormatValue(value); got != expected[i][j] {
+				t.Errorf("row %d column %d: expected %s, got %s", i, j, expected[i][j], got)
+			}
+		}
+	}
+
+	// SET 句の式は更新前の行で評価する
+	mustExecute(t, sess, "UPDATE orders SET qty = qty + 1, price = price * 2 WHERE id <> 2")
+	// 更新した行は移動することがあるので id で照合する
+	result, err = sess.Execute("SELECT id, qty, price FROM orders")
+	if err != nil {
+		t.Fatalf("SELECT failed: %v", err)
+	}
+	want := map[string]string{"1": "3 21.00", "2": "4 3.25", "3": "2 NULL"}
+	for _, row := range result.GetRows() {
+		values := row.GetValues()
+		id := storage.FormatValue(values[0])
+		if got := storage.FormatValue(values[1]) + " " + storage.FormatValue(values[2]); got != want[id] {
+			t.Errorf("after UPDATE id %s: expected %s, got %s", id, want[id], got)
+		}
+	}
+
+	// % は * や / と同じ強さで左から結び付く
+	result, err = sess.Execute("SELECT qty % 2, price % 4 * 2 FROM orders WHERE id = 1")
+	if err != nil {
+		t.Fatalf("SELECT with %% failed: %v", err)
+	}
+	values := result.GetRows()[0].GetValues()
+	if got := storage.FormatValue(values[0]) + " " + storage.FormatValue(values[1]); got != "1 2.00" {
+		t.Errorf("expected 1 2.00, got %s", got)
+	}
+	// 0 で割るとエラーになる（NULL の行は NULL のまま）
+	for _, query := range []string{
+		"SELECT qty / 0 FROM orders",
+		"SELECT price % (qty - qty) FROM orders",
+		"SELECT MOD(qty, 0) FROM orders",
+	} {
+		if _, err := sess.Execute(query); !errors.Is(err, storage.ErrDivisionByZero) {
+			t.Errorf("%s: expected ErrDivisionByZero, got %v", query, err)
+		}
+	}
+}
+
+func TestSessionScalarFunctions(t *testing.T) {
+	sess := setupSharedSessions(t, 1)[0]
+	mustExecute(t, sess,
+		"CREATE TABLE events (id INT PRIMARY KEY, title VARCHAR(255), price DECIMAL(10,2), held DATE, note TEXT)",
+		"INSERT INTO events (id, title, price, held, note) VALUES (1, '  Go Meetup ', 12.345, DATE '2024-03-15', NULL)",
+		"INSERT INTO events (id, title, price, held, note) VALUES (2, 'db night', -4.50, DATE '2023-12-01', 'free drinks')",
+	)
+
+	result, err := sess.Execute("SELECT UPPER(TRIM(title)) AS name, ROUND(price, 1), ABS(price), YEAR(held), COALESCE(note, 'none'), CAST(id AS VARCHAR(10)) FROM events WHERE LENGTH(title) > 8")
+	if err != nil {
+		t.Fatalf("SELECT failed: %v", err)
+	}
+	expected := [][]string{
+		{"GO MEETUP", "12.4", "12.35", "2024", "none", "1"},
+	}
+	rows := result.GetRows()
+	if len(rows) != len(expected) {
+		t.Fatalf("expected %d rows, got %d", len(expected), len(rows))
+	}
+	for i, row := range rows {
+		for j, value := range row.GetValues() {
+			if got := storage.FormatValue(value); got != expected[i][j] {
+				t.Errorf("row %d column %d: expected %s, got %s", i, j, expected[i][j], got)
+			}
+		}
+	}
+	if name := result.GetSchema().GetColumns()[0].GetName(); name != "name" {
+		t.Errorf("expected column name, got %s", name)
+	}
+
+	mustExecute(t, sess, "UPDATE events SET title = CONCAT(UPPER(SUBSTR(title, 1, 1)), SUBSTR(title, 2)) WHERE id = 2")
+	result, err = sess.Execute("SELECT title FROM events WHERE id = 2")
+	if err != nil || storage.FormatValue(result.GetRows()[0].GetValues()[0]) != "Db night" {
+		t.Errorf("UPDATE with functions = %v, %v", result, err)
+	}
+
+	// CAST は DECIMAL の小数部を四捨五入して整数にし、MOD は DECIMAL のまま計算する
+	result, err = sess.Execute("SELECT CAST(price AS INT), CAST(price AS BIGINT), CAST(CAST(price AS DOUBLE) AS INT), MOD(price, 0.3) FROM events WHERE id = 1")
+	if err != nil {
+		t.Fatalf("SELECT CAST failed: %v", err)
+	}
+	for i, want := range []string{"12", "12", "12", "0.05"} {
+		if got := storage.FormatValue(result.GetRows()[0].GetValues()[i]); got != want {
+			t.Errorf("column %d: expected %s, got %s", i, want, got)
+		}
+	}
+
+	// 関数名と引数の位置をエラーに含める
+	_, err = sess.Execute("SELECT UPPER(price) FROM events")
+	if err == nil || !strings.Contains(err.Error(), "UPPER argument 1 must be a string") {
+		t.Errorf("expected a typed argument error, got %v", err)
+	}
+	if _, err := sess.Execute("SELECT NOPE(id) FROM events"); err == nil || !strings.Contains(err.Error(), "unknown function: NOPE") {
+		t.Errorf("expected an unknown function error, got %v", err)
+	}
+}
+
+func TestSessionPredicates(t *testing.T) {
+	sess := setupSharedSessions(t, 1)[0]
+	mustExecute(t, sess,
+		"CREATE TABLE people (id INT PRIMARY KEY, name VARCHAR(255), age INT)",
+		"CREATE INDEX idx_people_age ON people (age)",
+		"INSERT INTO people (id, name, age) VALUES (1, 'alice', 30)",
+		"INSERT INTO people (id, name, age) VALUES (2, 'bob', NULL)",
+		"INSERT INTO people (id, name, age) VALUES (3, 'carol_100%', 20)",
+		"INSERT INTO people (id, name, age) VALUES (4, 'dave', 45)",
+	)
+
+	conditions := map[string][]int{
+		"name LIKE 'a%'":                  {1},
+		"name LIKE '_o_'":                 {2},
+		"name NOT LIKE '%a%'":             {2},
+		"name LIKE '%!%' ESCAPE '!'":      {3},
+		"name LIKE '%!_%' ESCAPE '!'":     {3},
+		"age IN (20, 45)":                 {3, 4},
+		"age NOT IN (20, 45)":             {1},
+		"age NOT IN (20, NULL)":           {},
+		"age BETWEEN 20 AND 30":           {1, 3},
+		"age NOT BETWEEN 20 AND 30":       {4},
+		"NOT age > 25":                    {3},
+		"NOT (age > 25 OR id = 3)":        {},
+		"NOT age IS NULL AND id IN (1,2)": {1},
+	}
+	for where, want := range conditions {
+		result, err := sess.Execute("SELECT id FROM people WHERE " + where)
+		if err != nil {
+			t.Fatalf("WHERE %s failed: %v", where, err)
+		}
+		var got []int
+		for _, row := range result.GetRows() {
+			got = append(got, int(row.GetValues()[0].(storage.Int32Value)))
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, want) {
+			t.Errorf("WHERE %s: expected %v, got %v", where, want, got)
+		}
+	}
+}
+
+func TestSessionSubqueries(t *testing.T) {
+	sess := setupSharedSessions(t, 1)[0]
+	mustExecute(t, sess,
+		"CREATE TABLE users (id INT PRIMARY KEY, name VARCHAR(255), age INT)",
+		"CREATE TABLE orders (id INT PRIMARY KEY, user_id INT, amount INT)",
+		"INSERT INTO users (id, name, age) VALUES (1, 'alice', 30)",
+		"INSERT INTO users (id, name, age) VALUES (2, 'bob', NULL)",
+		"INSERT INTO users (id, name, age) VALUES (3, 'carol', 20)",
+		"INSERT INTO users (id, name, age) VALUES (4, 'dave', 45)",
+		"INSERT INTO orders (id, user_id, amount) VALUES (1, 1, 100)",
+		"INSERT INTO orders (id, user_id, amount) VALUES (2, 1, 250)",
+		"INSERT INTO orders (id, user_id, amount) VALUES (3, 3, 80)",
+		"INSERT INTO orders (id, user_id, amount) VALUES (4, NULL, 50)",
+	)
+
+	conditions := map[string][]int{
+		// 相関サブクエリはセミ結合・反結合になる
+		"EXISTS (SELECT * FROM orders WHERE orders.user_id = users.id)":                    {1, 3},
+		"NOT EXISTS (SELECT * FROM orders WHERE orders.user_id = users.id)":                {2, 4},
+		"EXISTS (SELECT * FROM orders WHERE user_id = users.id AND amount > 200)":          {1},
+		"EXISTS (SELECT * FROM orders WHERE orders.id = users.id AND orders.amount > 90)":  {1, 2},
+		"id IN (SELECT orders.user_id FROM orders WHERE orders.amount > users.age)":        {1, 3},
+		"id IN (SELECT user_id FROM orders)":                                               {1, 3},
+		"id NOT IN (SELECT user_id FROM orders)":                                           {},
+		"id NOT IN (SELECT user_id FROM orders WHERE user_id IS NOT NULL)":                 {2, 4},
+		"id IN (SELECT id FROM users WHERE age > 25)":                                      {1, 4},
+		"age > 25 AND id IN (SELECT user_id FROM orders)":                                  {1},
+		"id IN (SELECT user_id FROM orders WHERE amount IN (SELECT amount FROM orders))":   {1, 3},
+		"NOT EXISTS (SELECT * FROM orders WHERE orders.user_id = users.id AND amount < 0)": {1, 2, 3, 4},
+		// 相関のないサブクエリは一度だけ実行して値として使う
+		"age > (SELECT AVG(age) FROM users)":                          {4},
+		"age = (SELECT MIN(age) FROM users) OR id = 2":                {2, 3},
+		"EXISTS (SELECT * FROM orders WHERE amount > 1000) OR id = 1": {1},
+		"id = (SELECT user_id FROM orders WHERE amount > 1000)":       {},
+		"id IN (SELECT user_id FROM orders) OR age IS NULL":           {1, 2, 3},
+	}
+	for where, want := range conditions {
+		result, err := sess.Execute("SELECT id FROM users WHERE " + where)
+		if err != nil {
+			t.Fatalf("WHERE %s failed: %v", where, err)
+		}
+		got := []int{}
+		for _, row := range result.GetRows() {
+			got = append(got, int(row.GetValues()[0].(storage.Int32Value)))
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, want) {
+			t.Errorf("WHERE %s: expected %v, got %v", where, want, got)
+		}
+	}
+
+	// FROM 句のサブクエリ（派生テーブル）
+	queries := map[string][]string{
+		"SELECT big.user_id FROM (SELECT user_id, amount FROM orders WHERE amount > 90) AS big WHERE big.amount < 200": {"1"},
+		"SELECT t.name FROM (SELECT name, age FROM users) t WHERE t.age >= 30":                                         {"alice", "dave"},
+		"SELECT id, (SELECT COUNT(*) FROM orders) AS n FROM users WHERE id = 1":                                        {"1", "4"},
+		"SELECT COUNT(*) FROM (SELECT * FROM users WHERE id IN (SELECT user_id FROM orders)) AS buyers":                {"2"},
+	}
+	for query, want := range queries {
+		result, err := sess.Execute(query)
+		if err != nil {
+			t.Fatalf("%s failed: %v", query, err)
+		}
+		var got []string
+		for _, row := range result.GetRows() {
+			for _, value := range row.GetValues() {
+				got = append(got, storage.FormatValue(value))
+			}
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, want) {
+			t.Errorf("%s: expected %v, got %v", query, want, got)
+		}
+	}
+
+	errorCases := map[string]error{
+		"SELECT id FROM users WHERE id = (SELECT user_id FROM orders)":                                    planner.ErrSubqueryRows,
+		"SELECT id FROM users WHERE id IN (SELECT id, amount FROM orders)":                                planner.ErrSubqueryColumns,
+		"SELECT id FROM users WHERE age = (SELECT amount FROM orders WHERE orders.user_id = users.id)":    planner.ErrCorrelatedSubquery,
+		"SELECT id FROM users WHERE EXISTS (SELECT COUNT(*) FROM orders WHERE orders.user_id = users.id)": planner.ErrCorrelatedSubquery,
+	}
+	for query, want := range errorCases {
+		if _, err := sess.Execute(query); !errors.Is(err, want) {
+			t.Errorf("%s: expected %v, got %v", query, want, err)
+		}
+	}
+}
+
+func TestSessionJoins(t *testing.T) {
+	sess := setupSharedSessions(t, 1)[0]
+	mustExecute(t, sess,
+		"CREATE TABLE users (id INT PRIMARY KEY, name VARCHAR(255), manager_id INT)",
+		"CREATE TABLE orders (id INT PRIMARY KEY, user_id INT, item_id INT)",
+		"CREATE TABLE items (item_id INT PRIMARY KEY, title VARCHAR(255))",
+		"INSERT INTO users (id, name, manager_id) VALUES (1, 'alice', NULL)",
+		"INSERT INTO users (id, name, manager_id) VALUES (2, 'bob', 1)",
+		"INSERT INTO users (id, name, manager_id) VALUES (3, 'carol', 1)",
+		"INSERT INTO orders (id, user_id, item_id) VALUES (1, 1, 10)",
+		"INSERT INTO orders (id, user_id, item_id) VALUES (2, 2, 20)",
+		"INSERT INTO orders (id, user_id, item_id) VALUES (3, 9, 10)",
+		"INSERT INTO items (item_id, title) VALUES (10, 'pen')",
+		"INSERT INTO items (item_id, title) VALUES (20, 'ink')",
+		"INSERT INTO items (item_id, title) VALUES (30, 'pad')",
+		"CREATE TABLE stock (item_id INT, qty INT)",
+		"INSERT INTO stock (item_id, qty) VALUES (20, 5)",
+		"INSERT INTO stock (item_id, qty) VALUES (40, 7)",
+	)
+
+	// 行ごとに値を "," でつないで比べる
+	queries := map[string][]string{
+		// USING のカラムは1つにまとめ、外部結合では相手のない行も値を持つ
+		"SELECT * FROM items i LEFT JOIN stock s USING (item_id)":                                             {"10,pen,NULL", "20,ink,5", "30,pad,NULL"},
+		"SELECT * FROM items RIGHT JOIN stock USING (item_id)":                                                {"20,ink,5", "40,NULL,7"},
+		"SELECT * FROM items FULL OUTER JOIN stock USING (item_id)":                                           {"10,pen,NULL", "20,ink,5", "30,pad,NULL", "40,NULL,7"},
+		"SELECT item_id, i.item_id, s.item_id FROM items i FULL JOIN stock s USING (item_id)":                 {"10,10,NULL", "20,20,20", "30,30,NULL", "40,NULL,40"},
+		"SELECT item_id FROM items i FULL JOIN stock s USING (item_id) WHERE i.item_id IS NULL":               {"40"},
+		"SELECT COUNT(item_id) FROM items FULL JOIN stock USING (item_id)":                                    {"4"},
+		"SELECT o.id, item_id, qty FROM orders o JOIN items USING (item_id) RIGHT JOIN stock USING (item_id)": {"2,20,5", "NULL,40,7"},
+		// 3つのテーブルを別名で結合する
+		"SELECT u.name, i.title FROM users AS u JOIN orders o ON o.user_id = u.id JOIN items i ON i.item_id = o.item_id": {"alice,pen", "bob,ink"},
+		// 同じテーブルを別名で結合する
+		"SELECT e.name, m.name FROM users e JOIN users m ON e.manager_id = m.id": {"bob,alice", "carol,alice"},
+		// 外部結合は相手のない行のカラムを NULL にする
+		"SELECT u.name, o.id FROM users u LEFT JOIN orders o ON o.user_id = u.id":                    {"alice,1", "bob,2", "carol,NULL"},
+		"SELECT u.name, o.id FROM users u RIGHT OUTER JOIN orders o ON o.user_id = u.id":             {"NULL,3", "alice,1", "bob,2"},
+		"SELECT u.name, o.id FROM users u FULL JOIN orders o ON o.user_id = u.id":                    {"NULL,3", "alice,1", "bob,2", "carol,NULL"},
+		"SELECT i.title FROM items i LEFT JOIN orders o ON o.item_id = i.item_id WHERE o.id IS NULL": {"pad"},
+		"SELECT u.name FROM users u LEFT JOIN orders o ON o.user_id = u.id WHERE u.id > 1":           {"bob", "carol"},
+		"SELECT e.name, m.name FROM users e LEFT JOIN users m ON e.manager_id = m.id":                {"alice,NULL", "bob,alice", "carol,alice"},
+		// CROSS JOIN と USING
+		"SELECT COUNT(*) FROM users CROSS JOIN items":                           {"9"},
+		"SELECT o.id, items.title FROM orders o JOIN items USING (item_id)":     {"1,pen", "2,ink", "3,pen"},
+		"SELECT o.id, i.title FROM orders o RIGHT JOIN items i USING (item_id)": {"1,pen", "2,ink", "3,pen", "NULL,pad"},
+		// 同じ名前のカラムはテーブル名で区別する（カンマは CROSS JOIN）
+		"SELECT users.id, orders.id FROM users, orders WHERE orders.user_id = users.id":   {"1,1", "2,2"},
+		"SELECT u.id, o.id, o.user_id FROM users u, orders o WHERE o.id = 3 AND u.id = 2": {"2,3,9"},
+	}
+	for query, want := range queries {
+		result, err := sess.Execute(query)
+		if err != nil {
+			t.Fatalf("%s failed: %v", query, err)
+		}
+		var got []string
+		for _, row := range result.GetRows() {
+			values := make([]string, len(row.GetValues()))
+			for i, value := range row.GetValues() {
+				values[i] = storage.FormatValue(value)
+			}
+			got = append(got, strings.Join(values, ","))
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, want) {
+			t.Errorf("%s: expected %v, got %v", query, want, got)
+		}
+	}
+
+	for _, query := range []string{
+		"SELECT * FROM users u JOIN orders o ON o.user_id = users.id",
+		"SELECT * FROM users JOIN orders USING (title)",
+		// 修飾子のテーブルがない、または複数のテーブルにあるカラムは参照できない
+		"SELECT zz.id FROM users",
+		"SELECT zz.id FROM users WHERE zz.id = 1",
+		"SELECT id FROM users, orders",
+		"SELECT * FROM users u JOIN orders o ON id = user_id",
+		"SELECT name FROM users u JOIN orders o ON o.user_id = u.id ORDER BY id",
+	} {
+		if _, err := sess.Execute(query); err == nil {
+			t.Errorf("%s: expected error", query)
+		}
+	}
+}
+
+func TestSessionHashJoin(t *testing.T) {
+	sess := setupSharedSessions(t, 1)[0]
+	mustExecute(t, sess,
+		"CREATE TABLE users (id INT PRIMARY KEY, name VARCHAR(255))",
+		"CREATE TABLE orders (id INT PRIMARY KEY, user_id INT, amount INT)",
+	)
+	// 入れ子ループ（40 * 80 行）よりハッシュ結合が安くなる行数にする
+	for i := 1; i <= 40; i++ {
+		mustExecute(t, sess, fmt.Sprintf("INSERT INTO users (id, name) VALUES (%d, 'user%d')", i, i))
+	}
+	for i := 1; i <= 80; i++ {
+		// user_id は 1〜20 と NULL（id が 80 の行）
+		userID := fmt.Sprint(i%20 + 1)
+		if i == 80 {
+			userID = "NULL"
+		}
+		mustExecute(t, sess, fmt.Sprintf("INSERT INTO orders (id, user_id, amount) VALUES (%d, %s, %d)", i, userID, i))
+	}
+
+	queries := map[string]string{
+		"SELECT COUNT(*) FROM users u JOIN orders o ON o.user_id = u.id":                                 "79",
+		"SELECT SUM(amount) FROM users u JOIN orders o ON o.user_id = u.id AND o.amount > 40":            "2340",
+		"SELECT COUNT(*) FROM users u LEFT JOIN orders o ON o.user_id = u.id":                            "99",
+		"SELECT COUNT(*) FROM users u LEFT JOIN orders o ON o.user_id = u.id WHERE o.id IS NULL":         "20",
+		"SELECT COUNT(*) FROM users u FULL JOIN orders o ON o.user_id = u.id":                            "100",
+		"SELECT COUNT(*) FROM users WHERE EXISTS (SELECT * FROM orders WHERE orders.user_id = users.id)": "20",
+	}
+	for query, want := range queries {
+		result, err := sess.Execute(query)
+		if err != nil {
+			t.Fatalf("%s failed: %v", query, err)
+		}
+		if got := storage.FormatValue(result.GetRows()[0].GetValues()[0]); got != want {
+			t.Errorf("%s: expected %s, got %s", query, want, got)
+		}
+	}
+}
+
+func TestSessionAnalyze(t *testing.T) {
+	sess := setupSharedSessions(t, 1)[0]
+	mustExecute(t, sess,
+		"CREATE TABLE customers (id INT PRIMARY KEY, region INT)",
+		"CREATE TABLE orders (id INT PRIMARY KEY, customer_id INT, item_id INT)",
+		"CREATE TABLE items (id INT PRIMARY KEY, title VARCHAR(255))",
+	)
+	for i := 1; i <= 20; i++ {
+		mustExecute(t, sess, fmt.Sprintf("INSERT INTO customers (id, region) VALUES (%d, %d)", i, i%4))
+	}
+	for i := 1; i <= 5; i++ {
+		mustExecute(t, sess, fmt.Sprintf("INSERT INTO items (id, title) VALUES (%d, 'item%d')", i, i))
+	}
+	for i := 1; i <= 60; i++ {
+		mustExecute(t, sess, fmt.Sprintf("INSERT INTO orders (id, customer_id, item_id) VALUES (%d, %d, %d)", i, i%20+1, i%5+1))
+	}
+
+	query := "SELECT COUNT(*), SUM(item_id) FROM orders JOIN customers ON orders.customer_id = customers.id JOIN items ON orders.item_id = items.id WHERE customers.region = 3"
+	before, err := sess.Execute(query)
+	if err != nil {
+		t.Fatalf("%s failed: %v", query, err)
+	}
+
+	result, err := sess.Execute("ANALYZE")
+	if err != nil {
+		t.Fatalf("ANALYZE failed: %v", err)
+	}
+	if want := "analyzed: customers, items, orders"; result.GetMessage() != want {
+		t.Errorf("expected %q, got %q", want, result.GetMessage())
+	}
+	if _, err := sess.Execute("ANALYZE orders"); err != nil {
+		t.Fatalf("ANALYZE orders failed: %v", err)
+	}
+	if _, err := sess.Execute("ANALYZE missing"); err == nil {
+		t.Error("expected error for unknown table")
+	}
+
+	// 統計情報で結合順を変えても結果は同じ
+	after, err := sess.Execute(query)
+	if err != nil {
+		t.Fatalf("%s failed: %v", query, err)
+	}
+	for i, want := range before.GetRows()[0].GetValues() {
+		if got := after.GetRows()[0].GetValues()[i]; storage.FormatValue(got) != storage.FormatValue(want) {
+			t.Errorf("column %d: expected %s, got %s", i, storage.FormatValue(want), storage.FormatValue(got))
+		}
+	}
+	if got := storage.FormatValue(after.GetRows()[0].GetValues()[0]); got != "15" {
+		t.Errorf("expected 15 rows, got %s", got)
+	}
+}
+
+func TestSessionOrderByLimitDistinct(t *testing.T) {
+	sess := setupSharedSessions(t, 1)[0]
+	mustExecute(t, sess,
+		"CREATE TABLE users (id INT PRIMARY KEY, name VARCHAR(255), city VARCHAR(255), age INT)",
+		"INSERT INTO users (id, name, city, age) VALUES (1, 'alice', 'tokyo', 30)",
+		"INSERT INTO users (id, name, city, age) VALUES (2, 'bob', 'osaka', 25)",
+		"INSERT INTO users (id, name, city, age) VALUES (3, 'carol', 'tokyo', NULL)",
+		"INSERT INTO users (id, name, city, age) VALUES (4, 'dave', 'nagoya', 40)",
+		"INSERT INTO users (id, name, city, age) VALUES (5, 'eve', 'osaka', 25)",
+	)
+
+	// 行ごとに値を "," でつないで、返された順のまま比べる
+	queries := map[string][]string{
+		"SELECT name FROM users ORDER BY name DESC":                                           {"eve", "dave", "carol", "bob", "alice"},
+		"SELECT name, age FROM users ORDER BY age DESC, name":                                 {"dave,40", "alice,30", "bob,25", "eve,25", "carol,NULL"},
+		"SELECT name FROM users ORDER BY age, id DESC":                                        {"carol", "eve", "bob", "alice", "dave"},
+		"SELECT name FROM users ORDER BY id LIMIT 2":                                          {"alice", "bob"},
+		"SELECT name FROM users ORDER BY id LIMIT 2 OFFSET 3":                                 {"dave", "eve"},
+		"SELECT name FROM users ORDER BY id OFFSET 4":                                         {"eve"},
+		"SELECT name AS n FROM users WHERE age > 20 ORDER BY n DESC LIMIT 1":                  {"eve"},
+		"SELECT age * 2 AS double FROM users WHERE age IS NOT NULL ORDER BY 1":                {"50", "50", "60", "80"},
+		"SELECT DISTINCT city FROM users ORDER BY city":                                       {"nagoya", "osaka", "tokyo"},
+		"SELECT DISTINCT age FROM users ORDER BY age DESC LIMIT 2":                            {"40", "30"},
+		"SELECT COUNT(*) FROM users LIMIT 0":                                                  nil,
+		"SELECT name FROM (SELECT * FROM users ORDER BY age DESC LIMIT 2) AS t ORDER BY name": {"alice", "dave"},
+	}
+	for query, want := range queries {
+		result, err := sess.Execute(query)
+		if err != nil {
+			t.Fatalf("%s failed: %v", query, err)
+		}
+		var got []string
+		for _, row := range result.GetRows() {
+			values := make([]string, len(row.GetValues()))
+			for i, value := range row.GetValues() {
+				values[i] = storage.FormatValue(value)
+			}
+			got = append(got, strings.Join(values, ","))
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("%s: expected %v, got %v", query, want, got)
+		}
+	}
+
+	// EXPLAIN は文を実行せずに、最適化したプランを1ノード1行で返す
+	var lines []string
+	if _, err := sess.Stream("EXPLAIN SELECT DISTINCT name FROM users ORDER BY name LIMIT 3", func(row *storage.Row) error {
+		lines = append(lines, storage.FormatValue(row.GetValues()[0]))
+		return nil
+	}); err != nil {
+		t.Fatalf("EXPLAIN failed: %v", err)
+	}
+	want := []string{"Limit(3)", "  TopN(3, name)", "    Distinct", "      Project([name])", "        Scan(users)"}
+	if !slices.Equal(lines, want) {
+		t.Errorf("EXPLAIN: expected %q, got %q", want, lines)
+	}
+	if _, err := sess.Execute("EXPLAIN DELETE FROM users"); err != nil {
+		t.Fatalf("EXPLAIN DELETE failed: %v", err)
+	}
+	if got := queryStrings(t, sess, "SELECT name FROM users ORDER BY id LIMIT 1"); !slices.Equal(got, []string{"alice"}) {
+		t.Errorf("EXPLAIN DELETE must not delete rows, got %v", got)
+	}
+
+	for _, query := range []string{
+		"SELECT DISTINCT city FROM users ORDER BY age",
+		"SELECT name FROM users ORDER BY missing",
+		"SELECT name FROM users ORDER BY 3",
+	} {
+		if _, err := sess.Execute(query); err == nil {
+			t.Errorf("%s: expected error", query)
+		}
+	}
+}
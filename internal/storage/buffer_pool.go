@@ -0,0 +1,356 @@
+package storage
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	ErrNoFreeFrame   = errors.New("no free frame in buffer pool")
+	ErrPageNotPinned = errors.New("page is not pinned")
+	ErrPageNotInPool = errors.New("page is not in buffer pool")
+)
+
+// DefaultBufferPoolFrames はカタログが作成するバッファプールのフレーム数
+const DefaultBufferPoolFrames = 256
+
+// pageKey はファイル（Pager）とページIDの組でページを識別する
+type pageKey struct {
+	pager  *Pager
+	pageID PageID
+}
+
+// frame はバッファプール内の1ページ分の領域
+type frame struct {
+	key      pageKey
+	data     []byte
+	pinCount int
+	dirty    bool
+	recLSN   uint64 // ダーティになったときの LSN（これより前のログはページに反映済み）
+}
+
+// DirtyPage はダーティページ表の1行
+type DirtyPage struct {
+	File   string // ページを持つファイル名
+	PageID PageID
+	RecLSN uint64 // このページの REDO を始める LSN
+}
+
+// BufferPoolStats はバッファプールの統計情報
+type BufferPoolStats struct {
+	Hits      uint64 // キャッシュヒット数
+	Misses    uint64 // キャッシュミス数（ディスクから読み込んだ回数）
+	Evictions uint64 // 追い出し回数
+	Flushes   uint64 // ディスクへの書き出し回数
+}
+
+// BufferPool は複数の Pager で共有するページキャッシュ
+// ページをピン留めしている間は追い出されず、ダーティページは追い出し時に書き出す
+type BufferPool struct {
+	mu        sync.Mutex
+	frames    []*frame
+	pageTable map[pageKey]FrameID
+	freeList  []FrameID
+	replacer  Replacer
+	// beforeFlush はダーティページを書き出す直前に呼ばれる
+	// WAL を先に書き出して、ログより先にページがディスクに載らないようにする
+	beforeFlush func() error
+	// recLSN はページがダーティになったときに呼ばれ、ダーティページ表の recLSN を返す
+	recLSN func() uint64
+	// unsynced は書き出したが fsync していない Pager
+	unsynced map[*Pager]struct{}
+
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+	flushes   atomic.Uint64
+}
+
+// NewBufferPool は frameCount 個のフレームを持つバッファプールを作成する
+func NewBufferPool(frameCount int, policy EvictionPolicy) *BufferPool {
+	if frameCount <= 0 {
+		frameCount = DefaultBufferPoolFrames
+	}
+	bp := &BufferPool{
+		frames:    make([]*frame, frameCount),
+		pageTable: make(map[pageKey]FrameID, frameCount),
+		freeList:  make([]FrameID, 0, frameCount),
+		replacer:  NewReplacer(policy, frameCount),
+		unsynced:  make(map[*Pager]struct{}),
+	}
+	for i := range bp.frames {
+		bp.frames[i] = &frame{data: make([]byte, pageSize)}
+		bp.freeList = append(bp.freeList, FrameID(i))
+	}
+	return bp
+}
+
+// SetBeforeFlush はダーティページを書き出す直前に呼ぶ関数を設定する
+func (bp *BufferPool) SetBeforeFlush(fn func() error) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	bp.beforeFlush = fn
+}
+
+// SetRecLSN はページがダーティになったときに recLSN を返す関数を設定する
+func (bp *BufferPool) SetRecLSN(fn func() uint64) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	bp.recLSN = fn
+}
+
+// FetchPage はページをピン留めして返す（なければディスクから読み込む）
+// 使い終わったら UnpinPage を呼ぶこと
+func (bp *BufferPool) FetchPage(pager *Pager, pageID PageID) (*Page, error) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	key := pageKey{pager: pager, pageID: pageID}
+	if frameID, ok := bp.pageTable[key]; ok {
+		bp.hits.Add(1)
+		bp.pin(frameID)
+		return NewPage(pageID, bp.frames[frameID].data), nil
+	}
+
+	bp.misses.Add(1)
+	frameID, err := bp.allocateFrame()
+	if err != nil {
+		return nil, err
+	}
+	f := bp.frames[frameID]
+	if _, err := pager.ReadPage(pageID, f.data); err != nil {
+		bp.freeList = append(bp.freeList, frameID)
+		return nil, err
+	}
+	bp.install(frameID, key)
+	return NewPage(pageID, f.data), nil
+}
+
+// NewPage はディスクにまだ存在しないページ用のフレームを確保し、ピン留めして返す
+// 新しいページはダーティ扱いになり、追い出しやフラッシュ時に書き出される
+func (bp *BufferPool) NewPage(pager *Pager, pageID PageID) (*Page, error) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	key := pageKey{pager: pager, pageID: pageID}
+	if frameID, ok := bp.pageTable[key]; ok {
+		bp.pin(frameID)
+		f := bp.frames[frameID]
+		clear(f.data)
+		bp.markDirty(f)
+		return NewPage(pageID, f.data), nil
+	}
+
+	frameID, err := bp.allocateFrame()
+	if err != nil {
+		return nil, err
+	}
+	f := bp.frames[frameID]
+	clear(f.data)
+	bp.install(frameID, key)
+	bp.markDirty(f)
+	return NewPage(pageID, f.data), nil
+}
+
+// UnpinPage はピンを外す。dirty が true ならページをダーティにする
+func (bp *BufferPool) UnpinPage(pager *Pager, pageID PageID, dirty bool) error {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	frameID, ok := bp.pageTable[pageKey{pager: pager, pageID: pageID}]
+	if !ok {
+		return ErrPageNotInPool
+	}
+	f := bp.frames[frameID]
+	if f.pinCount == 0 {
+		return ErrPageNotPinned
+	}
+	f.pinCount--
+	if dirty {
+		bp.markDirty(f)
+	}
+	if f.pinCount == 0 {
+		bp.replacer.SetEvictable(frameID, true)
+	}
+	return nil
+}
+
+// FlushPage はページがダーティならディスクに書き出す
+func (bp *BufferPool) FlushPage(pager *Pager, pageID PageID) error {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	frameID, ok := bp.pageTable[pageKey{pager: pager, pageID: pageID}]
+	if !ok {
+		return ErrPageNotInPool
+	}
+	return bp.flushFrame(frameID)
+}
+
+// FlushPager は指定した Pager のダーティページをすべて書き出す
+func (bp *BufferPool) FlushPager(pager *Pager) error {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	for key, frameID := range bp.pageTable {
+		if key.pager != pager {
+			continue
+		}
+		if err := bp.flushFrame(frameID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FlushAll はすべてのダーティページを書き出す
+func (bp *BufferPool) FlushAll() error {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	for _, frameID := range bp.pageTable {
+		if err := bp.flushFrame(frameID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sync は書き出したページを fsync でディスクに確実に書き込む
+func (bp *BufferPool) Sync() error {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	for pager := range bp.unsynced {
+		if err := pager.Sync(); err != nil {
+			return err
+		}
+		delete(bp.unsynced, pager)
+	}
+	return nil
+}
+
+// DirtyPages はダーティページ表（ダーティページと recLSN）を返す
+func (bp *BufferPool) DirtyPages() []DirtyPage {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	pages := make([]DirtyPage, 0)
+	for key, frameID := range bp.pageTable {
+		f := bp.frames[frameID]
+		if !f.dirty {
+			continue
+		}
+		pages = append(pages, DirtyPage{File: key.pager.GetName(), PageID: key.pageID, RecLSN: f.recLSN})
+	}
+	return pages
+}
+
+// DiscardPager は指定した Pager のページを書き出さずにプールから取り除く
+// Pager を閉じる前に呼ぶ（閉じたファイルへの書き出しを防ぐ）
+func (bp *BufferPool) DiscardPager(pager *Pager) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	for key, frameID := range bp.pageTable {
+		if key.pager != pager {
+			continue
+		}
+		f := bp.frames[frameID]
+		f.pinCount = 0
+		f.dirty = false
+		bp.replacer.Remove(frameID)
+		delete(bp.pageTable, key)
+		bp.freeList = append(bp.freeList, frameID)
+	}
+	delete(bp.unsynced, pager)
+}
+
+// Stats は統計情報を返す
+func (bp *BufferPool) Stats() BufferPoolStats {
+	return BufferPoolStats{
+		Hits:      bp.hits.Load(),
+		Misses:    bp.misses.Load(),
+		Evictions: bp.evictions.Load(),
+		Flushes:   bp.flushes.Load(),
+	}
+}
+
+// FrameCount はフレーム数を返す
+func (bp *BufferPool) FrameCount() int {
+	return len(bp.frames)
+}
+
+// allocateFrame は空きフレームを取得する。なければ追い出す
+// 呼び出し側でロックを取得していること
+func (bp *BufferPool) allocateFrame() (FrameID, error) {
+	if n := len(bp.freeList); n > 0 {
+		frameID := bp.freeList[n-1]
+		bp.freeList = bp.freeList[:n-1]
+		return frameID, nil
+	}
+	frameID, ok := bp.replacer.Evict()
+	if !ok {
+		return 0, ErrNoFreeFrame
+	}
+	// 追い出すページがダーティなら書き出す
+	if err := bp.flushFrame(frameID); err != nil {
+		bp.replacer.RecordAccess(frameID)
+		bp.replacer.SetEvictable(frameID, true)
+		return 0, err
+	}
+	bp.evictions.Add(1)
+	delete(bp.pageTable, bp.frames[frameID].key)
+	return frameID, nil
+}
+
+// install はフレームにページを割り当ててピン留めする
+func (bp *BufferPool) install(frameID FrameID, key pageKey) {
+	f := bp.frames[frameID]
+	f.key = key
+	f.pinCount = 0
+	f.dirty = false
+	bp.pageTable[key] = frameID
+	bp.pin(frameID)
+}
+
+// pin はフレームのピン数を増やす
+func (bp *BufferPool) pin(frameID FrameID) {
+	f := bp.frames[frameID]
+	f.pinCount++
+	bp.replacer.RecordAccess(frameID)
+	bp.replacer.SetEvictable(frameID, false)
+}
+
+// markDirty はフレームをダーティにし、クリーンからダーティになったときは recLSN を記録する
+// 呼び出し側でロックを取得していること
+func (bp *BufferPool) markDirty(f *frame) {
+	if f.dirty {
+		return
+	}
+	f.dirty = true
+	if bp.recLSN != nil {
+		f.recLSN = bp.recLSN()
+	}
+}
+
+// flushFrame はフレームがダーティならディスクに書き出す
+func (bp *BufferPool) flushFrame(frameID FrameID) error {
+	f := bp.frames[frameID]
+	if !f.dirty {
+		return nil
+	}
+	if bp.beforeFlush != nil {
+		if err := bp.beforeFlush(); err != nil {
+			return err
+		}
+	}
+	if err := f.key.pager.WritePage(NewPage(f.key.pageID, f.data)); err != nil {
+		return err
+	}
+	f.dirty = false
+	bp.unsynced[f.key.pager] = struct{}{}
+	bp.flushes.Add(1)
+	return nil
+}
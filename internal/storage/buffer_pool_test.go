@@ -0,0 +1,268 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// =============================================================================
+// BufferPool Tests
+// =============================================================================
+
+func newTestPager(t *testing.T, name string) *Pager {
+	t.Helper()
+	pager, err := NewPager(filepath.Join(t.TempDir(), name))
+	if err != nil {
+		t.Fatalf("NewPager failed: %v", err)
+	}
+	t.Cleanup(func() { pager.Close() })
+	return pager
+}
+
+func TestBufferPoolHitAndMiss(t *testing.T) {
+	pager := newTestPager(t, "test.db")
+	bp := NewBufferPool(4, EvictionPolicyLRU)
+
+	page, err := bp.NewPage(pager, 0)
+	if err != nil {
+		t.Fatalf("NewPage failed: %v", err)
+	}
+	copy(page.data, []byte("hello"))
+	if err := bp.UnpinPage(pager, 0, true); err != nil {
+		t.Fatalf("UnpinPage failed: %v", err)
+	}
+
+	// プールにあるのでヒット
+	page, err = bp.FetchPage(pager, 0)
+	if err != nil {
+		t.Fatalf("FetchPage failed: %v", err)
+	}
+	if string(page.data[:5]) != "hello" {
+		t.Errorf("FetchPage returned %q, want %q", page.data[:5], "hello")
+	}
+	bp.UnpinPage(pager, 0, false)
+
+	stats := bp.Stats()
+	if stats.Hits != 1 || stats.Misses != 0 {
+		t.Errorf("Stats() = %+v, want 1 hit and 0 misses", stats)
+	}
+}
+
+func TestBufferPoolFlushOnEvict(t *testing.T) {
+	pager := newTestPager(t, "test.db")
+	bp := NewBufferPool(2, EvictionPolicyLRU)
+
+	// 3ページ書き込むと最初のページが追い出される
+	for i := 0; i < 3; i++ {
+		page, err := bp.NewPage(pager, PageID(i))
+		if err != nil {
+			t.Fatalf("NewPage(%d) failed: %v", i, err)
+		}
+		page.data[0] = byte(i + 1)
+		bp.UnpinPage(pager, PageID(i), true)
+	}
+
+	stats := bp.Stats()
+	if stats.Evictions != 1 || stats.Flushes != 1 {
+		t.Errorf("Stats() = %+v, want 1 eviction and 1 flush", stats)
+	}
+
+	// 追い出されたページはディスクから読み直せる
+	page, err := bp.FetchPage(pager, 0)
+	if err != nil {
+		t.Fatalf("FetchPage failed: %v", err)
+	}
+	if page.data[0] != 1 {
+		t.Errorf("page 0 data = %d, want 1", page.data[0])
+	}
+	bp.UnpinPage(pager, 0, false)
+	if bp.Stats().Misses != 1 {
+		t.Errorf("Misses = %d, want 1", bp.Stats().Misses)
+	}
+}
+
+func TestBufferPoolBeforeFlush(t *testing.T) {
+	pager := newTestPager(t, "test.db")
+	bp := NewBufferPool(1, EvictionPolicyLRU)
+	calls := 0
+	bp.SetBeforeFlush(func() error {
+		calls++
+		return nil
+	})
+
+	bp.NewPage(pager, 0)
+	bp.UnpinPage(pager, 0, true)
+	// 追い出しでも明示的な書き出しでも、ページを書く前に呼ばれる
+	bp.NewPage(pager, 1)
+	bp.UnpinPage(pager, 1, true)
+	if calls != 1 {
+		t.Errorf("expected 1 call on eviction, got %d", calls)
+	}
+	if err := bp.FlushAll(); err != nil {
+		t.Fatalf("FlushAll failed: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 calls after FlushAll, got %d", calls)
+	}
+
+	// 失敗した場合はページを書かない
+	bp.SetBeforeFlush(func() error { return errors.New("wal unavailable") })
+	page, _ := bp.FetchPage(pager, 1)
+	page.data[0] = 9
+	bp.UnpinPage(pager, 1, true)
+	if err := bp.FlushAll(); err == nil {
+		t.Error("expected FlushAll to fail")
+	}
+}
+
+func TestBufferPoolDirtyPages(t *testing.T) {
+	pager := newTestPager(t, "test.db")
+	bp := NewBufferPool(4, EvictionPolicyLRU)
+	lsn := uint64(10)
+	bp.SetRecLSN(func() uint64 { return lsn })
+
+	bp.NewPage(pager, 0)
+	bp.UnpinPage(pager, 0, true)
+	// 2回目以降の変更では recLSN は変わらない
+	lsn = 20
+	page, _ := bp.FetchPage(pager, 0)
+	bp.UnpinPage(pager, page.GetID(), true)
+	bp.NewPage(pager, 1)
+	bp.UnpinPage(pager, 1, true)
+
+	recLSNs := make(map[PageID]uint64)
+	for _, p := range bp.DirtyPages() {
+		if p.File != "test.db" {
+			t.Errorf("unexpected file name %q", p.File)
+		}
+		recLSNs[p.PageID] = p.RecLSN
+	}
+	if len(recLSNs) != 2 || recLSNs[0] != 10 || recLSNs[1] != 20 {
+		t.Errorf("unexpected dirty page table: %v", recLSNs)
+	}
+
+	// 書き出すとダーティページ表から消える
+	if err := bp.FlushAll(); err != nil {
+		t.Fatalf("FlushAll failed: %v", err)
+	}
+	if err := bp.Sync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if pages := bp.DirtyPages(); len(pages) != 0 {
+		t.Errorf("expected no dirty pages after flush, got %v", pages)
+	}
+}
+
+func TestBufferPoolAllPinned(t *testing.T) {
+	pager := newTestPager(t, "test.db")
+	bp := NewBufferPool(1, EvictionPolicyClock)
+
+	if _, err := bp.NewPage(pager, 0); err != nil {
+		t.Fatalf("NewPage failed: %v", err)
+	}
+	// ピン留め中なので追い出せない
+	if _, err := bp.NewPage(pager, 1); !errors.Is(err, ErrNoFreeFrame) {
+		t.Errorf("NewPage error = %v, want %v", err, ErrNoFreeFrame)
+	}
+	bp.UnpinPage(pager, 0, true)
+	if _, err := bp.NewPage(pager, 1); err != nil {
+		t.Errorf("NewPage after unpin failed: %v", err)
+	}
+}
+
+func TestBufferPoolUnpinErrors(t *testing.T) {
+	pager := newTestPager(t, "test.db")
+	bp := NewBufferPool(2, EvictionPolicyLRU)
+
+	if err := bp.UnpinPage(pager, 0, false); !errors.Is(err, ErrPageNotInPool) {
+		t.Errorf("UnpinPage error = %v, want %v", err, ErrPageNotInPool)
+	}
+	bp.NewPage(pager, 0)
+	bp.UnpinPage(pager, 0, false)
+	if err := bp.UnpinPage(pager, 0, false); !errors.Is(err, ErrPageNotPinned) {
+		t.Errorf("UnpinPage error = %v, want %v", err, ErrPageNotPinned)
+	}
+}
+
+func TestBufferPoolSharedAcrossPagers(t *testing.T) {
+	pager1 := newTestPager(t, "a.db")
+	pager2 := newTestPager(t, "b.db")
+	bp := NewBufferPool(4, EvictionPolicyLRU)
+
+	// 同じページIDでも Pager が違えば別ページ
+	p1, _ := bp.NewPage(pager1, 0)
+	p1.data[0] = 'a'
+	bp.UnpinPage(pager1, 0, true)
+	p2, _ := bp.NewPage(pager2, 0)
+	p2.data[0] = 'b'
+	bp.UnpinPage(pager2, 0, true)
+
+	if err := bp.FlushPager(pager1); err != nil {
+		t.Fatalf("FlushPager failed: %v", err)
+	}
+	if bp.Stats().Flushes != 1 {
+		t.Errorf("Flushes = %d, want 1", bp.Stats().Flushes)
+	}
+
+	bp.DiscardPager(pager2)
+	page, err := bp.FetchPage(pager1, 0)
+	if err != nil {
+		t.Fatalf("FetchPage failed: %v", err)
+	}
+	if page.data[0] != 'a' {
+		t.Errorf("pager1 page data = %c, want a", page.data[0])
+	}
+}
+
+func TestTableWithSmallBufferPool(t *testing.T) {
+	pager := newTestPager(t, "users.db")
+	bp := NewBufferPool(2, EvictionPolicyClock)
+	schema := NewSchema("users", []Column{
+		*NewColumn("id", ColumnTypeInt32, 4, false),
+		*NewColumn("name", ColumnTypeString, 255, false),
+	})
+	table, err := NewTableWithBufferPool("users", schema, pager, bp)
+	if err != nil {
+		t.Fatalf("NewTableWithBufferPool failed: %v", err)
+	}
+
+	// フレーム数より多いページを使う
+	const rowCount = 500
+	for i := 0; i < rowCount; i++ {
+		row := NewRow([]Value{Int32Value(i), StringValue("user-with-a-fairly-long-name")})
+		if err := table.Insert(row); err != nil {
+			t.Fatalf("Insert(%d) failed: %v", i, err)
+		}
+	}
+	if table.numPages <= 2 {
+		t.Fatalf("expected more pages than frames, got %d pages", table.numPages)
+	}
+
+	rows, err := table.Scan()
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if len(rows) != rowCount {
+		t.Errorf("Scan returned %d rows, want %d", len(rows), rowCount)
+	}
+	if bp.Stats().Evictions == 0 {
+		t.Error("expected evictions with a 2-frame pool")
+	}
+
+	// 書き出し後に別のテーブルとして開き直しても同じ行が読める
+	if err := table.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	reopened, err := NewTable("users", schema, pager)
+	if err != nil {
+		t.Fatalf("NewTable failed: %v", err)
+	}
+	rows, err = reopened.Scan()
+	if err != nil {
+		t.Fatalf("Scan after reopen failed: %v", err)
+	}
+	if len(rows) != rowCount {
+		t.Errorf("Scan after reopen returned %d rows, want %d", len(rows), rowCount)
+	}
+}
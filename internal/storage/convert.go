@@ -0,0 +1,407 @@
+package storage
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrValueOutOfRange    = errors.New("value out of range")
+	ErrIncomparableValues = errors.New("incomparable values")
+)
+
+// defaultDecimalPrecision は精度を指定しない DECIMAL の精度
+const defaultDecimalPrecision = 10
+
+// CastValue は値をカラムの型に変換する（NULL はそのまま返す）
+// 数値は桁あふれしない限り別の数値型にでき、文字列は日付や数値として読む
+// DECIMAL はカラムのスケールに丸め、精度（カラムのサイズ）を超えるとエラーにする
+// VARCHAR に入らない長さの文字列もエラーにする（TEXT を使う）
+func CastValue(value Value, col *Column) (Value, error) {
+	if value == nil {
+		return nil, nil
+	}
+	if value.Type() == col.GetColumnType() && col.GetColumnType() != ColumnTypeDecimal && col.GetColumnType() != ColumnTypeString {
+		return value, nil
+	}
+	switch col.GetColumnType() {
+	case ColumnTypeInt32:
+		n, err := toInt64(value)
+		if err != nil {
+			return nil, err
+		}
+		if n < math.MinInt32 || n > math.MaxInt32 {
+			return nil, fmt.Errorf("%w: %d for %s", ErrValueOutOfRange, n, col.GetName())
+		}
+		return Int32Value(n), nil
+	case ColumnTypeInt64:
+		n, err := toInt64(value)
+		if err != nil {
+			return nil, err
+		}
+		return Int64Value(n), nil
+	case ColumnTypeFloat32:
+		f, err := toFloat64(value)
+		if err != nil {
+			return nil, err
+		}
+		if math.Abs(f) > math.MaxFloat32 {
+			return nil, fmt.Errorf("%w: %v for %s", ErrValueOutOfRange, f, col.GetName())
+		}
+		return Float32Value(f), nil
+	case ColumnTypeFloat64:
+		f, err := toFloat64(value)
+		if err != nil {
+			return nil, err
+		}
+		return Float64Value(f), nil
+	case ColumnTypeDecimal:
+		return castDecimal(value, col)
+	case ColumnTypeDate:
+		switch v := value.(type) {
+		case StringValue:
+			return ParseDate(string(v))
+		case TimestampValue:
+			return NewDateValue(v.Time()), nil
+		}
+	case ColumnTypeTime:
+		switch v := value.(type) {
+		case StringValue:
+			return ParseTime(string(v))
+		case TimestampValue:
+			return NewTimeValue(v.Time()), nil
+		}
+	case ColumnTypeTimestamp:
+		switch v := value.(type) {
+		case StringValue:
+			return ParseTimestamp(string(v))
+		case DateValue:
+			return NewTimestampValue(v.Time()), nil
+		}
+	case ColumnTypeString:
+		s := FormatValue(value)
+		if len(s) > MaxVarcharLength {
+			return nil, fmt.Errorf("%w: %d bytes for VARCHAR %s", ErrValueOutOfRange, len(s), col.GetName())
+		}
+		return StringValue(s), nil
+	case ColumnTypeText:
+		return TextValue(FormatValue(value)), nil
+	case ColumnTypeBlob:
+		switch v := value.(type) {
+		case StringValue:
+			return BlobValue(v), nil
+		case TextValue:
+			return BlobValue(v), nil
+		}
+	}
+	return nil, fmt.Errorf("%w: cannot convert %s to %s", ErrInvalidType, value.Type(), col.GetColumnType())
+}
+
+// ConvertValue は CAST(x AS type) で値をカラムの型に変換する（NULL はそのまま返す）
+// 代入の変換（CastValue）と違い、小数部のある数値（DECIMAL, FLOAT）も整数型にでき、小数部は四捨五入する
+// 数値の型にするときは、文字列（VARCHAR, TEXT）を前後の空白を除いた数値として読み、真偽値は 1 と 0 にする
+func ConvertValue(value Value, col *Column) (Value, error) {
+	switch col.GetColumnType() {
+	case ColumnTypeInt32, ColumnTypeInt64, ColumnTypeFloat32, ColumnTypeFloat64, ColumnTypeDecimal:
+	default:
+		return CastValue(value, col)
+	}
+	switch v := value.(type) {
+	case StringValue, TextValue:
+		s, _ := textOf(v)
+		n, err := parseNumber(strings.TrimSpace(s))
+		if err != nil {
+			return nil, err
+		}
+		value = n
+	case BoolValue:
+		value = Int64Value(boolToInt(bool(v)))
+	}
+	if col.GetColumnType() == ColumnTypeInt32 || col.GetColumnType() == ColumnTypeInt64 {
+		n, err := roundToInt64(value)
+		if err != nil {
+			return nil, err
+		}
+		value = Int64Value(n)
+	}
+	return CastValue(value, col)
+}
+
+// parseNumber は数値の文字列を整数、DECIMAL、浮動小数点数（指数表記など）の順に読む
+func parseNumber(s string) (Value, error) {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return Int64Value(n), nil
+	}
+	if d, err := ParseDecimal(s); err == nil {
+		return d, nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return Float64Value(f), nil
+	}
+	return nil, fmt.Errorf("%w: invalid number %q", ErrInvalidData, s)
+}
+
+// roundToInt64 は数値を四捨五入して int64 にする（0 から遠いほうに丸める）
+func roundToInt64(value Value) (int64, error) {
+	switch v := value.(type) {
+	case DecimalValue:
+		d, err := v.Rescale(0)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %s", ErrValueOutOfRange, v)
+		}
+		return d.Unscaled, nil
+	case Float32Value, Float64Value:
+		f, _ := toFloat64(v)
+		f = math.Round(f)
+		// float64(math.MaxInt64) は 2^63 に丸められるので、2^63 以上は範囲外
+		if math.IsNaN(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return 0, fmt.Errorf("%w: %v", ErrValueOutOfRange, f)
+		}
+		return int64(f), nil
+	}
+	return toInt64(value)
+}
+
+// castDecimal は値をカラムのスケールの DecimalValue にし、精度に収まるか確かめる
+func castDecimal(value Value, col *Column) (Value, error) {
+	var d DecimalValue
+	var err error
+	switch v := value.(type) {
+	case DecimalValue:
+		d, err = v.Rescale(col.GetScale())
+	case Float32Value:
+		d, err = DecimalFromFloat(float64(v), col.GetScale())
+	case Float64Value:
+		d, err = DecimalFromFloat(float64(v), col.GetScale())
+	case StringValue:
+		if d, err = ParseDecimal(string(v)); err == nil {
+			d, err = d.Rescale(col.GetScale())
+		}
+	default:
+		var n int64
+		if n, err = toInt64(value); err == nil {
+			d, err = NewDecimal(n, 0).Rescale(col.GetScale())
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	precision := int(col.GetSize())
+	if precision == 0 {
+		precision = defaultDecimalPrecision
+	}
+	if d.Precision() > precision {
+		return nil, fmt.Errorf("%w: %s exceeds DECIMAL(%d,%d) for %s", ErrValueOutOfRange, d, precision, col.GetScale(), col.GetName())
+	}
+	return d, nil
+}
+
+// toInt64 は整数か整数を表す文字列を int64 にする
+func toInt64(value Value) (int64, error) {
+	switch v := value.(type) {
+	case Int32Value:
+		return int64(v), nil
+	case Int64Value:
+		return int64(v), nil
+	case StringValue:
+		n, err := strconv.ParseInt(string(v), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: invalid integer %q", ErrInvalidData, string(v))
+		}
+		return n, nil
+	case DecimalValue:
+		if v.Scale == 0 {
+			return v.Unscaled, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: cannot convert %s to integer", ErrInvalidType, value.Type())
+}
+
+// toFloat64 は数値か数値を表す文字列を float64 にする
+func toFloat64(value Value) (float64, error) {
+	switch v := value.(type) {
+	case Int32Value:
+		return float64(v), nil
+	case Int64Value:
+		return float64(v), nil
+	case Float32Value:
+		return float64(v), nil
+	case Float64Value:
+		return float64(v), nil
+	case DecimalValue:
+		return v.Float64(), nil
+	case StringValue:
+		f, err := strconv.ParseFloat(string(v), 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: invalid number %q", ErrInvalidData, string(v))
+		}
+		return f, nil
+	}
+	return 0, fmt.Errorf("%w: cannot convert %s to float", ErrInvalidType, value.Type())
+}
+
+// IsNumeric は値が数値かどうかを返す
+func IsNumeric(value Value) bool {
+	switch value.(type) {
+	case Int32Value, Int64Value, Float32Value, Float64Value, DecimalValue:
+		return true
+	}
+	return false
+}
+
+// CompareValues は2つの値を比べ、a が小さければ負、等しければ 0、大きければ正を返す
+// 数値は型が違っても値で比べる（どちらかが浮動小数点数なら浮動小数点数で、それ以外は DECIMAL で比べる）
+// 日付と日時は日時にそろえて比べ、日付や時刻と文字列は文字列を読んでから比べる
+func CompareValues(a, b Value) (int, error) {
+	if a == nil || b == nil {
+		return 0, fmt.Errorf("%w: NULL", ErrIncomparableValues)
+	}
+	if IsNumeric(a) && IsNumeric(b) {
+		return compareNumbers(a, b), nil
+	}
+	switch x := a.(type) {
+	case StringValue, TextValue:
+		if y, ok := textOf(b); ok {
+			s, _ := textOf(x)
+			return cmp.Compare(s, y), nil
+		}
+		if _, ok := x.(StringValue); ok && isTemporal(b) {
+			c, err := CompareValues(b, a)
+			return -c, err
+		}
+	case BlobValue:
+		if y, ok := b.(BlobValue); ok {
+			return cmp.Compare(x, y), nil
+		}
+	case BoolValue:
+		if y, ok := b.(BoolValue); ok {
+			return cmp.Compare(boolToInt(bool(x)), boolToInt(bool(y))), nil
+		}
+	case DateValue, TimeValue, TimestampValue:
+		return compareTemporal(a, b)
+	}
+	return 0, fmt.Errorf("%w: %s and %s", ErrIncomparableValues, a.Type(), b.Type())
+}
+
+// textOf は VARCHAR か TEXT の値を文字列にする
+func textOf(v Value) (string, bool) {
+	switch v := v.(type) {
+	case StringValue:
+		return string(v), true
+	case TextValue:
+		return string(v), true
+	}
+	return "", false
+}
+
+func compareNumbers(a, b Value) int {
+	if ai, err := toInt64(a); err == nil && isInteger(a) {
+		if bi, err := toInt64(b); err == nil && isInteger(b) {
+			return cmp.Compare(ai, bi)
+		}
+	}
+	if isFloat(a) || isFloat(b) {
+		af, _ := toFloat64(a)
+		bf, _ := toFloat64(b)
+		return cmp.Compare(af, bf)
+	}
+	return toDecimal(a).Cmp(toDecimal(b))
+}
+
+func compareTemporal(a, b Value) (int, error) {
+	if s, ok := b.(StringValue); ok {
+		col := NewColumn("", a.Type(), 0, false)
+		parsed, err := CastValue(s, col)
+		if err != nil {
+			return 0, err
+		}
+		b = parsed
+	}
+	switch {
+	case a.Type() == b.Type():
+		return cmp.Compare(temporalOrdinal(a), temporalOrdinal(b)), nil
+	case a.Type() != ColumnTypeTime && b.Type() != ColumnTypeTime && isTemporal(b):
+		// 日付と日時は日時にそろえる
+		timestamp := NewColumn("", ColumnTypeTimestamp, 0, false)
+		x, _ := CastValue(a, timestamp)
+		y, _ := CastValue(b, timestamp)
+		return cmp.Compare(x.(TimestampValue), y.(TimestampValue)), nil
+	}
+	return 0, fmt.Errorf("%w: %s and %s", ErrIncomparableValues, a.Type(), b.Type())
+}
+
+func temporalOrdinal(v Value) int64 {
+	switch v := v.(type) {
+	case DateValue:
+		return int64(v)
+	case TimeValue:
+		return int64(v)
+	case TimestampValue:
+		return int64(v)
+	}
+	return 0
+}
+
+func isTemporal(v Value) bool {
+	switch v.(type) {
+	case DateValue, TimeValue, TimestampValue:
+		return true
+	}
+	return false
+}
+
+func isInteger(v Value) bool {
+	switch v.(type) {
+	case Int32Value, Int64Value:
+		return true
+	}
+	return false
+}
+
+func isFloat(v Value) bool {
+	switch v.(type) {
+	case Float32Value, Float64Value:
+		return true
+	}
+	return false
+}
+
+// toDecimal は整数か DECIMAL を DecimalValue にする
+func toDecimal(v Value) DecimalValue {
+	if d, ok := v.(DecimalValue); ok {
+		return d
+	}
+	n, _ := toInt64(v)
+	return NewDecimal(n, 0)
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// FormatValue は値を表示用の文字列にする（NULL は "NULL"）
+func FormatValue(value Value) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case StringValue:
+		return string(v)
+	case TextValue:
+		return string(v)
+	case Float32Value:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case Float64Value:
+		return strconv.FormatFloat(float64(v), 'g', -1, 64)
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
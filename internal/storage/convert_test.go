@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCastValue(t *testing.T) {
+	price := NewColumn("price", ColumnTypeDecimal, 5, false)
+	price.SetScale(2)
+	tests := []struct {
+		name  string
+		value Value
+		col   *Column
+		want  Value
+	}{
+		{"int to bigint", Int32Value(7), NewColumn("n", ColumnTypeInt64, 0, false), Int64Value(7)},
+		{"bigint to int", Int64Value(-7), NewColumn("n", ColumnTypeInt32, 0, false), Int32Value(-7)},
+		{"int to double", Int64Value(3), NewColumn("f", ColumnTypeFloat64, 0, false), Float64Value(3)},
+		{"decimal to float", NewDecimal(125, 2), NewColumn("f", ColumnTypeFloat32, 0, false), Float32Value(1.25)},
+		{"decimal rounds to scale", NewDecimal(12345, 3), price, NewDecimal(1235, 2)},
+		{"int to decimal", Int64Value(12), price, NewDecimal(1200, 2)},
+		{"float to decimal", Float64Value(0.1), price, NewDecimal(10, 2)},
+		{"string to date", StringValue("2024-02-29"), NewColumn("d", ColumnTypeDate, 0, false), DateValue(19782)},
+		{"string to time", StringValue("01:02:03"), NewColumn("t", ColumnTypeTime, 0, false), TimeValue(3723000000)},
+		{"date to timestamp", DateValue(1), NewColumn("ts", ColumnTypeTimestamp, 0, false), TimestampValue(86400000000)},
+		{"number to string", NewDecimal(-5, 1), NewColumn("s", ColumnTypeString, 0, false), StringValue("-0.5")},
+		{"null", nil, price, nil},
+	}
+	for _, tt := range tests {
+		got, err := CastValue(tt.value, tt.col)
+		if err != nil {
+			t.Errorf("%s: CastValue failed: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: CastValue = %#v, want %#v", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := CastValue(Int64Value(1<<40), NewColumn("n", ColumnTypeInt32, 0, false)); !errors.Is(err, ErrValueOutOfRange) {
+		t.Errorf("expected ErrValueOutOfRange for int overflow, got %v", err)
+	}
+	if _, err := CastValue(NewDecimal(100000, 2), price); !errors.Is(err, ErrValueOutOfRange) {
+		t.Errorf("expected ErrValueOutOfRange for DECIMAL(5,2), got %v", err)
+	}
+	if _, err := CastValue(StringValue("2024-13-01"), NewColumn("d", ColumnTypeDate, 0, false)); !errors.Is(err, ErrInvalidData) {
+		t.Errorf("expected ErrInvalidData for a bad date, got %v", err)
+	}
+	if _, err := CastValue(BoolValue(true), NewColumn("d", ColumnTypeDate, 0, false)); !errors.Is(err, ErrInvalidType) {
+		t.Errorf("expected ErrInvalidType, got %v", err)
+	}
+}
+
+func TestConvertValue(t *testing.T) {
+	price := NewColumn("price", ColumnTypeDecimal, 5, false)
+	price.SetScale(2)
+	targets := []*Column{
+		NewColumn("i", ColumnTypeInt32, 0, false),
+		NewColumn("b", ColumnTypeInt64, 0, false),
+		NewColumn("f", ColumnTypeFloat32, 0, false),
+		NewColumn("d", ColumnTypeFloat64, 0, false),
+		price,
+	}
+	// 変換元ごとの、targets の順の変換結果
+	tests := []struct {
+		name  string
+		value Value
+		want  []Value
+	}{
+		{"decimal", NewDecimal(1050, 2), []Value{Int32Value(11), Int64Value(11), Float32Value(10.5), Float64Value(10.5), NewDecimal(1050, 2)}},
+		{"negative decimal", NewDecimal(-1049, 2), []Value{Int32Value(-10), Int64Value(-10), Float32Value(-10.49), Float64Value(-10.49), NewDecimal(-1049, 2)}},
+		{"float", Float64Value(1.5), []Value{Int32Value(2), Int64Value(2), Float32Value(1.5), Float64Value(1.5), NewDecimal(150, 2)}},
+		{"negative float", Float32Value(-2.5), []Value{Int32Value(-3), Int64Value(-3), Float32Value(-2.5), Float64Value(-2.5), NewDecimal(-250, 2)}},
+		{"varchar", StringValue(" 7.125 "), []Value{Int32Value(7), Int64Value(7), Float32Value(7.125), Float64Value(7.125), NewDecimal(713, 2)}},
+		{"text", TextValue("-42"), []Value{Int32Value(-42), Int64Value(-42), Float32Value(-42), Float64Value(-42), NewDecimal(-4200, 2)}},
+		{"exponent", StringValue("1e2"), []Value{Int32Value(100), Int64Value(100), Float32Value(100), Float64Value(100), NewDecimal(10000, 2)}},
+		{"bool", BoolValue(true), []Value{Int32Value(1), Int64Value(1), Float32Value(1), Float64Value(1), NewDecimal(100, 2)}},
+	}
+	for _, tt := range tests {
+		for i, col := range targets {
+			got, err := ConvertValue(tt.value, col)
+			if err != nil || got != tt.want[i] {
+				t.Errorf("%s to %s: ConvertValue = %#v, %v, want %#v", tt.name, col.GetColumnType(), got, err, tt.want[i])
+			}
+		}
+	}
+
+	// 代入の変換は小数部のある数値を整数にしない
+	if _, err := CastValue(NewDecimal(1050, 2), targets[0]); !errors.Is(err, ErrInvalidType) {
+		t.Errorf("expected CastValue to reject DECIMAL to INT, got %v", err)
+	}
+	errorTests := []struct {
+		name  string
+		value Value
+		col   *Column
+		err   error
+	}{
+		{"float overflow", Float64Value(1e19), targets[1], ErrValueOutOfRange},
+		{"int overflow", Float64Value(3e9), targets[0], ErrValueOutOfRange},
+		{"decimal precision", StringValue("1234.5"), price, ErrValueOutOfRange},
+		{"not a number", TextValue("abc"), targets[3], ErrInvalidData},
+	}
+	for _, tt := range errorTests {
+		if _, err := ConvertValue(tt.value, tt.col); !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.err, err)
+		}
+	}
+	if got, err := ConvertValue(Int32Value(5), NewColumn("s", ColumnTypeString, 0, false)); err != nil || got != StringValue("5") {
+		t.Errorf("int to string: ConvertValue = %#v, %v", got, err)
+	}
+}
+
+func TestCompareValues(t *testing.T) {
+	date, _ := ParseDate("2024-01-31")
+	timestamp, _ := ParseTimestamp("2024-01-31 12:00:00")
+	tests := []struct {
+		name string
+		a, b Value
+		want int
+	}{
+		{"int and bigint", Int32Value(3), Int64Value(4), -1},
+		{"int and double", Int32Value(3), Float64Value(2.5), 1},
+		{"float and double", Float32Value(0.5), Float64Value(0.5), 0},
+		{"decimal scales", NewDecimal(150, 2), NewDecimal(15, 1), 0},
+		{"int and decimal", Int64Value(2), NewDecimal(199, 2), 1},
+		{"date and timestamp", date, timestamp, -1},
+		{"date and string", date, StringValue("2024-01-31"), 0},
+		{"string and time", StringValue("10:00:00"), TimeValue(0), 1},
+		{"strings", StringValue("a"), StringValue("b"), -1},
+		{"bools", BoolValue(true), BoolValue(false), 1},
+	}
+	for _, tt := range tests {
+		got, err := CompareValues(tt.a, tt.b)
+		if err != nil {
+			t.Errorf("%s: CompareValues failed: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: CompareValues = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+	for _, pair := range [][2]Value{{Int32Value(1), StringValue("1")}, {date, TimeValue(0)}, {nil, Int32Value(1)}} {
+		if _, err := CompareValues(pair[0], pair[1]); !errors.Is(err, ErrIncomparableValues) {
+			t.Errorf("CompareValues(%v, %v): expected ErrIncomparableValues, got %v", pair[0], pair[1], err)
+		}
+	}
+}
+
+func TestTemporalValues(t *testing.T) {
+	date, err := ParseDate("1969-12-31")
+	if err != nil || date != -1 || date.String() != "1969-12-31" {
+		t.Errorf("ParseDate = %d (%v), want -1", date, err)
+	}
+	tm, err := ParseTime("23:59:59.5")
+	if err != nil || tm.String() != "23:59:59.5" {
+		t.Errorf("ParseTime = %s (%v)", tm, err)
+	}
+	ts, err := ParseTimestamp("2024-01-31T09:30:00+09:00")
+	if err != nil || ts.String() != "2024-01-31 00:30:00" {
+		t.Errorf("ParseTimestamp = %s (%v), want UTC time", ts, err)
+	}
+	ts, err = ParseTimestamp("2024-01-31")
+	if err != nil || ts.String() != "2024-01-31 00:00:00" {
+		t.Errorf("ParseTimestamp(date only) = %s (%v)", ts, err)
+	}
+}
+
+func TestDecodeRow_NumericAndTemporal(t *testing.T) {
+	price := NewColumn("price", ColumnTypeDecimal, 10, true)
+	price.SetScale(2)
+	schema := NewSchema("events", []Column{
+		*NewColumn("ratio", ColumnTypeFloat32, 0, false),
+		*NewColumn("score", ColumnTypeFloat64, 0, false),
+		*price,
+		*NewColumn("day", ColumnTypeDate, 0, false),
+		*NewColumn("at", ColumnTypeTime, 0, false),
+		*NewColumn("created", ColumnTypeTimestamp, 0, false),
+	})
+	values := []Value{Float32Value(0.25), Float64Value(-1e100), NewDecimal(-12345, 2), DateValue(-365), TimeValue(45296000001), TimestampValue(1706659200000000)}
+	decoded, err := DecodeRow(NewRowWithID(9, values).Encode(), schema)
+	if err != nil {
+		t.Fatalf("DecodeRow failed: %v", err)
+	}
+	for i, v := range decoded.GetValues() {
+		if v != values[i] {
+			t.Errorf("column %d: got %#v, want %#v", i, v, values[i])
+		}
+	}
+
+	// NULL の DECIMAL
+	decoded, err = DecodeRow(NewRowWithID(10, []Value{Float32Value(0), Float64Value(0), nil, DateValue(0), TimeValue(0), TimestampValue(0)}).Encode(), schema)
+	if err != nil || decoded.GetValues()[2] != nil {
+		t.Errorf("expected NULL decimal, got %v (%v)", decoded, err)
+	}
+}
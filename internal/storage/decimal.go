@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// MaxDecimalPrecision は DECIMAL の最大の桁数（int64 に収まる桁数）
+const MaxDecimalPrecision = 18
+
+// decimalDivisionScale は DECIMAL の割り算で、割られる数と割る数のスケールより多く残す小数の桁数
+const decimalDivisionScale = 4
+
+var (
+	ErrDecimalOverflow = errors.New("decimal overflow")
+	ErrDivisionByZero  = errors.New("division by zero")
+)
+
+// DecimalValue は固定小数点数（Unscaled / 10^Scale）
+// 同じカラムの値はカラムのスケールにそろえて保存する
+type DecimalValue struct {
+	Unscaled int64
+	Scale    uint8
+}
+
+func NewDecimal(unscaled int64, scale uint8) DecimalValue {
+	return DecimalValue{Unscaled: unscaled, Scale: scale}
+}
+
+func (v DecimalValue) Type() ColumnType { return ColumnTypeDecimal }
+
+func (v DecimalValue) Size() int { return 9 } // 値8byte + スケール1byte
+
+func (v DecimalValue) Encode() []byte {
+	buf := make([]byte, 9)
+	binary.LittleEndian.PutUint64(buf[:8], uint64(v.Unscaled))
+	buf[8] = v.Scale
+	return buf
+}
+
+// ParseDecimal は "-12.340" のような10進数の文字列を DecimalValue にする（スケールは小数部の桁数）
+func ParseDecimal(s string) (DecimalValue, error) {
+	s = strings.TrimSpace(s)
+	digits := strings.TrimLeft(s, "+-")
+	intPart, fracPart, _ := strings.Cut(digits, ".")
+	if intPart == "" && fracPart == "" || strings.Trim(intPart+fracPart, "0123456789") != "" {
+		return DecimalValue{}, fmt.Errorf("%w: invalid decimal %q", ErrInvalidData, s)
+	}
+	if len(fracPart) > MaxDecimalPrecision {
+		return DecimalValue{}, fmt.Errorf("%w: %s", ErrDecimalOverflow, s)
+	}
+	n, ok := new(big.Int).SetString(intPart+fracPart, 10)
+	if !ok {
+		return DecimalValue{}, fmt.Errorf("%w: invalid decimal %q", ErrInvalidData, s)
+	}
+	if strings.HasPrefix(s, "-") {
+		n.Neg(n)
+	}
+	return decimalFromBig(n, uint8(len(fracPart)))
+}
+
+// DecimalFromFloat は浮動小数点数をスケールの桁で四捨五入した DecimalValue にする
+func DecimalFromFloat(f float64, scale uint8) (DecimalValue, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return DecimalValue{}, fmt.Errorf("%w: %v", ErrDecimalOverflow, f)
+	}
+	return ParseDecimal(strconv.FormatFloat(f, 'f', int(scale), 64))
+}
+
+func (v DecimalValue) String() string {
+	s := strconv.FormatInt(v.Unscaled, 10)
+	if v.Scale == 0 {
+		return s
+	}
+	sign := ""
+	if v.Unscaled < 0 {
+		sign, s = "-", s[1:]
+	}
+	if pad := int(v.Scale) + 1 - len(s); pad > 0 {
+		s = strings.Repeat("0", pad) + s
+	}
+	point := len(s) - int(v.Scale)
+	return sign + s[:point] + "." + s[point:]
+}
+
+// Float64 は値を浮動小数点数にする（誤差が出ることがある）
+func (v DecimalValue) Float64() float64 {
+	f, _ := strconv.ParseFloat(v.String(), 64)
+	return f
+}
+
+// Precision は値の桁数を返す
+func (v DecimalValue) Precision() int {
+	return len(strconv.FormatUint(absInt64(v.Unscaled), 10))
+}
+
+// Rescale はスケールを変える（小さくするときは四捨五入する）
+func (v DecimalValue) Rescale(scale uint8) (DecimalValue, error) {
+	if scale > MaxDecimalPrecision {
+		return DecimalValue{}, fmt.Errorf("%w: scale %d", ErrDecimalOverflow, scale)
+	}
+	return decimalFromBig(rescaleBig(v.big(), v.Scale, scale), scale)
+}
+
+// Cmp は2つの値を比べ、v が小さければ負、等しければ 0、大きければ正を返す
+func (v DecimalValue) Cmp(other DecimalValue) int {
+	scale := max(v.Scale, other.Scale)
+	return rescaleBig(v.big(), v.Scale, scale).Cmp(rescaleBig(other.big(), other.Scale, scale))
+}
+
+func (v DecimalValue) Add(other DecimalValue) (DecimalValue, error) {
+	scale := max(v.Scale, other.Scale)
+	sum := new(big.Int).Add(rescaleBig(v.big(), v.Scale, scale), rescaleBig(other.big(), other.Scale, scale))
+	return decimalFromBig(sum, scale)
+}
+
+func (v DecimalValue) Sub(other DecimalValue) (DecimalValue, error) {
+	return v.Add(DecimalValue{Unscaled: -other.Unscaled, Scale: other.Scale})
+}
+
+// Mul は積を返す（スケールは両方のスケールの和で、MaxDecimalPrecision を超える分は四捨五入する）
+func (v DecimalValue) Mul(other DecimalValue) (DecimalValue, error) {
+	product := new(big.Int).Mul(v.big(), other.big())
+	scale := v.Scale + other.Scale
+	if scale > MaxDecimalPrecision {
+		product, scale = rescaleBig(product, scale, MaxDecimalPrecision), MaxDecimalPrecision
+	}
+	return decimalFromBig(product, scale)
+}
+
+// Div は商を返す（スケールは両方のスケールの大きいほうに decimalDivisionScale 桁を足したもの）
+func (v DecimalValue) Div(other DecimalValue) (DecimalValue, error) {
+	if other.Unscaled == 0 {
+		return DecimalValue{}, ErrDivisionByZero
+	}
+	scale := min(max(v.Scale, other.Scale)+decimalDivisionScale, MaxDecimalPrecision)
+	// (a / 10^as) / (b / 10^bs) を 10^scale 倍すると a * 10^(scale+bs-as) / b
+	numerator := rescaleBig(v.big(), v.Scale, scale+other.Scale)
+	return decimalFromBig(roundQuo(numerator, other.big()), scale)
+}
+
+// Mod は v を other で割った余りを返す（符号は v に合わせ、スケールは両方のスケールの大きいほう）
+func (v DecimalValue) Mod(other DecimalValue) (DecimalValue, error) {
+	if other.Unscaled == 0 {
+		return DecimalValue{}, ErrDivisionByZero
+	}
+	scale := max(v.Scale, other.Scale)
+	remainder := new(big.Int).Rem(rescaleBig(v.big(), v.Scale, scale), rescaleBig(other.big(), other.Scale, scale))
+	return decimalFromBig(remainder, scale)
+}
+
+func (v DecimalValue) big() *big.Int {
+	return big.NewInt(v.Unscaled)
+}
+
+// decimalFromBig は int64 に収まらなければ ErrDecimalOverflow を返す
+func decimalFromBig(n *big.Int, scale uint8) (DecimalValue, error) {
+	if !n.IsInt64() {
+		return DecimalValue{}, ErrDecimalOverflow
+	}
+	return DecimalValue{Unscaled: n.Int64(), Scale: scale}, nil
+}
+
+// rescaleBig はスケール from の値をスケール to にする（小さくするときは四捨五入する）
+func rescaleBig(n *big.Int, from, to uint8) *big.Int {
+	switch {
+	case to > from:
+		return new(big.Int).Mul(n, pow10(to-from))
+	case to < from:
+		return roundQuo(n, pow10(from-to))
+	default:
+		return n
+	}
+}
+
+// roundQuo は n / d を四捨五入する（0 から遠いほうに丸める）
+func roundQuo(n, d *big.Int) *big.Int {
+	q, r := new(big.Int).QuoRem(n, d, new(big.Int))
+	if new(big.Int).Mul(new(big.Int).Abs(r), big.NewInt(2)).Cmp(new(big.Int).Abs(d)) >= 0 {
+		if n.Sign()*d.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return q
+}
+
+func pow10(n uint8) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+func absInt64(n int64) uint64 {
+	if n < 0 {
+		return uint64(-(n + 1)) + 1
+	}
+	return uint64(n)
+}
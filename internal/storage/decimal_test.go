@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func mustParseDecimal(t *testing.T, s string) DecimalValue {
+	t.Helper()
+	d, err := ParseDecimal(s)
+	if err != nil {
+		t.Fatalf("ParseDecimal(%q) failed: %v", s, err)
+	}
+	return d
+}
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		input    string
+		unscaled int64
+		scale    uint8
+		str      string
+	}{
+		{"12.34", 1234, 2, "12.34"},
+		{"-0.05", -5, 2, "-0.05"},
+		{"100", 100, 0, "100"},
+		{"0.10", 10, 2, "0.10"},
+		{".5", 5, 1, "0.5"},
+	}
+	for _, tt := range tests {
+		d := mustParseDecimal(t, tt.input)
+		if d.Unscaled != tt.unscaled || d.Scale != tt.scale {
+			t.Errorf("ParseDecimal(%q) = %d/10^%d, want %d/10^%d", tt.input, d.Unscaled, d.Scale, tt.unscaled, tt.scale)
+		}
+		if d.String() != tt.str {
+			t.Errorf("ParseDecimal(%q).String() = %q, want %q", tt.input, d.String(), tt.str)
+		}
+	}
+	for _, input := range []string{"", "abc", "1.2.3", "."} {
+		if _, err := ParseDecimal(input); err == nil {
+			t.Errorf("ParseDecimal(%q) should fail", input)
+		}
+	}
+	if _, err := ParseDecimal("99999999999999999999"); !errors.Is(err, ErrDecimalOverflow) {
+		t.Errorf("expected ErrDecimalOverflow, got %v", err)
+	}
+}
+
+func TestDecimalArithmetic(t *testing.T) {
+	a, b := mustParseDecimal(t, "10.25"), mustParseDecimal(t, "3.5")
+	tests := []struct {
+		name string
+		op   func(DecimalValue, DecimalValue) (DecimalValue, error)
+		want string
+	}{
+		{"add", DecimalValue.Add, "13.75"},
+		{"sub", DecimalValue.Sub, "6.75"},
+		{"mul", DecimalValue.Mul, "35.875"},
+		{"div", DecimalValue.Div, "2.928571"},
+		{"mod", DecimalValue.Mod, "3.25"},
+	}
+	for _, tt := range tests {
+		got, err := tt.op(a, b)
+		if err != nil {
+			t.Fatalf("%s failed: %v", tt.name, err)
+		}
+		if got.String() != tt.want {
+			t.Errorf("%s = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+	if _, err := a.Div(NewDecimal(0, 2)); !errors.Is(err, ErrDivisionByZero) {
+		t.Errorf("expected ErrDivisionByZero, got %v", err)
+	}
+	// 余りの符号は割られる数に合わせ、浮動小数点数の誤差は出ない
+	if got, _ := mustParseDecimal(t, "-123456789012.34").Mod(mustParseDecimal(t, "0.1")); got.String() != "-0.04" {
+		t.Errorf("mod = %s, want -0.04", got)
+	}
+	if _, err := a.Mod(NewDecimal(0, 0)); !errors.Is(err, ErrDivisionByZero) {
+		t.Errorf("expected ErrDivisionByZero, got %v", err)
+	}
+	if _, err := NewDecimal(math.MaxInt64, 0).Add(NewDecimal(1, 0)); !errors.Is(err, ErrDecimalOverflow) {
+		t.Errorf("expected ErrDecimalOverflow, got %v", err)
+	}
+}
+
+func TestDecimalRescaleAndCompare(t *testing.T) {
+	tests := []struct {
+		input string
+		scale uint8
+		want  string
+	}{
+		{"1.005", 2, "1.01"},
+		{"-1.005", 2, "-1.01"},
+		{"1.004", 2, "1.00"},
+		{"2.5", 0, "3"},
+		{"7", 3, "7.000"},
+	}
+	for _, tt := range tests {
+		got, err := mustParseDecimal(t, tt.input).Rescale(tt.scale)
+		if err != nil {
+			t.Fatalf("Rescale failed: %v", err)
+		}
+		if got.String() != tt.want {
+			t.Errorf("%s rescaled to %d = %s, want %s", tt.input, tt.scale, got, tt.want)
+		}
+	}
+	if c := mustParseDecimal(t, "1.5").Cmp(mustParseDecimal(t, "1.50")); c != 0 {
+		t.Errorf("1.5 and 1.50 should be equal, got %d", c)
+	}
+	if c := mustParseDecimal(t, "-2").Cmp(mustParseDecimal(t, "0.01")); c >= 0 {
+		t.Errorf("-2 should be less than 0.01, got %d", c)
+	}
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+)
+
+// MaxVarcharLength は VARCHAR に入る最大のバイト数（長さを2byteで持つため）
+// これより長い文字列は TEXT に入れる
+const MaxVarcharLength = 1<<16 - 1
+
+// TextValue は TEXT カラムの値（長さを4byteで持つ）
+type TextValue string
+
+func (v TextValue) Type() ColumnType { return ColumnTypeText }
+
+func (v TextValue) Size() int { return 4 + len(v) } // 長さ4byte + 文字列
+
+func (v TextValue) Encode() []byte {
+	return encodeLargeValue(string(v))
+}
+
+// BlobValue は BLOB カラムの値
+// 比較できるように、バイト列を string として持つ
+type BlobValue string
+
+func (v BlobValue) Type() ColumnType { return ColumnTypeBlob }
+
+func (v BlobValue) Size() int { return 4 + len(v) } // 長さ4byte + バイト列
+
+func (v BlobValue) Encode() []byte {
+	return encodeLargeValue(string(v))
+}
+
+// String はバイト列を \x から始まる16進数で表す
+func (v BlobValue) String() string {
+	return `\x` + hex.EncodeToString([]byte(v))
+}
+
+func encodeLargeValue(s string) []byte {
+	buf := make([]byte, 4+len(s))
+	binary.LittleEndian.PutUint32(buf[:4], uint32(len(s)))
+	copy(buf[4:], s)
+	return buf
+}
+
+// isLargeValueType はオーバーフローページに置ける型かどうかを返す
+func isLargeValueType(t ColumnType) bool {
+	return t == ColumnTypeText || t == ColumnTypeBlob
+}
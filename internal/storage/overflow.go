@@ -0,0 +1,301 @@
+package storage
+
+import (
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"slices"
+)
+
+// ErrOverflowUnavailable はオーバーフローページに置いた値を、ページを読めないところでデコードしようとしたときに返す
+var ErrOverflowUnavailable = errors.New("value is stored in overflow pages")
+
+// オーバーフローページ
+// TEXT / BLOB の大きな値は行から追い出し、テーブルのファイルの中でページの連鎖として持つ
+// 行には値の代わりに先頭ページと長さ（OverflowRef）を書く
+//
+// レイアウト:
+//
+//	[0:6]   0（スロットページとして読むと行数 0・空き 0 に見えるので、走査や挿入の対象にならない）
+//	[6]     ページの種類（pageKindOverflow / pageKindFree）
+//	[8:16]  次のページID（最後のページなら -1）
+//	[16:18] このページに入っているバイト数
+//	[18:]   値の続き
+const (
+	overflowPageHeaderSize = 18
+	overflowPageCapacity   = pageSize - overflowPageHeaderSize
+
+	pageKindOverflow byte = 1 // 値の一部を持つページ
+	pageKindFree     byte = 2 // 解放されて再利用を待つページ
+
+	noNextPage PageID = -1
+
+	// overflowRefSize は OverflowRef をエンコードしたサイズ（先頭ページ8byte + 長さ4byte）
+	overflowRefSize = 12
+
+	// maxInlineRowSize はページにそのまま書く行の最大サイズ
+	// これを超える行は大きな TEXT / BLOB の値から順にオーバーフローページへ追い出す（1ページに4行以上入るように）
+	maxInlineRowSize = (pageSize-PageHeaderSize)/4 - SlotSize
+)
+
+// OverflowRef はオーバーフローページに置いた値の位置
+type OverflowRef struct {
+	PageID PageID // 連鎖の先頭のページ
+	Length uint32 // 値のバイト数
+}
+
+func (r OverflowRef) encode() []byte {
+	buf := make([]byte, overflowRefSize)
+	binary.LittleEndian.PutUint64(buf[:8], uint64(r.PageID))
+	binary.LittleEndian.PutUint32(buf[8:12], r.Length)
+	return buf
+}
+
+func decodeOverflowRef(data []byte) OverflowRef {
+	return OverflowRef{
+		PageID: PageID(binary.LittleEndian.Uint64(data[:8])),
+		Length: binary.LittleEndian.Uint32(data[8:12]),
+	}
+}
+
+// OverflowReader はオーバーフローページに置いた値を読む
+type OverflowReader interface {
+	ReadOverflow(ref OverflowRef) ([]byte, error)
+}
+
+func readOverflowValue(overflow OverflowReader, ref OverflowRef, columnType ColumnType) (Value, error) {
+	if overflow == nil {
+		return nil, ErrOverflowUnavailable
+	}
+	data, err := overflow.ReadOverflow(ref)
+	if err != nil {
+		return nil, err
+	}
+	return newLargeValue(columnType, data), nil
+}
+
+func newLargeValue(columnType ColumnType, data []byte) Value {
+	if columnType == ColumnTypeBlob {
+		return BlobValue(data)
+	}
+	return TextValue(data)
+}
+
+// isSlottedPage はページがスロットページかどうかを返す（スロットページの空き領域は必ずヘッダーの後ろから始まる）
+func isSlottedPage(data []byte) bool {
+	return binary.LittleEndian.Uint16(data[2:4]) >= PageHeaderSize
+}
+
+// overflowReader はテーブルのオーバーフローページを読む
+// 呼び出し側はテーブルの mu を持っていること
+type overflowReader struct {
+	table *Table
+}
+
+func (r overflowReader) ReadOverflow(ref OverflowRef) ([]byte, error) {
+	data := make([]byte, 0, ref.Length)
+	err := r.table.walkOverflow(ref, func(pageID PageID, payload []byte) error {
+		data = append(data, payload...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != int(ref.Length) {
+		return nil, ErrInvalidData
+	}
+	return data, nil
+}
+
+// overflowCollector は値を読まずに、行が参照しているオーバーフローページの位置を集める
+type overflowCollector struct {
+	refs []OverflowRef
+}
+
+func (c *overflowCollector) ReadOverflow(ref OverflowRef) ([]byte, error) {
+	c.refs = append(c.refs, ref)
+	return nil, nil
+}
+
+// decodeStoredRow はページに書かれた行をデコードする（オーバーフローページの値も読む）
+// 呼び出し側は mu を持っていること
+func (t *Table) decodeStoredRow(data []byte) (*Row, error) {
+	return DecodeRowWithOverflow(data, t.schema, overflowReader{table: t})
+}
+
+// storedOverflowRefs はページに書かれた行が参照しているオーバーフローページの位置を返す
+func (t *Table) storedOverflowRefs(data []byte) ([]OverflowRef, error) {
+	collector := &overflowCollector{}
+	if _, err := DecodeRowWithOverflow(data, t.schema, collector); err != nil {
+		return nil, err
+	}
+	return collector.refs, nil
+}
+
+// encodeStoredRow はページに書く形に行をエンコードする
+// 行が大きすぎれば TEXT / BLOB の値を大きいものから順にオーバーフローページへ書き出す
+// 戻り値の refs は書き出した値の位置（行を書けなかったときに解放する）
+// 呼び出し側は mu を持っていること
+func (t *Table) encodeStoredRow(row *Row) (data []byte, refs []OverflowRef, err error) {
+	data = row.Encode()
+	if len(data) <= maxInlineRowSize {
+		return data, nil, nil
+	}
+	values := row.GetValues()
+	var candidates []int
+	for i, v := range values {
+		if v != nil && isLargeValueType(v.Type()) && v.Size() > overflowRefSize {
+			candidates = append(candidates, i)
+		}
+	}
+	slices.SortStableFunc(candidates, func(a, b int) int {
+		return cmp.Compare(values[b].Size(), values[a].Size())
+	})
+	size := len(data)
+	spilled := make(map[int]OverflowRef)
+	for _, i := range candidates {
+		if size <= maxInlineRowSize {
+			break
+		}
+		payload := values[i].Encode()[4:] // 長さの4byteを除いた値
+		ref, err := t.writeOverflow(payload)
+		if err != nil {
+			t.freeOverflowRefs(refs)
+			return nil, nil, err
+		}
+		spilled[i] = ref
+		refs = append(refs, ref)
+		size -= values[i].Size() - overflowRefSize
+	}
+	return encodeRow(row.GetRowID(), values, spilled), refs, nil
+}
+
+// writeOverflow は値をオーバーフローページの連鎖に書き出す
+// 解放済みのページがあれば再利用し、なければテーブルの末尾にページを足す
+// 行より先にディスクへ書き出すので、書き出された行が書き出されていないページを指すことはない
+func (t *Table) writeOverflow(payload []byte) (OverflowRef, error) {
+	pageCount := max(1, (len(payload)+overflowPageCapacity-1)/overflowPageCapacity)
+	pageIDs := make([]PageID, pageCount)
+	for i := range pageIDs {
+		pageIDs[i] = t.takeFreePage()
+	}
+	for i, pageID := range pageIDs {
+		chunk := payload[min(i*overflowPageCapacity, len(payload)):min((i+1)*overflowPageCapacity, len(payload))]
+		next := noNextPage
+		if i+1 < len(pageIDs) {
+			next = pageIDs[i+1]
+		}
+		var data [pageSize]byte
+		data[6] = pageKindOverflow
+		binary.LittleEndian.PutUint64(data[8:16], uint64(next))
+		binary.LittleEndian.PutUint16(data[16:18], uint16(len(chunk)))
+		copy(data[overflowPageHeaderSize:], chunk)
+		if err := t.writeRawPage(pageID, data); err != nil {
+			return OverflowRef{}, err
+		}
+		if err := t.pool.FlushPage(t.pager, pageID); err != nil {
+			return OverflowRef{}, err
+		}
+	}
+	return OverflowRef{PageID: pageIDs[0], Length: uint32(len(payload))}, nil
+}
+
+// takeFreePage は再利用するページか、テーブルの末尾の新しいページのIDを返す
+func (t *Table) takeFreePage() PageID {
+	if n := len(t.freePages); n > 0 {
+		pageID := t.freePages[n-1]
+		t.freePages = t.freePages[:n-1]
+		return pageID
+	}
+	pageID := t.numPages.ToPageID()
+	t.numPages++
+	return pageID
+}
+
+// writeRawPage はページの内容をバッファプールに書き込んでダーティにする
+// まだファイルにないページ（takeFreePage で末尾に足したページ）ならプールに新しく作る
+func (t *Table) writeRawPage(pageID PageID, data [pageSize]byte) error {
+	var page *Page
+	var err error
+	if uint32(pageID) >= t.pager.GetNumPages() {
+		page, err = t.pool.NewPage(t.pager, pageID)
+	} else {
+		page, err = t.pool.FetchPage(t.pager, pageID)
+	}
+	if err != nil {
+		return err
+	}
+	copy(page.data, data[:])
+	return t.pool.UnpinPage(t.pager, pageID, true)
+}
+
+// walkOverflow は連鎖のページを先頭から順に読み、ページごとの値の断片を fn に渡す
+func (t *Table) walkOverflow(ref OverflowRef, fn func(pageID PageID, payload []byte) error) error {
+	remaining := int(ref.Length)
+	pageID := ref.PageID
+	for {
+		if pageID < 0 || pageID >= t.numPages.ToPageID() {
+			return ErrInvalidData
+		}
+		page, err := t.getPage(pageID)
+		if err != nil {
+			return err
+		}
+		data := page.Data()
+		length := int(binary.LittleEndian.Uint16(data[16:18]))
+		if isSlottedPage(data[:]) || data[6] != pageKindOverflow || length > overflowPageCapacity || length > remaining {
+			return ErrInvalidData
+		}
+		if err := fn(pageID, data[overflowPageHeaderSize:overflowPageHeaderSize+length]); err != nil {
+			return err
+		}
+		remaining -= length
+		next := PageID(binary.LittleEndian.Uint64(data[8:16]))
+		if next == noNextPage {
+			return nil
+		}
+		if remaining == 0 {
+			return ErrInvalidData // 長さを超えて続く連鎖は壊れている
+		}
+		pageID = next
+	}
+}
+
+// freeOverflowRefs は値を置いていたページを解放し、次の書き出しで再利用する
+func (t *Table) freeOverflowRefs(refs []OverflowRef) error {
+	for _, ref := range refs {
+		var pageIDs []PageID
+		err := t.walkOverflow(ref, func(pageID PageID, payload []byte) error {
+			pageIDs = append(pageIDs, pageID)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, pageID := range pageIDs {
+			var data [pageSize]byte
+			data[6] = pageKindFree
+			if err := t.writeRawPage(pageID, data); err != nil {
+				return err
+			}
+			t.freePages = append(t.freePages, pageID)
+		}
+	}
+	return nil
+}
+
+// freeStoredRow はページに書かれた行が参照しているオーバーフローページを解放する
+func (t *Table) freeStoredRow(data []byte) error {
+	refs, err := t.storedOverflowRefs(data)
+	if err != nil {
+		return err
+	}
+	return t.freeOverflowRefs(refs)
+}
+
+// GetFreePageCount は再利用を待っているページの数を返す
+func (t *Table) GetFreePageCount() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.freePages)
+}
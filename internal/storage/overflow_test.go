@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func newDocumentTestTable(t *testing.T, pager *Pager) *Table {
+	t.Helper()
+	schema := NewSchema("documents", []Column{
+		*NewColumn("id", ColumnTypeInt32, 4, false),
+		*NewColumn("body", ColumnTypeText, 0, true),
+		*NewColumn("data", ColumnTypeBlob, 0, true),
+	})
+	table, err := NewTable("documents", schema, pager)
+	if err != nil {
+		t.Fatalf("NewTable failed: %v", err)
+	}
+	return table
+}
+
+func TestTableOverflowRoundTrip(t *testing.T) {
+	pager := newTestPager(t, "documents.db")
+	table := newDocumentTestTable(t, pager)
+
+	body := TextValue(strings.Repeat("あいうえお", 5000)) // 75000 byte
+	blob := BlobValue(strings.Repeat("\x00\xff", 3000))
+	small := TextValue("short")
+	for i, values := range [][]Value{
+		{Int32Value(1), body, blob},
+		{Int32Value(2), small, nil},
+	} {
+		if err := table.Insert(NewRow(values)); err != nil {
+			t.Fatalf("Insert(%d) failed: %v", i, err)
+		}
+	}
+	if table.numPages < 20 {
+		t.Fatalf("expected overflow pages, got %d pages", table.numPages)
+	}
+
+	row, err := table.FindByRowID(1)
+	if err != nil {
+		t.Fatalf("FindByRowID failed: %v", err)
+	}
+	if row.GetValues()[1] != body || row.GetValues()[2] != blob {
+		t.Error("large values were not read back")
+	}
+	rows, err := table.Scan()
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if len(rows) != 2 || rows[0].GetValues()[1] != body || rows[1].GetValues()[1] != small {
+		t.Errorf("Scan returned unexpected rows: %d", len(rows))
+	}
+
+	// 閉じて開き直しても読める
+	if err := table.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	reopened := newDocumentTestTable(t, pager)
+	row, err = reopened.FindByRowID(1)
+	if err != nil || row.GetValues()[1] != body {
+		t.Fatalf("FindByRowID after reopen = %v, %v", row, err)
+	}
+	if reopened.GetFreePageCount() != 0 {
+		t.Errorf("expected no free pages, got %d", reopened.GetFreePageCount())
+	}
+}
+
+func TestTableOverflowFreedOnUpdateAndDelete(t *testing.T) {
+	pager := newTestPager(t, "documents.db")
+	table := newDocumentTestTable(t, pager)
+
+	body := TextValue(strings.Repeat("x", 20000))
+	if err := table.Insert(NewRow([]Value{Int32Value(1), body, nil})); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	pages := table.numPages
+
+	// 小さな値に更新すると古いページは解放される
+	old, err := table.Update(1, NewRow([]Value{Int32Value(1), TextValue("small"), nil}))
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if old.GetValues()[1] != body {
+		t.Error("Update should return the old large value")
+	}
+	freed := table.GetFreePageCount()
+	if freed < 5 {
+		t.Fatalf("expected freed overflow pages, got %d", freed)
+	}
+
+	// 解放したページは再利用され、ファイルは伸びない
+	if err := table.Insert(NewRow([]Value{Int32Value(2), body, nil})); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if table.numPages != pages {
+		t.Errorf("expected %d pages after reuse, got %d", pages, table.numPages)
+	}
+	if _, err := table.Delete(2); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if table.GetFreePageCount() != freed {
+		t.Errorf("expected %d free pages after delete, got %d", freed, table.GetFreePageCount())
+	}
+
+	// 開き直すと参照されていないページは空きページとして見つかる
+	if err := table.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	reopened := newDocumentTestTable(t, pager)
+	if reopened.GetFreePageCount() != freed {
+		t.Errorf("expected %d free pages after reopen, got %d", freed, reopened.GetFreePageCount())
+	}
+	rows, err := reopened.Scan()
+	if err != nil || len(rows) != 1 || rows[0].GetValues()[1] != TextValue("small") {
+		t.Errorf("Scan after reopen = %v, %v", rows, err)
+	}
+}
+
+func TestDecodeRowWithoutOverflowReader(t *testing.T) {
+	schema := NewSchema("documents", []Column{
+		*NewColumn("id", ColumnTypeInt32, 4, false),
+		*NewColumn("body", ColumnTypeText, 0, true),
+	})
+	data := encodeRow(1, []Value{Int32Value(1), TextValue("spilled")}, map[int]OverflowRef{1: {PageID: 3, Length: 7}})
+	if _, err := DecodeRow(data, schema); !errors.Is(err, ErrOverflowUnavailable) {
+		t.Errorf("expected ErrOverflowUnavailable, got %v", err)
+	}
+	collector := &overflowCollector{}
+	if _, err := DecodeRowWithOverflow(data, schema, collector); err != nil {
+		t.Fatalf("DecodeRowWithOverflow failed: %v", err)
+	}
+	if len(collector.refs) != 1 || collector.refs[0] != (OverflowRef{PageID: 3, Length: 7}) {
+		t.Errorf("unexpected refs: %v", collector.refs)
+	}
+
+	// インラインの TEXT / BLOB は4byteの長さを持つ
+	long := TextValue(strings.Repeat("a", 70000))
+	decoded, err := DecodeRow(NewRowWithID(2, []Value{Int32Value(2), long}).Encode(), schema)
+	if err != nil || decoded.GetValues()[1] != long {
+		t.Errorf("inline TEXT round trip failed: %v", err)
+	}
+}
+
+func TestCastLargeValues(t *testing.T) {
+	text := NewColumn("body", ColumnTypeText, 0, false)
+	blob := NewColumn("data", ColumnTypeBlob, 0, false)
+	varchar := NewColumn("name", ColumnTypeString, 255, false)
+
+	if v, err := CastValue(StringValue("abc"), text); err != nil || v != TextValue("abc") {
+		t.Errorf("CastValue to TEXT = %#v, %v", v, err)
+	}
+	if v, err := CastValue(StringValue("\x01\x02"), blob); err != nil || v.(BlobValue).String() != `\x0102` {
+		t.Errorf("CastValue to BLOB = %#v, %v", v, err)
+	}
+	if _, err := CastValue(TextValue(strings.Repeat("a", MaxVarcharLength+1)), varchar); !errors.Is(err, ErrValueOutOfRange) {
+		t.Errorf("expected ErrValueOutOfRange for a long VARCHAR, got %v", err)
+	}
+	if c, err := CompareValues(TextValue("b"), StringValue("a")); err != nil || c <= 0 {
+		t.Errorf("CompareValues(TEXT, VARCHAR) = %d, %v", c, err)
+	}
+	if _, err := CompareValues(BlobValue("a"), StringValue("a")); !errors.Is(err, ErrIncomparableValues) {
+		t.Errorf("expected ErrIncomparableValues for BLOB and VARCHAR, got %v", err)
+	}
+}
@@ -2,6 +2,9 @@ package storage
 
 const pageSize = 4096
 
+// PageSize はページのバイト数（他パッケージでページを組み立てるときに使う）
+const PageSize = pageSize
+
 type PageID int64
 
 type Page struct {
@@ -21,3 +24,14 @@ func NewPage(id PageID, data []byte) *Page {
 func (p Page) GetOffset() int64 {
 	return int64(p.id) * pageSize
 }
+
+// GetID はページIDを返す
+func (p *Page) GetID() PageID {
+	return p.id
+}
+
+// Data はページのバイト列を返す
+// バッファプールから取得したページの場合はフレームを直接指すので、ピン留め中にだけ触ること
+func (p *Page) Data() []byte {
+	return p.data
+}
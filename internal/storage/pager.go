@@ -3,6 +3,7 @@ package storage
 import (
 	"errors"
 	"os"
+	"path/filepath"
 )
 
 var ErrInvalidPageID = errors.New("invalid page ID")
@@ -54,15 +55,33 @@ func (p *Pager) WritePage(page *Page) error {
 	if err != nil {
 		return err
 	}
+	// ファイル末尾を越えて書き込んだ場合はページ数を更新
+	if uint32(page.id) >= p.numPages {
+		p.numPages = uint32(page.id) + 1
+	}
 
 	return nil
 }
 
-// Close closes the Pager and the underlying file.
+// Sync flushes the written pages to stable storage.
+func (p *Pager) Sync() error {
+	return p.file.Sync()
+}
+
+// Close syncs and closes the Pager and the underlying file.
 func (p *Pager) Close() error {
+	if err := p.file.Sync(); err != nil {
+		p.file.Close()
+		return err
+	}
 	return p.file.Close()
 }
 
+// GetName returns the base name of the file.
+func (p *Pager) GetName() string {
+	return filepath.Base(p.file.Name())
+}
+
 func (p *Pager) GetNumPages() uint32 {
 	return p.numPages
 }
@@ -0,0 +1,181 @@
+package storage
+
+import "container/list"
+
+// FrameID はバッファプール内のフレーム番号
+type FrameID int
+
+// Replacer はバッファプールの追い出し対象を選ぶポリシー
+type Replacer interface {
+	// RecordAccess はフレームへのアクセスを記録する
+	RecordAccess(frameID FrameID)
+	// SetEvictable はフレームを追い出し可能にするかどうかを設定する（ピン数 0 で追い出し可能）
+	SetEvictable(frameID FrameID, evictable bool)
+	// Evict は追い出すフレームを選ぶ
+	Evict() (FrameID, bool)
+	// Remove はフレームを追跡対象から外す
+	Remove(frameID FrameID)
+	// Size は追い出し可能なフレーム数を返す
+	Size() int
+}
+
+// EvictionPolicy は追い出しポリシーの種類
+type EvictionPolicy int
+
+const (
+	EvictionPolicyLRU EvictionPolicy = iota + 1
+	EvictionPolicyClock
+)
+
+// NewReplacer はポリシーに対応する Replacer を作成する
+func NewReplacer(policy EvictionPolicy, capacity int) Replacer {
+	switch policy {
+	case EvictionPolicyClock:
+		return NewClockReplacer(capacity)
+	default:
+		return NewLRUReplacer(capacity)
+	}
+}
+
+// ============ LRU ============
+
+// lruReplacer は最も長くアクセスされていないフレームを追い出す
+type lruReplacer struct {
+	// 先頭が最近アクセスしたフレーム、末尾が最も古いフレーム
+	order     *list.List
+	elements  map[FrameID]*list.Element
+	evictable map[FrameID]bool
+	size      int
+}
+
+func NewLRUReplacer(capacity int) Replacer {
+	return &lruReplacer{
+		order:     list.New(),
+		elements:  make(map[FrameID]*list.Element, capacity),
+		evictable: make(map[FrameID]bool, capacity),
+	}
+}
+
+func (r *lruReplacer) RecordAccess(frameID FrameID) {
+	if elem, ok := r.elements[frameID]; ok {
+		r.order.MoveToFront(elem)
+		return
+	}
+	r.elements[frameID] = r.order.PushFront(frameID)
+}
+
+func (r *lruReplacer) SetEvictable(frameID FrameID, evictable bool) {
+	if _, ok := r.elements[frameID]; !ok {
+		return
+	}
+	if r.evictable[frameID] == evictable {
+		return
+	}
+	r.evictable[frameID] = evictable
+	if evictable {
+		r.size++
+	} else {
+		r.size--
+	}
+}
+
+func (r *lruReplacer) Evict() (FrameID, bool) {
+	for elem := r.order.Back(); elem != nil; elem = elem.Prev() {
+		frameID := elem.Value.(FrameID)
+		if r.evictable[frameID] {
+			r.Remove(frameID)
+			return frameID, true
+		}
+	}
+	return 0, false
+}
+
+func (r *lruReplacer) Remove(frameID FrameID) {
+	elem, ok := r.elements[frameID]
+	if !ok {
+		return
+	}
+	if r.evictable[frameID] {
+		r.size--
+	}
+	r.order.Remove(elem)
+	delete(r.elements, frameID)
+	delete(r.evictable, frameID)
+}
+
+func (r *lruReplacer) Size() int {
+	return r.size
+}
+
+// ============ Clock ============
+
+// clockReplacer は参照ビットを使った Second Chance 方式で追い出す
+type clockReplacer struct {
+	tracked    []bool // フレームを追跡しているか
+	referenced []bool // 参照ビット
+	evictable  []bool
+	hand       int
+	size       int
+}
+
+func NewClockReplacer(capacity int) Replacer {
+	return &clockReplacer{
+		tracked:    make([]bool, capacity),
+		referenced: make([]bool, capacity),
+		evictable:  make([]bool, capacity),
+	}
+}
+
+func (r *clockReplacer) RecordAccess(frameID FrameID) {
+	r.tracked[frameID] = true
+	r.referenced[frameID] = true
+}
+
+func (r *clockReplacer) SetEvictable(frameID FrameID, evictable bool) {
+	if !r.tracked[frameID] || r.evictable[frameID] == evictable {
+		return
+	}
+	r.evictable[frameID] = evictable
+	if evictable {
+		r.size++
+	} else {
+		r.size--
+	}
+}
+
+func (r *clockReplacer) Evict() (FrameID, bool) {
+	if r.size == 0 {
+		return 0, false
+	}
+	// 参照ビットが立っているフレームは1周だけ猶予を与えるので、最大2周で必ず見つかる
+	for i := 0; i < 2*len(r.tracked); i++ {
+		frameID := FrameID(r.hand)
+		r.hand = (r.hand + 1) % len(r.tracked)
+		if !r.tracked[frameID] || !r.evictable[frameID] {
+			continue
+		}
+		if r.referenced[frameID] {
+			r.referenced[frameID] = false
+			continue
+		}
+		r.Remove(frameID)
+		return frameID, true
+	}
+	return 0, false
+}
+
+func (r *clockReplacer) Remove(frameID FrameID) {
+	if !r.tracked[frameID] {
+		return
+	}
+	if r.evictable[frameID] {
+		r.size--
+	}
+	r.tracked[frameID] = false
+	r.referenced[frameID] = false
+	r.evictable[frameID] = false
+}
+
+func (r *clockReplacer) Size() int {
+	return r.size
+}
@@ -0,0 +1,81 @@
+package storage
+
+import "testing"
+
+// =============================================================================
+// Replacer Tests
+// =============================================================================
+
+func TestLRUReplacerEvictsLeastRecentlyUsed(t *testing.T) {
+	r := NewLRUReplacer(3)
+	for i := 0; i < 3; i++ {
+		r.RecordAccess(FrameID(i))
+		r.SetEvictable(FrameID(i), true)
+	}
+	// フレーム0に再アクセスすると、最も古いのはフレーム1になる
+	r.RecordAccess(0)
+
+	if r.Size() != 3 {
+		t.Fatalf("Size() = %d, want 3", r.Size())
+	}
+	frameID, ok := r.Evict()
+	if !ok || frameID != 1 {
+		t.Errorf("Evict() = (%d, %v), want (1, true)", frameID, ok)
+	}
+	frameID, ok = r.Evict()
+	if !ok || frameID != 2 {
+		t.Errorf("Evict() = (%d, %v), want (2, true)", frameID, ok)
+	}
+}
+
+func TestLRUReplacerSkipsPinnedFrames(t *testing.T) {
+	r := NewLRUReplacer(2)
+	r.RecordAccess(0)
+	r.RecordAccess(1)
+	r.SetEvictable(1, true)
+
+	frameID, ok := r.Evict()
+	if !ok || frameID != 1 {
+		t.Errorf("Evict() = (%d, %v), want (1, true)", frameID, ok)
+	}
+	if _, ok := r.Evict(); ok {
+		t.Error("Evict() should fail when only pinned frames remain")
+	}
+}
+
+func TestClockReplacerSecondChance(t *testing.T) {
+	r := NewClockReplacer(3)
+	for i := 0; i < 3; i++ {
+		r.RecordAccess(FrameID(i))
+		r.SetEvictable(FrameID(i), true)
+	}
+
+	// 全フレームの参照ビットが立っているので1周目で全てクリアされ、フレーム0が選ばれる
+	frameID, ok := r.Evict()
+	if !ok || frameID != 0 {
+		t.Errorf("Evict() = (%d, %v), want (0, true)", frameID, ok)
+	}
+	// フレーム1に再アクセスすると参照ビットが立ち、次はフレーム2が選ばれる
+	r.RecordAccess(1)
+	frameID, ok = r.Evict()
+	if !ok || frameID != 2 {
+		t.Errorf("Evict() = (%d, %v), want (2, true)", frameID, ok)
+	}
+	if r.Size() != 1 {
+		t.Errorf("Size() = %d, want 1", r.Size())
+	}
+}
+
+func TestClockReplacerRemove(t *testing.T) {
+	r := NewClockReplacer(2)
+	r.RecordAccess(0)
+	r.SetEvictable(0, true)
+	r.Remove(0)
+
+	if r.Size() != 0 {
+		t.Errorf("Size() = %d, want 0", r.Size())
+	}
+	if _, ok := r.Evict(); ok {
+		t.Error("Evict() should fail after Remove")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"encoding/gob"
 	"errors"
+	"math"
 )
 
 var (
@@ -41,20 +42,37 @@ func (r *Row) GetValues() []Value {
 }
 
 func (r *Row) Encode() []byte {
+	return encodeRow(r.rowID, r.values, nil)
+}
+
+// 各カラムの値の先頭に付けるフラグ
+const (
+	valueFlagNull     byte = 0 // NULL
+	valueFlagInline   byte = 1 // 値がそのまま続く
+	valueFlagOverflow byte = 2 // オーバーフローページの位置（OverflowRef）が続く
+)
+
+// encodeRow は行をエンコードする
+// spilled にあるカラムは値の代わりにオーバーフローページの位置を書く
+func encodeRow(rowID int64, values []Value, spilled map[int]OverflowRef) []byte {
 	var buf []byte
 	// 1. 行IDをエンコード
 	rowIDBytes := make([]byte, 8)
-	binary.LittleEndian.PutUint64(rowIDBytes, uint64(r.rowID))
+	binary.LittleEndian.PutUint64(rowIDBytes, uint64(rowID))
 	buf = append(buf, rowIDBytes...)
 
 	// 2. 各カラムの値をエンコード
-	for _, v := range r.values {
+	for i, v := range values {
 		if v == nil {
 			// NULLの場合: 1byte目に0を書く
-			buf = append(buf, 0)
+			buf = append(buf, valueFlagNull)
+		} else if ref, ok := spilled[i]; ok {
+			// オーバーフローページに置いた場合: 1byte目に2、その後に位置
+			buf = append(buf, valueFlagOverflow)
+			buf = append(buf, ref.encode()...)
 		} else {
 			// 非NULLの場合: 1byte目に1、その後に値
-			buf = append(buf, 1)
+			buf = append(buf, valueFlagInline)
 			buf = append(buf, v.Encode()...)
 		}
 	}
@@ -63,7 +81,13 @@ func (r *Row) Encode() []byte {
 }
 
 // DecodeRow はバイト列から行をデシリアライズ
+// オーバーフローページに置いた値を含む行は読めない（テーブルのページにある行は Table を通して読む）
 func DecodeRow(data []byte, schema *Schema) (*Row, error) {
+	return DecodeRowWithOverflow(data, schema, nil)
+}
+
+// DecodeRowWithOverflow はバイト列から行をデシリアライズし、オーバーフローページに置いた値を overflow から読む
+func DecodeRowWithOverflow(data []byte, schema *Schema, overflow OverflowReader) (*Row, error) {
 	if len(data) < 8 {
 		return nil, ErrInvalidData
 	}
@@ -79,13 +103,26 @@ func DecodeRow(data []byte, schema *Schema) (*Row, error) {
 		}
 
 		// NULLチェック
-		isNull := data[offset] == 0
+		flag := data[offset]
 		offset++
 
-		if isNull {
+		if flag == valueFlagNull {
 			values[i] = nil
 			continue
 		}
+		if flag == valueFlagOverflow {
+			if !isLargeValueType(col.GetColumnType()) || offset+overflowRefSize > len(data) {
+				return nil, ErrInvalidData
+			}
+			ref := decodeOverflowRef(data[offset:])
+			offset += overflowRefSize
+			value, err := readOverflowValue(overflow, ref, col.GetColumnType())
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+			continue
+		}
 
 		// 型に応じてデコード
 		switch col.GetColumnType() {
@@ -99,6 +136,31 @@ func DecodeRow(data []byte, schema *Schema) (*Row, error) {
 			values[i] = Int64Value(val)
 			offset += 8
 
+		case ColumnTypeFloat32:
+			values[i] = Float32Value(math.Float32frombits(binary.LittleEndian.Uint32(data[offset:])))
+			offset += 4
+
+		case ColumnTypeFloat64:
+			values[i] = Float64Value(math.Float64frombits(binary.LittleEndian.Uint64(data[offset:])))
+			offset += 8
+
+		case ColumnTypeDecimal:
+			unscaled := int64(binary.LittleEndian.Uint64(data[offset:]))
+			values[i] = DecimalValue{Unscaled: unscaled, Scale: data[offset+8]}
+			offset += 9
+
+		case ColumnTypeDate:
+			values[i] = DateValue(int32(binary.LittleEndian.Uint32(data[offset:])))
+			offset += 4
+
+		case ColumnTypeTime:
+			values[i] = TimeValue(int64(binary.LittleEndian.Uint64(data[offset:])))
+			offset += 8
+
+		case ColumnTypeTimestamp:
+			values[i] = TimestampValue(int64(binary.LittleEndian.Uint64(data[offset:])))
+			offset += 8
+
 		case ColumnTypeString:
 			// 長さを読む（2byte）
 			length := binary.LittleEndian.Uint16(data[offset:])
@@ -112,6 +174,19 @@ func DecodeRow(data []byte, schema *Schema) (*Row, error) {
 			values[i] = BoolValue(data[offset] == 1)
 			offset++
 
+		case ColumnTypeText, ColumnTypeBlob:
+			// 長さを読む（4byte）
+			if offset+4 > len(data) {
+				return nil, ErrInvalidData
+			}
+			length := int(binary.LittleEndian.Uint32(data[offset:]))
+			offset += 4
+			if offset+length > len(data) {
+				return nil, ErrInvalidData
+			}
+			values[i] = newLargeValue(col.GetColumnType(), data[offset:offset+length])
+			offset += length
+
 		default:
 			return nil, ErrInvalidType
 		}
@@ -1,11 +1,26 @@
 package storage
 
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrColumnNotFound  = errors.New("column not found")
+	ErrAmbiguousColumn = errors.New("ambiguous column")
+	ErrUnknownTable    = errors.New("unknown table")
+)
+
 // カラムを定義する
 type Column struct {
+	table      string // カラムが属するテーブル名（結合したスキーマで修飾名を解決する）
 	name       string
 	columnType ColumnType
 	size       uint16
+	scale      uint8 // DECIMAL の小数部の桁数
 	nullable   bool
+	primaryKey bool
+	hidden     bool // USING でまとめた元のカラム（テーブル名で修飾したときだけ参照でき、* には含めない）
 }
 
 // カラムを作成する
@@ -18,6 +33,11 @@ func (c *Column) GetName() string {
 	return c.name
 }
 
+// カラムが属するテーブル名を取得する
+func (c *Column) GetTableName() string {
+	return c.table
+}
+
 // カラムの型を取得する
 func (c *Column) GetColumnType() ColumnType {
 	return c.columnType
@@ -28,11 +48,46 @@ func (c *Column) GetSize() uint16 {
 	return c.size
 }
 
+// カラムのスケール（DECIMAL の小数部の桁数）を取得する
+func (c *Column) GetScale() uint8 {
+	return c.scale
+}
+
+// カラムが属するテーブル名を設定する
+func (c *Column) SetTableName(tableName string) {
+	c.table = tableName
+}
+
+// カラムのスケールを設定する
+func (c *Column) SetScale(scale uint8) {
+	c.scale = scale
+}
+
 // カラムのnullableを取得する
 func (c *Column) GetNullable() bool {
 	return c.nullable
 }
 
+// カラムが主キーかどうかを取得する
+func (c *Column) GetPrimaryKey() bool {
+	return c.primaryKey
+}
+
+// カラムを主キーとして設定する
+func (c *Column) SetPrimaryKey(primaryKey bool) {
+	c.primaryKey = primaryKey
+}
+
+// カラムが USING でまとめた元のカラムかどうかを取得する
+func (c *Column) GetHidden() bool {
+	return c.hidden
+}
+
+// カラムを USING でまとめた元のカラムとして設定する
+func (c *Column) SetHidden(hidden bool) {
+	c.hidden = hidden
+}
+
 // スキーマを定義する
 type Schema struct {
 	tableName string
@@ -40,7 +95,25 @@ type Schema struct {
 }
 
 // スキーマを作成する
+// テーブル名のないカラムはこのスキーマのテーブルに属する
 func NewSchema(tableName string, columns []Column) *Schema {
+	for i := range columns {
+		if columns[i].table == "" {
+			columns[i].table = tableName
+		}
+	}
+	return &Schema{tableName: tableName, columns: columns}
+}
+
+// WithTableName はすべてのカラムを別のテーブル名（別名）に属させたスキーマを返す
+// 別名を付けたカラムはどれも名前だけで参照できる
+func (s *Schema) WithTableName(tableName string) *Schema {
+	columns := make([]Column, len(s.columns))
+	copy(columns, s.columns)
+	for i := range columns {
+		columns[i].table = tableName
+		columns[i].hidden = false
+	}
 	return &Schema{tableName: tableName, columns: columns}
 }
 
@@ -69,9 +142,60 @@ func (s *Schema) GetColumnIndex(name string) int {
 	return -1
 }
 
+// FindColumn は table.name のカラムのインデックスを取得する
+// table が空なら名前だけで探し、別々のテーブルに同じ名前のカラムがあれば ErrAmbiguousColumn を返す
+// （USING でまとめた元のカラムは名前だけでは探さない）
+// table があればそのテーブルのカラムからしか探さない（そのテーブルがなければ ErrUnknownTable を返す）
+func (s *Schema) FindColumn(table, name string) (int, error) {
+	if table == "" {
+		found := -1
+		for i, col := range s.columns {
+			if col.name != name || col.hidden {
+				continue
+			}
+			if found >= 0 && s.columns[found].table != col.table {
+				return -1, fmt.Errorf("%w: %s", ErrAmbiguousColumn, name)
+			}
+			if found < 0 {
+				found = i
+			}
+		}
+		if found < 0 {
+			return -1, fmt.Errorf("%w: %s", ErrColumnNotFound, name)
+		}
+		return found, nil
+	}
+	known := false
+	for i, col := range s.columns {
+		if col.table != table {
+			continue
+		}
+		if col.name == name {
+			return i, nil
+		}
+		known = true
+	}
+	if !known {
+		return -1, fmt.Errorf("%w: %s (column %s.%s)", ErrUnknownTable, table, table, name)
+	}
+	return -1, fmt.Errorf("%w: %s.%s", ErrColumnNotFound, table, name)
+}
+
+// 主キーカラムのインデックスを取得する（主キーがない場合は -1）
+func (s *Schema) GetPrimaryKeyIndex() int {
+	for i, col := range s.columns {
+		if col.primaryKey {
+			return i
+		}
+	}
+	return -1
+}
+
+// Merge は2つのスキーマのカラムを並べたスキーマを返す
+// カラムのテーブル名はそのまま引き継ぐ（USING でまとめたカラムはテーブル名を持たない）
 func (s *Schema) Merge(other *Schema) *Schema {
 	mergedColumns := make([]Column, 0, len(s.columns)+len(other.columns))
 	mergedColumns = append(mergedColumns, s.columns...)
 	mergedColumns = append(mergedColumns, other.columns...)
-	return NewSchema(s.tableName, mergedColumns)
+	return &Schema{tableName: s.tableName, columns: mergedColumns}
 }
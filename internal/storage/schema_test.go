@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"errors"
 	"testing"
 )
 
@@ -61,6 +62,17 @@ func TestColumnGetters(t *testing.T) {
 	}
 }
 
+func TestColumnPrimaryKey(t *testing.T) {
+	col := NewColumn("id", ColumnTypeInt32, 4, false)
+	if col.GetPrimaryKey() {
+		t.Error("NewColumn().GetPrimaryKey() should be false by default")
+	}
+	col.SetPrimaryKey(true)
+	if !col.GetPrimaryKey() {
+		t.Error("GetPrimaryKey() should be true after SetPrimaryKey(true)")
+	}
+}
+
 // =============================================================================
 // Schema Tests
 // =============================================================================
@@ -172,3 +184,64 @@ func TestSchemaWithDifferentTables(t *testing.T) {
 		t.Errorf("products schema GetColumnCount() = %d, want %d", productsSchema.GetColumnCount(), 4)
 	}
 }
+
+func TestSchemaGetPrimaryKeyIndex(t *testing.T) {
+	id := NewColumn("id", ColumnTypeInt32, 4, false)
+	id.SetPrimaryKey(true)
+	schema := NewSchema("users", []Column{
+		*NewColumn("name", ColumnTypeString, 255, true),
+		*id,
+	})
+	if got := schema.GetPrimaryKeyIndex(); got != 1 {
+		t.Errorf("GetPrimaryKeyIndex() = %d, want %d", got, 1)
+	}
+
+	noPK := NewSchema("logs", []Column{*NewColumn("message", ColumnTypeString, 255, true)})
+	if got := noPK.GetPrimaryKeyIndex(); got != -1 {
+		t.Errorf("GetPrimaryKeyIndex() = %d, want %d", got, -1)
+	}
+}
+
+func TestSchemaFindColumn(t *testing.T) {
+	users := NewSchema("u", []Column{*NewColumn("id", ColumnTypeInt32, 4, false), *NewColumn("name", ColumnTypeString, 255, true)})
+	orders := NewSchema("o", []Column{*NewColumn("id", ColumnTypeInt32, 4, false), *NewColumn("user_id", ColumnTypeInt32, 4, true)})
+	joined := users.Merge(orders)
+
+	tests := []struct {
+		table, name string
+		want        int
+		err         error
+	}{
+		{"u", "id", 0, nil},
+		{"o", "id", 2, nil},
+		{"", "name", 1, nil},
+		{"", "user_id", 3, nil},
+		{"", "id", -1, ErrAmbiguousColumn},
+		{"zz", "id", -1, ErrUnknownTable},
+		{"u", "user_id", -1, ErrColumnNotFound},
+		{"", "missing", -1, ErrColumnNotFound},
+	}
+	for _, tt := range tests {
+		got, err := joined.FindColumn(tt.table, tt.name)
+		if got != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("FindColumn(%q, %q) = %d, %v, want %d, %v", tt.table, tt.name, got, err, tt.want, tt.err)
+		}
+	}
+	// USING でまとめた元のカラムは修飾したときだけ見つかる
+	hidden := *NewColumn("id", ColumnTypeInt32, 4, false)
+	hidden.SetHidden(true)
+	using := NewSchema("o", []Column{hidden, *NewColumn("qty", ColumnTypeInt32, 4, true)})
+	if got, err := using.FindColumn("", "id"); !errors.Is(err, ErrColumnNotFound) {
+		t.Errorf("FindColumn(\"\", \"id\") = %d, %v, want %v", got, err, ErrColumnNotFound)
+	}
+	if got, err := using.FindColumn("o", "id"); got != 0 || err != nil {
+		t.Errorf("FindColumn(\"o\", \"id\") = %d, %v, want 0, nil", got, err)
+	}
+	if got, err := using.WithTableName("t").FindColumn("", "id"); got != 0 || err != nil {
+		t.Errorf("WithTableName: FindColumn(\"\", \"id\") = %d, %v, want 0, nil", got, err)
+	}
+	// 1つのテーブルでは同じ名前のカラムがあっても先頭のカラムを返す
+	if got, err := NewSchema("u", []Column{*NewColumn("id", ColumnTypeInt32, 4, false), *NewColumn("id", ColumnTypeInt32, 4, false)}).FindColumn("", "id"); got != 0 || err != nil {
+		t.Errorf("FindColumn(\"\", \"id\") = %d, %v, want 0, nil", got, err)
+	}
+}
@@ -0,0 +1,244 @@
+package storage
+
+import (
+	"math/rand"
+	"slices"
+)
+
+// StatisticsBuckets は等深ヒストグラムのバケット数
+const StatisticsBuckets = 10
+
+// TableStatistics は ANALYZE で集めたテーブルの統計情報
+type TableStatistics struct {
+	RowCount int64
+	Columns  []ColumnStatistics // スキーマのカラム順
+}
+
+// ColumnStatistics はカラム1つ分の統計情報
+type ColumnStatistics struct {
+	Name          string
+	DistinctCount int64   // NULL を除いた値の種類の数
+	NullFraction  float64 // NULL の行の割合
+	Min           Value   // NULL 以外の値がなければ nil
+	Max           Value
+	// Histogram は等深ヒストグラムの境界（先頭が最小値、末尾が最大値）
+	// 隣り合う境界の間には、NULL 以外の行がほぼ同じ数ずつ入る
+	Histogram []Value
+}
+
+// StatisticsSampleSize は ANALYZE でヒストグラムと値の種類の数を求めるために残す行の数
+const StatisticsSampleSize = 10000
+
+// StatisticsCollector は行を1つずつ受け取って統計情報を集める
+// 行数、NULL の数、最小値と最大値はすべての行から求め、ヒストグラムと値の種類の数は
+// リザーバサンプリングで残した行から求めるので、テーブルの大きさによらず使うメモリは一定
+type StatisticsCollector struct {
+	schema   *Schema
+	rowCount int64
+	nonNull  []int64 // カラムごとの NULL 以外の行数
+	minimum  []Value
+	maximum  []Value
+	sample   []*Row
+	limit    int
+	rng      *rand.Rand
+}
+
+func NewStatisticsCollector(schema *Schema) *StatisticsCollector {
+	return newStatisticsCollector(schema, StatisticsSampleSize)
+}
+
+// newStatisticsCollector は残す行の数を指定して StatisticsCollector を作成する
+func newStatisticsCollector(schema *Schema, limit int) *StatisticsCollector {
+	n := schema.GetColumnCount()
+	return &StatisticsCollector{
+		schema:  schema,
+		nonNull: make([]int64, n),
+		minimum: make([]Value, n),
+		maximum: make([]Value, n),
+		limit:   limit,
+		// 同じテーブルからは同じ統計情報を作れるように乱数の種を固定する
+		rng: rand.New(rand.NewSource(1)),
+	}
+}
+
+// Add は行を1つ統計情報に加える
+func (c *StatisticsCollector) Add(row *Row) {
+	for i, v := range row.GetValues() {
+		if v == nil {
+			continue
+		}
+		c.nonNull[i]++
+		if c.minimum[i] == nil || compareForStatistics(v, c.minimum[i]) < 0 {
+			c.minimum[i] = v
+		}
+		if c.maximum[i] == nil || compareForStatistics(v, c.maximum[i]) > 0 {
+			c.maximum[i] = v
+		}
+	}
+	c.rowCount++
+	// n 行目は limit/n の確率で残し、残すなら今ある行のどれかと入れ替える
+	if len(c.sample) < c.limit {
+		c.sample = append(c.sample, row)
+	} else if j := c.rng.Int63n(c.rowCount); j < int64(c.limit) {
+		c.sample[j] = row
+	}
+}
+
+// Statistics は加えた行の統計情報を返す
+func (c *StatisticsCollector) Statistics() *TableStatistics {
+	stats := &TableStatistics{RowCount: c.rowCount}
+	for i, col := range c.schema.GetColumns() {
+		values := make([]Value, 0, len(c.sample))
+		for _, row := range c.sample {
+			if v := row.GetValues()[i]; v != nil {
+				values = append(values, v)
+			}
+		}
+		colStats := collectColumnStatistics(col.GetName(), values, c.nonNull[i], c.rowCount)
+		if colStats.Min != nil {
+			colStats.Min, colStats.Max = c.minimum[i], c.maximum[i]
+			colStats.Histogram[0], colStats.Histogram[len(colStats.Histogram)-1] = colStats.Min, colStats.Max
+		}
+		stats.Columns = append(stats.Columns, colStats)
+	}
+	return stats
+}
+
+// CollectStatistics は行からテーブルの統計情報を集める
+func CollectStatistics(schema *Schema, rows []*Row) *TableStatistics {
+	collector := NewStatisticsCollector(schema)
+	for _, row := range rows {
+		collector.Add(row)
+	}
+	return collector.Statistics()
+}
+
+// collectColumnStatistics はサンプルの NULL 以外の値からカラムの統計情報を集める
+// nonNull と rowCount はサンプルを取る前のすべての行での NULL 以外の行数と行数
+func collectColumnStatistics(name string, values []Value, nonNull, rowCount int64) ColumnStatistics {
+	stats := ColumnStatistics{Name: name}
+	if rowCount > 0 {
+		stats.NullFraction = float64(rowCount-nonNull) / float64(rowCount)
+	}
+	if len(values) == 0 {
+		return stats
+	}
+	slices.SortFunc(values, compareForStatistics)
+	// サンプルの中の値の種類の数と、1回しか現れない値の数
+	distinct, once := int64(0), int64(0)
+	for i := 0; i < len(values); {
+		j := i + 1
+		for j < len(values) && compareForStatistics(values[i], values[j]) == 0 {
+			j++
+		}
+		distinct++
+		if j-i == 1 {
+			once++
+		}
+		i = j
+	}
+	stats.DistinctCount = estimateDistinct(distinct, once, int64(len(values)), nonNull)
+	stats.Min, stats.Max = values[0], values[len(values)-1]
+	buckets := min(StatisticsBuckets, len(values))
+	// b 番目の境界は小さいほうから b*N/B 番目の値（最後の境界だけは最大値）
+	stats.Histogram = make([]Value, buckets+1)
+	for b := 0; b < buckets; b++ {
+		stats.Histogram[b] = values[b*len(values)/buckets]
+	}
+	stats.Histogram[buckets] = values[len(values)-1]
+	return stats
+}
+
+// estimateDistinct はサンプルの値の種類の数から全体の値の種類の数を見積もる（Haas と Stokes の推定量）
+// サンプルが全体なら種類の数をそのまま返す
+//
+//	D = n*d / (n - f1 + f1*n/N)  （n: サンプルの値の数、d: 種類の数、f1: 1回しか現れない値の数、N: 全体の値の数）
+func estimateDistinct(distinct, once, sampled, total int64) int64 {
+	if sampled >= total {
+		return distinct
+	}
+	n, d, f1 := float64(sampled), float64(distinct), float64(once)
+	estimate := n * d / (n - f1 + f1*n/float64(total))
+	return min(max(int64(estimate), distinct), total)
+}
+
+// compareForStatistics は同じカラムの値を比べる（比べられない値は等しいとみなす）
+func compareForStatistics(a, b Value) int {
+	c, err := CompareValues(a, b)
+	if err != nil {
+		return 0
+	}
+	return c
+}
+
+// GetColumn はカラムの統計情報を返す（なければ nil）
+func (s *TableStatistics) GetColumn(name string) *ColumnStatistics {
+	for i := range s.Columns {
+		if s.Columns[i].Name == name {
+			return &s.Columns[i]
+		}
+	}
+	return nil
+}
+
+// EqualFraction は値が value に等しい行の割合を見積もる（値の種類ごとに同じ数の行があるとみなす）
+func (c *ColumnStatistics) EqualFraction(value Value) float64 {
+	if c.DistinctCount == 0 || value == nil {
+		return 0
+	}
+	if c.Min != nil && (compareForStatistics(value, c.Min) < 0 || compareForStatistics(value, c.Max) > 0) {
+		return 0
+	}
+	return (1 - c.NullFraction) / float64(c.DistinctCount)
+}
+
+// LessFraction は値が value より小さい（inclusive なら value 以下の）行の割合を見積もる
+// ヒストグラムで value を含むバケットを探し、バケットの中は数値と日時なら値の位置で按分する
+func (c *ColumnStatistics) LessFraction(value Value, inclusive bool) float64 {
+	if len(c.Histogram) < 2 || value == nil {
+		return 0
+	}
+	nonNull := 1 - c.NullFraction
+	buckets := len(c.Histogram) - 1
+	var fraction float64
+	switch {
+	case compareForStatistics(value, c.Histogram[0]) <= 0:
+		fraction = 0
+	case compareForStatistics(value, c.Histogram[buckets]) > 0:
+		fraction = 1
+	default:
+		b := 0
+		for b < buckets-1 && compareForStatistics(value, c.Histogram[b+1]) > 0 {
+			b++
+		}
+		fraction = (float64(b) + bucketPosition(value, c.Histogram[b], c.Histogram[b+1])) / float64(buckets)
+	}
+	if inclusive {
+		fraction += c.EqualFraction(value) / nonNull
+	}
+	return min(max(fraction*nonNull, 0), nonNull)
+}
+
+// bucketPosition は値がバケットの下端から上端までのどのあたりにあるかを 0〜1 で返す
+// 位置を求められない値（文字列など）はバケットの中央とみなす
+func bucketPosition(value, low, high Value) float64 {
+	v, ok1 := statisticsOrdinal(value)
+	lo, ok2 := statisticsOrdinal(low)
+	hi, ok3 := statisticsOrdinal(high)
+	if !ok1 || !ok2 || !ok3 || hi <= lo {
+		return 0.5
+	}
+	return min(max((v-lo)/(hi-lo), 0), 1)
+}
+
+// statisticsOrdinal は数値と日時を大小関係を保った float64 にする
+func statisticsOrdinal(v Value) (float64, bool) {
+	if IsNumeric(v) {
+		f, err := toFloat64(v)
+		return f, err == nil
+	}
+	if isTemporal(v) {
+		return float64(temporalOrdinal(v)), true
+	}
+	return 0, false
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCollectStatistics(t *testing.T) {
+	schema := NewSchema("users", []Column{
+		*NewColumn("id", ColumnTypeInt32, 0, false),
+		*NewColumn("city", ColumnTypeString, 255, true),
+	})
+	// id は 0〜99、city は4種類で 20 行に1行は NULL
+	var rows []*Row
+	cities := []string{"osaka", "tokyo", "kyoto", "nagoya"}
+	for i := 0; i < 100; i++ {
+		var city Value = StringValue(cities[i%4])
+		if i%20 == 0 {
+			city = nil
+		}
+		rows = append(rows, NewRow([]Value{Int32Value(int32(i)), city}))
+	}
+	stats := CollectStatistics(schema, rows)
+	if stats.RowCount != 100 || len(stats.Columns) != 2 {
+		t.Fatalf("unexpected statistics: %+v", stats)
+	}
+
+	id := stats.GetColumn("id")
+	if id.DistinctCount != 100 || id.NullFraction != 0 || id.Min != Int32Value(0) || id.Max != Int32Value(99) {
+		t.Errorf("unexpected id statistics: %+v", id)
+	}
+	if len(id.Histogram) != StatisticsBuckets+1 || id.Histogram[0] != Int32Value(0) || id.Histogram[StatisticsBuckets] != Int32Value(99) {
+		t.Errorf("unexpected histogram: %v", id.Histogram)
+	}
+	city := stats.GetColumn("city")
+	if city.DistinctCount != 4 || city.NullFraction != 0.05 || city.Min != StringValue("kyoto") || city.Max != StringValue("tokyo") {
+		t.Errorf("unexpected city statistics: %+v", city)
+	}
+	if stats.GetColumn("missing") != nil {
+		t.Error("expected nil for unknown column")
+	}
+
+	near := func(got, want float64) bool { return math.Abs(got-want) < 0.02 }
+	tests := []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"id = 10", id.EqualFraction(Int32Value(10)), 0.01},
+		{"id = 1000", id.EqualFraction(Int32Value(1000)), 0},
+		{"id < 30", id.LessFraction(Int32Value(30), false), 0.3},
+		{"id <= 30", id.LessFraction(Int32Value(30), true), 0.31},
+		{"id < 0", id.LessFraction(Int32Value(0), false), 0},
+		{"id < 500", id.LessFraction(Int32Value(500), false), 1},
+		// 整数のカラムも小数と比べられる
+		{"id < 49.5", id.LessFraction(Float64Value(49.5), false), 0.5},
+		{"city = 'tokyo'", city.EqualFraction(StringValue("tokyo")), 0.2375},
+		// NULL の行はどの範囲にも入らない
+		{"city < 'zzz'", city.LessFraction(StringValue("zzz"), false), 0.95},
+	}
+	for _, tt := range tests {
+		if !near(tt.got, tt.want) {
+			t.Errorf("%s: expected about %v, got %v", tt.name, tt.want, tt.got)
+		}
+	}
+}
+
+func TestCollectStatisticsEmpty(t *testing.T) {
+	schema := NewSchema("empty", []Column{*NewColumn("id", ColumnTypeInt32, 0, true)})
+	stats := CollectStatistics(schema, nil)
+	col := stats.GetColumn("id")
+	if stats.RowCount != 0 || col.DistinctCount != 0 || col.Min != nil || col.Histogram != nil {
+		t.Errorf("unexpected statistics: %+v", stats)
+	}
+	if col.EqualFraction(Int32Value(1)) != 0 || col.LessFraction(Int32Value(1), true) != 0 {
+		t.Error("expected zero fractions for empty table")
+	}
+}
+
+func TestStatisticsCollectorSamplesRows(t *testing.T) {
+	// サンプルより多い行は一部だけ残し、行数、NULL の割合、最小値と最大値はすべての行から求める
+	schema := NewSchema("users", []Column{
+		*NewColumn("id", ColumnTypeInt32, 0, false),
+		*NewColumn("city", ColumnTypeString, 255, true),
+	})
+	cities := []string{"osaka", "tokyo", "kyoto", "nagoya"}
+	collector := newStatisticsCollector(schema, 200)
+	for i := 0; i < 10000; i++ {
+		var city Value = StringValue(cities[i%4])
+		if i%20 == 0 {
+			city = nil
+		}
+		collector.Add(NewRow([]Value{Int32Value(int32(i)), city}))
+	}
+	if len(collector.sample) != 200 {
+		t.Fatalf("expected 200 sampled rows, got %d", len(collector.sample))
+	}
+	stats := collector.Statistics()
+	if stats.RowCount != 10000 {
+		t.Errorf("expected 10000 rows, got %d", stats.RowCount)
+	}
+
+	id := stats.GetColumn("id")
+	if id.Min != Int32Value(0) || id.Max != Int32Value(9999) {
+		t.Errorf("expected exact min and max, got %v and %v", id.Min, id.Max)
+	}
+	if id.Histogram[0] != Int32Value(0) || id.Histogram[len(id.Histogram)-1] != Int32Value(9999) {
+		t.Errorf("expected histogram to span min and max: %v", id.Histogram)
+	}
+	// 一意なカラムは行数に近い種類の数を見積もる
+	if id.DistinctCount < 9000 || id.DistinctCount > 10000 {
+		t.Errorf("expected about 10000 distinct ids, got %d", id.DistinctCount)
+	}
+	if got := id.LessFraction(Int32Value(3000), false); math.Abs(got-0.3) > 0.1 {
+		t.Errorf("id < 3000: expected about 0.3, got %v", got)
+	}
+	city := stats.GetColumn("city")
+	if city.DistinctCount != 4 || city.NullFraction != 0.05 {
+		t.Errorf("unexpected city statistics: %+v", city)
+	}
+}
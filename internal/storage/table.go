@@ -1,6 +1,9 @@
 package storage
 
-import "errors"
+import (
+	"errors"
+	"sync"
+)
 
 var (
 	ErrTableNotFound = errors.New("table not found")
@@ -22,39 +25,73 @@ func (n NumPages) ToPageID() PageID {
 }
 
 // Table はテーブルを表す
+// ページの読み書きはすべてバッファプールを経由する
+// 複数のセッションから同時に使えるように、行の読み書きは mu で保護する
+// （トランザクションの分離は dbtxn のロックで行い、mu は1回の操作の間だけ持つ）
 type Table struct {
+	mu     sync.RWMutex
 	name   TableName
 	schema *Schema
 	pager  *Pager
+	pool   *BufferPool
 	// 現在のページ数
 	numPages  NumPages
 	nextRowID int64                 // 次の行ID
 	rowIndex  map[int64]RowLocation // 行IDから行位置のインデックス
+	indexes   []TableIndex          // カラムに張られたインデックス
+	// 行を追加するスロットページ（なければ -1）
+	// 末尾のページがオーバーフローページのこともあるので、最後に使ったスロットページを覚えておく
+	insertPageID PageID
+	freePages    []PageID // 解放されて再利用を待つページ
+}
+
+// tableBufferPoolFrames は NewTable が専用に作るバッファプールのフレーム数
+const tableBufferPoolFrames = 64
+
+// NewTable はテーブル専用の小さなバッファプールを持つテーブルを作成する
+func NewTable(name TableName, schema *Schema, pager *Pager) (*Table, error) {
+	return NewTableWithBufferPool(name, schema, pager, NewBufferPool(tableBufferPoolFrames, EvictionPolicyLRU))
 }
 
-func NewTable(name TableName, schema *Schema, pager *Pager) *Table {
+// NewTableWithBufferPool は共有バッファプールを使うテーブルを作成する
+// 既存のページが読めなければエラーを返す
+func NewTableWithBufferPool(name TableName, schema *Schema, pager *Pager, pool *BufferPool) (*Table, error) {
 	t := &Table{
-		name:      name,
-		schema:    schema,
-		pager:     pager,
-		numPages:  NumPages(pager.GetNumPages()),
-		nextRowID: 1,
-		rowIndex:  make(map[int64]RowLocation),
+		name:         name,
+		schema:       schema,
+		pager:        pager,
+		pool:         pool,
+		numPages:     NumPages(pager.GetNumPages()),
+		nextRowID:    1,
+		rowIndex:     make(map[int64]RowLocation),
+		insertPageID: -1,
 	}
 	// 既存のデータを読み込んでインデックスを再構築
-	t.rebuildIndex()
-	return t
+	if err := t.rebuildIndex(); err != nil {
+		return nil, err
+	}
+	return t, nil
 }
 
 // rebuildIndex はインデックスを再構築する
+// どの行からも参照されていないオーバーフローページ（解放済みやクラッシュで残ったもの）は再利用に回す
 func (t *Table) rebuildIndex() error {
 	t.rowIndex = make(map[int64]RowLocation)
+	t.insertPageID = -1
+	t.freePages = nil
 	maxRowID := int64(0)
+	var refs []OverflowRef
+	var unslotted []PageID
 	for i := 0; i < int(t.numPages); i++ {
 		page, err := t.getPage(PageID(i))
 		if err != nil {
 			return err
 		}
+		if data := page.Data(); !isSlottedPage(data[:]) {
+			unslotted = append(unslotted, PageID(i))
+			continue
+		}
+		t.insertPageID = PageID(i)
 		for j := 0; j < int(page.rowCount()); j++ {
 			rowData, err := page.GetRow(uint16(j))
 			if err == ErrSlotDeleted {
@@ -63,10 +100,12 @@ func (t *Table) rebuildIndex() error {
 			if err != nil {
 				return err
 			}
-			row, err := DecodeRow(rowData, t.schema)
+			collector := &overflowCollector{}
+			row, err := DecodeRowWithOverflow(rowData, t.schema, collector)
 			if err != nil {
 				return err
 			}
+			refs = append(refs, collector.refs...)
 			rowID := row.GetRowID()
 			// インデックスに追加
 			t.rowIndex[rowID] = RowLocation{
@@ -81,6 +120,22 @@ func (t *Table) rebuildIndex() error {
 	}
 	// 次の行IDを更新
 	t.nextRowID = maxRowID + 1
+
+	used := make(map[PageID]bool)
+	for _, ref := range refs {
+		err := t.walkOverflow(ref, func(pageID PageID, payload []byte) error {
+			used[pageID] = true
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, pageID := range unslotted {
+		if !used[pageID] {
+			t.freePages = append(t.freePages, pageID)
+		}
+	}
 	return nil
 }
 
@@ -88,20 +143,31 @@ func (t *Table) GetName() TableName {
 	return t.name
 }
 
-// GetRowCost はテーブルスキャン時の推定行数（コスト見積もり用）を返す。
-// 現状は正確な統計情報を持っていないため、簡易的に全行をスキャンして数える。
-// TODO: 将来的にはカタログに統計情報（行数、ヒストグラム等）を保持して高速化する。
+func (t *Table) GetSchema() *Schema {
+	return t.schema
+}
+
+// ReserveRowID は次の行IDを予約して返す
+// WAL に行IDを記録してから挿入するときに使う
+func (t *Table) ReserveRowID() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	rowID := t.nextRowID
+	t.nextRowID++
+	return rowID
+}
+
+// GetRowCost はテーブルスキャン時の推定行数（コスト見積もり用）を返す
+// 行IDのインデックスの件数を返すので、ページは読まない
 func (t *Table) GetRowCost() int {
-	rows, err := t.Scan()
-	if err != nil {
-		// コスト推定が失敗しても実行計画生成を完全に止めないため、0扱いにする。
-		// （呼び出し側でエラーとして扱いたい場合はAPI設計を見直す）
-		return 0
-	}
-	return len(rows)
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.rowIndex)
 }
 
 func (t *Table) Insert(row *Row) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	// 行IDが指定されていない場合は、次の行IDを使用
 	if row.GetRowID() == 0 {
 		row.SetRowID(t.nextRowID)
@@ -112,22 +178,40 @@ func (t *Table) Insert(row *Row) error {
 			t.nextRowID = row.GetRowID() + 1
 		}
 	}
-	rowData := row.Encode()
+	// 先にインデックスへ追加して一意性を確認する
+	if err := t.indexInsert(row); err != nil {
+		return err
+	}
+	rowData, refs, err := t.encodeStoredRow(row)
+	if err == nil {
+		err = t.insertRow(row.GetRowID(), rowData)
+		if err != nil {
+			t.freeOverflowRefs(refs)
+		}
+	}
+	if err != nil {
+		t.indexDelete(row, len(t.indexes))
+		return err
+	}
+	return nil
+}
 
+// insertRow はエンコード済みの行をページに書き込む
+func (t *Table) insertRow(rowID int64, rowData []byte) error {
 	pageID := PageID(0)
 
-	if t.numPages > 0 {
-		page, err := t.getPage((t.numPages - 1).ToPageID())
+	if t.insertPageID >= 0 {
+		page, err := t.getPage(t.insertPageID)
 		if err != nil {
 			return err
 		}
 		slotID, err := page.InsertRow(rowData)
 		if err == nil {
-			pageID = (t.numPages - 1).ToPageID()
+			pageID = t.insertPageID
 			if err := t.savePage(pageID, page); err != nil {
 				return err
 			}
-			t.rowIndex[row.GetRowID()] = RowLocation{
+			t.rowIndex[rowID] = RowLocation{
 				pageID: pageID,
 				rowID:  int64(slotID),
 			}
@@ -147,62 +231,180 @@ func (t *Table) Insert(row *Row) error {
 	}
 
 	// ページを保存
-	pageID = t.numPages.ToPageID()
-	t.numPages++
-	if err := t.savePage(pageID, page); err != nil {
+	pageID, err = t.allocatePage(page)
+	if err != nil {
 		return err
 	}
-	t.rowIndex[row.GetRowID()] = RowLocation{
+	t.rowIndex[rowID] = RowLocation{
 		pageID: pageID,
 		rowID:  int64(slotID),
 	}
 	return nil
 }
 
+// getPage はバッファプールからページを読み込む
 func (t *Table) getPage(pageID PageID) (*SlottedPage, error) {
-	page, err := t.pager.ReadPage(pageID, make([]byte, pageSize))
+	page, err := t.pool.FetchPage(t.pager, pageID)
 	if err != nil {
 		return nil, err
 	}
 	// []byte を [pageSize]byte に変換
 	var data [pageSize]byte
 	copy(data[:], page.data)
+	if err := t.pool.UnpinPage(t.pager, pageID, false); err != nil {
+		return nil, err
+	}
 	return LoadSlottedPage(data), nil
 }
 
+// savePage はページをバッファプールに書き戻してダーティにする
+// ディスクへの書き出しは追い出し時か Close 時に行われる
 func (t *Table) savePage(pageID PageID, slotted *SlottedPage) error {
+	page, err := t.pool.FetchPage(t.pager, pageID)
+	if err != nil {
+		return err
+	}
 	// [pageSize]byte を []byte に変換
 	data := slotted.Data()
-	return t.pager.WritePage(NewPage(pageID, data[:]))
+	copy(page.data, data[:])
+	return t.pool.UnpinPage(t.pager, pageID, true)
+}
+
+// allocatePage はテーブル末尾に新しいページを追加する
+func (t *Table) allocatePage(slotted *SlottedPage) (PageID, error) {
+	pageID := t.numPages.ToPageID()
+	page, err := t.pool.NewPage(t.pager, pageID)
+	if err != nil {
+		return 0, err
+	}
+	data := slotted.Data()
+	copy(page.data, data[:])
+	if err := t.pool.UnpinPage(t.pager, pageID, true); err != nil {
+		return 0, err
+	}
+	t.numPages++
+	t.insertPageID = pageID
+	return pageID, nil
 }
 
+// Scan はテーブルの全行を読み込む
+// 大きなテーブルでは Iterator を使ってページ単位で読むこと
 func (t *Table) Scan() ([]*Row, error) {
 	var rows []*Row
-	for i := 0; i < int(t.numPages); i++ {
-		page, err := t.getPage(PageID(i))
+	it := t.Iterator()
+	for {
+		ok, err := it.Next()
 		if err != nil {
 			return nil, err
 		}
-		for j := 0; j < int(page.rowCount()); j++ {
-			rowData, err := page.GetRow(uint16(j))
+		if !ok {
+			return rows, nil
+		}
+		rows = append(rows, it.Row())
+	}
+}
+
+// Iterator はページを1つずつ読み込みながら行を返すイテレータを作成する
+func (t *Table) Iterator() *TableIterator {
+	it := &TableIterator{table: t}
+	it.Reset()
+	return it
+}
+
+// TableIterator はテーブルの行を先頭から順に返す
+// 一度に保持するのは現在のページだけなので、テーブル全体をメモリに載せない
+type TableIterator struct {
+	table    *Table
+	numPages NumPages     // 開始時点のページ数（走査中に追加されたページは対象外）
+	pageID   PageID       // 現在のページ
+	slotID   int          // 次に読むスロット
+	page     *SlottedPage // 現在のページ（未読み込みなら nil）
+	current  *Row
+}
+
+// Next は次の行に進む。行がなければ false を返す
+func (it *TableIterator) Next() (bool, error) {
+	for PageID(it.numPages) > it.pageID {
+		if it.page == nil {
+			it.table.mu.RLock()
+			page, err := it.table.getPage(it.pageID)
+			it.table.mu.RUnlock()
+			if err != nil {
+				return false, err
+			}
+			it.page = page
+			it.slotID = 0
+		}
+		for it.slotID < int(it.page.rowCount()) {
+			slotID := it.slotID
+			it.slotID++
+			rowData, err := it.page.GetRow(uint16(slotID))
 			if err == ErrSlotDeleted {
 				continue
 			}
 			if err != nil {
-				return nil, err
+				return false, err
+			}
+			row, err := DecodeRow(rowData, it.table.schema)
+			if errors.Is(err, ErrOverflowUnavailable) {
+				row, err = it.readLiveRow(slotID)
+				if row == nil && err == nil {
+					continue
+				}
 			}
-			row, err := DecodeRow(rowData, t.schema)
 			if err != nil {
-				return nil, err
+				return false, err
 			}
-			rows = append(rows, row)
+			it.current = row
+			return true, nil
 		}
+		// 次のページへ
+		it.page = nil
+		it.pageID++
+	}
+	it.current = nil
+	return false, nil
+}
+
+// readLiveRow はオーバーフローページに値を置いた行を読む
+// 読み込んだページのコピーは古いことがあるので、ロックを取ってから今のページを読み直す（削除されていれば nil）
+func (it *TableIterator) readLiveRow(slotID int) (*Row, error) {
+	it.table.mu.RLock()
+	defer it.table.mu.RUnlock()
+	page, err := it.table.getPage(it.pageID)
+	if err != nil {
+		return nil, err
+	}
+	rowData, err := page.GetRow(uint16(slotID))
+	if err == ErrSlotDeleted {
+		return nil, nil
 	}
-	return rows, nil
+	if err != nil {
+		return nil, err
+	}
+	return it.table.decodeStoredRow(rowData)
+}
+
+// Row は現在の行を返す
+func (it *TableIterator) Row() *Row {
+	return it.current
+}
+
+// Reset は先頭から読み直せるように状態を戻す
+func (it *TableIterator) Reset() {
+	it.table.mu.RLock()
+	it.numPages = it.table.numPages
+	it.table.mu.RUnlock()
+	it.pageID = 0
+	it.slotID = 0
+	it.page = nil
+	it.current = nil
 }
 
 // Update は行を更新する
 func (t *Table) Update(rowID int64, row *Row) (*Row, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	location, exists := t.rowIndex[rowID]
 	if !exists {
 		return nil, ErrRowNotFound
@@ -215,54 +417,82 @@ func (t *Table) Update(rowID int64, row *Row) (*Row, error) {
 	if err != nil {
 		return nil, err
 	}
-	oldRow, err := DecodeRow(oldRowData, t.schema)
+	oldRow, err := t.decodeStoredRow(oldRowData)
 	if err != nil {
 		return nil, err
 	}
 	row.SetRowID(rowID)
-	newData := row.Encode()
+	// 先にエンコードしておき、インデックスやページを変更してから失敗しないようにする
+	newData, newRefs, err := t.encodeStoredRow(row)
+	if err != nil {
+		return nil, err
+	}
+	// インデックスを新しい値に付け替える（一意性違反なら元に戻っている）
+	if err := t.indexReplace(oldRow, row); err != nil {
+		t.freeOverflowRefs(newRefs)
+		return nil, err
+	}
+	if err := t.replaceRow(rowID, location, page, newData); err != nil {
+		t.indexReplace(row, oldRow)
+		t.freeOverflowRefs(newRefs)
+		return nil, err
+	}
+	// 新しい行を書けたので、古い値を置いていたページを解放する
+	if err := t.freeStoredRow(oldRowData); err != nil {
+		return nil, err
+	}
+	return oldRow, nil
+}
+
+// replaceRow はページ上の行をエンコード済みの新しい行に置き換える
+// 失敗したときは元の行をそのまま残す（page は getPage が返したコピーなので、保存するまで反映されない）
+func (t *Table) replaceRow(rowID int64, location RowLocation, page *SlottedPage, newData []byte) error {
 	// スロットを更新
 	// 簡易実装: 削除 -> 再挿入
 	if err := page.DeleteRow(uint16(location.rowID)); err != nil {
-		return nil, err
+		return err
 	}
 	// 同じページに再挿入
 	newSlotID, err := page.InsertRow(newData)
 	if err == ErrPageFull {
-		if err := t.savePage(location.pageID, page); err != nil {
-			return nil, err
+		// 新しいページに行を書いてから、古いスロットを消したページを保存する
+		newPage := NewSlottedPage()
+		newSlotID, err = newPage.InsertRow(newData)
+		if err != nil {
+			return err
 		}
-		// 新しいページを作成
-		page = NewSlottedPage()
-		newSlotID, err = page.InsertRow(newData)
+		pageID, err := t.allocatePage(newPage)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		pageID := t.numPages.ToPageID()
-		t.numPages++
-		if err := t.savePage(pageID, page); err != nil {
-			return nil, err
+		if err := t.savePage(location.pageID, page); err != nil {
+			// 古い行が残っているので、新しいページに書いた行を消す
+			newPage.DeleteRow(newSlotID)
+			t.savePage(pageID, newPage)
+			return err
 		}
 		t.rowIndex[rowID] = RowLocation{
 			pageID: pageID,
 			rowID:  int64(newSlotID),
 		}
 	} else if err != nil {
-		return nil, err
+		return err
 	} else {
 		if err := t.savePage(location.pageID, page); err != nil {
-			return nil, err
+			return err
 		}
 		t.rowIndex[rowID] = RowLocation{
 			pageID: location.pageID,
 			rowID:  int64(newSlotID),
 		}
 	}
-	return oldRow, nil
+	return nil
 }
 
 // Delete は行を削除する
 func (t *Table) Delete(rowID int64) (*Row, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	location, exists := t.rowIndex[rowID]
 	if !exists {
 		return nil, ErrRowNotFound
@@ -276,7 +506,7 @@ func (t *Table) Delete(rowID int64) (*Row, error) {
 	if err != nil {
 		return nil, err
 	}
-	oldRow, err := DecodeRow(oldRowData, t.schema)
+	oldRow, err := t.decodeStoredRow(oldRowData)
 	if err != nil {
 		return nil, err
 	}
@@ -290,10 +520,19 @@ func (t *Table) Delete(rowID int64) (*Row, error) {
 	}
 	// インデックスを更新
 	delete(t.rowIndex, rowID)
+	if err := t.indexDelete(oldRow, len(t.indexes)); err != nil {
+		return nil, err
+	}
+	// 値を置いていたオーバーフローページを解放
+	if err := t.freeStoredRow(oldRowData); err != nil {
+		return nil, err
+	}
 	return oldRow, nil
 }
 
 func (t *Table) FindByRowID(rowID int64) (*Row, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	location, exists := t.rowIndex[rowID]
 	if !exists {
 		return nil, ErrRowNotFound
@@ -306,11 +545,37 @@ func (t *Table) FindByRowID(rowID int64) (*Row, error) {
 	if err != nil {
 		return nil, err
 	}
-	return DecodeRow(rowData, t.schema)
+	return t.decodeStoredRow(rowData)
 }
 
-// Close はテーブルを閉じる
+// Flush はテーブルのダーティページをディスクに書き出す
+func (t *Table) Flush() error {
+	return t.pool.FlushPager(t.pager)
+}
+
+// Close はダーティページを書き出してテーブルを閉じる
 func (t *Table) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.Flush(); err != nil {
+		return err
+	}
+	if err := t.closeIndexes(); err != nil {
+		return err
+	}
+	t.pool.DiscardPager(t.pager)
+	return t.pager.Close()
+}
+
+// Drop はダーティページを書き出さずにテーブルを閉じる（ファイル削除前に使う）
+// インデックスも書き出さずに閉じる
+func (t *Table) Drop() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.dropIndexes(); err != nil {
+		return err
+	}
+	t.pool.DiscardPager(t.pager)
 	return t.pager.Close()
 }
 
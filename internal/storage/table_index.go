@@ -0,0 +1,260 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+var (
+	ErrIndexExists   = errors.New("index already exists")
+	ErrIndexNotFound = errors.New("index not found")
+)
+
+// KeyRange はインデックスを検索するキーの範囲
+// Low / High が nil の場合はその側に制限がない
+// 複合インデックスでは先頭のカラムだけを指定してもよい（接頭辞で比較する）
+type KeyRange struct {
+	Low           []Value
+	High          []Value
+	LowInclusive  bool
+	HighInclusive bool
+}
+
+// NewKeyRangeEqual は key に一致する範囲を作成する
+func NewKeyRangeEqual(key ...Value) KeyRange {
+	return KeyRange{Low: key, High: key, LowInclusive: true, HighInclusive: true}
+}
+
+// IsPoint は1つのキーに一致する範囲かどうかを返す
+func (r KeyRange) IsPoint() bool {
+	if r.Low == nil || len(r.Low) != len(r.High) || !r.LowInclusive || !r.HighInclusive {
+		return false
+	}
+	for i := range r.Low {
+		if r.Low[i] != r.High[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// TableIndex はテーブルのカラムに張られたインデックス
+// 実装は index パッケージにあり、テーブルは行の変更に合わせてこのインターフェースで更新する
+type TableIndex interface {
+	// GetName はインデックス名を返す
+	GetName() string
+	// GetColumnIndexes はインデックス対象のカラム位置を返す（複合キーなら複数）
+	GetColumnIndexes() []int
+	// IsUnique は重複キーを許さないかどうかを返す
+	IsUnique() bool
+	// Add はキーと行IDを追加する（ユニークインデックスで重複すればエラー）
+	Add(key []Value, rowID int64) error
+	// Remove はキーと行IDの組を取り除く
+	Remove(key []Value, rowID int64) error
+	// Lookup は範囲に含まれるキーを持つ行IDをキーの昇順で返す
+	Lookup(r KeyRange) ([]int64, error)
+	// Close はインデックスを書き出して閉じる
+	Close() error
+	// Drop は書き出さずに閉じる（インデックスを削除するときに使う）
+	Drop() error
+}
+
+// AddIndex はインデックスを登録し、既存の行で構築する
+// 構築中は行の変更を止める
+func (t *Table) AddIndex(idx TableIndex) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.getIndex(idx.GetName()) != nil {
+		return fmt.Errorf("%w: %s", ErrIndexExists, idx.GetName())
+	}
+	for i := 0; i < int(t.numPages); i++ {
+		page, err := t.getPage(PageID(i))
+		if err != nil {
+			return err
+		}
+		for j := 0; j < int(page.rowCount()); j++ {
+			rowData, err := page.GetRow(uint16(j))
+			if err == ErrSlotDeleted {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			row, err := t.decodeStoredRow(rowData)
+			if err != nil {
+				return err
+			}
+			key := indexKey(idx, row.GetValues())
+			if key == nil {
+				continue
+			}
+			if err := idx.Add(key, row.GetRowID()); err != nil {
+				return err
+			}
+		}
+	}
+	t.indexes = append(t.indexes, idx)
+	return nil
+}
+
+// AttachIndex は構築済みのインデックスを既存の行を読まずに登録する
+// 前回正常に閉じられたディスク上のインデックスを開き直すときに使う
+func (t *Table) AttachIndex(idx TableIndex) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.getIndex(idx.GetName()) != nil {
+		return fmt.Errorf("%w: %s", ErrIndexExists, idx.GetName())
+	}
+	t.indexes = append(t.indexes, idx)
+	return nil
+}
+
+// RemoveIndex はインデックスの登録を外す
+func (t *Table) RemoveIndex(name string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, idx := range t.indexes {
+		if idx.GetName() == name {
+			t.indexes = append(t.indexes[:i], t.indexes[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrIndexNotFound, name)
+}
+
+// GetIndex は名前でインデックスを探す（なければ nil）
+func (t *Table) GetIndex(name string) TableIndex {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.getIndex(name)
+}
+
+func (t *Table) getIndex(name string) TableIndex {
+	for _, idx := range t.indexes {
+		if idx.GetName() == name {
+			return idx
+		}
+	}
+	return nil
+}
+
+// GetIndexes はテーブルのインデックス一覧を返す
+func (t *Table) GetIndexes() []TableIndex {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return slices.Clone(t.indexes)
+}
+
+// LookupIndex はインデックスを検索し、範囲に含まれるキーを持つ行IDを返す
+// 行の変更と同時にインデックスを読まないように、テーブルの mu を持って検索する
+func (t *Table) LookupIndex(idx TableIndex, r KeyRange) ([]int64, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return idx.Lookup(r)
+}
+
+// indexKey は行からインデックスのキーを取り出す
+// 先頭のカラムが NULL の行、ユニークインデックスでいずれかのカラムが NULL の行は
+// インデックスに載せない（nil を返す）
+func indexKey(idx TableIndex, values []Value) []Value {
+	columns := idx.GetColumnIndexes()
+	key := make([]Value, len(columns))
+	for i, col := range columns {
+		key[i] = values[col]
+		if key[i] == nil && (i == 0 || idx.IsUnique()) {
+			return nil
+		}
+	}
+	return key
+}
+
+// closeIndexes はすべてのインデックスを閉じる
+func (t *Table) closeIndexes() error {
+	var firstErr error
+	for _, idx := range t.indexes {
+		if err := idx.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// dropIndexes はすべてのインデックスを書き出さずに閉じる
+func (t *Table) dropIndexes() error {
+	var firstErr error
+	for _, idx := range t.indexes {
+		if err := idx.Drop(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	t.indexes = nil
+	return firstErr
+}
+
+// indexInsert は行をすべてのインデックスに追加する
+// 途中で失敗した場合は追加済みのインデックスから取り除いて元に戻す
+func (t *Table) indexInsert(row *Row) error {
+	values := row.GetValues()
+	for i, idx := range t.indexes {
+		key := indexKey(idx, values)
+		if key == nil {
+			continue
+		}
+		if err := idx.Add(key, row.GetRowID()); err != nil {
+			t.indexDelete(row, i)
+			return err
+		}
+	}
+	return nil
+}
+
+// indexReplace はインデックスのエントリを oldRow の値から newRow の値に付け替える
+// 途中で失敗したら、付け替えたインデックスを元に戻してエラーを返す
+func (t *Table) indexReplace(oldRow, newRow *Row) error {
+	for i, idx := range t.indexes {
+		if err := replaceIndexEntry(idx, oldRow, newRow); err != nil {
+			for _, done := range t.indexes[:i] {
+				replaceIndexEntry(done, newRow, oldRow)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceIndexEntry は1つのインデックスのエントリを付け替える
+// 新しい値を追加できなければ古い値を戻す
+func replaceIndexEntry(idx TableIndex, oldRow, newRow *Row) error {
+	oldKey := indexKey(idx, oldRow.GetValues())
+	newKey := indexKey(idx, newRow.GetValues())
+	if oldKey != nil {
+		if err := idx.Remove(oldKey, oldRow.GetRowID()); err != nil {
+			return err
+		}
+	}
+	if newKey != nil {
+		if err := idx.Add(newKey, newRow.GetRowID()); err != nil {
+			if oldKey != nil {
+				idx.Add(oldKey, oldRow.GetRowID())
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// indexDelete は先頭から count 個のインデックスから行を取り除く
+func (t *Table) indexDelete(row *Row, count int) error {
+	values := row.GetValues()
+	for _, idx := range t.indexes[:count] {
+		key := indexKey(idx, values)
+		if key == nil {
+			continue
+		}
+		if err := idx.Remove(key, row.GetRowID()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+var errFakeDuplicate = errors.New("duplicate")
+
+// fakeIndex は Int32 キーを map で管理するテスト用のインデックス
+type fakeIndex struct {
+	name    string
+	column  int
+	unique  bool
+	entries map[int32][]int64
+}
+
+func newFakeIndex(name string, column int, unique bool) *fakeIndex {
+	return &fakeIndex{name: name, column: column, unique: unique, entries: make(map[int32][]int64)}
+}
+
+func (f *fakeIndex) GetName() string         { return f.name }
+func (f *fakeIndex) GetColumnIndexes() []int { return []int{f.column} }
+func (f *fakeIndex) IsUnique() bool          { return f.unique }
+func (f *fakeIndex) Close() error            { return nil }
+func (f *fakeIndex) Drop() error             { return nil }
+
+func (f *fakeIndex) Add(key []Value, rowID int64) error {
+	k := int32(key[0].(Int32Value))
+	if f.unique && len(f.entries[k]) > 0 {
+		return errFakeDuplicate
+	}
+	f.entries[k] = append(f.entries[k], rowID)
+	return nil
+}
+
+func (f *fakeIndex) Remove(key []Value, rowID int64) error {
+	k := int32(key[0].(Int32Value))
+	for i, id := range f.entries[k] {
+		if id == rowID {
+			f.entries[k] = append(f.entries[k][:i], f.entries[k][i+1:]...)
+			return nil
+		}
+	}
+	return ErrRowNotFound
+}
+
+func (f *fakeIndex) Lookup(r KeyRange) ([]int64, error) {
+	return f.entries[int32(r.Low[0].(Int32Value))], nil
+}
+
+func newIndexedTestTable(t *testing.T) *Table {
+	t.Helper()
+	schema := NewSchema("users", []Column{
+		*NewColumn("id", ColumnTypeInt32, 4, false),
+		*NewColumn("age", ColumnTypeInt32, 4, false),
+	})
+	table, err := NewTable("users", schema, newTestPager(t, "users.db"))
+	if err != nil {
+		t.Fatalf("NewTable failed: %v", err)
+	}
+	return table
+}
+
+func TestTableAddIndexBuildsFromExistingRows(t *testing.T) {
+	table := newIndexedTestTable(t)
+	table.Insert(NewRow([]Value{Int32Value(1), Int32Value(20)}))
+	table.Insert(NewRow([]Value{Int32Value(2), Int32Value(20)}))
+
+	idx := newFakeIndex("age_idx", 1, false)
+	if err := table.AddIndex(idx); err != nil {
+		t.Fatalf("AddIndex failed: %v", err)
+	}
+	if got := len(idx.entries[20]); got != 2 {
+		t.Errorf("expected 2 entries for age=20, got %d", got)
+	}
+	if err := table.AddIndex(newFakeIndex("age_idx", 1, false)); !errors.Is(err, ErrIndexExists) {
+		t.Errorf("expected ErrIndexExists, got %v", err)
+	}
+
+	// 重複がある列にユニークインデックスは作れない
+	if err := table.AddIndex(newFakeIndex("age_uniq", 1, true)); err == nil {
+		t.Error("expected error for unique index on duplicated column")
+	}
+	if table.GetIndex("age_uniq") != nil {
+		t.Error("failed index should not be registered")
+	}
+}
+
+func TestTableMaintainsIndexes(t *testing.T) {
+	table := newIndexedTestTable(t)
+	pk := newFakeIndex("users_pkey", 0, true)
+	age := newFakeIndex("age_idx", 1, false)
+	table.AddIndex(pk)
+	table.AddIndex(age)
+
+	row := NewRow([]Value{Int32Value(1), Int32Value(20)})
+	if err := table.Insert(row); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	rowID := row.GetRowID()
+
+	// 一意性違反の行はテーブルにもインデックスにも残らない
+	if err := table.Insert(NewRow([]Value{Int32Value(1), Int32Value(30)})); !errors.Is(err, errFakeDuplicate) {
+		t.Fatalf("expected duplicate error, got %v", err)
+	}
+	if rows, _ := table.Scan(); len(rows) != 1 {
+		t.Errorf("expected 1 row, got %d", len(rows))
+	}
+	if len(age.entries[30]) != 0 {
+		t.Error("age index should be rolled back")
+	}
+
+	// Update はキーを付け替える
+	if _, err := table.Update(rowID, NewRow([]Value{Int32Value(2), Int32Value(25)})); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if len(pk.entries[1]) != 0 || len(pk.entries[2]) != 1 || len(age.entries[25]) != 1 {
+		t.Errorf("indexes not updated: pk=%v age=%v", pk.entries, age.entries)
+	}
+
+	// 一意性違反の Update は元に戻る
+	other := NewRow([]Value{Int32Value(3), Int32Value(40)})
+	table.Insert(other)
+	if _, err := table.Update(other.GetRowID(), NewRow([]Value{Int32Value(2), Int32Value(40)})); err == nil {
+		t.Fatal("expected duplicate error on update")
+	}
+	if len(pk.entries[3]) != 1 || len(age.entries[40]) != 1 {
+		t.Errorf("indexes should keep original keys: pk=%v age=%v", pk.entries, age.entries)
+	}
+
+	// Delete はインデックスからも取り除く
+	if _, err := table.Delete(rowID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if len(pk.entries[2]) != 0 || len(age.entries[25]) != 0 {
+		t.Errorf("indexes not cleaned up: pk=%v age=%v", pk.entries, age.entries)
+	}
+
+	if err := table.RemoveIndex("age_idx"); err != nil {
+		t.Fatalf("RemoveIndex failed: %v", err)
+	}
+	if err := table.RemoveIndex("age_idx"); !errors.Is(err, ErrIndexNotFound) {
+		t.Errorf("expected ErrIndexNotFound, got %v", err)
+	}
+	if len(table.GetIndexes()) != 1 {
+		t.Errorf("expected 1 index, got %d", len(table.GetIndexes()))
+	}
+}
+
+func TestTableUpdateRestoresIndexesOnFailure(t *testing.T) {
+	table := newIndexedTestTable(t)
+	age := newFakeIndex("age_idx", 1, false)
+	pk := newFakeIndex("users_pkey", 0, true)
+	table.AddIndex(age)
+	table.AddIndex(pk)
+	first := NewRow([]Value{Int32Value(1), Int32Value(20)})
+	table.Insert(first)
+	table.Insert(NewRow([]Value{Int32Value(2), Int32Value(30)}))
+
+	// 後ろのインデックスで失敗したら、付け替え済みの前のインデックスも元に戻す
+	if _, err := table.Update(first.GetRowID(), NewRow([]Value{Int32Value(2), Int32Value(25)})); !errors.Is(err, errFakeDuplicate) {
+		t.Fatalf("expected duplicate error, got %v", err)
+	}
+	if len(age.entries[20]) != 1 || len(age.entries[25]) != 0 || len(pk.entries[1]) != 1 {
+		t.Errorf("indexes should keep original keys: pk=%v age=%v", pk.entries, age.entries)
+	}
+}
+
+func TestTableUpdateKeepsRowWhenRowDoesNotFit(t *testing.T) {
+	// NULL の行は小さいが、すべての値を埋めるとページに入らない
+	columns := make([]Column, 1000)
+	for i := range columns {
+		columns[i] = *NewColumn(fmt.Sprintf("c%d", i), ColumnTypeInt32, 4, i > 0)
+	}
+	table, err := NewTable("wide", NewSchema("wide", columns), newTestPager(t, "wide.db"))
+	if err != nil {
+		t.Fatalf("NewTable failed: %v", err)
+	}
+	pk := newFakeIndex("wide_pkey", 0, true)
+	table.AddIndex(pk)
+
+	values := make([]Value, len(columns))
+	values[0] = Int32Value(1)
+	row := NewRow(values)
+	if err := table.Insert(row); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	full := make([]Value, len(columns))
+	for i := range full {
+		full[i] = Int32Value(int32(i + 2))
+	}
+	if _, err := table.Update(row.GetRowID(), NewRow(full)); !errors.Is(err, ErrPageFull) {
+		t.Fatalf("expected ErrPageFull, got %v", err)
+	}
+
+	// インデックスも行も更新前のまま
+	if len(pk.entries[1]) != 1 || len(pk.entries[2]) != 0 {
+		t.Errorf("index should keep original key: %v", pk.entries)
+	}
+	got, err := table.FindByRowID(row.GetRowID())
+	if err != nil {
+		t.Fatalf("FindByRowID failed: %v", err)
+	}
+	if got.GetValues()[0] != Int32Value(1) || got.GetValues()[1] != nil {
+		t.Errorf("row should be unchanged, got %v", got.GetValues()[:2])
+	}
+	if table.numPages != 1 {
+		t.Errorf("failed update should not allocate pages, got %d pages", table.numPages)
+	}
+}
+
+func TestTableGetRowCostDoesNotReadPages(t *testing.T) {
+	table := newIndexedTestTable(t)
+	for i := int32(1); i <= 3; i++ {
+		if err := table.Insert(NewRow([]Value{Int32Value(i), Int32Value(20)})); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+	if _, err := table.Delete(2); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	before := table.pool.Stats()
+	if got := table.GetRowCost(); got != 2 {
+		t.Errorf("expected row cost 2, got %d", got)
+	}
+	after := table.pool.Stats()
+	if after.Hits != before.Hits || after.Misses != before.Misses {
+		t.Errorf("GetRowCost should not fetch pages: before %+v, after %+v", before, after)
+	}
+}
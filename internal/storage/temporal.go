@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	dateLayout      = "2006-01-02"
+	timeLayout      = "15:04:05.999999"
+	timestampLayout = dateLayout + " " + timeLayout
+	secondsPerDay   = 24 * 60 * 60
+)
+
+// DateValue は 1970-01-01 からの日数
+type DateValue int32
+
+// NewDateValue は時刻の日付部分（UTC）を DateValue にする
+func NewDateValue(t time.Time) DateValue {
+	y, m, d := t.UTC().Date()
+	return DateValue(time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / secondsPerDay)
+}
+
+// ParseDate は "2024-01-31" の形式の日付を読む
+func ParseDate(s string) (DateValue, error) {
+	t, err := time.Parse(dateLayout, strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid date %q", ErrInvalidData, s)
+	}
+	return NewDateValue(t), nil
+}
+
+func (v DateValue) Type() ColumnType { return ColumnTypeDate }
+
+func (v DateValue) Size() int { return 4 }
+
+func (v DateValue) Encode() []byte {
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf, uint32(v))
+	return buf
+}
+
+// Time は日付の 0 時（UTC）を返す
+func (v DateValue) Time() time.Time {
+	return time.Unix(int64(v)*secondsPerDay, 0).UTC()
+}
+
+func (v DateValue) String() string {
+	return v.Time().Format(dateLayout)
+}
+
+// TimeValue は 0 時からのマイクロ秒
+type TimeValue int64
+
+// NewTimeValue は時刻の時刻部分（UTC）を TimeValue にする
+func NewTimeValue(t time.Time) TimeValue {
+	t = t.UTC()
+	return TimeValue(t.Sub(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)).Microseconds())
+}
+
+// ParseTime は "13:45:00" や "13:45:00.123456" の形式の時刻を読む
+func ParseTime(s string) (TimeValue, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{"15:04:05", "15:04"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return NewTimeValue(t), nil
+		}
+	}
+	return 0, fmt.Errorf("%w: invalid time %q", ErrInvalidData, s)
+}
+
+func (v TimeValue) Type() ColumnType { return ColumnTypeTime }
+
+func (v TimeValue) Size() int { return 8 }
+
+func (v TimeValue) Encode() []byte {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, uint64(v))
+	return buf
+}
+
+func (v TimeValue) String() string {
+	return time.UnixMicro(int64(v)).UTC().Format(timeLayout)
+}
+
+// TimestampValue は 1970-01-01 00:00:00 UTC からのマイクロ秒
+type TimestampValue int64
+
+// NewTimestampValue は時刻を TimestampValue にする（マイクロ秒より細かい部分は切り捨てる）
+func NewTimestampValue(t time.Time) TimestampValue {
+	return TimestampValue(t.UnixMicro())
+}
+
+// ParseTimestamp は "2024-01-31 13:45:00" の形式の日時を読む
+// 日付だけなら 0 時、タイムゾーンがなければ UTC とみなす
+func ParseTimestamp(s string) (TimestampValue, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02T15:04:05", time.RFC3339Nano, "2006-01-02 15:04", dateLayout} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return NewTimestampValue(t), nil
+		}
+	}
+	return 0, fmt.Errorf("%w: invalid timestamp %q", ErrInvalidData, s)
+}
+
+func (v TimestampValue) Type() ColumnType { return ColumnTypeTimestamp }
+
+func (v TimestampValue) Size() int { return 8 }
+
+func (v TimestampValue) Encode() []byte {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, uint64(v))
+	return buf
+}
+
+// Time は日時を time.Time（UTC）にする
+func (v TimestampValue) Time() time.Time {
+	return time.UnixMicro(int64(v)).UTC()
+}
+
+func (v TimestampValue) String() string {
+	return v.Time().Format(timestampLayout)
+}
@@ -6,6 +6,7 @@ package storage
 import (
 	"encoding/binary"
 	"encoding/gob"
+	"math"
 )
 
 func init() {
@@ -14,6 +15,14 @@ func init() {
 	gob.Register(Int64Value(0))
 	gob.Register(StringValue(""))
 	gob.Register(BoolValue(false))
+	gob.Register(Float32Value(0))
+	gob.Register(Float64Value(0))
+	gob.Register(DecimalValue{})
+	gob.Register(DateValue(0))
+	gob.Register(TimeValue(0))
+	gob.Register(TimestampValue(0))
+	gob.Register(TextValue(""))
+	gob.Register(BlobValue(""))
 }
 
 type ColumnType int
@@ -25,8 +34,45 @@ const (
 	ColumnTypeFloat64
 	ColumnTypeString
 	ColumnTypeBool
+	ColumnTypeDecimal   // 固定小数点数（カラムのサイズが精度、スケールは Column.GetScale）
+	ColumnTypeDate      // 日付
+	ColumnTypeTime      // 時刻
+	ColumnTypeTimestamp // 日時（UTC）
+	ColumnTypeText      // 長い文字列（大きな値はオーバーフローページに置く）
+	ColumnTypeBlob      // バイナリ（大きな値はオーバーフローページに置く）
 )
 
+func (t ColumnType) String() string {
+	switch t {
+	case ColumnTypeInt32:
+		return "INT"
+	case ColumnTypeInt64:
+		return "BIGINT"
+	case ColumnTypeFloat32:
+		return "FLOAT"
+	case ColumnTypeFloat64:
+		return "DOUBLE"
+	case ColumnTypeString:
+		return "VARCHAR"
+	case ColumnTypeBool:
+		return "BOOL"
+	case ColumnTypeDecimal:
+		return "DECIMAL"
+	case ColumnTypeDate:
+		return "DATE"
+	case ColumnTypeTime:
+		return "TIME"
+	case ColumnTypeTimestamp:
+		return "TIMESTAMP"
+	case ColumnTypeText:
+		return "TEXT"
+	case ColumnTypeBlob:
+		return "BLOB"
+	default:
+		return "UNKNOWN"
+	}
+}
+
 // TODO: Datum でもいいかも
 type Value interface {
 	Type() ColumnType
@@ -87,3 +133,29 @@ func (v Int64Value) Encode() []byte {
 	binary.LittleEndian.PutUint64(buf, uint64(v))
 	return buf
 }
+
+// Float32
+type Float32Value float32
+
+func (v Float32Value) Type() ColumnType { return ColumnTypeFloat32 }
+
+func (v Float32Value) Size() int { return 4 }
+
+func (v Float32Value) Encode() []byte {
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf, math.Float32bits(float32(v)))
+	return buf
+}
+
+// Float64
+type Float64Value float64
+
+func (v Float64Value) Type() ColumnType { return ColumnTypeFloat64 }
+
+func (v Float64Value) Size() int { return 8 }
+
+func (v Float64Value) Encode() []byte {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, math.Float64bits(float64(v)))
+	return buf
+}
@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/takeuchi-shogo/go-example-database/internal/session"
+	"github.com/takeuchi-shogo/go-example-database/internal/storage"
 )
 
 const (
@@ -115,12 +116,30 @@ func (r *Repl) print(s string, args ...interface{}) {
 }
 
 func (r *Repl) eval(input string) {
-	result, err := r.session.Execute(input)
+	// SELECT の結果は行が生成されるたびに表示する
+	result, err := r.session.Stream(input, func(row *storage.Row) error {
+		_, err := fmt.Fprintln(r.output, formatRow(row))
+		return err
+	})
 	if err != nil {
 		fmt.Fprintln(r.output, "Error:", err)
 		return
 	}
-	fmt.Fprintln(r.output, result.String())
+	fmt.Fprintln(r.output, result.GetMessage())
+}
+
+// formatRow は行を "値 | 値 | ..." の形式に整形する
+func formatRow(row *storage.Row) string {
+	values := row.GetValues()
+	columns := make([]string, len(values))
+	for i, v := range values {
+		if v == nil {
+			columns[i] = "NULL"
+			continue
+		}
+		columns[i] = fmt.Sprintf("%v", v)
+	}
+	return strings.Join(columns, " | ")
 }
 
 var goodbyeMessages = []string{